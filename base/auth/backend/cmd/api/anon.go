@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/anonlogin"
+)
+
+const (
+	// defaultAnonDifficulty は匿名トークンのプルーフオブワークの既定の難易度（先頭0ビット数）。
+	// ブラウザで1秒未満に解ける程度にする。
+	defaultAnonDifficulty = 18
+	// maxAnonDifficulty はクライアントが現実的な時間で解ける上限。
+	maxAnonDifficulty     = 32
+	defaultAnonChallenge  = 2 * time.Minute
+	defaultAnonJWTExpires = 15 * time.Minute
+)
+
+// ResolveAnon はテナントの匿名トークン発行用依存を解決する。
+func (r *tenantResolver) ResolveAnon(tenantID string) (httpadapter.AnonTenantDeps, error) {
+	if v, ok := r.anonCache.Load(tenantID); ok {
+		return v.(httpadapter.AnonTenantDeps), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return httpadapter.AnonTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+
+	ac := cfg.Anonymous
+	if ac.ChallengeSecret == "" || ac.SubjectSecret == "" || ac.JWTSecret == "" {
+		if _, logged := r.anonDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+			r.logf("tenant %s: anonymous tokens disabled (missing challengeSecret, subjectSecret or jwtSecret)", tenantID)
+		}
+		return httpadapter.AnonTenantDeps{}, httpadapter.ErrAnonDisabled
+	}
+
+	difficulty := ac.Difficulty
+	if difficulty == 0 {
+		difficulty = defaultAnonDifficulty
+	}
+	if difficulty < 0 || difficulty > maxAnonDifficulty {
+		return httpadapter.AnonTenantDeps{}, fmt.Errorf("tenant %s: anonymous.difficulty must be between 1 and %d", tenantID, maxAnonDifficulty)
+	}
+	challengeTTL := ac.ChallengeTTL
+	if challengeTTL <= 0 {
+		challengeTTL = defaultAnonChallenge
+	}
+	expiresIn := ac.JWTExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = defaultAnonJWTExpires
+	}
+
+	challenges := anonlogin.NewHMACChallengeManager([]byte(ac.ChallengeSecret), difficulty, challengeTTL, r.nonces)
+	tokenIssuer := anonlogin.NewJWTIssuer([]byte(ac.JWTSecret), ac.JWTIssuer, ac.JWTAudience, expiresIn)
+	deps := httpadapter.AnonTenantDeps{
+		Usecase:        anonlogin.NewUsecase(challenges, tokenIssuer, []byte(ac.SubjectSecret)),
+		AllowedOrigins: toSet(cfg.AllowedOrigins),
+	}
+	r.anonCache.Store(tenantID, deps)
+	return deps, nil
+}
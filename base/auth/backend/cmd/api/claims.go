@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sngm3741/roots/base/auth/internal/tenant"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/twitterlogin"
+)
+
+// profileClaims はプロフィール項目のクレーム設定を検証し、クレーム名に claimNamespace を前置して返す。
+// 標準クレームと衝突しないよう、設定がある場合は claimNamespace を必須にする。
+func profileClaims(tenantID, provider, namespace string, fields []string, cfgs []tenant.ProfileClaimConfig) ([]tenant.ProfileClaimConfig, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		return nil, fmt.Errorf("tenant %s: claimNamespace is required for %s.profileClaims", tenantID, provider)
+	}
+	known := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		known[f] = struct{}{}
+	}
+
+	out := make([]tenant.ProfileClaimConfig, 0, len(cfgs))
+	for i, c := range cfgs {
+		field := strings.TrimSpace(c.Field)
+		claim := strings.TrimSpace(c.Claim)
+		if field == "" || claim == "" {
+			return nil, fmt.Errorf("tenant %s: %s.profileClaims[%d] requires field and claim", tenantID, provider, i)
+		}
+		root, _, _ := strings.Cut(field, ".")
+		if _, ok := known[root]; !ok {
+			return nil, fmt.Errorf("tenant %s: %s.profileClaims[%d].field %q is not listed in profileFields", tenantID, provider, i, field)
+		}
+		out = append(out, tenant.ProfileClaimConfig{Field: field, Claim: namespace + claim})
+	}
+	return out, nil
+}
+
+func lineProfileClaims(cfgs []tenant.ProfileClaimConfig) []linelogin.ProfileClaim {
+	out := make([]linelogin.ProfileClaim, 0, len(cfgs))
+	for _, c := range cfgs {
+		out = append(out, linelogin.ProfileClaim{Field: c.Field, Claim: c.Claim})
+	}
+	return out
+}
+
+func twitterProfileClaims(cfgs []tenant.ProfileClaimConfig) []twitterlogin.ProfileClaim {
+	out := make([]twitterlogin.ProfileClaim, 0, len(cfgs))
+	for _, c := range cfgs {
+		out = append(out, twitterlogin.ProfileClaim{Field: c.Field, Claim: c.Claim})
+	}
+	return out
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/fakeidp"
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+	"github.com/sngm3741/roots/base/auth/internal/tenant"
+)
+
+const (
+	e2eHost   = "e2e.auth.example.com"
+	e2eOrigin = "https://app.example.com"
+)
+
+// 実際の infra/external クライアント・リダイレクト・PKCE・state Cookie を通して、偽IdPに対するログインを端から端まで確認する。
+func TestLoginFlows_FakeIdP(t *testing.T) {
+	t.Parallel()
+
+	router, idpClient := newE2EServer(t)
+
+	tests := []struct {
+		name        string
+		provider    string
+		action      string
+		user        string
+		wantSuccess bool
+		wantUserID  string
+	}{
+		{name: "LINE ログイン", provider: "line", user: "U123", wantSuccess: true, wantUserID: "U123"},
+		{name: "LINE キャンセル", provider: "line", action: fakeidp.ActionCancel},
+		{name: "LINE 不正な認可コード", provider: "line", action: fakeidp.ActionInvalidCode},
+		{name: "X ログイン（PKCE）", provider: "twitter", wantSuccess: true, wantUserID: "1000000001"},
+		{name: "X キャンセル", provider: "twitter", action: fakeidp.ActionCancel},
+		{name: "X エラー", provider: "twitter", action: fakeidp.ActionError},
+		{name: "Apple ログイン（id_token）", provider: "apple", user: "000123.abc", wantSuccess: true, wantUserID: "000123.abc"},
+		{name: "Apple キャンセル", provider: "apple", action: fakeidp.ActionCancel},
+		{name: "Apple 不正な認可コード", provider: "apple", action: fakeidp.ActionInvalidCode},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// 1. auth でログインを開始し、認可URLと state Cookie を受け取る。
+			body, _ := json.Marshal(map[string]string{"origin": e2eOrigin})
+			req := httptest.NewRequest(http.MethodPost, "/"+tt.provider+"/login", bytes.NewReader(body))
+			req.Host = e2eHost
+			req.Header.Set("Origin", e2eOrigin)
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("login start status=%d body=%s", rr.Code, rr.Body.String())
+			}
+			var start struct {
+				AuthorizationURL string `json:"authorizationUrl"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &start); err != nil {
+				t.Fatalf("decode login start: %v", err)
+			}
+			cookies := rr.Result().Cookies()
+
+			// 2. 偽IdPの認可エンドポイントを画面操作の代わりにクエリで制御して呼ぶ。
+			authorizeURL := start.AuthorizationURL
+			if tt.action != "" {
+				authorizeURL += "&" + fakeidp.ParamAction + "=" + tt.action
+			}
+			if tt.user != "" {
+				authorizeURL += "&" + fakeidp.ParamUser + "=" + url.QueryEscape(tt.user)
+			}
+			res, err := idpClient.Get(authorizeURL)
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+			defer res.Body.Close()
+
+			// 3. IdPの応答をauthのコールバックへ渡す（Appleはform_post、それ以外はリダイレクト）。
+			var callback *http.Request
+			if tt.provider == "apple" {
+				action, form := parseFormPost(t, res)
+				target, _ := url.Parse(action)
+				callback = httptest.NewRequest(http.MethodPost, target.RequestURI(), strings.NewReader(form.Encode()))
+				callback.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				if res.StatusCode != http.StatusFound {
+					t.Fatalf("authorize status=%d", res.StatusCode)
+				}
+				target, err := url.Parse(res.Header.Get("Location"))
+				if err != nil {
+					t.Fatalf("parse redirect: %v", err)
+				}
+				callback = httptest.NewRequest(http.MethodGet, target.RequestURI(), nil)
+			}
+			callback.Host = e2eHost
+			for _, c := range cookies {
+				callback.AddCookie(c)
+			}
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, callback)
+
+			// 4. アプリへのリダイレクトのフラグメントに載った結果を確認する。
+			result := decodeLoginResult(t, rr)
+			if result.Success != tt.wantSuccess {
+				t.Fatalf("success=%v want=%v result=%+v", result.Success, tt.wantSuccess, result)
+			}
+			if !tt.wantSuccess {
+				if result.Error == "" {
+					t.Fatalf("error message is empty: %+v", result)
+				}
+				return
+			}
+			if result.Payload.AccessToken == "" {
+				t.Fatalf("access token is empty: %+v", result)
+			}
+			if got := result.userID(); got != tt.wantUserID {
+				t.Fatalf("user id=%q want=%q", got, tt.wantUserID)
+			}
+		})
+	}
+}
+
+// newE2EServer は偽IdPを起動し、そこへ向けたテナント設定で auth のルーターを組み立てる。
+func newE2EServer(t *testing.T) (http.Handler, *http.Client) {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	idp, err := fakeidp.New(fakeidp.Config{
+		BaseURL: ts.URL,
+		Clients: map[string]string{
+			"line-channel":    "line-secret",
+			"x-client":        "",
+			"com.example.web": "",
+		},
+	})
+	if err != nil {
+		t.Fatalf("fakeidp: %v", err)
+	}
+	ts.Config.Handler = idp.Handler()
+
+	appleKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate apple key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(appleKey)
+	if err != nil {
+		t.Fatalf("marshal apple key: %v", err)
+	}
+	applePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	cfg := `auth:
+  e2e:
+    allowedOrigins: ["` + e2eOrigin + `"]
+    defaultRedirectOrigin: ` + e2eOrigin + `
+    redirectPath: /auth/result
+    line:
+      channelID: line-channel
+      channelSecret: line-secret
+      redirectURI: https://` + e2eHost + `/line/callback
+      scopes: ["profile"]
+      stateSecret: lstate
+      stateTTL: 10m
+      jwtSecret: ljwt
+      jwtExpiresIn: 1h
+      endpoints:
+        authorize: ` + ts.URL + `/line/authorize
+        token: ` + ts.URL + `/line/token
+        profile: ` + ts.URL + `/line/profile
+    twitter:
+      clientID: x-client
+      redirectURI: https://` + e2eHost + `/twitter/callback
+      scopes: ["users.read", "tweet.read", "offline.access"]
+      stateSecret: tstate
+      stateTTL: 10m
+      jwtSecret: tjwt
+      jwtExpiresIn: 1h
+      endpoints:
+        authorize: ` + ts.URL + `/twitter/authorize
+        token: ` + ts.URL + `/twitter/token
+        profile: ` + ts.URL + `/twitter/users/me
+    apple:
+      clientID: com.example.web
+      teamID: TEAM123456
+      keyID: KEY1234567
+      privateKey: |
+` + indent(string(applePEM), "        ") + `
+      redirectURI: https://` + e2eHost + `/apple/callback
+      scopes: ["name", "email"]
+      stateSecret: astate
+      stateTTL: 10m
+      jwtSecret: ajwt
+      jwtExpiresIn: 1h
+      endpoints:
+        issuer: ` + idp.AppleIssuer() + `
+        authorize: ` + ts.URL + `/apple/authorize
+        token: ` + ts.URL + `/apple/token
+        jwks: ` + ts.URL + `/apple/keys
+`
+	path := filepath.Join(t.TempDir(), "tenants.yaml")
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatalf("write cfg: %v", err)
+	}
+	loader, err := tenant.NewLoader(path)
+	if err != nil {
+		t.Fatalf("load cfg: %v", err)
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resolver := newTenantResolver(loader, httpClient, noncestore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), func(string, ...any) {})
+	router := newRouter(resolver, 10*time.Second, log.New(io.Discard, "", 0))
+
+	// 認可エンドポイントのリダイレクト先は auth のホストなので、追わずに Location を読む。
+	idpClient := &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return router, idpClient
+}
+
+var hiddenInput = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)">`)
+var formAction = regexp.MustCompile(`<form method="post" action="([^"]+)">`)
+
+// parseFormPost は form_post の自動送信フォームから送信先と値を取り出す。
+func parseFormPost(t *testing.T, res *http.Response) (string, url.Values) {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("authorize status=%d", res.StatusCode)
+	}
+	page, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read form_post: %v", err)
+	}
+	action := formAction.FindStringSubmatch(string(page))
+	if action == nil {
+		t.Fatalf("form action not found: %s", page)
+	}
+	form := url.Values{}
+	for _, m := range hiddenInput.FindAllStringSubmatch(string(page), -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	return html.UnescapeString(action[1]), form
+}
+
+type e2eLoginResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	Payload struct {
+		AccessToken string `json:"accessToken"`
+		LineUser    struct {
+			UserID string `json:"userId"`
+		} `json:"lineUser"`
+		TwitterUser struct {
+			UserID string `json:"userId"`
+		} `json:"twitterUser"`
+		AppleUser struct {
+			UserID string `json:"userId"`
+		} `json:"appleUser"`
+	} `json:"payload"`
+}
+
+func (r e2eLoginResult) userID() string {
+	for _, id := range []string{r.Payload.LineUser.UserID, r.Payload.TwitterUser.UserID, r.Payload.AppleUser.UserID} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// decodeLoginResult はコールバックのリダイレクト先フラグメント（<prefix>=<base64url JSON>）を読む。
+func decodeLoginResult(t *testing.T, rr *httptest.ResponseRecorder) e2eLoginResult {
+	t.Helper()
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("callback status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	target, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse callback redirect: %v", err)
+	}
+	if !strings.HasPrefix(target.String(), e2eOrigin+"/auth/result#") {
+		t.Fatalf("unexpected redirect: %s", target)
+	}
+	_, encoded, ok := strings.Cut(target.Fragment, "=")
+	if !ok {
+		t.Fatalf("unexpected fragment: %s", target.Fragment)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decode fragment: %v", err)
+	}
+	var result e2eLoginResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	return result
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
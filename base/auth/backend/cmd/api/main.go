@@ -15,14 +15,26 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
 	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
 	"github.com/sngm3741/roots/base/auth/internal/config"
+	infraapple "github.com/sngm3741/roots/base/auth/internal/infra/external/apple"
+	infradiscord "github.com/sngm3741/roots/base/auth/internal/infra/external/discord"
 	infraline "github.com/sngm3741/roots/base/auth/internal/infra/external/line"
 	infratwitter "github.com/sngm3741/roots/base/auth/internal/infra/external/twitter"
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
 	"github.com/sngm3741/roots/base/auth/internal/tenant"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/anonlogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/applelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/discordlogin"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/twitterlogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/webhook"
 )
 
 const (
@@ -33,6 +45,14 @@ const (
 	twitterAuthorizeEndpoint = "https://twitter.com/i/oauth2/authorize"
 	twitterTokenEndpoint     = "https://api.twitter.com/2/oauth2/token"
 	twitterProfileEndpoint   = "https://api.twitter.com/2/users/me"
+	discordAuthorizeEndpoint = "https://discord.com/oauth2/authorize"
+	discordTokenEndpoint     = "https://discord.com/api/oauth2/token"
+	discordAPIBaseURL        = "https://discord.com/api/v10"
+	discordCDNBaseURL        = "https://cdn.discordapp.com"
+	appleIssuer              = "https://appleid.apple.com"
+	appleAuthorizeEndpoint   = "https://appleid.apple.com/auth/authorize"
+	appleTokenEndpoint       = "https://appleid.apple.com/auth/token"
+	appleJWKSEndpoint        = "https://appleid.apple.com/auth/keys"
 )
 
 // main はDIを行いHTTPサーバーを起動する。
@@ -46,6 +66,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load tenant config: %v", err)
 	}
+	if err := checkTokenVaultRetention(loader, appCfg.StateStore.VaultMaxTTL); err != nil {
+		log.Fatalf("invalid tenant config: %v", err)
+	}
 
 	logger := log.New(os.Stdout, "[auth] ", log.LstdFlags|log.Lmsgprefix)
 
@@ -53,15 +76,47 @@ func main() {
 		Timeout: appCfg.HTTPTimeout,
 	}
 
-	resolver := newTenantResolver(loader, httpClient, logger.Printf)
-	lineHandler := httpadapter.NewLineHandler(resolver, appCfg.HTTPTimeout, logger)
-	twitterHandler := httpadapter.NewTwitterHandler(resolver, appCfg.HTTPTimeout, logger)
+	nonces, grants, vaults, webhooks, closeStores, err := newStores(appCfg.StateStore)
+	if err != nil {
+		log.Fatalf("failed to init state store: %v", err)
+	}
+	defer closeStores()
+
+	resolver := newTenantResolver(loader, httpClient, nonces, grants, vaults, webhooks, logger.Printf)
+	router := newRouter(resolver, appCfg.HTTPTimeout, logger)
+
+	httpServer := &http.Server{
+		Addr:              appCfg.HTTPAddr,
+		Handler:           router,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		logger.Printf("HTTP サーバーを %s で待ち受けます", appCfg.HTTPAddr)
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	waitForShutdown(httpServer, resolver, errChan, logger)
+}
+
+// newRouter はミドルウェアと全プロバイダのルートを登録したルーターを組み立てる。
+func newRouter(resolver *tenantResolver, httpTimeout time.Duration, logger *log.Logger) http.Handler {
+	lineHandler := httpadapter.NewLineHandler(resolver, httpTimeout, logger)
+	twitterHandler := httpadapter.NewTwitterHandler(resolver, httpTimeout, logger)
+	discordHandler := httpadapter.NewDiscordHandler(resolver, httpTimeout, logger)
+	appleHandler := httpadapter.NewAppleHandler(resolver, httpTimeout, logger)
+	oidcHandler := httpadapter.NewOIDCHandler(resolver, httpTimeout, logger)
+	tokenVaultHandler := httpadapter.NewTokenVaultHandler(resolver, httpTimeout, logger)
+	anonHandler := httpadapter.NewAnonHandler(resolver, httpTimeout, logger)
+	sessionHandler := httpadapter.NewSessionHandler(resolver, logger)
+	webhookHandler := httpadapter.NewWebhookHandler(resolver, httpTimeout, logger)
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.Timeout(appCfg.HTTPTimeout))
+	router.Use(middleware.Timeout(httpTimeout))
 	router.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{
 		Logger:  logger,
 		NoColor: true,
@@ -75,25 +130,22 @@ func main() {
 		r.Use(httpadapter.WithTenant)
 		lineHandler.RegisterLineRoutes(r)
 		twitterHandler.RegisterRoutes(r)
+		discordHandler.RegisterRoutes(r)
+		appleHandler.RegisterRoutes(r)
+		oidcHandler.RegisterRoutes(r)
+		tokenVaultHandler.RegisterRoutes(r)
+		anonHandler.RegisterRoutes(r)
+		sessionHandler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
 	})
-
-	httpServer := &http.Server{
-		Addr:              appCfg.HTTPAddr,
-		Handler:           router,
-		ReadHeaderTimeout: 5 * time.Second,
-	}
-
-	errChan := make(chan error, 1)
-	go func() {
-		logger.Printf("HTTP サーバーを %s で待ち受けます", appCfg.HTTPAddr)
-		errChan <- httpServer.ListenAndServe()
-	}()
-
-	waitForShutdown(httpServer, errChan, logger)
+	return router
 }
 
-// waitForShutdown はSIGINT/SIGTERMを待ち、HTTPサーバーを安全に停止する。
-func waitForShutdown(httpServer *http.Server, errChan <-chan error, logger *log.Logger) {
+// webhookDrainTimeout は終了時に配信中のWebhookを待つ上限。
+const webhookDrainTimeout = 15 * time.Second
+
+// waitForShutdown はSIGINT/SIGTERMを待ち、HTTPサーバーを安全に停止してから配信中のWebhookを待つ。
+func waitForShutdown(httpServer *http.Server, resolver *tenantResolver, errChan <-chan error, logger *log.Logger) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sigChan)
@@ -113,23 +165,100 @@ func waitForShutdown(httpServer *http.Server, errChan <-chan error, logger *log.
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Printf("HTTP サーバーのシャットダウンに失敗しました: %v", err)
 	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), webhookDrainTimeout)
+	defer cancelDrain()
+	resolver.shutdownWebhooks(drainCtx)
 	logger.Println("シャットダウンが完了しました。")
 }
 
+// newStores は設定に応じてstate nonce・OIDCグラント・トークン保管庫のストアを生成する。
+func newStores(cfg config.StateStoreConfig) (nonceStore, oidcprovider.Store, tokenvault.Store, webhook.Store, func(), error) {
+	if cfg.Backend != config.StateStoreNATS {
+		return noncestore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), func() {}, nil
+	}
+	nc, err := natsgo.Connect(cfg.NATSURL)
+	if err != nil {
+		return nil, nil, nil, nil, nil, fmt.Errorf("connect nats: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, nil, nil, fmt.Errorf("jetstream: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nonces, err := noncestore.NewKV(ctx, js, cfg.KVBucket, cfg.MaxTTL)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, nil, nil, err
+	}
+	grants, err := grantstore.NewKV(ctx, js, cfg.GrantKVBucket, cfg.GrantMaxTTL)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, nil, nil, err
+	}
+	vaults, err := grantstore.NewKV(ctx, js, cfg.VaultKVBucket, cfg.VaultMaxTTL)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, nil, nil, err
+	}
+	webhooks, err := grantstore.NewKV(ctx, js, cfg.WebhookKVBucket, cfg.WebhookMaxTTL)
+	if err != nil {
+		nc.Close()
+		return nil, nil, nil, nil, nil, err
+	}
+	return nonces, grants, vaults, webhooks, func() { _ = nc.Drain() }, nil
+}
+
+// nonceStore は各プロバイダのStateManagerに渡すnonceストア。
+type nonceStore interface {
+	linelogin.NonceStore
+	twitterlogin.NonceStore
+	discordlogin.NonceStore
+	applelogin.NonceStore
+	anonlogin.NonceStore
+}
+
 type tenantResolver struct {
 	loader          *tenant.Loader
 	httpClient      *http.Client
+	nonces          nonceStore
+	grants          oidcprovider.Store
+	vaults          tokenvault.Store
+	webhooks        webhook.Store
 	lineCache       sync.Map
 	twitterCache    sync.Map
+	discordCache    sync.Map
+	appleCache      sync.Map
+	anonCache       sync.Map
+	oidcCache       sync.Map
+	oidcProviders   sync.Map
+	tokenVaults     sync.Map
+	tokenVaultCache sync.Map
+	pagesCache      sync.Map
+	sessions        sync.Map
+	dispatchers     sync.Map
 	logf            func(string, ...any)
 	lineDisabled    sync.Map
 	twitterDisabled sync.Map
+	discordDisabled sync.Map
+	appleDisabled   sync.Map
+	oidcDisabled    sync.Map
+	vaultDisabled   sync.Map
+	anonDisabled    sync.Map
+	sessionDisabled sync.Map
+	webhookDisabled sync.Map
 }
 
-func newTenantResolver(loader *tenant.Loader, httpClient *http.Client, logf func(string, ...any)) *tenantResolver {
+func newTenantResolver(loader *tenant.Loader, httpClient *http.Client, nonces nonceStore, grants oidcprovider.Store, vaults tokenvault.Store, webhooks webhook.Store, logf func(string, ...any)) *tenantResolver {
 	return &tenantResolver{
 		loader:     loader,
 		httpClient: httpClient,
+		nonces:     nonces,
+		grants:     grants,
+		vaults:     vaults,
+		webhooks:   webhooks,
 		logf:       logf,
 	}
 }
@@ -153,26 +282,60 @@ func (r *tenantResolver) ResolveLine(tenantID string) (httpadapter.LineTenantDep
 	}
 
 	allowed := toSet(cfg.AllowedOrigins)
-	stateMgr := linelogin.NewHMACStateManager([]byte(lineCfg.StateSecret), lineCfg.StateTTL)
-	tokenIssuer := linelogin.NewJWTIssuer([]byte(lineCfg.JWTSecret), lineCfg.JWTIssuer, lineCfg.JWTAudience, lineCfg.JWTExpiresIn)
-	lineClient := infraline.NewClient(
-		r.httpClient,
-		lineCfg.ChannelID,
-		lineCfg.ChannelSecret,
-		lineCfg.RedirectURI,
-		lineAuthorizeEndpoint,
-		lineTokenEndpoint,
-		lineProfileEndpoint,
-		defaultLineBotPrompt,
-		lineCfg.Scopes,
-	)
+	handoff := r.oidcHandoff(tenantID, allowed)
+	stateSecrets, err := r.rotatingSecrets(tenantID, "line.stateSecret", lineCfg.StateSecret, lineCfg.StateSecrets)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+	jwtSecrets, err := r.rotatingSecrets(tenantID, "line.jwtSecret", lineCfg.JWTSecret, lineCfg.JWTSecrets)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+	claims, err := profileClaims(tenantID, "line", cfg.ClaimNamespace, lineCfg.ProfileFields, lineCfg.ProfileClaims)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+	stateMgr := linelogin.NewRotatingHMACStateManager(lineSecrets(stateSecrets), lineCfg.StateTTL, r.nonces)
+	tokenIssuer := linelogin.NewRotatingJWTIssuer(lineSecrets(jwtSecrets), lineCfg.JWTIssuer, lineCfg.JWTAudience, lineCfg.JWTExpiresIn).
+		WithProfileClaims(lineProfileClaims(claims))
+	lineClient := r.newLineClient(lineCfg)
+
+	stateCookie, err := newStateCookie(cfg.StateCookie, lineCfg.StateTTL)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	pages, err := r.pages(tenantID, cfg.Pages)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+	session, err := r.session(tenantID)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+	notifier, err := r.loginNotifier(tenantID)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
+
+	vault, err := r.tokenVault(tenantID)
+	if err != nil {
+		return httpadapter.LineTenantDeps{}, err
+	}
 
 	usecase := linelogin.NewUsecase(stateMgr, lineClient, tokenIssuer, allowed, cfg.DefaultRedirectOrigin)
+	if vault != nil {
+		usecase = usecase.WithTokenVault(vault)
+	}
 	deps := httpadapter.LineTenantDeps{
 		Usecase:               usecase,
 		AllowedOrigins:        allowed,
 		DefaultRedirectOrigin: cfg.DefaultRedirectOrigin,
 		RedirectPath:          cfg.RedirectPath,
+		StateCookie:           stateCookie,
+		OIDC:                  handoff,
+		Pages:                 pages,
+		Session:               session,
+		Webhooks:              notifier,
 	}
 	r.lineCache.Store(tenantID, deps)
 	return deps, nil
@@ -197,29 +360,290 @@ func (r *tenantResolver) ResolveTwitter(tenantID string) (httpadapter.TwitterTen
 	}
 
 	allowed := toSet(cfg.AllowedOrigins)
-	stateMgr := twitterlogin.NewHMACStateManager([]byte(tw.StateSecret), tw.StateTTL)
-	tokenIssuer := twitterlogin.NewJWTIssuer([]byte(tw.JWTSecret), tw.JWTIssuer, tw.JWTAudience, tw.JWTExpiresIn)
-	twitterClient := infratwitter.NewClient(
+	handoff := r.oidcHandoff(tenantID, allowed)
+	stateSecrets, err := r.rotatingSecrets(tenantID, "twitter.stateSecret", tw.StateSecret, tw.StateSecrets)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+	jwtSecrets, err := r.rotatingSecrets(tenantID, "twitter.jwtSecret", tw.JWTSecret, tw.JWTSecrets)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+	claims, err := profileClaims(tenantID, "twitter", cfg.ClaimNamespace, tw.ProfileFields, tw.ProfileClaims)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+	stateMgr := twitterlogin.NewRotatingHMACStateManager(twitterSecrets(stateSecrets), tw.StateTTL, r.nonces)
+	tokenIssuer := twitterlogin.NewRotatingJWTIssuer(twitterSecrets(jwtSecrets), tw.JWTIssuer, tw.JWTAudience, tw.JWTExpiresIn).
+		WithProfileClaims(twitterProfileClaims(claims))
+	twitterClient := r.newTwitterClient(tw)
+	stateCookie, err := newStateCookie(cfg.StateCookie, tw.StateTTL)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	pages, err := r.pages(tenantID, cfg.Pages)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+	session, err := r.session(tenantID)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+	notifier, err := r.loginNotifier(tenantID)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+
+	vault, err := r.tokenVault(tenantID)
+	if err != nil {
+		return httpadapter.TwitterTenantDeps{}, err
+	}
+
+	usecase := twitterlogin.NewUsecase(stateMgr, twitterClient, tokenIssuer, allowed, cfg.DefaultRedirectOrigin)
+	if vault != nil {
+		usecase = usecase.WithTokenVault(vault)
+	}
+	deps := httpadapter.TwitterTenantDeps{
+		Usecase:               usecase,
+		AllowedOrigins:        allowed,
+		DefaultRedirectOrigin: cfg.DefaultRedirectOrigin,
+		RedirectPath:          cfg.RedirectPath,
+		StateCookie:           stateCookie,
+		OIDC:                  handoff,
+		Pages:                 pages,
+		Session:               session,
+		Webhooks:              notifier,
+	}
+	r.twitterCache.Store(tenantID, deps)
+	return deps, nil
+}
+
+// newLineClient はテナントのLINE設定からAPIクライアントを生成する。
+func (r *tenantResolver) newLineClient(lineCfg tenant.LineConfig) *infraline.Client {
+	return infraline.NewClient(
+		r.httpClient,
+		lineCfg.ChannelID,
+		lineCfg.ChannelSecret,
+		lineCfg.RedirectURI,
+		endpointOr(lineCfg.Endpoints.Authorize, lineAuthorizeEndpoint),
+		endpointOr(lineCfg.Endpoints.Token, lineTokenEndpoint),
+		endpointOr(lineCfg.Endpoints.Profile, lineProfileEndpoint),
+		defaultLineBotPrompt,
+		lineCfg.Scopes,
+	).WithProfileFields(lineCfg.ProfileFields)
+}
+
+// newTwitterClient はテナントのTwitter設定からAPIクライアントを生成する。
+func (r *tenantResolver) newTwitterClient(tw tenant.TwitterConfig) *infratwitter.Client {
+	return infratwitter.NewClient(
 		r.httpClient,
 		tw.ClientID,
 		tw.ClientSecret,
 		tw.RedirectURI,
-		twitterAuthorizeEndpoint,
-		twitterTokenEndpoint,
-		twitterProfileEndpoint,
+		endpointOr(tw.Endpoints.Authorize, twitterAuthorizeEndpoint),
+		endpointOr(tw.Endpoints.Token, twitterTokenEndpoint),
+		endpointOr(tw.Endpoints.Profile, twitterProfileEndpoint),
 		tw.Scopes,
+	).WithUserFields(tw.ProfileFields)
+}
+
+func (r *tenantResolver) ResolveDiscord(tenantID string) (httpadapter.DiscordTenantDeps, error) {
+	if v, ok := r.discordCache.Load(tenantID); ok {
+		return v.(httpadapter.DiscordTenantDeps), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return httpadapter.DiscordTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+
+	dc := cfg.Discord
+	if dc.ClientID == "" || dc.ClientSecret == "" || dc.RedirectURI == "" {
+		if _, logged := r.discordDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+			r.logf("tenant %s: Discord auth disabled (missing credentials)", tenantID)
+		}
+		return httpadapter.DiscordTenantDeps{}, httpadapter.ErrDiscordDisabled
+	}
+
+	if err := requireSecrets(tenantID, "discord.stateSecret", dc.StateSecret, "discord.jwtSecret", dc.JWTSecret); err != nil {
+		return httpadapter.DiscordTenantDeps{}, err
+	}
+	// ロールはギルドのメンバー情報から読むので、ギルドがなければ判定されず誰でもログインできてしまう。
+	if len(dc.RequiredRoleIDs) > 0 && strings.TrimSpace(dc.GuildID) == "" {
+		return httpadapter.DiscordTenantDeps{}, fmt.Errorf("tenant %s: discord.guildID is required when discord.requiredRoleIDs is set", tenantID)
+	}
+
+	allowed := toSet(cfg.AllowedOrigins)
+	handoff := r.oidcHandoff(tenantID, allowed)
+	stateMgr := discordlogin.NewHMACStateManager([]byte(dc.StateSecret), dc.StateTTL, r.nonces)
+	tokenIssuer := discordlogin.NewJWTIssuer([]byte(dc.JWTSecret), dc.JWTIssuer, dc.JWTAudience, dc.JWTExpiresIn)
+	discordClient := infradiscord.NewClient(
+		r.httpClient,
+		dc.ClientID,
+		dc.ClientSecret,
+		dc.RedirectURI,
+		discordAuthorizeEndpoint,
+		discordTokenEndpoint,
+		discordAPIBaseURL,
+		discordCDNBaseURL,
+		dc.Scopes,
 	)
-	usecase := twitterlogin.NewUsecase(stateMgr, twitterClient, tokenIssuer, allowed, cfg.DefaultRedirectOrigin)
-	deps := httpadapter.TwitterTenantDeps{
+	stateCookie, err := newStateCookie(cfg.StateCookie, dc.StateTTL)
+	if err != nil {
+		return httpadapter.DiscordTenantDeps{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	pages, err := r.pages(tenantID, cfg.Pages)
+	if err != nil {
+		return httpadapter.DiscordTenantDeps{}, err
+	}
+	session, err := r.session(tenantID)
+	if err != nil {
+		return httpadapter.DiscordTenantDeps{}, err
+	}
+	notifier, err := r.loginNotifier(tenantID)
+	if err != nil {
+		return httpadapter.DiscordTenantDeps{}, err
+	}
+
+	gate := discordlogin.GuildGate{
+		GuildID:         dc.GuildID,
+		RequiredRoleIDs: dc.RequiredRoleIDs,
+	}
+	usecase := discordlogin.NewUsecase(stateMgr, discordClient, tokenIssuer, gate, allowed, cfg.DefaultRedirectOrigin)
+	deps := httpadapter.DiscordTenantDeps{
 		Usecase:               usecase,
 		AllowedOrigins:        allowed,
 		DefaultRedirectOrigin: cfg.DefaultRedirectOrigin,
 		RedirectPath:          cfg.RedirectPath,
+		StateCookie:           stateCookie,
+		OIDC:                  handoff,
+		Pages:                 pages,
+		Session:               session,
+		Webhooks:              notifier,
 	}
-	r.twitterCache.Store(tenantID, deps)
+	r.discordCache.Store(tenantID, deps)
+	return deps, nil
+}
+
+func (r *tenantResolver) ResolveApple(tenantID string) (httpadapter.AppleTenantDeps, error) {
+	if v, ok := r.appleCache.Load(tenantID); ok {
+		return v.(httpadapter.AppleTenantDeps), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return httpadapter.AppleTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+
+	ac := cfg.Apple
+	if ac.ClientID == "" || ac.TeamID == "" || ac.KeyID == "" || ac.PrivateKey == "" || ac.RedirectURI == "" {
+		if _, logged := r.appleDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+			r.logf("tenant %s: Apple auth disabled (missing credentials)", tenantID)
+		}
+		return httpadapter.AppleTenantDeps{}, httpadapter.ErrAppleDisabled
+	}
+
+	if err := requireSecrets(tenantID, "apple.stateSecret", ac.StateSecret, "apple.jwtSecret", ac.JWTSecret); err != nil {
+		return httpadapter.AppleTenantDeps{}, err
+	}
+	privateKey, err := infraapple.ParsePrivateKey([]byte(ac.PrivateKey))
+	if err != nil {
+		return httpadapter.AppleTenantDeps{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+
+	allowed := toSet(cfg.AllowedOrigins)
+	handoff := r.oidcHandoff(tenantID, allowed)
+	stateMgr := applelogin.NewHMACStateManager([]byte(ac.StateSecret), ac.StateTTL, r.nonces)
+	tokenIssuer := applelogin.NewJWTIssuer([]byte(ac.JWTSecret), ac.JWTIssuer, ac.JWTAudience, ac.JWTExpiresIn)
+	appleClient := infraapple.NewClient(r.httpClient, infraapple.Config{
+		ClientID:          ac.ClientID,
+		TeamID:            ac.TeamID,
+		KeyID:             ac.KeyID,
+		PrivateKey:        privateKey,
+		RedirectURI:       ac.RedirectURI,
+		Scopes:            ac.Scopes,
+		Issuer:            endpointOr(ac.Endpoints.Issuer, appleIssuer),
+		AuthorizeEndpoint: endpointOr(ac.Endpoints.Authorize, appleAuthorizeEndpoint),
+		TokenEndpoint:     endpointOr(ac.Endpoints.Token, appleTokenEndpoint),
+		JWKSEndpoint:      endpointOr(ac.Endpoints.JWKS, appleJWKSEndpoint),
+		ClientSecretTTL:   ac.ClientSecretTTL,
+	})
+	stateCookie, err := newStateCookie(cfg.StateCookie, ac.StateTTL)
+	if err != nil {
+		return httpadapter.AppleTenantDeps{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	pages, err := r.pages(tenantID, cfg.Pages)
+	if err != nil {
+		return httpadapter.AppleTenantDeps{}, err
+	}
+	session, err := r.session(tenantID)
+	if err != nil {
+		return httpadapter.AppleTenantDeps{}, err
+	}
+	notifier, err := r.loginNotifier(tenantID)
+	if err != nil {
+		return httpadapter.AppleTenantDeps{}, err
+	}
+	// form_post はappleid.apple.comからのクロスサイトPOSTのため、SameSite=None でないとCookieが届かない。
+	stateCookie.SameSite = http.SameSiteNoneMode
+
+	usecase := applelogin.NewUsecase(stateMgr, appleClient, tokenIssuer, allowed, cfg.DefaultRedirectOrigin)
+	deps := httpadapter.AppleTenantDeps{
+		Usecase:               usecase,
+		AllowedOrigins:        allowed,
+		DefaultRedirectOrigin: cfg.DefaultRedirectOrigin,
+		RedirectPath:          cfg.RedirectPath,
+		StateCookie:           stateCookie,
+		OIDC:                  handoff,
+		Pages:                 pages,
+		Session:               session,
+		Webhooks:              notifier,
+	}
+	r.appleCache.Store(tenantID, deps)
 	return deps, nil
 }
 
+// newStateCookie はテナント設定からstate紐付けCookieの設定を組み立てる。
+func newStateCookie(cfg tenant.StateCookieConfig, ttl time.Duration) (httpadapter.StateCookie, error) {
+	name := strings.TrimSpace(cfg.Name)
+	if name == "" {
+		name = httpadapter.DefaultStateCookieName
+	}
+	domain := strings.TrimSpace(cfg.Domain)
+	if strings.HasPrefix(name, "__Host-") && domain != "" {
+		return httpadapter.StateCookie{}, fmt.Errorf("stateCookie: __Host- cookie must not set domain")
+	}
+
+	var sameSite http.SameSite
+	switch strings.ToLower(strings.TrimSpace(cfg.SameSite)) {
+	case "", "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return httpadapter.StateCookie{}, fmt.Errorf("stateCookie: unknown sameSite %q", cfg.SameSite)
+	}
+
+	return httpadapter.StateCookie{
+		Disabled:    cfg.Disabled,
+		Name:        name,
+		Domain:      domain,
+		SameSite:    sameSite,
+		Partitioned: cfg.Partitioned,
+		MaxAge:      ttl,
+	}, nil
+}
+
+// endpointOr はテナント設定で上書きされたエンドポイントを優先し、未指定なら本番のURLを返す。
+func endpointOr(override, fallback string) string {
+	if v := strings.TrimSpace(override); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func toSet(values []string) map[string]struct{} {
 	set := make(map[string]struct{}, len(values))
 	for _, v := range values {
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
 	"github.com/sngm3741/roots/base/auth/internal/tenant"
 )
 
@@ -31,6 +33,32 @@ func TestTenantResolver(t *testing.T) {
       jwtAudience: aud
       jwtExpiresIn: 24h
     twitter: {}
+    anonymous:
+      challengeSecret: achallenge
+      subjectSecret: asubject
+      jwtSecret: ajwt
+      jwtIssuer: iss
+    session:
+      secret: ssession
+      domain: example.com
+    webhooks:
+      endpoints:
+        - url: https://app.example.com/hooks/auth
+          secret: whsec
+          events: [first_login]
+    discord:
+      clientID: did
+      clientSecret: dsec
+      redirectURI: https://app.example.com/dcb
+      scopes: ["identify", "guilds.members.read"]
+      guildID: "123"
+      requiredRoleIDs: ["456"]
+      stateSecret: dstate
+      stateTTL: 10m
+      jwtSecret: djwt
+      jwtIssuer: dciss
+      jwtAudience: dcaud
+      jwtExpiresIn: 24h
   tenantTwitterOnly:
     allowedOrigins: ["https://app.example.com"]
     defaultRedirectOrigin: https://app.example.com
@@ -47,6 +75,101 @@ func TestTenantResolver(t *testing.T) {
       jwtIssuer: twiss
       jwtAudience: twaud
       jwtExpiresIn: 24h
+    tokenVault:
+      key: MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=
+      providers: [twitter]
+    apple:
+      clientID: com.example.web
+      teamID: TEAM123456
+      keyID: KEY1234567
+      privateKey: not-a-pem
+      redirectURI: https://app.example.com/acb
+      stateSecret: astate
+      jwtSecret: ajwt
+  tenantBadPages:
+    allowedOrigins: ["https://app.example.com"]
+    line:
+      channelID: cid
+      channelSecret: csec
+      redirectURI: https://app.example.com/cb
+      stateSecret: sss
+      jwtSecret: jjj
+    pages:
+      locale: fr
+    tokenVault:
+      key: c2hvcnQ=
+    anonymous:
+      challengeSecret: achallenge
+      subjectSecret: asubject
+      jwtSecret: ajwt
+      difficulty: 64
+    session:
+      secret: ssession
+      sameSite: none
+    twitter:
+      clientID: tid
+      redirectURI: https://app.example.com/tcb
+      stateSecret: tstate
+      jwtSecret: tjwt
+      profileFields: [verified]
+      profileClaims:
+        - field: verified
+          claim: x_verified
+    discord:
+      clientID: did
+      clientSecret: dsec
+      redirectURI: https://app.example.com/dcb
+      requiredRoleIDs: ["456"]
+      stateSecret: dstate
+      jwtSecret: djwt
+  tenantRotatedSecrets:
+    claimNamespace: https://app.example.com/claims/
+    allowedOrigins: ["https://app.example.com"]
+    twitter:
+      clientID: tid
+      redirectURI: https://app.example.com/tcb
+      stateSecrets:
+        - id: "2025"
+          value: tstate-new
+        - id: "2024"
+          value: tstate-old
+          expiresAt: 2000-01-01T00:00:00Z
+      jwtSecret: tjwt
+      profileFields: [verified]
+      profileClaims:
+        - field: verified
+          claim: x_verified
+    line:
+      channelID: cid
+      channelSecret: csec
+      redirectURI: https://app.example.com/cb
+      stateSecret: sss
+      jwtSecrets:
+        - id: "2024"
+          value: jjj
+          expiresAt: 2000-01-01T00:00:00Z
+    discord:
+      clientID: did
+      clientSecret: dsec
+      redirectURI: https://app.example.com/dcb
+      jwtSecret: djwt
+    apple:
+      clientID: com.example.web
+      teamID: TEAM123456
+      keyID: KEY1234567
+      privateKey: not-a-pem
+      redirectURI: https://app.example.com/acb
+      stateSecret: astate
+  tenantBadWebhooks:
+    allowedOrigins: ["https://app.example.com"]
+    webhooks:
+      endpoints:
+        - url: https://app.example.com/hooks/auth
+          secret: whsec
+          events: [logout]
+  tenantSessionNoOrigins:
+    session:
+      secret: ssession
 `
 
 	dir := t.TempDir()
@@ -70,6 +193,32 @@ func TestTenantResolver(t *testing.T) {
 		{name: "line disabled", tenantID: "tenantTwitterOnly", resolve: "line", wantError: true},
 		{name: "twitter enabled", tenantID: "tenantTwitterOnly", resolve: "twitter"},
 		{name: "twitter disabled", tenantID: "tenantLineOnly", resolve: "twitter", wantError: true},
+		{name: "discord enabled", tenantID: "tenantLineOnly", resolve: "discord"},
+		{name: "discord disabled", tenantID: "tenantTwitterOnly", resolve: "discord", wantError: true},
+		{name: "discord roles without guild", tenantID: "tenantBadPages", resolve: "discord", wantError: true},
+		{name: "discord missing state secret", tenantID: "tenantRotatedSecrets", resolve: "discord", wantError: true},
+		{name: "apple disabled", tenantID: "tenantLineOnly", resolve: "apple", wantError: true},
+		{name: "apple invalid private key", tenantID: "tenantTwitterOnly", resolve: "apple", wantError: true},
+		{name: "apple missing jwt secret", tenantID: "tenantRotatedSecrets", resolve: "apple", wantError: true},
+		{name: "oidc disabled", tenantID: "tenantLineOnly", resolve: "oidc", wantError: true},
+		{name: "line invalid pages", tenantID: "tenantBadPages", resolve: "line", wantError: true},
+		{name: "twitter rotated secrets", tenantID: "tenantRotatedSecrets", resolve: "twitter"},
+		{name: "twitter profile claims without namespace", tenantID: "tenantBadPages", resolve: "twitter", wantError: true},
+		{name: "line all secrets expired", tenantID: "tenantRotatedSecrets", resolve: "line", wantError: true},
+		{name: "vault without oidc", tenantID: "tenantTwitterOnly", resolve: "vault", wantError: true},
+		{name: "vault disabled", tenantID: "tenantLineOnly", resolve: "vault", wantError: true},
+		{name: "vault invalid key", tenantID: "tenantBadPages", resolve: "vault", wantError: true},
+		{name: "anonymous enabled", tenantID: "tenantLineOnly", resolve: "anon"},
+		{name: "anonymous disabled", tenantID: "tenantTwitterOnly", resolve: "anon", wantError: true},
+		{name: "anonymous difficulty too high", tenantID: "tenantBadPages", resolve: "anon", wantError: true},
+		{name: "session enabled", tenantID: "tenantLineOnly", resolve: "session"},
+		{name: "session disabled", tenantID: "tenantTwitterOnly", resolve: "session", wantError: true},
+		{name: "session without allowed origins", tenantID: "tenantSessionNoOrigins", resolve: "session", wantError: true},
+		{name: "session sameSite none", tenantID: "tenantBadPages", resolve: "session", wantError: true},
+		{name: "webhook notifier enabled", tenantID: "tenantLineOnly", resolve: "notifier"},
+		{name: "webhook unsupported event", tenantID: "tenantBadWebhooks", resolve: "notifier", wantError: true},
+		{name: "webhook log without oidc", tenantID: "tenantLineOnly", resolve: "webhooks", wantError: true},
+		{name: "webhook log disabled", tenantID: "tenantTwitterOnly", resolve: "webhooks", wantError: true},
 	}
 
 	for _, tt := range tests {
@@ -93,6 +242,70 @@ func TestTenantResolver(t *testing.T) {
 				if !tt.wantError && err != nil {
 					t.Fatalf("unexpected error: %v", err)
 				}
+			case "discord":
+				_, err := loader.ResolveDiscord(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "apple":
+				_, err := loader.ResolveApple(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "oidc":
+				_, err := loader.ResolveOIDC(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "vault":
+				_, err := loader.ResolveTokenVault(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "anon":
+				_, err := loader.ResolveAnon(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "session":
+				_, err := loader.ResolveSession(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "notifier":
+				notifier, err := loader.loginNotifier(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && (err != nil || notifier == nil) {
+					t.Fatalf("unexpected result: notifier=%v err=%v", notifier, err)
+				}
+			case "webhooks":
+				_, err := loader.ResolveWebhooks(tt.tenantID)
+				if tt.wantError && err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				if !tt.wantError && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
 			default:
 				t.Fatalf("unknown resolve type")
 			}
@@ -107,5 +320,43 @@ func newTenantResolverForTest(path string) (*tenantResolver, error) {
 		return nil, err
 	}
 	client := &http.Client{Timeout: 30 * time.Second}
-	return newTenantResolver(loader, client, func(string, ...any) {}), nil
+	return newTenantResolver(loader, client, noncestore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), grantstore.NewMemory(), func(string, ...any) {}), nil
+}
+
+// トークン保管庫の保管期間が AUTH_VAULT_MAX_TTL を超えるテナントを起動時に拒否することを確認する。
+func TestCheckTokenVaultRetention(t *testing.T) {
+	t.Parallel()
+
+	const key = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	tests := []struct {
+		name      string
+		vault     string
+		maxTTL    time.Duration
+		wantError bool
+	}{
+		{name: "保管期間がTTL以内", vault: "key: " + key + "\n      retention: 720h", maxTTL: 2160 * time.Hour},
+		{name: "既定の保管期間とTTLが同じ", vault: "key: " + key, maxTTL: 2160 * time.Hour},
+		{name: "保管期間がTTL超過", vault: "key: " + key + "\n      retention: 4320h", maxTTL: 2160 * time.Hour, wantError: true},
+		{name: "既定の保管期間がTTL超過", vault: "key: " + key, maxTTL: 720 * time.Hour, wantError: true},
+		{name: "保管庫なしは対象外", vault: "retention: 4320h", maxTTL: 720 * time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfgPath := filepath.Join(t.TempDir(), "tenants.yaml")
+			cfg := "auth:\n  t1:\n    tokenVault:\n      " + tt.vault + "\n"
+			if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+			loader, err := tenant.NewLoader(cfgPath)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			err = checkTokenVaultRetention(loader, tt.maxTTL)
+			if tt.wantError != (err != nil) {
+				t.Fatalf("err=%v wantError=%v", err, tt.wantError)
+			}
+		})
+	}
 }
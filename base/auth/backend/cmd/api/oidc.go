@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+)
+
+// defaultOIDCRequestTTL は認可リクエストCookieの既定の有効期間（oidcprovider の既定値と揃える）。
+const defaultOIDCRequestTTL = 10 * time.Minute
+
+// defaultOIDCDeviceCodeTTL はデバイスコードとユーザーコードCookieの既定の有効期間。
+const defaultOIDCDeviceCodeTTL = 10 * time.Minute
+
+// oidcTenant はテナントごとに1つだけ生成するOIDCプロバイダと引き渡し先。
+type oidcTenant struct {
+	provider     *oidcprovider.Provider
+	cookie       httpadapter.OIDCRequestCookie
+	deviceCookie httpadapter.OIDCRequestCookie
+	pages        *httpadapter.Pages
+	handoff      httpadapter.OIDCHandoff
+}
+
+// ResolveOIDC はテナントのOIDCプロバイダ用依存を解決する。
+func (r *tenantResolver) ResolveOIDC(tenantID string) (httpadapter.OIDCTenantDeps, error) {
+	if v, ok := r.oidcCache.Load(tenantID); ok {
+		return v.(httpadapter.OIDCTenantDeps), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return httpadapter.OIDCTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	entry, err := r.oidcTenant(tenantID)
+	if err != nil {
+		return httpadapter.OIDCTenantDeps{}, err
+	}
+
+	var upstreams []httpadapter.OIDCUpstream
+	if _, err := r.ResolveLine(tenantID); err == nil {
+		upstreams = append(upstreams, httpadapter.OIDCUpstream{ID: "line", Label: "LINE", LoginPath: "/line/login"})
+	}
+	if _, err := r.ResolveTwitter(tenantID); err == nil {
+		upstreams = append(upstreams, httpadapter.OIDCUpstream{ID: "twitter", Label: "X", LoginPath: "/twitter/login"})
+	}
+	if _, err := r.ResolveDiscord(tenantID); err == nil {
+		upstreams = append(upstreams, httpadapter.OIDCUpstream{ID: "discord", Label: "Discord", LoginPath: "/discord/login"})
+	}
+	if _, err := r.ResolveApple(tenantID); err == nil {
+		upstreams = append(upstreams, httpadapter.OIDCUpstream{ID: "apple", Label: "Apple", LoginPath: "/apple/login"})
+	}
+
+	// /token・/userinfo をブラウザから呼ぶSPA向けに、登録済みredirect_uriのオリジンだけCORSを許可する。
+	allowed := map[string]struct{}{}
+	for _, c := range cfg.OIDC.Clients {
+		for _, uri := range c.RedirectURIs {
+			if origin := httpadapter.IssuerOrigin(uri); origin != "" {
+				allowed[origin] = struct{}{}
+			}
+		}
+	}
+
+	deps := httpadapter.OIDCTenantDeps{
+		Usecase:        entry.provider,
+		Upstreams:      upstreams,
+		AllowedOrigins: allowed,
+		RequestCookie:  entry.cookie,
+		DeviceCookie:   entry.deviceCookie,
+		Pages:          entry.pages,
+	}
+	r.oidcCache.Store(tenantID, deps)
+	return deps, nil
+}
+
+// oidcHandoff はテナントでOIDCが有効なら引き渡し先を返し、選択ページのオリジンを allowed に加える。
+// allowed が空（全オリジン許可）の場合はそのままにする。
+func (r *tenantResolver) oidcHandoff(tenantID string, allowed map[string]struct{}) httpadapter.OIDCHandoff {
+	entry, err := r.oidcTenant(tenantID)
+	if err != nil {
+		return nil
+	}
+	if len(allowed) > 0 {
+		allowed[httpadapter.IssuerOrigin(entry.provider.Issuer())] = struct{}{}
+	}
+	return entry.handoff
+}
+
+// oidcTenant はテナント設定からOIDCプロバイダを生成してキャッシュする。
+func (r *tenantResolver) oidcTenant(tenantID string) (*oidcTenant, error) {
+	if v, ok := r.oidcProviders.Load(tenantID); ok {
+		return v.(*oidcTenant), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return nil, fmt.Errorf("tenant %s not found", tenantID)
+	}
+
+	oc := cfg.OIDC
+	if oc.Issuer == "" || oc.SigningKey == "" || (len(oc.Clients) == 0 && len(oc.ServiceClients) == 0 && len(oc.DeviceClients) == 0) {
+		if _, logged := r.oidcDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+			r.logf("tenant %s: OIDC provider disabled (missing issuer, signingKey or clients)", tenantID)
+		}
+		return nil, httpadapter.ErrOIDCDisabled
+	}
+	if httpadapter.IssuerOrigin(oc.Issuer) == "" {
+		return nil, fmt.Errorf("tenant %s: oidc.issuer must be an absolute URL", tenantID)
+	}
+
+	key, err := oidcprovider.ParseRSAPrivateKey([]byte(oc.SigningKey))
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	keyID := strings.TrimSpace(oc.KeyID)
+	if keyID == "" {
+		sum := sha256.Sum256(key.PublicKey.N.Bytes())
+		keyID = hex.EncodeToString(sum[:8])
+	}
+
+	clients := make([]oidcprovider.Client, 0, len(oc.Clients))
+	for _, c := range oc.Clients {
+		if strings.TrimSpace(c.ClientID) == "" || len(c.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("tenant %s: oidc client requires clientID and redirectURIs", tenantID)
+		}
+		clients = append(clients, oidcprovider.Client{
+			ID:           c.ClientID,
+			Secret:       c.ClientSecret,
+			Name:         c.Name,
+			RedirectURIs: c.RedirectURIs,
+		})
+	}
+
+	serviceClients := make([]oidcprovider.ServiceClient, 0, len(oc.ServiceClients))
+	for _, c := range oc.ServiceClients {
+		if strings.TrimSpace(c.ClientID) == "" || len(c.Scopes) == 0 {
+			return nil, fmt.Errorf("tenant %s: oidc service client requires clientID and scopes", tenantID)
+		}
+		secretHash, err := oidcprovider.ParseSecretSHA256(c.ClientSecretSHA256)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: service client %s: %w", tenantID, c.ClientID, err)
+		}
+		serviceClients = append(serviceClients, oidcprovider.ServiceClient{
+			ID:           c.ClientID,
+			Name:         c.Name,
+			SecretSHA256: secretHash,
+			Scopes:       c.Scopes,
+		})
+	}
+
+	deviceClients := make([]oidcprovider.DeviceClient, 0, len(oc.DeviceClients))
+	for _, c := range oc.DeviceClients {
+		if strings.TrimSpace(c.ClientID) == "" {
+			return nil, fmt.Errorf("tenant %s: oidc device client requires clientID", tenantID)
+		}
+		deviceClients = append(deviceClients, oidcprovider.DeviceClient{ID: c.ClientID, Name: c.Name})
+	}
+
+	requestTTL := oc.RequestTTL
+	if requestTTL <= 0 {
+		requestTTL = defaultOIDCRequestTTL
+	}
+	deviceCodeTTL := oc.DeviceCodeTTL
+	if deviceCodeTTL <= 0 {
+		deviceCodeTTL = defaultOIDCDeviceCodeTTL
+	}
+	provider := oidcprovider.NewProvider(oidcprovider.Config{
+		Issuer:          oc.Issuer,
+		Clients:         clients,
+		ServiceClients:  serviceClients,
+		ServiceTokenTTL: oc.ServiceTokenTTL,
+		DeviceClients:   deviceClients,
+		DeviceCodeTTL:   deviceCodeTTL,
+		RequestTTL:      requestTTL,
+		CodeTTL:         oc.CodeTTL,
+		AccessTokenTTL:  oc.AccessTokenTTL,
+		IDTokenTTL:      oc.IDTokenTTL,
+	}, oidcprovider.NewRS256Signer(key, keyID), r.grants)
+	cookie := httpadapter.OIDCRequestCookie{MaxAge: requestTTL}
+	deviceCookie := httpadapter.OIDCRequestCookie{Name: httpadapter.DefaultOIDCDeviceCookieName, MaxAge: deviceCodeTTL}
+	pages, err := r.pages(tenantID, cfg.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &oidcTenant{
+		provider:     provider,
+		cookie:       cookie,
+		deviceCookie: deviceCookie,
+		pages:        pages,
+		handoff:      httpadapter.NewOIDCHandoff(provider, cookie, deviceCookie, pages, r.logf),
+	}
+	actual, _ := r.oidcProviders.LoadOrStore(tenantID, entry)
+	return actual.(*oidcTenant), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/tenant"
+)
+
+// pages はテナントのブランディング設定からPagesを生成してキャッシュする。
+func (r *tenantResolver) pages(tenantID string, cfg tenant.PagesConfig) (*httpadapter.Pages, error) {
+	if v, ok := r.pagesCache.Load(tenantID); ok {
+		return v.(*httpadapter.Pages), nil
+	}
+
+	var overrides fs.FS
+	if dir := strings.TrimSpace(cfg.TemplateDir); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: pages templateDir: %w", tenantID, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("tenant %s: pages templateDir %s is not a directory", tenantID, dir)
+		}
+		overrides = os.DirFS(dir)
+	}
+
+	pages, err := httpadapter.NewPages(httpadapter.Branding{
+		AppName: strings.TrimSpace(cfg.AppName),
+		LogoURL: strings.TrimSpace(cfg.LogoURL),
+		Colors: httpadapter.PageColors{
+			Primary:    strings.TrimSpace(cfg.Colors.Primary),
+			Background: strings.TrimSpace(cfg.Colors.Background),
+			Text:       strings.TrimSpace(cfg.Colors.Text),
+		},
+		Locale:   cfg.Locale,
+		Messages: cfg.Messages,
+	}, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	actual, _ := r.pagesCache.LoadOrStore(tenantID, pages)
+	return actual.(*httpadapter.Pages), nil
+}
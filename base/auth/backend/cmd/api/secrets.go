@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/tenant"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/twitterlogin"
+)
+
+// rotatingSecrets は署名鍵のリストを検証して返す。list が空なら従来の単一の鍵を使う。
+// 有効な鍵が1つもなければエラーにし、期限切れの鍵は設定から外すようログに残す。
+func (r *tenantResolver) rotatingSecrets(tenantID, field, single string, list []tenant.SecretConfig) ([]tenant.SecretConfig, error) {
+	if len(list) == 0 {
+		if single == "" {
+			return nil, fmt.Errorf("tenant %s: %s is required", tenantID, field)
+		}
+		return []tenant.SecretConfig{{Value: single}}, nil
+	}
+
+	now := time.Now()
+	active := 0
+	for i, s := range list {
+		if strings.TrimSpace(s.Value) == "" {
+			return nil, fmt.Errorf("tenant %s: %ss[%d].value is required", tenantID, field, i)
+		}
+		if !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt) {
+			if r.logf != nil {
+				r.logf("tenant %s: %ss[%d] (id=%q) expired at %s and is ignored", tenantID, field, i, s.ID, s.ExpiresAt.Format(time.RFC3339))
+			}
+			continue
+		}
+		active++
+	}
+	if active == 0 {
+		return nil, fmt.Errorf("tenant %s: %ss has no active secret", tenantID, field)
+	}
+	return list, nil
+}
+
+// requireSecrets は入れ替えに対応しないプロバイダの署名鍵がすべて設定されているかを確かめる。
+// fields はフィールド名と値の組を並べたもの。
+func requireSecrets(tenantID string, fields ...string) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if strings.TrimSpace(fields[i+1]) == "" {
+			return fmt.Errorf("tenant %s: %s is required", tenantID, fields[i])
+		}
+	}
+	return nil
+}
+
+func lineSecrets(list []tenant.SecretConfig) []linelogin.Secret {
+	out := make([]linelogin.Secret, 0, len(list))
+	for _, s := range list {
+		out = append(out, linelogin.Secret{ID: s.ID, Value: []byte(s.Value), ExpiresAt: s.ExpiresAt})
+	}
+	return out
+}
+
+func twitterSecrets(list []tenant.SecretConfig) []twitterlogin.Secret {
+	out := make([]twitterlogin.Secret, 0, len(list))
+	for _, s := range list {
+		out = append(out, twitterlogin.Secret{ID: s.ID, Value: []byte(s.Value), ExpiresAt: s.ExpiresAt})
+	}
+	return out
+}
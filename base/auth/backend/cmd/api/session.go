@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/session"
+)
+
+// defaultSessionTTL はセッションCookieの既定の有効期間。
+const defaultSessionTTL = 24 * time.Hour
+
+// ResolveSession はテナントの /session エンドポイントの依存を解決する。
+func (r *tenantResolver) ResolveSession(tenantID string) (httpadapter.SessionTenantDeps, error) {
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return httpadapter.SessionTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	cookie, err := r.session(tenantID)
+	if err != nil {
+		return httpadapter.SessionTenantDeps{}, err
+	}
+	if cookie == nil {
+		if _, logged := r.sessionDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+			r.logf("tenant %s: session cookie mode disabled (missing session.secret)", tenantID)
+		}
+		return httpadapter.SessionTenantDeps{}, httpadapter.ErrSessionDisabled
+	}
+	// Cookieは親ドメインに付くので、許可リストがなければ同じサイトの別オリジンからプロフィールとCSRFトークンを読めてしまう。
+	if len(cfg.AllowedOrigins) == 0 {
+		return httpadapter.SessionTenantDeps{}, fmt.Errorf("tenant %s: allowedOrigins is required when session.secret is set", tenantID)
+	}
+	return httpadapter.SessionTenantDeps{
+		Cookie:         cookie,
+		AllowedOrigins: toSet(cfg.AllowedOrigins),
+	}, nil
+}
+
+// session はテナント設定からセッションCookieの設定を生成してキャッシュする。session.secret がなければ nil を返す。
+func (r *tenantResolver) session(tenantID string) (*httpadapter.SessionCookie, error) {
+	if v, ok := r.sessions.Load(tenantID); ok {
+		return v.(*httpadapter.SessionCookie), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return nil, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	sc := cfg.Session
+	if strings.TrimSpace(sc.Secret) == "" {
+		return nil, nil
+	}
+
+	name := strings.TrimSpace(sc.CookieName)
+	if name == "" {
+		name = httpadapter.DefaultSessionCookieName
+	}
+	domain := strings.TrimSpace(sc.Domain)
+	if strings.HasPrefix(name, "__Host-") && domain != "" {
+		return nil, fmt.Errorf("tenant %s: session: __Host- cookie must not set domain", tenantID)
+	}
+	var sameSite http.SameSite
+	switch strings.ToLower(strings.TrimSpace(sc.SameSite)) {
+	case "", "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	default:
+		// クロスサイトで送られるCookieはCSRFの前提を崩すため、none は受け付けない。
+		return nil, fmt.Errorf("tenant %s: session: sameSite must be lax or strict, got %q", tenantID, sc.SameSite)
+	}
+	ttl := sc.TTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+
+	cookie := &httpadapter.SessionCookie{
+		Manager:  session.NewManager([]byte(sc.Secret), tenantID, ttl),
+		Name:     name,
+		Domain:   domain,
+		SameSite: sameSite,
+	}
+	actual, _ := r.sessions.LoadOrStore(tenantID, cookie)
+	return actual.(*httpadapter.SessionCookie), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/tenant"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
+)
+
+// defaultTokenVaultRetention はトークン保管庫の既定の保管期間（AUTH_VAULT_MAX_TTL の既定値と揃える）。
+const defaultTokenVaultRetention = 90 * 24 * time.Hour
+
+// defaultTokenVaultProviders は tokenVault.providers を省略したときに保管するプロバイダ。
+var defaultTokenVaultProviders = []string{"line", "twitter"}
+
+// ResolveTokenVault はテナントのトークン保管庫APIの依存を解決する。
+// 取得にはサービストークンが必要なため、tokenVault に加えてOIDCプロバイダも有効である必要がある。
+func (r *tenantResolver) ResolveTokenVault(tenantID string) (httpadapter.TokenVaultTenantDeps, error) {
+	if v, ok := r.tokenVaultCache.Load(tenantID); ok {
+		return v.(httpadapter.TokenVaultTenantDeps), nil
+	}
+	if _, ok := r.loader.AuthConfig(tenantID); !ok {
+		return httpadapter.TokenVaultTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+
+	vault, err := r.tokenVault(tenantID)
+	if err != nil {
+		return httpadapter.TokenVaultTenantDeps{}, err
+	}
+	if vault == nil {
+		r.logVaultDisabled(tenantID, "missing tokenVault.key")
+		return httpadapter.TokenVaultTenantDeps{}, httpadapter.ErrVaultDisabled
+	}
+	entry, err := r.oidcTenant(tenantID)
+	if err != nil {
+		r.logVaultDisabled(tenantID, "OIDC provider is required to verify service tokens")
+		return httpadapter.TokenVaultTenantDeps{}, httpadapter.ErrVaultDisabled
+	}
+
+	deps := httpadapter.TokenVaultTenantDeps{
+		Vault:    vault,
+		Verifier: entry.provider,
+	}
+	r.tokenVaultCache.Store(tenantID, deps)
+	return deps, nil
+}
+
+// tokenVault はテナント設定からトークン保管庫を生成してキャッシュする。tokenVault.key がなければ nil を返す。
+// ログイン時の保存とAPIからの取得で同じ Vault を共有し、更新の直列化をテナント内で効かせる。
+func (r *tenantResolver) tokenVault(tenantID string) (*tokenvault.Vault, error) {
+	if v, ok := r.tokenVaults.Load(tenantID); ok {
+		return v.(*tokenvault.Vault), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return nil, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	tv := cfg.TokenVault
+	if strings.TrimSpace(tv.Key) == "" {
+		return nil, nil
+	}
+	if r.vaults == nil {
+		return nil, fmt.Errorf("tenant %s: token vault store is not configured", tenantID)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(tv.Key))
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: tokenVault.key must be base64: %w", tenantID, err)
+	}
+	providers := tv.Providers
+	if len(providers) == 0 {
+		providers = defaultTokenVaultProviders
+	}
+	for _, p := range providers {
+		if p != "line" && p != "twitter" {
+			return nil, fmt.Errorf("tenant %s: tokenVault.providers: unsupported provider %q", tenantID, p)
+		}
+	}
+	retention := tokenVaultRetention(tv)
+
+	vault, err := tokenvault.NewVault(tenantID, key, r.vaults, providers, retention)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	if lc := cfg.Line; lc.ChannelID != "" && lc.ChannelSecret != "" {
+		vault.WithRefresher("line", r.newLineClient(lc))
+	}
+	if tw := cfg.Twitter; tw.ClientID != "" {
+		vault.WithRefresher("twitter", r.newTwitterClient(tw))
+	}
+
+	actual, _ := r.tokenVaults.LoadOrStore(tenantID, vault)
+	return actual.(*tokenvault.Vault), nil
+}
+
+// tokenVaultRetention は tokenVault.retention を既定値で補って返す。
+func tokenVaultRetention(tv tenant.TokenVaultConfig) time.Duration {
+	if tv.Retention <= 0 {
+		return defaultTokenVaultRetention
+	}
+	return tv.Retention
+}
+
+// checkTokenVaultRetention はトークン保管庫を使う全テナントの保管期間が maxTTL（AUTH_VAULT_MAX_TTL）以下か確かめる。
+// 保存先のバケットのTTLを超える保管期間は、期限より前にKVの失効で消えてしまうため起動時に拒否する。
+func checkTokenVaultRetention(loader *tenant.Loader, maxTTL time.Duration) error {
+	if maxTTL <= 0 {
+		return nil
+	}
+	for _, id := range loader.TenantIDs() {
+		cfg, _ := loader.AuthConfig(id)
+		if strings.TrimSpace(cfg.TokenVault.Key) == "" {
+			continue
+		}
+		if retention := tokenVaultRetention(cfg.TokenVault); retention > maxTTL {
+			return fmt.Errorf("tenant %s: tokenVault.retention %s exceeds AUTH_VAULT_MAX_TTL %s; lower the retention or raise AUTH_VAULT_MAX_TTL", id, retention, maxTTL)
+		}
+	}
+	return nil
+}
+
+func (r *tenantResolver) logVaultDisabled(tenantID, reason string) {
+	if _, logged := r.vaultDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+		r.logf("tenant %s: token vault API disabled (%s)", tenantID, reason)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	httpadapter "github.com/sngm3741/roots/base/auth/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/webhook"
+)
+
+const (
+	defaultWebhookMaxAttempts = 6
+	defaultWebhookBackoff     = 10 * time.Second
+)
+
+// ResolveWebhooks はテナントのWebhook配信ログAPIの依存を解決する。
+// 取得にはサービストークンが必要なため、webhooks に加えてOIDCプロバイダも有効である必要がある。
+func (r *tenantResolver) ResolveWebhooks(tenantID string) (httpadapter.WebhookTenantDeps, error) {
+	if _, ok := r.loader.AuthConfig(tenantID); !ok {
+		return httpadapter.WebhookTenantDeps{}, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	dispatcher, err := r.webhookDispatcher(tenantID)
+	if err != nil {
+		return httpadapter.WebhookTenantDeps{}, err
+	}
+	if dispatcher == nil {
+		r.logWebhooksDisabled(tenantID, "missing webhooks.endpoints")
+		return httpadapter.WebhookTenantDeps{}, httpadapter.ErrWebhooksDisabled
+	}
+	entry, err := r.oidcTenant(tenantID)
+	if err != nil {
+		r.logWebhooksDisabled(tenantID, "OIDC provider is required to verify service tokens")
+		return httpadapter.WebhookTenantDeps{}, httpadapter.ErrWebhooksDisabled
+	}
+	return httpadapter.WebhookTenantDeps{
+		Log:      dispatcher,
+		Verifier: entry.provider,
+	}, nil
+}
+
+// loginNotifier はログインの通知先を返す。Webhook未設定のテナントでは nil を返す。
+// 型付き nil をインターフェースに入れないよう、ここで変換する。
+func (r *tenantResolver) loginNotifier(tenantID string) (httpadapter.LoginNotifier, error) {
+	dispatcher, err := r.webhookDispatcher(tenantID)
+	if err != nil || dispatcher == nil {
+		return nil, err
+	}
+	return dispatcher, nil
+}
+
+// webhookDispatcher はテナント設定からWebhookの配信を生成してキャッシュする。endpoints がなければ nil を返す。
+// 全プロバイダと配信ログAPIで同じ Dispatcher を共有し、配信ログの更新をテナント内で直列化する。
+func (r *tenantResolver) webhookDispatcher(tenantID string) (*webhook.Dispatcher, error) {
+	if v, ok := r.dispatchers.Load(tenantID); ok {
+		return v.(*webhook.Dispatcher), nil
+	}
+
+	cfg, ok := r.loader.AuthConfig(tenantID)
+	if !ok {
+		return nil, fmt.Errorf("tenant %s not found", tenantID)
+	}
+	wc := cfg.Webhooks
+	if len(wc.Endpoints) == 0 {
+		return nil, nil
+	}
+	if r.webhooks == nil {
+		return nil, fmt.Errorf("tenant %s: webhook store is not configured", tenantID)
+	}
+
+	endpoints := make([]webhook.Endpoint, 0, len(wc.Endpoints))
+	for i, ep := range wc.Endpoints {
+		u, err := url.Parse(strings.TrimSpace(ep.URL))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("tenant %s: webhooks.endpoints[%d].url must be an absolute http(s) URL", tenantID, i)
+		}
+		if strings.TrimSpace(ep.Secret) == "" {
+			return nil, fmt.Errorf("tenant %s: webhooks.endpoints[%d].secret is required", tenantID, i)
+		}
+		for _, ev := range ep.Events {
+			if ev != webhook.EventLogin && ev != webhook.EventFirstLogin {
+				return nil, fmt.Errorf("tenant %s: webhooks.endpoints[%d].events: unsupported event %q", tenantID, i, ev)
+			}
+		}
+		endpoints = append(endpoints, webhook.Endpoint{URL: u.String(), Secret: ep.Secret, Events: ep.Events})
+	}
+	maxAttempts := wc.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+	backoff := wc.Backoff
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+
+	dispatcher := webhook.NewDispatcher(tenantID, endpoints, r.webhooks, r.httpClient, maxAttempts, backoff)
+	actual, _ := r.dispatchers.LoadOrStore(tenantID, dispatcher)
+	return actual.(*webhook.Dispatcher), nil
+}
+
+// shutdownWebhooks は生成済みの全テナントの Dispatcher を並行して止め、配信中のWebhookを ctx の期限まで待つ。
+// 期限までに終わらなかったテナントはログに残す。
+func (r *tenantResolver) shutdownWebhooks(ctx context.Context) {
+	var wg sync.WaitGroup
+	r.dispatchers.Range(func(key, value any) bool {
+		wg.Add(1)
+		go func(tenantID string, d *webhook.Dispatcher) {
+			defer wg.Done()
+			if err := d.Shutdown(ctx); err != nil && r.logf != nil {
+				r.logf("tenant %s: webhook deliveries still in flight at shutdown: %v", tenantID, err)
+			}
+		}(key.(string), value.(*webhook.Dispatcher))
+		return true
+	})
+	wg.Wait()
+}
+
+func (r *tenantResolver) logWebhooksDisabled(tenantID, reason string) {
+	if _, logged := r.webhookDisabled.LoadOrStore(tenantID, struct{}{}); !logged && r.logf != nil {
+		r.logf("tenant %s: webhook delivery log API disabled (%s)", tenantID, reason)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/fakeidp"
+)
+
+const (
+	defaultAddr    = ":9090"
+	defaultBaseURL = "http://localhost:9090"
+)
+
+// main はローカル・CI用の偽IdP（LINE・X・Sign in with Apple）を起動する。本番では使わない。
+//
+// 環境変数:
+//   - FAKEIDP_ADDR: 待ち受けアドレス（既定 :9090）
+//   - FAKEIDP_BASE_URL: auth から見た偽IdPのURL（既定 http://localhost:9090）
+//   - FAKEIDP_CLIENTS: 登録するクライアント。"client_id=secret" をカンマ区切りで並べ、公開クライアントは "client_id=" とする
+func main() {
+	logger := log.New(os.Stdout, "[fakeidp] ", log.LstdFlags|log.Lmsgprefix)
+
+	clients, err := parseClients(os.Getenv("FAKEIDP_CLIENTS"))
+	if err != nil {
+		logger.Fatalf("invalid FAKEIDP_CLIENTS: %v", err)
+	}
+	server, err := fakeidp.New(fakeidp.Config{
+		BaseURL: getEnv("FAKEIDP_BASE_URL", defaultBaseURL),
+		Clients: clients,
+	})
+	if err != nil {
+		logger.Fatalf("failed to init fakeidp: %v", err)
+	}
+
+	addr := getEnv("FAKEIDP_ADDR", defaultAddr)
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		logger.Printf("偽IdPを %s で待ち受けます（Apple issuer: %s）", addr, server.AppleIssuer())
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errChan:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("偽IdPが異常終了しました: %v", err)
+		}
+	case <-sigChan:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = httpServer.Shutdown(ctx)
+}
+
+// parseClients は "id=secret,id2=" 形式のクライアント一覧を解析する。
+func parseClients(raw string) (map[string]string, error) {
+	clients := map[string]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(id) == "" {
+			return nil, errors.New(`each client must be "client_id=secret"`)
+		}
+		clients[strings.TrimSpace(id)] = strings.TrimSpace(secret)
+	}
+	if len(clients) == 0 {
+		return nil, errors.New("at least one client is required")
+	}
+	return clients, nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
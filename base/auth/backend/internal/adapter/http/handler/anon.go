@@ -0,0 +1,223 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/anonlogin"
+)
+
+// AnonHandler はログインなしの匿名トークン発行のHTTP境界をまとめる。
+type AnonHandler struct {
+	resolver    AnonTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewAnonHandler は匿名トークン用ハンドラを初期化する。
+func NewAnonHandler(
+	resolver AnonTenantResolver,
+	httpTimeout time.Duration,
+	logger *log.Logger,
+) *AnonHandler {
+	return &AnonHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターに匿名トークン用エンドポイントを登録する。
+func (h *AnonHandler) RegisterRoutes(r chi.Router) {
+	r.Options("/anonymous/challenge", h.handlePreflight)
+	r.Post("/anonymous/challenge", h.handleChallenge)
+	r.Options("/anonymous/token", h.handlePreflight)
+	r.Post("/anonymous/token", h.handleToken)
+}
+
+func (h *AnonHandler) depsFromRequest(w http.ResponseWriter, r *http.Request) (AnonTenantDeps, error) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return AnonTenantDeps{}, errors.New("tenant missing")
+	}
+	deps, err := h.resolver.ResolveAnon(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrAnonDisabled) {
+			http.Error(w, "anonymous tokens are disabled for this tenant", http.StatusNotFound)
+			return AnonTenantDeps{}, err
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return AnonTenantDeps{}, err
+	}
+	return deps, nil
+}
+
+type anonChallengeResponse struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type anonTokenRequest struct {
+	Challenge string              `json:"challenge"`
+	Solution  string              `json:"solution"`
+	DeviceKey anonlogin.DeviceKey `json:"deviceKey"`
+	Signature string              `json:"signature"`
+}
+
+type anonTokenResponse struct {
+	AccessToken string `json:"accessToken"`
+	TokenType   string `json:"tokenType"`
+	ExpiresIn   int    `json:"expiresIn"`
+	Subject     string `json:"subject"`
+}
+
+// handleChallenge はプルーフオブワークのチャレンジを返す。
+func (h *AnonHandler) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	deps, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	out, err := deps.Usecase.Challenge(ctx)
+	if err != nil {
+		h.logger.Printf("failed to issue anonymous challenge: %v", err)
+		http.Error(w, "failed to issue challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(anonChallengeResponse{
+		Challenge:  out.Challenge,
+		Difficulty: out.Difficulty,
+		ExpiresAt:  out.ExpiresAt,
+	}); err != nil {
+		h.logger.Printf("failed to encode anonymous challenge response: %v", err)
+	}
+}
+
+// handleToken はチャレンジの解と端末鍵の署名を検証し、匿名トークンを返す。
+func (h *AnonHandler) handleToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	deps, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	var req anonTokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	out, err := deps.Usecase.Issue(ctx, anonlogin.IssueInput{
+		Challenge: req.Challenge,
+		Solution:  req.Solution,
+		DeviceKey: req.DeviceKey,
+		Signature: req.Signature,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, anonlogin.ErrInvalidChallenge):
+			http.Error(w, "invalid challenge", http.StatusBadRequest)
+		case errors.Is(err, anonlogin.ErrChallengeExpired):
+			http.Error(w, "challenge expired", http.StatusBadRequest)
+		case errors.Is(err, anonlogin.ErrChallengeReused):
+			http.Error(w, "challenge already used", http.StatusConflict)
+		case errors.Is(err, anonlogin.ErrInsufficientWork):
+			http.Error(w, "insufficient proof of work", http.StatusBadRequest)
+		case errors.Is(err, anonlogin.ErrInvalidDeviceKey):
+			http.Error(w, "invalid device key", http.StatusBadRequest)
+		case errors.Is(err, anonlogin.ErrInvalidSignature):
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+		default:
+			h.logger.Printf("failed to issue anonymous token: %v", err)
+			http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(anonTokenResponse{
+		AccessToken: out.AccessToken,
+		TokenType:   out.TokenType,
+		ExpiresIn:   out.ExpiresIn,
+		Subject:     out.Subject,
+	}); err != nil {
+		h.logger.Printf("failed to encode anonymous token response: %v", err)
+	}
+}
+
+// prepare はテナントの依存を解決し、ブラウザからの呼び出しならオリジンを確認してCORSヘッダを付ける。
+// サーバー間の呼び出し（Originなし）はそのまま通す。
+func (h *AnonHandler) prepare(w http.ResponseWriter, r *http.Request) (AnonTenantDeps, bool) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return AnonTenantDeps{}, false
+	}
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return AnonTenantDeps{}, false
+		}
+		h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	}
+	return deps, true
+}
+
+func (h *AnonHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isOriginAllowed は許可済みオリジンかを判定する。allowed が空なら全許可。
+func (h *AnonHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	_, ok := allowed[origin]
+	return ok
+}
+
+// applyCORSHeaders は許可済みオリジンに対してCORSレスポンスヘッダを付与する。
+func (h *AnonHandler) applyCORSHeaders(allowed map[string]struct{}, w http.ResponseWriter, origin string) {
+	if !h.isOriginAllowed(allowed, origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Vary", "Origin")
+}
@@ -0,0 +1,100 @@
+package httpadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/anonlogin"
+)
+
+// 匿名トークン発行のエラーをHTTPステータスへ写す対応をテーブル駆動で検証する。
+func TestAnonHandler_Token(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		origin     string
+		issueErr   error
+		wantStatus int
+	}{
+		{name: "発行成功", origin: "https://app.example.com", wantStatus: http.StatusOK},
+		{name: "サーバー間（Originなし）", wantStatus: http.StatusOK},
+		{name: "origin未許可", origin: "https://bad.example.com", wantStatus: http.StatusForbidden},
+		{name: "解が不足", origin: "https://app.example.com", issueErr: anonlogin.ErrInsufficientWork, wantStatus: http.StatusBadRequest},
+		{name: "チャレンジ再利用", origin: "https://app.example.com", issueErr: anonlogin.ErrChallengeReused, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock := &mockAnonResolver{
+				deps: AnonTenantDeps{
+					Usecase: &mockAnonUsecase{
+						issueOut: &anonlogin.IssueOutput{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 600, Subject: "anon:abc"},
+						issueErr: tt.issueErr,
+					},
+					AllowedOrigins: map[string]struct{}{"https://app.example.com": {}},
+				},
+			}
+			h := NewAnonHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+			var buf bytes.Buffer
+			_ = json.NewEncoder(&buf).Encode(map[string]any{"challenge": "c", "solution": "1", "signature": "sig"})
+			req := httptest.NewRequest(http.MethodPost, "/anonymous/token", &buf)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			rr := httptest.NewRecorder()
+
+			h.handleToken(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var res anonTokenResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if res.AccessToken != "jwt" || res.Subject != "anon:abc" {
+				t.Fatalf("unexpected response: %+v", res)
+			}
+		})
+	}
+}
+
+// --- mocks ---
+
+type mockAnonResolver struct {
+	deps AnonTenantDeps
+}
+
+func (m *mockAnonResolver) ResolveAnon(string) (AnonTenantDeps, error) {
+	return m.deps, nil
+}
+
+type mockAnonUsecase struct {
+	issueOut *anonlogin.IssueOutput
+	issueErr error
+}
+
+func (m *mockAnonUsecase) Challenge(context.Context) (*anonlogin.ChallengeOutput, error) {
+	return &anonlogin.ChallengeOutput{Challenge: "c", Difficulty: 8, ExpiresAt: time.Now().Add(time.Minute)}, nil
+}
+
+func (m *mockAnonUsecase) Issue(context.Context, anonlogin.IssueInput) (*anonlogin.IssueOutput, error) {
+	if m.issueErr != nil {
+		return nil, m.issueErr
+	}
+	return m.issueOut, nil
+}
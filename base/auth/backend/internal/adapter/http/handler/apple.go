@@ -0,0 +1,386 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/applelogin"
+)
+
+// AppleHandler はAppleログインのHTTP境界をまとめる。
+type AppleHandler struct {
+	resolver    AppleTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewAppleHandler はApple用ハンドラを初期化する。
+func NewAppleHandler(
+	resolver AppleTenantResolver,
+	httpTimeout time.Duration,
+	logger *log.Logger,
+) *AppleHandler {
+	return &AppleHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターにApple用エンドポイントを登録する。
+func (h *AppleHandler) RegisterRoutes(r chi.Router) {
+	r.Options("/apple/login", h.handlePreflight)
+	r.Post("/apple/login", h.handleLoginStart)
+	// Appleは response_mode=form_post でコールバックをPOSTする。
+	r.Post("/apple/callback", h.handleCallback)
+}
+
+func (h *AppleHandler) depsFromRequest(w http.ResponseWriter, r *http.Request) (AppleTenantDeps, error) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return AppleTenantDeps{}, errors.New("tenant missing")
+	}
+	deps, err := h.resolver.ResolveApple(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrAppleDisabled) {
+			http.Error(w, "apple auth is disabled for this tenant", http.StatusNotFound)
+			return AppleTenantDeps{}, err
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return AppleTenantDeps{}, err
+	}
+	return deps, nil
+}
+
+type appleLoginRequest struct {
+	Origin string `json:"origin"`
+	// Display が "popup" ならコールバックでポップアップ完了ページを返す。
+	Display string `json:"display,omitempty"`
+}
+
+type appleLoginResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// handleLoginStart はログイン開始要求を受け付け、認可URLとstateを返す。
+func (h *AppleHandler) handleLoginStart(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	headerOrigin := r.Header.Get("Origin")
+
+	var req appleLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("failed to decode apple login request: %v", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	origin := strings.TrimSpace(req.Origin)
+	if origin == "" {
+		origin = strings.TrimSpace(headerOrigin)
+	}
+
+	if origin != "" && !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		h.logger.Printf("apple login start rejected: origin %q not allowed", origin)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if origin == "" {
+		http.Error(w, "origin is required", http.StatusBadRequest)
+		return
+	}
+
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	out, err := deps.Usecase.Start(ctx, origin)
+	if err != nil {
+		if errors.Is(err, applelogin.ErrOriginNotAllowed) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, applelogin.ErrOriginRequired) {
+			http.Error(w, "origin is required", http.StatusBadRequest)
+			return
+		}
+		h.logger.Printf("failed to start apple login: %v", err)
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	deps.StateCookie.set(w, appleStateCookieProvider, out.Nonce)
+	if req.Display == displayPopup {
+		deps.StateCookie.setPopup(w, appleStateCookieProvider)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(appleLoginResponse{
+		AuthorizationURL: out.AuthorizationURL,
+		State:            out.State,
+	}); err != nil {
+		h.logger.Printf("failed to encode apple login response: %v", err)
+	}
+}
+
+// handleCallback はAppleのform_postコールバックを処理し、リダイレクトを返す。
+func (h *AppleHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		h.logger.Printf("failed to parse apple callback form: %v", err)
+		http.Error(w, "invalid callback", http.StatusBadRequest)
+		return
+	}
+
+	stateParam := r.PostForm.Get("state")
+	code := r.PostForm.Get("code")
+
+	if errorCode := r.PostForm.Get("error"); errorCode != "" {
+		h.logger.Printf("Apple login returned error: %s", errorCode)
+		result := appleLoginResult{
+			Type:    appleLoginResultMessageType,
+			Success: false,
+			State:   stateParam,
+			Error:   fmt.Sprintf("Apple認証がキャンセルされました: %s", errorCode),
+		}
+		if payload, err := deps.Usecase.DecodeState(stateParam); err == nil {
+			result.Origin = payload.Origin
+		}
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, appleStateCookieProvider))
+		h.redirectWithResult(w, r, result, builder, deps.Usecase.DecodeState)
+		return
+	}
+
+	if payload, err := deps.Usecase.DecodeState(stateParam); err == nil && payload != nil &&
+		!deps.StateCookie.matches(r, appleStateCookieProvider, payload.Nonce) {
+		h.logger.Printf("apple callback rejected: state cookie mismatch")
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, appleStateCookieProvider))
+		h.redirectWithResult(w, r, appleLoginResult{
+			Type:      appleLoginResultMessageType,
+			Success:   false,
+			State:     stateParam,
+			Origin:    payload.Origin,
+			Error:     stateMismatchMessage,
+			ErrorCode: errorCodeStateMismatch,
+		}, builder, deps.Usecase.DecodeState)
+		return
+	}
+	deps.StateCookie.clear(w, appleStateCookieProvider)
+
+	result, err := deps.Usecase.Callback(ctx, code, stateParam, r.PostForm.Get("user"))
+	if err != nil {
+		h.logger.Printf("apple callback handling failed: %v", err)
+		http.Error(w, "failed to handle callback", http.StatusInternalServerError)
+		return
+	}
+
+	loginRes := appleLoginResult{
+		Type:    appleLoginResultMessageType,
+		Success: result.Success,
+		State:   result.State,
+		Origin:  result.Origin,
+	}
+	if result.Payload != nil {
+		loginRes.Payload = &appleLoginResultPayload{
+			AccessToken: result.Payload.AccessToken,
+			TokenType:   result.Payload.TokenType,
+			ExpiresIn:   result.Payload.ExpiresIn,
+			AppleUser: appleLoginUser{
+				UserID:      result.Payload.AppleUser.ID,
+				Email:       result.Payload.AppleUser.Email,
+				DisplayName: result.Payload.AppleUser.DisplayName,
+			},
+		}
+	}
+	if !result.Success && result.ErrorMessage != "" {
+		loginRes.Error = result.ErrorMessage
+	}
+
+	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+		WithOIDC(deps.OIDC).
+		WithPages(deps.Pages, deps.StateCookie.popup(r, appleStateCookieProvider)).
+		WithSession(deps.Session).
+		WithNotifier(deps.Webhooks)
+	h.redirectWithResult(w, r, loginRes, builder, deps.Usecase.DecodeState)
+}
+
+// handlePreflight はCORSプリフライトを処理する。
+func (h *AppleHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	appleLoginResultMessageType = "oauth-login-result"
+	appleStateCookieProvider    = "apple"
+)
+
+type appleLoginResult struct {
+	Type      string                   `json:"type"`
+	Success   bool                     `json:"success"`
+	State     string                   `json:"state,omitempty"`
+	Origin    string                   `json:"origin,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+	ErrorCode string                   `json:"errorCode,omitempty"`
+	Session   bool                     `json:"session,omitempty"`
+	Payload   *appleLoginResultPayload `json:"payload,omitempty"`
+}
+
+// upstream はOIDCへ引き渡すためにプロバイダ非依存の結果へ変換する。
+func (r appleLoginResult) upstream() UpstreamResult {
+	res := UpstreamResult{Provider: appleStateCookieProvider, Success: r.Success, Error: r.Error}
+	if r.Payload != nil {
+		res.AccessToken = r.Payload.AccessToken
+		res.TokenType = r.Payload.TokenType
+		res.ExpiresIn = r.Payload.ExpiresIn
+		res.Subject = r.Payload.AppleUser.UserID
+		res.Name = r.Payload.AppleUser.DisplayName
+		res.Email = r.Payload.AppleUser.Email
+	}
+	return res
+}
+
+// withholdToken はセッションCookieモードの結果からJWTを取り除く。
+func (r *appleLoginResult) withholdToken() {
+	r.Session = true
+	if r.Payload != nil {
+		r.Payload.AccessToken, r.Payload.TokenType, r.Payload.ExpiresIn = "", "", 0
+	}
+}
+
+type appleLoginResultPayload struct {
+	AccessToken string         `json:"accessToken,omitempty"`
+	TokenType   string         `json:"tokenType,omitempty"`
+	ExpiresIn   int            `json:"expiresIn,omitempty"`
+	AppleUser   appleLoginUser `json:"appleUser"`
+}
+
+type appleLoginUser struct {
+	UserID      string `json:"userId"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// redirectWithResult は結果をフラグメントに載せてリダイレクトする（ポップアップ開始ならpostMessageで返す）。
+func (h *AppleHandler) redirectWithResult(
+	w http.ResponseWriter,
+	r *http.Request,
+	result appleLoginResult,
+	builder *RedirectBuilder,
+	decodeState func(string) (*applelogin.StatePayload, error),
+) {
+	if err := builder.notifyLogin(r.Context(), result.upstream()); err != nil {
+		h.logger.Printf("failed to notify login webhooks: %v", err)
+	}
+	if builder.handoff(w, r, result.Origin, result.upstream()) {
+		return
+	}
+	if !builder.startSession(w, &result, h.logger) {
+		return
+	}
+	target, err := h.buildRedirectURL(result, builder, decodeState)
+	if err != nil {
+		h.logger.Printf("failed to build apple redirect URL: %v", err)
+	}
+	if err := builder.complete(w, r, result.Origin, result.upstream(), result, target); err != nil {
+		h.logger.Printf("failed to render login result page: %v", err)
+	}
+}
+
+func (h *AppleHandler) buildRedirectURL(
+	result appleLoginResult,
+	builder *RedirectBuilder,
+	decodeState func(string) (*applelogin.StatePayload, error),
+) (string, error) {
+	origin := strings.TrimSpace(result.Origin)
+	if origin == "" && result.State != "" && decodeState != nil {
+		if payload, err := decodeState(result.State); err == nil {
+			origin = payload.Origin
+		}
+	}
+	if origin == "" {
+		origin = builder.defaultOrigin
+	}
+	if origin == "" {
+		return "", fmt.Errorf("redirect origin is empty")
+	}
+
+	base, err := url.Parse(origin)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect origin %q: %w", origin, err)
+	}
+
+	base.Path = builder.redirectPath
+	base.RawQuery = ""
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal login result: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	base.Fragment = "oauth-login=" + encoded
+
+	return base.String(), nil
+}
+
+func (h *AppleHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	_, ok := allowed[origin]
+	return ok
+}
+
+// applyCORSHeaders は許可済みオリジンに対してCORSレスポンスヘッダを付与する。
+func (h *AppleHandler) applyCORSHeaders(allowed map[string]struct{}, w http.ResponseWriter, origin string) {
+	if !h.isOriginAllowed(allowed, origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Vary", "Origin")
+}
@@ -0,0 +1,114 @@
+package httpadapter
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/applelogin"
+)
+
+// form_post のコールバックをテーブル駆動で検証する。
+func TestAppleHandler_Callback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantCallback bool
+		wantUser     string
+	}{
+		{
+			name:         "初回ログインでuserを受け取る",
+			form:         url.Values{"state": {"st"}, "code": {"cd"}, "user": {`{"name":{"firstName":"Taro"}}`}},
+			wantCallback: true,
+			wantUser:     `{"name":{"firstName":"Taro"}}`,
+		},
+		{
+			name:         "2回目以降はuserなし",
+			form:         url.Values{"state": {"st"}, "code": {"cd"}},
+			wantCallback: true,
+		},
+		{
+			name: "ユーザーがキャンセル",
+			form: url.Values{"state": {"st"}, "error": {"user_cancelled_authorize"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			usecase := &mockAppleUsecase{
+				callbackOut: &applelogin.CallbackResult{
+					Success: true,
+					State:   "st",
+					Origin:  "https://app.example.com",
+				},
+			}
+			mock := &mockAppleResolver{
+				deps: AppleTenantDeps{
+					Usecase:               usecase,
+					DefaultRedirectOrigin: "https://app.example.com",
+					RedirectPath:          "/done",
+					StateCookie:           StateCookie{Disabled: true},
+				},
+			}
+			h := NewAppleHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+			req := httptest.NewRequest(http.MethodPost, "/apple/callback", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			rr := httptest.NewRecorder()
+			h.handleCallback(rr, req)
+
+			if rr.Code != http.StatusSeeOther {
+				t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+			}
+			if loc := rr.Header().Get("Location"); !strings.HasPrefix(loc, "https://app.example.com/done#oauth-login=") {
+				t.Fatalf("unexpected location: %s", loc)
+			}
+			if usecase.called != tt.wantCallback {
+				t.Fatalf("callback called=%v want=%v", usecase.called, tt.wantCallback)
+			}
+			if usecase.gotUser != tt.wantUser {
+				t.Fatalf("user=%q want=%q", usecase.gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+// --- mocks ---
+
+type mockAppleResolver struct {
+	deps AppleTenantDeps
+}
+
+func (m *mockAppleResolver) ResolveApple(string) (AppleTenantDeps, error) { return m.deps, nil }
+
+type mockAppleUsecase struct {
+	startOut    *applelogin.StartOutput
+	startErr    error
+	callbackOut *applelogin.CallbackResult
+	callbackErr error
+	called      bool
+	gotUser     string
+}
+
+func (m *mockAppleUsecase) Start(context.Context, string) (*applelogin.StartOutput, error) {
+	return m.startOut, m.startErr
+}
+func (m *mockAppleUsecase) Callback(_ context.Context, _, _, userJSON string) (*applelogin.CallbackResult, error) {
+	m.called = true
+	m.gotUser = userJSON
+	return m.callbackOut, m.callbackErr
+}
+func (m *mockAppleUsecase) DecodeState(string) (*applelogin.StatePayload, error) {
+	return &applelogin.StatePayload{Origin: "https://app.example.com"}, nil
+}
@@ -4,14 +4,27 @@ import (
 	"context"
 	"errors"
 
+	"github.com/sngm3741/roots/base/auth/internal/usecase/anonlogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/applelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/discordlogin"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/twitterlogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/webhook"
 )
 
 // プロバイダが無効な場合に返すエラー。
 var (
-	ErrLineDisabled    = errors.New("line disabled for tenant")
-	ErrTwitterDisabled = errors.New("twitter disabled for tenant")
+	ErrLineDisabled     = errors.New("line disabled for tenant")
+	ErrTwitterDisabled  = errors.New("twitter disabled for tenant")
+	ErrDiscordDisabled  = errors.New("discord disabled for tenant")
+	ErrAppleDisabled    = errors.New("apple disabled for tenant")
+	ErrOIDCDisabled     = errors.New("oidc provider disabled for tenant")
+	ErrVaultDisabled    = errors.New("token vault disabled for tenant")
+	ErrAnonDisabled     = errors.New("anonymous tokens disabled for tenant")
+	ErrSessionDisabled  = errors.New("session cookie mode disabled for tenant")
+	ErrWebhooksDisabled = errors.New("webhooks disabled for tenant")
 )
 
 // LineTenantDeps はテナント別のLINEログイン用依存をまとめる。
@@ -20,12 +33,22 @@ type LineTenantDeps struct {
 	AllowedOrigins        map[string]struct{}
 	DefaultRedirectOrigin string
 	RedirectPath          string
+	StateCookie           StateCookie
+	// OIDC はOIDCの選択ページから始まったログインを認可フローへ戻す。OIDC無効のテナントではnil。
+	OIDC OIDCHandoff
+	// Pages は結果・ポップアップ完了ページの描画。nilなら既定のページを使う。
+	Pages *Pages
+	// Session はセッションCookieモードの設定。nilならJWTをフラグメントで返す。
+	Session *SessionCookie
+	// Webhooks はログインをテナントのアプリへ通知する。Webhook未設定のテナントではnil。
+	Webhooks LoginNotifier
 }
 
 // LineUsecase はLINEログインユースケースの最小インターフェース。
 type LineUsecase interface {
 	Start(ctx context.Context, origin string) (*linelogin.StartOutput, error)
 	Callback(ctx context.Context, code, stateParam string) (*linelogin.CallbackResult, error)
+	DecodeState(state string) (*linelogin.StatePayload, error)
 }
 
 // LineTenantResolver はテナントIDからLINE用依存を解決する。
@@ -39,6 +62,15 @@ type TwitterTenantDeps struct {
 	AllowedOrigins        map[string]struct{}
 	DefaultRedirectOrigin string
 	RedirectPath          string
+	StateCookie           StateCookie
+	// OIDC はOIDCの選択ページから始まったログインを認可フローへ戻す。OIDC無効のテナントではnil。
+	OIDC OIDCHandoff
+	// Pages は結果・ポップアップ完了ページの描画。nilなら既定のページを使う。
+	Pages *Pages
+	// Session はセッションCookieモードの設定。nilならJWTをフラグメントで返す。
+	Session *SessionCookie
+	// Webhooks はログインをテナントのアプリへ通知する。Webhook未設定のテナントではnil。
+	Webhooks LoginNotifier
 }
 
 // TwitterUsecase はTwitterログインユースケースの最小インターフェース。
@@ -52,3 +84,172 @@ type TwitterUsecase interface {
 type TwitterTenantResolver interface {
 	ResolveTwitter(tenantID string) (TwitterTenantDeps, error)
 }
+
+// DiscordTenantDeps はテナント別のDiscordログイン用依存をまとめる。
+type DiscordTenantDeps struct {
+	Usecase               DiscordUsecase
+	AllowedOrigins        map[string]struct{}
+	DefaultRedirectOrigin string
+	RedirectPath          string
+	StateCookie           StateCookie
+	// OIDC はOIDCの選択ページから始まったログインを認可フローへ戻す。OIDC無効のテナントではnil。
+	OIDC OIDCHandoff
+	// Pages は結果・ポップアップ完了ページの描画。nilなら既定のページを使う。
+	Pages *Pages
+	// Session はセッションCookieモードの設定。nilならJWTをフラグメントで返す。
+	Session *SessionCookie
+	// Webhooks はログインをテナントのアプリへ通知する。Webhook未設定のテナントではnil。
+	Webhooks LoginNotifier
+}
+
+// DiscordUsecase はDiscordログインユースケースの最小インターフェース。
+type DiscordUsecase interface {
+	Start(ctx context.Context, origin string) (*discordlogin.StartOutput, error)
+	Callback(ctx context.Context, code, stateParam string) (*discordlogin.CallbackResult, error)
+	DecodeState(state string) (*discordlogin.StatePayload, error)
+}
+
+// DiscordTenantResolver はテナントIDからDiscord用依存を解決する。
+type DiscordTenantResolver interface {
+	ResolveDiscord(tenantID string) (DiscordTenantDeps, error)
+}
+
+// AppleTenantDeps はテナント別のSign in with Apple用依存をまとめる。
+type AppleTenantDeps struct {
+	Usecase               AppleUsecase
+	AllowedOrigins        map[string]struct{}
+	DefaultRedirectOrigin string
+	RedirectPath          string
+	StateCookie           StateCookie
+	// OIDC はOIDCの選択ページから始まったログインを認可フローへ戻す。OIDC無効のテナントではnil。
+	OIDC OIDCHandoff
+	// Pages は結果・ポップアップ完了ページの描画。nilなら既定のページを使う。
+	Pages *Pages
+	// Session はセッションCookieモードの設定。nilならJWTをフラグメントで返す。
+	Session *SessionCookie
+	// Webhooks はログインをテナントのアプリへ通知する。Webhook未設定のテナントではnil。
+	Webhooks LoginNotifier
+}
+
+// AppleUsecase はSign in with Appleユースケースの最小インターフェース。
+type AppleUsecase interface {
+	Start(ctx context.Context, origin string) (*applelogin.StartOutput, error)
+	Callback(ctx context.Context, code, stateParam, userJSON string) (*applelogin.CallbackResult, error)
+	DecodeState(state string) (*applelogin.StatePayload, error)
+}
+
+// AppleTenantResolver はテナントIDからApple用依存を解決する。
+type AppleTenantResolver interface {
+	ResolveApple(tenantID string) (AppleTenantDeps, error)
+}
+
+// OIDCTenantDeps はテナント別のOIDCプロバイダ用依存をまとめる。
+type OIDCTenantDeps struct {
+	Usecase OIDCUsecase
+	// Upstreams は選択ページに並べる上流ログイン（有効なもののみ）。
+	Upstreams []OIDCUpstream
+	// AllowedOrigins は /token・/userinfo のCORSを許可するオリジン（登録クライアントのredirect_uri由来）。
+	AllowedOrigins map[string]struct{}
+	// RequestCookie は選択ページから上流ログイン完了まで認可リクエストIDを保持するCookie。
+	RequestCookie OIDCRequestCookie
+	// DeviceCookie は /device での入力から上流ログイン完了までユーザーコードを保持するCookie。
+	DeviceCookie OIDCRequestCookie
+	// Pages は選択・エラーページの描画。nilなら既定のページを使う。
+	Pages *Pages
+}
+
+// OIDCUpstream は選択ページに表示する上流ログイン1件。
+type OIDCUpstream struct {
+	ID        string
+	Label     string
+	LoginPath string
+}
+
+// OIDCUsecase はOIDCプロバイダユースケースの最小インターフェース。
+type OIDCUsecase interface {
+	Issuer() string
+	Authorize(ctx context.Context, in oidcprovider.AuthorizeInput) (*oidcprovider.AuthorizationRequest, error)
+	Complete(ctx context.Context, requestID string, identity oidcprovider.Identity) (string, error)
+	Deny(ctx context.Context, requestID, description string) (string, error)
+	ErrorRedirect(e *oidcprovider.Error) string
+	Exchange(ctx context.Context, in oidcprovider.TokenInput) (*oidcprovider.TokenResponse, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]any, error)
+	Discovery() oidcprovider.Discovery
+	JWKS() oidcprovider.JWKS
+	StartDevice(ctx context.Context, in oidcprovider.DeviceInput) (*oidcprovider.DeviceAuthorization, error)
+	LookupDevice(ctx context.Context, userCode string) (*oidcprovider.DeviceRequest, error)
+	ApproveDevice(ctx context.Context, userCode string, identity oidcprovider.Identity, token oidcprovider.DeviceToken) error
+	DenyDevice(ctx context.Context, userCode string) error
+}
+
+// OIDCTenantResolver はテナントIDからOIDC用依存を解決する。
+type OIDCTenantResolver interface {
+	ResolveOIDC(tenantID string) (OIDCTenantDeps, error)
+}
+
+// TokenVaultTenantDeps はテナント別のトークン保管庫APIの依存をまとめる。
+type TokenVaultTenantDeps struct {
+	Vault TokenVaultUsecase
+	// Verifier は内部サービスのサービストークン（client_credentials）を検証する。
+	Verifier ServiceTokenVerifier
+}
+
+// TokenVaultUsecase はトークン保管庫の最小インターフェース。
+type TokenVaultUsecase interface {
+	Get(ctx context.Context, provider, subject string) (*tokenvault.Token, error)
+}
+
+// ServiceTokenVerifier はサービストークンを検証し、クライアントIDを返す。
+type ServiceTokenVerifier interface {
+	VerifyServiceToken(token, scope string) (string, error)
+}
+
+// TokenVaultTenantResolver はテナントIDからトークン保管庫APIの依存を解決する。
+type TokenVaultTenantResolver interface {
+	ResolveTokenVault(tenantID string) (TokenVaultTenantDeps, error)
+}
+
+// AnonTenantDeps はテナント別の匿名トークン発行用依存をまとめる。
+type AnonTenantDeps struct {
+	Usecase        AnonUsecase
+	AllowedOrigins map[string]struct{}
+}
+
+// AnonUsecase は匿名トークン発行ユースケースの最小インターフェース。
+type AnonUsecase interface {
+	Challenge(ctx context.Context) (*anonlogin.ChallengeOutput, error)
+	Issue(ctx context.Context, in anonlogin.IssueInput) (*anonlogin.IssueOutput, error)
+}
+
+// AnonTenantResolver はテナントIDから匿名トークン用依存を解決する。
+type AnonTenantResolver interface {
+	ResolveAnon(tenantID string) (AnonTenantDeps, error)
+}
+
+// SessionTenantDeps はテナント別のセッションCookieモード用依存をまとめる。
+type SessionTenantDeps struct {
+	Cookie         *SessionCookie
+	AllowedOrigins map[string]struct{}
+}
+
+// SessionTenantResolver はテナントIDからセッション用依存を解決する。
+type SessionTenantResolver interface {
+	ResolveSession(tenantID string) (SessionTenantDeps, error)
+}
+
+// WebhookTenantDeps はテナント別のWebhook配信ログAPIの依存をまとめる。
+type WebhookTenantDeps struct {
+	Log WebhookLog
+	// Verifier は内部サービスのサービストークン（client_credentials）を検証する。
+	Verifier ServiceTokenVerifier
+}
+
+// WebhookLog はWebhook配信ログの最小インターフェース。
+type WebhookLog interface {
+	Deliveries(ctx context.Context) ([]webhook.Delivery, error)
+}
+
+// WebhookTenantResolver はテナントIDからWebhook配信ログAPIの依存を解決する。
+type WebhookTenantResolver interface {
+	ResolveWebhooks(tenantID string) (WebhookTenantDeps, error)
+}
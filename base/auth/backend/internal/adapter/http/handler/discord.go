@@ -0,0 +1,381 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/discordlogin"
+)
+
+// DiscordHandler はDiscordログインのHTTP境界をまとめる。
+type DiscordHandler struct {
+	resolver    DiscordTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewDiscordHandler はDiscord用ハンドラを初期化する。
+func NewDiscordHandler(
+	resolver DiscordTenantResolver,
+	httpTimeout time.Duration,
+	logger *log.Logger,
+) *DiscordHandler {
+	return &DiscordHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターにDiscord用エンドポイントを登録する。
+func (h *DiscordHandler) RegisterRoutes(r chi.Router) {
+	r.Options("/discord/login", h.handlePreflight)
+	r.Post("/discord/login", h.handleLoginStart)
+	r.Get("/discord/callback", h.handleCallback)
+}
+
+func (h *DiscordHandler) depsFromRequest(w http.ResponseWriter, r *http.Request) (DiscordTenantDeps, error) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return DiscordTenantDeps{}, errors.New("tenant missing")
+	}
+	deps, err := h.resolver.ResolveDiscord(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrDiscordDisabled) {
+			http.Error(w, "discord auth is disabled for this tenant", http.StatusNotFound)
+			return DiscordTenantDeps{}, err
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return DiscordTenantDeps{}, err
+	}
+	return deps, nil
+}
+
+type discordLoginRequest struct {
+	Origin string `json:"origin"`
+	// Display が "popup" ならコールバックでポップアップ完了ページを返す。
+	Display string `json:"display,omitempty"`
+}
+
+type discordLoginResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// handleLoginStart はログイン開始要求を受け付け、認可URLとstateを返す。
+func (h *DiscordHandler) handleLoginStart(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	headerOrigin := r.Header.Get("Origin")
+
+	var req discordLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("failed to decode discord login request: %v", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	origin := strings.TrimSpace(req.Origin)
+	if origin == "" {
+		origin = strings.TrimSpace(headerOrigin)
+	}
+
+	if origin != "" && !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		h.logger.Printf("discord login start rejected: origin %q not allowed", origin)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if origin == "" {
+		http.Error(w, "origin is required", http.StatusBadRequest)
+		return
+	}
+
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	out, err := deps.Usecase.Start(ctx, origin)
+	if err != nil {
+		if errors.Is(err, discordlogin.ErrOriginNotAllowed) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, discordlogin.ErrOriginRequired) {
+			http.Error(w, "origin is required", http.StatusBadRequest)
+			return
+		}
+		h.logger.Printf("failed to start discord login: %v", err)
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	deps.StateCookie.set(w, discordStateCookieProvider, out.Nonce)
+	if req.Display == displayPopup {
+		deps.StateCookie.setPopup(w, discordStateCookieProvider)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(discordLoginResponse{
+		AuthorizationURL: out.AuthorizationURL,
+		State:            out.State,
+	}); err != nil {
+		h.logger.Printf("failed to encode discord login response: %v", err)
+	}
+}
+
+// handleCallback はDiscordのコールバックを処理し、リダイレクトを返す。
+func (h *DiscordHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	stateParam := r.URL.Query().Get("state")
+	code := r.URL.Query().Get("code")
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		errorDescription := r.URL.Query().Get("error_description")
+		h.logger.Printf("Discord login returned error: %s (%s)", errorCode, errorDescription)
+		result := discordLoginResult{
+			Type:    discordLoginResultMessageType,
+			Success: false,
+			State:   stateParam,
+			Error:   fmt.Sprintf("Discord認証がキャンセルされました: %s", errorCode),
+		}
+		if payload, err := deps.Usecase.DecodeState(stateParam); err == nil {
+			result.Origin = payload.Origin
+		}
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, discordStateCookieProvider))
+		h.redirectWithResult(w, r, result, builder, deps.Usecase.DecodeState)
+		return
+	}
+
+	if payload, err := deps.Usecase.DecodeState(stateParam); err == nil && payload != nil &&
+		!deps.StateCookie.matches(r, discordStateCookieProvider, payload.Nonce) {
+		h.logger.Printf("discord callback rejected: state cookie mismatch")
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, discordStateCookieProvider))
+		h.redirectWithResult(w, r, discordLoginResult{
+			Type:      discordLoginResultMessageType,
+			Success:   false,
+			State:     stateParam,
+			Origin:    payload.Origin,
+			Error:     stateMismatchMessage,
+			ErrorCode: errorCodeStateMismatch,
+		}, builder, deps.Usecase.DecodeState)
+		return
+	}
+	deps.StateCookie.clear(w, discordStateCookieProvider)
+
+	result, err := deps.Usecase.Callback(ctx, code, stateParam)
+	if err != nil {
+		h.logger.Printf("discord callback handling failed: %v", err)
+		http.Error(w, "failed to handle callback", http.StatusInternalServerError)
+		return
+	}
+
+	loginRes := discordLoginResult{
+		Type:    discordLoginResultMessageType,
+		Success: result.Success,
+		State:   result.State,
+		Origin:  result.Origin,
+	}
+	if result.Payload != nil {
+		loginRes.Payload = &discordLoginResultPayload{
+			AccessToken: result.Payload.AccessToken,
+			TokenType:   result.Payload.TokenType,
+			ExpiresIn:   result.Payload.ExpiresIn,
+			DiscordUser: discordLoginUser{
+				UserID:      result.Payload.DiscordUser.ID,
+				Username:    result.Payload.DiscordUser.Username,
+				DisplayName: result.Payload.DiscordUser.DisplayName,
+				AvatarURL:   result.Payload.DiscordUser.AvatarURL,
+			},
+		}
+	}
+	if !result.Success && result.ErrorMessage != "" {
+		loginRes.Error = result.ErrorMessage
+	}
+
+	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+		WithOIDC(deps.OIDC).
+		WithPages(deps.Pages, deps.StateCookie.popup(r, discordStateCookieProvider)).
+		WithSession(deps.Session).
+		WithNotifier(deps.Webhooks)
+	h.redirectWithResult(w, r, loginRes, builder, deps.Usecase.DecodeState)
+}
+
+// handlePreflight はCORSプリフライトを処理する。
+func (h *DiscordHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	discordLoginResultMessageType = "oauth-login-result"
+	discordStateCookieProvider    = "discord"
+)
+
+type discordLoginResult struct {
+	Type      string                     `json:"type"`
+	Success   bool                       `json:"success"`
+	State     string                     `json:"state,omitempty"`
+	Origin    string                     `json:"origin,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+	ErrorCode string                     `json:"errorCode,omitempty"`
+	Session   bool                       `json:"session,omitempty"`
+	Payload   *discordLoginResultPayload `json:"payload,omitempty"`
+}
+
+// upstream はOIDCへ引き渡すためにプロバイダ非依存の結果へ変換する。
+func (r discordLoginResult) upstream() UpstreamResult {
+	res := UpstreamResult{Provider: discordStateCookieProvider, Success: r.Success, Error: r.Error}
+	if r.Payload != nil {
+		res.AccessToken = r.Payload.AccessToken
+		res.TokenType = r.Payload.TokenType
+		res.ExpiresIn = r.Payload.ExpiresIn
+		res.Subject = r.Payload.DiscordUser.UserID
+		res.Name = r.Payload.DiscordUser.DisplayName
+		res.Picture = r.Payload.DiscordUser.AvatarURL
+	}
+	return res
+}
+
+// withholdToken はセッションCookieモードの結果からJWTを取り除く。
+func (r *discordLoginResult) withholdToken() {
+	r.Session = true
+	if r.Payload != nil {
+		r.Payload.AccessToken, r.Payload.TokenType, r.Payload.ExpiresIn = "", "", 0
+	}
+}
+
+type discordLoginResultPayload struct {
+	AccessToken string           `json:"accessToken,omitempty"`
+	TokenType   string           `json:"tokenType,omitempty"`
+	ExpiresIn   int              `json:"expiresIn,omitempty"`
+	DiscordUser discordLoginUser `json:"discordUser"`
+}
+
+type discordLoginUser struct {
+	UserID      string `json:"userId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+}
+
+// redirectWithResult は結果をフラグメントに載せてリダイレクトする（ポップアップ開始ならpostMessageで返す）。
+func (h *DiscordHandler) redirectWithResult(
+	w http.ResponseWriter,
+	r *http.Request,
+	result discordLoginResult,
+	builder *RedirectBuilder,
+	decodeState func(string) (*discordlogin.StatePayload, error),
+) {
+	if err := builder.notifyLogin(r.Context(), result.upstream()); err != nil {
+		h.logger.Printf("failed to notify login webhooks: %v", err)
+	}
+	if builder.handoff(w, r, result.Origin, result.upstream()) {
+		return
+	}
+	if !builder.startSession(w, &result, h.logger) {
+		return
+	}
+	target, err := h.buildRedirectURL(result, builder, decodeState)
+	if err != nil {
+		h.logger.Printf("failed to build discord redirect URL: %v", err)
+	}
+	if err := builder.complete(w, r, result.Origin, result.upstream(), result, target); err != nil {
+		h.logger.Printf("failed to render login result page: %v", err)
+	}
+}
+
+func (h *DiscordHandler) buildRedirectURL(
+	result discordLoginResult,
+	builder *RedirectBuilder,
+	decodeState func(string) (*discordlogin.StatePayload, error),
+) (string, error) {
+	origin := strings.TrimSpace(result.Origin)
+	if origin == "" && result.State != "" && decodeState != nil {
+		if payload, err := decodeState(result.State); err == nil {
+			origin = payload.Origin
+		}
+	}
+	if origin == "" {
+		origin = builder.defaultOrigin
+	}
+	if origin == "" {
+		return "", fmt.Errorf("redirect origin is empty")
+	}
+
+	base, err := url.Parse(origin)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect origin %q: %w", origin, err)
+	}
+
+	base.Path = builder.redirectPath
+	base.RawQuery = ""
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal login result: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	base.Fragment = "oauth-login=" + encoded
+
+	return base.String(), nil
+}
+
+func (h *DiscordHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	_, ok := allowed[origin]
+	return ok
+}
+
+// applyCORSHeaders は許可済みオリジンに対してCORSレスポンスヘッダを付与する。
+func (h *DiscordHandler) applyCORSHeaders(allowed map[string]struct{}, w http.ResponseWriter, origin string) {
+	if !h.isOriginAllowed(allowed, origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Vary", "Origin")
+}
@@ -0,0 +1,122 @@
+package httpadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/discordlogin"
+)
+
+// Discordハンドラのログイン開始をテーブル駆動で検証する。
+func TestDiscordHandler_LoginStart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+		wantCookie bool
+	}{
+		{name: "正常でstate Cookieを発行", origin: "https://app.example.com", wantStatus: http.StatusOK, wantCookie: true},
+		{name: "origin未許可", origin: "https://bad.example.com", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock := &mockDiscordResolver{
+				deps: DiscordTenantDeps{
+					Usecase: &mockDiscordUsecase{
+						startOut: &discordlogin.StartOutput{
+							AuthorizationURL: "https://discord.example.com",
+							State:            "state",
+							Nonce:            "nonce",
+						},
+					},
+					AllowedOrigins:        map[string]struct{}{"https://app.example.com": {}},
+					DefaultRedirectOrigin: "https://app.example.com",
+					RedirectPath:          "/done",
+					StateCookie:           StateCookie{MaxAge: time.Minute},
+				},
+			}
+			h := NewDiscordHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+			var buf bytes.Buffer
+			_ = json.NewEncoder(&buf).Encode(map[string]string{"origin": tt.origin})
+			req := httptest.NewRequest(http.MethodPost, "/discord/login", &buf)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			rr := httptest.NewRecorder()
+
+			h.handleLoginStart(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			setCookie := rr.Header().Get("Set-Cookie")
+			if tt.wantCookie != strings.HasPrefix(setCookie, DefaultStateCookieName+"_discord=") {
+				t.Fatalf("unexpected Set-Cookie: %q", setCookie)
+			}
+		})
+	}
+}
+
+func TestDiscordHandler_Callback(t *testing.T) {
+	t.Parallel()
+	mock := &mockDiscordResolver{
+		deps: DiscordTenantDeps{
+			Usecase: &mockDiscordUsecase{
+				callbackOut: &discordlogin.CallbackResult{
+					Success:      false,
+					State:        "st",
+					Origin:       "https://app.example.com",
+					ErrorMessage: "必要なロールが付与されていないためログインできません。",
+				},
+			},
+			DefaultRedirectOrigin: "https://app.example.com",
+			RedirectPath:          "/done",
+		},
+	}
+	h := NewDiscordHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/discord/callback?state=st&code=cd", nil)
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+	rr := httptest.NewRecorder()
+	h.handleCallback(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	if loc := rr.Header().Get("Location"); !strings.HasPrefix(loc, "https://app.example.com/done#oauth-login=") {
+		t.Fatalf("unexpected location: %s", loc)
+	}
+}
+
+// --- mocks ---
+
+type mockDiscordResolver struct {
+	deps DiscordTenantDeps
+}
+
+func (m *mockDiscordResolver) ResolveDiscord(string) (DiscordTenantDeps, error) { return m.deps, nil }
+
+type mockDiscordUsecase struct {
+	startOut    *discordlogin.StartOutput
+	startErr    error
+	callbackOut *discordlogin.CallbackResult
+	callbackErr error
+}
+
+func (m *mockDiscordUsecase) Start(context.Context, string) (*discordlogin.StartOutput, error) {
+	return m.startOut, m.startErr
+}
+func (m *mockDiscordUsecase) Callback(context.Context, string, string) (*discordlogin.CallbackResult, error) {
+	return m.callbackOut, m.callbackErr
+}
+func (m *mockDiscordUsecase) DecodeState(string) (*discordlogin.StatePayload, error) { return nil, nil }
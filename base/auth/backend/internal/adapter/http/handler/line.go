@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"log"
 	"net/http"
@@ -115,6 +114,8 @@ func (h *LineHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
 
 type loginRequest struct {
 	Origin string `json:"origin"`
+	// Display が "popup" ならコールバックでポップアップ完了ページを返す。
+	Display string `json:"display,omitempty"`
 }
 
 type loginResponse struct {
@@ -175,6 +176,10 @@ func (h *LineHandler) handleLoginStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deps.StateCookie.set(w, lineStateCookieProvider, out.Nonce)
+	if req.Display == displayPopup {
+		deps.StateCookie.setPopup(w, lineStateCookieProvider)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(loginResponse{
 		AuthorizationURL: out.AuthorizationURL,
@@ -196,6 +201,26 @@ func (h *LineHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
 	stateParam := r.URL.Query().Get("state")
 	code := r.URL.Query().Get("code")
 
+	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+		WithOIDC(deps.OIDC).
+		WithPages(deps.Pages, deps.StateCookie.popup(r, lineStateCookieProvider)).
+		WithSession(deps.Session).
+		WithNotifier(deps.Webhooks)
+	if payload, err := deps.Usecase.DecodeState(stateParam); err == nil && payload != nil &&
+		!deps.StateCookie.matches(r, lineStateCookieProvider, payload.Nonce) {
+		h.logger.Printf("line callback rejected: state cookie mismatch")
+		h.redirectWithResult(w, r, loginResult{
+			Type:      lineLoginResultMessageType,
+			Success:   false,
+			State:     stateParam,
+			Origin:    payload.Origin,
+			Error:     stateMismatchMessage,
+			ErrorCode: errorCodeStateMismatch,
+		}, builder)
+		return
+	}
+	deps.StateCookie.clear(w, lineStateCookieProvider)
+
 	result, err := deps.Usecase.Callback(ctx, code, stateParam)
 	if err != nil {
 		h.logger.Printf("callback handling failed: %v", err)
@@ -225,32 +250,71 @@ func (h *LineHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
 		loginRes.Error = result.ErrorMessage
 	}
 
-	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath)
-	target, err := builder.Build(loginRes)
+	h.redirectWithResult(w, r, loginRes, builder)
+}
+
+// redirectWithResult は結果をフラグメントに載せてリダイレクトする（ポップアップ開始ならpostMessageで返す）。
+func (h *LineHandler) redirectWithResult(w http.ResponseWriter, r *http.Request, result loginResult, builder *RedirectBuilder) {
+	if err := builder.notifyLogin(r.Context(), result.upstream()); err != nil {
+		h.logger.Printf("failed to notify login webhooks: %v", err)
+	}
+	if builder.handoff(w, r, result.Origin, result.upstream()) {
+		return
+	}
+	if !builder.startSession(w, &result, h.logger) {
+		return
+	}
+	target, err := builder.Build(result)
 	if err != nil {
 		h.logger.Printf("failed to build redirect URL: %v", err)
-		h.renderFallbackPage(w, loginRes, builder.defaultOrigin, builder.redirectPath)
-		return
 	}
-
-	http.Redirect(w, r, target, http.StatusSeeOther)
+	if err := builder.complete(w, r, result.Origin, result.upstream(), result, target); err != nil {
+		h.logger.Printf("failed to render login result page: %v", err)
+	}
 }
 
-const lineLoginResultMessageType = "line-login-result"
+const (
+	lineLoginResultMessageType = "line-login-result"
+	lineStateCookieProvider    = "line"
+)
 
 type loginResult struct {
-	Type    string              `json:"type"`
-	Success bool                `json:"success"`
-	State   string              `json:"state,omitempty"`
-	Origin  string              `json:"origin,omitempty"`
-	Error   string              `json:"error,omitempty"`
-	Payload *loginResultPayload `json:"payload,omitempty"`
+	Type      string              `json:"type"`
+	Success   bool                `json:"success"`
+	State     string              `json:"state,omitempty"`
+	Origin    string              `json:"origin,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	ErrorCode string              `json:"errorCode,omitempty"`
+	Session   bool                `json:"session,omitempty"`
+	Payload   *loginResultPayload `json:"payload,omitempty"`
+}
+
+// upstream はOIDCへ引き渡すためにプロバイダ非依存の結果へ変換する。
+func (r loginResult) upstream() UpstreamResult {
+	res := UpstreamResult{Provider: lineStateCookieProvider, Success: r.Success, Error: r.Error}
+	if r.Payload != nil {
+		res.AccessToken = r.Payload.AccessToken
+		res.TokenType = r.Payload.TokenType
+		res.ExpiresIn = r.Payload.ExpiresIn
+		res.Subject = r.Payload.LineUser.UserID
+		res.Name = r.Payload.LineUser.DisplayName
+		res.Picture = r.Payload.LineUser.AvatarURL
+	}
+	return res
+}
+
+// withholdToken はセッションCookieモードの結果からJWTを取り除く。
+func (r *loginResult) withholdToken() {
+	r.Session = true
+	if r.Payload != nil {
+		r.Payload.AccessToken, r.Payload.TokenType, r.Payload.ExpiresIn = "", "", 0
+	}
 }
 
 type loginResultPayload struct {
-	AccessToken string        `json:"accessToken"`
-	TokenType   string        `json:"tokenType"`
-	ExpiresIn   int           `json:"expiresIn"`
+	AccessToken string        `json:"accessToken,omitempty"`
+	TokenType   string        `json:"tokenType,omitempty"`
+	ExpiresIn   int           `json:"expiresIn,omitempty"`
 	LineUser    loginLineUser `json:"lineUser"`
 }
 
@@ -264,6 +328,11 @@ type loginLineUser struct {
 type RedirectBuilder struct {
 	defaultOrigin string
 	redirectPath  string
+	oidc          OIDCHandoff
+	pages         *Pages
+	popup         bool
+	session       *SessionCookie
+	notifier      LoginNotifier
 }
 
 // NewRedirectBuilder はリダイレクト先とパスの組を初期化する。
@@ -281,6 +350,50 @@ func NewRedirectBuilder(defaultOrigin, redirectPath string) *RedirectBuilder {
 	}
 }
 
+// WithOIDC はOIDCの選択ページから始まったログインの引き渡し先を設定する。nilなら何もしない。
+func (b *RedirectBuilder) WithOIDC(h OIDCHandoff) *RedirectBuilder {
+	b.oidc = h
+	return b
+}
+
+// handoff は origin がOIDCの選択ページであれば結果を認可フローへ引き渡し、trueを返す。
+func (b *RedirectBuilder) handoff(w http.ResponseWriter, r *http.Request, origin string, result UpstreamResult) bool {
+	if b.oidc == nil || !b.oidc.Owns(origin) {
+		return false
+	}
+	b.oidc.Complete(w, r, result)
+	return true
+}
+
+// WithPages は結果ページの描画と、ポップアップで開始したログインかどうかを設定する。
+func (b *RedirectBuilder) WithPages(pages *Pages, popup bool) *RedirectBuilder {
+	b.pages = pages
+	b.popup = popup
+	return b
+}
+
+// complete は結果をブラウザへ返す。ポップアップ開始なら開いた側へpostMessageする完了ページ、
+// target があればリダイレクト、どちらでもなければ戻り先リンク付きの結果ページを描画する。
+func (b *RedirectBuilder) complete(w http.ResponseWriter, r *http.Request, origin string, result UpstreamResult, payload any, target string) error {
+	origin = strings.TrimSpace(origin)
+	if origin == "" {
+		origin = b.defaultOrigin
+	}
+	pages := pagesOrDefault(b.pages)
+	if b.popup && origin != "" {
+		return pages.RenderPopup(w, result, payload, strings.TrimRight(origin, "/"), target)
+	}
+	if target != "" {
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return nil
+	}
+	var link string
+	if origin != "" {
+		link = strings.TrimRight(origin, "/") + b.redirectPath
+	}
+	return pages.RenderResult(w, result, link)
+}
+
 func (b *RedirectBuilder) Build(result loginResult) (string, error) {
 	origin := strings.TrimSpace(result.Origin)
 	if origin == "" {
@@ -309,48 +422,6 @@ func (b *RedirectBuilder) Build(result loginResult) (string, error) {
 	return base.String(), nil
 }
 
-func (h *LineHandler) renderFallbackPage(w http.ResponseWriter, result loginResult, defaultOrigin, redirectPath string) {
-	message := "LINEログインが完了しました。元の画面に戻ってください。"
-	if !result.Success && result.Error != "" {
-		message = result.Error
-	}
-
-	var linkHTML string
-	targetOrigin := defaultOrigin
-	if result.Origin != "" {
-		targetOrigin = result.Origin
-	}
-	if targetOrigin != "" {
-		link := strings.TrimRight(targetOrigin, "/") + redirectPath
-		linkHTML = fmt.Sprintf(
-			`<p><a href="%s">こちらをタップしてトップページに戻ってください。</a></p>`,
-			template.HTMLEscapeString(link),
-		)
-	}
-
-	page := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="ja">
-  <head>
-    <meta charset="utf-8" />
-    <title>LINE ログイン</title>
-    <style>
-      body { font-family: system-ui, sans-serif; padding: 24px; text-align: center; background: #f8fafc; color: #0f172a; }
-      a { color: #ec4899; font-weight: 600; text-decoration: none; }
-    </style>
-  </head>
-  <body>
-    <p>%s</p>
-    %s
-  </body>
-</html>`,
-		template.HTMLEscapeString(message),
-		linkHTML,
-	)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = io.WriteString(w, page)
-}
-
 func (h *LineHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
 	if origin == "" {
 		return false
@@ -368,5 +439,6 @@ func (h *LineHandler) applyCORSHeaders(allowed map[string]struct{}, w http.Respo
 		return
 	}
 	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Vary", "Origin")
 }
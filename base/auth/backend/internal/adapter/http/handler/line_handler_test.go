@@ -3,12 +3,15 @@ package httpadapter
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,6 +114,134 @@ func TestLineHandler_Callback(t *testing.T) {
 	}
 }
 
+// state紐付けCookieの一致/不一致をテーブル駆動で検証する。
+func TestLineHandler_CallbackStateCookie(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		cookieNonce   string
+		wantErrorCode bool
+	}{
+		{name: "Cookie一致でコールバック続行", cookieNonce: "nonce-1"},
+		{name: "Cookie不一致でstate_mismatch", cookieNonce: "other", wantErrorCode: true},
+		{name: "Cookieなしでstate_mismatch", wantErrorCode: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cookie := StateCookie{MaxAge: time.Minute}
+			mock := &mockLineResolver{
+				deps: LineTenantDeps{
+					Usecase: &mockLineUsecase{
+						decodeOut: &linelogin.StatePayload{Origin: "https://app.example.com", Nonce: "nonce-1"},
+						callbackOut: &linelogin.CallbackResult{
+							Success: true,
+							State:   "state",
+							Origin:  "https://app.example.com",
+						},
+					},
+					DefaultRedirectOrigin: "https://app.example.com",
+					RedirectPath:          "/done",
+					StateCookie:           cookie,
+				},
+			}
+			h := NewLineHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+			req := httptest.NewRequest(http.MethodGet, "/?state=state&code=code", nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			if tt.cookieNonce != "" {
+				req.AddCookie(&http.Cookie{Name: cookie.cookieName(lineStateCookieProvider), Value: stateBindingHash(tt.cookieNonce)})
+			}
+			rr := httptest.NewRecorder()
+			h.handleCallback(rr, req)
+
+			if rr.Code != http.StatusSeeOther {
+				t.Fatalf("status=%d", rr.Code)
+			}
+			result := decodeLineResultFragment(t, rr.Header().Get("Location"))
+			if tt.wantErrorCode {
+				if result.Success || result.ErrorCode != errorCodeStateMismatch {
+					t.Fatalf("want state_mismatch, got %+v", result)
+				}
+				return
+			}
+			if !result.Success || result.ErrorCode != "" {
+				t.Fatalf("want success, got %+v", result)
+			}
+		})
+	}
+}
+
+// ポップアップで開始したログインはリダイレクトせず、開いた側へpostMessageする完了ページを返す。
+func TestLineHandler_CallbackPopup(t *testing.T) {
+	t.Parallel()
+
+	cookie := StateCookie{MaxAge: time.Minute}
+	mock := &mockLineResolver{
+		deps: LineTenantDeps{
+			Usecase: &mockLineUsecase{
+				startOut:  &linelogin.StartOutput{AuthorizationURL: "https://access.line.me/auth", State: "state", Nonce: "nonce-1"},
+				decodeOut: &linelogin.StatePayload{Origin: "https://app.example.com", Nonce: "nonce-1"},
+				callbackOut: &linelogin.CallbackResult{
+					Success: true,
+					State:   "state",
+					Origin:  "https://app.example.com",
+				},
+			},
+			DefaultRedirectOrigin: "https://app.example.com",
+			RedirectPath:          "/done",
+			StateCookie:           cookie,
+		},
+	}
+	h := NewLineHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+	start := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"origin":"https://app.example.com","display":"popup"}`))
+	start = start.WithContext(context.WithValue(start.Context(), tenantKey{}, "tenant1"))
+	startRR := httptest.NewRecorder()
+	h.handleLoginStart(startRR, start)
+	if startRR.Code != http.StatusOK {
+		t.Fatalf("start status=%d", startRR.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?state=state&code=code", nil)
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+	for _, c := range startRR.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	h.handleCallback(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{`postMessage(result, "https://app.example.com")`, `"type":"line-login-result"`} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func decodeLineResultFragment(t *testing.T, location string) loginResult {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("parse location: %v", err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(u.Fragment, "line-login="))
+	if err != nil {
+		t.Fatalf("decode fragment: %v", err)
+	}
+	var result loginResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	return result
+}
+
 // --- mocks ---
 
 type mockLineResolver struct {
@@ -124,6 +255,7 @@ type mockLineUsecase struct {
 	startErr    error
 	callbackOut *linelogin.CallbackResult
 	callbackErr error
+	decodeOut   *linelogin.StatePayload
 }
 
 func (m *mockLineUsecase) Start(context.Context, string) (*linelogin.StartOutput, error) {
@@ -132,3 +264,6 @@ func (m *mockLineUsecase) Start(context.Context, string) (*linelogin.StartOutput
 func (m *mockLineUsecase) Callback(context.Context, string, string) (*linelogin.CallbackResult, error) {
 	return m.callbackOut, m.callbackErr
 }
+func (m *mockLineUsecase) DecodeState(string) (*linelogin.StatePayload, error) {
+	return m.decodeOut, nil
+}
@@ -0,0 +1,434 @@
+package httpadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+)
+
+// OIDCHandler はテナントをOpenID Connectプロバイダとして公開するエンドポイントをまとめる。
+type OIDCHandler struct {
+	resolver    OIDCTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewOIDCHandler はOIDC用ハンドラを初期化する。
+func NewOIDCHandler(
+	resolver OIDCTenantResolver,
+	httpTimeout time.Duration,
+	logger *log.Logger,
+) *OIDCHandler {
+	return &OIDCHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターにOIDC用エンドポイントを登録する。
+func (h *OIDCHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/.well-known/openid-configuration", h.handleDiscovery)
+	r.Get("/.well-known/jwks.json", h.handleJWKS)
+	r.Get("/authorize", h.handleAuthorize)
+	r.Options("/token", h.handlePreflight)
+	r.Post("/token", h.handleToken)
+	r.Options("/userinfo", h.handlePreflight)
+	r.Get("/userinfo", h.handleUserInfo)
+	r.Post("/userinfo", h.handleUserInfo)
+	r.Post("/device/code", h.handleDeviceCode)
+	r.Get("/device", h.handleDevicePage)
+	r.Post("/device", h.handleDeviceVerify)
+}
+
+func (h *OIDCHandler) depsFromRequest(w http.ResponseWriter, r *http.Request) (OIDCTenantDeps, error) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return OIDCTenantDeps{}, errors.New("tenant missing")
+	}
+	deps, err := h.resolver.ResolveOIDC(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrOIDCDisabled) {
+			http.Error(w, "oidc is disabled for this tenant", http.StatusNotFound)
+			return OIDCTenantDeps{}, err
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return OIDCTenantDeps{}, err
+	}
+	return deps, nil
+}
+
+func (h *OIDCHandler) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	h.writeJSON(w, http.StatusOK, deps.Usecase.Discovery())
+}
+
+func (h *OIDCHandler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	h.writeJSON(w, http.StatusOK, deps.Usecase.JWKS())
+}
+
+// handleAuthorize は認可リクエストを検証し、上流ログインの選択ページを返す。
+func (h *OIDCHandler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	q := r.URL.Query()
+	req, err := deps.Usecase.Authorize(ctx, oidcprovider.AuthorizeInput{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	})
+	if err != nil {
+		var oerr *oidcprovider.Error
+		if errors.As(err, &oerr) {
+			if oerr.RedirectURI != "" {
+				http.Redirect(w, r, deps.Usecase.ErrorRedirect(oerr), http.StatusSeeOther)
+				return
+			}
+			h.renderError(w, deps.Pages, http.StatusBadRequest, "oidc.invalidRequest", oerr.Description)
+			return
+		}
+		h.logger.Printf("oidc authorize failed: %v", err)
+		h.renderError(w, deps.Pages, http.StatusInternalServerError, "oidc.startFailed", "")
+		return
+	}
+
+	if len(deps.Upstreams) == 0 {
+		http.Redirect(w, r, deps.Usecase.ErrorRedirect(&oidcprovider.Error{
+			Code:        oidcprovider.ErrCodeAccessDenied,
+			Description: "no login provider is enabled",
+			RedirectURI: req.RedirectURI,
+			State:       req.State,
+		}), http.StatusSeeOther)
+		return
+	}
+
+	deps.DeviceCookie.clear(w)
+	deps.RequestCookie.set(w, req.ID)
+	appName := req.ClientName
+	if appName == "" {
+		appName = req.ClientID
+	}
+	if err := pagesOrDefault(deps.Pages).RenderSelect(w, appName, deps.Upstreams); err != nil {
+		h.logger.Printf("failed to render provider selection page: %v", err)
+	}
+}
+
+// handleToken は認可コードをトークンに交換する。
+func (h *OIDCHandler) handleToken(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, r.Header.Get("Origin"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, oidcprovider.ErrCodeInvalidRequest, "invalid form body")
+		return
+	}
+
+	in := oidcprovider.TokenInput{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		Scope:        r.PostForm.Get("scope"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+	}
+	// client_secret_basic の値はフォームエンコードされている（RFC 6749 2.3.1）。
+	basicID, basicSecret, usedBasic := r.BasicAuth()
+	if usedBasic {
+		if id, err := url.QueryUnescape(basicID); err == nil {
+			in.ClientID = id
+		}
+		if secret, err := url.QueryUnescape(basicSecret); err == nil {
+			in.ClientSecret = secret
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	res, err := deps.Usecase.Exchange(ctx, in)
+	if err != nil {
+		var oerr *oidcprovider.Error
+		if errors.As(err, &oerr) {
+			status := http.StatusBadRequest
+			if oerr.Code == oidcprovider.ErrCodeInvalidClient {
+				status = http.StatusUnauthorized
+				if usedBasic {
+					w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+				}
+			}
+			h.writeOAuthError(w, status, oerr.Code, oerr.Description)
+			return
+		}
+		h.logger.Printf("oidc token exchange failed: %v", err)
+		h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// handleDeviceCode はデバイス認可を開始し、デバイスコードとユーザーコードを返す（RFC 8628 3.1）。
+func (h *OIDCHandler) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, http.StatusBadRequest, oidcprovider.ErrCodeInvalidRequest, "invalid form body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	res, err := deps.Usecase.StartDevice(ctx, oidcprovider.DeviceInput{
+		ClientID: r.PostForm.Get("client_id"),
+		Scope:    r.PostForm.Get("scope"),
+	})
+	if err != nil {
+		var oerr *oidcprovider.Error
+		if errors.As(err, &oerr) {
+			status := http.StatusBadRequest
+			if oerr.Code == oidcprovider.ErrCodeInvalidClient {
+				status = http.StatusUnauthorized
+			}
+			h.writeOAuthError(w, status, oerr.Code, oerr.Description)
+			return
+		}
+		h.logger.Printf("oidc device authorization failed: %v", err)
+		h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// handleDevicePage はユーザーコードの入力ページを返す。verification_uri_complete のコードは入力欄に補完する。
+func (h *OIDCHandler) handleDevicePage(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	token, err := newDeviceCSRFToken()
+	if err != nil {
+		h.logger.Printf("failed to generate device csrf token: %v", err)
+		h.renderError(w, deps.Pages, http.StatusInternalServerError, "oidc.startFailed", "")
+		return
+	}
+	deviceCSRFCookie(deps.DeviceCookie).set(w, token)
+	if err := pagesOrDefault(deps.Pages).RenderDevice(w, http.StatusOK, r.URL.Query().Get("user_code"), token, ""); err != nil {
+		h.logger.Printf("failed to render device page: %v", err)
+	}
+}
+
+// handleDeviceVerify は入力されたユーザーコードを確認し、承認に使う上流ログインの選択ページを返す。
+func (h *OIDCHandler) handleDeviceVerify(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	pages := pagesOrDefault(deps.Pages)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16<<10)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, deps.Pages, http.StatusBadRequest, "oidc.invalidRequest", "")
+		return
+	}
+	userCode := r.PostForm.Get("user_code")
+
+	// 他サイトから攻撃者のユーザーコードを送り込まれないよう、入力ページで発行したトークンと照合する。
+	csrf := deviceCSRFCookie(deps.DeviceCookie)
+	expected := csrf.read(r)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(r.PostForm.Get("csrf_token"))) != 1 {
+		h.renderError(w, deps.Pages, http.StatusForbidden, "oidc.invalidRequest", "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	req, err := deps.Usecase.LookupDevice(ctx, userCode)
+	if err != nil {
+		if errors.Is(err, oidcprovider.ErrDeviceCodeNotFound) {
+			if err := pages.RenderDevice(w, http.StatusBadRequest, userCode, expected, "device.invalid"); err != nil {
+				h.logger.Printf("failed to render device page: %v", err)
+			}
+			return
+		}
+		h.logger.Printf("oidc device lookup failed: %v", err)
+		h.renderError(w, deps.Pages, http.StatusInternalServerError, "oidc.startFailed", "")
+		return
+	}
+
+	if len(deps.Upstreams) == 0 {
+		h.renderError(w, deps.Pages, http.StatusServiceUnavailable, "oidc.startFailed", "")
+		return
+	}
+
+	csrf.clear(w)
+	deps.RequestCookie.clear(w)
+	deps.DeviceCookie.set(w, req.UserCode)
+	appName := req.ClientName
+	if appName == "" {
+		appName = req.ClientID
+	}
+	if err := pages.RenderDeviceSelect(w, appName, req.UserCode, deps.Upstreams); err != nil {
+		h.logger.Printf("failed to render provider selection page: %v", err)
+	}
+}
+
+// deviceCSRFCookie はデバイスコード入力フォームのCSRFトークンを保持するCookie。
+func deviceCSRFCookie(device OIDCRequestCookie) OIDCRequestCookie {
+	name := device.Name
+	if name == "" {
+		name = DefaultOIDCDeviceCookieName
+	}
+	return OIDCRequestCookie{Name: name + "_csrf", MaxAge: device.MaxAge}
+}
+
+func newDeviceCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// handleUserInfo はBearerトークンのユーザー情報を返す。
+func (h *OIDCHandler) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, r.Header.Get("Origin"))
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	info, err := deps.Usecase.UserInfo(ctx, token)
+	if err != nil {
+		var oerr *oidcprovider.Error
+		if errors.As(err, &oerr) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			h.writeOAuthError(w, http.StatusUnauthorized, oerr.Code, oerr.Description)
+			return
+		}
+		h.logger.Printf("oidc userinfo failed: %v", err)
+		h.writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, info)
+}
+
+// handlePreflight は /token・/userinfo のCORSプリフライトを処理する。
+func (h *OIDCHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if _, ok := deps.AllowedOrigins[origin]; !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyCORSHeaders は登録クライアントのオリジンに対してCORSレスポンスヘッダを付与する。
+func (h *OIDCHandler) applyCORSHeaders(allowed map[string]struct{}, w http.ResponseWriter, origin string) {
+	if _, ok := allowed[origin]; !ok || origin == "" {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Vary", "Origin")
+}
+
+func (h *OIDCHandler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Printf("failed to encode oidc response: %v", err)
+	}
+}
+
+func (h *OIDCHandler) writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	h.writeJSON(w, status, body)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:]), true
+	}
+	if r.Method == http.MethodPost {
+		if token := r.PostFormValue("access_token"); token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// renderError はリダイレクトできないOIDCのエラーをユーザーに表示する。
+func (h *OIDCHandler) renderError(w http.ResponseWriter, pages *Pages, status int, messageKey, detail string) {
+	if err := pagesOrDefault(pages).RenderError(w, status, messageKey, detail); err != nil {
+		h.logger.Printf("failed to render oidc error page: %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package httpadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+)
+
+func newTestOIDCDeps(t *testing.T) OIDCTenantDeps {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	provider := oidcprovider.NewProvider(oidcprovider.Config{
+		Issuer: "https://tenant1.auth.example.com",
+		Clients: []oidcprovider.Client{
+			{ID: "lilink", Secret: "s3cret", Name: "lilink", RedirectURIs: []string{"https://lilink.example.com/cb"}},
+		},
+		DeviceClients: []oidcprovider.DeviceClient{{ID: "roots-cli", Name: "roots CLI"}},
+	}, oidcprovider.NewRS256Signer(key, "k1"), grantstore.NewMemory())
+	return OIDCTenantDeps{
+		Usecase:        provider,
+		Upstreams:      []OIDCUpstream{{ID: "line", Label: "LINE", LoginPath: "/line/login"}},
+		AllowedOrigins: map[string]struct{}{"https://lilink.example.com": {}},
+		RequestCookie:  OIDCRequestCookie{MaxAge: time.Minute},
+		DeviceCookie:   OIDCRequestCookie{Name: DefaultOIDCDeviceCookieName, MaxAge: time.Minute},
+	}
+}
+
+func withTenant(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+}
+
+// /authorize の検証エラーの返し方をテーブル駆動で確認する。
+func TestOIDCHandler_AuthorizeErrors(t *testing.T) {
+	t.Parallel()
+	deps := newTestOIDCDeps(t)
+	h := NewOIDCHandler(&mockOIDCResolver{deps: deps}, 2*time.Second, log.New(io.Discard, "", 0))
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:       "未登録クライアントはエラーページ",
+			query:      "response_type=code&client_id=unknown&redirect_uri=https%3A%2F%2Flilink.example.com%2Fcb&scope=openid",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "openidなしはクライアントへリダイレクト",
+			query:        "response_type=code&client_id=lilink&redirect_uri=https%3A%2F%2Flilink.example.com%2Fcb&scope=profile&state=st",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://lilink.example.com/cb?error=invalid_scope",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			h.handleAuthorize(rr, withTenant(httptest.NewRequest(http.MethodGet, "/authorize?"+tt.query, nil)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantLocation != "" && !strings.HasPrefix(rr.Header().Get("Location"), tt.wantLocation) {
+				t.Fatalf("location=%s", rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+// 選択ページ→上流ログイン完了→/token→/userinfo の一連を確認する。
+func TestOIDCHandler_CodeFlow(t *testing.T) {
+	t.Parallel()
+	deps := newTestOIDCDeps(t)
+	h := NewOIDCHandler(&mockOIDCResolver{deps: deps}, 2*time.Second, log.New(io.Discard, "", 0))
+
+	rr := httptest.NewRecorder()
+	h.handleAuthorize(rr, withTenant(httptest.NewRequest(http.MethodGet,
+		"/authorize?response_type=code&client_id=lilink&redirect_uri=https%3A%2F%2Flilink.example.com%2Fcb&scope=openid+profile&state=st&nonce=nc", nil)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `data-login-path="/line/login"`) {
+		t.Fatalf("unexpected selection page: %d %s", rr.Code, rr.Body.String())
+	}
+	var requestCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == DefaultOIDCRequestCookieName {
+			requestCookie = c
+		}
+	}
+	if requestCookie == nil || requestCookie.SameSite != http.SameSiteNoneMode {
+		t.Fatalf("request cookie not set: %v", rr.Result().Cookies())
+	}
+
+	// LINEのコールバックが選択ページのオリジンへ戻ろうとすると、認可フローへ引き渡される。
+	builder := NewRedirectBuilder("https://app.example.com", "/done").
+		WithOIDC(NewOIDCHandoff(deps.Usecase, deps.RequestCookie, deps.DeviceCookie, nil, nil))
+	line := NewLineHandler(nil, 2*time.Second, log.New(io.Discard, "", 0))
+	callbackReq := httptest.NewRequest(http.MethodGet, "/line/callback", nil)
+	callbackReq.AddCookie(requestCookie)
+	rr = httptest.NewRecorder()
+	line.redirectWithResult(rr, callbackReq, loginResult{
+		Type:    lineLoginResultMessageType,
+		Success: true,
+		Origin:  "https://tenant1.auth.example.com",
+		Payload: &loginResultPayload{LineUser: loginLineUser{UserID: "U1", DisplayName: "Taro"}},
+	}, builder)
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil || loc.Host != "lilink.example.com" || loc.Query().Get("state") != "st" {
+		t.Fatalf("unexpected handoff redirect: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {loc.Query().Get("code")},
+		"redirect_uri": {"https://lilink.example.com/cb"},
+	}
+	tokenReq := withTenant(httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode())))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth("lilink", "s3cret")
+	rr = httptest.NewRecorder()
+	h.handleToken(rr, tokenReq)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("token status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var tok oidcprovider.TokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&tok); err != nil || tok.IDToken == "" {
+		t.Fatalf("decode token response: %v %+v", err, tok)
+	}
+
+	// 同じコードの再利用は invalid_grant。
+	tokenReq = withTenant(httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode())))
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth("lilink", "s3cret")
+	rr = httptest.NewRecorder()
+	h.handleToken(rr, tokenReq)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_grant") {
+		t.Fatalf("reuse status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	infoReq := withTenant(httptest.NewRequest(http.MethodGet, "/userinfo", nil))
+	infoReq.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	rr = httptest.NewRecorder()
+	h.handleUserInfo(rr, infoReq)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"sub":"line:U1"`) {
+		t.Fatalf("userinfo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// /device/code→入力ページ→選択ページ→上流ログイン完了→ポーリングの一連を確認する。
+func TestOIDCHandler_DeviceFlow(t *testing.T) {
+	t.Parallel()
+	deps := newTestOIDCDeps(t)
+	h := NewOIDCHandler(&mockOIDCResolver{deps: deps}, 2*time.Second, log.New(io.Discard, "", 0))
+
+	postForm := func(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := withTenant(httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode())))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		switch path {
+		case "/device/code":
+			h.handleDeviceCode(rr, req)
+		case "/device":
+			h.handleDeviceVerify(rr, req)
+		default:
+			h.handleToken(rr, req)
+		}
+		return rr
+	}
+	findCookie := func(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == name && c.MaxAge >= 0 {
+				return c
+			}
+		}
+		return nil
+	}
+
+	rr := postForm("/device/code", url.Values{"client_id": {"lilink"}})
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown device client status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = postForm("/device/code", url.Values{"client_id": {"roots-cli"}, "scope": {"openid profile"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("device code status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var auth oidcprovider.DeviceAuthorization
+	if err := json.NewDecoder(rr.Body).Decode(&auth); err != nil || auth.DeviceCode == "" {
+		t.Fatalf("decode device authorization: %v %+v", err, auth)
+	}
+	poll := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "client_id": {"roots-cli"}, "device_code": {auth.DeviceCode}}
+	if rr := postForm("/token", poll); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "authorization_pending") {
+		t.Fatalf("pending poll status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.handleDevicePage(rr, withTenant(httptest.NewRequest(http.MethodGet, "/device?user_code="+url.QueryEscape(auth.UserCode), nil)))
+	csrf := findCookie(rr, DefaultOIDCDeviceCookieName+"_csrf")
+	if rr.Code != http.StatusOK || csrf == nil || !strings.Contains(rr.Body.String(), auth.UserCode) {
+		t.Fatalf("unexpected device page: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// CSRFトークンが一致しなければ受け付けない。
+	if rr := postForm("/device", url.Values{"user_code": {auth.UserCode}, "csrf_token": {"forged"}}, csrf); rr.Code != http.StatusForbidden {
+		t.Fatalf("forged csrf status=%d", rr.Code)
+	}
+	if rr := postForm("/device", url.Values{"user_code": {"BBBB-BBBB"}, "csrf_token": {csrf.Value}}, csrf); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown user code status=%d", rr.Code)
+	}
+	rr = postForm("/device", url.Values{"user_code": {strings.ToLower(auth.UserCode)}, "csrf_token": {csrf.Value}}, csrf)
+	deviceCookie := findCookie(rr, DefaultOIDCDeviceCookieName)
+	if rr.Code != http.StatusOK || deviceCookie == nil || !strings.Contains(rr.Body.String(), "roots CLI") {
+		t.Fatalf("unexpected device selection page: %d %s", rr.Code, rr.Body.String())
+	}
+
+	builder := NewRedirectBuilder("https://app.example.com", "/done").
+		WithOIDC(NewOIDCHandoff(deps.Usecase, deps.RequestCookie, deps.DeviceCookie, nil, nil))
+	line := NewLineHandler(nil, 2*time.Second, log.New(io.Discard, "", 0))
+	callbackReq := httptest.NewRequest(http.MethodGet, "/line/callback", nil)
+	callbackReq.AddCookie(deviceCookie)
+	rr = httptest.NewRecorder()
+	line.redirectWithResult(rr, callbackReq, loginResult{
+		Type:    lineLoginResultMessageType,
+		Success: true,
+		Origin:  "https://tenant1.auth.example.com",
+		Payload: &loginResultPayload{AccessToken: "line-jwt", TokenType: "Bearer", ExpiresIn: 3600, LineUser: loginLineUser{UserID: "U1", DisplayName: "Taro"}},
+	}, builder)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "端末に戻ってください") {
+		t.Fatalf("unexpected device result page: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = postForm("/token", poll)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("approved poll status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var tok oidcprovider.TokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&tok); err != nil || tok.AccessToken != "line-jwt" || tok.IDToken == "" {
+		t.Fatalf("unexpected device token: %v %+v", err, tok)
+	}
+	if rr := postForm("/token", poll); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "expired_token") {
+		t.Fatalf("second poll status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// --- mocks ---
+
+type mockOIDCResolver struct {
+	deps OIDCTenantDeps
+}
+
+func (m *mockOIDCResolver) ResolveOIDC(string) (OIDCTenantDeps, error) { return m.deps, nil }
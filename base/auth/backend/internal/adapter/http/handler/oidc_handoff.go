@@ -0,0 +1,207 @@
+package httpadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+)
+
+// DefaultOIDCRequestCookieName は認可リクエストIDを保持するCookieの既定名。
+const DefaultOIDCRequestCookieName = "__Host-oidc_request"
+
+// DefaultOIDCDeviceCookieName はデバイスフローのユーザーコードを保持するCookieの既定名。
+const DefaultOIDCDeviceCookieName = "__Host-oidc_device"
+
+// OIDCRequestCookie は /authorize から上流ログインのコールバックまで認可リクエストIDを運ぶCookie。
+// Sign in with Apple の form_post（クロスサイトPOST）でも届くよう SameSite=None で発行する。
+type OIDCRequestCookie struct {
+	Name   string
+	MaxAge time.Duration
+}
+
+func (c OIDCRequestCookie) cookieName() string {
+	if c.Name == "" {
+		return DefaultOIDCRequestCookieName
+	}
+	return c.Name
+}
+
+func (c OIDCRequestCookie) set(w http.ResponseWriter, requestID string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    requestID,
+		Path:     "/",
+		MaxAge:   int(c.MaxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+func (c OIDCRequestCookie) clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+func (c OIDCRequestCookie) read(r *http.Request) string {
+	cookie, err := r.Cookie(c.cookieName())
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// UpstreamResult は上流ログイン（LINE/X など）の結果をプロバイダ非依存にまとめたもの。
+type UpstreamResult struct {
+	Provider string
+	Success  bool
+	Error    string
+	Subject  string
+	Name     string
+	Picture  string
+	Email    string
+	// AccessToken などは上流ログインで発行したJWT。デバイスフローの応答に使う。
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int
+}
+
+// OIDCHandoff はOIDCの選択ページから始まった上流ログインの結果を認可フローへ引き渡す。
+type OIDCHandoff interface {
+	// Owns は origin がOIDCプロバイダ自身（選択ページ）のオリジンかを返す。
+	Owns(origin string) bool
+	// Complete は認可リクエストを完了（または拒否）してクライアントへリダイレクトする。
+	Complete(w http.ResponseWriter, r *http.Request, result UpstreamResult)
+}
+
+type oidcHandoff struct {
+	usecase      OIDCUsecase
+	origin       string
+	cookie       OIDCRequestCookie
+	deviceCookie OIDCRequestCookie
+	pages        *Pages
+	logf         func(string, ...any)
+}
+
+// NewOIDCHandoff は発行者URLのオリジンを選択ページとして扱うOIDCHandoffを生成する。
+// deviceCookie はデバイスフローのユーザーコード、pages はエラーページの描画に使う（nilなら既定のページ）。
+func NewOIDCHandoff(usecase OIDCUsecase, cookie, deviceCookie OIDCRequestCookie, pages *Pages, logf func(string, ...any)) OIDCHandoff {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	return &oidcHandoff{
+		usecase:      usecase,
+		origin:       IssuerOrigin(usecase.Issuer()),
+		cookie:       cookie,
+		deviceCookie: deviceCookie,
+		pages:        pages,
+		logf:         logf,
+	}
+}
+
+// IssuerOrigin は発行者URLからスキームとホストだけを取り出す。
+func IssuerOrigin(issuer string) string {
+	u, err := url.Parse(strings.TrimSpace(issuer))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (h *oidcHandoff) Owns(origin string) bool {
+	return h.origin != "" && strings.TrimRight(strings.TrimSpace(origin), "/") == h.origin
+}
+
+func (h *oidcHandoff) Complete(w http.ResponseWriter, r *http.Request, result UpstreamResult) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if userCode := h.deviceCookie.read(r); userCode != "" {
+		h.deviceCookie.clear(w)
+		h.completeDevice(ctx, w, userCode, result)
+		return
+	}
+
+	requestID := h.cookie.read(r)
+	h.cookie.clear(w)
+
+	var (
+		target string
+		err    error
+	)
+	if result.Success && result.Subject != "" {
+		target, err = h.usecase.Complete(ctx, requestID, oidcprovider.Identity{
+			Provider: result.Provider,
+			Subject:  result.Subject,
+			Name:     result.Name,
+			Picture:  result.Picture,
+			Email:    result.Email,
+		})
+	} else {
+		// error_description はASCIIに限られるため、上流のメッセージはログにだけ残す。
+		h.logf("oidc handoff: %s login failed: %s", result.Provider, result.Error)
+		target, err = h.usecase.Deny(ctx, requestID, result.Provider+" login failed")
+	}
+	if err != nil {
+		if errors.Is(err, oidcprovider.ErrRequestNotFound) {
+			h.renderError(w, http.StatusBadRequest, "oidc.expired")
+			return
+		}
+		h.logf("oidc handoff failed: %v", err)
+		h.renderError(w, http.StatusInternalServerError, "oidc.completeFailed")
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// completeDevice はデバイスフローのユーザーコードを承認（または拒否）し、端末へ戻るよう案内する。
+func (h *oidcHandoff) completeDevice(ctx context.Context, w http.ResponseWriter, userCode string, result UpstreamResult) {
+	approved := result.Success && result.Subject != "" && result.AccessToken != ""
+	var err error
+	if approved {
+		err = h.usecase.ApproveDevice(ctx, userCode, oidcprovider.Identity{
+			Provider: result.Provider,
+			Subject:  result.Subject,
+			Name:     result.Name,
+			Picture:  result.Picture,
+			Email:    result.Email,
+		}, oidcprovider.DeviceToken{
+			AccessToken: result.AccessToken,
+			TokenType:   result.TokenType,
+			ExpiresIn:   result.ExpiresIn,
+		})
+	} else {
+		h.logf("oidc device: %s login failed: %s", result.Provider, result.Error)
+		err = h.usecase.DenyDevice(ctx, userCode)
+	}
+	if err != nil {
+		if errors.Is(err, oidcprovider.ErrDeviceCodeNotFound) {
+			h.renderError(w, http.StatusBadRequest, "device.expired")
+			return
+		}
+		h.logf("oidc device completion failed: %v", err)
+		h.renderError(w, http.StatusInternalServerError, "oidc.completeFailed")
+		return
+	}
+	if err := pagesOrDefault(h.pages).RenderDeviceResult(w, approved, result.Provider); err != nil {
+		h.logf("oidc device: %v", err)
+	}
+}
+
+func (h *oidcHandoff) renderError(w http.ResponseWriter, status int, messageKey string) {
+	if err := pagesOrDefault(h.pages).RenderError(w, status, messageKey, ""); err != nil {
+		h.logf("oidc handoff: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package httpadapter
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// defaultTemplates は既定のページテンプレート。テナントは同名ファイルで個別に上書きできる。
+//
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+const (
+	pageResult = "result.html"
+	pageError  = "error.html"
+	pagePopup  = "popup.html"
+	pageSelect = "select.html"
+	pageDevice = "device.html"
+)
+
+// defaultLocale はロケール未指定時に使う言語。
+const defaultLocale = "ja"
+
+// pageMessages はロケールごとの既定文言。{provider} と {app} は表示時に置き換える。
+var pageMessages = map[string]map[string]string{
+	"ja": {
+		"login.title":         "{provider} ログイン",
+		"login.success":       "{provider}ログインが完了しました。元の画面に戻ってください。",
+		"login.failed":        "{provider}ログインに失敗しました。",
+		"login.back":          "こちらをタップして元の画面に戻ってください。",
+		"popup.success":       "{provider}ログインが完了しました。このウィンドウは自動で閉じます。",
+		"error.title":         "ログイン",
+		"oidc.invalidRequest": "ログイン要求が不正です。",
+		"oidc.startFailed":    "ログインを開始できませんでした。時間をおいて再度お試しください。",
+		"oidc.expired":        "ログインの有効期限が切れました。アプリからもう一度やり直してください。",
+		"oidc.completeFailed": "ログインを完了できませんでした。時間をおいて再度お試しください。",
+		"select.title":        "ログイン",
+		"select.prompt":       "{app} にログインする方法を選んでください。",
+		"select.button":       "{provider} でログイン",
+		"select.failed":       "ログインを開始できませんでした。もう一度お試しください。",
+		"device.title":        "端末のログイン",
+		"device.prompt":       "端末に表示されているコードを入力してください。",
+		"device.submit":       "次へ",
+		"device.invalid":      "コードが正しくないか、有効期限が切れています。",
+		"device.expired":      "コードの有効期限が切れました。端末からもう一度やり直してください。",
+		"device.confirm":      "{app} へのログインを承認します。コード {code} が端末の表示と一致することを確認してください。",
+		"device.approved":     "{provider}で承認しました。端末に戻ってください。",
+		"device.denied":       "{provider}ログインに失敗したため、端末のログインを中止しました。",
+	},
+	"en": {
+		"login.title":         "{provider} login",
+		"login.success":       "{provider} login completed. Please return to the app.",
+		"login.failed":        "{provider} login failed.",
+		"login.back":          "Tap here to return to the app.",
+		"popup.success":       "{provider} login completed. This window will close automatically.",
+		"error.title":         "Login",
+		"oidc.invalidRequest": "The login request is invalid.",
+		"oidc.startFailed":    "Could not start the login. Please try again later.",
+		"oidc.expired":        "The login has expired. Please start again from the app.",
+		"oidc.completeFailed": "Could not complete the login. Please try again later.",
+		"select.title":        "Login",
+		"select.prompt":       "Choose how to sign in to {app}.",
+		"select.button":       "Continue with {provider}",
+		"select.failed":       "Could not start the login. Please try again.",
+		"device.title":        "Device login",
+		"device.prompt":       "Enter the code shown on your device.",
+		"device.submit":       "Continue",
+		"device.invalid":      "The code is incorrect or has expired.",
+		"device.expired":      "The code has expired. Please start again from your device.",
+		"device.confirm":      "You are signing in to {app}. Make sure the code {code} matches the one on your device.",
+		"device.approved":     "Approved with {provider}. You can return to your device.",
+		"device.denied":       "{provider} login failed, so the device login was cancelled.",
+	},
+}
+
+// providerLabels はページに表示するプロバイダ名。
+var providerLabels = map[string]string{
+	lineStateCookieProvider:    "LINE",
+	twitterStateCookieProvider: "X",
+	discordStateCookieProvider: "Discord",
+	appleStateCookieProvider:   "Apple",
+}
+
+// PageColors はページの配色。CSSの色指定として埋め込む。
+type PageColors struct {
+	Primary    string
+	Background string
+	Text       string
+}
+
+// Branding はテナントごとのページの見た目と文言の設定。空の項目は既定値を使う。
+type Branding struct {
+	AppName string
+	LogoURL string
+	Colors  PageColors
+	// Locale は既定文言の言語（ja / en）。
+	Locale string
+	// Messages はキー単位で既定文言を上書きする。
+	Messages map[string]string
+}
+
+// Pages はログイン結果・エラー・ポップアップ完了・選択ページを描画する。
+type Pages struct {
+	tmpl     *template.Template
+	branding Branding
+	lang     string
+	messages map[string]string
+}
+
+var defaultPages = mustDefaultPages()
+
+func mustDefaultPages() *Pages {
+	p, err := NewPages(Branding{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// NewPages は埋め込みの既定テンプレートに overrides の同名ファイル（*.html）を重ねてPagesを生成する。
+// overrides がnilなら既定テンプレートのみを使う。
+func NewPages(branding Branding, overrides fs.FS) (*Pages, error) {
+	lang := strings.TrimSpace(branding.Locale)
+	if lang == "" {
+		lang = defaultLocale
+	}
+	base, ok := pageMessages[lang]
+	if !ok {
+		return nil, fmt.Errorf("pages: unsupported locale %q", lang)
+	}
+	messages := make(map[string]string, len(base)+len(branding.Messages))
+	for k, v := range base {
+		messages[k] = v
+	}
+	for k, v := range branding.Messages {
+		if v = strings.TrimSpace(v); v != "" {
+			messages[k] = v
+		}
+	}
+
+	tmpl, err := template.ParseFS(defaultTemplates, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("pages: parse default templates: %w", err)
+	}
+	if overrides != nil {
+		matches, err := fs.Glob(overrides, "*.html")
+		if err != nil {
+			return nil, fmt.Errorf("pages: list override templates: %w", err)
+		}
+		if len(matches) > 0 {
+			if tmpl, err = tmpl.ParseFS(overrides, matches...); err != nil {
+				return nil, fmt.Errorf("pages: parse override templates: %w", err)
+			}
+		}
+	}
+
+	branding.Colors = withDefaultColors(branding.Colors)
+	return &Pages{tmpl: tmpl, branding: branding, lang: lang, messages: messages}, nil
+}
+
+func withDefaultColors(c PageColors) PageColors {
+	if strings.TrimSpace(c.Primary) == "" {
+		c.Primary = "#ec4899"
+	}
+	if strings.TrimSpace(c.Background) == "" {
+		c.Background = "#f8fafc"
+	}
+	if strings.TrimSpace(c.Text) == "" {
+		c.Text = "#0f172a"
+	}
+	return c
+}
+
+// pageView はテンプレートに渡す値。
+type pageView struct {
+	Lang    string
+	AppName string
+	LogoURL string
+	Colors  PageColors
+	Title   string
+	Message string
+	Detail  string
+
+	LinkURL  string
+	LinkText string
+
+	// ポップアップ完了ページ用。
+	Result       any
+	TargetOrigin string
+
+	// 選択ページ用。
+	Upstreams []OIDCUpstream
+	ErrorText string
+
+	// デバイスコード入力ページ用。
+	UserCode  string
+	CSRFToken string
+}
+
+// text はキーの文言を返し、{provider}・{app} を置き換える。
+func (p *Pages) text(key, provider string) string {
+	msg := p.messages[key]
+	return strings.NewReplacer("{provider}", providerLabel(provider), "{app}", p.branding.AppName).Replace(msg)
+}
+
+func providerLabel(provider string) string {
+	if label, ok := providerLabels[provider]; ok {
+		return label
+	}
+	return provider
+}
+
+func (p *Pages) view(title string) pageView {
+	return pageView{
+		Lang:    p.lang,
+		AppName: p.branding.AppName,
+		LogoURL: p.branding.LogoURL,
+		Colors:  p.branding.Colors,
+		Title:   title,
+	}
+}
+
+// render はバッファに描画してから書き出し、テンプレートの失敗で中途半端なHTMLを返さないようにする。
+func (p *Pages) render(w http.ResponseWriter, status int, name string, view pageView) error {
+	var buf bytes.Buffer
+	if err := p.tmpl.ExecuteTemplate(&buf, name, view); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return fmt.Errorf("pages: render %s: %w", name, err)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
+
+// RenderResult はリダイレクトできない場合のログイン結果ページを描画する。link が空ならリンクを出さない。
+func (p *Pages) RenderResult(w http.ResponseWriter, result UpstreamResult, link string) error {
+	view := p.view(p.text("login.title", result.Provider))
+	view.Message = p.text("login.success", result.Provider)
+	if !result.Success {
+		view.Message = p.text("login.failed", result.Provider)
+		view.Detail = result.Error
+	}
+	if link != "" {
+		view.LinkURL = link
+		view.LinkText = p.text("login.back", result.Provider)
+	}
+	return p.render(w, http.StatusOK, pageResult, view)
+}
+
+// RenderPopup はポップアップで開始したログインの完了ページを描画する。
+// 開いた側（window.opener）へ targetOrigin 限定で payload を postMessage し、openerが無ければ link へ遷移する。
+func (p *Pages) RenderPopup(w http.ResponseWriter, result UpstreamResult, payload any, targetOrigin, link string) error {
+	view := p.view(p.text("login.title", result.Provider))
+	view.Message = p.text("popup.success", result.Provider)
+	if !result.Success {
+		view.Message = p.text("login.failed", result.Provider)
+		view.Detail = result.Error
+	}
+	view.Result = payload
+	view.TargetOrigin = targetOrigin
+	if link != "" {
+		view.LinkURL = link
+		view.LinkText = p.text("login.back", result.Provider)
+	}
+	return p.render(w, http.StatusOK, pagePopup, view)
+}
+
+// RenderError はユーザーに見せるエラーページを描画する。messageKey は文言カタログのキー。
+func (p *Pages) RenderError(w http.ResponseWriter, status int, messageKey, detail string) error {
+	view := p.view(p.text("error.title", ""))
+	view.Message = p.text(messageKey, "")
+	view.Detail = detail
+	return p.render(w, status, pageError, view)
+}
+
+// RenderSelect はOIDCの上流ログイン選択ページを描画する。appName はクライアント名（空ならテナントのAppName）。
+func (p *Pages) RenderSelect(w http.ResponseWriter, appName string, upstreams []OIDCUpstream) error {
+	return p.renderSelect(w, appName, "select.prompt", "", upstreams)
+}
+
+// RenderDeviceSelect はデバイスフローで承認に使う上流ログインの選択ページを描画する。
+func (p *Pages) RenderDeviceSelect(w http.ResponseWriter, appName, userCode string, upstreams []OIDCUpstream) error {
+	return p.renderSelect(w, appName, "device.confirm", userCode, upstreams)
+}
+
+func (p *Pages) renderSelect(w http.ResponseWriter, appName, promptKey, userCode string, upstreams []OIDCUpstream) error {
+	if appName == "" {
+		appName = p.branding.AppName
+	}
+	replacer := strings.NewReplacer("{app}", appName, "{code}", userCode)
+	view := p.view(p.text("select.title", ""))
+	view.Message = replacer.Replace(p.messages[promptKey])
+	view.ErrorText = p.text("select.failed", "")
+	view.Upstreams = make([]OIDCUpstream, 0, len(upstreams))
+	for _, u := range upstreams {
+		label := u.Label
+		if label == "" {
+			label = providerLabel(u.ID)
+		}
+		u.Label = strings.NewReplacer("{provider}", label).Replace(p.messages["select.button"])
+		view.Upstreams = append(view.Upstreams, u)
+	}
+	return p.render(w, http.StatusOK, pageSelect, view)
+}
+
+// RenderDevice はデバイスフローのコード入力ページを描画する。errorKey が空でなければエラー文言を添える。
+func (p *Pages) RenderDevice(w http.ResponseWriter, status int, userCode, csrfToken, errorKey string) error {
+	view := p.view(p.text("device.title", ""))
+	view.Message = p.text("device.prompt", "")
+	view.LinkText = p.text("device.submit", "")
+	view.UserCode = userCode
+	view.CSRFToken = csrfToken
+	if errorKey != "" {
+		view.Detail = p.text(errorKey, "")
+	}
+	return p.render(w, status, pageDevice, view)
+}
+
+// RenderDeviceResult はデバイスフローの承認結果を描画する。
+func (p *Pages) RenderDeviceResult(w http.ResponseWriter, approved bool, provider string) error {
+	view := p.view(p.text("device.title", ""))
+	view.Message = p.text("device.approved", provider)
+	if !approved {
+		view.Message = p.text("device.denied", provider)
+	}
+	return p.render(w, http.StatusOK, pageResult, view)
+}
+
+// pagesOrDefault はnilなら既定のPagesを返す。
+func pagesOrDefault(p *Pages) *Pages {
+	if p == nil {
+		return defaultPages
+	}
+	return p
+}
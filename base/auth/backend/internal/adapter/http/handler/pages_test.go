@@ -0,0 +1,134 @@
+package httpadapter
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// ページの既定描画・ロケール・文言/テンプレートの上書きをテーブル駆動で検証する。
+func TestPages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		branding  Branding
+		overrides fstest.MapFS
+		render    func(p *Pages, w http.ResponseWriter) error
+		want      []string
+		notWant   []string
+		wantErr   bool
+	}{
+		{
+			name:     "既定は日本語の結果ページ",
+			branding: Branding{},
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderResult(w, UpstreamResult{Provider: "line", Success: true}, "https://app.example.com/done")
+			},
+			want: []string{`lang="ja"`, "LINEログインが完了しました", `href="https://app.example.com/done"`, "#ec4899"},
+		},
+		{
+			name:     "英語ロケールとブランド",
+			branding: Branding{Locale: "en", AppName: "Acme", LogoURL: "https://cdn.example.com/logo.png", Colors: PageColors{Primary: "#123456"}},
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderResult(w, UpstreamResult{Provider: "twitter", Success: true}, "")
+			},
+			want:    []string{`lang="en"`, "X login completed", `src="https://cdn.example.com/logo.png"`, "#123456"},
+			notWant: []string{"<a href"},
+		},
+		{
+			name:     "文言の上書き",
+			branding: Branding{Messages: map[string]string{"login.failed": "{app}: {provider} でエラー", "login.title": ""}},
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderResult(w, UpstreamResult{Provider: "discord", Error: "<b>boom</b>"}, "")
+			},
+			want:    []string{": Discord でエラー", "&lt;b&gt;boom&lt;/b&gt;", "Discord ログイン"},
+			notWant: []string{"<b>boom</b>"},
+		},
+		{
+			name:      "テンプレートの上書き",
+			overrides: fstest.MapFS{"error.html": {Data: []byte(`<main data-brand="custom">{{.Message}}</main>`)}},
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderError(w, http.StatusBadRequest, "oidc.expired", "")
+			},
+			want: []string{`<main data-brand="custom">ログインの有効期限が切れました。`},
+		},
+		{
+			name:     "色に不正な値はCSSへ埋め込まない",
+			branding: Branding{Colors: PageColors{Background: "red;}</style><script>alert(1)</script>"}},
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderError(w, http.StatusBadRequest, "oidc.expired", "")
+			},
+			want:    []string{"ZgotmplZ"},
+			notWant: []string{"alert(1)"},
+		},
+		{
+			name: "ポップアップ完了ページ",
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderPopup(w, UpstreamResult{Provider: "apple", Success: true},
+					map[string]string{"type": "oauth-login-result", "note": "</script>"},
+					"https://app.example.com", "https://app.example.com/done#oauth-login=x")
+			},
+			want:    []string{`postMessage(result, "https://app.example.com")`, `"oauth-login-result"`, "Appleログインが完了しました。このウィンドウは自動で閉じます。"},
+			notWant: []string{`"</script>"`},
+		},
+		{
+			name: "選択ページ",
+			render: func(p *Pages, w http.ResponseWriter) error {
+				return p.RenderSelect(w, "Acme", []OIDCUpstream{{ID: "line", Label: "LINE", LoginPath: "/line/login"}})
+			},
+			want: []string{"Acme にログインする方法を選んでください。", `data-login-path="/line/login"`, "LINE でログイン"},
+		},
+		{
+			name:     "未対応のロケール",
+			branding: Branding{Locale: "fr"},
+			wantErr:  true,
+		},
+		{
+			name:      "壊れた上書きテンプレート",
+			overrides: fstest.MapFS{"result.html": {Data: []byte(`{{.Message`)}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// nilのMapFSをそのまま渡すと非nilのfs.FSになるため分けて渡す。
+			var overrides fs.FS
+			if tt.overrides != nil {
+				overrides = tt.overrides
+			}
+			p, err := NewPages(tt.branding, overrides)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPages: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			if err := tt.render(p, rr); err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			body := rr.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Fatalf("body missing %q:\n%s", want, body)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(body, notWant) {
+					t.Fatalf("body unexpectedly contains %q:\n%s", notWant, body)
+				}
+			}
+		})
+	}
+}
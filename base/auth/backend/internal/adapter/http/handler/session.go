@@ -0,0 +1,308 @@
+package httpadapter
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/session"
+)
+
+// DefaultSessionCookieName はセッションCookieの既定名。親ドメインに付けるため __Host- ではなく __Secure- を使う。
+const DefaultSessionCookieName = "__Secure-auth_session"
+
+// csrfHeader は状態を変更するリクエストでCSRFトークンを送るヘッダ。
+const csrfHeader = "X-CSRF-Token"
+
+// SessionManager はセッショントークンとCSRFトークンを扱う最小インターフェース。
+type SessionManager interface {
+	Issue(id session.Identity) (string, *session.Session, error)
+	Verify(token string) (*session.Session, error)
+	CSRFToken(s *session.Session) string
+	VerifyCSRF(s *session.Session, token string) bool
+	TTL() time.Duration
+}
+
+// SessionCookie はセッションCookieモードの設定。コールバックはJWTをフラグメントに載せず、
+// HttpOnly・Secure・SameSite のCookieを親ドメイン（Domain）に付けて同一サイトのアプリと共有する。
+type SessionCookie struct {
+	Manager  SessionManager
+	Name     string
+	Domain   string
+	SameSite http.SameSite
+}
+
+func (c *SessionCookie) cookieName() string {
+	if name := strings.TrimSpace(c.Name); name != "" {
+		return name
+	}
+	return DefaultSessionCookieName
+}
+
+func (c *SessionCookie) cookie(value string, maxAge int) *http.Cookie {
+	sameSite := c.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    value,
+		Path:     "/",
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
+
+// start はログイン結果からセッションを発行してCookieに書き込む。
+func (c *SessionCookie) start(w http.ResponseWriter, result UpstreamResult) error {
+	token, _, err := c.Manager.Issue(session.Identity{
+		Provider: result.Provider,
+		Subject:  result.Subject,
+		Name:     result.Name,
+		Picture:  result.Picture,
+		Email:    result.Email,
+	})
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie(token, int(c.Manager.TTL().Seconds())))
+	return nil
+}
+
+// read はリクエストのCookieからセッションを検証して返す。
+func (c *SessionCookie) read(r *http.Request) (*session.Session, error) {
+	cookie, err := r.Cookie(c.cookieName())
+	if err != nil || cookie.Value == "" {
+		return nil, session.ErrInvalidSession
+	}
+	return c.Manager.Verify(cookie.Value)
+}
+
+// clear はセッションCookieを削除する。
+func (c *SessionCookie) clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie("", -1))
+}
+
+// WithSession はセッションCookieモードを設定する。nilならフラグメントで結果を返す。
+func (b *RedirectBuilder) WithSession(s *SessionCookie) *RedirectBuilder {
+	b.session = s
+	return b
+}
+
+// sessionResult はセッションCookieモードで返せるログイン結果。プロバイダごとの結果型が実装する。
+type sessionResult interface {
+	upstream() UpstreamResult
+	// withholdToken はセッションを開始したことを結果に記録し、JWTを取り除く。
+	withholdToken()
+}
+
+// startSession はセッションCookieモードで成功したログインならセッションを開始し、結果からJWTを取り除く。
+// セッションCookieモードではJWTをフラグメントやpostMessageに載せない。
+// 開始に失敗した場合は500を返してfalseを返すので、呼び出し側はそのまま戻る。
+func (b *RedirectBuilder) startSession(w http.ResponseWriter, result sessionResult, logger *log.Logger) bool {
+	up := result.upstream()
+	if b.session == nil || !up.Success || up.Subject == "" {
+		return true
+	}
+	if err := b.session.start(w, up); err != nil {
+		logger.Printf("failed to start session: %v", err)
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return false
+	}
+	result.withholdToken()
+	return true
+}
+
+// SessionHandler はセッションCookieモードの /session エンドポイントをまとめる。
+type SessionHandler struct {
+	resolver SessionTenantResolver
+	logger   *log.Logger
+}
+
+// NewSessionHandler はセッション用ハンドラを初期化する。
+func NewSessionHandler(resolver SessionTenantResolver, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		resolver: resolver,
+		logger:   logger,
+	}
+}
+
+// RegisterRoutes はルーターにセッション用エンドポイントを登録する。
+func (h *SessionHandler) RegisterRoutes(r chi.Router) {
+	r.Options("/session", h.handlePreflight)
+	r.Get("/session", h.handleGet)
+	r.Delete("/session", h.handleDelete)
+	r.Options("/session/verify", h.handlePreflight)
+	r.Post("/session/verify", h.handleVerify)
+}
+
+func (h *SessionHandler) depsFromRequest(w http.ResponseWriter, r *http.Request) (SessionTenantDeps, error) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return SessionTenantDeps{}, errors.New("tenant missing")
+	}
+	deps, err := h.resolver.ResolveSession(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrSessionDisabled) {
+			http.Error(w, "session cookie mode is disabled for this tenant", http.StatusNotFound)
+			return SessionTenantDeps{}, err
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return SessionTenantDeps{}, err
+	}
+	return deps, nil
+}
+
+type sessionUser struct {
+	Provider    string `json:"provider"`
+	UserID      string `json:"userId"`
+	DisplayName string `json:"displayName,omitempty"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+	Email       string `json:"email,omitempty"`
+}
+
+type sessionResponse struct {
+	User      sessionUser `json:"user"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+	CSRFToken string      `json:"csrfToken"`
+}
+
+// handleGet はセッションのユーザーと、状態を変更するリクエストに付けるCSRFトークンを返す。
+func (h *SessionHandler) handleGet(w http.ResponseWriter, r *http.Request) {
+	deps, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	s, err := deps.Cookie.read(r)
+	if err != nil {
+		http.Error(w, "no active session", http.StatusUnauthorized)
+		return
+	}
+
+	h.writeSession(w, deps, s)
+}
+
+// handleVerify はアプリのサーバーが状態を変更するリクエストを受けたときに呼ぶ検証用エンドポイント。
+// 受け取ったセッションCookieと X-CSRF-Token ヘッダをそのまま転送すると、両方が有効ならセッションを返す。
+func (h *SessionHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
+	deps, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	s, err := deps.Cookie.read(r)
+	if err != nil {
+		http.Error(w, "no active session", http.StatusUnauthorized)
+		return
+	}
+	if !deps.Cookie.Manager.VerifyCSRF(s, r.Header.Get(csrfHeader)) {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+	h.writeSession(w, deps, s)
+}
+
+// writeSession はセッションのユーザー・有効期限・CSRFトークンを返す。
+func (h *SessionHandler) writeSession(w http.ResponseWriter, deps SessionTenantDeps, s *session.Session) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sessionResponse{
+		User: sessionUser{
+			Provider:    s.Provider,
+			UserID:      s.Subject,
+			DisplayName: s.Name,
+			AvatarURL:   s.Picture,
+			Email:       s.Email,
+		},
+		ExpiresAt: s.ExpiresAt,
+		CSRFToken: deps.Cookie.Manager.CSRFToken(s),
+	}); err != nil {
+		h.logger.Printf("failed to encode session response: %v", err)
+	}
+}
+
+// handleDelete はログアウトとしてセッションCookieを削除する。CSRFトークンが必要。
+func (h *SessionHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	deps, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	s, err := deps.Cookie.read(r)
+	if err != nil {
+		// 期限切れ・不正なCookieも残さない。
+		deps.Cookie.clear(w)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !deps.Cookie.Manager.VerifyCSRF(s, r.Header.Get(csrfHeader)) {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+	deps.Cookie.clear(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// prepare はテナントの依存を解決し、ブラウザからの呼び出しならオリジンを確認してCORSヘッダを付ける。
+func (h *SessionHandler) prepare(w http.ResponseWriter, r *http.Request) (SessionTenantDeps, bool) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return SessionTenantDeps{}, false
+	}
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return SessionTenantDeps{}, false
+		}
+		h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	}
+	return deps, true
+}
+
+func (h *SessionHandler) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.depsFromRequest(w, r)
+	if err != nil {
+		return
+	}
+	origin := r.Header.Get("Origin")
+	if !h.isOriginAllowed(deps.AllowedOrigins, origin) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.applyCORSHeaders(deps.AllowedOrigins, w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", csrfHeader)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isOriginAllowed は許可済みオリジンかを判定する。Cookieを送れるCORSを返すので、allowed が空なら何も許可しない。
+func (h *SessionHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
+	if origin == "" || len(allowed) == 0 {
+		return false
+	}
+	_, ok := allowed[origin]
+	return ok
+}
+
+// applyCORSHeaders は許可済みオリジンに対して、Cookieを送れるCORSレスポンスヘッダを付与する。
+func (h *SessionHandler) applyCORSHeaders(allowed map[string]struct{}, w http.ResponseWriter, origin string) {
+	if !h.isOriginAllowed(allowed, origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Vary", "Origin")
+}
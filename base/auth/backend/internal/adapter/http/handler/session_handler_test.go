@@ -0,0 +1,190 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/session"
+)
+
+func TestSessionHandler(t *testing.T) {
+	t.Parallel()
+
+	cookie := &SessionCookie{Manager: session.NewManager([]byte("secret"), "tenant1", time.Hour), Domain: "example.com"}
+	token, s, err := cookie.Manager.Issue(session.Identity{Provider: "line", Subject: "U123", Name: "テスト"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	csrf := cookie.Manager.CSRFToken(s)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		cookie      string
+		csrf        string
+		disabled    bool
+		noAllowlist bool
+		wantStatus  int
+		wantCleared bool
+	}{
+		{name: "セッション取得", method: http.MethodGet, origin: "https://app.example.com", cookie: token, wantStatus: http.StatusOK},
+		{name: "Cookieなしで401", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "不正なCookieで401", method: http.MethodGet, cookie: "bad", wantStatus: http.StatusUnauthorized},
+		{name: "Origin未許可で403", method: http.MethodGet, origin: "https://evil.example.net", cookie: token, wantStatus: http.StatusForbidden},
+		{name: "許可リストが空なら403", method: http.MethodGet, origin: "https://app.example.com", cookie: token, noAllowlist: true, wantStatus: http.StatusForbidden},
+		{name: "無効なテナントで404", method: http.MethodGet, cookie: token, disabled: true, wantStatus: http.StatusNotFound},
+		{name: "ログアウト", method: http.MethodDelete, cookie: token, csrf: csrf, wantStatus: http.StatusNoContent, wantCleared: true},
+		{name: "CSRFトークンなしのログアウトは403", method: http.MethodDelete, cookie: token, wantStatus: http.StatusForbidden},
+		{name: "セッションなしのログアウトはCookieを消す", method: http.MethodDelete, wantStatus: http.StatusNoContent, wantCleared: true},
+		{name: "CSRF検証", method: http.MethodPost, origin: "https://app.example.com", cookie: token, csrf: csrf, wantStatus: http.StatusOK},
+		{name: "CSRFトークンなしの検証は403", method: http.MethodPost, cookie: token, wantStatus: http.StatusForbidden},
+		{name: "不正なCSRFトークンは403", method: http.MethodPost, cookie: token, csrf: "AAAA", wantStatus: http.StatusForbidden},
+		{name: "セッションなしの検証は401", method: http.MethodPost, csrf: csrf, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resolver := &mockSessionResolver{deps: SessionTenantDeps{
+				Cookie:         cookie,
+				AllowedOrigins: map[string]struct{}{"https://app.example.com": {}},
+			}}
+			if tt.disabled {
+				resolver.err = ErrSessionDisabled
+			}
+			if tt.noAllowlist {
+				resolver.deps.AllowedOrigins = nil
+			}
+			h := NewSessionHandler(resolver, log.New(io.Discard, "", 0))
+
+			req := httptest.NewRequest(tt.method, "/session", nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultSessionCookieName, Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				req.Header.Set(csrfHeader, tt.csrf)
+			}
+			rr := httptest.NewRecorder()
+			switch tt.method {
+			case http.MethodGet:
+				h.handleGet(rr, req)
+			case http.MethodPost:
+				h.handleVerify(rr, req)
+			default:
+				h.handleDelete(rr, req)
+			}
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			cleared := false
+			for _, c := range rr.Result().Cookies() {
+				if c.Name == DefaultSessionCookieName && c.MaxAge < 0 {
+					cleared = true
+				}
+			}
+			if cleared != tt.wantCleared {
+				t.Fatalf("cookie cleared=%v want=%v", cleared, tt.wantCleared)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Fatalf("allow credentials=%q", got)
+			}
+			var res sessionResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if res.User.Provider != "line" || res.User.UserID != "U123" || res.CSRFToken != csrf {
+				t.Fatalf("unexpected response: %+v", res)
+			}
+		})
+	}
+}
+
+// セッションCookieモードではコールバックがCookieを付け、フラグメントにJWTを載せない。
+func TestLineHandler_CallbackSessionMode(t *testing.T) {
+	t.Parallel()
+
+	cookie := &SessionCookie{Manager: session.NewManager([]byte("secret"), "tenant1", time.Hour), Domain: "example.com"}
+	mock := &mockLineResolver{
+		deps: LineTenantDeps{
+			Usecase: &mockLineUsecase{
+				callbackOut: &linelogin.CallbackResult{
+					Success: true,
+					State:   "state",
+					Origin:  "https://app.example.com",
+					Payload: &linelogin.ResultPayload{
+						AccessToken: "jwt",
+						TokenType:   "Bearer",
+						ExpiresIn:   3600,
+						LineUser:    linelogin.LineUserPayload{ID: "U123", DisplayName: "テスト"},
+					},
+				},
+			},
+			DefaultRedirectOrigin: "https://app.example.com",
+			RedirectPath:          "/done",
+			Session:               cookie,
+		},
+	}
+	h := NewLineHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/?state=state&code=code", nil)
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+	rr := httptest.NewRecorder()
+	h.handleCallback(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	result := decodeLineResultFragment(t, rr.Header().Get("Location"))
+	if !result.Success || !result.Session || result.Payload == nil || result.Payload.AccessToken != "" {
+		t.Fatalf("fragment must not carry the JWT: %+v", result)
+	}
+	if result.Payload.LineUser.UserID != "U123" {
+		t.Fatalf("user=%+v", result.Payload.LineUser)
+	}
+
+	var sessionCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == DefaultSessionCookieName {
+			sessionCookie = c
+		}
+	}
+	if sessionCookie == nil {
+		t.Fatalf("session cookie not set")
+	}
+	if !sessionCookie.HttpOnly || !sessionCookie.Secure || sessionCookie.Domain != "example.com" || sessionCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected cookie attributes: %+v", sessionCookie)
+	}
+	s, err := cookie.Manager.Verify(sessionCookie.Value)
+	if err != nil {
+		t.Fatalf("verify session: %v", err)
+	}
+	if s.Provider != "line" || s.Subject != "U123" || s.Name != "テスト" {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+}
+
+type mockSessionResolver struct {
+	deps SessionTenantDeps
+	err  error
+}
+
+func (m *mockSessionResolver) ResolveSession(string) (SessionTenantDeps, error) {
+	return m.deps, m.err
+}
@@ -0,0 +1,113 @@
+package httpadapter
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errorCodeStateMismatch はstateとブラウザの紐付けが一致しない場合にログイン結果へ載せるエラーコード。
+const errorCodeStateMismatch = "state_mismatch"
+
+// stateMismatchMessage は紐付け不一致時にユーザーへ表示する文言。
+const stateMismatchMessage = "ログインを開始したブラウザと異なるため中断しました。もう一度お試しください。"
+
+// displayPopup はログインをポップアップで開始したことを示す Display の値。
+const displayPopup = "popup"
+
+// DefaultStateCookieName はstate紐付けCookieの既定名（プロバイダ名を後ろに付与する）。
+const DefaultStateCookieName = "__Host-auth_state"
+
+// StateCookie はログイン開始時にstateのnonceをブラウザへ紐付けるCookieの設定。
+// コールバックではCookieのハッシュとstate内nonceを照合し、別ブラウザで開始されたログインを拒否する。
+type StateCookie struct {
+	Disabled    bool
+	Name        string
+	Domain      string
+	SameSite    http.SameSite
+	Partitioned bool
+	MaxAge      time.Duration
+}
+
+// cookieName はプロバイダごとのCookie名を返す。
+func (c StateCookie) cookieName(provider string) string {
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		name = DefaultStateCookieName
+	}
+	return name + "_" + provider
+}
+
+// set はnonceのハッシュをHttpOnly Cookieとして書き込む。
+func (c StateCookie) set(w http.ResponseWriter, provider, nonce string) {
+	if c.Disabled {
+		return
+	}
+	http.SetCookie(w, c.cookie(provider, stateBindingHash(nonce), int(c.MaxAge.Seconds())))
+}
+
+// clear はCookieを削除する。
+func (c StateCookie) clear(w http.ResponseWriter, provider string) {
+	if c.Disabled {
+		return
+	}
+	http.SetCookie(w, c.cookie(provider, "", -1))
+	http.SetCookie(w, c.cookie(provider+"_"+displayPopup, "", -1))
+}
+
+// setPopup はポップアップで開始したログインであることを記録する。無効時は記録せずリダイレクトで返す。
+func (c StateCookie) setPopup(w http.ResponseWriter, provider string) {
+	if c.Disabled {
+		return
+	}
+	http.SetCookie(w, c.cookie(provider+"_"+displayPopup, "1", int(c.MaxAge.Seconds())))
+}
+
+// popup はポップアップで開始したログインかを返す。
+func (c StateCookie) popup(r *http.Request, provider string) bool {
+	if c.Disabled {
+		return false
+	}
+	cookie, err := r.Cookie(c.cookieName(provider + "_" + displayPopup))
+	return err == nil && cookie.Value == "1"
+}
+
+// matches はリクエストのCookieがnonceと紐付いているかを定数時間で判定する。無効時は常にtrue。
+func (c StateCookie) matches(r *http.Request, provider, nonce string) bool {
+	if c.Disabled {
+		return true
+	}
+	cookie, err := r.Cookie(c.cookieName(provider))
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	expected := stateBindingHash(nonce)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(expected)) == 1
+}
+
+func (c StateCookie) cookie(provider, value string, maxAge int) *http.Cookie {
+	sameSite := c.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:        c.cookieName(provider),
+		Value:       value,
+		Path:        "/",
+		Domain:      c.Domain,
+		MaxAge:      maxAge,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    sameSite,
+		Partitioned: c.Partitioned,
+	}
+}
+
+// stateBindingHash はnonceからCookieに保存するハッシュ値を作る。
+func stateBindingHash(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
+)
+
+// TokenVaultScope は保管したトークンを取得するサービストークンに必要なスコープ。
+const TokenVaultScope = "auth:tokens"
+
+// TokenVaultHandler は保管した上流プロバイダのトークンを内部サービスへ返す。
+type TokenVaultHandler struct {
+	resolver    TokenVaultTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewTokenVaultHandler はトークン保管庫API用ハンドラを初期化する。
+func NewTokenVaultHandler(resolver TokenVaultTenantResolver, httpTimeout time.Duration, logger *log.Logger) *TokenVaultHandler {
+	return &TokenVaultHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターにトークン保管庫APIを登録する。
+func (h *TokenVaultHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/internal/tokens/{provider}/{subject}", h.handleGet)
+}
+
+type vaultTokenResponse struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	AccessToken string     `json:"accessToken"`
+	TokenType   string     `json:"tokenType,omitempty"`
+	Scope       string     `json:"scope,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// handleGet はサービストークンを検証し、必要なら更新したアクセストークンを返す。リフレッシュトークンは返さない。
+func (h *TokenVaultHandler) handleGet(w http.ResponseWriter, r *http.Request) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return
+	}
+	deps, err := h.resolver.ResolveTokenVault(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrVaultDisabled) {
+			http.Error(w, "token vault is disabled for this tenant", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tokens"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	clientID, err := deps.Verifier.VerifyServiceToken(token, TokenVaultScope)
+	if err != nil {
+		if errors.Is(err, oidcprovider.ErrInsufficientScope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+TokenVaultScope+`"`)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	provider := chi.URLParam(r, "provider")
+	subject := chi.URLParam(r, "subject")
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	stored, err := deps.Vault.Get(ctx, provider, subject)
+	if err != nil {
+		switch {
+		case errors.Is(err, tokenvault.ErrNotFound):
+			http.Error(w, "token not found", http.StatusNotFound)
+		case errors.Is(err, tokenvault.ErrExpired):
+			http.Error(w, "token expired; the user must log in again", http.StatusGone)
+		default:
+			h.logger.Printf("token vault get failed (client=%s provider=%s): %v", clientID, provider, err)
+			http.Error(w, "failed to load token", http.StatusBadGateway)
+		}
+		return
+	}
+	h.logger.Printf("token vault: client %s read %s token", clientID, provider)
+
+	res := vaultTokenResponse{
+		Provider:    provider,
+		Subject:     subject,
+		AccessToken: stored.AccessToken,
+		TokenType:   stored.TokenType,
+		Scope:       stored.Scope,
+	}
+	if !stored.ExpiresAt.IsZero() {
+		res.ExpiresAt = &stored.ExpiresAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.Printf("failed to encode token vault response: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package httpadapter
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
+)
+
+// サービストークンの検証結果と保管庫の状態に応じた応答をテーブル駆動で確認する。
+func TestTokenVaultHandler_Get(t *testing.T) {
+	t.Parallel()
+
+	deps := TokenVaultTenantDeps{
+		Vault: &mockTokenVault{tokens: map[string]*tokenvault.Token{
+			"twitter/42": {AccessToken: "x-at", RefreshToken: "x-rt", TokenType: "bearer", ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		}},
+		Verifier: mockServiceVerifier{},
+	}
+	r := chi.NewRouter()
+	r.Use(WithTenant)
+	NewTokenVaultHandler(&mockTokenVaultResolver{deps: deps}, 2*time.Second, log.New(io.Discard, "", 0)).RegisterRoutes(r)
+
+	tests := []struct {
+		name       string
+		path       string
+		auth       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "トークンを返す", path: "/internal/tokens/twitter/42", auth: "Bearer good", wantStatus: http.StatusOK, wantBody: `"accessToken":"x-at"`},
+		{name: "未保管", path: "/internal/tokens/twitter/43", auth: "Bearer good", wantStatus: http.StatusNotFound},
+		{name: "期限切れ", path: "/internal/tokens/line/U1", auth: "Bearer good", wantStatus: http.StatusGone},
+		{name: "Authorizationなし", path: "/internal/tokens/twitter/42", wantStatus: http.StatusUnauthorized},
+		{name: "不正なトークン", path: "/internal/tokens/twitter/42", auth: "Bearer bad", wantStatus: http.StatusUnauthorized},
+		{name: "スコープ不足", path: "/internal/tokens/twitter/42", auth: "Bearer noscope", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = "tenant1.auth.example.com"
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Fatalf("body=%s", rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "x-rt") {
+				t.Fatalf("refresh token must not be returned: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+// --- mocks ---
+
+type mockTokenVaultResolver struct {
+	deps TokenVaultTenantDeps
+}
+
+func (m *mockTokenVaultResolver) ResolveTokenVault(string) (TokenVaultTenantDeps, error) {
+	return m.deps, nil
+}
+
+type mockTokenVault struct {
+	tokens map[string]*tokenvault.Token
+}
+
+func (m *mockTokenVault) Get(_ context.Context, provider, subject string) (*tokenvault.Token, error) {
+	if provider == "line" {
+		return nil, tokenvault.ErrExpired
+	}
+	if tok, ok := m.tokens[provider+"/"+subject]; ok {
+		return tok, nil
+	}
+	return nil, tokenvault.ErrNotFound
+}
+
+type mockServiceVerifier struct{}
+
+func (mockServiceVerifier) VerifyServiceToken(token, scope string) (string, error) {
+	switch token {
+	case "good":
+		return "survey-backend", nil
+	case "noscope":
+		return "", oidcprovider.ErrInsufficientScope
+	default:
+		return "", oidcprovider.ErrInvalidServiceToken
+	}
+}
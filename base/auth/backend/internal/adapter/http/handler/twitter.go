@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 	"net/url"
@@ -65,6 +64,8 @@ func (h *TwitterHandler) depsFromRequest(w http.ResponseWriter, r *http.Request)
 
 type twitterLoginRequest struct {
 	Origin string `json:"origin"`
+	// Display が "popup" ならコールバックでポップアップ完了ページを返す。
+	Display string `json:"display,omitempty"`
 }
 
 type twitterLoginResponse struct {
@@ -125,6 +126,10 @@ func (h *TwitterHandler) handleLoginStart(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	deps.StateCookie.set(w, twitterStateCookieProvider, out.Nonce)
+	if req.Display == displayPopup {
+		deps.StateCookie.setPopup(w, twitterStateCookieProvider)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(twitterLoginResponse{
 		AuthorizationURL: out.AuthorizationURL,
@@ -159,11 +164,31 @@ func (h *TwitterHandler) handleCallback(w http.ResponseWriter, r *http.Request)
 		if payload, err := deps.Usecase.DecodeState(stateParam); err == nil {
 			result.Origin = payload.Origin
 		}
-		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath)
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, twitterStateCookieProvider))
 		h.redirectWithResult(w, r, result, builder, deps.Usecase.DecodeState)
 		return
 	}
 
+	if payload, err := deps.Usecase.DecodeState(stateParam); err == nil && payload != nil &&
+		!deps.StateCookie.matches(r, twitterStateCookieProvider, payload.Nonce) {
+		h.logger.Printf("twitter callback rejected: state cookie mismatch")
+		builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+			WithOIDC(deps.OIDC).
+			WithPages(deps.Pages, deps.StateCookie.popup(r, twitterStateCookieProvider))
+		h.redirectWithResult(w, r, twitterLoginResult{
+			Type:      twitterLoginResultMessageType,
+			Success:   false,
+			State:     stateParam,
+			Origin:    payload.Origin,
+			Error:     stateMismatchMessage,
+			ErrorCode: errorCodeStateMismatch,
+		}, builder, deps.Usecase.DecodeState)
+		return
+	}
+	deps.StateCookie.clear(w, twitterStateCookieProvider)
+
 	result, err := deps.Usecase.Callback(ctx, code, stateParam)
 	if err != nil {
 		h.logger.Printf("twitter callback handling failed: %v", err)
@@ -194,7 +219,11 @@ func (h *TwitterHandler) handleCallback(w http.ResponseWriter, r *http.Request)
 		loginRes.Error = result.ErrorMessage
 	}
 
-	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath)
+	builder := NewRedirectBuilder(deps.DefaultRedirectOrigin, deps.RedirectPath).
+		WithOIDC(deps.OIDC).
+		WithPages(deps.Pages, deps.StateCookie.popup(r, twitterStateCookieProvider)).
+		WithSession(deps.Session).
+		WithNotifier(deps.Webhooks)
 	h.redirectWithResult(w, r, loginRes, builder, deps.Usecase.DecodeState)
 }
 
@@ -215,21 +244,48 @@ func (h *TwitterHandler) handlePreflight(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-const twitterLoginResultMessageType = "oauth-login-result"
+const (
+	twitterLoginResultMessageType = "oauth-login-result"
+	twitterStateCookieProvider    = "twitter"
+)
 
 type twitterLoginResult struct {
-	Type    string                     `json:"type"`
-	Success bool                       `json:"success"`
-	State   string                     `json:"state,omitempty"`
-	Origin  string                     `json:"origin,omitempty"`
-	Error   string                     `json:"error,omitempty"`
-	Payload *twitterLoginResultPayload `json:"payload,omitempty"`
+	Type      string                     `json:"type"`
+	Success   bool                       `json:"success"`
+	State     string                     `json:"state,omitempty"`
+	Origin    string                     `json:"origin,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+	ErrorCode string                     `json:"errorCode,omitempty"`
+	Session   bool                       `json:"session,omitempty"`
+	Payload   *twitterLoginResultPayload `json:"payload,omitempty"`
+}
+
+// upstream はOIDCへ引き渡すためにプロバイダ非依存の結果へ変換する。
+func (r twitterLoginResult) upstream() UpstreamResult {
+	res := UpstreamResult{Provider: twitterStateCookieProvider, Success: r.Success, Error: r.Error}
+	if r.Payload != nil {
+		res.AccessToken = r.Payload.AccessToken
+		res.TokenType = r.Payload.TokenType
+		res.ExpiresIn = r.Payload.ExpiresIn
+		res.Subject = r.Payload.TwitterUser.UserID
+		res.Name = r.Payload.TwitterUser.DisplayName
+		res.Picture = r.Payload.TwitterUser.AvatarURL
+	}
+	return res
+}
+
+// withholdToken はセッションCookieモードの結果からJWTを取り除く。
+func (r *twitterLoginResult) withholdToken() {
+	r.Session = true
+	if r.Payload != nil {
+		r.Payload.AccessToken, r.Payload.TokenType, r.Payload.ExpiresIn = "", "", 0
+	}
 }
 
 type twitterLoginResultPayload struct {
-	AccessToken string           `json:"accessToken"`
-	TokenType   string           `json:"tokenType"`
-	ExpiresIn   int              `json:"expiresIn"`
+	AccessToken string           `json:"accessToken,omitempty"`
+	TokenType   string           `json:"tokenType,omitempty"`
+	ExpiresIn   int              `json:"expiresIn,omitempty"`
 	TwitterUser twitterLoginUser `json:"twitterUser"`
 }
 
@@ -240,7 +296,7 @@ type twitterLoginUser struct {
 	AvatarURL   string `json:"avatarUrl,omitempty"`
 }
 
-// redirectWithResult は結果をフラグメントに載せてリダイレクトする。
+// redirectWithResult は結果をフラグメントに載せてリダイレクトする（ポップアップ開始ならpostMessageで返す）。
 func (h *TwitterHandler) redirectWithResult(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -248,13 +304,22 @@ func (h *TwitterHandler) redirectWithResult(
 	builder *RedirectBuilder,
 	decodeState func(string) (*twitterlogin.StatePayload, error),
 ) {
+	if err := builder.notifyLogin(r.Context(), result.upstream()); err != nil {
+		h.logger.Printf("failed to notify login webhooks: %v", err)
+	}
+	if builder.handoff(w, r, result.Origin, result.upstream()) {
+		return
+	}
+	if !builder.startSession(w, &result, h.logger) {
+		return
+	}
 	target, err := h.buildRedirectURL(result, builder, decodeState)
 	if err != nil {
 		h.logger.Printf("failed to build twitter redirect URL: %v", err)
-		h.renderFallbackPage(w, result, builder)
-		return
 	}
-	http.Redirect(w, r, target, http.StatusSeeOther)
+	if err := builder.complete(w, r, result.Origin, result.upstream(), result, target); err != nil {
+		h.logger.Printf("failed to render login result page: %v", err)
+	}
 }
 
 func (h *TwitterHandler) buildRedirectURL(
@@ -294,54 +359,6 @@ func (h *TwitterHandler) buildRedirectURL(
 	return base.String(), nil
 }
 
-func (h *TwitterHandler) renderFallbackPage(w http.ResponseWriter, result twitterLoginResult, builder *RedirectBuilder) {
-	message := "Xログインが完了しました。元の画面に戻ってください。"
-	if !result.Success && result.Error != "" {
-		message = result.Error
-	}
-
-	var linkHTML string
-	if builder.defaultOrigin != "" {
-		link := strings.TrimRight(builder.defaultOrigin, "/") + builder.redirectPath
-		linkHTML = fmt.Sprintf(
-			`<p><a href="%s">こちらをタップして戻ってください。</a></p>`,
-			template.HTMLEscapeString(link),
-		)
-	}
-
-	html := fmt.Sprintf(
-		`<!DOCTYPE html>
-<html lang="ja">
-  <head>
-    <meta charset="utf-8" />
-    <title>X認証</title>
-    <meta name="viewport" content="width=device-width, initial-scale=1" />
-    <style>
-      body { font-family: sans-serif; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; background: #f8fafc; }
-      .card { padding: 24px; border-radius: 16px; background: white; box-shadow: 0 12px 30px rgba(15, 23, 42, 0.12); max-width: 360px; text-align: center; }
-      h1 { font-size: 20px; margin-bottom: 12px; color: #0f172a; }
-      p { font-size: 14px; color: #334155; }
-      a { color: #1d9bf0; text-decoration: none; }
-      a:hover { text-decoration: underline; }
-    </style>
-  </head>
-  <body>
-    <div class="card">
-      <h1>X認証</h1>
-      <p>%s</p>
-      %s
-    </div>
-  </body>
-</html>`,
-		template.HTMLEscapeString(message),
-		linkHTML,
-	)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(html))
-}
-
 func (h *TwitterHandler) isOriginAllowed(allowed map[string]struct{}, origin string) bool {
 	if origin == "" {
 		return false
@@ -359,5 +376,6 @@ func (h *TwitterHandler) applyCORSHeaders(allowed map[string]struct{}, w http.Re
 		return
 	}
 	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Vary", "Origin")
 }
@@ -0,0 +1,119 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/oidcprovider"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/webhook"
+)
+
+// WebhookScope は配信ログを読むサービストークンに必要なスコープ。
+const WebhookScope = "auth:webhooks"
+
+// LoginNotifier はログインをテナントのアプリへ通知する。
+type LoginNotifier interface {
+	Notify(ctx context.Context, user webhook.User) error
+}
+
+// WithNotifier はログインの通知先を設定する。nilなら通知しない。
+func (b *RedirectBuilder) WithNotifier(n LoginNotifier) *RedirectBuilder {
+	b.notifier = n
+	return b
+}
+
+// notifyLogin は成功したログインを通知する。配信は非同期で、ここでは初回判定と配信の登録だけを行う。
+func (b *RedirectBuilder) notifyLogin(ctx context.Context, result UpstreamResult) error {
+	if b.notifier == nil || !result.Success || result.Subject == "" {
+		return nil
+	}
+	return b.notifier.Notify(ctx, webhook.User{
+		Provider: result.Provider,
+		Subject:  result.Subject,
+		Name:     result.Name,
+		Picture:  result.Picture,
+		Email:    result.Email,
+	})
+}
+
+// WebhookHandler はWebhookの配信ログを内部サービスへ返す。
+type WebhookHandler struct {
+	resolver    WebhookTenantResolver
+	logger      *log.Logger
+	httpTimeout time.Duration
+}
+
+// NewWebhookHandler は配信ログAPI用ハンドラを初期化する。
+func NewWebhookHandler(resolver WebhookTenantResolver, httpTimeout time.Duration, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		resolver:    resolver,
+		logger:      logger,
+		httpTimeout: httpTimeout,
+	}
+}
+
+// RegisterRoutes はルーターに配信ログAPIを登録する。
+func (h *WebhookHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/internal/webhooks/deliveries", h.handleDeliveries)
+}
+
+type webhookDeliveriesResponse struct {
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+// handleDeliveries はサービストークンを検証し、新しい順の配信ログを返す。
+func (h *WebhookHandler) handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenantID := TenantFromContext(r.Context())
+	if strings.TrimSpace(tenantID) == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return
+	}
+	deps, err := h.resolver.ResolveWebhooks(tenantID)
+	if err != nil {
+		if errors.Is(err, ErrWebhooksDisabled) {
+			http.Error(w, "webhooks are disabled for this tenant", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="webhooks"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := deps.Verifier.VerifyServiceToken(token, WebhookScope); err != nil {
+		if errors.Is(err, oidcprovider.ErrInsufficientScope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+WebhookScope+`"`)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.httpTimeout)
+	defer cancel()
+
+	deliveries, err := deps.Log.Deliveries(ctx)
+	if err != nil {
+		h.logger.Printf("failed to load webhook deliveries: %v", err)
+		http.Error(w, "failed to load deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(webhookDeliveriesResponse{Deliveries: deliveries}); err != nil {
+		h.logger.Printf("failed to encode webhook deliveries: %v", err)
+	}
+}
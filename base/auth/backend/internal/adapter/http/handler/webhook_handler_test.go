@@ -0,0 +1,141 @@
+package httpadapter
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/webhook"
+)
+
+// サービストークンの検証結果とテナント設定に応じた配信ログAPIの応答を確認する。
+func TestWebhookHandler_Deliveries(t *testing.T) {
+	t.Parallel()
+
+	deps := WebhookTenantDeps{
+		Log:      mockWebhookLog{{ID: "dlv_1", EventID: "evt_1", Event: webhook.EventLogin, URL: "https://app.example.com/hook", Status: webhook.StatusSucceeded, Attempts: 1}},
+		Verifier: mockServiceVerifier{},
+	}
+
+	tests := []struct {
+		name       string
+		auth       string
+		disabled   bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "配信ログを返す", auth: "Bearer good", wantStatus: http.StatusOK, wantBody: `"id":"dlv_1"`},
+		{name: "Authorizationなし", wantStatus: http.StatusUnauthorized},
+		{name: "不正なトークン", auth: "Bearer bad", wantStatus: http.StatusUnauthorized},
+		{name: "スコープ不足", auth: "Bearer noscope", wantStatus: http.StatusForbidden},
+		{name: "Webhook未設定", auth: "Bearer good", disabled: true, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resolver := &mockWebhookResolver{deps: deps}
+			if tt.disabled {
+				resolver.err = ErrWebhooksDisabled
+			}
+			r := chi.NewRouter()
+			r.Use(WithTenant)
+			NewWebhookHandler(resolver, 2*time.Second, log.New(io.Discard, "", 0)).RegisterRoutes(r)
+
+			req := httptest.NewRequest(http.MethodGet, "/internal/webhooks/deliveries", nil)
+			req.Host = "tenant1.auth.example.com"
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Fatalf("body=%s want contains %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// 成功したログインだけを通知する。
+func TestLineHandler_CallbackNotifiesLogin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		success bool
+		want    []webhook.User
+	}{
+		{name: "成功したログインを通知", success: true, want: []webhook.User{{Provider: "line", Subject: "U123", Name: "テスト"}}},
+		{name: "失敗は通知しない", success: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			out := &linelogin.CallbackResult{Success: tt.success, State: "state", Origin: "https://app.example.com"}
+			if tt.success {
+				out.Payload = &linelogin.ResultPayload{AccessToken: "jwt", LineUser: linelogin.LineUserPayload{ID: "U123", DisplayName: "テスト"}}
+			}
+			notifier := &mockLoginNotifier{}
+			mock := &mockLineResolver{deps: LineTenantDeps{
+				Usecase:               &mockLineUsecase{callbackOut: out},
+				DefaultRedirectOrigin: "https://app.example.com",
+				RedirectPath:          "/done",
+				Webhooks:              notifier,
+			}}
+			h := NewLineHandler(mock, 2*time.Second, log.New(io.Discard, "", 0))
+
+			req := httptest.NewRequest(http.MethodGet, "/?state=state&code=code", nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "tenant1"))
+			rr := httptest.NewRecorder()
+			h.handleCallback(rr, req)
+
+			if rr.Code != http.StatusSeeOther {
+				t.Fatalf("status=%d", rr.Code)
+			}
+			if len(notifier.users) != len(tt.want) {
+				t.Fatalf("notified=%+v want=%+v", notifier.users, tt.want)
+			}
+			for i := range tt.want {
+				if notifier.users[i] != tt.want[i] {
+					t.Fatalf("notified=%+v want=%+v", notifier.users[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+type mockWebhookResolver struct {
+	deps WebhookTenantDeps
+	err  error
+}
+
+func (m *mockWebhookResolver) ResolveWebhooks(string) (WebhookTenantDeps, error) {
+	return m.deps, m.err
+}
+
+type mockWebhookLog []webhook.Delivery
+
+func (m mockWebhookLog) Deliveries(context.Context) ([]webhook.Delivery, error) {
+	return m, nil
+}
+
+type mockLoginNotifier struct {
+	users []webhook.User
+}
+
+func (m *mockLoginNotifier) Notify(_ context.Context, user webhook.User) error {
+	m.users = append(m.users, user)
+	return nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"time"
@@ -9,23 +10,75 @@ import (
 
 // AppConfig はサーバー共通設定とテナント設定ファイルパスを保持する。
 type AppConfig struct {
-	HTTPAddr        string
-	HTTPTimeout     time.Duration
+	HTTPAddr         string
+	HTTPTimeout      time.Duration
 	TenantConfigPath string
+	StateStore       StateStoreConfig
 }
 
+// StateStoreConfig はOAuth stateのnonceを記録するストアの設定。
+type StateStoreConfig struct {
+	// Backend は "memory" または "nats"。
+	Backend  string
+	NATSURL  string
+	KVBucket string
+	// MaxTTL はKVバケットのTTLで、テナントのstateTTLの最大値以上にする。
+	MaxTTL time.Duration
+	// GrantKVBucket はOIDCの認可リクエスト・認可コード・アクセストークンを保存するバケット。
+	GrantKVBucket string
+	// GrantMaxTTL はGrantKVBucketのTTLで、テナントのaccessTokenTTLの最大値以上にする。
+	GrantMaxTTL time.Duration
+	// VaultKVBucket はテナントの tokenVault が暗号化したプロバイダトークンを保存するバケット。
+	VaultKVBucket string
+	// VaultMaxTTL はVaultKVBucketのTTLで、テナントのretentionの最大値以上にする。
+	VaultMaxTTL time.Duration
+	// WebhookKVBucket はWebhookの初回ログイン判定の記録と配信ログを保存するバケット。
+	WebhookKVBucket string
+	// WebhookMaxTTL はWebhookKVBucketのTTLで、初回ログイン判定の保持期間（365日）以上にする。
+	WebhookMaxTTL time.Duration
+}
+
+// StateStoreBackend の値。
+const (
+	StateStoreMemory = "memory"
+	StateStoreNATS   = "nats"
+)
+
 const (
-	defaultHTTPAddr    = ":8080"
-	defaultHTTPTimeout = 30 * time.Second
+	defaultHTTPAddr      = ":8080"
+	defaultHTTPTimeout   = 30 * time.Second
+	defaultStateKVBucket = "auth_state_nonces"
+	defaultStateMaxTTL   = 30 * time.Minute
+	defaultGrantKVBucket = "auth_oidc_grants"
+	defaultGrantMaxTTL   = 24 * time.Hour
+	defaultVaultKVBucket = "auth_token_vault"
+	defaultVaultMaxTTL   = 90 * 24 * time.Hour
+	defaultWebhookBucket = "auth_webhooks"
+	defaultWebhookMaxTTL = 365 * 24 * time.Hour
 )
 
 // Load は環境変数から設定を読み込む。
-// 必須: AUTH_TENANT_CONFIG_PATH
+// 必須: AUTH_TENANT_CONFIG_PATH（AUTH_STATE_STORE=nats の場合は AUTH_NATS_URL も必須）
 func Load() (AppConfig, error) {
 	cfg := AppConfig{
-		HTTPAddr:        getEnv("AUTH_HTTP_ADDR", defaultHTTPAddr),
-		HTTPTimeout:     parseDuration("AUTH_HTTP_TIMEOUT", defaultHTTPTimeout),
+		HTTPAddr:         getEnv("AUTH_HTTP_ADDR", defaultHTTPAddr),
+		HTTPTimeout:      parseDuration("AUTH_HTTP_TIMEOUT", defaultHTTPTimeout),
 		TenantConfigPath: strings.TrimSpace(os.Getenv("AUTH_TENANT_CONFIG_PATH")),
+		StateStore: StateStoreConfig{
+			Backend:  strings.ToLower(getEnv("AUTH_STATE_STORE", StateStoreMemory)),
+			NATSURL:  strings.TrimSpace(os.Getenv("AUTH_NATS_URL")),
+			KVBucket: getEnv("AUTH_STATE_KV_BUCKET", defaultStateKVBucket),
+			MaxTTL:   parseDuration("AUTH_STATE_MAX_TTL", defaultStateMaxTTL),
+
+			GrantKVBucket: getEnv("AUTH_GRANT_KV_BUCKET", defaultGrantKVBucket),
+			GrantMaxTTL:   parseDuration("AUTH_GRANT_MAX_TTL", defaultGrantMaxTTL),
+
+			VaultKVBucket: getEnv("AUTH_VAULT_KV_BUCKET", defaultVaultKVBucket),
+			VaultMaxTTL:   parseDuration("AUTH_VAULT_MAX_TTL", defaultVaultMaxTTL),
+
+			WebhookKVBucket: getEnv("AUTH_WEBHOOK_KV_BUCKET", defaultWebhookBucket),
+			WebhookMaxTTL:   parseDuration("AUTH_WEBHOOK_MAX_TTL", defaultWebhookMaxTTL),
+		},
 	}
 	if cfg.TenantConfigPath == "" {
 		return AppConfig{}, errors.New("AUTH_TENANT_CONFIG_PATH is required")
@@ -33,6 +86,15 @@ func Load() (AppConfig, error) {
 	if cfg.HTTPTimeout <= 0 {
 		return AppConfig{}, errors.New("AUTH_HTTP_TIMEOUT must be positive")
 	}
+	switch cfg.StateStore.Backend {
+	case StateStoreMemory:
+	case StateStoreNATS:
+		if cfg.StateStore.NATSURL == "" {
+			return AppConfig{}, errors.New("AUTH_NATS_URL is required when AUTH_STATE_STORE=nats")
+		}
+	default:
+		return AppConfig{}, fmt.Errorf("AUTH_STATE_STORE must be %q or %q", StateStoreMemory, StateStoreNATS)
+	}
 	return cfg, nil
 }
 
@@ -0,0 +1,58 @@
+package appleuser
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidID はユーザーIDが不正な場合に返される。
+	ErrInvalidID = errors.New("appleuser: invalid id")
+)
+
+// ID はAppleユーザー（id_tokenのsub）を識別するための値オブジェクト。
+type ID string
+
+// NewID は空でないIDを生成する。
+func NewID(v string) (ID, error) {
+	id := ID(strings.TrimSpace(v))
+	if id == "" {
+		return "", ErrInvalidID
+	}
+	return id, nil
+}
+
+// User はSign in with Appleで得られるユーザーの集約ルート。
+// 氏名は初回ログイン時にしか送られないため空の場合がある。
+type User struct {
+	id          ID
+	email       string
+	displayName string
+}
+
+// New はユーザーを生成する。
+func New(id ID, email, displayName string) (*User, error) {
+	if id == "" {
+		return nil, ErrInvalidID
+	}
+	return &User{
+		id:          id,
+		email:       strings.TrimSpace(email),
+		displayName: strings.TrimSpace(displayName),
+	}, nil
+}
+
+// ID はユーザーIDを返す。
+func (u *User) ID() ID {
+	return u.id
+}
+
+// Email はメールアドレス（プライベートリレーの場合あり）を返す。
+func (u *User) Email() string {
+	return u.email
+}
+
+// DisplayName は表示名を返す。
+func (u *User) DisplayName() string {
+	return u.displayName
+}
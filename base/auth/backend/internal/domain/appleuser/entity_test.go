@@ -0,0 +1,44 @@
+package appleuser
+
+import "testing"
+
+// NewID/Newのバリデーションをテーブル駆動で検証。
+func TestAppleUserValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		id          string
+		email       string
+		displayName string
+		wantErr     bool
+	}{
+		{"OK", "001234.abcd.0123", "user@privaterelay.appleid.com", "Taro Yamada", false},
+		{"氏名なしでもOK", "001234.abcd.0123", "", "", false},
+		{"空IDでエラー", " ", "", "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			id, err := NewID(tt.id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			u, err := New(id, tt.email, tt.displayName)
+			if err != nil {
+				t.Fatalf("New error: %v", err)
+			}
+			if u.Email() != tt.email || u.DisplayName() != tt.displayName {
+				t.Fatalf("unexpected user: %+v", u)
+			}
+		})
+	}
+}
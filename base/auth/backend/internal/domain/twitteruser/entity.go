@@ -28,6 +28,8 @@ type User struct {
 	username    string
 	displayName string
 	avatarURL   string
+	// attributes はテナント設定で追加取得したプロフィール項目（上流APIのフィールド名がキー）。
+	attributes map[string]any
 }
 
 // New はユーザーを生成する。
@@ -62,3 +64,18 @@ func (u *User) DisplayName() string {
 func (u *User) AvatarURL() string {
 	return u.avatarURL
 }
+
+// WithAttributes は追加のプロフィール項目を持つコピーを返す。
+func (u *User) WithAttributes(attrs map[string]any) *User {
+	cp := *u
+	cp.attributes = make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		cp.attributes[k] = v
+	}
+	return &cp
+}
+
+// Attributes は追加のプロフィール項目を返す。未設定ならnil。
+func (u *User) Attributes() map[string]any {
+	return u.attributes
+}
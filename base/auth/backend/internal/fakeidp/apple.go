@@ -0,0 +1,196 @@
+package fakeidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+const (
+	providerApple    = "apple"
+	defaultAppleUser = "000001.fakeidp.0001"
+	appleTokenTTL    = 3600
+)
+
+// formPostTemplate は response_mode=form_post の自動送信フォーム。ブラウザを使わないテストは hidden の値を読んでPOSTする。
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $k, $v := .Fields}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}</form>
+</body></html>
+`))
+
+// handleAppleAuthorize はSign in with Appleの認可画面の代わりに、form_postでredirect_uriへ戻す。
+// キャンセル時のAppleは error=user_cancelled_authorize を送る。初回の同意時だけ user（氏名・メール）を付ける。
+func (s *Server) handleAppleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	clientID := q.Get("client_id")
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("response_type") != "code" || q.Get("response_mode") != "form_post" || !s.knownClient(clientID) || !validRedirectURI(redirectURI) {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{"state": q.Get("state")}
+	switch action := q.Get(ParamAction); action {
+	case ActionCancel:
+		fields["error"] = "user_cancelled_authorize"
+	case ActionError:
+		fields["error"] = "invalid_request"
+	default:
+		userID := q.Get(ParamUser)
+		if userID == "" {
+			userID = defaultAppleUser
+		}
+		code, err := s.issueCode(action, grant{
+			provider:    providerApple,
+			clientID:    clientID,
+			redirectURI: redirectURI,
+			scope:       q.Get("scope"),
+			nonce:       q.Get("nonce"),
+			userID:      userID,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fields["code"] = code
+		if s.firstConsent(providerApple, clientID, userID) && strings.Contains(q.Get("scope"), "name") {
+			user, _ := json.Marshal(map[string]any{
+				"name":  map[string]string{"firstName": "Fake", "lastName": "User"},
+				"email": appleEmail(userID),
+			})
+			fields["user"] = string(user)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = formPostTemplate.Execute(w, struct {
+		Action string
+		Fields map[string]string
+	}{Action: redirectURI, Fields: fields})
+}
+
+// handleAppleToken は認可コードをアクセストークンとRS256署名のid_tokenに交換する。
+// client_secret はES256のJWTで、sub が client_id と一致することだけを確認する（署名は検証しない）。
+func (s *Server) handleAppleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if !s.knownClient(clientID) || !validAppleClientSecret(r.PostForm.Get("client_secret"), clientID) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	g, ok := s.takeCode(providerApple, r.PostForm.Get("code"))
+	if !ok || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "The code has expired or has been revoked.")
+		return
+	}
+
+	a := account{provider: providerApple, clientID: clientID, userID: g.userID, scope: g.scope}
+	accessToken, refreshToken, err := s.issueTokens(a, true)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	now := s.now()
+	claims := map[string]any{
+		"iss":            s.AppleIssuer(),
+		"aud":            clientID,
+		"sub":            g.userID,
+		"iat":            now.Unix(),
+		"exp":            now.Unix() + 600,
+		"email":          appleEmail(g.userID),
+		"email_verified": "true",
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	idToken, err := s.signRS256(claims)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    appleTokenTTL,
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+	})
+}
+
+// handleAppleKeys はid_tokenの検証用JWKSを返す。
+func (s *Server) handleAppleKeys(w http.ResponseWriter, _ *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) signRS256(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// validAppleClientSecret はclient secret JWTの形式と sub を確認する。
+func validAppleClientSecret(secret, clientID string) bool {
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil || header.Alg != "ES256" {
+		return false
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(rawClaims, &claims) != nil {
+		return false
+	}
+	return claims.Sub == clientID
+}
+
+func appleEmail(userID string) string {
+	return strings.ReplaceAll(userID, ".", "-") + "@privaterelay.appleid.com"
+}
@@ -0,0 +1,118 @@
+package fakeidp
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	providerLine    = "line"
+	defaultLineUser = "Ufakeidp0001"
+	lineTokenTTL    = 2592000
+)
+
+// handleLineAuthorize はLINEログインの認可画面の代わりに、即座にredirect_uriへ戻す。
+// キャンセル時のLINEは error=access_denied と error_description を返す。
+func (s *Server) handleLineAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	clientID := q.Get("client_id")
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("response_type") != "code" || !s.knownClient(clientID) || !validRedirectURI(redirectURI) {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("state", q.Get("state"))
+	switch action := q.Get(ParamAction); action {
+	case ActionCancel:
+		params.Set("error", "access_denied")
+		params.Set("error_description", "The user has denied the authorization request.")
+	case ActionError:
+		params.Set("error", "server_error")
+		params.Set("error_description", "fakeidp simulated error")
+	default:
+		userID := q.Get(ParamUser)
+		if userID == "" {
+			userID = defaultLineUser
+		}
+		code, err := s.issueCode(action, grant{
+			provider:    providerLine,
+			clientID:    clientID,
+			redirectURI: redirectURI,
+			scope:       q.Get("scope"),
+			userID:      userID,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params.Set("code", code)
+	}
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// handleLineToken は authorization_code と refresh_token のグラントに応答する。
+// LINEと同じく client_id・client_secret をフォームで受け取る。
+func (s *Server) handleLineToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	secret, ok := s.clients[clientID]
+	if !ok || secret == "" || r.PostForm.Get("client_secret") != secret {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "invalid client_id or client_secret")
+		return
+	}
+
+	var a account
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		g, ok := s.takeCode(providerLine, r.PostForm.Get("code"))
+		if !ok || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+			return
+		}
+		a = account{provider: providerLine, clientID: clientID, userID: g.userID, scope: g.scope}
+	case "refresh_token":
+		a, ok = s.takeRefresh(providerLine, clientID, r.PostForm.Get("refresh_token"))
+		if !ok {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	accessToken, refreshToken, err := s.issueTokens(a, true)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token":  accessToken,
+		"expires_in":    lineTokenTTL,
+		"refresh_token": refreshToken,
+		"scope":         a.scope,
+		"token_type":    "Bearer",
+	})
+}
+
+// handleLineProfile は /v2/profile と同じ形でプロフィールを返す。
+func (s *Server) handleLineProfile(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.bearerAccount(r, providerLine)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "The access token expired or is invalid")
+		return
+	}
+	writeJSON(w, map[string]any{
+		"userId":        a.userID,
+		"displayName":   "Fake " + strings.TrimPrefix(a.userID, "U"),
+		"pictureUrl":    "https://profile.line-scdn.net/fakeidp/" + a.userID,
+		"statusMessage": "fakeidp user",
+	})
+}
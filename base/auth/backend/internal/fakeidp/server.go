@@ -0,0 +1,271 @@
+package fakeidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// 認可エンドポイントのクエリで応答を切り替えるパラメータ。
+// auth が組み立てた認可URLに付け足して使う（ブラウザを使わないテストでは画面操作の代わりになる）。
+const (
+	// ParamAction は approve（既定）・cancel・error・invalid_code のいずれか。
+	ParamAction = "fakeidp_action"
+	// ParamUser はログインさせるユーザーID。省略時はプロバイダごとの既定ユーザー。
+	ParamUser = "fakeidp_user"
+)
+
+// ParamAction の値。
+const (
+	ActionApprove     = "approve"
+	ActionCancel      = "cancel"
+	ActionError       = "error"
+	ActionInvalidCode = "invalid_code"
+)
+
+const (
+	codeTTL        = 5 * time.Minute
+	accessTokenTTL = time.Hour
+)
+
+// Config は偽IdPの設定。
+type Config struct {
+	// BaseURL は偽IdPを公開するURL（例: http://localhost:9090）。Appleのissuerに使う。
+	BaseURL string
+	// Clients は登録済みクライアント（client_id → client_secret）。secret が空なら公開クライアント。
+	Clients map[string]string
+}
+
+// Server はLINE・X・Sign in with Apple（OIDC）の認可・トークン・プロフィールAPIを模倣するHTTPサーバー。
+// 状態はすべてメモリに持ち、プロセスを再起動すると消える。
+type Server struct {
+	baseURL string
+	clients map[string]string
+	key     *rsa.PrivateKey
+	keyID   string
+	now     func() time.Time
+
+	mu       sync.Mutex
+	codes    map[string]grant
+	tokens   map[string]account
+	refresh  map[string]account
+	consents map[string]struct{}
+}
+
+// grant は発行済みの認可コードに紐づく情報。
+type grant struct {
+	provider      string
+	clientID      string
+	redirectURI   string
+	scope         string
+	codeChallenge string
+	nonce         string
+	userID        string
+	expiresAt     time.Time
+}
+
+// account はアクセストークン・リフレッシュトークンに紐づくユーザー。
+type account struct {
+	provider  string
+	clientID  string
+	userID    string
+	scope     string
+	expiresAt time.Time
+}
+
+// New は偽IdPを生成する。id_token の署名鍵は起動ごとに生成する。
+func New(cfg Config) (*Server, error) {
+	base := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if _, err := url.ParseRequestURI(base); err != nil || base == "" {
+		return nil, fmt.Errorf("fakeidp: base URL must be absolute: %q", cfg.BaseURL)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("fakeidp: generate signing key: %w", err)
+	}
+	clients := make(map[string]string, len(cfg.Clients))
+	for id, secret := range cfg.Clients {
+		clients[id] = secret
+	}
+	return &Server{
+		baseURL:  base,
+		clients:  clients,
+		key:      key,
+		keyID:    "fakeidp",
+		now:      func() time.Time { return time.Now().UTC() },
+		codes:    map[string]grant{},
+		tokens:   map[string]account{},
+		refresh:  map[string]account{},
+		consents: map[string]struct{}{},
+	}, nil
+}
+
+// AppleIssuer はid_tokenの iss に入れる値（テナント設定の apple.endpoints.issuer に指定する）。
+func (s *Server) AppleIssuer() string {
+	return s.baseURL + "/apple"
+}
+
+// Handler はルーティング済みのHTTPハンドラを返す。
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+	r.Get("/line/authorize", s.handleLineAuthorize)
+	r.Post("/line/token", s.handleLineToken)
+	r.Get("/line/profile", s.handleLineProfile)
+	r.Get("/twitter/authorize", s.handleTwitterAuthorize)
+	r.Post("/twitter/token", s.handleTwitterToken)
+	r.Get("/twitter/users/me", s.handleTwitterProfile)
+	r.Get("/apple/authorize", s.handleAppleAuthorize)
+	r.Post("/apple/token", s.handleAppleToken)
+	r.Get("/apple/keys", s.handleAppleKeys)
+	return r
+}
+
+// issueCode は認可コードを発行する。invalid_code の場合は記録せず、トークン交換で失敗するコードを返す。
+func (s *Server) issueCode(action string, g grant) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if action == ActionInvalidCode {
+		return "invalid-" + code, nil
+	}
+	g.expiresAt = s.now().Add(codeTTL)
+	s.mu.Lock()
+	s.codes[code] = g
+	s.mu.Unlock()
+	return code, nil
+}
+
+// takeCode は認可コードを1回だけ取り出す。
+func (s *Server) takeCode(provider, code string) (grant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	if !ok || g.provider != provider || !s.now().Before(g.expiresAt) {
+		return grant{}, false
+	}
+	return g, true
+}
+
+// issueTokens はアクセストークンと、必要ならリフレッシュトークンを発行する。
+func (s *Server) issueTokens(a account, withRefresh bool) (accessToken, refreshToken string, err error) {
+	accessToken, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	a.expiresAt = s.now().Add(accessTokenTTL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[accessToken] = a
+	if withRefresh {
+		refreshToken, err = randomToken()
+		if err != nil {
+			return "", "", err
+		}
+		s.refresh[refreshToken] = a
+	}
+	return accessToken, refreshToken, nil
+}
+
+// takeRefresh はリフレッシュトークンを1回だけ取り出す（X と同じく使い捨て）。
+func (s *Server) takeRefresh(provider, clientID, token string) (account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.refresh[token]
+	if !ok || a.provider != provider || a.clientID != clientID {
+		return account{}, false
+	}
+	delete(s.refresh, token)
+	return a, true
+}
+
+// bearerAccount はAuthorizationヘッダのアクセストークンに紐づくユーザーを返す。
+func (s *Server) bearerAccount(r *http.Request, provider string) (account, bool) {
+	raw := r.Header.Get("Authorization")
+	if len(raw) < 7 || !strings.EqualFold(raw[:7], "Bearer ") {
+		return account{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.tokens[strings.TrimSpace(raw[7:])]
+	if !ok || a.provider != provider || !s.now().Before(a.expiresAt) {
+		return account{}, false
+	}
+	return a, true
+}
+
+// firstConsent はクライアントとユーザーの組で初回の同意かを返す（Appleは初回だけ氏名を送る）。
+func (s *Server) firstConsent(provider, clientID, userID string) bool {
+	key := provider + "\x00" + clientID + "\x00" + userID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.consents[key]; ok {
+		return false
+	}
+	s.consents[key] = struct{}{}
+	return true
+}
+
+// knownClient は client_id が登録済みかを返す。
+func (s *Server) knownClient(clientID string) bool {
+	_, ok := s.clients[clientID]
+	return ok
+}
+
+// redirectWithParams はredirect_uriにクエリを付けてリダイレクトする。
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := target.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// writeOAuthError はRFC 6749 5.2 形式のエラーを返す。
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// validRedirectURI はredirect_uriが絶対URLかを確認する。
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("fakeidp: generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
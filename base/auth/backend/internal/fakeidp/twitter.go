@@ -0,0 +1,162 @@
+package fakeidp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	providerTwitter    = "twitter"
+	defaultTwitterUser = "1000000001"
+	twitterTokenTTL    = 7200
+)
+
+// handleTwitterAuthorize はXの認可画面の代わりに、即座にredirect_uriへ戻す。PKCE（S256）を必須にする。
+func (s *Server) handleTwitterAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	clientID := q.Get("client_id")
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("response_type") != "code" || !s.knownClient(clientID) || !validRedirectURI(redirectURI) ||
+		q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("state", q.Get("state"))
+	switch action := q.Get(ParamAction); action {
+	case ActionCancel:
+		params.Set("error", "access_denied")
+	case ActionError:
+		params.Set("error", "server_error")
+		params.Set("error_description", "fakeidp simulated error")
+	default:
+		userID := q.Get(ParamUser)
+		if userID == "" {
+			userID = defaultTwitterUser
+		}
+		code, err := s.issueCode(action, grant{
+			provider:      providerTwitter,
+			clientID:      clientID,
+			redirectURI:   redirectURI,
+			scope:         q.Get("scope"),
+			codeChallenge: q.Get("code_challenge"),
+			userID:        userID,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		params.Set("code", code)
+	}
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// handleTwitterToken は authorization_code と refresh_token のグラントに応答する。
+// 機密クライアントはBasic認証、公開クライアントは client_id のみで認証する。
+// リフレッシュトークンは offline.access スコープがある場合だけ発行し、使い捨てにする。
+func (s *Server) handleTwitterToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form")
+		return
+	}
+	clientID, ok := s.authenticateTwitterClient(r)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "unauthorized_client", "Missing valid authorization header")
+		return
+	}
+
+	var a account
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		g, ok := s.takeCode(providerTwitter, r.PostForm.Get("code"))
+		if !ok || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Value passed for the authorization code was invalid.")
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Value passed for the code verifier did not match.")
+			return
+		}
+		a = account{provider: providerTwitter, clientID: clientID, userID: g.userID, scope: g.scope}
+	case "refresh_token":
+		a, ok = s.takeRefresh(providerTwitter, clientID, r.PostForm.Get("refresh_token"))
+		if !ok {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Value passed for the token was invalid.")
+			return
+		}
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	offline := containsScope(a.scope, "offline.access")
+	accessToken, refreshToken, err := s.issueTokens(a, offline)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	res := map[string]any{
+		"token_type":   "bearer",
+		"expires_in":   twitterTokenTTL,
+		"access_token": accessToken,
+		"scope":        a.scope,
+	}
+	if refreshToken != "" {
+		res["refresh_token"] = refreshToken
+	}
+	writeJSON(w, res)
+}
+
+func (s *Server) authenticateTwitterClient(r *http.Request) (string, bool) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		expected, known := s.clients[id]
+		return id, known && expected != "" && secret == expected
+	}
+	id := r.PostForm.Get("client_id")
+	secret, known := s.clients[id]
+	return id, known && secret == ""
+}
+
+// handleTwitterProfile は /2/users/me と同じ形でプロフィールを返す。user.fields で要求された追加項目も返す。
+func (s *Server) handleTwitterProfile(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.bearerAccount(r, providerTwitter)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`))
+		return
+	}
+	data := map[string]any{
+		"id":       a.userID,
+		"name":     "Fake " + a.userID,
+		"username": "fake_" + a.userID,
+	}
+	for _, field := range strings.Split(r.URL.Query().Get("user.fields"), ",") {
+		switch strings.TrimSpace(field) {
+		case "profile_image_url":
+			data["profile_image_url"] = "https://pbs.twimg.com/profile_images/fakeidp/" + a.userID + "_normal.jpg"
+		case "verified":
+			data["verified"] = false
+		case "created_at":
+			data["created_at"] = "2020-01-01T00:00:00.000Z"
+		case "public_metrics":
+			data["public_metrics"] = map[string]int{"followers_count": 42, "following_count": 7, "tweet_count": 100, "listed_count": 0}
+		}
+	}
+	writeJSON(w, map[string]any{"data": data})
+}
+
+func containsScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package apple
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/appleuser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/applelogin"
+)
+
+// Config はAppleクライアントの設定。エンドポイントはテスト用のスタンドインサーバーに差し替えられる。
+type Config struct {
+	ClientID          string
+	TeamID            string
+	KeyID             string
+	PrivateKey        *ecdsa.PrivateKey
+	RedirectURI       string
+	Scopes            []string
+	Issuer            string
+	AuthorizeEndpoint string
+	TokenEndpoint     string
+	JWKSEndpoint      string
+	// ClientSecretTTL はclient secret JWTの有効期間（Appleの上限は6か月）。
+	ClientSecretTTL time.Duration
+	// JWKSCacheTTL は公開鍵セットのキャッシュ期間。
+	JWKSCacheTTL time.Duration
+}
+
+// Client はSign in with Apple の呼び出しを担当するHTTPクライアント。
+type Client struct {
+	httpClient        *http.Client
+	clientID          string
+	redirectURI       string
+	scopes            []string
+	issuer            string
+	authorizeEndpoint string
+	tokenEndpoint     string
+	secrets           *clientSecretSigner
+	keys              *jwksCache
+	now               func() time.Time
+}
+
+// NewClient はAppleクライアントを初期化する。
+func NewClient(httpClient *http.Client, cfg Config) *Client {
+	secretTTL := cfg.ClientSecretTTL
+	if secretTTL <= 0 {
+		secretTTL = 24 * time.Hour
+	}
+	jwksTTL := cfg.JWKSCacheTTL
+	if jwksTTL <= 0 {
+		jwksTTL = time.Hour
+	}
+	clientID := strings.TrimSpace(cfg.ClientID)
+	return &Client{
+		httpClient:        httpClient,
+		clientID:          clientID,
+		redirectURI:       strings.TrimSpace(cfg.RedirectURI),
+		scopes:            append([]string(nil), cfg.Scopes...),
+		issuer:            strings.TrimSpace(cfg.Issuer),
+		authorizeEndpoint: strings.TrimSpace(cfg.AuthorizeEndpoint),
+		tokenEndpoint:     strings.TrimSpace(cfg.TokenEndpoint),
+		secrets:           newClientSecretSigner(strings.TrimSpace(cfg.TeamID), strings.TrimSpace(cfg.KeyID), clientID, cfg.PrivateKey, secretTTL),
+		keys:              newJWKSCache(httpClient, strings.TrimSpace(cfg.JWKSEndpoint), jwksTTL),
+		now:               func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// BuildAuthorizeURL はresponse_mode=form_post の認可URLを生成する。
+func (c *Client) BuildAuthorizeURL(state, nonce string) string {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("response_mode", "form_post")
+	values.Set("client_id", c.clientID)
+	values.Set("redirect_uri", c.redirectURI)
+	values.Set("scope", strings.Join(c.scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+
+	return fmt.Sprintf("%s?%s", strings.TrimRight(c.authorizeEndpoint, "/"), values.Encode())
+}
+
+// ExchangeToken はauthorization code をclient secret JWTと共に送りトークンを取得する。
+func (c *Client) ExchangeToken(ctx context.Context, code string) (*applelogin.Token, error) {
+	secret, err := c.secrets.Secret()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.redirectURI)
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", secret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("apple token: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("apple token: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("apple token: read response: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("apple token: status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("apple token: decode response: %w", err)
+	}
+	if parsed.IDToken == "" {
+		return nil, errors.New("apple token: missing id_token")
+	}
+
+	return &applelogin.Token{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		IDToken:      parsed.IDToken,
+		TokenType:    parsed.TokenType,
+		ExpiresIn:    parsed.ExpiresIn,
+	}, nil
+}
+
+// VerifyIDToken はid_tokenをAppleのJWKSで検証し、クレームを返す。
+func (c *Client) VerifyIDToken(ctx context.Context, idToken, nonce string) (*applelogin.IDTokenClaims, error) {
+	claims, err := verifyIDToken(ctx, c.keys, idToken, c.issuer, c.clientID, nonce, c.now())
+	if err != nil {
+		return nil, err
+	}
+	sub, err := appleuser.NewID(claims.Sub)
+	if err != nil {
+		return nil, err
+	}
+	return &applelogin.IDTokenClaims{
+		Subject:        sub,
+		Email:          claims.Email,
+		EmailVerified:  bool(claims.EmailVerified),
+		IsPrivateEmail: bool(claims.IsPrivateEmail),
+	}, nil
+}
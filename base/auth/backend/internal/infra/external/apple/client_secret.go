@@ -0,0 +1,108 @@
+package apple
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// appleAudience はclient secret JWTのaudに入れる固定値。
+const appleAudience = "https://appleid.apple.com"
+
+// ParsePrivateKey はApple Developerから取得した .p8（PKCS#8 PEM）をECDSA鍵として読み込む。
+func ParsePrivateKey(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("apple: private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("apple: parse private key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apple: private key is not ECDSA")
+	}
+	return key, nil
+}
+
+// clientSecretSigner はES256で署名したclient secret JWTを生成し、期限まで使い回す。
+type clientSecretSigner struct {
+	teamID   string
+	keyID    string
+	clientID string
+	key      *ecdsa.PrivateKey
+	lifetime time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	cached    string
+	expiresAt time.Time
+}
+
+func newClientSecretSigner(teamID, keyID, clientID string, key *ecdsa.PrivateKey, lifetime time.Duration) *clientSecretSigner {
+	return &clientSecretSigner{
+		teamID:   teamID,
+		keyID:    keyID,
+		clientID: clientID,
+		key:      key,
+		lifetime: lifetime,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Secret はキャッシュ済みのclient secretを返す。期限の1分前を過ぎていれば作り直す。
+func (s *clientSecretSigner) Secret() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.cached != "" && now.Add(time.Minute).Before(s.expiresAt) {
+		return s.cached, nil
+	}
+
+	expiresAt := now.Add(s.lifetime)
+	header := map[string]any{
+		"alg": "ES256",
+		"kid": s.keyID,
+	}
+	payload := map[string]any{
+		"iss": s.teamID,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+		"aud": appleAudience,
+		"sub": s.clientID,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("apple client secret: marshal header: %w", err)
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("apple client secret: marshal payload: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("apple client secret: sign: %w", err)
+	}
+
+	// JWSのES256署名は r||s をそれぞれ32バイト固定長で連結する。
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	s.cached = unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	s.expiresAt = expiresAt
+	return s.cached, nil
+}
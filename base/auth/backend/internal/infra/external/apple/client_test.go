@@ -0,0 +1,210 @@
+package apple
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeApple はトークン・JWKSエンドポイントを模したローカルのスタンドインサーバー。
+type fakeApple struct {
+	t         *testing.T
+	server    *httptest.Server
+	signKey   *rsa.PrivateKey
+	secretKey *ecdsa.PublicKey
+	nonce     string
+	kid       string
+	secrets   []string
+}
+
+func newFakeApple(t *testing.T, secretKey *ecdsa.PublicKey) *fakeApple {
+	t.Helper()
+	signKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa: %v", err)
+	}
+	f := &fakeApple{t: t, signKey: signKey, secretKey: secretKey, kid: "test-kid"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/keys", f.handleKeys)
+	mux.HandleFunc("/auth/token", f.handleToken)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeApple) handleKeys(w http.ResponseWriter, r *http.Request) {
+	pub := f.signKey.PublicKey
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-kid",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (f *fakeApple) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	secret := r.PostForm.Get("client_secret")
+	if !verifyES256(secret, f.secretKey) {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusBadRequest)
+		return
+	}
+	f.secrets = append(f.secrets, secret)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "apple-at",
+		"refresh_token": "apple-rt",
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+		"id_token":      f.idToken(),
+	})
+}
+
+func (f *fakeApple) idToken() string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": f.kid})
+	payload, _ := json.Marshal(map[string]any{
+		"iss":              "https://appleid.apple.com",
+		"aud":              "com.example.web",
+		"sub":              "001234.abcd.0123",
+		"iat":              time.Now().Unix(),
+		"exp":              time.Now().Add(10 * time.Minute).Unix(),
+		"nonce":            f.nonce,
+		"email":            "user@privaterelay.appleid.com",
+		"email_verified":   "true",
+		"is_private_email": "true",
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.signKey, crypto.SHA256, digest[:])
+	if err != nil {
+		f.t.Fatalf("sign id_token: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func verifyES256(token string, key *ecdsa.PublicKey) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+// トークン交換とid_token検証をスタンドインサーバーでテーブル駆動検証する。
+func TestClient_ExchangeAndVerify(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("marshal p8: %v", err)
+	}
+	parsedKey, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("parse p8: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		serverNonce string
+		wantNonce   string
+		kid         string
+		wantErr     bool
+	}{
+		{name: "正常", serverNonce: "n1", wantNonce: "n1", kid: "test-kid"},
+		{name: "nonce不一致", serverNonce: "other", wantNonce: "n1", kid: "test-kid", wantErr: true},
+		{name: "未知のkid", serverNonce: "n1", wantNonce: "n1", kid: "rotated", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fake := newFakeApple(t, &ecKey.PublicKey)
+			fake.nonce = tt.serverNonce
+			fake.kid = tt.kid
+
+			client := NewClient(fake.server.Client(), Config{
+				ClientID:          "com.example.web",
+				TeamID:            "TEAM123456",
+				KeyID:             "KEY1234567",
+				PrivateKey:        parsedKey,
+				RedirectURI:       "https://tenant.auth.example.com/apple/callback",
+				Scopes:            []string{"name", "email"},
+				Issuer:            "https://appleid.apple.com",
+				AuthorizeEndpoint: fake.server.URL + "/auth/authorize",
+				TokenEndpoint:     fake.server.URL + "/auth/token",
+				JWKSEndpoint:      fake.server.URL + "/auth/keys",
+			})
+
+			tok, err := client.ExchangeToken(context.Background(), "code")
+			if err != nil {
+				t.Fatalf("ExchangeToken: %v", err)
+			}
+			claims, err := client.VerifyIDToken(context.Background(), tok.IDToken, tt.wantNonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got claims %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyIDToken: %v", err)
+			}
+			if claims.Subject != "001234.abcd.0123" || !claims.EmailVerified || !claims.IsPrivateEmail {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+
+			// client secret はキャッシュされ、2回目も同じ値が送られる。
+			if _, err := client.ExchangeToken(context.Background(), "code2"); err != nil {
+				t.Fatalf("second ExchangeToken: %v", err)
+			}
+			if len(fake.secrets) != 2 || fake.secrets[0] != fake.secrets[1] {
+				t.Fatalf("client secret not cached")
+			}
+		})
+	}
+}
+
+func TestClient_BuildAuthorizeURL(t *testing.T) {
+	t.Parallel()
+	client := NewClient(http.DefaultClient, Config{
+		ClientID:          "com.example.web",
+		RedirectURI:       "https://tenant.auth.example.com/apple/callback",
+		Scopes:            []string{"name", "email"},
+		AuthorizeEndpoint: "https://appleid.apple.com/auth/authorize",
+	})
+	got := client.BuildAuthorizeURL("st", "nc")
+	for _, want := range []string{"response_mode=form_post", "state=st", "nonce=nc", "scope=name+email"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("authorize URL %q missing %q", got, want)
+		}
+	}
+}
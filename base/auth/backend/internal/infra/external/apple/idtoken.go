@@ -0,0 +1,205 @@
+package apple
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// errUnknownKey はid_tokenのkidがJWKSに存在しない場合に返す。
+	errUnknownKey = errors.New("apple id_token: unknown kid")
+)
+
+// jwksCache はAppleの公開鍵セットを取得し、一定時間キャッシュする。
+type jwksCache struct {
+	httpClient *http.Client
+	endpoint   string
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKSCache(httpClient *http.Client, endpoint string, ttl time.Duration) *jwksCache {
+	return &jwksCache{
+		httpClient: httpClient,
+		endpoint:   endpoint,
+		ttl:        ttl,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Key はkidに対応する公開鍵を返す。キャッシュにない場合は鍵ローテーションを考慮して再取得する。
+func (c *jwksCache) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fresh := c.keys != nil && c.now().Sub(c.fetchedAt) < c.ttl
+	if fresh {
+		if key, ok := c.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("apple jwks: create request: %w", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("apple jwks: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("apple jwks: read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("apple jwks: status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return fmt.Errorf("apple jwks: decode response: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	c.keys = keys
+	c.fetchedAt = c.now()
+	return nil
+}
+
+// idTokenClaims はAppleのid_tokenに含まれるクレーム。
+// email_verified / is_private_email は文字列 "true" で来ることがあるため flexBool で受ける。
+type idTokenClaims struct {
+	Iss            string   `json:"iss"`
+	Aud            string   `json:"aud"`
+	Sub            string   `json:"sub"`
+	Exp            int64    `json:"exp"`
+	Iat            int64    `json:"iat"`
+	Nonce          string   `json:"nonce"`
+	Email          string   `json:"email"`
+	EmailVerified  flexBool `json:"email_verified"`
+	IsPrivateEmail flexBool `json:"is_private_email"`
+}
+
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// verifyIDToken はRS256署名・iss・aud・exp・nonceを検証してクレームを返す。
+func verifyIDToken(ctx context.Context, keys *jwksCache, idToken, issuer, audience, nonce string, now time.Time) (*idTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("apple id_token: malformed")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("apple id_token: decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("apple id_token: parse header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("apple id_token: unexpected alg %q", header.Alg)
+	}
+
+	key, err := keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("apple id_token: decode signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("apple id_token: invalid signature: %w", err)
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("apple id_token: decode payload: %w", err)
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, fmt.Errorf("apple id_token: parse payload: %w", err)
+	}
+
+	if claims.Iss != issuer {
+		return nil, fmt.Errorf("apple id_token: unexpected iss %q", claims.Iss)
+	}
+	if claims.Aud != audience {
+		return nil, fmt.Errorf("apple id_token: unexpected aud %q", claims.Aud)
+	}
+	if now.Unix() >= claims.Exp {
+		return nil, errors.New("apple id_token: expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("apple id_token: nonce mismatch")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,208 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/discorduser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/discordlogin"
+)
+
+// Client はDiscord OAuth2 / API 呼び出しを担当するHTTPクライアント。
+type Client struct {
+	httpClient        *http.Client
+	clientID          string
+	clientSecret      string
+	redirectURI       string
+	authorizeEndpoint string
+	tokenEndpoint     string
+	apiBaseURL        string
+	cdnBaseURL        string
+	scopes            []string
+}
+
+// NewClient はDiscord API クライアントを初期化する。
+// apiBaseURL は https://discord.com/api/v10 のようなREST APIのベースURL。
+func NewClient(
+	httpClient *http.Client,
+	clientID string,
+	clientSecret string,
+	redirectURI string,
+	authorizeEndpoint string,
+	tokenEndpoint string,
+	apiBaseURL string,
+	cdnBaseURL string,
+	scopes []string,
+) *Client {
+	return &Client{
+		httpClient:        httpClient,
+		clientID:          strings.TrimSpace(clientID),
+		clientSecret:      strings.TrimSpace(clientSecret),
+		redirectURI:       strings.TrimSpace(redirectURI),
+		authorizeEndpoint: strings.TrimSpace(authorizeEndpoint),
+		tokenEndpoint:     strings.TrimSpace(tokenEndpoint),
+		apiBaseURL:        strings.TrimRight(strings.TrimSpace(apiBaseURL), "/"),
+		cdnBaseURL:        strings.TrimRight(strings.TrimSpace(cdnBaseURL), "/"),
+		scopes:            append([]string(nil), scopes...),
+	}
+}
+
+// BuildAuthorizeURL はstateを含めた認可URLを生成する。
+func (c *Client) BuildAuthorizeURL(state string) string {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", c.clientID)
+	values.Set("redirect_uri", c.redirectURI)
+	values.Set("scope", strings.Join(c.scopes, " "))
+	values.Set("state", state)
+
+	return fmt.Sprintf("%s?%s", strings.TrimRight(c.authorizeEndpoint, "/"), values.Encode())
+}
+
+// ExchangeToken はauthorization code を使ってトークンを取得する。
+func (c *Client) ExchangeToken(ctx context.Context, code string) (*discordlogin.Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.redirectURI)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("discord token: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discord token: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("discord token: read response: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("discord token: status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("discord token: decode response: %w", err)
+	}
+	if parsed.AccessToken == "" {
+		return nil, errors.New("discord token: missing access_token")
+	}
+
+	return &discordlogin.Token{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		TokenType:    parsed.TokenType,
+		ExpiresIn:    parsed.ExpiresIn,
+		Scope:        parsed.Scope,
+	}, nil
+}
+
+// FetchProfile は /users/@me からプロフィールを取得する。
+func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*discordlogin.Profile, error) {
+	body, status, err := c.get(ctx, c.apiBaseURL+"/users/@me", accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("discord profile: %w", err)
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("discord profile: status %d: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Avatar     string `json:"avatar"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("discord profile: decode response: %w", err)
+	}
+
+	did, err := discorduser.NewID(payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := payload.GlobalName
+	if displayName == "" {
+		displayName = payload.Username
+	}
+
+	return &discordlogin.Profile{
+		ID:          did,
+		DisplayName: displayName,
+		Username:    payload.Username,
+		AvatarURL:   c.avatarURL(payload.ID, payload.Avatar),
+	}, nil
+}
+
+// FetchGuildMember は /users/@me/guilds/{guild.id}/member からギルドメンバー情報を取得する。
+// guilds.members.read スコープが必要で、未参加の場合は ErrNotGuildMember を返す。
+func (c *Client) FetchGuildMember(ctx context.Context, accessToken, guildID string) (*discordlogin.GuildMember, error) {
+	endpoint := c.apiBaseURL + "/users/@me/guilds/" + url.PathEscape(guildID) + "/member"
+	body, status, err := c.get(ctx, endpoint, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("discord guild member: %w", err)
+	}
+	if status == http.StatusNotFound {
+		return nil, discordlogin.ErrNotGuildMember
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("discord guild member: status %d: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("discord guild member: decode response: %w", err)
+	}
+	return &discordlogin.GuildMember{Roles: payload.Roles}, nil
+}
+
+func (c *Client) get(ctx context.Context, endpoint, accessToken string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, 0, fmt.Errorf("read response: %w", err)
+	}
+	return body, res.StatusCode, nil
+}
+
+// avatarURL はアバターハッシュからCDNのURLを組み立てる。
+func (c *Client) avatarURL(userID, avatarHash string) string {
+	if avatarHash == "" || c.cdnBaseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/avatars/%s/%s.png", c.cdnBaseURL, userID, avatarHash)
+}
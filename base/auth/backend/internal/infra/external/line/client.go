@@ -9,9 +9,11 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/linelogin"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 // Client はLINE OAuth / API 呼び出しを担当するHTTPクライアント。
@@ -25,6 +27,7 @@ type Client struct {
 	profileEndpoint   string
 	scopes            []string
 	botPrompt         string
+	profileFields     []string
 }
 
 // NewClient はLINE API クライアントを初期化する。
@@ -42,6 +45,12 @@ func NewClient(httpClient *http.Client, channelID, channelSecret, redirectURI, a
 	}
 }
 
+// WithProfileFields はプロフィールAPIの応答から Attributes に残すフィールド（statusMessage など）を指定する。
+func (c *Client) WithProfileFields(fields []string) *Client {
+	c.profileFields = append([]string(nil), fields...)
+	return c
+}
+
 func (c *Client) BuildAuthorizeURL(state string) string {
 	values := url.Values{}
 	values.Set("response_type", "code")
@@ -63,6 +72,50 @@ func (c *Client) ExchangeToken(ctx context.Context, code string) (*linelogin.Lin
 	form.Set("client_id", c.channelID)
 	form.Set("client_secret", c.channelSecret)
 
+	parsed, err := c.requestToken(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	return &linelogin.LineToken{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		ExpiresIn:    parsed.ExpiresIn,
+		TokenType:    parsed.TokenType,
+		Scope:        parsed.Scope,
+	}, nil
+}
+
+// Refresh はリフレッシュトークンでアクセストークンを更新する。
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*tokenvault.Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", c.channelID)
+	form.Set("client_secret", c.channelSecret)
+
+	parsed, err := c.requestToken(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenvault.Token{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		TokenType:    parsed.TokenType,
+		Scope:        parsed.Scope,
+		ExpiresAt:    time.Now().UTC().Add(time.Duration(parsed.ExpiresIn) * time.Second),
+	}, nil
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+func (c *Client) requestToken(ctx context.Context, form url.Values) (*tokenResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenEndpoint, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("line token: create request: %w", err)
@@ -80,26 +133,14 @@ func (c *Client) ExchangeToken(ctx context.Context, code string) (*linelogin.Lin
 		return nil, fmt.Errorf("line token: status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var parsed struct {
-		AccessToken  string `json:"access_token"`
-		ExpiresIn    int    `json:"expires_in"`
-		TokenType    string `json:"token_type"`
-		IDToken      string `json:"id_token"`
-		RefreshToken string `json:"refresh_token"`
-		Scope        string `json:"scope"`
-	}
+	var parsed tokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
 		return nil, fmt.Errorf("line token: decode response: %w", err)
 	}
 	if parsed.AccessToken == "" {
 		return nil, errors.New("line token: missing access_token")
 	}
-
-	return &linelogin.LineToken{
-		AccessToken: parsed.AccessToken,
-		ExpiresIn:   parsed.ExpiresIn,
-		TokenType:   parsed.TokenType,
-	}, nil
+	return &parsed, nil
 }
 
 func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*linelogin.LineProfile, error) {
@@ -120,13 +161,17 @@ func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*linelog
 		return nil, fmt.Errorf("line profile: status %d: %s", resp.StatusCode, string(body))
 	}
 
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("line profile: read response: %w", err)
+	}
 	var profile struct {
 		UserID        string `json:"userId"`
 		DisplayName   string `json:"displayName"`
 		PictureURL    string `json:"pictureUrl"`
 		StatusMessage string `json:"statusMessage"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+	if err := json.Unmarshal(body, &profile); err != nil {
 		return nil, fmt.Errorf("line profile: decode response: %w", err)
 	}
 	lineID, err := lineuser.NewID(profile.UserID)
@@ -134,9 +179,28 @@ func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*linelog
 		return nil, err
 	}
 
-	return &linelogin.LineProfile{
+	result := &linelogin.LineProfile{
 		ID:          lineID,
 		DisplayName: profile.DisplayName,
 		AvatarURL:   profile.PictureURL,
-	}, nil
+	}
+	if len(c.profileFields) > 0 {
+		var raw map[string]any
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("line profile: decode response: %w", err)
+		}
+		result.Attributes = pickFields(raw, c.profileFields)
+	}
+	return result, nil
+}
+
+// pickFields は fields に含まれるキーだけを取り出す。
+func pickFields(raw map[string]any, fields []string) map[string]any {
+	picked := make(map[string]any, len(fields))
+	for _, f := range fields {
+		if v, ok := raw[f]; ok {
+			picked[f] = v
+		}
+	}
+	return picked
 }
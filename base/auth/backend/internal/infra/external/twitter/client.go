@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/twitteruser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 	"github.com/sngm3741/roots/base/auth/internal/usecase/twitterlogin"
 )
 
@@ -25,6 +27,7 @@ type Client struct {
 	tokenEndpoint     string
 	profileEndpoint   string
 	scopes            []string
+	userFields        []string
 }
 
 // NewClient はTwitter API クライアントを初期化する。
@@ -50,6 +53,16 @@ func NewClient(
 	}
 }
 
+// defaultUserFields はプロフィール取得で常に要求する user.fields。
+var defaultUserFields = []string{"name", "username", "profile_image_url"}
+
+// WithUserFields は user.fields に追加で要求するフィールド（verified / public_metrics / created_at など）を指定する。
+// 追加したフィールドは Profile.Attributes に入る。
+func (c *Client) WithUserFields(fields []string) *Client {
+	c.userFields = append([]string(nil), fields...)
+	return c
+}
+
 // BuildAuthorizeURL はstate/code_challengeを含めた認可URLを生成する。
 func (c *Client) BuildAuthorizeURL(state, codeChallenge string) string {
 	values := url.Values{}
@@ -73,6 +86,49 @@ func (c *Client) ExchangeToken(ctx context.Context, code, codeVerifier string) (
 	form.Set("code_verifier", codeVerifier)
 	form.Set("client_id", c.clientID)
 
+	parsed, err := c.requestToken(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	return &twitterlogin.Token{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		TokenType:    parsed.TokenType,
+		ExpiresIn:    parsed.ExpiresIn,
+		Scope:        parsed.Scope,
+	}, nil
+}
+
+// Refresh はリフレッシュトークンでアクセストークンを更新する（offline.access スコープが必要）。
+// X のリフレッシュトークンは1回限りのため、応答の新しいリフレッシュトークンを保存し直すこと。
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*tokenvault.Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", c.clientID)
+
+	parsed, err := c.requestToken(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenvault.Token{
+		AccessToken:  parsed.AccessToken,
+		RefreshToken: parsed.RefreshToken,
+		TokenType:    parsed.TokenType,
+		Scope:        parsed.Scope,
+		ExpiresAt:    time.Now().UTC().Add(time.Duration(parsed.ExpiresIn) * time.Second),
+	}, nil
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+}
+
+func (c *Client) requestToken(ctx context.Context, form url.Values) (*tokenResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenEndpoint, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("twitter token: create request: %w", err)
@@ -99,26 +155,14 @@ func (c *Client) ExchangeToken(ctx context.Context, code, codeVerifier string) (
 		return nil, fmt.Errorf("twitter token: status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
 	}
 
-	var parsed struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token,omitempty"`
-		TokenType    string `json:"token_type"`
-		ExpiresIn    int    `json:"expires_in"`
-		Scope        string `json:"scope"`
-	}
+	var parsed tokenResponse
 	if err := json.Unmarshal(body, &parsed); err != nil {
 		return nil, fmt.Errorf("twitter token: decode response: %w", err)
 	}
 	if parsed.AccessToken == "" {
 		return nil, errors.New("twitter token: missing access_token")
 	}
-
-	return &twitterlogin.Token{
-		AccessToken:  parsed.AccessToken,
-		RefreshToken: parsed.RefreshToken,
-		TokenType:    parsed.TokenType,
-		ExpiresIn:    parsed.ExpiresIn,
-	}, nil
+	return &parsed, nil
 }
 
 // FetchProfile はアクセストークンを使ってプロフィールを取得する。
@@ -129,7 +173,13 @@ func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*twitter
 	}
 	query := profileURL.Query()
 	if query.Get("user.fields") == "" {
-		query.Set("user.fields", "name,username,profile_image_url")
+		fields := append([]string(nil), defaultUserFields...)
+		for _, f := range c.userFields {
+			if !containsField(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+		query.Set("user.fields", strings.Join(fields, ","))
 	}
 	profileURL.RawQuery = query.Encode()
 
@@ -165,6 +215,21 @@ func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*twitter
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return nil, fmt.Errorf("twitter profile: decode response: %w", err)
 	}
+	var attributes map[string]any
+	if len(c.userFields) > 0 {
+		var raw struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("twitter profile: decode response: %w", err)
+		}
+		attributes = make(map[string]any, len(c.userFields))
+		for _, f := range c.userFields {
+			if v, ok := raw.Data[f]; ok {
+				attributes[f] = v
+			}
+		}
+	}
 	if payload.Data.ID == "" {
 		return nil, errors.New("twitter profile: missing id")
 	}
@@ -179,5 +244,15 @@ func (c *Client) FetchProfile(ctx context.Context, accessToken string) (*twitter
 		DisplayName: payload.Data.Name,
 		Username:    payload.Data.Username,
 		AvatarURL:   payload.Data.ProfileImageURL,
+		Attributes:  attributes,
 	}, nil
 }
+
+func containsField(fields []string, f string) bool {
+	for _, v := range fields {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
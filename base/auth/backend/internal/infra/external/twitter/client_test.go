@@ -0,0 +1,38 @@
+package twitter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 追加の user.fields を要求し、応答を Attributes に残すことを確認する。
+func TestClient_FetchProfileUserFields(t *testing.T) {
+	t.Parallel()
+
+	var gotFields string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotFields = r.URL.Query().Get("user.fields")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"id":"42","name":"Taro","username":"taro","verified":true,"public_metrics":{"followers_count":10}}}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "cid", "", "https://app.example.com/cb", "", "", srv.URL, nil).
+		WithUserFields([]string{"verified", "public_metrics", "username"})
+	profile, err := c.FetchProfile(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("FetchProfile error: %v", err)
+	}
+	if gotFields != "name,username,profile_image_url,verified,public_metrics" {
+		t.Fatalf("unexpected user.fields: %s", gotFields)
+	}
+	if profile.Username != "taro" || profile.Attributes["verified"] != true {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+	metrics, _ := profile.Attributes["public_metrics"].(map[string]any)
+	if metrics["followers_count"] != float64(10) {
+		t.Fatalf("unexpected public_metrics: %v", profile.Attributes["public_metrics"])
+	}
+}
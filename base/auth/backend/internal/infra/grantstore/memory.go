@@ -0,0 +1,76 @@
+package grantstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Memory はプロセス内で認可コードなどの一時データをTTL付きで保持するストア。
+// 単一インスタンス運用やテスト向けで、複数レプリカ間では共有されない。
+type Memory struct {
+	mu   sync.Mutex
+	data map[string]memoryEntry
+	now  func() time.Time
+}
+
+// NewMemory は空のインメモリストアを生成する。
+func NewMemory() *Memory {
+	return &Memory{
+		data: make(map[string]memoryEntry),
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Put は値を有効期限付きで保存する。既存の値は上書きする。
+func (m *Memory) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	m.data[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Get は値を参照する。削除はしない。未登録・期限切れの場合はfalseを返す。
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[key]
+	if !ok || !m.now().Before(entry.expiresAt) {
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Take は値を取り出して削除する。未登録・期限切れ・取り出し済みの場合はfalseを返す。
+func (m *Memory) Take(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(m.data, key)
+	if !m.now().Before(entry.expiresAt) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// sweep は期限切れの値を掃除する。呼び出し側でロックを保持していること。
+func (m *Memory) sweep(now time.Time) {
+	for k, entry := range m.data {
+		if !now.Before(entry.expiresAt) {
+			delete(m.data, k)
+		}
+	}
+}
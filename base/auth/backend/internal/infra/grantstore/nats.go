@@ -0,0 +1,98 @@
+package grantstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// KV はNATS JetStream KeyValueに一時データを保存するストア。
+// バケット自体のTTLで古いキーを掃除しつつ、値に保存した期限でも判定する。
+type KV struct {
+	kv  jetstream.KeyValue
+	now func() time.Time
+}
+
+type kvEnvelope struct {
+	ExpiresAt int64  `json:"exp"`
+	Value     []byte `json:"v"`
+}
+
+// NewKV は指定バケットを作成（既存なら更新）してKVストアを返す。
+// maxTTL はバケットのTTLで、保存する値のTTLの最大値以上を指定する。
+func NewKV(ctx context.Context, js jetstream.JetStream, bucket string, maxTTL time.Duration) (*KV, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "auth short-lived grants",
+		TTL:         maxTTL,
+		History:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("grantstore: create bucket %s: %w", bucket, err)
+	}
+	return &KV{
+		kv:  kv,
+		now: func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Put は値を有効期限付きで保存する。既存の値は上書きする。
+func (s *KV) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(kvEnvelope{ExpiresAt: s.now().Add(ttl).UnixNano(), Value: value})
+	if err != nil {
+		return fmt.Errorf("grantstore: marshal %s: %w", key, err)
+	}
+	if _, err := s.kv.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("grantstore: put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get は値を参照する。削除はしない。未登録・期限切れの場合はfalseを返す。
+func (s *KV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, err := s.kv.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("grantstore: get %s: %w", key, err)
+	}
+	value, ok := s.unwrap(entry.Value())
+	return value, ok, nil
+}
+
+// Take は値を取り出して削除する。リビジョン指定の削除で同時取り出しを1件に絞る。
+func (s *KV) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, err := s.kv.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("grantstore: get %s: %w", key, err)
+	}
+	if err := s.kv.Delete(ctx, key, jetstream.LastRevision(entry.Revision())); err != nil {
+		var apiErr *jetstream.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("grantstore: delete %s: %w", key, err)
+	}
+	value, ok := s.unwrap(entry.Value())
+	return value, ok, nil
+}
+
+// unwrap は保存時の期限を確認して値を取り出す。壊れた値は未登録として扱う。
+func (s *KV) unwrap(data []byte) ([]byte, bool) {
+	var env kvEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, false
+	}
+	if !s.now().Before(time.Unix(0, env.ExpiresAt)) {
+		return nil, false
+	}
+	return env.Value, true
+}
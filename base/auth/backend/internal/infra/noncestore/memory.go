@@ -0,0 +1,63 @@
+package noncestore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate は同じnonceが既に記録されている場合に返す。
+var ErrDuplicate = errors.New("noncestore: duplicate nonce")
+
+// Memory はプロセス内でnonceをTTL付きで保持するストア。
+// 単一インスタンス運用やテスト向けで、複数レプリカ間では共有されない。
+type Memory struct {
+	mu   sync.Mutex
+	data map[string]time.Time
+	now  func() time.Time
+}
+
+// NewMemory は空のインメモリストアを生成する。
+func NewMemory() *Memory {
+	return &Memory{
+		data: make(map[string]time.Time),
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Remember はnonceを有効期限付きで記録する。既に存在する場合はErrDuplicateを返す。
+func (m *Memory) Remember(_ context.Context, nonce string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	if _, ok := m.data[nonce]; ok {
+		return ErrDuplicate
+	}
+	m.data[nonce] = now.Add(ttl)
+	return nil
+}
+
+// Consume はnonceを取り出して削除する。未登録・期限切れ・消費済みの場合はfalseを返す。
+func (m *Memory) Consume(_ context.Context, nonce string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt, ok := m.data[nonce]
+	if !ok {
+		return false, nil
+	}
+	delete(m.data, nonce)
+	return m.now().Before(expiresAt), nil
+}
+
+// sweep は期限切れのnonceを掃除する。呼び出し側でロックを保持していること。
+func (m *Memory) sweep(now time.Time) {
+	for k, exp := range m.data {
+		if !now.Before(exp) {
+			delete(m.data, k)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package noncestore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 記録したnonceは1回だけ消費でき、2回目・未登録・期限切れは拒否することを確認する。
+func TestMemory_Consume(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		nonce   string
+		elapsed time.Duration
+		want    []bool
+	}{
+		{name: "1回だけ消費できる", nonce: "n1", want: []bool{true, false}},
+		{name: "未登録", nonce: "unknown", want: []bool{false}},
+		{name: "期限切れ", nonce: "n1", elapsed: 10 * time.Minute, want: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := NewMemory()
+			clock := now
+			m.now = func() time.Time { return clock }
+			if err := m.Remember(context.Background(), "n1", 10*time.Minute); err != nil {
+				t.Fatalf("remember: %v", err)
+			}
+			clock = clock.Add(tt.elapsed)
+			for i, want := range tt.want {
+				got, err := m.Consume(context.Background(), tt.nonce)
+				if err != nil {
+					t.Fatalf("consume %d: %v", i, err)
+				}
+				if got != want {
+					t.Fatalf("consume %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 有効なnonceの再記録は重複として拒否し、期限切れなら記録し直せることを確認する。
+func TestMemory_Remember(t *testing.T) {
+	t.Parallel()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	if err := m.Remember(ctx, "n1", time.Minute); err != nil {
+		t.Fatalf("remember: %v", err)
+	}
+	if err := m.Remember(ctx, "n1", time.Minute); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("err=%v want ErrDuplicate", err)
+	}
+	clock = clock.Add(time.Minute)
+	if err := m.Remember(ctx, "n1", time.Minute); err != nil {
+		t.Fatalf("remember after expiry: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package noncestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// KV はNATS JetStream KeyValueにnonceを記録するストア。
+// バケット自体のTTLで古いキーを掃除しつつ、値に保存した期限でも判定する。
+type KV struct {
+	kv  jetstream.KeyValue
+	now func() time.Time
+}
+
+// NewKV は指定バケットを作成（既存なら更新）してKVストアを返す。
+// maxTTL はバケットのTTLで、テナントごとのstateTTLの最大値以上を指定する。
+func NewKV(ctx context.Context, js jetstream.JetStream, bucket string, maxTTL time.Duration) (*KV, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "auth oauth state nonces",
+		TTL:         maxTTL,
+		History:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("noncestore: create bucket %s: %w", bucket, err)
+	}
+	return &KV{
+		kv:  kv,
+		now: func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Remember はnonceを有効期限付きで記録する。既に存在する場合はErrDuplicateを返す。
+func (s *KV) Remember(ctx context.Context, nonce string, ttl time.Duration) error {
+	expiresAt := s.now().Add(ttl).UnixNano()
+	if _, err := s.kv.Create(ctx, nonce, []byte(strconv.FormatInt(expiresAt, 10))); err != nil {
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return ErrDuplicate
+		}
+		return fmt.Errorf("noncestore: create %s: %w", nonce, err)
+	}
+	return nil
+}
+
+// Consume はnonceを取り出して削除する。リビジョン指定の削除で同時消費を1件に絞る。
+func (s *KV) Consume(ctx context.Context, nonce string) (bool, error) {
+	entry, err := s.kv.Get(ctx, nonce)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("noncestore: get %s: %w", nonce, err)
+	}
+	if err := s.kv.Delete(ctx, nonce, jetstream.LastRevision(entry.Revision())); err != nil {
+		var apiErr *jetstream.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+			return false, nil
+		}
+		return false, fmt.Errorf("noncestore: delete %s: %w", nonce, err)
+	}
+
+	expiresAt, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	return s.now().Before(time.Unix(0, expiresAt)), nil
+}
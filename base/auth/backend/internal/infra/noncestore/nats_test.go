@@ -0,0 +1,151 @@
+package noncestore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeKeyValue は Create・Get・Delete だけを持つプロセス内のKVバケット。
+// JetStream と同じく、取得後に他で消されたキーの削除は最終シーケンス不一致で失敗させる。
+type fakeKeyValue struct {
+	jetstream.KeyValue
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	revision uint64
+	// beforeDelete は Get と Delete の間に割り込む処理。同時消費の再現に使う。
+	beforeDelete func()
+}
+
+type fakeEntry struct {
+	jetstream.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e fakeEntry) Value() []byte    { return e.value }
+func (e fakeEntry) Revision() uint64 { return e.revision }
+
+func (f *fakeKeyValue) Create(_ context.Context, key string, value []byte, _ ...jetstream.KVCreateOpt) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.values[key]; ok {
+		return 0, jetstream.ErrKeyExists
+	}
+	f.revision++
+	f.values[key] = value
+	return f.revision, nil
+}
+
+func (f *fakeKeyValue) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.values[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return fakeEntry{value: v, revision: f.revision}, nil
+}
+
+func (f *fakeKeyValue) Delete(_ context.Context, key string, _ ...jetstream.KVDeleteOpt) error {
+	if hook := f.beforeDelete; hook != nil {
+		f.beforeDelete = nil
+		hook()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.values[key]; !ok {
+		return &jetstream.APIError{ErrorCode: jetstream.JSErrCodeStreamWrongLastSequence, Code: 400}
+	}
+	delete(f.values, key)
+	return nil
+}
+
+func newTestKV(clock *time.Time) (*KV, *fakeKeyValue) {
+	kv := &fakeKeyValue{values: map[string][]byte{}}
+	return &KV{kv: kv, now: func() time.Time { return *clock }}, kv
+}
+
+// 記録したnonceは1回だけ消費でき、2回目・未登録・期限切れは拒否することを確認する。
+func TestKV_Consume(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		nonce   string
+		elapsed time.Duration
+		want    []bool
+	}{
+		{name: "1回だけ消費できる", nonce: "n1", want: []bool{true, false}},
+		{name: "未登録", nonce: "unknown", want: []bool{false}},
+		{name: "期限切れ", nonce: "n1", elapsed: 10 * time.Minute, want: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			s, _ := newTestKV(&clock)
+			if err := s.Remember(context.Background(), "n1", 10*time.Minute); err != nil {
+				t.Fatalf("remember: %v", err)
+			}
+			clock = clock.Add(tt.elapsed)
+			for i, want := range tt.want {
+				got, err := s.Consume(context.Background(), tt.nonce)
+				if err != nil {
+					t.Fatalf("consume %d: %v", i, err)
+				}
+				if got != want {
+					t.Fatalf("consume %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 同じnonceを同時に消費した場合は先に削除した1件だけが成功することを確認する。
+func TestKV_ConsumeRace(t *testing.T) {
+	t.Parallel()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, kv := newTestKV(&clock)
+	ctx := context.Background()
+	if err := s.Remember(ctx, "n1", time.Minute); err != nil {
+		t.Fatalf("remember: %v", err)
+	}
+
+	var other bool
+	kv.beforeDelete = func() {
+		var err error
+		if other, err = s.Consume(ctx, "n1"); err != nil {
+			t.Errorf("concurrent consume: %v", err)
+		}
+	}
+	got, err := s.Consume(ctx, "n1")
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if got || !other {
+		t.Fatalf("consume=%v concurrent=%v, want only the concurrent one to succeed", got, other)
+	}
+}
+
+// 有効なnonceの再記録は重複として拒否することを確認する。
+func TestKV_Remember(t *testing.T) {
+	t.Parallel()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _ := newTestKV(&clock)
+	ctx := context.Background()
+	if err := s.Remember(ctx, "n1", time.Minute); err != nil {
+		t.Fatalf("remember: %v", err)
+	}
+	if err := s.Remember(ctx, "n1", time.Minute); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("err=%v want ErrDuplicate", err)
+	}
+}
@@ -14,39 +14,253 @@ type Config struct {
 
 // AuthTenant は1テナント分の設定。
 type AuthTenant struct {
-	AllowedOrigins        []string      `yaml:"allowedOrigins"`
-	DefaultRedirectOrigin string        `yaml:"defaultRedirectOrigin"`
-	RedirectPath          string        `yaml:"redirectPath"`
-	Line                  LineConfig    `yaml:"line"`
-	Twitter               TwitterConfig `yaml:"twitter"`
+	AllowedOrigins        []string          `yaml:"allowedOrigins"`
+	DefaultRedirectOrigin string            `yaml:"defaultRedirectOrigin"`
+	RedirectPath          string            `yaml:"redirectPath"`
+	Line                  LineConfig        `yaml:"line"`
+	Twitter               TwitterConfig     `yaml:"twitter"`
+	Discord               DiscordConfig     `yaml:"discord"`
+	Apple                 AppleConfig       `yaml:"apple"`
+	StateCookie           StateCookieConfig `yaml:"stateCookie"`
+	OIDC                  OIDCConfig        `yaml:"oidc"`
+	Pages                 PagesConfig       `yaml:"pages"`
+	// ClaimNamespace は profileClaims のクレーム名に付ける接頭辞（例: https://makotoclub.jp/claims/）。
+	ClaimNamespace string `yaml:"claimNamespace"`
+	// TokenVault を設定すると、ログイン時に受け取ったプロバイダのトークンを暗号化して保管する。
+	TokenVault TokenVaultConfig `yaml:"tokenVault"`
+	Anonymous  AnonymousConfig  `yaml:"anonymous"`
+	Session    SessionConfig    `yaml:"session"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks"`
+}
+
+// WebhooksConfig はログインをテナントのアプリへ通知するWebhookの設定。endpoints を指定すると有効になる。
+// 失敗した配信は backoff（既定 10 秒）から倍々の間隔で、最初の送信を含め maxAttempts 回（既定 6）まで送る。
+type WebhooksConfig struct {
+	Endpoints   []WebhookEndpointConfig `yaml:"endpoints"`
+	MaxAttempts int                     `yaml:"maxAttempts"`
+	Backoff     time.Duration           `yaml:"backoff"`
+}
+
+// WebhookEndpointConfig は通知先。events は login・first_login から選び、省略すると両方を送る。
+type WebhookEndpointConfig struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+// SessionConfig は同一サイトのアプリ向けのセッションCookieモードの設定。secret を指定すると有効になり、
+// コールバックはJWTをフラグメントで渡す代わりに HttpOnly・Secure のセッションCookieを domain（親ドメイン）に付ける。
+// sameSite は lax（既定）か strict。ttl の既定は 24 時間。
+type SessionConfig struct {
+	Secret     string        `yaml:"secret"`
+	CookieName string        `yaml:"cookieName"`
+	Domain     string        `yaml:"domain"`
+	SameSite   string        `yaml:"sameSite"`
+	TTL        time.Duration `yaml:"ttl"`
+}
+
+// AnonymousConfig はログインなしで使う匿名トークンの設定。
+// challengeSecret・subjectSecret・jwtSecret をすべて指定すると有効になる。
+// subjectSecret は端末鍵から仮名の sub を導出する鍵で、変更すると既存端末の sub がすべて変わる。
+type AnonymousConfig struct {
+	ChallengeSecret string        `yaml:"challengeSecret"`
+	Difficulty      int           `yaml:"difficulty"`
+	ChallengeTTL    time.Duration `yaml:"challengeTTL"`
+	SubjectSecret   string        `yaml:"subjectSecret"`
+	JWTSecret       string        `yaml:"jwtSecret"`
+	JWTIssuer       string        `yaml:"jwtIssuer"`
+	JWTAudience     string        `yaml:"jwtAudience"`
+	JWTExpiresIn    time.Duration `yaml:"jwtExpiresIn"`
+}
+
+// TokenVaultConfig はプロバイダトークン保管庫の設定。
+// key はAES-256の鍵（32バイトをbase64で表したもの）。providers を省略すると line と twitter を保管する。
+// retention は最後の保存・更新から保管する期間（既定 90 日、AUTH_VAULT_MAX_TTL 以下にする）。
+type TokenVaultConfig struct {
+	Key       string        `yaml:"key"`
+	Providers []string      `yaml:"providers"`
+	Retention time.Duration `yaml:"retention"`
+}
+
+// PagesConfig はログイン結果・エラー・ポップアップ完了・選択ページのブランディング設定。
+// templateDir に同名の *.html（result / error / popup / select / layout）を置くと既定テンプレートを上書きする。
+type PagesConfig struct {
+	TemplateDir string            `yaml:"templateDir"`
+	Locale      string            `yaml:"locale"`
+	AppName     string            `yaml:"appName"`
+	LogoURL     string            `yaml:"logoURL"`
+	Colors      PageColorsConfig  `yaml:"colors"`
+	Messages    map[string]string `yaml:"messages"`
+}
+
+// PageColorsConfig はページの配色（CSSの色指定）。
+type PageColorsConfig struct {
+	Primary    string `yaml:"primary"`
+	Background string `yaml:"background"`
+	Text       string `yaml:"text"`
+}
+
+// StateCookieConfig はstateをブラウザに紐付けるCookieの設定。
+// 既定は __Host- プレフィックス付き・SameSite=Lax。クロスサイト構成では sameSite: none を指定する。
+type StateCookieConfig struct {
+	Disabled    bool   `yaml:"disabled"`
+	Name        string `yaml:"name"`
+	Domain      string `yaml:"domain"`
+	SameSite    string `yaml:"sameSite"`
+	Partitioned bool   `yaml:"partitioned"`
 }
 
 // LineConfig はテナントごとのLINE設定。
+// StateSecrets・JWTSecrets を指定すると StateSecret・JWTSecret より優先し、鍵を入れ替えられる。
 type LineConfig struct {
-	ChannelID     string        `yaml:"channelID"`
-	ChannelSecret string        `yaml:"channelSecret"`
-	RedirectURI   string        `yaml:"redirectURI"`
-	Scopes        []string      `yaml:"scopes"`
-	StateSecret   string        `yaml:"stateSecret"`
-	StateTTL      time.Duration `yaml:"stateTTL"`
-	JWTSecret     string        `yaml:"jwtSecret"`
-	JWTIssuer     string        `yaml:"jwtIssuer"`
-	JWTAudience   string        `yaml:"jwtAudience"`
-	JWTExpiresIn  time.Duration `yaml:"jwtExpiresIn"`
+	ChannelID     string         `yaml:"channelID"`
+	ChannelSecret string         `yaml:"channelSecret"`
+	RedirectURI   string         `yaml:"redirectURI"`
+	Scopes        []string       `yaml:"scopes"`
+	StateSecret   string         `yaml:"stateSecret"`
+	StateSecrets  []SecretConfig `yaml:"stateSecrets"`
+	StateTTL      time.Duration  `yaml:"stateTTL"`
+	JWTSecret     string         `yaml:"jwtSecret"`
+	JWTSecrets    []SecretConfig `yaml:"jwtSecrets"`
+	JWTIssuer     string         `yaml:"jwtIssuer"`
+	JWTAudience   string         `yaml:"jwtAudience"`
+	JWTExpiresIn  time.Duration  `yaml:"jwtExpiresIn"`
+	// ProfileFields はプロフィールAPIの応答から追加で残すフィールド（statusMessage など）。
+	ProfileFields []string             `yaml:"profileFields"`
+	ProfileClaims []ProfileClaimConfig `yaml:"profileClaims"`
+	Endpoints     OAuthEndpointsConfig `yaml:"endpoints"`
+}
+
+// OAuthEndpointsConfig は上流のエンドポイントの上書き。ローカル・CIで cmd/fakeidp に向けるときに使い、空の項目は本番のURLのまま。
+type OAuthEndpointsConfig struct {
+	Authorize string `yaml:"authorize"`
+	Token     string `yaml:"token"`
+	Profile   string `yaml:"profile"`
 }
 
 // TwitterConfig はテナントごとのTwitter設定。
+// StateSecrets・JWTSecrets を指定すると StateSecret・JWTSecret より優先し、鍵を入れ替えられる。
 type TwitterConfig struct {
-	ClientID     string        `yaml:"clientID"`
-	ClientSecret string        `yaml:"clientSecret"`
-	RedirectURI  string        `yaml:"redirectURI"`
-	Scopes       []string      `yaml:"scopes"`
-	StateSecret  string        `yaml:"stateSecret"`
-	StateTTL     time.Duration `yaml:"stateTTL"`
-	JWTSecret    string        `yaml:"jwtSecret"`
-	JWTIssuer    string        `yaml:"jwtIssuer"`
-	JWTAudience  string        `yaml:"jwtAudience"`
-	JWTExpiresIn time.Duration `yaml:"jwtExpiresIn"`
+	ClientID     string         `yaml:"clientID"`
+	ClientSecret string         `yaml:"clientSecret"`
+	RedirectURI  string         `yaml:"redirectURI"`
+	Scopes       []string       `yaml:"scopes"`
+	StateSecret  string         `yaml:"stateSecret"`
+	StateSecrets []SecretConfig `yaml:"stateSecrets"`
+	StateTTL     time.Duration  `yaml:"stateTTL"`
+	JWTSecret    string         `yaml:"jwtSecret"`
+	JWTSecrets   []SecretConfig `yaml:"jwtSecrets"`
+	JWTIssuer    string         `yaml:"jwtIssuer"`
+	JWTAudience  string         `yaml:"jwtAudience"`
+	JWTExpiresIn time.Duration  `yaml:"jwtExpiresIn"`
+	// ProfileFields は user.fields に追加で要求するフィールド（verified / public_metrics / created_at など）。
+	ProfileFields []string             `yaml:"profileFields"`
+	ProfileClaims []ProfileClaimConfig `yaml:"profileClaims"`
+	Endpoints     OAuthEndpointsConfig `yaml:"endpoints"`
+}
+
+// ProfileClaimConfig は追加のプロフィール項目をJWTのクレームへ写す設定1件。
+// field は profileFields のいずれか（ネストした値は public_metrics.followers_count のようにドットでたどる）、
+// claim には claimNamespace を前置したものがクレーム名になる。
+type ProfileClaimConfig struct {
+	Field string `yaml:"field"`
+	Claim string `yaml:"claim"`
+}
+
+// SecretConfig は入れ替え可能な署名鍵1件。先頭の有効な鍵で署名し、有効なすべての鍵で検証する。
+// expiresAt（RFC 3339）を過ぎた鍵は使わない。id はJWTヘッダの kid に入る。
+type SecretConfig struct {
+	ID        string    `yaml:"id"`
+	Value     string    `yaml:"value"`
+	ExpiresAt time.Time `yaml:"expiresAt"`
+}
+
+// DiscordConfig はテナントごとのDiscord設定。
+// GuildID を指定するとギルド参加者のみ、RequiredRoleIDs を指定するといずれかのロール保持者のみログインできる。
+// ギルド判定には guilds.members.read スコープが必要。
+type DiscordConfig struct {
+	ClientID        string        `yaml:"clientID"`
+	ClientSecret    string        `yaml:"clientSecret"`
+	RedirectURI     string        `yaml:"redirectURI"`
+	Scopes          []string      `yaml:"scopes"`
+	GuildID         string        `yaml:"guildID"`
+	RequiredRoleIDs []string      `yaml:"requiredRoleIDs"`
+	StateSecret     string        `yaml:"stateSecret"`
+	StateTTL        time.Duration `yaml:"stateTTL"`
+	JWTSecret       string        `yaml:"jwtSecret"`
+	JWTIssuer       string        `yaml:"jwtIssuer"`
+	JWTAudience     string        `yaml:"jwtAudience"`
+	JWTExpiresIn    time.Duration `yaml:"jwtExpiresIn"`
+}
+
+// AppleConfig はテナントごとのSign in with Apple設定。
+// ClientID は Services ID、PrivateKey は Apple Developer で発行した .p8 の PEM 文字列。
+type AppleConfig struct {
+	ClientID        string        `yaml:"clientID"`
+	TeamID          string        `yaml:"teamID"`
+	KeyID           string        `yaml:"keyID"`
+	PrivateKey      string        `yaml:"privateKey"`
+	RedirectURI     string        `yaml:"redirectURI"`
+	Scopes          []string      `yaml:"scopes"`
+	ClientSecretTTL time.Duration `yaml:"clientSecretTTL"`
+	StateSecret     string        `yaml:"stateSecret"`
+	StateTTL        time.Duration `yaml:"stateTTL"`
+	JWTSecret       string        `yaml:"jwtSecret"`
+	JWTIssuer       string        `yaml:"jwtIssuer"`
+	JWTAudience     string        `yaml:"jwtAudience"`
+	JWTExpiresIn    time.Duration `yaml:"jwtExpiresIn"`
+	// Endpoints はローカル・CIで cmd/fakeidp に向けるときに使う。空の項目は本番のURLのまま。
+	Endpoints AppleEndpointsConfig `yaml:"endpoints"`
+}
+
+// AppleEndpointsConfig はSign in with Appleのエンドポイントの上書き。issuer はid_tokenの iss の検証に使う。
+type AppleEndpointsConfig struct {
+	Issuer    string `yaml:"issuer"`
+	Authorize string `yaml:"authorize"`
+	Token     string `yaml:"token"`
+	JWKS      string `yaml:"jwks"`
+}
+
+// OIDCConfig はテナントをOpenID Connectプロバイダとして公開する設定。
+// SigningKey はRS256署名用のRSA秘密鍵（PEM）。Clients に連携するアプリを登録する。
+type OIDCConfig struct {
+	Issuer         string             `yaml:"issuer"`
+	SigningKey     string             `yaml:"signingKey"`
+	KeyID          string             `yaml:"keyID"`
+	RequestTTL     time.Duration      `yaml:"requestTTL"`
+	CodeTTL        time.Duration      `yaml:"codeTTL"`
+	AccessTokenTTL time.Duration      `yaml:"accessTokenTTL"`
+	IDTokenTTL     time.Duration      `yaml:"idTokenTTL"`
+	Clients        []OIDCClientConfig `yaml:"clients"`
+	// ServiceClients は client_credentials でサービストークンを取得できるバックエンド。
+	ServiceClients  []ServiceClientConfig `yaml:"serviceClients"`
+	ServiceTokenTTL time.Duration         `yaml:"serviceTokenTTL"`
+	// DeviceClients はデバイスフロー（RFC 8628）でログインするCLIなどの公開クライアント。
+	DeviceClients []DeviceClientConfig `yaml:"deviceClients"`
+	DeviceCodeTTL time.Duration        `yaml:"deviceCodeTTL"`
+}
+
+// OIDCClientConfig は登録済みアプリ1件。clientSecret を省略すると公開クライアント（PKCE必須）になる。
+type OIDCClientConfig struct {
+	ClientID     string   `yaml:"clientID"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Name         string   `yaml:"name"`
+	RedirectURIs []string `yaml:"redirectURIs"`
+}
+
+// ServiceClientConfig はサービスクライアント1件。
+// clientSecretSHA256 は client secret の SHA-256（16進）で、平文の secret は設定に置かない。
+type ServiceClientConfig struct {
+	ClientID           string   `yaml:"clientID"`
+	ClientSecretSHA256 string   `yaml:"clientSecretSHA256"`
+	Name               string   `yaml:"name"`
+	Scopes             []string `yaml:"scopes"`
+}
+
+// DeviceClientConfig はデバイスフローのクライアント1件。secret は持たない。
+type DeviceClientConfig struct {
+	ClientID string `yaml:"clientID"`
+	Name     string `yaml:"name"`
 }
 
 // Parse はYAMLバイト列からConfigを構築する。
@@ -31,6 +31,16 @@ func (l *Loader) AuthConfig(tenantID string) (AuthTenant, bool) {
 	return ten, ok
 }
 
+// TenantIDs は定義済みのテナントIDを昇順で返す。起動時の設定検査に使う。
+func (l *Loader) TenantIDs() []string {
+	ids := make([]string, 0, len(l.cfg.Auth))
+	for id := range l.cfg.Auth {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func loadConfig(path string) (Config, error) {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -0,0 +1,101 @@
+package anonlogin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// subjectPrefix は匿名トークンの sub の接頭辞。ログインユーザーのIDと衝突させない。
+const subjectPrefix = "anon:"
+
+// Usecase は端末鍵とプルーフオブワークによる匿名トークン発行を司るアプリケーションサービス。
+type Usecase struct {
+	challenges    ChallengeManager
+	tokens        TokenIssuer
+	subjectSecret []byte
+}
+
+// ChallengeOutput はチャレンジ発行時の戻り値。
+type ChallengeOutput struct {
+	Challenge  string
+	Difficulty int
+	ExpiresAt  time.Time
+}
+
+// IssueInput は匿名トークン発行の入力。Signature は端末鍵で Challenge に付けた署名。
+type IssueInput struct {
+	Challenge string
+	Solution  string
+	DeviceKey DeviceKey
+	Signature string
+}
+
+// IssueOutput は発行した匿名トークン。Subject はテナント内で端末ごとに固定の仮名ID。
+type IssueOutput struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int
+	Subject     string
+}
+
+// NewUsecase は匿名トークン用ユースケースを初期化する。
+// subjectSecret はテナントごとの鍵で、同じ端末でもテナントが違えば別の sub になる。
+func NewUsecase(challenges ChallengeManager, tokens TokenIssuer, subjectSecret []byte) *Usecase {
+	return &Usecase{
+		challenges:    challenges,
+		tokens:        tokens,
+		subjectSecret: append([]byte(nil), subjectSecret...),
+	}
+}
+
+// Challenge はプルーフオブワークのチャレンジを発行する。
+func (u *Usecase) Challenge(ctx context.Context) (*ChallengeOutput, error) {
+	c, err := u.challenges.Issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ChallengeOutput{
+		Challenge:  c.Value,
+		Difficulty: c.Difficulty,
+		ExpiresAt:  c.ExpiresAt,
+	}, nil
+}
+
+// Issue は端末鍵の署名とチャレンジの解を検証し、匿名トークンを発行する。
+func (u *Usecase) Issue(ctx context.Context, in IssueInput) (*IssueOutput, error) {
+	challenge := strings.TrimSpace(in.Challenge)
+	if challenge == "" {
+		return nil, ErrInvalidChallenge
+	}
+	if err := in.DeviceKey.verifySignature(challenge, strings.TrimSpace(in.Signature)); err != nil {
+		return nil, err
+	}
+	thumbprint := in.DeviceKey.Thumbprint()
+	if err := u.challenges.Verify(ctx, challenge, thumbprint, strings.TrimSpace(in.Solution)); err != nil {
+		return nil, err
+	}
+
+	subject := u.subject(thumbprint)
+	token, expiresIn, err := u.tokens.Issue(subject, thumbprint)
+	if err != nil {
+		return nil, fmt.Errorf("issue anonymous token: %w", err)
+	}
+	return &IssueOutput{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Subject:     subject,
+	}, nil
+}
+
+// subject は端末鍵のサムプリントからテナント固有の仮名IDを導出する。鍵そのものは sub から復元できない。
+func (u *Usecase) subject(thumbprint string) string {
+	mac := hmac.New(sha256.New, u.subjectSecret)
+	mac.Write([]byte(thumbprint))
+	return subjectPrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,239 @@
+package anonlogin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+)
+
+const testDifficulty = 8
+
+// 匿名トークン発行の検証をテーブル駆動で確認する。
+func TestUsecase_Issue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mutate  func(in *IssueInput, other *ecdsa.PrivateKey)
+		reuse   bool
+		wantErr error
+	}{
+		{name: "発行成功"},
+		{
+			name: "解が難易度を満たさない",
+			mutate: func(in *IssueInput, _ *ecdsa.PrivateKey) {
+				in.Solution = unsolved(in.Challenge, in.DeviceKey.Thumbprint())
+			},
+			wantErr: ErrInsufficientWork,
+		},
+		{
+			name: "別の端末鍵で署名",
+			mutate: func(in *IssueInput, other *ecdsa.PrivateKey) {
+				in.Signature = signChallenge(t, other, in.Challenge)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "解を別の端末に使い回す",
+			mutate: func(in *IssueInput, other *ecdsa.PrivateKey) {
+				// 偶然別の鍵でも難易度を満たす解にならないよう、満たさない鍵を選ぶ。
+				for leadingZeroBits(workDigest(in.Challenge, jwkOf(&other.PublicKey).Thumbprint(), in.Solution)) >= testDifficulty {
+					other = newDeviceKey(t)
+				}
+				in.DeviceKey = jwkOf(&other.PublicKey)
+				in.Signature = signChallenge(t, other, in.Challenge)
+			},
+			wantErr: ErrInsufficientWork,
+		},
+		{
+			name:    "改ざんされたチャレンジ",
+			mutate:  func(in *IssueInput, _ *ecdsa.PrivateKey) { in.Challenge = "x" + in.Challenge },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "曲線外の鍵",
+			mutate:  func(in *IssueInput, _ *ecdsa.PrivateKey) { in.DeviceKey.Y = in.DeviceKey.X },
+			wantErr: ErrInvalidDeviceKey,
+		},
+		{name: "チャレンジの再利用", reuse: true, wantErr: ErrChallengeReused},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			u := NewUsecase(
+				NewHMACChallengeManager([]byte("challenge-secret"), testDifficulty, time.Minute, noncestore.NewMemory()),
+				NewJWTIssuer([]byte("jwt-secret"), "iss", "aud", 10*time.Minute),
+				[]byte("subject-secret"),
+			)
+			device, other := newDeviceKey(t), newDeviceKey(t)
+			in := solve(t, u, device)
+			if tt.mutate != nil {
+				tt.mutate(&in, other)
+			}
+			if tt.reuse {
+				if _, err := u.Issue(context.Background(), in); err != nil {
+					t.Fatalf("first issue: %v", err)
+				}
+			}
+
+			out, err := u.Issue(context.Background(), in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(out.Subject, subjectPrefix) || out.ExpiresIn != 600 {
+				t.Fatalf("unexpected output: %+v", out)
+			}
+			claims := decodeClaims(t, out.AccessToken)
+			if claims["sub"] != out.Subject || claims["anonymous"] != true {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+			if cnf, _ := claims["cnf"].(map[string]any); cnf["jkt"] != in.DeviceKey.Thumbprint() {
+				t.Fatalf("cnf.jkt mismatch: %v", claims["cnf"])
+			}
+		})
+	}
+}
+
+// sub は同じテナント・同じ端末なら固定で、テナントが違えば変わる。
+func TestUsecase_SubjectIsPerTenant(t *testing.T) {
+	t.Parallel()
+
+	newUsecase := func(subjectSecret string) *Usecase {
+		return NewUsecase(
+			NewHMACChallengeManager([]byte("challenge-secret"), testDifficulty, time.Minute, noncestore.NewMemory()),
+			NewJWTIssuer([]byte("jwt-secret"), "iss", "aud", time.Minute),
+			[]byte(subjectSecret),
+		)
+	}
+	device := newDeviceKey(t)
+	issue := func(u *Usecase) string {
+		out, err := u.Issue(context.Background(), solve(t, u, device))
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		return out.Subject
+	}
+
+	tenantA, tenantB := newUsecase("tenant-a"), newUsecase("tenant-b")
+	first, second := issue(tenantA), issue(tenantA)
+	if first != second {
+		t.Fatalf("subject changed for the same device: %s != %s", first, second)
+	}
+	if other := issue(tenantB); other == first {
+		t.Fatalf("subject must differ across tenants: %s", other)
+	}
+}
+
+// 期限切れのチャレンジは解が正しくても受け付けない。
+func TestHMACChallengeManager_Expired(t *testing.T) {
+	t.Parallel()
+
+	m := NewHMACChallengeManager([]byte("secret"), testDifficulty, time.Minute, noncestore.NewMemory())
+	c, err := m.Issue(context.Background())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	m.now = func() time.Time { return time.Now().UTC().Add(2 * time.Minute) }
+	if err := m.Verify(context.Background(), c.Value, "jkt", findSolution(c.Value, "jkt", testDifficulty)); !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("err=%v want=%v", err, ErrChallengeExpired)
+	}
+}
+
+func newDeviceKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func jwkOf(pub *ecdsa.PublicKey) DeviceKey {
+	return DeviceKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func signChallenge(t *testing.T, key *ecdsa.PrivateKey, challenge string) string {
+	t.Helper()
+	digest := sha256.Sum256([]byte(challenge))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// solve はクライアントと同じ手順でチャレンジを取得して解き、署名する。
+func solve(t *testing.T, u *Usecase, key *ecdsa.PrivateKey) IssueInput {
+	t.Helper()
+	c, err := u.Challenge(context.Background())
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	jwk := jwkOf(&key.PublicKey)
+	return IssueInput{
+		Challenge: c.Challenge,
+		Solution:  findSolution(c.Challenge, jwk.Thumbprint(), c.Difficulty),
+		DeviceKey: jwk,
+		Signature: signChallenge(t, key, c.Challenge),
+	}
+}
+
+func findSolution(challenge, thumbprint string, difficulty int) string {
+	for i := 0; ; i++ {
+		s := strconv.Itoa(i)
+		if leadingZeroBits(workDigest(challenge, thumbprint, s)) >= difficulty {
+			return s
+		}
+	}
+}
+
+func unsolved(challenge, thumbprint string) string {
+	for i := 0; ; i++ {
+		s := strconv.Itoa(i)
+		if leadingZeroBits(workDigest(challenge, thumbprint, s)) < testDifficulty {
+			return s
+		}
+	}
+}
+
+func decodeClaims(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed token: %s", token)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	return claims
+}
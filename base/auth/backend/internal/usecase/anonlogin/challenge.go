@@ -0,0 +1,167 @@
+package anonlogin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidChallenge はチャレンジの形式・署名が不正な場合に返す。
+	ErrInvalidChallenge = errors.New("challenge: invalid")
+	// ErrChallengeExpired はチャレンジの有効期限を過ぎた場合に返す。
+	ErrChallengeExpired = errors.New("challenge: expired")
+	// ErrChallengeReused は使用済みのチャレンジが再度使われた場合に返す。
+	ErrChallengeReused = errors.New("challenge: already used")
+	// ErrInsufficientWork はプルーフオブワークの解が難易度を満たさない場合に返す。
+	ErrInsufficientWork = errors.New("challenge: insufficient proof of work")
+)
+
+// maxSolutionLength は受け付ける解の最大長。
+const maxSolutionLength = 64
+
+// Challenge は匿名トークンの発行前に解かせるプルーフオブワークの課題。
+type Challenge struct {
+	Value      string
+	Difficulty int
+	ExpiresAt  time.Time
+	Nonce      string
+}
+
+// ChallengeManager はチャレンジの発行と解の検証を抽象化する。
+type ChallengeManager interface {
+	Issue(ctx context.Context) (*Challenge, error)
+	Verify(ctx context.Context, challenge, keyThumbprint, solution string) error
+}
+
+// NonceStore はチャレンジのnonceをTTL付きで記録し、一度だけ消費させるストア。
+type NonceStore interface {
+	Remember(ctx context.Context, nonce string, ttl time.Duration) error
+	Consume(ctx context.Context, nonce string) (bool, error)
+}
+
+// HMACChallengeManager はHMAC署名したチャレンジを扱う実装。
+// 解は SHA-256(challenge "." 端末鍵のサムプリント "." solution) の先頭 difficulty ビットが0になる solution。
+type HMACChallengeManager struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	nonces     NonceStore
+	now        func() time.Time
+}
+
+// NewHMACChallengeManager はHMACベースのChallengeManagerを生成する。
+// nonces には発行済みnonceを記録するストアを渡し、チャレンジの再利用を防ぐ。
+func NewHMACChallengeManager(secret []byte, difficulty int, ttl time.Duration, nonces NonceStore) *HMACChallengeManager {
+	return &HMACChallengeManager{
+		secret:     append([]byte(nil), secret...),
+		difficulty: difficulty,
+		ttl:        ttl,
+		nonces:     nonces,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Issue はチャレンジを生成し、nonceをストアに記録する。
+func (m *HMACChallengeManager) Issue(ctx context.Context) (*Challenge, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("challenge: failed to generate nonce: %w", err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := m.now().Add(m.ttl)
+	if err := m.nonces.Remember(ctx, nonce, m.ttl); err != nil {
+		return nil, fmt.Errorf("challenge: failed to record nonce: %w", err)
+	}
+
+	serialized := fmt.Sprintf("%d|%d|%s", expiresAt.Unix(), m.difficulty, nonce)
+	value := base64.RawURLEncoding.EncodeToString([]byte(serialized)) + "." + base64.RawURLEncoding.EncodeToString(m.sign(serialized))
+	return &Challenge{
+		Value:      value,
+		Difficulty: m.difficulty,
+		ExpiresAt:  expiresAt,
+		Nonce:      nonce,
+	}, nil
+}
+
+// Verify は署名・期限・解を検証し、最後にnonceを消費する。解が誤っていてもチャレンジは消費しない。
+func (m *HMACChallengeManager) Verify(ctx context.Context, challenge, keyThumbprint, solution string) error {
+	payload, sig, ok := strings.Cut(challenge, ".")
+	if !ok {
+		return ErrInvalidChallenge
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	providedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(providedSig, m.sign(string(decoded))) {
+		return ErrInvalidChallenge
+	}
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 3 {
+		return ErrInvalidChallenge
+	}
+	expiresUnix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	if !m.now().Before(time.Unix(expiresUnix, 0)) {
+		return ErrChallengeExpired
+	}
+	// 発行後に難易度を上げた場合も、新しい難易度を満たさない解は受け付けない。
+	if difficulty < m.difficulty {
+		difficulty = m.difficulty
+	}
+	if len(solution) == 0 || len(solution) > maxSolutionLength {
+		return ErrInsufficientWork
+	}
+	if leadingZeroBits(workDigest(challenge, keyThumbprint, solution)) < difficulty {
+		return ErrInsufficientWork
+	}
+
+	consumed, err := m.nonces.Consume(ctx, parts[2])
+	if err != nil {
+		return fmt.Errorf("challenge: failed to consume nonce: %w", err)
+	}
+	if !consumed {
+		return ErrChallengeReused
+	}
+	return nil
+}
+
+func (m *HMACChallengeManager) sign(serialized string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(serialized))
+	return mac.Sum(nil)
+}
+
+// workDigest は解の検証に使うハッシュ。端末鍵を含めることで、解を別の端末へ使い回せないようにする。
+func workDigest(challenge, keyThumbprint, solution string) []byte {
+	sum := sha256.Sum256([]byte(challenge + "." + keyThumbprint + "." + solution))
+	return sum[:]
+}
+
+// leadingZeroBits はバイト列の先頭から続く0ビットの数を返す。
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
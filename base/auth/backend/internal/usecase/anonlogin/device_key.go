@@ -0,0 +1,72 @@
+package anonlogin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+var (
+	// ErrInvalidDeviceKey は端末鍵がP-256のEC公開鍵（JWK）でない場合に返す。
+	ErrInvalidDeviceKey = errors.New("device key: invalid")
+	// ErrInvalidSignature は端末鍵によるチャレンジの署名を検証できない場合に返す。
+	ErrInvalidSignature = errors.New("device key: invalid signature")
+)
+
+// DeviceKey は端末で生成したP-256公開鍵のJWK。秘密鍵は端末（WebCryptoの抽出不可鍵など）から出さない。
+type DeviceKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey はJWKをECDSA公開鍵に変換する。曲線上の点であることも確認する。
+func (k DeviceKey) publicKey() (*ecdsa.PublicKey, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, ErrInvalidDeviceKey
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != 32 {
+		return nil, ErrInvalidDeviceKey
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil || len(y) != 32 {
+		return nil, ErrInvalidDeviceKey
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrInvalidDeviceKey
+	}
+	return pub, nil
+}
+
+// Thumbprint はRFC 7638のJWKサムプリント（SHA-256、base64url）を返す。
+func (k DeviceKey) Thumbprint() string {
+	// 必須メンバーを辞書順に並べた正規形。値はbase64urlのため追加のエスケープは不要。
+	canonical := `{"crv":"` + k.Crv + `","kty":"` + k.Kty + `","x":"` + k.X + `","y":"` + k.Y + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// verifySignature はチャレンジに対する端末鍵の署名（WebCryptoと同じ r||s の64バイト、base64url）を検証する。
+func (k DeviceKey) verifySignature(message, signature string) error {
+	pub, err := k.publicKey()
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(sig) != 64 {
+		return ErrInvalidSignature
+	}
+	digest := sha256.Sum256([]byte(message))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
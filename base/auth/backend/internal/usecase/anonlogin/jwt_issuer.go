@@ -0,0 +1,84 @@
+package anonlogin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TokenIssuer は匿名トークンの発行を抽象化する。
+type TokenIssuer interface {
+	Issue(subject, keyThumbprint string) (string, int, error)
+}
+
+// JWTIssuer はHS256で匿名トークンを発行する実装。
+type JWTIssuer struct {
+	secret    []byte
+	issuer    string
+	audience  string
+	expiresIn time.Duration
+	now       func() time.Time
+}
+
+// NewJWTIssuer はJWTIssuerを生成する。
+func NewJWTIssuer(secret []byte, issuer, audience string, expiresIn time.Duration) *JWTIssuer {
+	return &JWTIssuer{
+		secret:    append([]byte(nil), secret...),
+		issuer:    issuer,
+		audience:  audience,
+		expiresIn: expiresIn,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Issue はJWTと有効秒数を返す。
+// anonymous クレームでログインユーザーと区別し、cnf.jkt に端末鍵のサムプリントを入れる（RFC 7800）。
+func (i *JWTIssuer) Issue(subject, keyThumbprint string) (string, int, error) {
+	if len(i.secret) == 0 {
+		return "", 0, fmt.Errorf("token issuer: secret is empty")
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", 0, fmt.Errorf("token issuer: generate jti: %w", err)
+	}
+
+	now := i.now()
+	expiry := now.Add(i.expiresIn)
+
+	header := map[string]any{
+		"alg": "HS256",
+		"typ": "JWT",
+	}
+	payload := map[string]any{
+		"sub":       subject,
+		"iss":       i.issuer,
+		"iat":       now.Unix(),
+		"exp":       expiry.Unix(),
+		"jti":       base64.RawURLEncoding.EncodeToString(jti),
+		"anonymous": true,
+		"cnf":       map[string]string{"jkt": keyThumbprint},
+	}
+	if i.audience != "" {
+		payload["aud"] = i.audience
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", 0, fmt.Errorf("token issuer: marshal header: %w", err)
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", 0, fmt.Errorf("token issuer: marshal payload: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(unsigned))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return unsigned + "." + signature, int(i.expiresIn.Seconds()), nil
+}
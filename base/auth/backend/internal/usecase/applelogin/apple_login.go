@@ -0,0 +1,249 @@
+package applelogin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/appleuser"
+)
+
+var (
+	// ErrOriginRequired はオリジンが未指定の場合に返す。
+	ErrOriginRequired = errors.New("origin is required")
+	// ErrOriginNotAllowed は許可されていないオリジンの場合に返す。
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// Usecase はSign in with Appleの開始とコールバック処理を司るアプリケーションサービス。
+type Usecase struct {
+	states                StateManager
+	apple                 AppleClient
+	tokens                TokenIssuer
+	allowedOrigins        map[string]struct{}
+	defaultRedirectOrigin string
+}
+
+// StartOutput はログイン開始時の戻り値。
+type StartOutput struct {
+	AuthorizationURL string
+	State            string
+	// Nonce はstateに埋め込んだnonceで、ブラウザへの紐付けに使う。
+	Nonce string
+}
+
+// CallbackResult はコールバック処理の結果を表す。
+type CallbackResult struct {
+	Success      bool
+	State        string
+	Origin       string
+	ErrorMessage string
+	Payload      *ResultPayload
+}
+
+// ResultPayload は成功時に返すアクセストークンとユーザー情報。
+type ResultPayload struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int
+	AppleUser   AppleUserPayload
+}
+
+// AppleUserPayload はレスポンス用に整えたAppleユーザー情報。
+type AppleUserPayload struct {
+	ID          string
+	Email       string
+	DisplayName string
+}
+
+// NewUsecase はSign in with Apple用ユースケースを初期化する。
+func NewUsecase(states StateManager, apple AppleClient, tokens TokenIssuer, allowedOrigins map[string]struct{}, defaultRedirectOrigin string) *Usecase {
+	copied := make(map[string]struct{}, len(allowedOrigins))
+	for k, v := range allowedOrigins {
+		copied[k] = v
+	}
+	return &Usecase{
+		states:                states,
+		apple:                 apple,
+		tokens:                tokens,
+		allowedOrigins:        copied,
+		defaultRedirectOrigin: strings.TrimSpace(defaultRedirectOrigin),
+	}
+}
+
+// Start はstateとid_token用nonceを生成し、認可URLを返す。
+func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == "" {
+		return nil, ErrOriginRequired
+	}
+	if !u.isOriginAllowed(origin) {
+		return nil, ErrOriginNotAllowed
+	}
+
+	state, statePayload, err := u.states.Issue(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StartOutput{
+		AuthorizationURL: u.apple.BuildAuthorizeURL(state, idTokenNonce(statePayload.Nonce)),
+		State:            state,
+		Nonce:            statePayload.Nonce,
+	}, nil
+}
+
+// Callback はform_postで届いたコールバックを処理し、JWTを含む結果を返す。
+// userJSON は初回ログイン時のみAppleが送る `user` フィールド（氏名・メール）。
+func (u *Usecase) Callback(ctx context.Context, code, stateParam, userJSON string) (*CallbackResult, error) {
+	code = strings.TrimSpace(code)
+	stateParam = strings.TrimSpace(stateParam)
+
+	if code == "" || stateParam == "" {
+		origin := u.extractOrigin(stateParam)
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       origin,
+			ErrorMessage: "無効なログイン応答です。再度お試しください。",
+		}, nil
+	}
+
+	payload, err := u.states.Verify(ctx, stateParam)
+	if err != nil {
+		origin := u.extractOrigin(stateParam)
+		message := "無効なログイン試行です。再度お試しください。"
+		switch {
+		case errors.Is(err, ErrStateExpired):
+			message = "ログインの有効期限が切れました。もう一度お試しください。"
+		case errors.Is(err, ErrStateReused):
+			message = "このログイン応答は既に使用されています。もう一度お試しください。"
+		}
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       origin,
+			ErrorMessage: message,
+		}, nil
+	}
+
+	tokenResp, err := u.apple.ExchangeToken(ctx, code)
+	if err != nil {
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       payload.Origin,
+			ErrorMessage: "Apple認証との通信に失敗しました。時間を置いて再度お試しください。",
+		}, nil
+	}
+
+	claims, err := u.apple.VerifyIDToken(ctx, tokenResp.IDToken, idTokenNonce(payload.Nonce))
+	if err != nil {
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       payload.Origin,
+			ErrorMessage: "Appleの認証情報を検証できませんでした。もう一度お試しください。",
+		}, nil
+	}
+
+	first := parseFirstLoginUser(userJSON)
+	email := claims.Email
+	if email == "" {
+		email = first.Email
+	}
+	au, err := appleuser.New(claims.Subject, email, first.displayName())
+	if err != nil {
+		return nil, err
+	}
+
+	appToken, expiresIn, err := u.tokens.Issue(au)
+	if err != nil {
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       payload.Origin,
+			ErrorMessage: "アクセストークンの生成に失敗しました。",
+		}, nil
+	}
+
+	return &CallbackResult{
+		Success: true,
+		State:   stateParam,
+		Origin:  payload.Origin,
+		Payload: &ResultPayload{
+			AccessToken: appToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   expiresIn,
+			AppleUser: AppleUserPayload{
+				ID:          string(au.ID()),
+				Email:       au.Email(),
+				DisplayName: au.DisplayName(),
+			},
+		},
+	}, nil
+}
+
+// firstLoginUser は初回ログイン時にAppleがform_postで送る `user` JSON。
+type firstLoginUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// parseFirstLoginUser は `user` JSONを解釈する。欠落・不正な場合はゼロ値を返す。
+func parseFirstLoginUser(raw string) firstLoginUser {
+	var user firstLoginUser
+	if strings.TrimSpace(raw) == "" {
+		return user
+	}
+	_ = json.Unmarshal([]byte(raw), &user)
+	return user
+}
+
+func (f firstLoginUser) displayName() string {
+	return strings.TrimSpace(strings.TrimSpace(f.Name.FirstName) + " " + strings.TrimSpace(f.Name.LastName))
+}
+
+// idTokenNonce はstateのnonceからid_tokenに埋め込むnonceを導出する。
+func idTokenNonce(stateNonce string) string {
+	sum := sha256.Sum256([]byte(stateNonce))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (u *Usecase) extractOrigin(state string) string {
+	if state == "" {
+		return u.defaultRedirectOrigin
+	}
+	payload, err := u.states.Decode(state)
+	if err != nil {
+		return u.defaultRedirectOrigin
+	}
+	// 検証に失敗したstateでも署名は正しいが、許可オリジン外には戻さない。
+	if payload.Origin != "" && u.isOriginAllowed(payload.Origin) {
+		return payload.Origin
+	}
+	return u.defaultRedirectOrigin
+}
+
+// DecodeState はstateをデコードしOrigin取得に使う（handler用）。
+func (u *Usecase) DecodeState(state string) (*StatePayload, error) {
+	return u.states.Decode(state)
+}
+
+// isOriginAllowed は許可オリジンかどうかを判定する。
+func (u *Usecase) isOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if len(u.allowedOrigins) == 0 {
+		return true
+	}
+	_, ok := u.allowedOrigins[origin]
+	return ok
+}
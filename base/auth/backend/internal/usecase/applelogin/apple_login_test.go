@@ -0,0 +1,169 @@
+package applelogin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/appleuser"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+)
+
+type fakeAppleClient struct {
+	authNonce string
+	tokenErr  error
+	verifyErr error
+	subject   string
+	email     string
+}
+
+func (f *fakeAppleClient) BuildAuthorizeURL(state, nonce string) string {
+	f.authNonce = nonce
+	return "https://apple.example/auth?state=" + state
+}
+
+func (f *fakeAppleClient) ExchangeToken(ctx context.Context, code string) (*Token, error) {
+	if f.tokenErr != nil {
+		return nil, f.tokenErr
+	}
+	return &Token{AccessToken: "at", IDToken: "id-token", TokenType: "Bearer", ExpiresIn: 3600}, nil
+}
+
+// VerifyIDToken は認可URLに載せたnonceと一致する場合だけ成功する。
+func (f *fakeAppleClient) VerifyIDToken(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error) {
+	if f.verifyErr != nil {
+		return nil, f.verifyErr
+	}
+	if nonce != f.authNonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	id, err := appleuser.NewID(f.subject)
+	if err != nil {
+		return nil, err
+	}
+	return &IDTokenClaims{Subject: id, Email: f.email}, nil
+}
+
+type fakeTokenIssuer struct {
+	token string
+	err   error
+}
+
+func (f *fakeTokenIssuer) Issue(u *appleuser.User) (string, int, error) {
+	if f.err != nil {
+		return "", 0, f.err
+	}
+	return f.token, 3600, nil
+}
+
+// Callbackの主要分岐と初回ログイン時の氏名・メールの扱いをテーブル駆動で検証。
+func TestUsecase_Callback(t *testing.T) {
+	t.Parallel()
+
+	const subject = "001234.abcdef.0123"
+	tests := []struct {
+		name        string
+		client      *fakeAppleClient
+		state       string
+		userJSON    string
+		wantSuccess bool
+		wantMsg     string
+		wantUser    AppleUserPayload
+	}{
+		{
+			name:        "2回目以降はid_tokenのメールだけ",
+			client:      &fakeAppleClient{subject: subject, email: "relay@privaterelay.appleid.com"},
+			wantSuccess: true,
+			wantUser:    AppleUserPayload{ID: subject, Email: "relay@privaterelay.appleid.com"},
+		},
+		{
+			name:        "初回ログインは氏名とメールを補う",
+			client:      &fakeAppleClient{subject: subject},
+			userJSON:    `{"name":{"firstName":" Taro ","lastName":"Yamada"},"email":"taro@example.com"}`,
+			wantSuccess: true,
+			wantUser:    AppleUserPayload{ID: subject, Email: "taro@example.com", DisplayName: "Taro Yamada"},
+		},
+		{
+			name:        "id_tokenのメールを優先",
+			client:      &fakeAppleClient{subject: subject, email: "id@example.com"},
+			userJSON:    `{"name":{"firstName":"Taro"},"email":"form@example.com"}`,
+			wantSuccess: true,
+			wantUser:    AppleUserPayload{ID: subject, Email: "id@example.com", DisplayName: "Taro"},
+		},
+		{
+			name:        "不正なuserは無視",
+			client:      &fakeAppleClient{subject: subject},
+			userJSON:    `{"name":`,
+			wantSuccess: true,
+			wantUser:    AppleUserPayload{ID: subject},
+		},
+		{
+			name:    "別の秘密鍵のstate",
+			client:  &fakeAppleClient{subject: subject},
+			state:   "other",
+			wantMsg: "無効なログイン試行です。再度お試しください。",
+		},
+		{
+			name:    "stateの改ざん",
+			client:  &fakeAppleClient{subject: subject},
+			state:   "tampered",
+			wantMsg: "無効なログイン試行です。再度お試しください。",
+		},
+		{
+			name:    "token取得失敗",
+			client:  &fakeAppleClient{tokenErr: errors.New("fail")},
+			wantMsg: "Apple認証との通信に失敗しました。時間を置いて再度お試しください。",
+		},
+		{
+			name:    "id_token検証失敗",
+			client:  &fakeAppleClient{verifyErr: errors.New("bad signature")},
+			wantMsg: "Appleの認証情報を検証できませんでした。もう一度お試しください。",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
+			uc := NewUsecase(m, tt.client, &fakeTokenIssuer{token: "app-token"}, map[string]struct{}{"https://allowed": {}}, "https://fallback")
+
+			out, err := uc.Start(context.Background(), "https://allowed")
+			if err != nil {
+				t.Fatalf("Start error: %v", err)
+			}
+			state := out.State
+			switch tt.state {
+			case "other":
+				other := NewHMACStateManager([]byte("other-secret"), time.Minute, noncestore.NewMemory())
+				if state, _, err = other.Issue(context.Background(), "https://allowed"); err != nil {
+					t.Fatalf("Issue error: %v", err)
+				}
+			case "tampered":
+				state = state[:len(state)-2] + "xx"
+			}
+
+			res, err := uc.Callback(context.Background(), "code", state, tt.userJSON)
+			if err != nil {
+				t.Fatalf("Callback error: %v", err)
+			}
+			if res.Success != tt.wantSuccess {
+				t.Fatalf("success mismatch: %+v", res)
+			}
+			if tt.wantMsg != "" && res.ErrorMessage != tt.wantMsg {
+				t.Fatalf("expected message %q, got %q", tt.wantMsg, res.ErrorMessage)
+			}
+			if !tt.wantSuccess {
+				return
+			}
+			if res.Origin != "https://allowed" || res.Payload.AccessToken != "app-token" {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+			if res.Payload.AppleUser != tt.wantUser {
+				t.Fatalf("user = %+v, want %+v", res.Payload.AppleUser, tt.wantUser)
+			}
+		})
+	}
+}
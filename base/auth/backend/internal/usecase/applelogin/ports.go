@@ -0,0 +1,31 @@
+package applelogin
+
+import (
+	"context"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/appleuser"
+)
+
+// AppleClient はSign in with Appleとのやりとりを抽象化する。
+type AppleClient interface {
+	BuildAuthorizeURL(state, nonce string) string
+	ExchangeToken(ctx context.Context, code string) (*Token, error)
+	VerifyIDToken(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error)
+}
+
+// Token はAppleトークンエンドポイントの結果をユースケース向けに整形したもの。
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	TokenType    string
+	ExpiresIn    int
+}
+
+// IDTokenClaims は検証済みid_tokenのうちユースケースで使うクレーム。
+type IDTokenClaims struct {
+	Subject        appleuser.ID
+	Email          string
+	EmailVerified  bool
+	IsPrivateEmail bool
+}
@@ -0,0 +1,75 @@
+package applelogin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+)
+
+// テーブル駆動で state 発行/検証を確認。
+func TestHMACStateManager_IssueVerify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		advance time.Duration
+		reuse   bool
+		wantErr error
+	}{
+		{
+			name:    "正常: 発行したstateを即検証",
+			now:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			advance: 0,
+		},
+		{
+			name:    "期限切れ",
+			now:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			advance: 2 * time.Minute,
+			wantErr: ErrStateExpired,
+		},
+		{
+			name:    "再利用",
+			now:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			advance: 0,
+			reuse:   true,
+			wantErr: ErrStateReused,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
+			m.now = func() time.Time { return tt.now }
+
+			state, payload, err := m.Issue(context.Background(), "https://app.example.com")
+			if err != nil {
+				t.Fatalf("Issue error: %v", err)
+			}
+
+			m.now = func() time.Time { return tt.now.Add(tt.advance) }
+			if tt.reuse {
+				if _, err := m.Verify(context.Background(), state); err != nil {
+					t.Fatalf("first Verify error: %v", err)
+				}
+			}
+			verified, err := m.Verify(context.Background(), state)
+			if tt.wantErr != nil {
+				if err == nil || err != tt.wantErr {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify error: %v", err)
+			}
+			if verified.Origin != payload.Origin {
+				t.Fatalf("origin mismatch")
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package discordlogin
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/discorduser"
+)
+
+var (
+	// ErrOriginRequired はオリジンが未指定の場合に返す。
+	ErrOriginRequired = errors.New("origin is required")
+	// ErrOriginNotAllowed は許可されていないオリジンの場合に返す。
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// Usecase はDiscordログインの開始とコールバック処理を司るアプリケーションサービス。
+type Usecase struct {
+	states                StateManager
+	discord               DiscordClient
+	tokens                TokenIssuer
+	gate                  GuildGate
+	allowedOrigins        map[string]struct{}
+	defaultRedirectOrigin string
+}
+
+// StartOutput はログイン開始時の戻り値。
+type StartOutput struct {
+	AuthorizationURL string
+	State            string
+	// Nonce はstateに埋め込んだnonceで、ブラウザへの紐付けに使う。
+	Nonce string
+}
+
+// CallbackResult はコールバック処理の結果を表す。
+type CallbackResult struct {
+	Success      bool
+	State        string
+	Origin       string
+	ErrorMessage string
+	Payload      *ResultPayload
+}
+
+// ResultPayload は成功時に返すアクセストークンとユーザー情報。
+type ResultPayload struct {
+	AccessToken string
+	TokenType   string
+	ExpiresIn   int
+	DiscordUser DiscordUserPayload
+}
+
+// DiscordUserPayload はレスポンス用に整えたDiscordユーザー情報。
+type DiscordUserPayload struct {
+	ID          string
+	Username    string
+	DisplayName string
+	AvatarURL   string
+}
+
+// NewUsecase はDiscordログイン用ユースケースを初期化する。
+func NewUsecase(states StateManager, discord DiscordClient, tokens TokenIssuer, gate GuildGate, allowedOrigins map[string]struct{}, defaultRedirectOrigin string) *Usecase {
+	copied := make(map[string]struct{}, len(allowedOrigins))
+	for k, v := range allowedOrigins {
+		copied[k] = v
+	}
+	return &Usecase{
+		states:  states,
+		discord: discord,
+		tokens:  tokens,
+		gate: GuildGate{
+			GuildID:         strings.TrimSpace(gate.GuildID),
+			RequiredRoleIDs: append([]string(nil), gate.RequiredRoleIDs...),
+		},
+		allowedOrigins:        copied,
+		defaultRedirectOrigin: strings.TrimSpace(defaultRedirectOrigin),
+	}
+}
+
+// Start はstateを生成し、認可URLを返す。
+func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == "" {
+		return nil, ErrOriginRequired
+	}
+	if !u.isOriginAllowed(origin) {
+		return nil, ErrOriginNotAllowed
+	}
+
+	state, statePayload, err := u.states.Issue(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StartOutput{
+		AuthorizationURL: u.discord.BuildAuthorizeURL(state),
+		State:            state,
+		Nonce:            statePayload.Nonce,
+	}, nil
+}
+
+// Callback はDiscordからのコールバックを処理し、ギルド条件を満たせばJWTを含む結果を返す。
+func (u *Usecase) Callback(ctx context.Context, code, stateParam string) (*CallbackResult, error) {
+	code = strings.TrimSpace(code)
+	stateParam = strings.TrimSpace(stateParam)
+
+	if code == "" || stateParam == "" {
+		origin := u.extractOrigin(stateParam)
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       origin,
+			ErrorMessage: "無効なログイン応答です。再度お試しください。",
+		}, nil
+	}
+
+	payload, err := u.states.Verify(ctx, stateParam)
+	if err != nil {
+		origin := u.extractOrigin(stateParam)
+		message := "無効なログイン試行です。再度お試しください。"
+		switch {
+		case errors.Is(err, ErrStateExpired):
+			message = "ログインの有効期限が切れました。もう一度お試しください。"
+		case errors.Is(err, ErrStateReused):
+			message = "このログイン応答は既に使用されています。もう一度お試しください。"
+		}
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       origin,
+			ErrorMessage: message,
+		}, nil
+	}
+
+	failure := func(message string) *CallbackResult {
+		return &CallbackResult{
+			Success:      false,
+			State:        stateParam,
+			Origin:       payload.Origin,
+			ErrorMessage: message,
+		}
+	}
+
+	tokenResp, err := u.discord.ExchangeToken(ctx, code)
+	if err != nil {
+		return failure("Discord認証との通信に失敗しました。時間を置いて再度お試しください。"), nil
+	}
+
+	profile, err := u.discord.FetchProfile(ctx, tokenResp.AccessToken)
+	if err != nil {
+		return failure("Discordプロフィールの取得に失敗しました。"), nil
+	}
+
+	if message, ok := u.checkGuildGate(ctx, tokenResp.AccessToken); !ok {
+		return failure(message), nil
+	}
+
+	du, err := discorduser.New(profile.ID, profile.Username, profile.DisplayName, profile.AvatarURL)
+	if err != nil {
+		return nil, err
+	}
+
+	appToken, expiresIn, err := u.tokens.Issue(du)
+	if err != nil {
+		return failure("アクセストークンの生成に失敗しました。"), nil
+	}
+
+	return &CallbackResult{
+		Success: true,
+		State:   stateParam,
+		Origin:  payload.Origin,
+		Payload: &ResultPayload{
+			AccessToken: appToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   expiresIn,
+			DiscordUser: DiscordUserPayload{
+				ID:          string(du.ID()),
+				Username:    du.Username(),
+				DisplayName: du.DisplayName(),
+				AvatarURL:   du.AvatarURL(),
+			},
+		},
+	}, nil
+}
+
+// checkGuildGate はギルド参加とロール条件を確認し、満たさない場合はユーザー向け文言を返す。
+func (u *Usecase) checkGuildGate(ctx context.Context, accessToken string) (string, bool) {
+	if u.gate.GuildID == "" {
+		return "", true
+	}
+	member, err := u.discord.FetchGuildMember(ctx, accessToken, u.gate.GuildID)
+	if err != nil {
+		if errors.Is(err, ErrNotGuildMember) {
+			return "指定のDiscordサーバーに参加していないためログインできません。", false
+		}
+		return "Discordサーバーの参加状況を確認できませんでした。時間を置いて再度お試しください。", false
+	}
+	if len(u.gate.RequiredRoleIDs) == 0 {
+		return "", true
+	}
+	for _, want := range u.gate.RequiredRoleIDs {
+		for _, have := range member.Roles {
+			if want == have {
+				return "", true
+			}
+		}
+	}
+	return "必要なロールが付与されていないためログインできません。", false
+}
+
+func (u *Usecase) extractOrigin(state string) string {
+	if state == "" {
+		return u.defaultRedirectOrigin
+	}
+	payload, err := u.states.Decode(state)
+	if err != nil {
+		return u.defaultRedirectOrigin
+	}
+	// 検証に失敗したstateでも署名は正しいが、許可オリジン外には戻さない。
+	if payload.Origin != "" && u.isOriginAllowed(payload.Origin) {
+		return payload.Origin
+	}
+	return u.defaultRedirectOrigin
+}
+
+// DecodeState はstateをデコードしOrigin取得に使う（handler用）。
+func (u *Usecase) DecodeState(state string) (*StatePayload, error) {
+	return u.states.Decode(state)
+}
+
+// isOriginAllowed は許可オリジンかどうかを判定する。
+func (u *Usecase) isOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if len(u.allowedOrigins) == 0 {
+		return true
+	}
+	_, ok := u.allowedOrigins[origin]
+	return ok
+}
@@ -0,0 +1,170 @@
+package discordlogin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/discorduser"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+)
+
+type fakeDiscordClient struct {
+	authURL     string
+	tokenErr    error
+	profileErr  error
+	memberErr   error
+	memberRoles []string
+	accessToken string
+	profileID   string
+	profileName string
+	username    string
+}
+
+func (f *fakeDiscordClient) BuildAuthorizeURL(state string) string {
+	return f.authURL + "?state=" + state
+}
+
+func (f *fakeDiscordClient) ExchangeToken(ctx context.Context, code string) (*Token, error) {
+	if f.tokenErr != nil {
+		return nil, f.tokenErr
+	}
+	return &Token{
+		AccessToken: f.accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   604800,
+	}, nil
+}
+
+func (f *fakeDiscordClient) FetchProfile(ctx context.Context, accessToken string) (*Profile, error) {
+	if f.profileErr != nil {
+		return nil, f.profileErr
+	}
+	id, _ := discorduser.NewID(f.profileID)
+	return &Profile{
+		ID:          id,
+		DisplayName: f.profileName,
+		Username:    f.username,
+	}, nil
+}
+
+func (f *fakeDiscordClient) FetchGuildMember(ctx context.Context, accessToken, guildID string) (*GuildMember, error) {
+	if f.memberErr != nil {
+		return nil, f.memberErr
+	}
+	return &GuildMember{Roles: f.memberRoles}, nil
+}
+
+type fakeTokenIssuer struct {
+	token string
+	err   error
+}
+
+func (f *fakeTokenIssuer) Issue(u *discorduser.User) (string, int, error) {
+	if f.err != nil {
+		return "", 0, f.err
+	}
+	return f.token, 3600, nil
+}
+
+// Callbackの主要分岐とギルドゲートをテーブル駆動で検証。
+func TestUsecase_Callback(t *testing.T) {
+	t.Parallel()
+
+	okClient := func() *fakeDiscordClient {
+		return &fakeDiscordClient{
+			authURL:     "https://discord.example",
+			accessToken: "at",
+			profileID:   "42",
+			profileName: "Alice",
+			username:    "alice",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		client      *fakeDiscordClient
+		gate        GuildGate
+		state       string
+		wantSuccess bool
+		wantMsg     string
+	}{
+		{
+			name:        "ゲートなしで成功",
+			client:      okClient(),
+			wantSuccess: true,
+		},
+		{
+			name: "ギルド参加・ロール一致で成功",
+			client: func() *fakeDiscordClient {
+				c := okClient()
+				c.memberRoles = []string{"r1", "r2"}
+				return c
+			}(),
+			gate:        GuildGate{GuildID: "g1", RequiredRoleIDs: []string{"r2"}},
+			wantSuccess: true,
+		},
+		{
+			name: "ギルド未参加で拒否",
+			client: func() *fakeDiscordClient {
+				c := okClient()
+				c.memberErr = ErrNotGuildMember
+				return c
+			}(),
+			gate:    GuildGate{GuildID: "g1"},
+			wantMsg: "指定のDiscordサーバーに参加していないためログインできません。",
+		},
+		{
+			name: "ロール不足で拒否",
+			client: func() *fakeDiscordClient {
+				c := okClient()
+				c.memberRoles = []string{"r1"}
+				return c
+			}(),
+			gate:    GuildGate{GuildID: "g1", RequiredRoleIDs: []string{"admin"}},
+			wantMsg: "必要なロールが付与されていないためログインできません。",
+		},
+		{
+			name:    "state検証失敗",
+			client:  &fakeDiscordClient{},
+			state:   "invalid",
+			wantMsg: "無効なログイン試行です。再度お試しください。",
+		},
+		{
+			name:    "token取得失敗",
+			client:  &fakeDiscordClient{tokenErr: errors.New("fail")},
+			wantMsg: "Discord認証との通信に失敗しました。時間を置いて再度お試しください。",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
+			uc := NewUsecase(m, tt.client, &fakeTokenIssuer{token: "app-token"}, tt.gate, map[string]struct{}{"https://allowed": {}}, "https://fallback")
+
+			state := tt.state
+			if state == "" {
+				out, err := uc.Start(context.Background(), "https://allowed")
+				if err != nil {
+					t.Fatalf("Start error: %v", err)
+				}
+				state = out.State
+			}
+
+			res, err := uc.Callback(context.Background(), "code", state)
+			if err != nil {
+				t.Fatalf("Callback error: %v", err)
+			}
+			if res.Success != tt.wantSuccess {
+				t.Fatalf("success mismatch: %+v", res)
+			}
+			if tt.wantMsg != "" && res.ErrorMessage != tt.wantMsg {
+				t.Fatalf("expected message %q, got %q", tt.wantMsg, res.ErrorMessage)
+			}
+		})
+	}
+}
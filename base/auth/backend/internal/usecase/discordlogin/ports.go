@@ -0,0 +1,48 @@
+package discordlogin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/discorduser"
+)
+
+// ErrNotGuildMember は指定ギルドにユーザーが参加していない場合に返す。
+var ErrNotGuildMember = errors.New("discord: not a guild member")
+
+// DiscordClient はDiscord OAuth2 APIとのやりとりを抽象化する。
+type DiscordClient interface {
+	BuildAuthorizeURL(state string) string
+	ExchangeToken(ctx context.Context, code string) (*Token, error)
+	FetchProfile(ctx context.Context, accessToken string) (*Profile, error)
+	FetchGuildMember(ctx context.Context, accessToken, guildID string) (*GuildMember, error)
+}
+
+// Token はDiscordトークンエンドポイントの結果をユースケース向けに整形したもの。
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	ExpiresIn    int
+	Scope        string
+}
+
+// Profile はDiscordの /users/@me の結果をユースケース向けに整形したもの。
+type Profile struct {
+	ID          discorduser.ID
+	DisplayName string
+	Username    string
+	AvatarURL   string
+}
+
+// GuildMember はギルドメンバー情報のうちゲート判定に使う部分。
+type GuildMember struct {
+	Roles []string
+}
+
+// GuildGate はトークン発行前に課すギルド参加・ロール条件。
+// GuildID が空ならゲートしない。RequiredRoleIDs はいずれか1つを持っていれば通過する。
+type GuildGate struct {
+	GuildID         string
+	RequiredRoleIDs []string
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
@@ -16,19 +17,33 @@ type TokenIssuer interface {
 	Issue(u *lineuser.User) (string, int, error)
 }
 
+// ProfileClaim は追加のプロフィール項目をJWTのクレームへ写す設定。
+// Field は上流APIのフィールド名で、ネストした値は "public_metrics.followers_count" のようにドットでたどる。
+type ProfileClaim struct {
+	Field string
+	Claim string
+}
+
 // JWTIssuer はHS256でJWTを発行する実装。
 type JWTIssuer struct {
-	secret    []byte
+	secrets   []Secret
 	issuer    string
 	audience  string
 	expiresIn time.Duration
+	claims    []ProfileClaim
 	now       func() time.Time
 }
 
 // NewJWTIssuer はJWTIssuerを生成する。
 func NewJWTIssuer(secret []byte, issuer, audience string, expiresIn time.Duration) *JWTIssuer {
+	return NewRotatingJWTIssuer([]Secret{{Value: secret}}, issuer, audience, expiresIn)
+}
+
+// NewRotatingJWTIssuer は複数の鍵を持つJWTIssuerを生成する。
+// 有効な鍵のうち先頭で署名し、IDがあれば kid に入れる。検証する側は kid で鍵を選べる。
+func NewRotatingJWTIssuer(secrets []Secret, issuer, audience string, expiresIn time.Duration) *JWTIssuer {
 	return &JWTIssuer{
-		secret:    append([]byte(nil), secret...),
+		secrets:   copySecrets(secrets),
 		issuer:    issuer,
 		audience:  audience,
 		expiresIn: expiresIn,
@@ -36,18 +51,28 @@ func NewJWTIssuer(secret []byte, issuer, audience string, expiresIn time.Duratio
 	}
 }
 
-func (i *JWTIssuer) Issue(u *lineuser.User) (string, int, error) {
-	if len(i.secret) == 0 {
-		return "", 0, fmt.Errorf("token issuer: secret is empty")
-	}
+// WithProfileClaims はユーザーの追加プロフィール項目をクレームに含めるよう設定する。
+func (i *JWTIssuer) WithProfileClaims(claims []ProfileClaim) *JWTIssuer {
+	i.claims = append([]ProfileClaim(nil), claims...)
+	return i
+}
 
+func (i *JWTIssuer) Issue(u *lineuser.User) (string, int, error) {
 	now := i.now()
+	active := activeSecrets(i.secrets, now)
+	if len(active) == 0 {
+		return "", 0, fmt.Errorf("token issuer: no active secret")
+	}
+	secret := active[0]
 	expiry := now.Add(i.expiresIn)
 
 	header := map[string]any{
 		"alg": "HS256",
 		"typ": "JWT",
 	}
+	if secret.ID != "" {
+		header["kid"] = secret.ID
+	}
 	payload := map[string]any{
 		"sub": u.ID(),
 		"iss": i.issuer,
@@ -63,6 +88,11 @@ func (i *JWTIssuer) Issue(u *lineuser.User) (string, int, error) {
 	if i.audience != "" {
 		payload["aud"] = i.audience
 	}
+	for _, c := range i.claims {
+		if v, ok := lookupAttribute(u.Attributes(), c.Field); ok {
+			payload[c.Claim] = v
+		}
+	}
 
 	headerJSON, err := json.Marshal(header)
 	if err != nil {
@@ -74,9 +104,28 @@ func (i *JWTIssuer) Issue(u *lineuser.User) (string, int, error) {
 	}
 
 	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
-	mac := hmac.New(sha256.New, i.secret)
-	mac.Write([]byte(unsigned))
-	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	signature := base64.RawURLEncoding.EncodeToString(signJWT(secret.Value, unsigned))
 
 	return unsigned + "." + signature, int(i.expiresIn.Seconds()), nil
 }
+
+// lookupAttribute はドット区切りのパスでプロフィール項目をたどる。
+func lookupAttribute(attrs map[string]any, field string) (any, bool) {
+	var cur any = attrs
+	for _, key := range strings.Split(field, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func signJWT(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,130 @@
+package linelogin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
+)
+
+// decodeHS256 はJWTの署名を secret で確かめ、ヘッダとクレームを返す。
+func decodeHS256(t *testing.T, token string, secret []byte) (map[string]any, map[string]any) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed token: %s", token)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		t.Fatalf("signature does not match secret %q", secret)
+	}
+	decode := func(part string) map[string]any {
+		raw, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var out map[string]any
+		if err := json.Unmarshal(raw, &out); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return out
+	}
+	return decode(parts[0]), decode(parts[1])
+}
+
+// 有効な鍵のうち先頭で署名し、鍵のIDを kid に入れることを確認する。
+func TestJWTIssuer_Rotation(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	id, err := lineuser.NewID("U1")
+	if err != nil {
+		t.Fatalf("NewID error: %v", err)
+	}
+	user, err := lineuser.New(id, "Taro", "")
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	oldKey := Secret{ID: "2024", Value: []byte("old-secret"), ExpiresAt: now.Add(2 * time.Hour)}
+	newKey := Secret{ID: "2025", Value: []byte("new-secret")}
+	expiredKey := Secret{ID: "2023", Value: []byte("expired-secret"), ExpiresAt: now}
+	tests := []struct {
+		name       string
+		secrets    []Secret
+		wantSecret []byte
+		wantKid    string
+		wantErr    bool
+	}{
+		{name: "先頭の鍵で署名", secrets: []Secret{newKey, oldKey}, wantSecret: newKey.Value, wantKid: "2025"},
+		{name: "期限切れの鍵は飛ばす", secrets: []Secret{expiredKey, oldKey}, wantSecret: oldKey.Value, wantKid: "2024"},
+		{name: "IDがなければkidなし", secrets: []Secret{{Value: []byte("single")}}, wantSecret: []byte("single")},
+		{name: "有効な鍵がない", secrets: []Secret{expiredKey}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			i := NewRotatingJWTIssuer(tt.secrets, "roots-auth", "app", time.Hour)
+			i.now = func() time.Time { return now }
+			token, _, err := i.Issue(user)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Issue error: %v", err)
+			}
+			header, claims := decodeHS256(t, token, tt.wantSecret)
+			if kid, _ := header["kid"].(string); kid != tt.wantKid {
+				t.Fatalf("kid=%q want %q", kid, tt.wantKid)
+			}
+			if claims["sub"] != "U1" || claims["iss"] != "roots-auth" || claims["aud"] != "app" {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+		})
+	}
+}
+
+// 追加のプロフィール項目が設定したクレーム名で入ることを確認する。
+func TestJWTIssuer_ProfileClaims(t *testing.T) {
+	t.Parallel()
+
+	id, err := lineuser.NewID("U1")
+	if err != nil {
+		t.Fatalf("NewID error: %v", err)
+	}
+	user, err := lineuser.New(id, "Taro", "")
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	user = user.WithAttributes(map[string]any{
+		"statusMessage": "hello",
+		"metrics":       map[string]any{"friends": float64(3)},
+	})
+
+	i := NewJWTIssuer([]byte("secret"), "roots-auth", "", time.Hour).WithProfileClaims([]ProfileClaim{
+		{Field: "statusMessage", Claim: "https://app.example.com/status"},
+		{Field: "metrics.friends", Claim: "https://app.example.com/friends"},
+		{Field: "missing", Claim: "https://app.example.com/missing"},
+	})
+	token, _, err := i.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	_, claims := decodeHS256(t, token, []byte("secret"))
+	if claims["https://app.example.com/status"] != "hello" || claims["https://app.example.com/friends"] != float64(3) {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	if _, ok := claims["https://app.example.com/missing"]; ok {
+		t.Fatalf("missing field should not be set: %v", claims)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 var (
@@ -22,12 +24,15 @@ type Usecase struct {
 	tokens                TokenIssuer
 	allowedOrigins        map[string]struct{}
 	defaultRedirectOrigin string
+	vault                 TokenVault
 }
 
 // StartOutput はログイン開始時の戻り値。
 type StartOutput struct {
 	AuthorizationURL string
 	State            string
+	// Nonce はstateに埋め込んだnonceで、ブラウザへの紐付けに使う。
+	Nonce string
 }
 
 // CallbackResult はコールバック処理の結果を表す。
@@ -69,6 +74,12 @@ func NewUsecase(states StateManager, line LineClient, tokens TokenIssuer, allowe
 	}
 }
 
+// WithTokenVault はログイン時にLINEのトークンを保管するよう設定する。
+func (u *Usecase) WithTokenVault(v TokenVault) *Usecase {
+	u.vault = v
+	return u
+}
+
 func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error) {
 	origin = strings.TrimSpace(origin)
 	if origin == "" {
@@ -78,7 +89,7 @@ func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error
 		return nil, ErrOriginNotAllowed
 	}
 
-	state, _, err := u.states.Issue(origin)
+	state, statePayload, err := u.states.Issue(ctx, origin)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +97,7 @@ func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error
 	return &StartOutput{
 		AuthorizationURL: u.line.BuildAuthorizeURL(state),
 		State:            state,
+		Nonce:            statePayload.Nonce,
 	}, nil
 }
 
@@ -103,12 +115,15 @@ func (u *Usecase) Callback(ctx context.Context, code, stateParam string) (*Callb
 		}, nil
 	}
 
-	payload, err := u.states.Verify(stateParam)
+	payload, err := u.states.Verify(ctx, stateParam)
 	if err != nil {
 		origin := u.extractOrigin(stateParam)
 		message := "無効なログイン試行です。再度お試しください。"
-		if errors.Is(err, ErrStateExpired) {
+		switch {
+		case errors.Is(err, ErrStateExpired):
 			message = "ログインの有効期限が切れました。もう一度お試しください。"
+		case errors.Is(err, ErrStateReused):
+			message = "このログイン応答は既に使用されています。もう一度お試しください。"
 		}
 		return &CallbackResult{
 			Success:      false,
@@ -142,6 +157,30 @@ func (u *Usecase) Callback(ctx context.Context, code, stateParam string) (*Callb
 	if err != nil {
 		return nil, err
 	}
+	if len(profile.Attributes) > 0 {
+		uProfile = uProfile.WithAttributes(profile.Attributes)
+	}
+
+	if u.vault != nil {
+		var expiresAt time.Time
+		if tokenResp.ExpiresIn > 0 {
+			expiresAt = time.Now().UTC().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+		}
+		if err := u.vault.Save(ctx, "line", string(uProfile.ID()), tokenvault.Token{
+			AccessToken:  tokenResp.AccessToken,
+			RefreshToken: tokenResp.RefreshToken,
+			TokenType:    tokenResp.TokenType,
+			Scope:        tokenResp.Scope,
+			ExpiresAt:    expiresAt,
+		}); err != nil {
+			return &CallbackResult{
+				Success:      false,
+				State:        stateParam,
+				Origin:       payload.Origin,
+				ErrorMessage: "ログイン情報の保存に失敗しました。時間を置いて再度お試しください。",
+			}, nil
+		}
+	}
 
 	appToken, expiresIn, err := u.tokens.Issue(uProfile)
 	if err != nil {
@@ -178,12 +217,18 @@ func (u *Usecase) extractOrigin(state string) string {
 	if err != nil {
 		return u.defaultRedirectOrigin
 	}
-	if payload.Origin != "" {
+	// 検証に失敗したstateでも署名は正しいが、許可オリジン外には戻さない。
+	if payload.Origin != "" && u.isOriginAllowed(payload.Origin) {
 		return payload.Origin
 	}
 	return u.defaultRedirectOrigin
 }
 
+// DecodeState はstateをデコードしOrigin取得に使う（handler用）。
+func (u *Usecase) DecodeState(state string) (*StatePayload, error) {
+	return u.states.Decode(state)
+}
+
 // isOriginAllowed は許可オリジンかどうかを判定する。
 func (u *Usecase) isOriginAllowed(origin string) bool {
 	if origin == "" {
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 type fakeLineClient struct {
@@ -58,11 +60,24 @@ func (f *fakeTokenIssuer) Issue(u *lineuser.User) (string, int, error) {
 	return f.token, 3600, nil
 }
 
+type fakeTokenVault struct {
+	err   error
+	saved []string
+}
+
+func (f *fakeTokenVault) Save(ctx context.Context, provider, subject string, token tokenvault.Token) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.saved = append(f.saved, provider+":"+subject+":"+token.AccessToken)
+	return nil
+}
+
 // テーブル駆動で Start/Callback の主要分岐を検証。
 func TestUsecase_Flows(t *testing.T) {
 	t.Parallel()
 
-	stateMgr := NewHMACStateManager([]byte("secret"), time.Minute)
+	stateMgr := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
 	stateMgr.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
 
 	tests := []struct {
@@ -92,6 +107,17 @@ func TestUsecase_Flows(t *testing.T) {
 			code:        "code",
 			wantSuccess: true,
 		},
+		{
+			name: "Callback: トークンの保管に失敗するとログインも失敗",
+			setup: func() *Usecase {
+				return NewUsecase(stateMgr, &fakeLineClient{accessToken: "at", profileID: "U123"}, &fakeTokenIssuer{token: "app-token"}, nil, "https://fallback").
+					WithTokenVault(&fakeTokenVault{err: errors.New("kv down")})
+			},
+			state:       mustIssueState(stateMgr, "https://origin"),
+			code:        "code",
+			wantSuccess: false,
+			wantMessage: "ログイン情報の保存に失敗しました。時間を置いて再度お試しください。",
+		},
 		{
 			name: "Callback: state検証失敗でエラー文言",
 			setup: func() *Usecase {
@@ -157,8 +183,26 @@ func TestUsecase_Flows(t *testing.T) {
 	}
 }
 
+// ログイン成功時にLINEのアクセストークンを保管することを確認する。
+func TestUsecase_CallbackSavesToken(t *testing.T) {
+	t.Parallel()
+
+	stateMgr := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
+	vault := &fakeTokenVault{}
+	uc := NewUsecase(stateMgr, &fakeLineClient{accessToken: "line-at", profileID: "U123"}, &fakeTokenIssuer{token: "app-token"}, nil, "https://fallback").
+		WithTokenVault(vault)
+
+	res, err := uc.Callback(context.Background(), "code", mustIssueState(stateMgr, "https://origin"))
+	if err != nil || !res.Success {
+		t.Fatalf("Callback: %+v %v", res, err)
+	}
+	if len(vault.saved) != 1 || vault.saved[0] != "line:U123:line-at" {
+		t.Fatalf("unexpected saved tokens: %v", vault.saved)
+	}
+}
+
 func mustIssueState(m *HMACStateManager, origin string) string {
-	state, _, err := m.Issue(origin)
+	state, _, err := m.Issue(context.Background(), origin)
 	if err != nil {
 		panic(err)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/lineuser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 // LineClient はLINE OAuth/API呼び出しのポート定義。
@@ -15,9 +16,11 @@ type LineClient interface {
 
 // LineToken はLINEトークンエンドポイントの応答をユースケース向けにまとめたもの。
 type LineToken struct {
-	AccessToken string
-	ExpiresIn   int
-	TokenType   string
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+	TokenType    string
+	Scope        string
 }
 
 // LineProfile はLINEプロフィールAPIの結果をユースケース向けに整形したもの。
@@ -25,4 +28,11 @@ type LineProfile struct {
 	ID          lineuser.ID
 	DisplayName string
 	AvatarURL   string
+	// Attributes はテナント設定で残すよう指定したフィールド（statusMessage など、APIのフィールド名がキー）。
+	Attributes map[string]any
+}
+
+// TokenVault は上流のトークンを後のAPI呼び出しのために保管する。
+type TokenVault interface {
+	Save(ctx context.Context, provider, subject string, token tokenvault.Token) error
 }
@@ -0,0 +1,35 @@
+package linelogin
+
+import "time"
+
+// Secret はstate・JWTの署名に使う共有鍵1件。
+// ID はJWTヘッダの kid に入れる任意の識別子。ExpiresAt を過ぎた鍵は署名にも検証にも使わない（ゼロ値は無期限）。
+type Secret struct {
+	ID        string
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+// activeSecrets は now 時点で有効な鍵を設定順に返す。先頭が署名用になる。
+func activeSecrets(secrets []Secret, now time.Time) []Secret {
+	active := make([]Secret, 0, len(secrets))
+	for _, s := range secrets {
+		if len(s.Value) == 0 {
+			continue
+		}
+		if !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt) {
+			continue
+		}
+		active = append(active, s)
+	}
+	return active
+}
+
+func copySecrets(secrets []Secret) []Secret {
+	out := make([]Secret, 0, len(secrets))
+	for _, s := range secrets {
+		s.Value = append([]byte(nil), s.Value...)
+		out = append(out, s)
+	}
+	return out
+}
@@ -1,6 +1,7 @@
 package linelogin
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -17,6 +18,8 @@ var (
 	ErrInvalidState = errors.New("state: invalid")
 	// ErrStateExpired はstateがTTLを超過している場合に返される。
 	ErrStateExpired = errors.New("state: expired")
+	// ErrStateReused は消費済みのstateが再度使われた場合に返される。
+	ErrStateReused = errors.New("state: already used")
 )
 
 // StatePayload はstateに埋め込む情報を表す。
@@ -28,28 +31,48 @@ type StatePayload struct {
 
 // StateManager はstateの発行・検証の抽象。
 type StateManager interface {
-	Issue(origin string) (string, *StatePayload, error)
-	Verify(state string) (*StatePayload, error)
+	Issue(ctx context.Context, origin string) (string, *StatePayload, error)
+	Verify(ctx context.Context, state string) (*StatePayload, error)
 	Decode(state string) (*StatePayload, error)
 }
 
+// NonceStore はstateのnonceをTTL付きで記録し、一度だけ消費させるストア。
+type NonceStore interface {
+	Remember(ctx context.Context, nonce string, ttl time.Duration) error
+	Consume(ctx context.Context, nonce string) (bool, error)
+}
+
 // HMACStateManager はHMAC署名されたstateを扱う実装。
 type HMACStateManager struct {
-	secret []byte
-	ttl    time.Duration
-	now    func() time.Time
+	secrets []Secret
+	ttl     time.Duration
+	nonces  NonceStore
+	now     func() time.Time
 }
 
 // NewHMACStateManager はHMACベースのStateManagerを生成する。
-func NewHMACStateManager(secret []byte, ttl time.Duration) *HMACStateManager {
+// nonces には発行済みnonceを記録するストアを渡し、stateの再利用を防ぐ。
+func NewHMACStateManager(secret []byte, ttl time.Duration, nonces NonceStore) *HMACStateManager {
+	return NewRotatingHMACStateManager([]Secret{{Value: secret}}, ttl, nonces)
+}
+
+// NewRotatingHMACStateManager は複数の鍵を持つStateManagerを生成する。
+// 有効な鍵のうち先頭で署名し、すべての有効な鍵で検証するため、鍵を入れ替えても発行済みのstateが使える。
+func NewRotatingHMACStateManager(secrets []Secret, ttl time.Duration, nonces NonceStore) *HMACStateManager {
 	return &HMACStateManager{
-		secret: append([]byte(nil), secret...),
-		ttl:    ttl,
-		now:    func() time.Time { return time.Now().UTC() },
+		secrets: copySecrets(secrets),
+		ttl:     ttl,
+		nonces:  nonces,
+		now:     func() time.Time { return time.Now().UTC() },
 	}
 }
 
-func (m *HMACStateManager) Issue(origin string) (string, *StatePayload, error) {
+func (m *HMACStateManager) Issue(ctx context.Context, origin string) (string, *StatePayload, error) {
+	active := activeSecrets(m.secrets, m.now())
+	if len(active) == 0 {
+		return "", nil, errors.New("state: no active secret")
+	}
+
 	nonce, err := randomString(32)
 	if err != nil {
 		return "", nil, fmt.Errorf("state: failed to generate nonce: %w", err)
@@ -60,17 +83,18 @@ func (m *HMACStateManager) Issue(origin string) (string, *StatePayload, error) {
 		Origin:   origin,
 		Nonce:    nonce,
 	}
+	if err := m.nonces.Remember(ctx, nonce, m.ttl); err != nil {
+		return "", nil, fmt.Errorf("state: failed to record nonce: %w", err)
+	}
 
 	serialized := fmt.Sprintf("%d|%s|%s", payload.IssuedAt.Unix(), origin, nonce)
-	mac := hmac.New(sha256.New, m.secret)
-	mac.Write([]byte(serialized))
-	signature := mac.Sum(nil)
+	signature := signState(active[0].Value, serialized)
 
 	state := fmt.Sprintf("%s|%s", serialized, base64.RawURLEncoding.EncodeToString(signature))
 	return base64.RawURLEncoding.EncodeToString([]byte(state)), payload, nil
 }
 
-func (m *HMACStateManager) Verify(state string) (*StatePayload, error) {
+func (m *HMACStateManager) Verify(ctx context.Context, state string) (*StatePayload, error) {
 	payload, err := m.Decode(state)
 	if err != nil {
 		return nil, err
@@ -78,6 +102,13 @@ func (m *HMACStateManager) Verify(state string) (*StatePayload, error) {
 	if m.now().Sub(payload.IssuedAt) > m.ttl {
 		return nil, ErrStateExpired
 	}
+	consumed, err := m.nonces.Consume(ctx, payload.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("state: failed to consume nonce: %w", err)
+	}
+	if !consumed {
+		return nil, ErrStateReused
+	}
 	return payload, nil
 }
 
@@ -93,17 +124,20 @@ func (m *HMACStateManager) Decode(state string) (*StatePayload, error) {
 
 	issuedAtRaw, origin, nonce, sigRaw := parts[0], parts[1], parts[2], parts[3]
 
-	expected := fmt.Sprintf("%s|%s|%s", issuedAtRaw, origin, nonce)
-	mac := hmac.New(sha256.New, m.secret)
-	mac.Write([]byte(expected))
-	expectedSig := mac.Sum(nil)
-
 	providedSig, err := base64.RawURLEncoding.DecodeString(sigRaw)
 	if err != nil {
 		return nil, ErrInvalidState
 	}
 
-	if !hmac.Equal(providedSig, expectedSig) {
+	expected := fmt.Sprintf("%s|%s|%s", issuedAtRaw, origin, nonce)
+	verified := false
+	for _, secret := range activeSecrets(m.secrets, m.now()) {
+		if hmac.Equal(providedSig, signState(secret.Value, expected)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
 		return nil, ErrInvalidState
 	}
 
@@ -119,6 +153,12 @@ func (m *HMACStateManager) Decode(state string) (*StatePayload, error) {
 	}, nil
 }
 
+func signState(secret []byte, serialized string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(serialized))
+	return mac.Sum(nil)
+}
+
 // randomString は指定バイト長のランダム文字列を生成する。
 func randomString(length int) (string, error) {
 	buf := make([]byte, length)
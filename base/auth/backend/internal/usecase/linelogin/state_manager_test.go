@@ -1,8 +1,11 @@
 package linelogin
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
 )
 
 // テーブル駆動で Issue/Verify の正常系と期限切れを検証する。
@@ -17,6 +20,7 @@ func TestHMACStateManager_IssueVerify(t *testing.T) {
 		name    string
 		now     time.Time
 		advance time.Duration
+		reuse   bool
 		wantErr error
 	}{
 		{
@@ -30,6 +34,13 @@ func TestHMACStateManager_IssueVerify(t *testing.T) {
 			advance: 2 * time.Minute,
 			wantErr: ErrStateExpired,
 		},
+		{
+			name:    "再利用: 消費済みstateでエラー",
+			now:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			advance: 0,
+			reuse:   true,
+			wantErr: ErrStateReused,
+		},
 	}
 
 	for _, tt := range tests {
@@ -37,10 +48,10 @@ func TestHMACStateManager_IssueVerify(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			m := NewHMACStateManager([]byte("secret"), time.Minute)
+			m := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
 			m.now = func() time.Time { return tt.now }
 
-			state, payload, err := m.Issue("https://app.example.com")
+			state, payload, err := m.Issue(context.Background(), "https://app.example.com")
 			if err != nil {
 				t.Fatalf("Issue error: %v", err)
 			}
@@ -49,7 +60,12 @@ func TestHMACStateManager_IssueVerify(t *testing.T) {
 			}
 
 			m.now = func() time.Time { return tt.now.Add(tt.advance) }
-			verified, err := m.Verify(state)
+			if tt.reuse {
+				if _, err := m.Verify(context.Background(), state); err != nil {
+					t.Fatalf("first Verify error: %v", err)
+				}
+			}
+			verified, err := m.Verify(context.Background(), state)
 			if tt.wantErr != nil {
 				if err == nil || err != tt.wantErr {
 					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
@@ -65,3 +81,49 @@ func TestHMACStateManager_IssueVerify(t *testing.T) {
 		})
 	}
 }
+
+// 鍵の入れ替え中は旧鍵で署名したstateも検証でき、期限切れの鍵は使われないことを確認する。
+func TestHMACStateManager_Rotation(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldKey := Secret{ID: "old", Value: []byte("old-secret"), ExpiresAt: now.Add(time.Hour)}
+	newKey := Secret{ID: "new", Value: []byte("new-secret")}
+
+	before := NewRotatingHMACStateManager([]Secret{oldKey}, time.Minute, noncestore.NewMemory())
+	before.now = func() time.Time { return now }
+	state, _, err := before.Issue(context.Background(), "https://app.example.com")
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		secrets []Secret
+		at      time.Time
+		wantErr error
+	}{
+		{name: "新しい鍵を先頭に追加しても旧鍵のstateを検証できる", secrets: []Secret{newKey, oldKey}, at: now},
+		{name: "期限切れの旧鍵では検証しない", secrets: []Secret{newKey, oldKey}, at: now.Add(time.Hour), wantErr: ErrInvalidState},
+		{name: "旧鍵を外すと検証できない", secrets: []Secret{newKey}, at: now, wantErr: ErrInvalidState},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := NewRotatingHMACStateManager(tt.secrets, time.Hour*2, noncestore.NewMemory())
+			m.now = func() time.Time { return tt.at }
+			_, err := m.Decode(state)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// 全鍵が期限切れなら発行できない。
+	expired := NewRotatingHMACStateManager([]Secret{oldKey}, time.Minute, noncestore.NewMemory())
+	expired.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, _, err := expired.Issue(context.Background(), "https://app.example.com"); err == nil {
+		t.Fatal("expected error when all secrets expired")
+	}
+}
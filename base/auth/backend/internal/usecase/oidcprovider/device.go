@@ -0,0 +1,313 @@
+package oidcprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrDeviceCodeNotFound はユーザーコードが未登録・期限切れ・処理済みの場合に返す。
+var ErrDeviceCodeNotFound = errors.New("oidc: device code not found")
+
+const (
+	// grantTypeDeviceCode は RFC 8628 のデバイスコードグラント。
+	grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	defaultDeviceCodeTTL      = 10 * time.Minute
+	defaultDevicePollInterval = 5 * time.Second
+
+	keyPrefixDevice     = "oidc.device."
+	keyPrefixUserCode   = "oidc.ucode."
+	keyPrefixDevicePoll = "oidc.dpoll."
+
+	// userCodeAlphabet は読み間違えにくい子音のみの文字集合（RFC 8628 6.1）。
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+// DeviceClient はデバイスフローでログインするCLIなどの公開クライアント。
+type DeviceClient struct {
+	ID   string
+	Name string
+}
+
+// DeviceInput は /device/code のフォームパラメータ。
+type DeviceInput struct {
+	ClientID string
+	Scope    string
+}
+
+// DeviceAuthorization は /device/code の応答（RFC 8628 3.2）。
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceRequest はユーザーの承認を待っているデバイス認可。
+type DeviceRequest struct {
+	UserCode   string
+	ClientID   string
+	ClientName string
+}
+
+// DeviceToken は上流ログインで発行されたJWT。承認後のポーリングでそのまま返す。
+type DeviceToken struct {
+	AccessToken string `json:"accessToken"`
+	TokenType   string `json:"tokenType"`
+	ExpiresIn   int    `json:"expiresIn"`
+}
+
+// deviceGrant はデバイスコードに紐づく状態。
+type deviceGrant struct {
+	ClientID   string      `json:"clientId"`
+	ClientName string      `json:"clientName,omitempty"`
+	Scopes     []string    `json:"scopes"`
+	UserCode   string      `json:"userCode"`
+	Status     string      `json:"status"`
+	ExpiresAt  int64       `json:"expiresAt"`
+	Identity   Identity    `json:"identity"`
+	Token      DeviceToken `json:"token"`
+	AuthTime   int64       `json:"authTime,omitempty"`
+}
+
+// StartDevice はデバイスコードとユーザーコードを発行する。
+func (p *Provider) StartDevice(ctx context.Context, in DeviceInput) (*DeviceAuthorization, error) {
+	client, ok := p.deviceClients[strings.TrimSpace(in.ClientID)]
+	if !ok || client.ID == "" {
+		return nil, newError(ErrCodeInvalidClient, "unknown client_id")
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := p.now().Add(p.deviceCodeTTL)
+	grant := deviceGrant{
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scopes:     filterScopes(in.Scope),
+		UserCode:   userCode,
+		Status:     deviceStatusPending,
+		ExpiresAt:  expiresAt.Unix(),
+	}
+	if err := p.put(ctx, keyPrefixDevice+deviceCode, grant, p.deviceCodeTTL); err != nil {
+		return nil, err
+	}
+	if err := p.store.Put(ctx, keyPrefixUserCode+userCode, []byte(deviceCode), p.deviceCodeTTL); err != nil {
+		return nil, fmt.Errorf("oidc: store user code: %w", err)
+	}
+
+	verificationURI := p.issuer + "/device"
+	display := formatUserCode(userCode)
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(display),
+		ExpiresIn:               int(p.deviceCodeTTL.Seconds()),
+		Interval:                int(p.devicePollInterval.Seconds()),
+	}, nil
+}
+
+// LookupDevice は承認待ちのユーザーコードを確認する。ユーザーコードは大文字小文字・区切りを問わない。
+func (p *Provider) LookupDevice(ctx context.Context, userCode string) (*DeviceRequest, error) {
+	code := normalizeUserCode(userCode)
+	if code == "" {
+		return nil, ErrDeviceCodeNotFound
+	}
+	raw, ok, err := p.store.Get(ctx, keyPrefixUserCode+code)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: get user code: %w", err)
+	}
+	if !ok {
+		return nil, ErrDeviceCodeNotFound
+	}
+	grant, ok, err := p.getDeviceGrant(ctx, string(raw))
+	if err != nil {
+		return nil, err
+	}
+	if !ok || grant.Status != deviceStatusPending {
+		return nil, ErrDeviceCodeNotFound
+	}
+	return &DeviceRequest{UserCode: formatUserCode(code), ClientID: grant.ClientID, ClientName: grant.ClientName}, nil
+}
+
+// ApproveDevice は上流ログインで認証されたユーザーでデバイス認可を承認する。ユーザーコードは1回限り有効。
+func (p *Provider) ApproveDevice(ctx context.Context, userCode string, identity Identity, token DeviceToken) error {
+	return p.finishDevice(ctx, userCode, func(grant *deviceGrant) {
+		grant.Status = deviceStatusApproved
+		grant.Identity = identity
+		grant.Token = token
+		grant.AuthTime = p.now().Unix()
+	})
+}
+
+// DenyDevice は上流ログインが失敗・キャンセルされたデバイス認可を拒否する。
+func (p *Provider) DenyDevice(ctx context.Context, userCode string) error {
+	return p.finishDevice(ctx, userCode, func(grant *deviceGrant) {
+		grant.Status = deviceStatusDenied
+	})
+}
+
+func (p *Provider) finishDevice(ctx context.Context, userCode string, update func(*deviceGrant)) error {
+	code := normalizeUserCode(userCode)
+	if code == "" {
+		return ErrDeviceCodeNotFound
+	}
+	raw, ok, err := p.store.Take(ctx, keyPrefixUserCode+code)
+	if err != nil {
+		return fmt.Errorf("oidc: take user code: %w", err)
+	}
+	if !ok {
+		return ErrDeviceCodeNotFound
+	}
+	deviceCode := string(raw)
+	grant, ok, err := p.getDeviceGrant(ctx, deviceCode)
+	if err != nil {
+		return err
+	}
+	if !ok || grant.Status != deviceStatusPending {
+		return ErrDeviceCodeNotFound
+	}
+	remaining := time.Unix(grant.ExpiresAt, 0).Sub(p.now())
+	if remaining <= 0 {
+		return ErrDeviceCodeNotFound
+	}
+	update(grant)
+	return p.put(ctx, keyPrefixDevice+deviceCode, grant, remaining)
+}
+
+// exchangeDeviceCode はポーリングに応答する。承認済みなら上流ログインのJWTを1回だけ返す。
+func (p *Provider) exchangeDeviceCode(ctx context.Context, in TokenInput) (*TokenResponse, error) {
+	client, ok := p.deviceClients[strings.TrimSpace(in.ClientID)]
+	if !ok || client.ID == "" || in.ClientSecret != "" {
+		return nil, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+	if in.DeviceCode == "" {
+		return nil, newError(ErrCodeInvalidRequest, "device_code is required")
+	}
+
+	grant, ok, err := p.getDeviceGrant(ctx, in.DeviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newError(ErrCodeExpiredToken, "device_code is invalid or expired")
+	}
+	if grant.ClientID != client.ID {
+		return nil, newError(ErrCodeInvalidGrant, "device_code was issued to another client")
+	}
+
+	if grant.Status == deviceStatusPending {
+		// 間隔より短いポーリングは slow_down を返す（RFC 8628 3.5）。
+		_, polled, err := p.store.Get(ctx, keyPrefixDevicePoll+in.DeviceCode)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: get device poll: %w", err)
+		}
+		if err := p.store.Put(ctx, keyPrefixDevicePoll+in.DeviceCode, []byte{1}, p.devicePollInterval); err != nil {
+			return nil, fmt.Errorf("oidc: store device poll: %w", err)
+		}
+		if polled {
+			return nil, newError(ErrCodeSlowDown, "")
+		}
+		return nil, newError(ErrCodeAuthorizationPending, "")
+	}
+
+	// 承認・拒否の結果は1回だけ返す。並行ポーリングでは Take に勝った方だけが受け取る。
+	if _, taken, err := p.store.Take(ctx, keyPrefixDevice+in.DeviceCode); err != nil {
+		return nil, fmt.Errorf("oidc: take device code: %w", err)
+	} else if !taken {
+		return nil, newError(ErrCodeExpiredToken, "device_code is invalid or expired")
+	}
+	if grant.Status == deviceStatusDenied {
+		return nil, newError(ErrCodeAccessDenied, "the user denied the request")
+	}
+
+	res := &TokenResponse{
+		AccessToken: grant.Token.AccessToken,
+		TokenType:   grant.Token.TokenType,
+		ExpiresIn:   grant.Token.ExpiresIn,
+		Scope:       strings.Join(grant.Scopes, " "),
+	}
+	if res.TokenType == "" {
+		res.TokenType = "Bearer"
+	}
+	if containsString(grant.Scopes, scopeOpenID) {
+		idToken, err := p.signIDToken(client.ID, grant.Identity, grant.Scopes, "", grant.AuthTime, res.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		res.IDToken = idToken
+	}
+	return res, nil
+}
+
+func (p *Provider) getDeviceGrant(ctx context.Context, deviceCode string) (*deviceGrant, bool, error) {
+	raw, ok, err := p.store.Get(ctx, keyPrefixDevice+deviceCode)
+	if err != nil {
+		return nil, false, fmt.Errorf("oidc: get device code: %w", err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	var grant deviceGrant
+	if err := json.Unmarshal(raw, &grant); err != nil {
+		return nil, false, fmt.Errorf("oidc: decode device code: %w", err)
+	}
+	return &grant, true, nil
+}
+
+func randomUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("oidc: generate user code: %w", err)
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode は入力から区切りや空白を除き、大文字に揃える。
+func normalizeUserCode(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(raw) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() != userCodeLength {
+		return ""
+	}
+	return b.String()
+}
+
+// formatUserCode は表示用に4文字ずつハイフンで区切る。
+func formatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
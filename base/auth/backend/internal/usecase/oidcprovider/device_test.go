@@ -0,0 +1,168 @@
+package oidcprovider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// デバイスフロー（発行・承認待ち・slow_down・承認・再利用）を確認する。
+func TestProvider_DeviceFlow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	auth, err := p.StartDevice(ctx, DeviceInput{ClientID: "admin-cli", Scope: "openid profile"})
+	if err != nil {
+		t.Fatalf("StartDevice: %v", err)
+	}
+	if auth.VerificationURI != "https://tenant.auth.example.com/device" || len(auth.UserCode) != 9 || auth.Interval != 5 {
+		t.Fatalf("unexpected authorization: %+v", auth)
+	}
+
+	poll := func(clientID string) (*TokenResponse, string) {
+		res, err := p.Exchange(ctx, TokenInput{GrantType: grantTypeDeviceCode, ClientID: clientID, DeviceCode: auth.DeviceCode})
+		if err == nil {
+			return res, ""
+		}
+		var oerr *Error
+		if !errors.As(err, &oerr) {
+			t.Fatalf("want *Error, got %v", err)
+		}
+		return nil, oerr.Code
+	}
+
+	if _, code := poll("admin-cli"); code != ErrCodeAuthorizationPending {
+		t.Fatalf("first poll: %s", code)
+	}
+	if _, code := poll("admin-cli"); code != ErrCodeSlowDown {
+		t.Fatalf("second poll: %s", code)
+	}
+	if _, code := poll("backup-cli"); code != ErrCodeInvalidGrant {
+		t.Fatalf("other client poll: %s", code)
+	}
+
+	// 入力は小文字・区切りなしでも受け付ける。
+	lookup := strings.ToLower(strings.ReplaceAll(auth.UserCode, "-", ""))
+	req, err := p.LookupDevice(ctx, lookup)
+	if err != nil {
+		t.Fatalf("LookupDevice: %v", err)
+	}
+	if req.ClientName != "Admin CLI" || req.UserCode != auth.UserCode {
+		t.Fatalf("unexpected device request: %+v", req)
+	}
+
+	identity := Identity{Provider: "line", Subject: "U1", Name: "Alice"}
+	if err := p.ApproveDevice(ctx, auth.UserCode, identity, DeviceToken{AccessToken: "line-jwt", TokenType: "Bearer", ExpiresIn: 3600}); err != nil {
+		t.Fatalf("ApproveDevice: %v", err)
+	}
+	if err := p.ApproveDevice(ctx, auth.UserCode, identity, DeviceToken{AccessToken: "other"}); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Fatalf("second approve: %v", err)
+	}
+	if _, err := p.LookupDevice(ctx, auth.UserCode); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Fatalf("lookup after approve: %v", err)
+	}
+
+	res, code := poll("admin-cli")
+	if code != "" {
+		t.Fatalf("approved poll: %s", code)
+	}
+	if res.AccessToken != "line-jwt" || res.ExpiresIn != 3600 || res.IDToken == "" {
+		t.Fatalf("unexpected token response: %+v", res)
+	}
+	claims, err := p.signer.Verify(res.IDToken)
+	if err != nil {
+		t.Fatalf("verify id_token: %v", err)
+	}
+	if claims["sub"] != "line:U1" || claims["aud"] != "admin-cli" || claims["name"] != "Alice" {
+		t.Fatalf("unexpected id_token claims: %v", claims)
+	}
+
+	if _, code := poll("admin-cli"); code != ErrCodeExpiredToken {
+		t.Fatalf("reused device code: %s", code)
+	}
+}
+
+// 拒否・未登録クライアント・不正なユーザーコードの扱いをテーブル駆動で確認する。
+func TestProvider_DeviceErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		run      func(p *Provider) error
+		wantCode string
+		wantErr  error
+	}{
+		{
+			name: "未登録クライアント",
+			run: func(p *Provider) error {
+				_, err := p.StartDevice(ctx, DeviceInput{ClientID: "web"})
+				return err
+			},
+			wantCode: ErrCodeInvalidClient,
+		},
+		{
+			name: "client_secret付きのポーリング",
+			run: func(p *Provider) error {
+				auth, err := p.StartDevice(ctx, DeviceInput{ClientID: "admin-cli"})
+				if err != nil {
+					return err
+				}
+				_, err = p.Exchange(ctx, TokenInput{GrantType: grantTypeDeviceCode, ClientID: "admin-cli", ClientSecret: "x", DeviceCode: auth.DeviceCode})
+				return err
+			},
+			wantCode: ErrCodeInvalidClient,
+		},
+		{
+			name: "拒否後のポーリング",
+			run: func(p *Provider) error {
+				auth, err := p.StartDevice(ctx, DeviceInput{ClientID: "admin-cli"})
+				if err != nil {
+					return err
+				}
+				if err := p.DenyDevice(ctx, auth.UserCode); err != nil {
+					return err
+				}
+				_, err = p.Exchange(ctx, TokenInput{GrantType: grantTypeDeviceCode, ClientID: "admin-cli", DeviceCode: auth.DeviceCode})
+				return err
+			},
+			wantCode: ErrCodeAccessDenied,
+		},
+		{
+			name: "不明なデバイスコード",
+			run: func(p *Provider) error {
+				_, err := p.Exchange(ctx, TokenInput{GrantType: grantTypeDeviceCode, ClientID: "admin-cli", DeviceCode: "unknown"})
+				return err
+			},
+			wantCode: ErrCodeExpiredToken,
+		},
+		{
+			name: "形式不正なユーザーコード",
+			run: func(p *Provider) error {
+				_, err := p.LookupDevice(ctx, "ABC")
+				return err
+			},
+			wantErr: ErrDeviceCodeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.run(newTestProvider(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want %v", err, tt.wantErr)
+				}
+				return
+			}
+			var oerr *Error
+			if !errors.As(err, &oerr) || oerr.Code != tt.wantCode {
+				t.Fatalf("err=%v want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package oidcprovider
+
+// OAuth 2.0 / OIDC のエラーコード。
+const (
+	ErrCodeInvalidRequest          = "invalid_request"
+	ErrCodeInvalidClient           = "invalid_client"
+	ErrCodeInvalidGrant            = "invalid_grant"
+	ErrCodeInvalidScope            = "invalid_scope"
+	ErrCodeUnauthorizedClient      = "unauthorized_client"
+	ErrCodeUnsupportedGrantType    = "unsupported_grant_type"
+	ErrCodeUnsupportedResponseType = "unsupported_response_type"
+	ErrCodeAccessDenied            = "access_denied"
+	ErrCodeInvalidToken            = "invalid_token"
+	// RFC 8628 のデバイスフロー用。
+	ErrCodeAuthorizationPending = "authorization_pending"
+	ErrCodeSlowDown             = "slow_down"
+	ErrCodeExpiredToken         = "expired_token"
+)
+
+// Error はクライアントへ返す OAuth エラー。
+// RedirectURI が空でない場合はリダイレクトでエラーを返してよい（client_id と redirect_uri の検証後）。
+type Error struct {
+	Code        string
+	Description string
+	RedirectURI string
+	State       string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "oidc: " + e.Code
+	}
+	return "oidc: " + e.Code + ": " + e.Description
+}
+
+func newError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
@@ -0,0 +1,61 @@
+package oidcprovider
+
+import (
+	"context"
+	"time"
+)
+
+// Store は認可リクエスト・認可コード・アクセストークンの一時保存先。
+// Get/Take は未登録・期限切れの場合にfalseを返す。
+// Take は取り出しと削除を原子的に行い、同じキーを2回返さないこと。
+type Store interface {
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Take(ctx context.Context, key string) ([]byte, bool, error)
+}
+
+// Signer はID/アクセストークンの署名と検証、公開鍵の公開を担当する。
+type Signer interface {
+	Sign(claims map[string]any) (string, error)
+	Verify(token string) (map[string]any, error)
+	JWKS() JWKS
+}
+
+// Client はテナントに登録されたアプリ（Relying Party）。
+// Secret が空のクライアントは公開クライアントとして扱い、PKCE を必須にする。
+type Client struct {
+	ID           string
+	Secret       string
+	Name         string
+	RedirectURIs []string
+}
+
+// Public は client secret を持たないクライアントかを返す。
+func (c Client) Public() bool {
+	return c.Secret == ""
+}
+
+// Identity は上流プロバイダ（LINE/X など）で認証されたユーザー。
+type Identity struct {
+	Provider string
+	// Subject は上流プロバイダ内のユーザーID。OIDC の sub は "provider:subject" になる。
+	Subject string
+	Name    string
+	Picture string
+	Email   string
+}
+
+// JWKS は /.well-known/jwks.json の応答。
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK はRSA公開鍵1件。
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
@@ -0,0 +1,617 @@
+package oidcprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRequestNotFound は認可リクエストが未登録・期限切れ・完了済みの場合に返す。
+	ErrRequestNotFound = errors.New("oidc: authorization request not found")
+)
+
+const (
+	defaultRequestTTL     = 10 * time.Minute
+	defaultCodeTTL        = time.Minute
+	defaultAccessTokenTTL = time.Hour
+	defaultIDTokenTTL     = time.Hour
+	// サービストークンは漏えい時の影響を抑えるため短命にする。
+	defaultServiceTokenTTL = 5 * time.Minute
+
+	keyPrefixRequest     = "oidc.req."
+	keyPrefixCode        = "oidc.code."
+	keyPrefixAccessToken = "oidc.at."
+
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+
+	codeChallengeMethodS256 = "S256"
+)
+
+// supportedScopes はこのプロバイダが解釈するスコープ。未知のスコープは無視する。
+var supportedScopes = []string{scopeOpenID, scopeProfile, scopeEmail}
+
+// Config はテナントごとのOIDCプロバイダ設定。
+type Config struct {
+	// Issuer はテナントの発行者URL（例: https://tenantA.auth.example.com）。
+	Issuer  string
+	Clients []Client
+	// ServiceClients は client_credentials 用のクライアント。Clients とはIDの名前空間を分ける。
+	ServiceClients  []ServiceClient
+	ServiceTokenTTL time.Duration
+	// DeviceClients はデバイスフロー（RFC 8628）でログインするCLIなど。
+	DeviceClients []DeviceClient
+	DeviceCodeTTL time.Duration
+	// RequestTTL は /authorize から上流ログイン完了までの猶予。
+	RequestTTL     time.Duration
+	CodeTTL        time.Duration
+	AccessTokenTTL time.Duration
+	IDTokenTTL     time.Duration
+}
+
+// Provider は認可コードフロー（PKCE対応）のOIDCプロバイダを司るアプリケーションサービス。
+type Provider struct {
+	issuer          string
+	clients         map[string]Client
+	serviceClients  map[string]ServiceClient
+	deviceClients   map[string]DeviceClient
+	signer          Signer
+	store           Store
+	requestTTL      time.Duration
+	codeTTL         time.Duration
+	accessTokenTTL  time.Duration
+	idTokenTTL      time.Duration
+	serviceTokenTTL time.Duration
+	// deviceCodeTTL はデバイスコードの有効期間、devicePollInterval はポーリングの最短間隔。
+	deviceCodeTTL      time.Duration
+	devicePollInterval time.Duration
+	now                func() time.Time
+}
+
+// NewProvider はOIDCプロバイダを初期化する。TTLが0以下の場合は既定値を使う。
+func NewProvider(cfg Config, signer Signer, store Store) *Provider {
+	clients := make(map[string]Client, len(cfg.Clients))
+	for _, c := range cfg.Clients {
+		c.ID = strings.TrimSpace(c.ID)
+		c.RedirectURIs = append([]string(nil), c.RedirectURIs...)
+		clients[c.ID] = c
+	}
+	serviceClients := make(map[string]ServiceClient, len(cfg.ServiceClients))
+	for _, c := range cfg.ServiceClients {
+		c.ID = strings.TrimSpace(c.ID)
+		c.Scopes = append([]string(nil), c.Scopes...)
+		serviceClients[c.ID] = c
+	}
+	deviceClients := make(map[string]DeviceClient, len(cfg.DeviceClients))
+	for _, c := range cfg.DeviceClients {
+		c.ID = strings.TrimSpace(c.ID)
+		deviceClients[c.ID] = c
+	}
+	return &Provider{
+		issuer:             strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/"),
+		clients:            clients,
+		serviceClients:     serviceClients,
+		deviceClients:      deviceClients,
+		signer:             signer,
+		store:              store,
+		requestTTL:         orDefault(cfg.RequestTTL, defaultRequestTTL),
+		codeTTL:            orDefault(cfg.CodeTTL, defaultCodeTTL),
+		accessTokenTTL:     orDefault(cfg.AccessTokenTTL, defaultAccessTokenTTL),
+		idTokenTTL:         orDefault(cfg.IDTokenTTL, defaultIDTokenTTL),
+		serviceTokenTTL:    orDefault(cfg.ServiceTokenTTL, defaultServiceTokenTTL),
+		deviceCodeTTL:      orDefault(cfg.DeviceCodeTTL, defaultDeviceCodeTTL),
+		devicePollInterval: defaultDevicePollInterval,
+		now:                func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Issuer は発行者URLを返す。
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthorizeInput は /authorize のクエリパラメータ。
+type AuthorizeInput struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationRequest は上流ログインの完了を待っている認可リクエスト。
+type AuthorizationRequest struct {
+	ID                  string   `json:"id"`
+	ClientID            string   `json:"clientId"`
+	ClientName          string   `json:"clientName,omitempty"`
+	RedirectURI         string   `json:"redirectUri"`
+	Scopes              []string `json:"scopes"`
+	State               string   `json:"state,omitempty"`
+	Nonce               string   `json:"nonce,omitempty"`
+	CodeChallenge       string   `json:"codeChallenge,omitempty"`
+	CodeChallengeMethod string   `json:"codeChallengeMethod,omitempty"`
+}
+
+// authorizationCode は認可コードに紐づく情報。
+type authorizationCode struct {
+	Request  AuthorizationRequest `json:"request"`
+	Identity Identity             `json:"identity"`
+	AuthTime int64                `json:"authTime"`
+}
+
+// accessTokenGrant はアクセストークン（jti）に紐づく userinfo の元データ。
+type accessTokenGrant struct {
+	ClientID string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+	Identity Identity `json:"identity"`
+}
+
+// Authorize は認可リクエストを検証して保存する。
+// client_id と redirect_uri が検証できた後のエラーは RedirectURI 付きの *Error になる。
+func (p *Provider) Authorize(ctx context.Context, in AuthorizeInput) (*AuthorizationRequest, error) {
+	client, ok := p.clients[strings.TrimSpace(in.ClientID)]
+	if !ok || client.ID == "" {
+		return nil, newError(ErrCodeInvalidRequest, "unknown client_id")
+	}
+	redirectURI := strings.TrimSpace(in.RedirectURI)
+	if !containsString(client.RedirectURIs, redirectURI) {
+		return nil, newError(ErrCodeInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	redirectErr := func(code, description string) error {
+		return &Error{Code: code, Description: description, RedirectURI: redirectURI, State: in.State}
+	}
+	if in.ResponseType != "code" {
+		return nil, redirectErr(ErrCodeUnsupportedResponseType, "only response_type=code is supported")
+	}
+	scopes := filterScopes(in.Scope)
+	if !containsString(scopes, scopeOpenID) {
+		return nil, redirectErr(ErrCodeInvalidScope, "scope must include openid")
+	}
+	if in.CodeChallenge != "" && in.CodeChallengeMethod != codeChallengeMethodS256 {
+		return nil, redirectErr(ErrCodeInvalidRequest, "code_challenge_method must be S256")
+	}
+	if client.Public() && in.CodeChallenge == "" {
+		return nil, redirectErr(ErrCodeInvalidRequest, "code_challenge is required for public clients")
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	req := &AuthorizationRequest{
+		ID:                  id,
+		ClientID:            client.ID,
+		ClientName:          client.Name,
+		RedirectURI:         redirectURI,
+		Scopes:              scopes,
+		State:               in.State,
+		Nonce:               in.Nonce,
+		CodeChallenge:       in.CodeChallenge,
+		CodeChallengeMethod: in.CodeChallengeMethod,
+	}
+	if err := p.put(ctx, keyPrefixRequest+id, req, p.requestTTL); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Complete は上流ログインで認証されたユーザーで認可リクエストを完了し、
+// 認可コード付きのクライアントへのリダイレクトURLを返す。
+func (p *Provider) Complete(ctx context.Context, requestID string, identity Identity) (string, error) {
+	req, err := p.takeRequest(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	grant := authorizationCode{
+		Request:  *req,
+		Identity: identity,
+		AuthTime: p.now().Unix(),
+	}
+	if err := p.put(ctx, keyPrefixCode+code, grant, p.codeTTL); err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	values.Set("code", code)
+	return p.clientRedirect(req.RedirectURI, req.State, values), nil
+}
+
+// Deny は上流ログインが失敗・キャンセルされた認可リクエストを終了し、
+// access_denied を載せたクライアントへのリダイレクトURLを返す。
+func (p *Provider) Deny(ctx context.Context, requestID, description string) (string, error) {
+	req, err := p.takeRequest(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	return p.ErrorRedirect(&Error{
+		Code:        ErrCodeAccessDenied,
+		Description: description,
+		RedirectURI: req.RedirectURI,
+		State:       req.State,
+	}), nil
+}
+
+// ErrorRedirect はリダイレクト可能なエラーをクライアントへのリダイレクトURLに変換する。
+func (p *Provider) ErrorRedirect(e *Error) string {
+	values := url.Values{}
+	values.Set("error", e.Code)
+	if e.Description != "" {
+		values.Set("error_description", e.Description)
+	}
+	return p.clientRedirect(e.RedirectURI, e.State, values)
+}
+
+// TokenInput は /token のフォームパラメータとクライアント認証情報。
+type TokenInput struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+	// Scope は client_credentials で要求するスコープ（空なら登録済みの全スコープ）。
+	Scope string
+	// DeviceCode はデバイスフローのポーリングで送られるデバイスコード。
+	DeviceCode string
+}
+
+// TokenResponse は /token の成功応答。
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Exchange は認可コードをアクセストークンとIDトークンに交換する。
+// grant_type=client_credentials の場合はサービストークンを発行し、
+// デバイスコードグラントの場合はユーザーの承認状況に応じて応答する。
+func (p *Provider) Exchange(ctx context.Context, in TokenInput) (*TokenResponse, error) {
+	switch in.GrantType {
+	case "authorization_code":
+	case grantTypeClientCredentials:
+		return p.issueServiceToken(in)
+	case grantTypeDeviceCode:
+		return p.exchangeDeviceCode(ctx, in)
+	default:
+		return nil, newError(ErrCodeUnsupportedGrantType, "")
+	}
+	client, err := p.authenticateClient(in.ClientID, in.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Code == "" {
+		return nil, newError(ErrCodeInvalidRequest, "code is required")
+	}
+	raw, ok, err := p.store.Take(ctx, keyPrefixCode+in.Code)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: take code: %w", err)
+	}
+	if !ok {
+		return nil, newError(ErrCodeInvalidGrant, "authorization code is invalid or expired")
+	}
+	var grant authorizationCode
+	if err := json.Unmarshal(raw, &grant); err != nil {
+		return nil, fmt.Errorf("oidc: decode code: %w", err)
+	}
+	req := grant.Request
+	if req.ClientID != client.ID {
+		return nil, newError(ErrCodeInvalidGrant, "authorization code was issued to another client")
+	}
+	if req.RedirectURI != in.RedirectURI {
+		return nil, newError(ErrCodeInvalidGrant, "redirect_uri does not match")
+	}
+	if req.CodeChallenge != "" && !verifyCodeChallenge(req.CodeChallenge, in.CodeVerifier) {
+		return nil, newError(ErrCodeInvalidGrant, "code_verifier does not match")
+	}
+
+	now := p.now()
+	subject := subjectOf(grant.Identity)
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := p.signer.Sign(map[string]any{
+		"iss":       p.issuer,
+		"sub":       subject,
+		"aud":       client.ID,
+		"client_id": client.ID,
+		"scope":     strings.Join(req.Scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.accessTokenTTL).Unix(),
+		"jti":       jti,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := p.put(ctx, keyPrefixAccessToken+jti, accessTokenGrant{
+		ClientID: client.ID,
+		Scopes:   req.Scopes,
+		Identity: grant.Identity,
+	}, p.accessTokenTTL); err != nil {
+		return nil, err
+	}
+
+	idToken, err := p.signIDToken(client.ID, grant.Identity, req.Scopes, req.Nonce, grant.AuthTime, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.accessTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       strings.Join(req.Scopes, " "),
+	}, nil
+}
+
+// signIDToken はクライアント向けのIDトークンに署名する。
+func (p *Provider) signIDToken(clientID string, identity Identity, scopes []string, nonce string, authTime int64, accessToken string) (string, error) {
+	now := p.now()
+	claims := map[string]any{
+		"iss":       p.issuer,
+		"sub":       subjectOf(identity),
+		"aud":       clientID,
+		"azp":       clientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.idTokenTTL).Unix(),
+		"auth_time": authTime,
+		"idp":       identity.Provider,
+		"at_hash":   halfHash(accessToken),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	for k, v := range profileClaims(identity, scopes) {
+		claims[k] = v
+	}
+	return p.signer.Sign(claims)
+}
+
+// UserInfo はアクセストークンを検証し、スコープに応じたクレームを返す。
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	claims, err := p.signer.Verify(accessToken)
+	if err != nil {
+		return nil, newError(ErrCodeInvalidToken, "access token is invalid")
+	}
+	if iss, _ := claims["iss"].(string); iss != p.issuer {
+		return nil, newError(ErrCodeInvalidToken, "access token is invalid")
+	}
+	if exp, _ := claims["exp"].(float64); p.now().Unix() >= int64(exp) {
+		return nil, newError(ErrCodeInvalidToken, "access token is expired")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, newError(ErrCodeInvalidToken, "access token is invalid")
+	}
+
+	raw, ok, err := p.store.Get(ctx, keyPrefixAccessToken+jti)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: get access token: %w", err)
+	}
+	if !ok {
+		return nil, newError(ErrCodeInvalidToken, "access token is expired")
+	}
+	var grant accessTokenGrant
+	if err := json.Unmarshal(raw, &grant); err != nil {
+		return nil, fmt.Errorf("oidc: decode access token: %w", err)
+	}
+
+	info := map[string]any{"sub": subjectOf(grant.Identity)}
+	for k, v := range profileClaims(grant.Identity, grant.Scopes) {
+		info[k] = v
+	}
+	return info, nil
+}
+
+// Discovery は /.well-known/openid-configuration の応答。
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+}
+
+// Discovery はディスカバリ文書を組み立てる。
+func (p *Provider) Discovery() Discovery {
+	grantTypes := []string{"authorization_code"}
+	if len(p.serviceClients) > 0 {
+		grantTypes = append(grantTypes, grantTypeClientCredentials)
+	}
+	var deviceEndpoint string
+	if len(p.deviceClients) > 0 {
+		grantTypes = append(grantTypes, grantTypeDeviceCode)
+		deviceEndpoint = p.issuer + "/device/code"
+	}
+	return Discovery{
+		Issuer:                            p.issuer,
+		AuthorizationEndpoint:             p.issuer + "/authorize",
+		TokenEndpoint:                     p.issuer + "/token",
+		UserInfoEndpoint:                  p.issuer + "/userinfo",
+		JWKSURI:                           p.issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   append([]string(nil), supportedScopes...),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "idp", "name", "picture", "email"},
+		AuthorizationResponseIssParameter: true,
+		DeviceAuthorizationEndpoint:       deviceEndpoint,
+	}
+}
+
+// JWKS は署名鍵の公開鍵セットを返す。
+func (p *Provider) JWKS() JWKS {
+	return p.signer.JWKS()
+}
+
+func (p *Provider) authenticateClient(clientID, secret string) (Client, error) {
+	client, ok := p.clients[strings.TrimSpace(clientID)]
+	if !ok || client.ID == "" {
+		return Client{}, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+	if client.Public() {
+		if secret != "" {
+			return Client{}, newError(ErrCodeInvalidClient, "client authentication failed")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1 {
+		return Client{}, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+	return client, nil
+}
+
+func (p *Provider) takeRequest(ctx context.Context, requestID string) (*AuthorizationRequest, error) {
+	if requestID == "" {
+		return nil, ErrRequestNotFound
+	}
+	raw, ok, err := p.store.Take(ctx, keyPrefixRequest+requestID)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: take request: %w", err)
+	}
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	var req AuthorizationRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, fmt.Errorf("oidc: decode request: %w", err)
+	}
+	return &req, nil
+}
+
+func (p *Provider) put(ctx context.Context, key string, value any, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("oidc: marshal %s: %w", key, err)
+	}
+	if err := p.store.Put(ctx, key, data, ttl); err != nil {
+		return fmt.Errorf("oidc: store %s: %w", key, err)
+	}
+	return nil
+}
+
+// clientRedirect はクライアントのredirect_uriにパラメータとstate・issを付けたURLを返す。
+func (p *Provider) clientRedirect(redirectURI, state string, values url.Values) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := target.Query()
+	for k, vs := range values {
+		for _, v := range vs {
+			query.Add(k, v)
+		}
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	query.Set("iss", p.issuer)
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// subjectOf は上流プロバイダ名とユーザーIDから OIDC の sub を組み立てる。
+func subjectOf(identity Identity) string {
+	return identity.Provider + ":" + identity.Subject
+}
+
+// profileClaims はスコープに応じて返してよいプロフィールクレームを返す。
+func profileClaims(identity Identity, scopes []string) map[string]any {
+	claims := map[string]any{}
+	if containsString(scopes, scopeProfile) {
+		if identity.Name != "" {
+			claims["name"] = identity.Name
+		}
+		if identity.Picture != "" {
+			claims["picture"] = identity.Picture
+		}
+	}
+	if containsString(scopes, scopeEmail) && identity.Email != "" {
+		claims["email"] = identity.Email
+	}
+	return claims
+}
+
+func filterScopes(raw string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(raw) {
+		if containsString(supportedScopes, s) && !containsString(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// halfHash は at_hash 用に SHA-256 の左半分を base64url で返す。
+func halfHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("oidc: generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,341 @@
+package oidcprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+)
+
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return NewProvider(Config{
+		Issuer: "https://tenant.auth.example.com",
+		Clients: []Client{
+			{ID: "web", Secret: "web-secret", RedirectURIs: []string{"https://app.example.com/cb"}},
+			{ID: "spa", RedirectURIs: []string{"https://spa.example.com/cb"}},
+		},
+		ServiceClients: []ServiceClient{
+			{ID: "lilink-backend", SecretSHA256: sha256Sum("svc-secret"), Scopes: []string{"message:send", "storage:write"}},
+		},
+		DeviceClients: []DeviceClient{
+			{ID: "admin-cli", Name: "Admin CLI"},
+			{ID: "backup-cli"},
+		},
+	}, NewRS256Signer(key, "k1"), grantstore.NewMemory())
+}
+
+func sha256Sum(v string) []byte {
+	sum := sha256.Sum256([]byte(v))
+	return sum[:]
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// /authorize の検証をテーブル駆動で確認する。
+func TestProvider_Authorize(t *testing.T) {
+	t.Parallel()
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name         string
+		in           AuthorizeInput
+		wantCode     string
+		wantRedirect bool
+	}{
+		{
+			name: "正常",
+			in:   AuthorizeInput{ResponseType: "code", ClientID: "web", RedirectURI: "https://app.example.com/cb", Scope: "openid profile"},
+		},
+		{
+			name:     "未登録クライアント",
+			in:       AuthorizeInput{ResponseType: "code", ClientID: "unknown", RedirectURI: "https://app.example.com/cb", Scope: "openid"},
+			wantCode: ErrCodeInvalidRequest,
+		},
+		{
+			name:     "未登録のredirect_uri",
+			in:       AuthorizeInput{ResponseType: "code", ClientID: "web", RedirectURI: "https://evil.example.com/cb", Scope: "openid"},
+			wantCode: ErrCodeInvalidRequest,
+		},
+		{
+			name:         "openidスコープなし",
+			in:           AuthorizeInput{ResponseType: "code", ClientID: "web", RedirectURI: "https://app.example.com/cb", Scope: "profile"},
+			wantCode:     ErrCodeInvalidScope,
+			wantRedirect: true,
+		},
+		{
+			name:         "implicitは非対応",
+			in:           AuthorizeInput{ResponseType: "token", ClientID: "web", RedirectURI: "https://app.example.com/cb", Scope: "openid"},
+			wantCode:     ErrCodeUnsupportedResponseType,
+			wantRedirect: true,
+		},
+		{
+			name:         "公開クライアントはPKCE必須",
+			in:           AuthorizeInput{ResponseType: "code", ClientID: "spa", RedirectURI: "https://spa.example.com/cb", Scope: "openid"},
+			wantCode:     ErrCodeInvalidRequest,
+			wantRedirect: true,
+		},
+		{
+			name:         "plainは非対応",
+			in:           AuthorizeInput{ResponseType: "code", ClientID: "spa", RedirectURI: "https://spa.example.com/cb", Scope: "openid", CodeChallenge: "abc", CodeChallengeMethod: "plain"},
+			wantCode:     ErrCodeInvalidRequest,
+			wantRedirect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req, err := p.Authorize(context.Background(), tt.in)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if req.ID == "" {
+					t.Fatalf("request id is empty")
+				}
+				return
+			}
+			var oerr *Error
+			if !errors.As(err, &oerr) {
+				t.Fatalf("want *Error, got %v", err)
+			}
+			if oerr.Code != tt.wantCode {
+				t.Fatalf("code=%s want=%s", oerr.Code, tt.wantCode)
+			}
+			if (oerr.RedirectURI != "") != tt.wantRedirect {
+				t.Fatalf("redirectable=%v want=%v", oerr.RedirectURI != "", tt.wantRedirect)
+			}
+		})
+	}
+}
+
+// 認可コードフロー全体（PKCE・コード再利用・userinfo）を確認する。
+func TestProvider_CodeFlow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	verifier := "verifier-0123456789-0123456789-0123456789"
+	req, err := p.Authorize(ctx, AuthorizeInput{
+		ResponseType:        "code",
+		ClientID:            "spa",
+		RedirectURI:         "https://spa.example.com/cb",
+		Scope:               "openid profile",
+		State:               "xyz",
+		Nonce:               "n-1",
+		CodeChallenge:       s256(verifier),
+		CodeChallengeMethod: "S256",
+	})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	target, err := p.Complete(ctx, req.ID, Identity{Provider: "line", Subject: "U123", Name: "Taro", Email: "taro@example.com"})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, err := p.Complete(ctx, req.ID, Identity{Provider: "line", Subject: "U123"}); !errors.Is(err, ErrRequestNotFound) {
+		t.Fatalf("second Complete err=%v want ErrRequestNotFound", err)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	q := u.Query()
+	if q.Get("state") != "xyz" || q.Get("iss") != "https://tenant.auth.example.com" || q.Get("code") == "" {
+		t.Fatalf("unexpected redirect: %s", target)
+	}
+
+	bad := TokenInput{GrantType: "authorization_code", Code: q.Get("code"), RedirectURI: "https://spa.example.com/cb", ClientID: "spa", CodeVerifier: "wrong"}
+	var oerr *Error
+	if _, err := p.Exchange(ctx, bad); !errors.As(err, &oerr) || oerr.Code != ErrCodeInvalidGrant {
+		t.Fatalf("wrong verifier err=%v", err)
+	}
+
+	// 検証に失敗したコードも消費済みになる。
+	good := bad
+	good.CodeVerifier = verifier
+	if _, err := p.Exchange(ctx, good); !errors.As(err, &oerr) || oerr.Code != ErrCodeInvalidGrant {
+		t.Fatalf("reused code err=%v", err)
+	}
+
+	req, _ = p.Authorize(ctx, AuthorizeInput{
+		ResponseType: "code", ClientID: "spa", RedirectURI: "https://spa.example.com/cb",
+		Scope: "openid profile", Nonce: "n-2", CodeChallenge: s256(verifier), CodeChallengeMethod: "S256",
+	})
+	target, _ = p.Complete(ctx, req.ID, Identity{Provider: "line", Subject: "U123", Name: "Taro", Email: "taro@example.com"})
+	u, _ = url.Parse(target)
+	good.Code = u.Query().Get("code")
+	tok, err := p.Exchange(ctx, good)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	idClaims, err := p.signer.Verify(tok.IDToken)
+	if err != nil {
+		t.Fatalf("verify id_token: %v", err)
+	}
+	if idClaims["sub"] != "line:U123" || idClaims["aud"] != "spa" || idClaims["nonce"] != "n-2" || idClaims["name"] != "Taro" {
+		t.Fatalf("unexpected id_token claims: %+v", idClaims)
+	}
+	if _, ok := idClaims["email"]; ok {
+		t.Fatalf("email must not be included without email scope")
+	}
+
+	info, err := p.UserInfo(ctx, tok.AccessToken)
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if info["sub"] != "line:U123" || info["name"] != "Taro" {
+		t.Fatalf("unexpected userinfo: %+v", info)
+	}
+}
+
+func TestProvider_ExchangeClientAuth(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := newTestProvider(t)
+
+	req, err := p.Authorize(ctx, AuthorizeInput{ResponseType: "code", ClientID: "web", RedirectURI: "https://app.example.com/cb", Scope: "openid"})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	target, _ := p.Complete(ctx, req.ID, Identity{Provider: "twitter", Subject: "42"})
+	u, _ := url.Parse(target)
+
+	var oerr *Error
+	_, err = p.Exchange(ctx, TokenInput{GrantType: "authorization_code", Code: u.Query().Get("code"), RedirectURI: "https://app.example.com/cb", ClientID: "web", ClientSecret: "nope"})
+	if !errors.As(err, &oerr) || oerr.Code != ErrCodeInvalidClient {
+		t.Fatalf("err=%v want invalid_client", err)
+	}
+	tok, err := p.Exchange(ctx, TokenInput{GrantType: "authorization_code", Code: u.Query().Get("code"), RedirectURI: "https://app.example.com/cb", ClientID: "web", ClientSecret: "web-secret"})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if tok.TokenType != "Bearer" || tok.IDToken == "" {
+		t.Fatalf("unexpected token response: %+v", tok)
+	}
+}
+
+// client_credentials のサービストークン発行をテーブル駆動で確認する。
+func TestProvider_ClientCredentials(t *testing.T) {
+	t.Parallel()
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name      string
+		in        TokenInput
+		wantCode  string
+		wantScope string
+		wantAud   []any
+	}{
+		{
+			name:      "スコープ省略で登録済みの全スコープ",
+			in:        TokenInput{GrantType: "client_credentials", ClientID: "lilink-backend", ClientSecret: "svc-secret"},
+			wantScope: "message:send storage:write",
+			wantAud:   []any{"message", "storage"},
+		},
+		{
+			name:      "スコープを絞る",
+			in:        TokenInput{GrantType: "client_credentials", ClientID: "lilink-backend", ClientSecret: "svc-secret", Scope: "message:send"},
+			wantScope: "message:send",
+			wantAud:   []any{"message"},
+		},
+		{
+			name:     "未許可のスコープ",
+			in:       TokenInput{GrantType: "client_credentials", ClientID: "lilink-backend", ClientSecret: "svc-secret", Scope: "storage:delete"},
+			wantCode: ErrCodeInvalidScope,
+		},
+		{
+			name:     "secret不一致",
+			in:       TokenInput{GrantType: "client_credentials", ClientID: "lilink-backend", ClientSecret: "wrong"},
+			wantCode: ErrCodeInvalidClient,
+		},
+		{
+			name:     "OIDCクライアントでは取得できない",
+			in:       TokenInput{GrantType: "client_credentials", ClientID: "web", ClientSecret: "web-secret"},
+			wantCode: ErrCodeInvalidClient,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tok, err := p.Exchange(context.Background(), tt.in)
+			if tt.wantCode != "" {
+				var oerr *Error
+				if !errors.As(err, &oerr) || oerr.Code != tt.wantCode {
+					t.Fatalf("err=%v want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if tok.Scope != tt.wantScope || tok.IDToken != "" {
+				t.Fatalf("unexpected token response: %+v", tok)
+			}
+			claims, err := p.signer.Verify(tok.AccessToken)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if claims["sub"] != "lilink-backend" || !reflect.DeepEqual(claims["aud"], tt.wantAud) {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+// 発行したサービストークンをスコープ単位で検証できることを確認する。
+func TestProvider_VerifyServiceToken(t *testing.T) {
+	t.Parallel()
+	p := newTestProvider(t)
+
+	tok, err := p.Exchange(context.Background(), TokenInput{GrantType: "client_credentials", ClientID: "lilink-backend", ClientSecret: "svc-secret", Scope: "message:send"})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   string
+		wantErr error
+	}{
+		{name: "許可されたスコープ", token: tok.AccessToken, scope: "message:send"},
+		{name: "別サービス宛て", token: tok.AccessToken, scope: "storage:write", wantErr: ErrInvalidServiceToken},
+		{name: "同じサービスの別スコープ", token: tok.AccessToken, scope: "message:broadcast", wantErr: ErrInsufficientScope},
+		{name: "改ざん", token: tok.AccessToken + "x", scope: "message:send", wantErr: ErrInvalidServiceToken},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clientID, err := p.VerifyServiceToken(tt.token, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want %v", err, tt.wantErr)
+			}
+			if err == nil && clientID != "lilink-backend" {
+				t.Fatalf("clientID=%s", clientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package oidcprovider
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+var (
+	// ErrInvalidServiceToken はサービストークンの署名・発行者・受信者・有効期限の検証に失敗した場合に返す。
+	ErrInvalidServiceToken = errors.New("oidc: invalid service token")
+	// ErrInsufficientScope はサービストークンに必要なスコープがない場合に返す。
+	ErrInsufficientScope = errors.New("oidc: insufficient scope")
+)
+
+// ServiceClient は client_credentials でサービストークンを取得するバックエンド。
+// SecretSHA256 は client secret の SHA-256 で、平文は保持しない。
+type ServiceClient struct {
+	ID           string
+	Name         string
+	SecretSHA256 []byte
+	Scopes       []string
+}
+
+// ParseSecretSHA256 は設定ファイルの16進表記のハッシュを読み込む。
+func ParseSecretSHA256(hexHash string) ([]byte, error) {
+	sum, err := hex.DecodeString(strings.TrimSpace(hexHash))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.New("oidc: clientSecretSHA256 must be a hex-encoded SHA-256")
+	}
+	return sum, nil
+}
+
+// issueServiceToken はサービスクライアントを認証し、短命のサービストークンを発行する。
+// aud にはスコープの接頭辞（message:send なら message）を入れ、下流サービスが自分宛てか判定できるようにする。
+func (p *Provider) issueServiceToken(in TokenInput) (*TokenResponse, error) {
+	client, ok := p.serviceClients[strings.TrimSpace(in.ClientID)]
+	if !ok || in.ClientSecret == "" {
+		return nil, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+	sum := sha256.Sum256([]byte(in.ClientSecret))
+	if subtle.ConstantTimeCompare(sum[:], client.SecretSHA256) != 1 {
+		return nil, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(in.Scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !containsString(client.Scopes, s) {
+				return nil, newError(ErrCodeInvalidScope, "scope "+s+" is not allowed for this client")
+			}
+		}
+		scopes = requested
+	}
+	if len(scopes) == 0 {
+		return nil, newError(ErrCodeInvalidScope, "no scope is granted to this client")
+	}
+
+	var audiences []string
+	for _, s := range scopes {
+		service, _, _ := strings.Cut(s, ":")
+		if !containsString(audiences, service) {
+			audiences = append(audiences, service)
+		}
+	}
+
+	now := p.now()
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.signer.Sign(map[string]any{
+		"iss":       p.issuer,
+		"sub":       client.ID,
+		"aud":       audiences,
+		"client_id": client.ID,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.serviceTokenTTL).Unix(),
+		"jti":       jti,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.serviceTokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// VerifyServiceToken はこのプロバイダが発行したサービストークンを検証し、scope を持つクライアントのIDを返す。
+// aud にはスコープの接頭辞が含まれている必要がある。
+func (p *Provider) VerifyServiceToken(token, scope string) (string, error) {
+	claims, err := p.signer.Verify(token)
+	if err != nil {
+		return "", ErrInvalidServiceToken
+	}
+	if iss, _ := claims["iss"].(string); iss != p.issuer {
+		return "", ErrInvalidServiceToken
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || !p.now().Before(time.Unix(int64(exp), 0)) {
+		return "", ErrInvalidServiceToken
+	}
+	clientID, _ := claims["client_id"].(string)
+	if _, ok := p.serviceClients[clientID]; !ok {
+		return "", ErrInvalidServiceToken
+	}
+	service, _, _ := strings.Cut(scope, ":")
+	audiences, _ := claims["aud"].([]any)
+	found := false
+	for _, a := range audiences {
+		if a == service {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", ErrInvalidServiceToken
+	}
+	granted, _ := claims["scope"].(string)
+	if !containsString(strings.Fields(granted), scope) {
+		return "", ErrInsufficientScope
+	}
+	return clientID, nil
+}
@@ -0,0 +1,126 @@
+package oidcprovider
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ParseRSAPrivateKey はPEM（PKCS#1 または PKCS#8）のRSA秘密鍵を読み込む。
+func ParseRSAPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("oidc: signing key is not PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("oidc: signing key is not RSA")
+	}
+	return key, nil
+}
+
+// RS256Signer はテナントのRSA鍵でJWTを署名・検証する実装。
+type RS256Signer struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewRS256Signer はRS256Signerを生成する。keyID はJWTヘッダとJWKSのkidに使う。
+func NewRS256Signer(key *rsa.PrivateKey, keyID string) *RS256Signer {
+	return &RS256Signer{key: key, keyID: keyID}
+}
+
+// Sign はクレームをRS256で署名したJWTを返す。
+func (s *RS256Signer) Sign(claims map[string]any) (string, error) {
+	header := map[string]any{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": s.keyID,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("oidc signer: marshal header: %w", err)
+	}
+	payloadJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("oidc signer: marshal payload: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("oidc signer: sign: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify は署名とkidを検証してクレームを返す。exp などの検証は呼び出し側で行う。
+func (s *RS256Signer) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc signer: malformed token")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("oidc signer: decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("oidc signer: parse header: %w", err)
+	}
+	if header.Alg != "RS256" || header.Kid != s.keyID {
+		return nil, errors.New("oidc signer: unexpected key")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("oidc signer: decode signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("oidc signer: invalid signature: %w", err)
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("oidc signer: decode payload: %w", err)
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, fmt.Errorf("oidc signer: parse payload: %w", err)
+	}
+	return claims, nil
+}
+
+// JWKS は公開鍵をJWK Set形式で返す。
+func (s *RS256Signer) JWKS() JWKS {
+	pub := s.key.PublicKey
+	return JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: s.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
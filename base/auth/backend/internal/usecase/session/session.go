@@ -0,0 +1,181 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSession はセッショントークンの形式・署名・発行者の検証に失敗した場合に返す。
+	ErrInvalidSession = errors.New("session: invalid")
+	// ErrSessionExpired はセッションの有効期限を過ぎた場合に返す。
+	ErrSessionExpired = errors.New("session: expired")
+)
+
+// Identity はセッションに保持する上流ログインのユーザー情報。
+type Identity struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"sub"`
+	Name     string `json:"name,omitempty"`
+	Picture  string `json:"picture,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// Session は検証済みのセッション。
+type Session struct {
+	ID string
+	Identity
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Manager はセッションCookieに入れるトークンの発行・検証とCSRFトークンの発行・照合を行う。
+// トークンは標準のHS256のJWT（header.payload をHMAC-SHA256で署名）で、サーバー側には状態を持たない。
+type Manager struct {
+	secret []byte
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewManager はManagerを生成する。
+func NewManager(secret []byte, issuer string, ttl time.Duration) *Manager {
+	return &Manager{
+		secret: append([]byte(nil), secret...),
+		issuer: issuer,
+		ttl:    ttl,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// TTL はセッションの有効期間を返す（Cookie の Max-Age に使う）。
+func (m *Manager) TTL() time.Duration {
+	return m.ttl
+}
+
+type claims struct {
+	Identity
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"sid"`
+}
+
+// Issue はユーザー情報からセッショントークンを発行する。
+func (m *Manager) Issue(id Identity) (string, *Session, error) {
+	if len(m.secret) == 0 {
+		return "", nil, fmt.Errorf("session: secret is empty")
+	}
+	if strings.TrimSpace(id.Provider) == "" || strings.TrimSpace(id.Subject) == "" {
+		return "", nil, fmt.Errorf("session: provider and subject are required")
+	}
+	sid := make([]byte, 16)
+	if _, err := rand.Read(sid); err != nil {
+		return "", nil, fmt.Errorf("session: generate id: %w", err)
+	}
+
+	now := m.now()
+	c := claims{
+		Identity:  id,
+		Issuer:    m.issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.ttl).Unix(),
+		ID:        base64.RawURLEncoding.EncodeToString(sid),
+	}
+	headerJSON, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", nil, fmt.Errorf("session: marshal header: %w", err)
+	}
+	payloadJSON, err := json.Marshal(c)
+	if err != nil {
+		return "", nil, fmt.Errorf("session: marshal payload: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(m.signJWT(unsigned))
+	return token, c.session(), nil
+}
+
+// Verify はセッショントークンの署名・発行者・有効期限を検証する。
+func (m *Manager) Verify(token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidSession
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidSession
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, m.signJWT(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidSession
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var c claims
+	if err := json.Unmarshal(payloadJSON, &c); err != nil {
+		return nil, ErrInvalidSession
+	}
+	if c.Issuer != m.issuer || c.ID == "" || c.Subject == "" {
+		return nil, ErrInvalidSession
+	}
+	if !m.now().Before(time.Unix(c.ExpiresAt, 0)) {
+		return nil, ErrSessionExpired
+	}
+	return c.session(), nil
+}
+
+// CSRFToken はセッションに紐付いたCSRFトークンを返す。
+// セッションIDから導出するため保存は不要で、同じセッションの間は同じ値になる。
+func (m *Manager) CSRFToken(s *Session) string {
+	return base64.RawURLEncoding.EncodeToString(m.signCSRF(s.ID))
+}
+
+// VerifyCSRF はCSRFトークンがセッションに紐付いたものかを定数時間で判定する。
+func (m *Manager) VerifyCSRF(s *Session, token string) bool {
+	if s == nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(m.CSRFToken(s))) == 1
+}
+
+// signJWT はRFC 7515どおり header.payload そのもののHMAC-SHA256を返す。共有鍵があれば一般のJWTライブラリでも検証できる。
+func (m *Manager) signJWT(unsigned string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+// signCSRF はセッションIDに "csrf:" を前置してHMAC-SHA256を計算する。
+// JWTの署名対象はbase64urlで ":" を含まないため、CSRFトークンがJWTの署名と一致することはない。
+func (m *Manager) signCSRF(sessionID string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte("csrf:" + sessionID))
+	return mac.Sum(nil)
+}
+
+func (c claims) session() *Session {
+	return &Session{
+		ID:        c.ID,
+		Identity:  c.Identity,
+		IssuedAt:  time.Unix(c.IssuedAt, 0).UTC(),
+		ExpiresAt: time.Unix(c.ExpiresAt, 0).UTC(),
+	}
+}
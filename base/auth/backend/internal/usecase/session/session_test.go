@@ -0,0 +1,114 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_Verify(t *testing.T) {
+	t.Parallel()
+
+	identity := Identity{Provider: "line", Subject: "U123", Name: "テスト"}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		mutate  func(token string) string
+		verify  *Manager
+		elapsed time.Duration
+		wantErr error
+	}{
+		{name: "検証成功"},
+		{name: "期限切れ", elapsed: 2 * time.Hour, wantErr: ErrSessionExpired},
+		{
+			name:    "署名改ざん",
+			mutate:  func(token string) string { return token[:strings.LastIndex(token, ".")+1] + "AAAA" },
+			wantErr: ErrInvalidSession,
+		},
+		{name: "形式不正", mutate: func(string) string { return "not-a-token" }, wantErr: ErrInvalidSession},
+		{name: "別の鍵", verify: NewManager([]byte("other"), "tenant1", time.Hour), wantErr: ErrInvalidSession},
+		{name: "別テナント", verify: NewManager([]byte("secret"), "tenant2", time.Hour), wantErr: ErrInvalidSession},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			issuer := NewManager([]byte("secret"), "tenant1", time.Hour)
+			issuer.now = func() time.Time { return base }
+			token, issued, err := issuer.Issue(identity)
+			if err != nil {
+				t.Fatalf("issue: %v", err)
+			}
+			if tt.mutate != nil {
+				token = tt.mutate(token)
+			}
+			verifier := tt.verify
+			if verifier == nil {
+				verifier = issuer
+			}
+			verifier.now = func() time.Time { return base.Add(tt.elapsed) }
+
+			got, err := verifier.Verify(token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want=%v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.ID != issued.ID || got.Identity != identity || !got.ExpiresAt.Equal(base.Add(time.Hour)) {
+				t.Fatalf("unexpected session: %+v", got)
+			}
+		})
+	}
+}
+
+// トークンは header.payload をHMAC-SHA256で署名した標準のHS256のJWTであることを確認する。
+func TestManager_IssueStandardHS256(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	token, _, err := NewManager(secret, "tenant1", time.Hour).Issue(Identity{Provider: "line", Subject: "U123"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	i := strings.LastIndex(token, ".")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token[:i]))
+	if want := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); token[i+1:] != want {
+		t.Fatalf("signature=%s want=%s", token[i+1:], want)
+	}
+}
+
+func TestManager_CSRF(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager([]byte("secret"), "tenant1", time.Hour)
+	_, s1, err := m.Issue(Identity{Provider: "line", Subject: "U1"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	_, s2, err := m.Issue(Identity{Provider: "line", Subject: "U1"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	token := m.CSRFToken(s1)
+	if !m.VerifyCSRF(s1, token) {
+		t.Fatalf("csrf token should match its session")
+	}
+	if m.VerifyCSRF(s2, token) {
+		t.Fatalf("csrf token must not match another session")
+	}
+	if m.VerifyCSRF(s1, "") {
+		t.Fatalf("empty csrf token must be rejected")
+	}
+	if NewManager([]byte("other"), "tenant1", time.Hour).VerifyCSRF(s1, token) {
+		t.Fatalf("csrf token must depend on the secret")
+	}
+}
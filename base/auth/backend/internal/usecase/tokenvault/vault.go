@@ -0,0 +1,215 @@
+package tokenvault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound は保管されたトークンがない場合に返す。
+	ErrNotFound = errors.New("tokenvault: token not found")
+	// ErrExpired はトークンが期限切れで、更新もできない場合に返す。
+	ErrExpired = errors.New("tokenvault: token expired")
+)
+
+const (
+	keyPrefix = "vault."
+	// refreshSkew は期限のこの時間前から更新する。
+	refreshSkew = time.Minute
+	// lockStripes は更新を直列化するロックの数。ユーザー数によらずこの数に収める。
+	lockStripes = 64
+)
+
+// Token は上流プロバイダのトークン。
+type Token struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	TokenType    string    `json:"tokenType,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Store は暗号化済みトークンの保存先。Get は未登録・期限切れの場合にfalseを返す。
+type Store interface {
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+}
+
+// Refresher はリフレッシュトークンで新しいトークンを取得する。
+type Refresher interface {
+	Refresh(ctx context.Context, refreshToken string) (*Token, error)
+}
+
+// Vault は上流プロバイダのトークンをテナント単位で暗号化して保管する。期限が近ければ更新して返す。
+// 同じユーザーの更新はプロセス内でだけ直列化する。別のプロセスと同時に更新して失敗した場合は、
+// 相手が保存したトークンを読み直して返す。
+type Vault struct {
+	tenantID   string
+	aead       cipher.AEAD
+	store      Store
+	retention  time.Duration
+	providers  map[string]struct{}
+	refreshers map[string]Refresher
+	locks      [lockStripes]sync.Mutex
+	now        func() time.Time
+}
+
+// NewVault はAES-256-GCMの鍵（32バイト）でVaultを生成する。
+// providers は保管対象のプロバイダ、retention は最後の保存から保持する期間。
+func NewVault(tenantID string, key []byte, store Store, providers []string, retention time.Duration) (*Vault, error) {
+	if len(key) != 32 {
+		return nil, errors.New("tokenvault: key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("tokenvault: init cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("tokenvault: init gcm: %w", err)
+	}
+	set := make(map[string]struct{}, len(providers))
+	for _, p := range providers {
+		set[p] = struct{}{}
+	}
+	return &Vault{
+		tenantID:   tenantID,
+		aead:       aead,
+		store:      store,
+		retention:  retention,
+		providers:  set,
+		refreshers: map[string]Refresher{},
+		now:        func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// WithRefresher はプロバイダのトークン更新を登録する。生成直後に呼ぶこと。
+func (v *Vault) WithRefresher(provider string, r Refresher) *Vault {
+	v.refreshers[provider] = r
+	return v
+}
+
+// Enabled はプロバイダのトークンを保管対象にしているかを返す。
+func (v *Vault) Enabled(provider string) bool {
+	_, ok := v.providers[provider]
+	return ok
+}
+
+// Save はトークンを暗号化して保存する。保管対象外のプロバイダは何もしない。
+func (v *Vault) Save(ctx context.Context, provider, subject string, token Token) error {
+	if !v.Enabled(provider) {
+		return nil
+	}
+	return v.put(ctx, provider, subject, token)
+}
+
+// Get はトークンを復号して返す。期限が近くリフレッシュトークンがあれば更新してから返す。
+func (v *Vault) Get(ctx context.Context, provider, subject string) (*Token, error) {
+	if !v.Enabled(provider) {
+		return nil, ErrNotFound
+	}
+	// 同じユーザーの更新を直列化する（X のリフレッシュトークンは1回限り有効）。
+	mu := v.lock(provider, subject)
+	mu.Lock()
+	defer mu.Unlock()
+
+	token, err := v.get(ctx, provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	if token.ExpiresAt.IsZero() || v.now().Add(refreshSkew).Before(token.ExpiresAt) {
+		return token, nil
+	}
+
+	refresher, ok := v.refreshers[provider]
+	if !ok || token.RefreshToken == "" {
+		if v.now().Before(token.ExpiresAt) {
+			return token, nil
+		}
+		return nil, ErrExpired
+	}
+	refreshed, err := refresher.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		// 別のプロセスが先に更新していれば、使ったリフレッシュトークンは無効になっている。
+		if current, getErr := v.get(ctx, provider, subject); getErr == nil &&
+			current.RefreshToken != token.RefreshToken && v.now().Before(current.ExpiresAt) {
+			return current, nil
+		}
+		return nil, fmt.Errorf("tokenvault: refresh %s token: %w", provider, err)
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	if err := v.put(ctx, provider, subject, *refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// lock はユーザーの更新を直列化するロックを返す。別のユーザーが同じロックを共有することがある。
+func (v *Vault) lock(provider, subject string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write(v.additionalData(provider, subject))
+	return &v.locks[h.Sum32()%lockStripes]
+}
+
+func (v *Vault) put(ctx context.Context, provider, subject string, token Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("tokenvault: marshal token: %w", err)
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("tokenvault: generate nonce: %w", err)
+	}
+	sealed := v.aead.Seal(nonce, nonce, plain, v.additionalData(provider, subject))
+	if err := v.store.Put(ctx, v.key(provider, subject), sealed, v.retention); err != nil {
+		return fmt.Errorf("tokenvault: store token: %w", err)
+	}
+	return nil
+}
+
+func (v *Vault) get(ctx context.Context, provider, subject string) (*Token, error) {
+	sealed, ok, err := v.store.Get(ctx, v.key(provider, subject))
+	if err != nil {
+		return nil, fmt.Errorf("tokenvault: get token: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	size := v.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("tokenvault: malformed ciphertext")
+	}
+	plain, err := v.aead.Open(nil, sealed[:size], sealed[size:], v.additionalData(provider, subject))
+	if err != nil {
+		return nil, fmt.Errorf("tokenvault: decrypt token: %w", err)
+	}
+	var token Token
+	if err := json.Unmarshal(plain, &token); err != nil {
+		return nil, fmt.Errorf("tokenvault: decode token: %w", err)
+	}
+	return &token, nil
+}
+
+// key はテナント・プロバイダ・ユーザーからKVで使える文字だけのキーを作る。
+func (v *Vault) key(provider, subject string) string {
+	sum := sha256.Sum256(v.additionalData(provider, subject))
+	return keyPrefix + hex.EncodeToString(sum[:])
+}
+
+// additionalData は暗号文を別のユーザーのキーへ差し替えられないよう、GCMの追加認証データに使う。
+func (v *Vault) additionalData(provider, subject string) []byte {
+	return []byte(v.tenantID + "\x00" + provider + "\x00" + subject)
+}
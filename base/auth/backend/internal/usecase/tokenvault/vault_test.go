@@ -0,0 +1,210 @@
+package tokenvault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/auth/internal/infra/grantstore"
+)
+
+var testKey = bytes.Repeat([]byte{7}, 32)
+
+// 保存・取得・期限切れ時の更新をテーブル駆動で確認する。
+func TestVault_Get(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		saved       Token
+		refresher   *fakeRefresher
+		wantToken   string
+		wantRefresh string
+		wantCalls   int
+		wantErr     error
+	}{
+		{
+			name:      "期限内はそのまま返す",
+			saved:     Token{AccessToken: "at1", RefreshToken: "rt1", ExpiresAt: now.Add(time.Hour)},
+			refresher: &fakeRefresher{},
+			wantToken: "at1",
+		},
+		{
+			name:        "期限が近ければ更新し、新しいリフレッシュトークンを保存する",
+			saved:       Token{AccessToken: "at1", RefreshToken: "rt1", ExpiresAt: now.Add(30 * time.Second)},
+			refresher:   &fakeRefresher{token: Token{AccessToken: "at2", RefreshToken: "rt2", ExpiresAt: now.Add(2 * time.Hour)}},
+			wantToken:   "at2",
+			wantRefresh: "rt2",
+			wantCalls:   1,
+		},
+		{
+			name:        "更新でリフレッシュトークンが返らなければ以前のものを残す",
+			saved:       Token{AccessToken: "at1", RefreshToken: "rt1", ExpiresAt: now.Add(-time.Minute)},
+			refresher:   &fakeRefresher{token: Token{AccessToken: "at2", ExpiresAt: now.Add(2 * time.Hour)}},
+			wantToken:   "at2",
+			wantRefresh: "rt1",
+			wantCalls:   1,
+		},
+		{
+			name:    "リフレッシュトークンがなく期限切れ",
+			saved:   Token{AccessToken: "at1", ExpiresAt: now.Add(-time.Minute)},
+			wantErr: ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			v, err := NewVault("tenant1", testKey, grantstore.NewMemory(), []string{"twitter"}, 24*time.Hour)
+			if err != nil {
+				t.Fatalf("NewVault: %v", err)
+			}
+			v.now = func() time.Time { return now }
+			if tt.refresher != nil {
+				v.WithRefresher("twitter", tt.refresher)
+			}
+			if err := v.Save(ctx, "twitter", "42", tt.saved); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			got, err := v.Get(ctx, "twitter", "42")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.AccessToken != tt.wantToken {
+				t.Fatalf("access token=%s want %s", got.AccessToken, tt.wantToken)
+			}
+			if tt.refresher != nil && tt.refresher.calls != tt.wantCalls {
+				t.Fatalf("refresh calls=%d want %d", tt.refresher.calls, tt.wantCalls)
+			}
+			if tt.wantRefresh != "" {
+				stored, err := v.get(ctx, "twitter", "42")
+				if err != nil || stored.RefreshToken != tt.wantRefresh || stored.AccessToken != tt.wantToken {
+					t.Fatalf("stored=%+v err=%v", stored, err)
+				}
+			}
+		})
+	}
+}
+
+// 暗号化して保存し、別ユーザー・別テナントの鍵では読めないことを確認する。
+func TestVault_Isolation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := grantstore.NewMemory()
+
+	v, err := NewVault("tenant1", testKey, store, []string{"line"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewVault: %v", err)
+	}
+	if err := v.Save(ctx, "line", "U1", Token{AccessToken: "secret-access-token"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	raw, ok, err := store.Get(ctx, v.key("line", "U1"))
+	if err != nil || !ok || bytes.Contains(raw, []byte("secret-access-token")) {
+		t.Fatalf("token must be stored encrypted: ok=%v err=%v", ok, err)
+	}
+
+	if _, err := v.Get(ctx, "line", "U2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other user err=%v", err)
+	}
+	// 保管対象外のプロバイダは保存しない。
+	if err := v.Save(ctx, "twitter", "U1", Token{AccessToken: "x"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := v.Get(ctx, "twitter", "U1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("disabled provider err=%v", err)
+	}
+
+	other, err := NewVault("tenant1", bytes.Repeat([]byte{8}, 32), store, []string{"line"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewVault: %v", err)
+	}
+	if _, err := other.Get(ctx, "line", "U1"); err == nil {
+		t.Fatal("different key must not decrypt")
+	}
+}
+
+// 別のプロセスが先に更新して自分の更新が失敗したら、保存し直されたトークンを返す。
+func TestVault_GetAfterConcurrentRefresh(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := grantstore.NewMemory()
+
+	newVault := func() *Vault {
+		v, err := NewVault("tenant1", testKey, store, []string{"twitter"}, 24*time.Hour)
+		if err != nil {
+			t.Fatalf("NewVault: %v", err)
+		}
+		v.now = func() time.Time { return now }
+		return v
+	}
+	v, other := newVault(), newVault()
+
+	tests := []struct {
+		name      string
+		saved     Token
+		wantToken string
+		wantErr   bool
+	}{
+		{name: "相手の更新結果を返す", saved: Token{AccessToken: "at2", RefreshToken: "rt2", ExpiresAt: now.Add(2 * time.Hour)}, wantToken: "at2"},
+		{name: "相手が保存していなければ失敗", saved: Token{AccessToken: "at1", RefreshToken: "rt1", ExpiresAt: now}, wantErr: true},
+	}
+	// 同じバケットを使うので順に実行する。
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Save(ctx, "twitter", "42", Token{AccessToken: "at1", RefreshToken: "rt1", ExpiresAt: now}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			v.WithRefresher("twitter", &fakeRefresher{
+				err: errors.New("invalid_request"),
+				onRefresh: func() {
+					if err := other.Save(ctx, "twitter", "42", tt.saved); err != nil {
+						t.Fatalf("Save: %v", err)
+					}
+				},
+			})
+			got, err := v.Get(ctx, "twitter", "42")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil || got.AccessToken != tt.wantToken {
+				t.Fatalf("got=%+v err=%v", got, err)
+			}
+		})
+	}
+}
+
+// --- fakes ---
+
+type fakeRefresher struct {
+	token Token
+	err   error
+	calls int
+	// onRefresh は更新の途中に割り込む処理。別のプロセスとの同時更新の再現に使う。
+	onRefresh func()
+}
+
+func (f *fakeRefresher) Refresh(_ context.Context, _ string) (*Token, error) {
+	f.calls++
+	if f.onRefresh != nil {
+		f.onRefresh()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	tok := f.token
+	return &tok, nil
+}
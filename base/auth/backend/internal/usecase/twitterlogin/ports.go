@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/twitteruser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 // TwitterClient はTwitter OAuth2 APIとのやりとりを抽象化する。
@@ -19,6 +20,7 @@ type Token struct {
 	RefreshToken string
 	TokenType    string
 	ExpiresIn    int
+	Scope        string
 }
 
 // Profile はTwitterプロフィールAPIの結果をユースケース向けに整形したもの。
@@ -27,4 +29,11 @@ type Profile struct {
 	DisplayName string
 	Username    string
 	AvatarURL   string
+	// Attributes は user.fields で追加取得したフィールド（APIのフィールド名がキー）。
+	Attributes map[string]any
+}
+
+// TokenVault は上流のトークンを後のAPI呼び出しのために保管する。
+type TokenVault interface {
+	Save(ctx context.Context, provider, subject string, token tokenvault.Token) error
 }
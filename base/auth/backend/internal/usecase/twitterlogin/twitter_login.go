@@ -6,8 +6,10 @@ import (
 	"encoding/base64"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/twitteruser"
+	"github.com/sngm3741/roots/base/auth/internal/usecase/tokenvault"
 )
 
 var (
@@ -25,12 +27,15 @@ type Usecase struct {
 	verifiers             *verifierStore
 	allowedOrigins        map[string]struct{}
 	defaultRedirectOrigin string
+	vault                 TokenVault
 }
 
 // StartOutput はログイン開始時の戻り値。
 type StartOutput struct {
 	AuthorizationURL string
 	State            string
+	// Nonce はstateに埋め込んだnonceで、ブラウザへの紐付けに使う。
+	Nonce string
 }
 
 // CallbackResult はコールバック処理の結果を表す。
@@ -74,6 +79,12 @@ func NewUsecase(states StateManager, twitter TwitterClient, tokens TokenIssuer,
 	}
 }
 
+// WithTokenVault はログイン時にXのトークンを保管するよう設定する。
+func (u *Usecase) WithTokenVault(v TokenVault) *Usecase {
+	u.vault = v
+	return u
+}
+
 // Start はPKCE code_challenge と state を生成し、認可URLを返す。
 func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error) {
 	origin = strings.TrimSpace(origin)
@@ -84,7 +95,7 @@ func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error
 		return nil, ErrOriginNotAllowed
 	}
 
-	state, _, err := u.states.Issue(origin)
+	state, statePayload, err := u.states.Issue(ctx, origin)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +110,7 @@ func (u *Usecase) Start(ctx context.Context, origin string) (*StartOutput, error
 	return &StartOutput{
 		AuthorizationURL: u.twitter.BuildAuthorizeURL(state, codeChallenge),
 		State:            state,
+		Nonce:            statePayload.Nonce,
 	}, nil
 }
 
@@ -117,12 +129,15 @@ func (u *Usecase) Callback(ctx context.Context, code, stateParam string) (*Callb
 		}, nil
 	}
 
-	payload, err := u.states.Verify(stateParam)
+	payload, err := u.states.Verify(ctx, stateParam)
 	if err != nil {
 		origin := u.extractOrigin(stateParam)
 		message := "無効なログイン試行です。再度お試しください。"
-		if errors.Is(err, ErrStateExpired) {
+		switch {
+		case errors.Is(err, ErrStateExpired):
 			message = "ログインの有効期限が切れました。もう一度お試しください。"
+		case errors.Is(err, ErrStateReused):
+			message = "このログイン応答は既に使用されています。もう一度お試しください。"
 		}
 		return &CallbackResult{
 			Success:      false,
@@ -166,6 +181,30 @@ func (u *Usecase) Callback(ctx context.Context, code, stateParam string) (*Callb
 	if err != nil {
 		return nil, err
 	}
+	if len(profile.Attributes) > 0 {
+		tu = tu.WithAttributes(profile.Attributes)
+	}
+
+	if u.vault != nil {
+		var expiresAt time.Time
+		if tokenResp.ExpiresIn > 0 {
+			expiresAt = time.Now().UTC().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+		}
+		if err := u.vault.Save(ctx, "twitter", string(tu.ID()), tokenvault.Token{
+			AccessToken:  tokenResp.AccessToken,
+			RefreshToken: tokenResp.RefreshToken,
+			TokenType:    tokenResp.TokenType,
+			Scope:        tokenResp.Scope,
+			ExpiresAt:    expiresAt,
+		}); err != nil {
+			return &CallbackResult{
+				Success:      false,
+				State:        stateParam,
+				Origin:       payload.Origin,
+				ErrorMessage: "ログイン情報の保存に失敗しました。時間を置いて再度お試しください。",
+			}, nil
+		}
+	}
 
 	appToken, expiresIn, err := u.tokens.Issue(tu)
 	if err != nil {
@@ -203,7 +242,8 @@ func (u *Usecase) extractOrigin(state string) string {
 	if err != nil {
 		return u.defaultRedirectOrigin
 	}
-	if payload.Origin != "" {
+	// 検証に失敗したstateでも署名は正しいが、許可オリジン外には戻さない。
+	if payload.Origin != "" && u.isOriginAllowed(payload.Origin) {
 		return payload.Origin
 	}
 	return u.defaultRedirectOrigin
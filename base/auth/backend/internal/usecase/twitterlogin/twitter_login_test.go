@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/sngm3741/roots/base/auth/internal/domain/twitteruser"
+	"github.com/sngm3741/roots/base/auth/internal/infra/noncestore"
 )
 
 type fakeTwitterClient struct {
@@ -188,7 +189,7 @@ func TestUsecase_Callback(t *testing.T) {
 }
 
 func mustState(m *HMACStateManager, origin string) string {
-	state, _, err := m.Issue(origin)
+	state, _, err := m.Issue(context.Background(), origin)
 	if err != nil {
 		panic(err)
 	}
@@ -196,7 +197,7 @@ func mustState(m *HMACStateManager, origin string) string {
 }
 
 func newStateMgr() *HMACStateManager {
-	m := NewHMACStateManager([]byte("secret"), time.Minute)
+	m := NewHMACStateManager([]byte("secret"), time.Minute, noncestore.NewMemory())
 	m.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
 	return m
 }
@@ -0,0 +1,402 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// イベント種別。first_login はそのテナントで初めてのログインのときだけ、login は毎回送る。
+const (
+	EventLogin      = "login"
+	EventFirstLogin = "first_login"
+)
+
+// 配信時のHTTPヘッダ。
+const (
+	HeaderID        = "X-Auth-Webhook-Id"
+	HeaderEvent     = "X-Auth-Webhook-Event"
+	HeaderTimestamp = "X-Auth-Webhook-Timestamp"
+	HeaderSignature = "X-Auth-Webhook-Signature"
+)
+
+// 配信の状態。
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	keyPrefix = "webhook."
+	// seenRetention は初回ログイン判定に使う記録の保持期間。最後のログインからこの期間が過ぎると再び first_login になる。
+	seenRetention = 365 * 24 * time.Hour
+	// logRetention・logLimit は配信ログの保持期間と件数。
+	logRetention = 7 * 24 * time.Hour
+	logLimit     = 100
+	// maxBackoff は再送間隔の上限。
+	maxBackoff = 10 * time.Minute
+	// maxErrorLength は配信ログに残すエラー文の長さ。
+	maxErrorLength = 200
+)
+
+// User は通知するログインユーザー。
+type User struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Name     string `json:"name,omitempty"`
+	Picture  string `json:"picture,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// Event はWebhookの本文。
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Tenant     string    `json:"tenant"`
+	OccurredAt time.Time `json:"occurredAt"`
+	User       User      `json:"user"`
+}
+
+// Endpoint はテナントの通知先。Events が空なら全種別を送る。
+type Endpoint struct {
+	URL    string
+	Secret string
+	Events []string
+}
+
+func (e Endpoint) subscribes(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery は配信ログの1件。再送しても同じIDで更新する。
+type Delivery struct {
+	ID             string    `json:"id"`
+	EventID        string    `json:"eventId"`
+	Event          string    `json:"event"`
+	URL            string    `json:"url"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	LastStatusCode int       `json:"lastStatusCode,omitempty"`
+	LastError      string    `json:"lastError,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Store は初回ログインの記録と配信ログの保存先。Get は未登録・期限切れの場合にfalseを返す。
+type Store interface {
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+}
+
+// Dispatcher はテナントのログインをWebhookで通知する。配信はリクエストとは別のゴルーチンで行い、
+// 失敗すると指数バックオフで maxAttempts 回まで再送する。再送は同じプロセス内で行うため、
+// 終了時は Shutdown で再送待ちを打ち切り、残りの配信を1回ずつ送ってから止める。
+type Dispatcher struct {
+	tenantID    string
+	endpoints   []Endpoint
+	store       Store
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	now         func() time.Time
+	// sleep は再送までの待機。stop が閉じられたら待たずに false を返す。
+	sleep    func(wait time.Duration, stop <-chan struct{}) bool
+	logMu    sync.Mutex
+	inflight sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDispatcher はDispatcherを生成する。backoff は初回の再送間隔で、以降は倍にしていく。
+func NewDispatcher(tenantID string, endpoints []Endpoint, store Store, client *http.Client, maxAttempts int, backoff time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		tenantID:    tenantID,
+		endpoints:   append([]Endpoint(nil), endpoints...),
+		store:       store,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		now:         func() time.Time { return time.Now().UTC() },
+		sleep:       sleepUntil,
+		stop:        make(chan struct{}),
+	}
+}
+
+// sleepUntil は wait だけ待つ。途中で stop が閉じられたら false を返す。
+func sleepUntil(wait time.Duration, stop <-chan struct{}) bool {
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Notify はログインを記録し、購読している通知先へ login（初回なら first_login も）を配信する。
+// 配信の完了は待たない。返すエラーは初回判定や配信ログの保存の失敗で、ログインそのものは止めない想定。
+func (d *Dispatcher) Notify(ctx context.Context, user User) error {
+	first, err := d.markSeen(ctx, user)
+	if err != nil {
+		return err
+	}
+	types := []string{EventLogin}
+	if first {
+		types = []string{EventFirstLogin, EventLogin}
+	}
+
+	now := d.now()
+	for _, typ := range types {
+		event := Event{ID: "evt_" + randomID(), Type: typ, Tenant: d.tenantID, OccurredAt: now, User: user}
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("webhook: marshal event: %w", err)
+		}
+		for _, ep := range d.endpoints {
+			if !ep.subscribes(typ) {
+				continue
+			}
+			delivery := Delivery{
+				ID:        "dlv_" + randomID(),
+				EventID:   event.ID,
+				Event:     typ,
+				URL:       ep.URL,
+				Status:    StatusPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := d.record(ctx, delivery); err != nil {
+				return err
+			}
+			d.inflight.Add(1)
+			go func(ep Endpoint, delivery Delivery) {
+				defer d.inflight.Done()
+				d.deliver(ep, delivery, body)
+			}(ep, delivery)
+		}
+	}
+	return nil
+}
+
+// Wait は配信中のWebhookがすべて終わるまで待つ。テストで使う。
+func (d *Dispatcher) Wait() {
+	d.inflight.Wait()
+}
+
+// Shutdown は再送待ちを打ち切り、配信中のWebhookが終わるまで ctx の期限まで待つ。
+// 再送を待っていた配信はすぐに最後の1回を送り、失敗すればそのまま failed として記録する。
+// 期限までに終わらなければ ctx のエラーを返す。
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.stopOnce.Do(func() { close(d.stop) })
+	done := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) stopping() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Deliveries は新しい順の配信ログを返す。
+func (d *Dispatcher) Deliveries(ctx context.Context) ([]Delivery, error) {
+	raw, ok, err := d.store.Get(ctx, d.logKey())
+	if err != nil {
+		return nil, fmt.Errorf("webhook: load deliveries: %w", err)
+	}
+	if !ok {
+		return []Delivery{}, nil
+	}
+	var deliveries []Delivery
+	if err := json.Unmarshal(raw, &deliveries); err != nil {
+		return nil, fmt.Errorf("webhook: decode deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// deliver は成功するか再送不能になるまで配信を繰り返し、試行ごとに配信ログを更新する。
+func (d *Dispatcher) deliver(ep Endpoint, delivery Delivery, body []byte) {
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		if attempt > 1 {
+			d.sleep(d.backoffFor(attempt-1), d.stop)
+		}
+		statusCode, retryable, err := d.send(ep, delivery, body)
+		delivery.Attempts = attempt
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = ""
+		delivery.UpdatedAt = d.now()
+		switch {
+		case err == nil:
+			delivery.Status = StatusSucceeded
+		case retryable && attempt < d.maxAttempts && !d.stopping():
+			delivery.Status = StatusPending
+			delivery.LastError = truncate(err.Error())
+		case retryable && attempt < d.maxAttempts:
+			delivery.Status = StatusFailed
+			delivery.LastError = truncate("shutdown before retry: " + err.Error())
+		default:
+			delivery.Status = StatusFailed
+			delivery.LastError = truncate(err.Error())
+		}
+		// 配信ログの保存失敗で配信自体は止めない。
+		_ = d.record(context.Background(), delivery)
+		if delivery.Status != StatusPending {
+			return
+		}
+	}
+}
+
+// send は1回分の配信を行う。5xx・408・429・通信エラーは再送対象とする。
+func (d *Dispatcher) send(ep Endpoint, delivery Delivery, body []byte) (int, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("build request: %w", err)
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(ep.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, false, nil
+	}
+	retryable := res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests
+	return res.StatusCode, retryable, fmt.Errorf("unexpected status %d", res.StatusCode)
+}
+
+// Sign は "v1=" に続けて HMAC-SHA256(secret, "<timestamp>.<body>") の16進を返す。
+// 受信側はタイムスタンプが新しいこと（数分以内）も確かめて再送攻撃を防ぐ。
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// markSeen はユーザーのログインを記録し、記録がなかった（初回）かを返す。
+// 同時ログインでは first_login が重複しうるため、受信側は冪等に処理する。
+func (d *Dispatcher) markSeen(ctx context.Context, user User) (bool, error) {
+	key := d.seenKey(user)
+	_, seen, err := d.store.Get(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("webhook: load login record: %w", err)
+	}
+	if err := d.store.Put(ctx, key, []byte("1"), seenRetention); err != nil {
+		return false, fmt.Errorf("webhook: save login record: %w", err)
+	}
+	return !seen, nil
+}
+
+// record は配信ログに追加（同じIDがあれば更新）し、新しい順に logLimit 件まで残す。
+// 更新はプロセス内で直列化する。複数インスタンスから同時に書くと一部の更新が失われることがある。
+func (d *Dispatcher) record(ctx context.Context, delivery Delivery) error {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	deliveries, err := d.Deliveries(ctx)
+	if err != nil {
+		return err
+	}
+	updated := make([]Delivery, 0, len(deliveries)+1)
+	updated = append(updated, delivery)
+	for _, existing := range deliveries {
+		if existing.ID != delivery.ID {
+			updated = append(updated, existing)
+		}
+	}
+	if len(updated) > logLimit {
+		updated = updated[:logLimit]
+	}
+	raw, err := json.Marshal(updated)
+	if err != nil {
+		return fmt.Errorf("webhook: encode deliveries: %w", err)
+	}
+	if err := d.store.Put(ctx, d.logKey(), raw, logRetention); err != nil {
+		return fmt.Errorf("webhook: save deliveries: %w", err)
+	}
+	return nil
+}
+
+// backoffFor は n 回目の失敗後の待ち時間を返す。
+func (d *Dispatcher) backoffFor(n int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < n && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// seenKey はテナント・プロバイダ・ユーザーからKVで使える文字だけのキーを作る。
+func (d *Dispatcher) seenKey(user User) string {
+	sum := sha256.Sum256([]byte(d.tenantID + "\x00" + user.Provider + "\x00" + user.Subject))
+	return keyPrefix + "seen." + hex.EncodeToString(sum[:])
+}
+
+func (d *Dispatcher) logKey() string {
+	sum := sha256.Sum256([]byte(d.tenantID))
+	return keyPrefix + "log." + hex.EncodeToString(sum[:])
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
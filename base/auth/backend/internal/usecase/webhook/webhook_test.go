@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 初回ログインでは first_login と login、2回目以降は login だけを、署名付きで購読先へ送る。
+func TestDispatcher_Notify(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+
+	d := NewDispatcher("tenant1", []Endpoint{
+		{URL: srv.URL + "/all", Secret: "s1"},
+		{URL: srv.URL + "/first", Secret: "s2", Events: []string{EventFirstLogin}},
+	}, newMemoryStore(), srv.Client(), 3, time.Second)
+
+	user := User{Provider: "line", Subject: "U123", Name: "テスト"}
+	if err := d.Notify(context.Background(), user); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	d.Wait()
+	if err := d.Notify(context.Background(), user); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	d.Wait()
+
+	got := map[string]int{}
+	for _, req := range rec.requests() {
+		var event Event
+		if err := json.Unmarshal(req.body, &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		secret := map[string]string{"/all": "s1", "/first": "s2"}[req.path]
+		ts, err := strconv.ParseInt(req.header.Get(HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Fatalf("timestamp: %v", err)
+		}
+		if req.header.Get(HeaderSignature) != Sign(secret, ts, req.body) {
+			t.Fatalf("signature mismatch for %s", req.path)
+		}
+		if req.header.Get(HeaderEvent) != event.Type || req.header.Get(HeaderID) == "" {
+			t.Fatalf("unexpected headers: %v", req.header)
+		}
+		if event.Tenant != "tenant1" || event.User != user {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+		got[req.path+" "+event.Type]++
+	}
+	want := map[string]int{"/all first_login": 1, "/all login": 2, "/first first_login": 1}
+	if len(got) != len(want) {
+		t.Fatalf("deliveries=%v want=%v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("deliveries=%v want=%v", got, want)
+		}
+	}
+
+	deliveries, err := d.Deliveries(context.Background())
+	if err != nil {
+		t.Fatalf("deliveries: %v", err)
+	}
+	if len(deliveries) != 4 {
+		t.Fatalf("log entries=%d want=4", len(deliveries))
+	}
+	for _, dl := range deliveries {
+		if dl.Status != StatusSucceeded || dl.Attempts != 1 || dl.LastStatusCode != http.StatusOK {
+			t.Fatalf("unexpected log entry: %+v", dl)
+		}
+	}
+}
+
+// 応答に応じた再送・打ち切りと、倍々の待ち時間を確認する。
+func TestDispatcher_Retry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+		wantWaits    []time.Duration
+	}{
+		{name: "一時的な失敗の後に成功", statuses: []int{500, 503, 200}, wantStatus: StatusSucceeded, wantAttempts: 3, wantWaits: []time.Duration{time.Second, 2 * time.Second}},
+		{name: "429は再送", statuses: []int{429, 204}, wantStatus: StatusSucceeded, wantAttempts: 2, wantWaits: []time.Duration{time.Second}},
+		{name: "4xxは再送しない", statuses: []int{400}, wantStatus: StatusFailed, wantAttempts: 1},
+		{name: "上限まで失敗", statuses: []int{500, 500, 500, 500}, wantStatus: StatusFailed, wantAttempts: 4, wantWaits: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				mu.Lock()
+				status := tt.statuses[calls]
+				calls++
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			t.Cleanup(srv.Close)
+
+			d := NewDispatcher("tenant1", []Endpoint{{URL: srv.URL, Secret: "s", Events: []string{EventLogin}}}, newMemoryStore(), srv.Client(), 4, time.Second)
+			var waits []time.Duration
+			d.sleep = func(wait time.Duration, _ <-chan struct{}) bool {
+				waits = append(waits, wait)
+				return true
+			}
+
+			if err := d.Notify(context.Background(), User{Provider: "line", Subject: "U1"}); err != nil {
+				t.Fatalf("notify: %v", err)
+			}
+			d.Wait()
+
+			deliveries, err := d.Deliveries(context.Background())
+			if err != nil {
+				t.Fatalf("deliveries: %v", err)
+			}
+			if len(deliveries) != 1 {
+				t.Fatalf("log entries=%d want=1", len(deliveries))
+			}
+			dl := deliveries[0]
+			if dl.Status != tt.wantStatus || dl.Attempts != tt.wantAttempts {
+				t.Fatalf("delivery=%+v want status=%s attempts=%d", dl, tt.wantStatus, tt.wantAttempts)
+			}
+			if tt.wantStatus == StatusFailed && dl.LastError == "" {
+				t.Fatalf("last error is empty: %+v", dl)
+			}
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("waits=%v want=%v", waits, tt.wantWaits)
+			}
+			for i := range waits {
+				if waits[i] != tt.wantWaits[i] {
+					t.Fatalf("waits=%v want=%v", waits, tt.wantWaits)
+				}
+			}
+		})
+	}
+}
+
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	reqs []recordedRequest
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.reqs = append(r.reqs, recordedRequest{path: req.URL.Path, header: req.Header.Clone(), body: body})
+	r.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *recorder) requests() []recordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedRequest(nil), r.reqs...)
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string][]byte{}}
+}
+
+func (m *memoryStore) Put(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	return v, ok, nil
+}
+
+// 終了処理は再送待ちの配信をすぐに1回送り直し、失敗すれば failed として記録してから戻る。
+func TestDispatcher_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "再送が成功", statuses: []int{500, 200}, wantStatus: StatusSucceeded, wantAttempts: 2},
+		{name: "再送も失敗", statuses: []int{500, 500}, wantStatus: StatusFailed, wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				mu.Lock()
+				status := tt.statuses[calls]
+				calls++
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			t.Cleanup(srv.Close)
+
+			// 再送間隔を1時間にし、Shutdown がなければ終わらない状態にする。
+			d := NewDispatcher("tenant1", []Endpoint{{URL: srv.URL, Secret: "s", Events: []string{EventLogin}}}, newMemoryStore(), srv.Client(), 6, time.Hour)
+			waiting := make(chan struct{})
+			d.sleep = func(wait time.Duration, stop <-chan struct{}) bool {
+				close(waiting)
+				return sleepUntil(wait, stop)
+			}
+			if err := d.Notify(context.Background(), User{Provider: "line", Subject: "U1"}); err != nil {
+				t.Fatalf("notify: %v", err)
+			}
+			<-waiting
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.Shutdown(ctx); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+			deliveries, err := d.Deliveries(context.Background())
+			if err != nil {
+				t.Fatalf("deliveries: %v", err)
+			}
+			if len(deliveries) != 1 || deliveries[0].Status != tt.wantStatus || deliveries[0].Attempts != tt.wantAttempts {
+				t.Fatalf("deliveries=%+v want status=%s attempts=%d", deliveries, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// 期限までに配信が終わらなければ Shutdown は ctx のエラーを返す。
+func TestDispatcher_ShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	d := NewDispatcher("tenant1", []Endpoint{{URL: srv.URL, Secret: "s", Events: []string{EventLogin}}}, newMemoryStore(), srv.Client(), 1, time.Second)
+	if err := d.Notify(context.Background(), User{Provider: "line", Subject: "U1"}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v want deadline exceeded", err)
+	}
+}
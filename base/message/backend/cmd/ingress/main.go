@@ -16,12 +16,19 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/sngm3741/roots/base/message/internal/adapter/http/handler"
 	"github.com/sngm3741/roots/base/message/internal/config"
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
+	"github.com/sngm3741/roots/base/message/internal/infra/memory"
 	natsinfra "github.com/sngm3741/roots/base/message/internal/infra/nats"
+	"github.com/sngm3741/roots/base/message/internal/infra/serviceauth"
 	"github.com/sngm3741/roots/base/message/internal/tenant"
 	"github.com/sngm3741/roots/base/message/internal/usecase/ingress"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
 func main() {
@@ -92,16 +99,24 @@ func waitForShutdown(srv *http.Server, errChan <-chan error, logger func(format
 	_ = srv.Shutdown(ctx)
 }
 
+// /send を呼ぶサービストークンに要求する宛先とスコープ。
+const (
+	serviceAuthAudience = "message"
+	serviceAuthScope    = "message:send"
+)
+
 type ingressResolver struct {
-	loader    *tenant.Loader
-	services  sync.Map
-	natsConns sync.Map // key: natsURL -> *nats.Conn
-	dial      func(url string) (*natsgo.Conn, error)
+	loader     *tenant.Loader
+	httpClient *http.Client
+	services   sync.Map
+	natsConns  sync.Map // key: natsURL -> *nats.Conn
+	dial       func(url string) (*natsgo.Conn, error)
 }
 
 func newIngressResolver(loader *tenant.Loader) *ingressResolver {
 	return &ingressResolver{
-		loader: loader,
+		loader:     loader,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
 		dial: func(url string) (*natsgo.Conn, error) {
 			return natsgo.Connect(url, natsgo.MaxReconnects(0))
 		},
@@ -125,21 +140,83 @@ func (r *ingressResolver) ResolveIngress(tenantID string) (handler.IngressTenant
 	if err != nil {
 		return handler.IngressTenantDeps{}, err
 	}
-	producer := natsinfra.NewProducer(conn)
+	producer, err := newProducer(conn, cfg)
+	if err != nil {
+		return handler.IngressTenantDeps{}, err
+	}
+	store, err := newStatusStore(conn, cfg)
+	if err != nil {
+		return handler.IngressTenantDeps{}, err
+	}
+	tracker := status.NewTracker(store)
+	scheduler, err := newScheduler(conn, cfg, tracker)
+	if err != nil {
+		return handler.IngressTenantDeps{}, err
+	}
+	// 構文は Loader が読み込み時に検証済み。
+	templates, err := msgtemplate.Compile(cfg.Templates)
+	if err != nil {
+		return handler.IngressTenantDeps{}, fmt.Errorf("tenant %s: templates: %w", tenantID, err)
+	}
 	publisher := ingress.NewPublisherImpl(producer)
 	service := ingress.NewService(publisher, ingress.Subjects{
 		Line:    cfg.LineSubject,
 		Discord: cfg.DiscordSubject,
-	})
+	}, tracker, scheduler, templates, log.Printf)
 
 	deps := handler.IngressTenantDeps{
-		Service: service,
-		Timeout: cfg.IngressTimeout,
+		Service:  service,
+		Timeout:  cfg.IngressTimeout,
+		Status:   tracker,
+		Schedule: scheduler,
+	}
+	if strings.TrimSpace(cfg.LineSubject) != "" && strings.TrimSpace(cfg.Line.NarrowcastProgressEndpoint) != "" {
+		deps.Progress = line.NewProgressReader(cfg.Line.NarrowcastProgressEndpoint, cfg.Line.ChannelToken, cfg.IngressTimeout)
+	}
+	if issuer := strings.TrimSpace(cfg.ServiceAuth.Issuer); issuer != "" {
+		deps.Auth = serviceauth.NewVerifier(r.httpClient, serviceauth.Config{
+			Issuer:   issuer,
+			JWKSURL:  cfg.ServiceAuth.JWKSURL,
+			Audience: serviceAuthAudience,
+			Scope:    serviceAuthScope,
+		})
 	}
 	r.services.Store(tenantID, deps)
 	return deps, nil
 }
 
+// newProducer はテナントのストリームへpublishするProducerを生成する。ストリームは初回publish時に作成する。
+func newProducer(conn *natsgo.Conn, cfg tenant.MessageTenant) (natsinfra.Producer, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	return natsinfra.NewProducer(js, natsinfra.TenantStream(cfg)), nil
+}
+
+// newStatusStore はテナント設定の status.backend に応じた配送状態の保存先を生成する。
+func newStatusStore(conn *natsgo.Conn, cfg tenant.MessageTenant) (status.Store, error) {
+	if cfg.Status.Backend == tenant.StatusBackendMemory {
+		return memory.NewStatusStore(), nil
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	return natsinfra.NewStatusStore(js, cfg.Status.Bucket, cfg.Status.TTL), nil
+}
+
+// newScheduler はテナントの配送予約を登録・一覧・取り消す schedule.Service を生成する。
+// 予約を送り出すのは worker の schedule.Dispatcher。
+func newScheduler(conn *natsgo.Conn, cfg tenant.MessageTenant, tracker *status.Tracker) (*schedule.Service, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	store := natsinfra.NewScheduleStore(js, cfg.Schedule.Bucket)
+	return schedule.NewService(store, tracker, cfg.Schedule.MaxDelay, log.Printf), nil
+}
+
 func (r *ingressResolver) natsConn(url string) (*natsgo.Conn, error) {
 	if v, ok := r.natsConns.Load(url); ok {
 		return v.(*natsgo.Conn), nil
@@ -55,11 +55,12 @@ func TestIngressResolver(t *testing.T) {
 	}
 
 	tests := []struct {
-		name      string
-		tenantID  string
-		wantError bool
+		name         string
+		tenantID     string
+		wantError    bool
+		wantProgress bool
 	}{
-		{name: "line+discord OK", tenantID: "both"},
+		{name: "line+discord OK", tenantID: "both", wantProgress: true},
 		{name: "discord only OK", tenantID: "discordOnly"},
 	}
 
@@ -80,6 +81,15 @@ func TestIngressResolver(t *testing.T) {
 			if deps.Timeout <= 0 {
 				t.Fatalf("timeout should be positive")
 			}
+			if deps.Status == nil {
+				t.Fatalf("status reader should be set")
+			}
+			if deps.Schedule == nil {
+				t.Fatalf("schedule manager should be set")
+			}
+			if (deps.Progress != nil) != tt.wantProgress {
+				t.Fatalf("progress reader set=%v want=%v", deps.Progress != nil, tt.wantProgress)
+			}
 		})
 	}
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/sngm3741/roots/base/message/internal/adapter/http/handler"
 	"github.com/sngm3741/roots/base/message/internal/config"
@@ -118,18 +119,35 @@ func (r *webhookResolver) ResolveLineWebhook(tenantID string) (handler.LineWebho
 	if strings.TrimSpace(cfg.LineSubject) == "" {
 		return handler.LineWebhookDeps{}, fmt.Errorf("tenant %s: line subject empty", tenantID)
 	}
+	if strings.TrimSpace(cfg.Line.ChannelSecret) == "" {
+		return handler.LineWebhookDeps{}, fmt.Errorf("tenant %s: line channelSecret empty", tenantID)
+	}
 	conn, err := r.natsConn(cfg.NATSURL)
 	if err != nil {
 		return handler.LineWebhookDeps{}, err
 	}
+	producer, err := newProducer(conn, cfg)
+	if err != nil {
+		return handler.LineWebhookDeps{}, err
+	}
 	deps := handler.LineWebhookDeps{
-		Producer: natsinfra.NewProducer(conn),
-		Subject:  cfg.LineSubject,
+		Producer:      producer,
+		Subject:       cfg.Events.LineSubject,
+		ChannelSecret: strings.TrimSpace(cfg.Line.ChannelSecret),
 	}
 	r.deps.Store(tenantID, deps)
 	return deps, nil
 }
 
+// newProducer はテナントの受信イベントのストリームへpublishするProducerを生成する。ストリームは初回publish時に作成する。
+func newProducer(conn *natsgo.Conn, cfg tenant.MessageTenant) (natsinfra.Producer, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	return natsinfra.NewProducer(js, natsinfra.EventStream(cfg)), nil
+}
+
 func (r *webhookResolver) natsConn(url string) (*natsgo.Conn, error) {
 	if v, ok := r.natsConns.Load(url); ok {
 		return v.(*natsgo.Conn), nil
@@ -10,7 +10,7 @@ import (
 	"github.com/sngm3741/roots/base/message/internal/tenant"
 )
 
-// webhookResolver のテーブル駆動テスト（LINE subject 有無の分岐）。
+// webhookResolver のテーブル駆動テスト（LINE subject・チャネルシークレット有無の分岐）。
 func TestWebhookResolver(t *testing.T) {
 	t.Parallel()
 
@@ -22,10 +22,19 @@ func TestWebhookResolver(t *testing.T) {
     line:
       pushEndpoint: https://api.line.me/v2/bot/message/push
       channelToken: tok
+      channelSecret: sec
     ingressTimeout: 5s
     workerHTTPTimeout: 5s
     discord:
       webhookURL: https://example.invalid/webhook-a
+  noSecret:
+    natsURL: nats://example:4222
+    lineSubject: line.c
+    line:
+      pushEndpoint: https://api.line.me/v2/bot/message/push
+      channelToken: tok
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
   noLine:
     natsURL: nats://example:4222
     discordSubject: discord.b
@@ -56,19 +65,24 @@ func TestWebhookResolver(t *testing.T) {
 	}{
 		{name: "line subject ok", tenantID: "hasLine"},
 		{name: "line subject missing", tenantID: "noLine", wantError: true},
+		{name: "channel secret missing", tenantID: "noSecret", wantError: true},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			_, err := resolver.ResolveLineWebhook(tt.tenantID)
+			deps, err := resolver.ResolveLineWebhook(tt.tenantID)
 			if tt.wantError && err == nil {
 				t.Fatalf("want error, got nil")
 			}
 			if !tt.wantError && err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
+			// 受信イベントは送信サブジェクトではなく専用のサブジェクトへ流す。
+			if !tt.wantError && deps.Subject != "line.inbound."+tt.tenantID {
+				t.Fatalf("subject=%s", deps.Subject)
+			}
 		})
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,11 +11,16 @@ import (
 	"time"
 
 	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/sngm3741/roots/base/message/internal/config"
 	"github.com/sngm3741/roots/base/message/internal/infra/discord"
 	"github.com/sngm3741/roots/base/message/internal/infra/line"
+	"github.com/sngm3741/roots/base/message/internal/infra/memory"
+	natsinfra "github.com/sngm3741/roots/base/message/internal/infra/nats"
 	"github.com/sngm3741/roots/base/message/internal/tenant"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 	"github.com/sngm3741/roots/base/message/internal/usecase/worker"
 )
 
@@ -32,44 +38,100 @@ func main() {
 	connPool := newNATSConnPool()
 	defer connPool.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var consumers []jetstream.ConsumeContext
 	tenants := loader.Tenants()
 	for tenantID, cfg := range tenants {
-		if err := setupTenantWorkers(tenantID, cfg, connPool); err != nil {
+		started, err := setupTenantWorkers(ctx, cfg, connPool)
+		if err != nil {
 			log.Fatalf("tenant %s worker init failed: %v", tenantID, err)
 		}
-		log.Printf("tenant %s workers started", tenantID)
+		consumers = append(consumers, started...)
+		log.Printf("tenant %s workers started (stream %s)", tenantID, cfg.Delivery.Stream)
 	}
 
 	wait()
+	// 処理中のメッセージは ack されずに残り、再起動後に再配送される。
+	for _, cc := range consumers {
+		cc.Stop()
+	}
 }
 
-func setupTenantWorkers(tenantID string, cfg tenant.MessageTenant, pool *natsConnPool) error {
+func setupTenantWorkers(ctx context.Context, cfg tenant.MessageTenant, pool *natsConnPool) ([]jetstream.ConsumeContext, error) {
 	if cfg.NATSURL == "" {
-		return fmt.Errorf("nats url empty")
+		return nil, fmt.Errorf("nats url empty")
 	}
 	nc, err := pool.Conn(cfg.NATSURL)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	stream := natsinfra.TenantStream(cfg)
+	if _, err := natsinfra.EnsureStream(ctx, js, stream); err != nil {
+		return nil, err
 	}
+	policy := worker.DeliveryPolicy{
+		MaxDeliver:        cfg.Delivery.MaxDeliver,
+		AckWait:           cfg.Delivery.AckWait,
+		Backoff:           cfg.Delivery.Backoff,
+		MaxBackoff:        cfg.Delivery.MaxBackoff,
+		DeadLetterSubject: cfg.Delivery.DeadLetterSubject,
+	}
+
+	tracker := status.NewTracker(newStatusStore(js, cfg))
+
+	// 予約は worker が送り出す。ctx が終わると止まる。
+	dispatcher := schedule.NewDispatcher(
+		natsinfra.NewScheduleStore(js, cfg.Schedule.Bucket),
+		natsinfra.NewProducer(js, stream),
+		tracker,
+		cfg.Schedule.PollInterval,
+		log.Printf,
+	)
+	go dispatcher.Run(ctx)
 
 	timeout := cfg.WorkerHTTPTimeout
 	if timeout <= 0 {
 		timeout = 5 * time.Second
 	}
 
+	var consumers []jetstream.ConsumeContext
 	if cfg.LineSubject != "" {
-		lineClient := line.NewPusher(cfg.Line.PushEndpoint, cfg.Line.ChannelToken, timeout)
-		if err := worker.BuildLineWorker(cfg.LineSubject, nc, lineClient, log.Printf); err != nil {
-			return fmt.Errorf("line worker: %w", err)
+		lineClient := line.NewPusher(line.Endpoints{
+			Push:       cfg.Line.PushEndpoint,
+			Multicast:  cfg.Line.MulticastEndpoint,
+			Broadcast:  cfg.Line.BroadcastEndpoint,
+			Narrowcast: cfg.Line.NarrowcastEndpoint,
+		}, cfg.Line.ChannelToken, timeout)
+		cc, err := worker.BuildLineWorker(ctx, cfg.LineSubject, js, stream.Name, policy, tracker, tracker, lineClient, log.Printf)
+		if err != nil {
+			return nil, fmt.Errorf("line worker: %w", err)
 		}
+		consumers = append(consumers, cc)
 	}
 	if cfg.DiscordSubject != "" {
 		discordClient := discord.NewSender(cfg.Discord.WebhookURL, cfg.Discord.Username, cfg.Discord.AvatarURL, timeout)
-		if err := worker.BuildDiscordWorker(cfg.DiscordSubject, nc, discordClient, log.Printf); err != nil {
-			return fmt.Errorf("discord worker: %w", err)
+		cc, err := worker.BuildDiscordWorker(ctx, cfg.DiscordSubject, js, stream.Name, policy, tracker, tracker, discordClient, log.Printf)
+		if err != nil {
+			return nil, fmt.Errorf("discord worker: %w", err)
 		}
+		consumers = append(consumers, cc)
+	}
+	return consumers, nil
+}
+
+// newStatusStore はテナント設定の status.backend に応じた配送状態の保存先を生成する。
+// memory は ingress と共有されないため、worker 側の遷移だけが残る。
+func newStatusStore(js jetstream.JetStream, cfg tenant.MessageTenant) status.Store {
+	if cfg.Status.Backend == tenant.StatusBackendMemory {
+		return memory.NewStatusStore()
 	}
-	return nil
+	return natsinfra.NewStatusStore(js, cfg.Status.Bucket, cfg.Status.TTL)
 }
 
 func wait() {
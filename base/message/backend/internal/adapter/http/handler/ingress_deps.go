@@ -3,17 +3,54 @@ package handler
 import (
 	"context"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
+	"github.com/sngm3741/roots/base/message/internal/infra/serviceauth"
+	"github.com/sngm3741/roots/base/message/internal/usecase/ingress"
 )
 
 // IngressTenantDeps は送信APIで利用するテナント依存情報をまとめる。
 type IngressTenantDeps struct {
 	Service IngressService
 	Timeout time.Duration
+	// Auth はサービストークンの検証器。nil の場合は呼び出し元を認証しない。
+	Auth ServiceTokenVerifier
+	// Status は配送状態の参照先。nil の場合は GET /messages/{id} が 404 を返す。
+	Status StatusReader
+	// Progress はLINEのナローキャスト進捗の照会先。nil の場合は GET /messages/{id}/progress が 404 を返す。
+	Progress NarrowcastProgressReader
+	// Schedule は配送予約の一覧・取り消し先。nil の場合は /scheduled が 404 を返す。
+	Schedule ScheduleManager
+}
+
+// ScheduleManager は配送予約を一覧・取り消す。schedule.Service が満たす。
+type ScheduleManager interface {
+	List(ctx context.Context) ([]message.Scheduled, error)
+	// Cancel は予約がなければ schedule.ErrNotFound、送り出し中なら schedule.ErrReleased を返す。
+	Cancel(ctx context.Context, id string) error
+}
+
+// NarrowcastProgressReader はLINEのリクエストIDからナローキャストの進捗を返す。line.ProgressReader が満たす。
+type NarrowcastProgressReader interface {
+	NarrowcastProgress(ctx context.Context, requestID string) (line.NarrowcastProgress, error)
+}
+
+// StatusReader はメッセージIDから配送状態を返す。未記録なら status.ErrNotFound。
+type StatusReader interface {
+	Get(ctx context.Context, id string) (message.Status, error)
+}
+
+// ServiceTokenVerifier はauthが発行したサービストークンを検証する。
+type ServiceTokenVerifier interface {
+	Verify(ctx context.Context, token string) (*serviceauth.Claims, error)
 }
 
-// IngressService はSendのみを要求する薄いインターフェース。
+// IngressService は送信と、送信済みのDiscord投稿の編集・削除を要求する薄いインターフェース。
 type IngressService interface {
-	Send(ctx context.Context, destination, userID, text string) error
+	Send(ctx context.Context, in ingress.SendInput) (ingress.SendResult, error)
+	Edit(ctx context.Context, in ingress.EditInput) (ingress.SendResult, error)
+	Delete(ctx context.Context, targetID string) (ingress.SendResult, error)
 }
 
 // IngressTenantResolver はテナントIDからIngress用依存を解決する。
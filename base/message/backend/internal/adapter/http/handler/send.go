@@ -4,16 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
+	"github.com/sngm3741/roots/base/message/internal/infra/serviceauth"
+	"github.com/sngm3741/roots/base/message/internal/usecase/ingress"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
-// SendHandler は外部からの送信要求を受け付ける。
+// SendHandler は外部からの送信要求を受け付け、配送状態を返す。
 type SendHandler struct {
 	resolver IngressTenantResolver
 	timeout  time.Duration
@@ -24,59 +34,426 @@ func NewSendHandler(resolver IngressTenantResolver, timeout time.Duration) *Send
 	return &SendHandler{resolver: resolver, timeout: timeout}
 }
 
-// Router は /send を登録したルーターを返す。
+// Router は /send と /messages/{id}（参照・編集・削除・ナローキャストの進捗）、
+// /scheduled（予約の一覧・取り消し）を登録したルーターを返す。
 func (h *SendHandler) Router() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
 	r.Post("/send", h.sendMessage)
+	r.Get("/messages/{id}", h.getStatus)
+	r.Get("/messages/{id}/progress", h.getProgress)
+	r.Patch("/messages/{id}", h.editMessage)
+	r.Delete("/messages/{id}", h.deleteMessage)
+	r.Get("/scheduled", h.listScheduled)
+	r.Delete("/scheduled/{id}", h.cancelScheduled)
 	return r
 }
 
+// idempotencyKeyHeader は冪等キーを渡すヘッダ。本文の idempotencyKey でも指定できる。
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type sendRequest struct {
 	Destination string `json:"destination,omitempty"`
 	UserID      string `json:"userId"`
-	Text        string `json:"text"`
+	// UserIDs は line-multicast の宛先。
+	UserIDs []string `json:"userIds,omitempty"`
+	// Narrowcast は line-narrowcast の宛先（recipient）・絞り込み条件（filter）・上限数（limit）。
+	Narrowcast     json.RawMessage `json:"narrowcast,omitempty"`
+	Text           string          `json:"text"`
+	IdempotencyKey string          `json:"idempotencyKey,omitempty"`
+	// Messages はLINE宛の型付きメッセージ。text の代わりに指定する。
+	Messages []json.RawMessage `json:"messages,omitempty"`
+	// Discord はDiscord宛の埋め込み・添付ファイル・スレッド指定。text の代わりに指定する。
+	Discord json.RawMessage `json:"discord,omitempty"`
+	// SendAt（RFC 3339）か Delay（"90s"・"1h30m" など）を指定すると予約して送る。
+	SendAt *time.Time `json:"sendAt,omitempty"`
+	Delay  string     `json:"delay,omitempty"`
+	// TemplateID はテナントのテンプレート。text・messages・discord の代わりに指定し、
+	// locale（省略時はテンプレートの既定）と params で展開する。
+	TemplateID string         `json:"templateId,omitempty"`
+	Locale     string         `json:"locale,omitempty"`
+	Params     map[string]any `json:"params,omitempty"`
+}
+
+type editRequest struct {
+	Text    string          `json:"text"`
+	Discord json.RawMessage `json:"discord,omitempty"`
+}
+
+type sendResponse struct {
+	Status    string `json:"status"`
+	MessageID string `json:"messageId"`
+	// SendAt は予約した場合の送る時刻。
+	SendAt *time.Time `json:"sendAt,omitempty"`
 }
 
 func (h *SendHandler) sendMessage(w http.ResponseWriter, r *http.Request) {
-	tenantID := TenantFromContext(r.Context())
-	if tenantID == "" {
-		http.Error(w, "tenant is required", http.StatusBadRequest)
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
 		return
 	}
+	defer cancel()
 
 	var req sendRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	// params の数値を 1e+06 のような表記にせず、送られたとおりに展開する。
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key := r.Header.Get(idempotencyKeyHeader)
+	if req.IdempotencyKey != "" {
+		if key != "" && key != req.IdempotencyKey {
+			http.Error(w, "Idempotency-Key header and idempotencyKey differ", http.StatusBadRequest)
+			return
+		}
+		key = req.IdempotencyKey
+	}
+	var delay time.Duration
+	if req.Delay != "" {
+		var err error
+		if delay, err = time.ParseDuration(req.Delay); err != nil {
+			http.Error(w, "invalid delay", http.StatusBadRequest)
+			return
+		}
+	}
+	var sendAt time.Time
+	if req.SendAt != nil {
+		sendAt = *req.SendAt
+	}
+
+	res, err := deps.Service.Send(ctx, ingress.SendInput{
+		Destination:    req.Destination,
+		UserID:         req.UserID,
+		UserIDs:        req.UserIDs,
+		Narrowcast:     req.Narrowcast,
+		Text:           req.Text,
+		Messages:       req.Messages,
+		Discord:        req.Discord,
+		IdempotencyKey: key,
+		SendAt:         sendAt,
+		Delay:          delay,
+		TemplateID:     req.TemplateID,
+		Locale:         req.Locale,
+		Params:         req.Params,
+	})
+	if err != nil {
+		writeSendError(w, err)
+		return
+	}
+
+	// 同じ冪等キーの再送には最初の要求と同じIDを返し、再送であることをヘッダで示す。
+	if res.Duplicate {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	if !res.SendAt.IsZero() {
+		writeJSON(w, http.StatusAccepted, sendResponse{Status: "scheduled", MessageID: res.MessageID, SendAt: &res.SendAt})
+		return
+	}
+	writeAccepted(w, res.MessageID)
+}
+
+// editMessage は送信済みのDiscord投稿の本文・埋め込みを置き換える要求を受け付ける。
+// 編集自体も1件の送信要求として扱い、その messageId で配送状態を参照できる。
+func (h *SendHandler) editMessage(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	id := chi.URLParam(r, "id")
+	if !message.ValidID(id) {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	var req editRequest
 	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	res, err := deps.Service.Edit(ctx, ingress.EditInput{TargetID: id, Text: req.Text, Discord: req.Discord})
+	if err != nil {
+		writeSendError(w, err)
+		return
+	}
+	writeAccepted(w, res.MessageID)
+}
+
+// deleteMessage は送信済みのDiscord投稿を削除する要求を受け付ける。
+func (h *SendHandler) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
 
+	id := chi.URLParam(r, "id")
+	if !message.ValidID(id) {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	res, err := deps.Service.Delete(ctx, id)
+	if err != nil {
+		writeSendError(w, err)
+		return
+	}
+	writeAccepted(w, res.MessageID)
+}
+
+// begin はテナントの解決・タイムアウトの設定・認可を行う。失敗時はレスポンスを書いてfalseを返す。
+func (h *SendHandler) begin(w http.ResponseWriter, r *http.Request) (IngressTenantDeps, context.Context, context.CancelFunc, bool) {
+	tenantID := TenantFromContext(r.Context())
+	if tenantID == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return IngressTenantDeps{}, nil, nil, false
+	}
 	deps, err := h.resolver.ResolveIngress(tenantID)
 	if err != nil {
 		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return IngressTenantDeps{}, nil, nil, false
+	}
+	ctx, cancel := h.requestContext(r.Context(), deps.Timeout)
+	if deps.Auth != nil && !h.authorize(ctx, w, r, deps.Auth) {
+		cancel()
+		return IngressTenantDeps{}, nil, nil, false
+	}
+	return deps, ctx, cancel, true
+}
+
+// writeSendError は送信・編集・削除の失敗をステータスコードに対応付ける。
+func writeSendError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, message.ErrEmptyDestination),
+		errors.Is(err, message.ErrEmptyUserID),
+		errors.Is(err, message.ErrEmptyText),
+		errors.Is(err, message.ErrTextWithMessages),
+		errors.Is(err, message.ErrMessagesNotSupported),
+		errors.Is(err, message.ErrTextWithDiscord),
+		errors.Is(err, message.ErrDiscordNotSupported),
+		errors.Is(err, message.ErrEditNotSupported),
+		errors.Is(err, message.ErrEmptyRecipients),
+		errors.Is(err, message.ErrTooManyRecipients),
+		errors.Is(err, message.ErrRecipientsNotSupported),
+		errors.Is(err, message.ErrNarrowcastNotSupported),
+		errors.Is(err, message.ErrInvalidIdempotencyKey),
+		errors.Is(err, message.ErrSendAtWithDelay),
+		errors.Is(err, message.ErrNegativeDelay),
+		errors.Is(err, schedule.ErrTooFar),
+		errors.Is(err, message.ErrTemplateWithBody),
+		errors.Is(err, message.ErrParamsWithoutTemplate),
+		errors.Is(err, msgtemplate.ErrNotFound),
+		errors.Is(err, msgtemplate.ErrNoBody),
+		errors.Is(err, msgtemplate.ErrRender),
+		errors.Is(err, linemsg.ErrInvalidMessage),
+		errors.Is(err, linemsg.ErrInvalidNarrowcast),
+		errors.Is(err, discordmsg.ErrInvalidPayload):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, status.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		log.Printf("send request failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func writeAccepted(w http.ResponseWriter, messageID string) {
+	writeJSON(w, http.StatusAccepted, sendResponse{Status: "accepted", MessageID: messageID})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// getStatus はメッセージIDの配送状態と遷移の履歴を返す。認可は /send と同じ。
+func (h *SendHandler) getStatus(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
 		return
 	}
+	defer cancel()
 
-	ctx, cancel := h.requestContext(r.Context(), deps.Timeout)
+	id := chi.URLParam(r, "id")
+	if !message.ValidID(id) {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	if deps.Status == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	st, err := deps.Status.Get(ctx, id)
+	switch {
+	case errors.Is(err, status.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("status lookup failed tenant=%s id=%s: %v", TenantFromContext(r.Context()), id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// getProgress は line-narrowcast で送ったメッセージについて、LINEの送信進捗を返す。
+// LINEがリクエストを受理する前（worker が送る前）は 404。
+func (h *SendHandler) getProgress(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
 	defer cancel()
 
-	if err := deps.Service.Send(ctx, req.Destination, req.UserID, req.Text); err != nil {
-		switch {
-		case errors.Is(err, message.ErrEmptyDestination),
-			errors.Is(err, message.ErrEmptyUserID),
-			errors.Is(err, message.ErrEmptyText):
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		default:
-			http.Error(w, "internal error", http.StatusInternalServerError)
-		}
+	id := chi.URLParam(r, "id")
+	if !message.ValidID(id) {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	if deps.Status == nil || deps.Progress == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	st, err := deps.Status.Get(ctx, id)
+	switch {
+	case errors.Is(err, status.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("status lookup failed tenant=%s id=%s: %v", TenantFromContext(r.Context()), id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if st.Destination != message.DestinationLineNarrowcast {
+		http.Error(w, "progress is only available for line-narrowcast", http.StatusBadRequest)
+		return
+	}
+	if st.Remote == nil {
+		http.Error(w, "narrowcast has not been accepted by LINE yet", http.StatusNotFound)
+		return
+	}
+	progress, err := deps.Progress.NarrowcastProgress(ctx, st.Remote.MessageID)
+	if err != nil {
+		log.Printf("narrowcast progress failed tenant=%s id=%s request_id=%s: %v", TenantFromContext(r.Context()), id, st.Remote.MessageID, err)
+		http.Error(w, "progress unavailable", http.StatusBadGateway)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+	_ = json.NewEncoder(w).Encode(progressResponse{MessageID: id, RequestID: st.Remote.MessageID, NarrowcastProgress: progress})
+}
+
+type progressResponse struct {
+	MessageID string `json:"messageId"`
+	// RequestID はLINEが振ったナローキャストのリクエストID。
+	RequestID string `json:"requestId"`
+	line.NarrowcastProgress
+}
+
+type scheduledResponse struct {
+	MessageID   string    `json:"messageId"`
+	Destination string    `json:"destination"`
+	SendAt      time.Time `json:"sendAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Releasing は worker が送り出し始めていて、もう取り消せないことを表す。
+	Releasing bool `json:"releasing"`
+}
+
+// listScheduled は送る前の予約を送る時刻の早い順に返す。本文は返さない。
+func (h *SendHandler) listScheduled(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	if deps.Schedule == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	entries, err := deps.Schedule.List(ctx)
+	if err != nil {
+		log.Printf("schedule list failed tenant=%s: %v", TenantFromContext(r.Context()), err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	out := make([]scheduledResponse, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, scheduledResponse{
+			MessageID:   e.MessageID,
+			Destination: e.Destination,
+			SendAt:      e.SendAt,
+			CreatedAt:   e.CreatedAt,
+			Releasing:   e.ReleasingAt != nil,
+		})
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Scheduled []scheduledResponse `json:"scheduled"`
+	}{Scheduled: out})
+}
+
+// cancelScheduled は送る前の予約を取り消す。worker が送り出し始めていたら 409。
+func (h *SendHandler) cancelScheduled(w http.ResponseWriter, r *http.Request) {
+	deps, ctx, cancel, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	id := chi.URLParam(r, "id")
+	if !message.ValidID(id) {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	if deps.Schedule == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	err := deps.Schedule.Cancel(ctx, id)
+	switch {
+	case errors.Is(err, schedule.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, schedule.ErrReleased):
+		http.Error(w, "already being sent", http.StatusConflict)
+	case err != nil:
+		log.Printf("schedule cancel failed tenant=%s id=%s: %v", TenantFromContext(r.Context()), id, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, sendResponse{Status: "canceled", MessageID: id})
+	}
+}
+
+// authorize はBearerのサービストークンを検証し、失敗時はレスポンスを書いてfalseを返す。
+func (h *SendHandler) authorize(ctx context.Context, w http.ResponseWriter, r *http.Request, verifier ServiceTokenVerifier) bool {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="message"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	_, err := verifier.Verify(ctx, strings.TrimSpace(header[7:]))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, serviceauth.ErrInsufficientScope):
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="message:send"`)
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, serviceauth.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	default:
+		log.Printf("service token verification failed: %v", err)
+		http.Error(w, "token verification unavailable", http.StatusServiceUnavailable)
+	}
+	return false
 }
 
 func (h *SendHandler) requestContext(parent context.Context, override time.Duration) (context.Context, context.CancelFunc) {
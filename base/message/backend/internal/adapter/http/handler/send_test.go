@@ -5,12 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
+	"github.com/sngm3741/roots/base/message/internal/infra/serviceauth"
+	"github.com/sngm3741/roots/base/message/internal/usecase/ingress"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
 // SendHandlerのHTTPマッピングをテーブル駆動で検証する。
@@ -18,13 +27,23 @@ func TestSendHandler(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name       string
-		body       any
-		sendErr    error
-		tenantID   string
-		wantStatus int
+		name         string
+		body         any
+		sendErr      error
+		tenantID     string
+		wantStatus   int
+		wantMessages int
 	}{
 		{name: "正常", body: map[string]string{"destination": "line", "userId": "u1", "text": "hi"}, tenantID: "t1", wantStatus: http.StatusAccepted},
+		{name: "型付きメッセージを渡す", body: `{"destination":"line","userId":"u1","messages":[{"type":"text","text":"a"},{"type":"sticker","packageId":"1","stickerId":"2"}]}`, tenantID: "t1", wantStatus: http.StatusAccepted, wantMessages: 2},
+		{name: "型付きメッセージ不正で400", body: `{"destination":"line","userId":"u1","messages":[{"type":"video"}]}`, tenantID: "t1", sendErr: fmt.Errorf("%w: messages[0]: unsupported type", linemsg.ErrInvalidMessage), wantStatus: http.StatusBadRequest, wantMessages: 1},
+		{name: "本文と型付きメッセージの両方で400", body: map[string]any{"destination": "line", "userId": "u1", "text": "hi", "messages": []any{}}, tenantID: "t1", sendErr: message.ErrTextWithMessages, wantStatus: http.StatusBadRequest},
+		{name: "Discordの投稿内容不正で400", body: `{"destination":"discord","userId":"u1","discord":{"tts":true}}`, tenantID: "t1", sendErr: fmt.Errorf("%w: unknown field", discordmsg.ErrInvalidPayload), wantStatus: http.StatusBadRequest},
+		{name: "本文とDiscordの投稿内容の両方で400", body: `{"destination":"discord","userId":"u1","text":"hi","discord":{"content":"hi"}}`, tenantID: "t1", sendErr: message.ErrTextWithDiscord, wantStatus: http.StatusBadRequest},
+		{name: "絞り込み条件不正で400", body: `{"destination":"line-narrowcast","narrowcast":{"filter":{}},"text":"hi"}`, tenantID: "t1", sendErr: fmt.Errorf("%w: filter.demographic is required", linemsg.ErrInvalidNarrowcast), wantStatus: http.StatusBadRequest},
+		{name: "未定義のテンプレートで400", body: `{"destination":"line","userId":"u1","templateId":"missing"}`, tenantID: "t1", sendErr: fmt.Errorf("%w: missing", msgtemplate.ErrNotFound), wantStatus: http.StatusBadRequest},
+		{name: "テンプレートのparams不足で400", body: `{"destination":"line","userId":"u1","templateId":"welcome","params":{}}`, tenantID: "t1", sendErr: fmt.Errorf("%w: map has no entry for key \"name\"", msgtemplate.ErrRender), wantStatus: http.StatusBadRequest},
+		{name: "マルチキャストの宛先超過で400", body: `{"destination":"line-multicast","userIds":["U1"],"text":"hi"}`, tenantID: "t1", sendErr: message.ErrTooManyRecipients, wantStatus: http.StatusBadRequest},
 		{name: "tenantなしで400", body: map[string]string{}, tenantID: "", wantStatus: http.StatusBadRequest},
 		{name: "バリデーションエラーで400", body: map[string]string{"destination": "", "userId": "u1", "text": "hi"}, tenantID: "t1", sendErr: message.ErrEmptyDestination, wantStatus: http.StatusBadRequest},
 		{name: "内部エラーで500", body: map[string]string{"destination": "line", "userId": "u1", "text": "hi"}, tenantID: "t1", sendErr: errors.New("boom"), wantStatus: http.StatusInternalServerError},
@@ -60,6 +79,112 @@ func TestSendHandler(t *testing.T) {
 
 			h.sendMessage(rr, req)
 
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if len(mockSvc.got.Messages) != tt.wantMessages {
+				t.Fatalf("messages=%d want=%d", len(mockSvc.got.Messages), tt.wantMessages)
+			}
+		})
+	}
+}
+
+// 冪等キーをヘッダ・本文のどちらからでも受け取り、再送には同じIDと再送ヘッダを返すことを確認する。
+func TestSendHandler_IdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		header       string
+		bodyKey      string
+		duplicate    bool
+		sendErr      error
+		wantStatus   int
+		wantKey      string
+		wantReplayed bool
+	}{
+		{name: "ヘッダで指定", header: "k1", wantStatus: http.StatusAccepted, wantKey: "k1"},
+		{name: "本文で指定", bodyKey: "k2", wantStatus: http.StatusAccepted, wantKey: "k2"},
+		{name: "両方同じ値", header: "k3", bodyKey: "k3", wantStatus: http.StatusAccepted, wantKey: "k3"},
+		{name: "両方で値が違えば400", header: "k4", bodyKey: "k5", wantStatus: http.StatusBadRequest},
+		{name: "再送は再送ヘッダ付き", header: "k6", duplicate: true, wantStatus: http.StatusAccepted, wantKey: "k6", wantReplayed: true},
+		{name: "不正なキーは400", header: "k7", sendErr: message.ErrInvalidIdempotencyKey, wantStatus: http.StatusBadRequest, wantKey: "k7"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &mockSendService{duplicate: tt.duplicate, err: tt.sendErr}
+			h := NewSendHandler(&mockIngressResolver{deps: IngressTenantDeps{Service: svc, Timeout: 2 * time.Second}}, 5*time.Second)
+
+			body, _ := json.Marshal(map[string]string{"destination": "line", "userId": "u1", "text": "hi", "idempotencyKey": tt.bodyKey})
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			if tt.header != "" {
+				req.Header.Set("Idempotency-Key", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.sendMessage(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if svc.got.IdempotencyKey != tt.wantKey {
+				t.Fatalf("key=%q want=%q", svc.got.IdempotencyKey, tt.wantKey)
+			}
+			if (rr.Header().Get("Idempotent-Replayed") == "true") != tt.wantReplayed {
+				t.Fatalf("replayed header=%q", rr.Header().Get("Idempotent-Replayed"))
+			}
+			if tt.wantStatus == http.StatusAccepted {
+				var res sendResponse
+				if err := json.NewDecoder(rr.Body).Decode(&res); err != nil || res.MessageID != "msg-1" {
+					t.Fatalf("response=%+v err=%v", res, err)
+				}
+			}
+		})
+	}
+}
+
+// サービストークン検証が有効なテナントの認可マッピングを検証する。
+func TestSendHandler_ServiceAuth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		header     string
+		verifyErr  error
+		wantStatus int
+	}{
+		{name: "正常", header: "Bearer tok", wantStatus: http.StatusAccepted},
+		{name: "ヘッダなしで401", wantStatus: http.StatusUnauthorized},
+		{name: "不正トークンで401", header: "Bearer tok", verifyErr: serviceauth.ErrInvalidToken, wantStatus: http.StatusUnauthorized},
+		{name: "スコープ不足で403", header: "Bearer tok", verifyErr: serviceauth.ErrInsufficientScope, wantStatus: http.StatusForbidden},
+		{name: "JWKS取得失敗で503", header: "Bearer tok", verifyErr: errors.New("jwks down"), wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resolver := &mockIngressResolver{
+				deps: IngressTenantDeps{
+					Service: &mockSendService{},
+					Timeout: 2 * time.Second,
+					Auth:    &mockVerifier{err: tt.verifyErr},
+				},
+			}
+			h := NewSendHandler(resolver, 5*time.Second)
+
+			body := `{"destination":"line","userId":"u1","text":"hi"}`
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			h.sendMessage(rr, req)
+
 			if rr.Code != tt.wantStatus {
 				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
 			}
@@ -67,6 +192,17 @@ func TestSendHandler(t *testing.T) {
 	}
 }
 
+type mockVerifier struct {
+	err error
+}
+
+func (m *mockVerifier) Verify(ctx context.Context, token string) (*serviceauth.Claims, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &serviceauth.Claims{ClientID: "lilink-backend", Scopes: []string{"message:send"}}, nil
+}
+
 type mockIngressResolver struct {
 	deps IngressTenantDeps
 	err  error
@@ -76,10 +212,351 @@ func (m *mockIngressResolver) ResolveIngress(string) (IngressTenantDeps, error)
 	return m.deps, m.err
 }
 
+type mockStatusReader struct {
+	st  message.Status
+	err error
+}
+
+func (m *mockStatusReader) Get(context.Context, string) (message.Status, error) {
+	return m.st, m.err
+}
+
 type mockSendService struct {
+	err       error
+	duplicate bool
+	sendAt    time.Time
+	got       ingress.SendInput
+	gotEdit   ingress.EditInput
+	gotDelete string
+}
+
+func (m *mockSendService) Send(ctx context.Context, in ingress.SendInput) (ingress.SendResult, error) {
+	m.got = in
+	if m.err != nil {
+		return ingress.SendResult{}, m.err
+	}
+	return ingress.SendResult{MessageID: "msg-1", Duplicate: m.duplicate, SendAt: m.sendAt}, nil
+}
+
+func (m *mockSendService) Edit(ctx context.Context, in ingress.EditInput) (ingress.SendResult, error) {
+	m.gotEdit = in
+	if m.err != nil {
+		return ingress.SendResult{}, m.err
+	}
+	return ingress.SendResult{MessageID: "msg-2"}, nil
+}
+
+func (m *mockSendService) Delete(ctx context.Context, targetID string) (ingress.SendResult, error) {
+	m.gotDelete = targetID
+	if m.err != nil {
+		return ingress.SendResult{}, m.err
+	}
+	return ingress.SendResult{MessageID: "msg-3"}, nil
+}
+
+// GET /messages/{id} の応答を確認する。
+func TestSendHandler_GetStatus(t *testing.T) {
+	t.Parallel()
+
+	const id = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	delivered := message.Status{MessageID: id, Destination: "line", State: message.StateDelivered, Attempts: 1, CreatedAt: at, UpdatedAt: at}
+	tests := []struct {
+		name       string
+		id         string
+		reader     StatusReader
+		wantStatus int
+		wantState  message.State
+	}{
+		{name: "記録あり", id: id, reader: &mockStatusReader{st: delivered}, wantStatus: http.StatusOK, wantState: message.StateDelivered},
+		{name: "記録なし", id: id, reader: &mockStatusReader{err: status.ErrNotFound}, wantStatus: http.StatusNotFound},
+		{name: "記録先なし", id: id, wantStatus: http.StatusNotFound},
+		{name: "ID形式不正", id: "not-a-uuid", reader: &mockStatusReader{st: delivered}, wantStatus: http.StatusBadRequest},
+		{name: "保存先エラー", id: id, reader: &mockStatusReader{err: errors.New("kv down")}, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			deps := IngressTenantDeps{Service: &mockSendService{}, Timeout: 2 * time.Second, Status: tt.reader}
+			h := NewSendHandler(&mockIngressResolver{deps: deps}, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodGet, "/messages/"+tt.id, nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			rr := httptest.NewRecorder()
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got message.Status
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || got.State != tt.wantState || got.MessageID != id {
+				t.Fatalf("body=%+v err=%v", got, err)
+			}
+		})
+	}
+}
+
+// PATCH・DELETE /messages/{id} の応答を確認する。
+func TestSendHandler_EditDelete(t *testing.T) {
+	t.Parallel()
+
+	const id = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	tests := []struct {
+		name       string
+		method     string
+		id         string
+		body       string
+		err        error
+		wantStatus int
+		wantID     string
+	}{
+		{name: "編集", method: http.MethodPatch, id: id, body: `{"discord":{"content":"復旧しました","embeds":[{"title":"DB","color":65280}]}}`, wantStatus: http.StatusAccepted, wantID: "msg-2"},
+		{name: "削除", method: http.MethodDelete, id: id, wantStatus: http.StatusAccepted, wantID: "msg-3"},
+		{name: "対象なしで404", method: http.MethodPatch, id: id, body: `{"text":"x"}`, err: status.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "LINE宛は400", method: http.MethodDelete, id: id, err: message.ErrEditNotSupported, wantStatus: http.StatusBadRequest},
+		{name: "編集できない項目で400", method: http.MethodPatch, id: id, body: `{"discord":{"threadId":"1"}}`, err: fmt.Errorf("%w: only content and embeds can be edited", discordmsg.ErrInvalidPayload), wantStatus: http.StatusBadRequest},
+		{name: "ID形式不正", method: http.MethodDelete, id: "not-a-uuid", wantStatus: http.StatusBadRequest},
+		{name: "ボディ不正で400", method: http.MethodPatch, id: id, body: "{", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &mockSendService{err: tt.err}
+			h := NewSendHandler(&mockIngressResolver{deps: IngressTenantDeps{Service: svc, Timeout: 2 * time.Second}}, 5*time.Second)
+
+			req := httptest.NewRequest(tt.method, "/messages/"+tt.id, bytes.NewBufferString(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			rr := httptest.NewRecorder()
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				return
+			}
+			var res sendResponse
+			if err := json.NewDecoder(rr.Body).Decode(&res); err != nil || res.MessageID != tt.wantID {
+				t.Fatalf("response=%+v err=%v", res, err)
+			}
+			if svc.gotEdit.TargetID != id && svc.gotDelete != id {
+				t.Fatalf("target not passed: edit=%+v delete=%q", svc.gotEdit, svc.gotDelete)
+			}
+		})
+	}
+}
+
+type mockProgressReader struct {
+	got string
 	err error
 }
 
-func (m *mockSendService) Send(ctx context.Context, destination, userID, text string) error {
+func (m *mockProgressReader) NarrowcastProgress(_ context.Context, requestID string) (line.NarrowcastProgress, error) {
+	m.got = requestID
+	if m.err != nil {
+		return line.NarrowcastProgress{}, m.err
+	}
+	n := int64(3)
+	return line.NarrowcastProgress{Phase: "succeeded", SuccessCount: &n, TargetCount: &n}, nil
+}
+
+// GET /messages/{id}/progress の応答を確認する。
+func TestSendHandler_GetProgress(t *testing.T) {
+	t.Parallel()
+
+	const id = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	accepted := message.Status{MessageID: id, Destination: message.DestinationLineNarrowcast, State: message.StateDelivered, Remote: &message.RemoteRef{MessageID: "req-1"}}
+	tests := []struct {
+		name       string
+		reader     StatusReader
+		progress   *mockProgressReader
+		wantStatus int
+	}{
+		{name: "進捗あり", reader: &mockStatusReader{st: accepted}, progress: &mockProgressReader{}, wantStatus: http.StatusOK},
+		{name: "LINE受理前は404", reader: &mockStatusReader{st: message.Status{MessageID: id, Destination: message.DestinationLineNarrowcast, State: message.StateQueued}}, progress: &mockProgressReader{}, wantStatus: http.StatusNotFound},
+		{name: "ナローキャスト以外は400", reader: &mockStatusReader{st: message.Status{MessageID: id, Destination: "line", State: message.StateDelivered}}, progress: &mockProgressReader{}, wantStatus: http.StatusBadRequest},
+		{name: "記録なし", reader: &mockStatusReader{err: status.ErrNotFound}, progress: &mockProgressReader{}, wantStatus: http.StatusNotFound},
+		{name: "照会先なし", reader: &mockStatusReader{st: accepted}, wantStatus: http.StatusNotFound},
+		{name: "LINEのエラーで502", reader: &mockStatusReader{st: accepted}, progress: &mockProgressReader{err: errors.New("line down")}, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			deps := IngressTenantDeps{Service: &mockSendService{}, Timeout: 2 * time.Second, Status: tt.reader}
+			if tt.progress != nil {
+				deps.Progress = tt.progress
+			}
+			h := NewSendHandler(&mockIngressResolver{deps: deps}, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodGet, "/messages/"+id+"/progress", nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			rr := httptest.NewRecorder()
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got progressResponse
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || got.RequestID != "req-1" || got.Phase != "succeeded" || *got.SuccessCount != 3 {
+				t.Fatalf("body=%+v err=%v", got, err)
+			}
+			if tt.progress.got != "req-1" {
+				t.Fatalf("requestId=%q", tt.progress.got)
+			}
+		})
+	}
+}
+
+// sendAt・delay を送信サービスへ渡し、予約した場合は送る時刻を返すことを確認する。
+func TestSendHandler_Schedule(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		extra      string
+		sendErr    error
+		wantStatus int
+		wantSendAt time.Time
+		wantDelay  time.Duration
+	}{
+		{name: "時刻で予約", extra: `,"sendAt":"2025-01-01T18:00:00+09:00"`, wantStatus: http.StatusAccepted, wantSendAt: at},
+		{name: "遅延で予約", extra: `,"delay":"1h30m"`, wantStatus: http.StatusAccepted, wantDelay: 90 * time.Minute},
+		{name: "遅延の形式不正で400", extra: `,"delay":"soon"`, wantStatus: http.StatusBadRequest},
+		{name: "両方指定で400", extra: `,"sendAt":"2025-01-01T09:00:00Z","delay":"1m"`, sendErr: message.ErrSendAtWithDelay, wantStatus: http.StatusBadRequest, wantSendAt: at, wantDelay: time.Minute},
+		{name: "期間超過で400", extra: `,"delay":"720h"`, sendErr: fmt.Errorf("%w: at most 168h0m0s ahead", schedule.ErrTooFar), wantStatus: http.StatusBadRequest, wantDelay: 720 * time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &mockSendService{err: tt.sendErr, sendAt: at}
+			h := NewSendHandler(&mockIngressResolver{deps: IngressTenantDeps{Service: svc, Timeout: 2 * time.Second}}, 5*time.Second)
+
+			body := `{"destination":"line","userId":"u1","text":"hi"` + tt.extra + `}`
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			rr := httptest.NewRecorder()
+			h.sendMessage(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !svc.got.SendAt.Equal(tt.wantSendAt) || svc.got.Delay != tt.wantDelay {
+				t.Fatalf("sendAt=%v delay=%v", svc.got.SendAt, svc.got.Delay)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				return
+			}
+			var res sendResponse
+			if err := json.NewDecoder(rr.Body).Decode(&res); err != nil || res.Status != "scheduled" || res.SendAt == nil || !res.SendAt.Equal(at) {
+				t.Fatalf("response=%+v err=%v", res, err)
+			}
+		})
+	}
+}
+
+type mockScheduleManager struct {
+	entries   []message.Scheduled
+	err       error
+	gotCancel string
+}
+
+func (m *mockScheduleManager) List(context.Context) ([]message.Scheduled, error) {
+	return m.entries, m.err
+}
+
+func (m *mockScheduleManager) Cancel(_ context.Context, id string) error {
+	m.gotCancel = id
 	return m.err
 }
+
+// GET /scheduled・DELETE /scheduled/{id} の応答を確認する。
+func TestSendHandler_Scheduled(t *testing.T) {
+	t.Parallel()
+
+	const id = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := message.Scheduled{MessageID: id, Destination: "line", Subject: "line.events", SendAt: at, CreatedAt: at, Body: json.RawMessage(`{}`)}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		manager    *mockScheduleManager
+		wantStatus int
+	}{
+		{name: "一覧", method: http.MethodGet, path: "/scheduled", manager: &mockScheduleManager{entries: []message.Scheduled{entry}}, wantStatus: http.StatusOK},
+		{name: "一覧の保存先エラー", method: http.MethodGet, path: "/scheduled", manager: &mockScheduleManager{err: errors.New("kv down")}, wantStatus: http.StatusInternalServerError},
+		{name: "予約先なし", method: http.MethodGet, path: "/scheduled", wantStatus: http.StatusNotFound},
+		{name: "取り消し", method: http.MethodDelete, path: "/scheduled/" + id, manager: &mockScheduleManager{}, wantStatus: http.StatusOK},
+		{name: "予約なしで404", method: http.MethodDelete, path: "/scheduled/" + id, manager: &mockScheduleManager{err: schedule.ErrNotFound}, wantStatus: http.StatusNotFound},
+		{name: "送り出し中で409", method: http.MethodDelete, path: "/scheduled/" + id, manager: &mockScheduleManager{err: schedule.ErrReleased}, wantStatus: http.StatusConflict},
+		{name: "ID形式不正", method: http.MethodDelete, path: "/scheduled/not-a-uuid", manager: &mockScheduleManager{}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			deps := IngressTenantDeps{Service: &mockSendService{}, Timeout: 2 * time.Second}
+			if tt.manager != nil {
+				deps.Schedule = tt.manager
+			}
+			h := NewSendHandler(&mockIngressResolver{deps: deps}, 5*time.Second)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+			rr := httptest.NewRecorder()
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d body=%s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if tt.method == http.MethodDelete {
+				if tt.manager.gotCancel != id {
+					t.Fatalf("canceled=%q", tt.manager.gotCancel)
+				}
+				return
+			}
+			// 一覧には本文とサブジェクトを含めない。
+			want := `{"scheduled":[{"messageId":"` + id + `","destination":"line","sendAt":"2025-01-01T00:00:00Z","createdAt":"2025-01-01T00:00:00Z","releasing":false}]}` + "\n"
+			if rr.Body.String() != want {
+				t.Fatalf("body=%s", rr.Body.String())
+			}
+		})
+	}
+}
+
+// templateId・locale・params を送信サービスへ渡し、params の数値は送られた表記のまま渡すことを確認する。
+func TestSendHandler_Template(t *testing.T) {
+	t.Parallel()
+	svc := &mockSendService{}
+	h := NewSendHandler(&mockIngressResolver{deps: IngressTenantDeps{Service: svc, Timeout: 2 * time.Second}}, 5*time.Second)
+
+	body := `{"destination":"line","userId":"u1","templateId":"points","locale":"ja-JP","params":{"name":"山田","points":1000000}}`
+	req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(body))
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "t1"))
+	rr := httptest.NewRecorder()
+	h.sendMessage(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if svc.got.TemplateID != "points" || svc.got.Locale != "ja-JP" || svc.got.Params["name"] != "山田" {
+		t.Fatalf("input=%+v", svc.got)
+	}
+	if got := fmt.Sprint(svc.got.Params["points"]); got != "1000000" {
+		t.Fatalf("points=%s", got)
+	}
+}
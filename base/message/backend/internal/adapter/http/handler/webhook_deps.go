@@ -6,6 +6,8 @@ import "github.com/sngm3741/roots/base/message/internal/infra/nats"
 type LineWebhookDeps struct {
 	Producer nats.Producer
 	Subject  string
+	// ChannelSecret は X-Line-Signature の検証鍵。
+	ChannelSecret string
 }
 
 // LineWebhookResolver はテナントIDからWebhook依存を解決する。
@@ -0,0 +1,235 @@
+package discordmsg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidPayload は送信内容がDiscordの仕様を満たさない場合に返す。理由は包んだエラーの文言に含める。
+var ErrInvalidPayload = errors.New("discordmsg: invalid payload")
+
+const (
+	// MaxEmbeds は1投稿あたりの埋め込みの上限。
+	MaxEmbeds = 10
+	// MaxAttachments は1投稿あたりの添付ファイルの上限。
+	MaxAttachments = 10
+	// MaxAttachmentBytes は添付ファイルの合計サイズの上限。NATSの既定の max_payload（1MB）に
+	// Base64 で収まる大きさにしている。
+	MaxAttachmentBytes = 512 << 10
+)
+
+// Discord Webhook の各フィールドの上限。
+const (
+	maxContentLength    = 2000
+	maxEmbedTitle       = 256
+	maxEmbedDescription = 4096
+	maxEmbedFields      = 25
+	maxFieldName        = 256
+	maxFieldValue       = 1024
+	maxFooterText       = 2048
+	maxEmbedTotal       = 6000
+	maxColor            = 0xFFFFFF
+	maxFilenameLength   = 255
+	maxThreadName       = 100
+)
+
+// Payload はDiscord Webhookへの投稿内容。Content・Embeds・Attachments の少なくとも1つが必要。
+type Payload struct {
+	Content     string       `json:"content,omitempty"`
+	Embeds      []Embed      `json:"embeds,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// ThreadID は既存のスレッドへ投稿する場合のスレッドID。
+	ThreadID string `json:"threadId,omitempty"`
+	// ThreadName はフォーラムチャンネルに新しい投稿（スレッド）を作る場合の名前。
+	ThreadName string `json:"threadName,omitempty"`
+}
+
+// Embed は埋め込み1つ。Color は 0xRRGGBB。
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Thumbnail   *EmbedImage  `json:"thumbnail,omitempty"`
+	Image       *EmbedImage  `json:"image,omitempty"`
+	Footer      *EmbedFooter `json:"footer,omitempty"`
+	Timestamp   *time.Time   `json:"timestamp,omitempty"`
+}
+
+// EmbedField は埋め込みの項目。
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// EmbedImage は埋め込みのサムネイル・画像。
+type EmbedImage struct {
+	URL string `json:"url"`
+}
+
+// EmbedFooter は埋め込みのフッター。
+type EmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// Attachment は添付ファイル。Data はJSONではBase64で表す。
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Data        []byte `json:"data"`
+}
+
+// Parse は送信APIの discord オブジェクトを読み込み、Discordの仕様に沿って検証する。
+// 未対応のフィールドは黙って落とさずエラーにする。
+func Parse(raw json.RawMessage) (Payload, error) {
+	p, err := decode(raw)
+	if err != nil {
+		return Payload{}, err
+	}
+	if err := p.Validate(); err != nil {
+		return Payload{}, err
+	}
+	return p, nil
+}
+
+// ParseEdit は投稿の編集内容を読み込む。編集できるのは本文と埋め込みだけで、
+// スレッドは元の投稿のものを使う。
+func ParseEdit(raw json.RawMessage) (Payload, error) {
+	p, err := decode(raw)
+	if err != nil {
+		return Payload{}, err
+	}
+	if err := p.ValidateEdit(); err != nil {
+		return Payload{}, err
+	}
+	return p, nil
+}
+
+func decode(raw json.RawMessage) (Payload, error) {
+	var p Payload
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Payload{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return p, nil
+}
+
+// Validate は新規投稿の内容を検証する。
+func (p Payload) Validate() error {
+	if strings.TrimSpace(p.Content) == "" && len(p.Embeds) == 0 && len(p.Attachments) == 0 {
+		return fmt.Errorf("%w: content, embeds or attachments is required", ErrInvalidPayload)
+	}
+	if p.ThreadID != "" && p.ThreadName != "" {
+		return fmt.Errorf("%w: threadId and threadName are mutually exclusive", ErrInvalidPayload)
+	}
+	if utf8.RuneCountInString(p.ThreadName) > maxThreadName {
+		return fmt.Errorf("%w: threadName must be at most %d characters", ErrInvalidPayload, maxThreadName)
+	}
+	if err := p.validateBody(); err != nil {
+		return err
+	}
+	if len(p.Attachments) > MaxAttachments {
+		return fmt.Errorf("%w: at most %d attachments", ErrInvalidPayload, MaxAttachments)
+	}
+	total := 0
+	for i, a := range p.Attachments {
+		if strings.TrimSpace(a.Filename) == "" || len(a.Filename) > maxFilenameLength || strings.ContainsAny(a.Filename, `/\`) {
+			return fmt.Errorf("%w: attachments[%d]: filename must be 1-%d bytes without path separators", ErrInvalidPayload, i, maxFilenameLength)
+		}
+		if len(a.Data) == 0 {
+			return fmt.Errorf("%w: attachments[%d]: data is empty", ErrInvalidPayload, i)
+		}
+		total += len(a.Data)
+	}
+	if total > MaxAttachmentBytes {
+		return fmt.Errorf("%w: attachments must total at most %d bytes", ErrInvalidPayload, MaxAttachmentBytes)
+	}
+	return nil
+}
+
+// ValidateEdit は編集内容を検証する。
+func (p Payload) ValidateEdit() error {
+	if len(p.Attachments) > 0 || p.ThreadID != "" || p.ThreadName != "" {
+		return fmt.Errorf("%w: only content and embeds can be edited", ErrInvalidPayload)
+	}
+	if strings.TrimSpace(p.Content) == "" && len(p.Embeds) == 0 {
+		return fmt.Errorf("%w: content or embeds is required", ErrInvalidPayload)
+	}
+	return p.validateBody()
+}
+
+// validateBody は本文と埋め込みを検証する。
+func (p Payload) validateBody() error {
+	if utf8.RuneCountInString(p.Content) > maxContentLength {
+		return fmt.Errorf("%w: content must be at most %d characters", ErrInvalidPayload, maxContentLength)
+	}
+	if len(p.Embeds) > MaxEmbeds {
+		return fmt.Errorf("%w: at most %d embeds", ErrInvalidPayload, MaxEmbeds)
+	}
+	total := 0
+	for i, e := range p.Embeds {
+		n, err := e.validate()
+		if err != nil {
+			return fmt.Errorf("%w: embeds[%d]: %v", ErrInvalidPayload, i, err)
+		}
+		total += n
+	}
+	if total > maxEmbedTotal {
+		return fmt.Errorf("%w: embeds must total at most %d characters", ErrInvalidPayload, maxEmbedTotal)
+	}
+	return nil
+}
+
+// validate は埋め込みを検証し、上限の合計に数える文字数を返す。
+func (e Embed) validate() (int, error) {
+	title := utf8.RuneCountInString(e.Title)
+	desc := utf8.RuneCountInString(e.Description)
+	switch {
+	case title > maxEmbedTitle:
+		return 0, fmt.Errorf("title must be at most %d characters", maxEmbedTitle)
+	case desc > maxEmbedDescription:
+		return 0, fmt.Errorf("description must be at most %d characters", maxEmbedDescription)
+	case e.Color < 0 || e.Color > maxColor:
+		return 0, errors.New("color must be between 0 and 0xFFFFFF")
+	case len(e.Fields) > maxEmbedFields:
+		return 0, fmt.Errorf("at most %d fields", maxEmbedFields)
+	case e.URL != "" && !isHTTP(e.URL):
+		return 0, errors.New("url must be http(s)")
+	case e.Thumbnail != nil && !isHTTP(e.Thumbnail.URL):
+		return 0, errors.New("thumbnail.url must be http(s)")
+	case e.Image != nil && !isHTTP(e.Image.URL):
+		return 0, errors.New("image.url must be http(s)")
+	}
+	total := title + desc
+	if e.Footer != nil {
+		n := utf8.RuneCountInString(e.Footer.Text)
+		if n == 0 || n > maxFooterText {
+			return 0, fmt.Errorf("footer.text must be 1-%d characters", maxFooterText)
+		}
+		total += n
+	}
+	for i, f := range e.Fields {
+		name := utf8.RuneCountInString(f.Name)
+		value := utf8.RuneCountInString(f.Value)
+		if strings.TrimSpace(f.Name) == "" || name > maxFieldName {
+			return 0, fmt.Errorf("fields[%d].name must be 1-%d characters", i, maxFieldName)
+		}
+		if strings.TrimSpace(f.Value) == "" || value > maxFieldValue {
+			return 0, fmt.Errorf("fields[%d].value must be 1-%d characters", i, maxFieldValue)
+		}
+		total += name + value
+	}
+	return total, nil
+}
+
+func isHTTP(u string) bool {
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://")
+}
@@ -0,0 +1,64 @@
+package discordmsg
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 投稿内容の検証のテーブル駆動テスト。
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	big := strings.Repeat("AAAA", MaxAttachmentBytes/3+2)
+	tests := []struct {
+		name     string
+		raw      string
+		edit     bool
+		wantErr  string
+		wantFile int
+	}{
+		{name: "本文のみ", raw: `{"content":"hi"}`},
+		{name: "埋め込み", raw: `{"embeds":[{"title":"障害","description":"DB接続断","color":16711680,"fields":[{"name":"影響","value":"全店舗","inline":true}],"thumbnail":{"url":"https://example.com/t.png"},"timestamp":"2025-01-01T00:00:00Z"}]}`},
+		{name: "添付ファイル", raw: `{"content":"log","attachments":[{"filename":"a.txt","contentType":"text/plain","data":"aGVsbG8="}]}`, wantFile: 1},
+		{name: "フォーラムに新規投稿", raw: `{"content":"hi","threadName":"障害報告"}`},
+		{name: "空", raw: `{}`, wantErr: "content, embeds or attachments is required"},
+		{name: "未知のフィールド", raw: `{"content":"hi","tts":true}`, wantErr: "unknown field"},
+		{name: "スレッド指定が両方", raw: `{"content":"hi","threadId":"1","threadName":"x"}`, wantErr: "mutually exclusive"},
+		{name: "本文が長すぎる", raw: `{"content":"` + strings.Repeat("a", 2001) + `"}`, wantErr: "content must be"},
+		{name: "色が範囲外", raw: `{"embeds":[{"title":"x","color":16777216}]}`, wantErr: "color"},
+		{name: "項目の値が空", raw: `{"embeds":[{"fields":[{"name":"a","value":""}]}]}`, wantErr: "fields[0].value"},
+		{name: "ファイル名にパス", raw: `{"attachments":[{"filename":"../a.txt","data":"aGVsbG8="}]}`, wantErr: "filename"},
+		{name: "添付が大きすぎる", raw: `{"attachments":[{"filename":"a.bin","data":"` + big + `"}]}`, wantErr: "total at most"},
+		{name: "編集は本文と埋め込み", raw: `{"content":"復旧しました"}`, edit: true},
+		{name: "編集で添付", raw: `{"content":"x","attachments":[{"filename":"a.txt","data":"aGVsbG8="}]}`, edit: true, wantErr: "only content and embeds"},
+		{name: "編集でスレッド指定", raw: `{"content":"x","threadId":"1"}`, edit: true, wantErr: "only content and embeds"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parse := Parse
+			if tt.edit {
+				parse = ParseEdit
+			}
+			p, err := parse(json.RawMessage(tt.raw))
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidPayload) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(p.Attachments) != tt.wantFile {
+				t.Fatalf("attachments=%d want=%d", len(p.Attachments), tt.wantFile)
+			}
+			if tt.wantFile > 0 && string(p.Attachments[0].Data) != "hello" {
+				t.Fatalf("data=%q", p.Attachments[0].Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package lineevent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Type はイベント種別。
+type Type string
+
+const (
+	TypeMessage      Type = "message"
+	TypeFollow       Type = "follow"
+	TypeUnfollow     Type = "unfollow"
+	TypeJoin         Type = "join"
+	TypeLeave        Type = "leave"
+	TypeMemberJoined Type = "memberJoined"
+	TypeMemberLeft   Type = "memberLeft"
+	TypePostback     Type = "postback"
+	TypeBeacon       Type = "beacon"
+)
+
+// Detail はイベント種別ごとの内容。メッセージ各種・Follow・Postback などのいずれか。
+type Detail interface {
+	EventType() Type
+}
+
+// MessageType はメッセージイベントの種別。
+type MessageType string
+
+const (
+	MessageText     MessageType = "text"
+	MessageImage    MessageType = "image"
+	MessageVideo    MessageType = "video"
+	MessageAudio    MessageType = "audio"
+	MessageFile     MessageType = "file"
+	MessageLocation MessageType = "location"
+	MessageSticker  MessageType = "sticker"
+)
+
+// Message はメッセージイベントの内容。
+type Message interface {
+	Detail
+	MessageID() string
+	MessageType() MessageType
+}
+
+// ContentProvider は画像・動画・音声の取得元。type が line ならコンテンツ取得APIで取り出す。
+type ContentProvider struct {
+	Type               string `json:"type"`
+	OriginalContentURL string `json:"originalContentUrl,omitempty"`
+	PreviewImageURL    string `json:"previewImageUrl,omitempty"`
+}
+
+// TextMessage はテキストメッセージ。
+type TextMessage struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// ImageMessage は画像メッセージ。
+type ImageMessage struct {
+	ID              string          `json:"id"`
+	ContentProvider ContentProvider `json:"contentProvider"`
+}
+
+// VideoMessage は動画メッセージ。Duration はミリ秒。
+type VideoMessage struct {
+	ID              string          `json:"id"`
+	Duration        int64           `json:"duration,omitempty"`
+	ContentProvider ContentProvider `json:"contentProvider"`
+}
+
+// AudioMessage は音声メッセージ。Duration はミリ秒。
+type AudioMessage struct {
+	ID              string          `json:"id"`
+	Duration        int64           `json:"duration,omitempty"`
+	ContentProvider ContentProvider `json:"contentProvider"`
+}
+
+// FileMessage はファイルメッセージ。
+type FileMessage struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	FileSize int64  `json:"fileSize"`
+}
+
+// LocationMessage は位置情報メッセージ。
+type LocationMessage struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// StickerMessage はスタンプメッセージ。
+type StickerMessage struct {
+	ID                  string   `json:"id"`
+	PackageID           string   `json:"packageId"`
+	StickerID           string   `json:"stickerId"`
+	StickerResourceType string   `json:"stickerResourceType,omitempty"`
+	Keywords            []string `json:"keywords,omitempty"`
+}
+
+// UnknownMessage は未対応の種別のメッセージ。種別とIDだけを保持する。
+type UnknownMessage struct {
+	ID   string      `json:"id"`
+	Type MessageType `json:"-"`
+}
+
+func (TextMessage) EventType() Type     { return TypeMessage }
+func (ImageMessage) EventType() Type    { return TypeMessage }
+func (VideoMessage) EventType() Type    { return TypeMessage }
+func (AudioMessage) EventType() Type    { return TypeMessage }
+func (FileMessage) EventType() Type     { return TypeMessage }
+func (LocationMessage) EventType() Type { return TypeMessage }
+func (StickerMessage) EventType() Type  { return TypeMessage }
+func (UnknownMessage) EventType() Type  { return TypeMessage }
+
+func (m TextMessage) MessageID() string     { return m.ID }
+func (m ImageMessage) MessageID() string    { return m.ID }
+func (m VideoMessage) MessageID() string    { return m.ID }
+func (m AudioMessage) MessageID() string    { return m.ID }
+func (m FileMessage) MessageID() string     { return m.ID }
+func (m LocationMessage) MessageID() string { return m.ID }
+func (m StickerMessage) MessageID() string  { return m.ID }
+func (m UnknownMessage) MessageID() string  { return m.ID }
+
+func (TextMessage) MessageType() MessageType     { return MessageText }
+func (ImageMessage) MessageType() MessageType    { return MessageImage }
+func (VideoMessage) MessageType() MessageType    { return MessageVideo }
+func (AudioMessage) MessageType() MessageType    { return MessageAudio }
+func (FileMessage) MessageType() MessageType     { return MessageFile }
+func (LocationMessage) MessageType() MessageType { return MessageLocation }
+func (StickerMessage) MessageType() MessageType  { return MessageSticker }
+func (m UnknownMessage) MessageType() MessageType {
+	return m.Type
+}
+
+// Follow は友だち追加（ブロック解除を含む）。
+type Follow struct {
+	IsUnblocked bool `json:"isUnblocked"`
+}
+
+// Unfollow はブロック。
+type Unfollow struct{}
+
+// Join はボットのグループ・トークルームへの参加。
+type Join struct{}
+
+// Leave はボットのグループからの退出。
+type Leave struct{}
+
+// MemberJoined はボットがいるグループへのメンバー参加。
+type MemberJoined struct {
+	Members []Source `json:"members"`
+}
+
+// MemberLeft はボットがいるグループからのメンバー退出。
+type MemberLeft struct {
+	Members []Source `json:"members"`
+}
+
+// Postback はボタン等から送られたポストバック。Params は日時選択アクションなどの付加情報。
+type Postback struct {
+	Data   string            `json:"data"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Beacon はビーコンの検知。
+type Beacon struct {
+	Hwid string `json:"hwid"`
+	Type string `json:"type"`
+	DM   string `json:"dm,omitempty"`
+}
+
+// Unknown は未対応の種別のイベント。種別名だけを保持し、破棄せずに中継する。
+type Unknown struct {
+	Type Type
+}
+
+func (Follow) EventType() Type       { return TypeFollow }
+func (Unfollow) EventType() Type     { return TypeUnfollow }
+func (Join) EventType() Type         { return TypeJoin }
+func (Leave) EventType() Type        { return TypeLeave }
+func (MemberJoined) EventType() Type { return TypeMemberJoined }
+func (MemberLeft) EventType() Type   { return TypeMemberLeft }
+func (Postback) EventType() Type     { return TypePostback }
+func (Beacon) EventType() Type       { return TypeBeacon }
+func (u Unknown) EventType() Type    { return u.Type }
+
+// detailField は publish するJSONで内容を入れるフィールド名を返す。LINEのWebhookと同じ名前にする。
+func detailField(d Detail) string {
+	switch d.(type) {
+	case Message:
+		return "message"
+	case Follow:
+		return "follow"
+	case MemberJoined:
+		return "joined"
+	case MemberLeft:
+		return "left"
+	case Postback:
+		return "postback"
+	case Beacon:
+		return "beacon"
+	default:
+		return ""
+	}
+}
+
+// marshalDetail は内容をJSONにする。メッセージには種別を type として含める。内容のない種別は nil を返す。
+func marshalDetail(d Detail) (json.RawMessage, error) {
+	if detailField(d) == "" {
+		return nil, nil
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("lineevent: encode %s: %w", d.EventType(), err)
+	}
+	m, ok := d.(Message)
+	if !ok {
+		return body, nil
+	}
+	typ, err := json.Marshal(m.MessageType())
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(`{"type":`), typ...)
+	if len(body) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, body[1:]...), nil
+}
@@ -10,31 +10,98 @@ import (
 var (
 	// ErrInvalidEvent は必須フィールド不足時に返す。
 	ErrInvalidEvent = errors.New("lineevent: invalid event")
+	// ErrInvalidSource は送信元の種別とIDが揃っていない場合に返す。
+	ErrInvalidSource = errors.New("lineevent: invalid source")
 )
 
-// Event はLINE Webhookから受け取るイベントの標準化フォーマット。
+// SourceType はイベントの送信元の種別。
+type SourceType string
+
+const (
+	SourceUser  SourceType = "user"
+	SourceGroup SourceType = "group"
+	SourceRoom  SourceType = "room"
+)
+
+// Source はイベントの送信元。グループ・トークルームでは UserID が空のこともある。
+type Source struct {
+	Type    SourceType `json:"type"`
+	UserID  string     `json:"userId,omitempty"`
+	GroupID string     `json:"groupId,omitempty"`
+	RoomID  string     `json:"roomId,omitempty"`
+}
+
+func (s Source) validate() error {
+	switch s.Type {
+	case SourceUser:
+		if s.UserID == "" {
+			return ErrInvalidSource
+		}
+	case SourceGroup:
+		if s.GroupID == "" {
+			return ErrInvalidSource
+		}
+	case SourceRoom:
+		if s.RoomID == "" {
+			return ErrInvalidSource
+		}
+	default:
+		return ErrInvalidSource
+	}
+	return nil
+}
+
+// Params はイベント生成の入力。
+type Params struct {
+	Destination    string
+	WebhookEventID string
+	ReplyToken     string
+	Mode           string
+	Source         Source
+	Timestamp      time.Time
+	Redelivery     bool
+	Detail         Detail
+	ReceivedAt     time.Time
+}
+
+// Event はLINE Webhookから受け取る1件のイベントの標準化フォーマット。
+// 種別ごとの内容は Detail に型付きで保持する。
 type Event struct {
-	destination string
-	eventType   string
-	userID      string
-	message     json.RawMessage
-	receivedAt  time.Time
+	destination    string
+	webhookEventID string
+	replyToken     string
+	mode           string
+	source         Source
+	timestamp      time.Time
+	redelivery     bool
+	detail         Detail
+	receivedAt     time.Time
 }
 
 // New はイベントを生成する。
-func New(destination, eventType, userID string, message json.RawMessage, receivedAt time.Time) (*Event, error) {
-	dest := strings.TrimSpace(destination)
-	etype := strings.TrimSpace(eventType)
-	uid := strings.TrimSpace(userID)
-	if etype == "" || uid == "" {
+func New(p Params) (*Event, error) {
+	if p.Detail == nil || strings.TrimSpace(string(p.Detail.EventType())) == "" {
 		return nil, ErrInvalidEvent
 	}
+	src := Source{
+		Type:    SourceType(strings.TrimSpace(string(p.Source.Type))),
+		UserID:  strings.TrimSpace(p.Source.UserID),
+		GroupID: strings.TrimSpace(p.Source.GroupID),
+		RoomID:  strings.TrimSpace(p.Source.RoomID),
+	}
+	if err := src.validate(); err != nil {
+		return nil, err
+	}
 	return &Event{
-		destination: dest,
-		eventType:   etype,
-		userID:      uid,
-		message:     message,
-		receivedAt:  receivedAt,
+		destination:    strings.TrimSpace(p.Destination),
+		webhookEventID: strings.TrimSpace(p.WebhookEventID),
+		replyToken:     strings.TrimSpace(p.ReplyToken),
+		mode:           strings.TrimSpace(p.Mode),
+		source:         src,
+		timestamp:      p.Timestamp,
+		redelivery:     p.Redelivery,
+		detail:         p.Detail,
+		receivedAt:     p.ReceivedAt,
 	}, nil
 }
 
@@ -43,22 +110,92 @@ func (e *Event) Destination() string {
 	return e.destination
 }
 
+// WebhookEventID はイベントの一意なIDを返す。再送時も同じ値になる。
+func (e *Event) WebhookEventID() string {
+	return e.webhookEventID
+}
+
 // EventType はイベント種別を返す。
-func (e *Event) EventType() string {
-	return e.eventType
+func (e *Event) EventType() Type {
+	return e.detail.EventType()
+}
+
+// ReplyToken は応答トークンを返す。応答できないイベントでは空。
+func (e *Event) ReplyToken() string {
+	return e.replyToken
+}
+
+// Mode はチャネルの状態（active/standby）を返す。
+func (e *Event) Mode() string {
+	return e.mode
 }
 
-// UserID はユーザーIDを返す。
+// Source は送信元を返す。
+func (e *Event) Source() Source {
+	return e.source
+}
+
+// UserID は送信元のユーザーIDを返す。
 func (e *Event) UserID() string {
-	return e.userID
+	return e.source.UserID
 }
 
-// Message はメッセージ本文（JSON）を返す。
-func (e *Event) Message() json.RawMessage {
-	return e.message
+// Timestamp はLINE側でイベントが発生した時刻を返す。
+func (e *Event) Timestamp() time.Time {
+	return e.timestamp
+}
+
+// Redelivery はLINEからの再送かどうかを返す。
+func (e *Event) Redelivery() bool {
+	return e.redelivery
+}
+
+// Detail は種別ごとの内容を返す。
+func (e *Event) Detail() Detail {
+	return e.detail
+}
+
+// Message はメッセージイベントの内容を返す。メッセージ以外では nil。
+func (e *Event) Message() Message {
+	m, _ := e.detail.(Message)
+	return m
 }
 
 // ReceivedAt は受信時刻を返す。
 func (e *Event) ReceivedAt() time.Time {
 	return e.receivedAt
 }
+
+// MarshalJSON はNATSへpublishする形式に変換する。種別ごとの内容は種別名のフィールドに入れる。
+func (e *Event) MarshalJSON() ([]byte, error) {
+	detail, err := marshalDetail(e.detail)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"destination":  e.destination,
+		"eventType":    e.EventType(),
+		"source":       e.source,
+		"isRedelivery": e.redelivery,
+		"receivedAt":   e.receivedAt,
+	}
+	if e.webhookEventID != "" {
+		out["webhookEventId"] = e.webhookEventID
+	}
+	if e.replyToken != "" {
+		out["replyToken"] = e.replyToken
+	}
+	if e.mode != "" {
+		out["mode"] = e.mode
+	}
+	if e.source.UserID != "" {
+		out["userId"] = e.source.UserID
+	}
+	if !e.timestamp.IsZero() {
+		out["timestamp"] = e.timestamp
+	}
+	if detail != nil {
+		out[detailField(e.detail)] = detail
+	}
+	return json.Marshal(out)
+}
@@ -2,6 +2,7 @@ package lineevent
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -9,26 +10,30 @@ import (
 // Event生成のテーブル駆動テスト。
 func TestEventNew(t *testing.T) {
 	t.Parallel()
-	body := json.RawMessage(`{"msg":"hi"}`)
 	now := time.Now()
 	tests := []struct {
 		name      string
-		dest      string
-		etype     string
-		uid       string
+		source    Source
+		detail    Detail
+		wantType  Type
 		wantError error
 	}{
-		{name: "正常", dest: "line", etype: "message", uid: "U1"},
-		{name: "etype空はエラー", dest: "line", uid: "U1", wantError: ErrInvalidEvent},
-		{name: "uid空はエラー", dest: "line", etype: "message", wantError: ErrInvalidEvent},
+		{name: "正常", source: Source{Type: SourceUser, UserID: "U1"}, detail: TextMessage{ID: "1", Text: "hi"}, wantType: TypeMessage},
+		{name: "グループはuserIdなしでも可", source: Source{Type: SourceGroup, GroupID: "C1"}, detail: Join{}, wantType: TypeJoin},
+		{name: "未対応の種別も保持", source: Source{Type: SourceUser, UserID: "U1"}, detail: Unknown{Type: "videoPlayComplete"}, wantType: "videoPlayComplete"},
+		{name: "内容なしはエラー", source: Source{Type: SourceUser, UserID: "U1"}, wantError: ErrInvalidEvent},
+		{name: "種別空はエラー", source: Source{Type: SourceUser, UserID: "U1"}, detail: Unknown{}, wantError: ErrInvalidEvent},
+		{name: "uid空はエラー", source: Source{Type: SourceUser}, detail: Follow{}, wantError: ErrInvalidSource},
+		{name: "roomIdなしはエラー", source: Source{Type: SourceRoom, UserID: "U1"}, detail: Follow{}, wantError: ErrInvalidSource},
+		{name: "送信元種別不明はエラー", source: Source{Type: "bot", UserID: "U1"}, detail: Follow{}, wantError: ErrInvalidSource},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			ev, err := New(tt.dest, tt.etype, tt.uid, body, now)
+			ev, err := New(Params{Destination: "dest", Source: tt.source, Detail: tt.detail, ReceivedAt: now})
 			if tt.wantError != nil {
-				if err != tt.wantError {
+				if !errors.Is(err, tt.wantError) {
 					t.Fatalf("want %v, got %v", tt.wantError, err)
 				}
 				return
@@ -36,11 +41,67 @@ func TestEventNew(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
-			if ev.EventType() != tt.etype || ev.UserID() != tt.uid {
-				t.Fatalf("field mismatch")
+			if ev.EventType() != tt.wantType || ev.UserID() != tt.source.UserID {
+				t.Fatalf("field mismatch: type=%s user=%s", ev.EventType(), ev.UserID())
 			}
-			if string(ev.Message()) == "" {
-				t.Fatalf("message empty")
+		})
+	}
+}
+
+// publish用JSONに種別ごとの内容が入ることを確認する。
+func TestEventMarshalJSON(t *testing.T) {
+	t.Parallel()
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		detail Detail
+		field  string
+		want   string
+	}{
+		{name: "テキスト", detail: TextMessage{ID: "1", Text: "hi"}, field: "message", want: `{"type":"text","id":"1","text":"hi"}`},
+		{name: "スタンプ", detail: StickerMessage{ID: "2", PackageID: "446", StickerID: "1988"}, field: "message", want: `{"type":"sticker","id":"2","packageId":"446","stickerId":"1988"}`},
+		{name: "未対応メッセージ", detail: UnknownMessage{ID: "3", Type: "story"}, field: "message", want: `{"type":"story","id":"3"}`},
+		{name: "ポストバック", detail: Postback{Data: "action=buy", Params: map[string]string{"date": "2025-01-01"}}, field: "postback", want: `{"data":"action=buy","params":{"date":"2025-01-01"}}`},
+		{name: "メンバー参加", detail: MemberJoined{Members: []Source{{Type: SourceUser, UserID: "U2"}}}, field: "joined", want: `{"members":[{"type":"user","userId":"U2"}]}`},
+		{name: "ブロック", detail: Unfollow{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ev, err := New(Params{
+				Destination:    "dest",
+				WebhookEventID: "01H",
+				ReplyToken:     "rt",
+				Source:         Source{Type: SourceUser, UserID: "U1"},
+				Timestamp:      ts,
+				Detail:         tt.detail,
+				ReceivedAt:     ts,
+			})
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			b, err := json.Marshal(ev)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if string(got["eventType"]) != `"`+string(tt.detail.EventType())+`"` || string(got["webhookEventId"]) != `"01H"` || string(got["userId"]) != `"U1"` {
+				t.Fatalf("unexpected envelope: %s", b)
+			}
+			for _, f := range []string{"message", "postback", "joined", "left", "follow", "beacon"} {
+				if f == tt.field {
+					continue
+				}
+				if _, ok := got[f]; ok {
+					t.Fatalf("unexpected field %s: %s", f, b)
+				}
+			}
+			if tt.field != "" && string(got[tt.field]) != tt.want {
+				t.Fatalf("%s=%s want=%s", tt.field, got[tt.field], tt.want)
 			}
 		})
 	}
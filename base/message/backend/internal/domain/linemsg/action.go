@@ -0,0 +1,132 @@
+package linemsg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ActionType はアクションの種別。
+type ActionType string
+
+const (
+	ActionPostback       ActionType = "postback"
+	ActionMessage        ActionType = "message"
+	ActionURI            ActionType = "uri"
+	ActionDatetimePicker ActionType = "datetimepicker"
+	// ActionCamera・ActionCameraRoll・ActionLocation はクイックリプライでだけ使える。
+	ActionCamera     ActionType = "camera"
+	ActionCameraRoll ActionType = "cameraRoll"
+	ActionLocation   ActionType = "location"
+)
+
+// アクション・クイックリプライの上限。
+const (
+	maxActionLabel     = 20
+	maxActionData      = 300
+	maxActionText      = 300
+	maxActionURI       = 1000
+	maxQuickReplyItems = 13
+)
+
+// Action はテンプレートのボタンやクイックリプライで使うアクション。種別ごとに使うフィールドが異なる。
+type Action struct {
+	Type  ActionType `json:"type"`
+	Label string     `json:"label,omitempty"`
+	// Data は postback・datetimepicker でWebhookに返る値。
+	Data string `json:"data,omitempty"`
+	// DisplayText は postback でユーザーの発言として表示する文。
+	DisplayText string `json:"displayText,omitempty"`
+	// Text は message で送られる文。
+	Text string `json:"text,omitempty"`
+	// URI は uri で開くURL。
+	URI string `json:"uri,omitempty"`
+	// Mode・Initial・Max・Min は datetimepicker の設定。
+	Mode    string `json:"mode,omitempty"`
+	Initial string `json:"initial,omitempty"`
+	Max     string `json:"max,omitempty"`
+	Min     string `json:"min,omitempty"`
+}
+
+// validate はアクションを検証する。quickReply はクイックリプライ内のアクションかどうか。
+func (a Action) validate(quickReply bool) error {
+	if strings.TrimSpace(a.Label) == "" || utf8.RuneCountInString(a.Label) > maxActionLabel {
+		return fmt.Errorf("label must be 1-%d characters", maxActionLabel)
+	}
+	switch a.Type {
+	case ActionPostback:
+		if a.Data == "" || utf8.RuneCountInString(a.Data) > maxActionData {
+			return fmt.Errorf("postback data must be 1-%d characters", maxActionData)
+		}
+		if utf8.RuneCountInString(a.DisplayText) > maxActionText {
+			return fmt.Errorf("postback displayText must be at most %d characters", maxActionText)
+		}
+	case ActionMessage:
+		if strings.TrimSpace(a.Text) == "" || utf8.RuneCountInString(a.Text) > maxActionText {
+			return fmt.Errorf("message action text must be 1-%d characters", maxActionText)
+		}
+	case ActionURI:
+		if !hasAnyPrefix(a.URI, "https://", "http://", "line://", "tel:") || len(a.URI) > maxActionURI {
+			return fmt.Errorf("uri must be an http(s), line or tel URI of at most %d characters", maxActionURI)
+		}
+	case ActionDatetimePicker:
+		if a.Data == "" || utf8.RuneCountInString(a.Data) > maxActionData {
+			return fmt.Errorf("datetimepicker data must be 1-%d characters", maxActionData)
+		}
+		if a.Mode != "date" && a.Mode != "time" && a.Mode != "datetime" {
+			return errors.New("datetimepicker mode must be date, time or datetime")
+		}
+	case ActionCamera, ActionCameraRoll, ActionLocation:
+		if !quickReply {
+			return fmt.Errorf("%s action is only allowed in quick replies", a.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported action type %q", a.Type)
+	}
+	return nil
+}
+
+// QuickReply はメッセージの下に出すクイックリプライのボタン。
+type QuickReply struct {
+	Items []QuickReplyItem `json:"items"`
+}
+
+// QuickReplyItem はクイックリプライのボタン1つ。Type は常に action。
+type QuickReplyItem struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"imageUrl,omitempty"`
+	Action   Action `json:"action"`
+}
+
+func (q *QuickReply) validate() error {
+	if q == nil {
+		return nil
+	}
+	if len(q.Items) == 0 || len(q.Items) > maxQuickReplyItems {
+		return fmt.Errorf("quickReply.items must contain 1-%d items", maxQuickReplyItems)
+	}
+	for i, item := range q.Items {
+		if item.Type != "action" {
+			return fmt.Errorf("quickReply.items[%d]: type must be action", i)
+		}
+		if item.ImageURL != "" {
+			if err := validateHTTPS("imageUrl", item.ImageURL); err != nil {
+				return fmt.Errorf("quickReply.items[%d]: %w", i, err)
+			}
+		}
+		if err := item.Action.validate(true); err != nil {
+			return fmt.Errorf("quickReply.items[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
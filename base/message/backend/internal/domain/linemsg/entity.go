@@ -0,0 +1,328 @@
+package linemsg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidMessage は送信メッセージがLINEの仕様を満たさない場合に返す。理由は包んだエラーの文言に含める。
+var ErrInvalidMessage = errors.New("linemsg: invalid message")
+
+// MaxMessages は1回のPushで送れるメッセージ数の上限。
+const MaxMessages = 5
+
+// LINE Messaging API の各フィールドの上限。
+const (
+	maxTextLength         = 5000
+	maxFlexAltTextLength  = 1500
+	maxTemplateAltLength  = 400
+	maxURLLength          = 2000
+	maxButtonsTitle       = 40
+	maxButtonsText        = 160
+	maxButtonsTextWithTop = 60
+	maxConfirmText        = 240
+	maxButtonsActions     = 4
+)
+
+// Type はメッセージ種別。
+type Type string
+
+const (
+	TypeText     Type = "text"
+	TypeImage    Type = "image"
+	TypeSticker  Type = "sticker"
+	TypeFlex     Type = "flex"
+	TypeTemplate Type = "template"
+)
+
+// Message はPushで送る1件のメッセージ。JSONにすると type を含むLINEの形式になる。
+type Message interface {
+	Type() Type
+	validate() error
+}
+
+// Text はテキストメッセージ。
+type Text struct {
+	Text       string      `json:"text"`
+	QuickReply *QuickReply `json:"quickReply,omitempty"`
+}
+
+// Image は画像メッセージ。URLはHTTPSに限る。
+type Image struct {
+	OriginalContentURL string      `json:"originalContentUrl"`
+	PreviewImageURL    string      `json:"previewImageUrl"`
+	QuickReply         *QuickReply `json:"quickReply,omitempty"`
+}
+
+// Sticker はスタンプメッセージ。
+type Sticker struct {
+	PackageID  string      `json:"packageId"`
+	StickerID  string      `json:"stickerId"`
+	QuickReply *QuickReply `json:"quickReply,omitempty"`
+}
+
+// Flex はFlex Message。Contents はbubbleかcarouselのコンテナで、中身は検証せずそのまま送る。
+type Flex struct {
+	AltText    string          `json:"altText"`
+	Contents   json.RawMessage `json:"contents"`
+	QuickReply *QuickReply     `json:"quickReply,omitempty"`
+}
+
+// Template はボタン・確認テンプレートのメッセージ。
+type Template struct {
+	AltText    string          `json:"altText"`
+	Template   TemplateContent `json:"template"`
+	QuickReply *QuickReply     `json:"quickReply,omitempty"`
+}
+
+// TemplateType はテンプレートの種別。
+type TemplateType string
+
+const (
+	TemplateButtons TemplateType = "buttons"
+	TemplateConfirm TemplateType = "confirm"
+)
+
+// TemplateContent はテンプレートの中身。confirm では画像・タイトル・defaultAction を使わない。
+type TemplateContent struct {
+	Type              TemplateType `json:"type"`
+	ThumbnailImageURL string       `json:"thumbnailImageUrl,omitempty"`
+	Title             string       `json:"title,omitempty"`
+	Text              string       `json:"text"`
+	DefaultAction     *Action      `json:"defaultAction,omitempty"`
+	Actions           []Action     `json:"actions"`
+}
+
+func (Text) Type() Type     { return TypeText }
+func (Image) Type() Type    { return TypeImage }
+func (Sticker) Type() Type  { return TypeSticker }
+func (Flex) Type() Type     { return TypeFlex }
+func (Template) Type() Type { return TypeTemplate }
+
+func (m Text) validate() error {
+	if strings.TrimSpace(m.Text) == "" || utf8.RuneCountInString(m.Text) > maxTextLength {
+		return fmt.Errorf("text must be 1-%d characters", maxTextLength)
+	}
+	return m.QuickReply.validate()
+}
+
+func (m Image) validate() error {
+	if err := validateHTTPS("originalContentUrl", m.OriginalContentURL); err != nil {
+		return err
+	}
+	if err := validateHTTPS("previewImageUrl", m.PreviewImageURL); err != nil {
+		return err
+	}
+	return m.QuickReply.validate()
+}
+
+func (m Sticker) validate() error {
+	if strings.TrimSpace(m.PackageID) == "" || strings.TrimSpace(m.StickerID) == "" {
+		return errors.New("packageId and stickerId are required")
+	}
+	return m.QuickReply.validate()
+}
+
+func (m Flex) validate() error {
+	if err := validateAltText(m.AltText, maxFlexAltTextLength); err != nil {
+		return err
+	}
+	var container struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(m.Contents, &container); err != nil || (container.Type != "bubble" && container.Type != "carousel") {
+		return errors.New("contents must be a bubble or carousel container")
+	}
+	return m.QuickReply.validate()
+}
+
+func (m Template) validate() error {
+	if err := validateAltText(m.AltText, maxTemplateAltLength); err != nil {
+		return err
+	}
+	if err := m.Template.validate(); err != nil {
+		return err
+	}
+	return m.QuickReply.validate()
+}
+
+func (t TemplateContent) validate() error {
+	text := utf8.RuneCountInString(t.Text)
+	switch t.Type {
+	case TemplateButtons:
+		if utf8.RuneCountInString(t.Title) > maxButtonsTitle {
+			return fmt.Errorf("template.title must be at most %d characters", maxButtonsTitle)
+		}
+		if t.ThumbnailImageURL != "" {
+			if err := validateHTTPS("template.thumbnailImageUrl", t.ThumbnailImageURL); err != nil {
+				return err
+			}
+		}
+		limit := maxButtonsText
+		if t.Title != "" || t.ThumbnailImageURL != "" {
+			limit = maxButtonsTextWithTop
+		}
+		if text == 0 || text > limit {
+			return fmt.Errorf("template.text must be 1-%d characters", limit)
+		}
+		if len(t.Actions) == 0 || len(t.Actions) > maxButtonsActions {
+			return fmt.Errorf("buttons template needs 1-%d actions", maxButtonsActions)
+		}
+		if t.DefaultAction != nil {
+			if err := t.DefaultAction.validate(false); err != nil {
+				return fmt.Errorf("template.defaultAction: %w", err)
+			}
+		}
+	case TemplateConfirm:
+		if t.Title != "" || t.ThumbnailImageURL != "" || t.DefaultAction != nil {
+			return errors.New("confirm template takes only text and actions")
+		}
+		if text == 0 || text > maxConfirmText {
+			return fmt.Errorf("template.text must be 1-%d characters", maxConfirmText)
+		}
+		if len(t.Actions) != 2 {
+			return errors.New("confirm template needs exactly 2 actions")
+		}
+	default:
+		return fmt.Errorf("unsupported template type %q", t.Type)
+	}
+	for i, a := range t.Actions {
+		if err := a.validate(false); err != nil {
+			return fmt.Errorf("template.actions[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON は種別を type として含める。
+func (m Text) MarshalJSON() ([]byte, error) {
+	type plain Text
+	return marshalWithType(TypeText, plain(m))
+}
+
+// MarshalJSON は種別を type として含める。
+func (m Image) MarshalJSON() ([]byte, error) {
+	type plain Image
+	return marshalWithType(TypeImage, plain(m))
+}
+
+// MarshalJSON は種別を type として含める。
+func (m Sticker) MarshalJSON() ([]byte, error) {
+	type plain Sticker
+	return marshalWithType(TypeSticker, plain(m))
+}
+
+// MarshalJSON は種別を type として含める。
+func (m Flex) MarshalJSON() ([]byte, error) {
+	type plain Flex
+	return marshalWithType(TypeFlex, plain(m))
+}
+
+// MarshalJSON は種別を type として含める。
+func (m Template) MarshalJSON() ([]byte, error) {
+	type plain Template
+	return marshalWithType(TypeTemplate, plain(m))
+}
+
+func marshalWithType(t Type, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("linemsg: encode %s: %w", t, err)
+	}
+	typ, _ := json.Marshal(t)
+	out := append([]byte(`{"type":`), typ...)
+	if len(body) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, body[1:]...), nil
+}
+
+// Parse は送信APIの messages 配列を型付きのメッセージにし、LINEの仕様に沿って検証する。
+// 未対応のフィールドは黙って落とさずエラーにする。
+func Parse(raws []json.RawMessage) ([]Message, error) {
+	if len(raws) == 0 || len(raws) > MaxMessages {
+		return nil, fmt.Errorf("%w: messages must contain 1-%d items", ErrInvalidMessage, MaxMessages)
+	}
+	out := make([]Message, 0, len(raws))
+	for i, raw := range raws {
+		m, err := parseOne(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: messages[%d]: %v", ErrInvalidMessage, i, err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func parseOne(raw json.RawMessage) (Message, error) {
+	var head struct {
+		Type Type `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, errors.New("must be an object with type")
+	}
+	var (
+		m   Message
+		err error
+	)
+	switch head.Type {
+	case TypeText:
+		m, err = decode[Text](raw)
+	case TypeImage:
+		m, err = decode[Image](raw)
+	case TypeSticker:
+		m, err = decode[Sticker](raw)
+	case TypeFlex:
+		m, err = decode[Flex](raw)
+	case TypeTemplate:
+		m, err = decode[Template](raw)
+	default:
+		return nil, fmt.Errorf("unsupported type %q", head.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", head.Type, err)
+	}
+	return m, nil
+}
+
+// decode は type 以外の未知のフィールドを拒否して T に読み込む。
+func decode[T Message](raw json.RawMessage) (Message, error) {
+	var m T
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", m.Type(), err)
+	}
+	delete(fields, "type")
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", m.Type(), err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", m.Type(), err)
+	}
+	return m, nil
+}
+
+func validateAltText(s string, limit int) error {
+	n := utf8.RuneCountInString(s)
+	if strings.TrimSpace(s) == "" || n > limit {
+		return fmt.Errorf("altText must be 1-%d characters", limit)
+	}
+	return nil
+}
+
+func validateHTTPS(field, u string) error {
+	if !strings.HasPrefix(u, "https://") || len(u) > maxURLLength {
+		return fmt.Errorf("%s must be an https URL of at most %d characters", field, maxURLLength)
+	}
+	return nil
+}
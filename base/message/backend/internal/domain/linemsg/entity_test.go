@@ -0,0 +1,97 @@
+package linemsg
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 送信メッセージの検証のテーブル駆動テスト。
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	buttons := `{"type":"template","altText":"予約","template":{"type":"buttons","title":"店舗","text":"予約しますか","actions":[{"type":"postback","label":"予約","data":"reserve=1"},{"type":"uri","label":"地図","uri":"https://example.com/map"}]}}`
+	tests := []struct {
+		name     string
+		messages []string
+		wantType []Type
+		wantErr  string
+	}{
+		{name: "テキスト", messages: []string{`{"type":"text","text":"hi"}`}, wantType: []Type{TypeText}},
+		{
+			name: "複数種別",
+			messages: []string{
+				`{"type":"image","originalContentUrl":"https://example.com/a.jpg","previewImageUrl":"https://example.com/a_s.jpg"}`,
+				`{"type":"sticker","packageId":"446","stickerId":"1988"}`,
+				`{"type":"flex","altText":"店舗カード","contents":{"type":"bubble","body":{"type":"box","layout":"vertical","contents":[]}}}`,
+				buttons,
+				`{"type":"template","altText":"確認","template":{"type":"confirm","text":"よろしいですか","actions":[{"type":"message","label":"はい","text":"はい"},{"type":"message","label":"いいえ","text":"いいえ"}]}}`,
+			},
+			wantType: []Type{TypeImage, TypeSticker, TypeFlex, TypeTemplate, TypeTemplate},
+		},
+		{name: "クイックリプライ", messages: []string{`{"type":"text","text":"場所は?","quickReply":{"items":[{"type":"action","action":{"type":"location","label":"位置情報"}}]}}`}, wantType: []Type{TypeText}},
+		{name: "空配列", messages: []string{}, wantErr: "1-5 items"},
+		{name: "6件以上", messages: []string{`{"type":"text","text":"1"}`, `{"type":"text","text":"2"}`, `{"type":"text","text":"3"}`, `{"type":"text","text":"4"}`, `{"type":"text","text":"5"}`, `{"type":"text","text":"6"}`}, wantErr: "1-5 items"},
+		{name: "未対応の種別", messages: []string{`{"type":"video"}`}, wantErr: `unsupported type "video"`},
+		{name: "未知のフィールド", messages: []string{`{"type":"text","text":"hi","emojis":[]}`}, wantErr: "unknown field"},
+		{name: "長すぎるテキスト", messages: []string{`{"type":"text","text":"` + strings.Repeat("あ", 5001) + `"}`}, wantErr: "text must be"},
+		{name: "画像がhttp", messages: []string{`{"type":"image","originalContentUrl":"http://example.com/a.jpg","previewImageUrl":"https://example.com/a.jpg"}`}, wantErr: "originalContentUrl"},
+		{name: "Flexの中身がコンテナでない", messages: []string{`{"type":"flex","altText":"x","contents":{"type":"box"}}`}, wantErr: "bubble or carousel"},
+		{name: "確認テンプレートのボタンが1つ", messages: []string{`{"type":"template","altText":"確認","template":{"type":"confirm","text":"ok?","actions":[{"type":"message","label":"はい","text":"はい"}]}}`}, wantErr: "exactly 2"},
+		{name: "テンプレートでカメラ", messages: []string{`{"type":"template","altText":"x","template":{"type":"buttons","text":"x","actions":[{"type":"camera","label":"撮影"}]}}`}, wantErr: "only allowed in quick replies"},
+		{name: "クイックリプライが14件", messages: []string{`{"type":"text","text":"x","quickReply":{"items":[` + strings.Repeat(`{"type":"action","action":{"type":"camera","label":"c"}},`, 13) + `{"type":"action","action":{"type":"camera","label":"c"}}]}}`}, wantErr: "1-13 items"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			raws := make([]json.RawMessage, len(tt.messages))
+			for i, m := range tt.messages {
+				raws[i] = json.RawMessage(m)
+			}
+			got, err := Parse(raws)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, m := range got {
+				if m.Type() != tt.wantType[i] {
+					t.Fatalf("messages[%d] type=%s want=%s", i, m.Type(), tt.wantType[i])
+				}
+			}
+		})
+	}
+}
+
+// JSONにしたメッセージは type を含み、読み直すと元と同じ内容になる。
+func TestMessage_MarshalRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"type":"flex","altText":"店舗カード","contents":{"type":"carousel","contents":[{"type":"bubble"}]},"quickReply":{"items":[{"type":"action","imageUrl":"https://example.com/i.png","action":{"type":"postback","label":"詳細","data":"shop=1","displayText":"詳細"}}]}},{"type":"text","text":"hi"}]`
+	var raws []json.RawMessage
+	if err := json.Unmarshal([]byte(in), &raws); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	msgs, err := Parse(raws)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	out, err := json.Marshal(msgs)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var want, got any
+	_ = json.Unmarshal([]byte(in), &want)
+	_ = json.Unmarshal(out, &got)
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(wantJSON) != string(gotJSON) {
+		t.Fatalf("round trip mismatch:\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+}
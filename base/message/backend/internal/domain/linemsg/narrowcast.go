@@ -0,0 +1,265 @@
+package linemsg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidNarrowcast はナローキャストの宛先・絞り込み条件がLINEの仕様を満たさない場合に返す。
+var ErrInvalidNarrowcast = errors.New("linemsg: invalid narrowcast")
+
+// MaxMulticastRecipients はマルチキャスト1回のAPI呼び出しで送れる宛先の上限。
+const MaxMulticastRecipients = 500
+
+// ナローキャストの上限。
+const (
+	maxAudiences         = 10
+	maxOperatorOperands  = 10
+	maxNarrowcastLimit   = 10_000_000
+	maxRecipientNestings = 10
+)
+
+// Narrowcast はナローキャストの宛先・絞り込み条件・上限数。すべて省略すると友だち全員に送る。
+type Narrowcast struct {
+	Recipient *Recipient       `json:"recipient,omitempty"`
+	Filter    *Filter          `json:"filter,omitempty"`
+	Limit     *NarrowcastLimit `json:"limit,omitempty"`
+}
+
+// Recipient はオーディエンスで宛先を指定する。type が operator なら and・or・not のいずれか1つで組み合わせる。
+type Recipient struct {
+	Type string `json:"type"`
+	// AudienceGroupID は type が audience のときのオーディエンスID。
+	AudienceGroupID int64 `json:"audienceGroupId,omitempty"`
+	// RequestID は type が redelivery のときの、再送する元のナローキャストのリクエストID。
+	RequestID string      `json:"requestId,omitempty"`
+	And       []Recipient `json:"and,omitempty"`
+	Or        []Recipient `json:"or,omitempty"`
+	Not       *Recipient  `json:"not,omitempty"`
+}
+
+// Filter は属性情報による絞り込み条件。
+type Filter struct {
+	Demographic *Demographic `json:"demographic"`
+}
+
+// Demographic は属性情報の条件。type が operator なら and・or・not のいずれか1つで組み合わせる。
+// 年齢と友だち期間は gte・lt、性別・OS・地域は oneOf で指定する。
+type Demographic struct {
+	Type  string        `json:"type"`
+	OneOf []string      `json:"oneOf,omitempty"`
+	GTE   string        `json:"gte,omitempty"`
+	LT    string        `json:"lt,omitempty"`
+	And   []Demographic `json:"and,omitempty"`
+	Or    []Demographic `json:"or,omitempty"`
+	Not   *Demographic  `json:"not,omitempty"`
+}
+
+// NarrowcastLimit は送信数の上限。
+type NarrowcastLimit struct {
+	Max                int  `json:"max,omitempty"`
+	UpToRemainingQuota bool `json:"upToRemainingQuota,omitempty"`
+}
+
+// 属性情報の条件で使える値。
+var (
+	demographicAges    = []string{"age_15", "age_20", "age_25", "age_30", "age_35", "age_40", "age_45", "age_50", "age_55", "age_60", "age_65", "age_70"}
+	demographicPeriods = []string{"day_7", "day_30", "day_90", "day_180", "day_365"}
+	demographicGenders = []string{"male", "female"}
+	demographicApps    = []string{"ios", "android"}
+)
+
+// ParseNarrowcast は送信APIの narrowcast オブジェクトを読み込み、LINEの仕様に沿って検証する。
+// 未対応のフィールドは黙って落とさずエラーにする。
+func ParseNarrowcast(raw json.RawMessage) (*Narrowcast, error) {
+	var n Narrowcast
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNarrowcast, err)
+	}
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Validate は宛先・絞り込み条件・上限数を検証する。
+func (n Narrowcast) Validate() error {
+	if n.Recipient != nil {
+		audiences := 0
+		if err := n.Recipient.validate(0, &audiences); err != nil {
+			return fmt.Errorf("%w: recipient: %v", ErrInvalidNarrowcast, err)
+		}
+		if audiences > maxAudiences {
+			return fmt.Errorf("%w: recipient: at most %d audiences", ErrInvalidNarrowcast, maxAudiences)
+		}
+	}
+	if n.Filter != nil {
+		if n.Filter.Demographic == nil {
+			return fmt.Errorf("%w: filter.demographic is required", ErrInvalidNarrowcast)
+		}
+		if err := n.Filter.Demographic.validate(0); err != nil {
+			return fmt.Errorf("%w: filter.demographic: %v", ErrInvalidNarrowcast, err)
+		}
+	}
+	if n.Limit != nil && (n.Limit.Max < 0 || n.Limit.Max > maxNarrowcastLimit) {
+		return fmt.Errorf("%w: limit.max must be between 1 and %d", ErrInvalidNarrowcast, maxNarrowcastLimit)
+	}
+	return nil
+}
+
+func (r Recipient) validate(depth int, audiences *int) error {
+	if depth > maxRecipientNestings {
+		return fmt.Errorf("operators nested more than %d levels", maxRecipientNestings)
+	}
+	switch r.Type {
+	case "audience":
+		if r.AudienceGroupID <= 0 || r.RequestID != "" || r.hasOperands() {
+			return errors.New("audience takes only a positive audienceGroupId")
+		}
+		*audiences++
+	case "redelivery":
+		if strings.TrimSpace(r.RequestID) == "" || r.AudienceGroupID != 0 || r.hasOperands() {
+			return errors.New("redelivery takes only requestId")
+		}
+		*audiences++
+	case "operator":
+		if r.AudienceGroupID != 0 || r.RequestID != "" {
+			return errors.New("operator takes only and, or or not")
+		}
+		operands, err := operatorOperands(r.And, r.Or, r.Not)
+		if err != nil {
+			return err
+		}
+		for i, o := range operands {
+			if err := o.validate(depth+1, audiences); err != nil {
+				return fmt.Errorf("operand[%d]: %w", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %q", r.Type)
+	}
+	return nil
+}
+
+func (r Recipient) hasOperands() bool {
+	return len(r.And) > 0 || len(r.Or) > 0 || r.Not != nil
+}
+
+func (d Demographic) validate(depth int) error {
+	if depth > maxRecipientNestings {
+		return fmt.Errorf("operators nested more than %d levels", maxRecipientNestings)
+	}
+	if d.Type != "operator" && (len(d.And) > 0 || len(d.Or) > 0 || d.Not != nil) {
+		return fmt.Errorf("%s does not take and, or or not", d.Type)
+	}
+	switch d.Type {
+	case "gender":
+		return validateOneOf(d, demographicGenders)
+	case "appType":
+		return validateOneOf(d, demographicApps)
+	case "area":
+		return validateOneOf(d, nil)
+	case "age":
+		return validateRange(d, demographicAges)
+	case "subscriptionPeriod":
+		return validateRange(d, demographicPeriods)
+	case "operator":
+		if len(d.OneOf) > 0 || d.GTE != "" || d.LT != "" {
+			return errors.New("operator takes only and, or or not")
+		}
+		operands, err := operatorOperands(d.And, d.Or, d.Not)
+		if err != nil {
+			return err
+		}
+		for i, o := range operands {
+			if err := o.validate(depth + 1); err != nil {
+				return fmt.Errorf("operand[%d]: %w", i, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %q", d.Type)
+	}
+}
+
+// operatorOperands は and・or・not のうち指定された1つの被演算子を返す。
+func operatorOperands[T any](and, or []T, not *T) ([]T, error) {
+	set := 0
+	for _, ok := range []bool{len(and) > 0, len(or) > 0, not != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("operator needs exactly one of and, or and not")
+	}
+	switch {
+	case not != nil:
+		return []T{*not}, nil
+	case len(and) > 0:
+		if len(and) > maxOperatorOperands {
+			return nil, fmt.Errorf("and takes at most %d operands", maxOperatorOperands)
+		}
+		return and, nil
+	default:
+		if len(or) > maxOperatorOperands {
+			return nil, fmt.Errorf("or takes at most %d operands", maxOperatorOperands)
+		}
+		return or, nil
+	}
+}
+
+// validateOneOf は oneOf の条件を検証する。allowed が nil なら値の種類は確かめない。
+func validateOneOf(d Demographic, allowed []string) error {
+	if d.GTE != "" || d.LT != "" {
+		return fmt.Errorf("%s takes only oneOf", d.Type)
+	}
+	if len(d.OneOf) == 0 {
+		return fmt.Errorf("%s needs oneOf", d.Type)
+	}
+	for _, v := range d.OneOf {
+		if strings.TrimSpace(v) == "" || (allowed != nil && indexOf(allowed, v) < 0) {
+			return fmt.Errorf("%s: unsupported value %q", d.Type, v)
+		}
+	}
+	return nil
+}
+
+// validateRange は gte・lt の条件を検証する。値は allowed の順に並んでいる前提で、gte < lt を求める。
+func validateRange(d Demographic, allowed []string) error {
+	if len(d.OneOf) > 0 {
+		return fmt.Errorf("%s takes only gte and lt", d.Type)
+	}
+	if d.GTE == "" && d.LT == "" {
+		return fmt.Errorf("%s needs gte or lt", d.Type)
+	}
+	gte, lt := -1, len(allowed)
+	if d.GTE != "" {
+		if gte = indexOf(allowed, d.GTE); gte < 0 {
+			return fmt.Errorf("%s: unsupported gte %q", d.Type, d.GTE)
+		}
+	}
+	if d.LT != "" {
+		if lt = indexOf(allowed, d.LT); lt < 0 {
+			return fmt.Errorf("%s: unsupported lt %q", d.Type, d.LT)
+		}
+	}
+	if gte >= lt {
+		return fmt.Errorf("%s: gte must be less than lt", d.Type)
+	}
+	return nil
+}
+
+func indexOf(values []string, v string) int {
+	for i, s := range values {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,52 @@
+package linemsg
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ナローキャストの宛先・絞り込み条件の検証のテーブル駆動テスト。
+func TestParseNarrowcast(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "全員", raw: `{}`},
+		{name: "オーディエンス", raw: `{"recipient":{"type":"audience","audienceGroupId":5614991017776}}`},
+		{
+			name: "オーディエンスと属性の組み合わせ",
+			raw:  `{"recipient":{"type":"operator","and":[{"type":"audience","audienceGroupId":1},{"type":"operator","not":{"type":"audience","audienceGroupId":2}}]},"filter":{"demographic":{"type":"operator","or":[{"type":"gender","oneOf":["female"]},{"type":"age","gte":"age_20","lt":"age_35"},{"type":"area","oneOf":["jp_13"]}]}},"limit":{"max":100,"upToRemainingQuota":true}}`,
+		},
+		{name: "再送", raw: `{"recipient":{"type":"redelivery","requestId":"5b59509c-c57b-11e9-aa8c-2a2ae2dbcce4"}}`},
+		{name: "未知のフィールド", raw: `{"recipient":{"type":"audience","audienceGroupId":1},"notify":true}`, wantErr: "unknown field"},
+		{name: "未対応の宛先種別", raw: `{"recipient":{"type":"user"}}`, wantErr: `unsupported type "user"`},
+		{name: "オーディエンスIDなし", raw: `{"recipient":{"type":"audience"}}`, wantErr: "positive audienceGroupId"},
+		{name: "演算子が2つ", raw: `{"recipient":{"type":"operator","and":[{"type":"audience","audienceGroupId":1}],"or":[{"type":"audience","audienceGroupId":2}]}}`, wantErr: "exactly one of"},
+		{name: "オーディエンスが11個", raw: `{"recipient":{"type":"operator","or":[` + strings.TrimSuffix(strings.Repeat(`{"type":"audience","audienceGroupId":1},`, 11), ",") + `]}}`, wantErr: "at most 10 operands"},
+		{name: "年齢の範囲が逆", raw: `{"filter":{"demographic":{"type":"age","gte":"age_40","lt":"age_20"}}}`, wantErr: "gte must be less than lt"},
+		{name: "性別の値が不正", raw: `{"filter":{"demographic":{"type":"gender","oneOf":["other"]}}}`, wantErr: `unsupported value "other"`},
+		{name: "属性条件なし", raw: `{"filter":{}}`, wantErr: "filter.demographic is required"},
+		{name: "上限数が負", raw: `{"limit":{"max":-1}}`, wantErr: "limit.max"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseNarrowcast(json.RawMessage(tt.raw))
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidNarrowcast) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -2,68 +2,264 @@ package message
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 )
 
 var (
+	// ErrEmptyID はメッセージIDが空の場合に返す。
+	ErrEmptyID = errors.New("message: id is required")
 	// ErrEmptyDestination は宛先が空の場合に返す。
 	ErrEmptyDestination = errors.New("message: destination is required")
 	// ErrEmptyUserID はuserIDが空の場合に返す。
 	ErrEmptyUserID = errors.New("message: userId is required")
 	// ErrEmptyText は本文が空の場合に返す。
-	ErrEmptyText = errors.New("message: text is required")
+	ErrEmptyText = errors.New("message: text or messages is required")
+	// ErrTextWithMessages は text と messages を両方指定した場合に返す。
+	ErrTextWithMessages = errors.New("message: text and messages are mutually exclusive")
+	// ErrMessagesNotSupported は messages に対応しない宛先に指定した場合に返す。
+	ErrMessagesNotSupported = errors.New("message: messages is only supported for line destinations")
+	// ErrTextWithDiscord は text と discord を両方指定した場合に返す。
+	ErrTextWithDiscord = errors.New("message: text and discord are mutually exclusive")
+	// ErrDiscordNotSupported は discord を Discord 以外の宛先に指定した場合に返す。
+	ErrDiscordNotSupported = errors.New("message: discord is only supported for discord")
+	// ErrEditNotSupported は編集・削除に対応しない宛先の投稿を対象にした場合に返す。
+	ErrEditNotSupported = errors.New("message: only discord messages can be edited or deleted")
+	// ErrEmptyTarget は編集・削除の対象IDが空の場合に返す。
+	ErrEmptyTarget = errors.New("message: target is required")
+	// ErrEmptyRecipients はマルチキャストの宛先が空の場合に返す。
+	ErrEmptyRecipients = errors.New("message: userIds is required for line-multicast")
+	// ErrTooManyRecipients はマルチキャストの宛先が MaxRecipients を超える場合に返す。
+	ErrTooManyRecipients = fmt.Errorf("message: userIds must contain at most %d ids", MaxRecipients)
+	// ErrRecipientsNotSupported は userIds をマルチキャスト以外の宛先に指定した場合に返す。
+	ErrRecipientsNotSupported = errors.New("message: userIds is only supported for line-multicast")
+	// ErrNarrowcastNotSupported は narrowcast をナローキャスト以外の宛先に指定した場合に返す。
+	ErrNarrowcastNotSupported = errors.New("message: narrowcast is only supported for line-narrowcast")
+	// ErrSendAtWithDelay は sendAt と delay を両方指定した場合に返す。
+	ErrSendAtWithDelay = errors.New("message: sendAt and delay are mutually exclusive")
+	// ErrNegativeDelay は delay が負の場合に返す。
+	ErrNegativeDelay = errors.New("message: delay must not be negative")
+	// ErrTemplateWithBody は templateId と text・messages・discord を両方指定した場合に返す。
+	ErrTemplateWithBody = errors.New("message: templateId and text, messages or discord are mutually exclusive")
+	// ErrParamsWithoutTemplate は templateId なしで params・locale を指定した場合に返す。
+	ErrParamsWithoutTemplate = errors.New("message: params and locale require templateId")
+)
+
+// 宛先。LINEの各宛先は同じサブジェクトで worker に渡し、使うAPIだけが異なる。
+const (
+	DestinationLine           = "line"
+	DestinationLineMulticast  = "line-multicast"
+	DestinationLineBroadcast  = "line-broadcast"
+	DestinationLineNarrowcast = "line-narrowcast"
+	DestinationDiscord        = "discord"
+)
+
+// MaxRecipients はマルチキャスト1件で指定できる宛先の上限。LINEの1回の上限（500件）ごとに
+// worker が分けて送る。
+const MaxRecipients = 10000
+
+// IsLine は dest がLINEの宛先（Push・マルチキャスト・ブロードキャスト・ナローキャスト）かを返す。
+func IsLine(dest string) bool {
+	switch dest {
+	case DestinationLine, DestinationLineMulticast, DestinationLineBroadcast, DestinationLineNarrowcast:
+		return true
+	}
+	return false
+}
+
+// Action は送信要求の種類。
+type Action string
+
+const (
+	// ActionSend は新規送信。エンベロープでは action を省略する。
+	ActionSend Action = ""
+	// ActionEdit は送信済みのDiscord投稿の編集。
+	ActionEdit Action = "edit"
+	// ActionDelete は送信済みのDiscord投稿の削除。
+	ActionDelete Action = "delete"
 )
 
+// Params は送信要求生成の入力。本文は Text・LineMessages・Discord のいずれか1つ。
+type Params struct {
+	// ID は NewID か IDFromKey で得たもの。
+	ID          string
+	Destination string
+	UserID      string
+	// UserIDs は line-multicast の宛先。重複は除く。
+	UserIDs []string
+	// Narrowcast は line-narrowcast の宛先と絞り込み条件。linemsg.ParseNarrowcast で検証済みのもの。
+	// nil なら友だち全員に送る。
+	Narrowcast *linemsg.Narrowcast
+	Text       string
+	// LineMessages はLINE宛の型付きメッセージ。linemsg.Parse で検証済みのもの。
+	LineMessages []linemsg.Message
+	// Discord はDiscord宛の投稿内容。discordmsg.Parse（編集は ParseEdit）で検証済みのもの。
+	Discord *discordmsg.Payload
+	// Action と TargetID は編集・削除の場合に、対象の送信要求のIDとあわせて指定する。
+	Action     Action
+	TargetID   string
+	ReceivedAt time.Time
+}
+
 // Message は送信要求を表す。
 type Message struct {
-	destination string
-	userID      string
-	text        string
-	receivedAt  time.Time
+	id           string
+	destination  string
+	userID       string
+	userIDs      []string
+	narrowcast   *linemsg.Narrowcast
+	text         string
+	lineMessages []linemsg.Message
+	discord      *discordmsg.Payload
+	action       Action
+	targetID     string
+	receivedAt   time.Time
 }
 
 // New は送信要求を生成する。
-func New(destination, userID, text string, receivedAt time.Time) (*Message, error) {
-	dest := strings.TrimSpace(destination)
+func New(p Params) (*Message, error) {
+	if strings.TrimSpace(p.ID) == "" {
+		return nil, ErrEmptyID
+	}
+	dest := strings.TrimSpace(p.Destination)
 	if dest == "" {
 		return nil, ErrEmptyDestination
 	}
-	uid := strings.TrimSpace(userID)
-	if uid == "" {
-		return nil, ErrEmptyUserID
+	uid := strings.TrimSpace(p.UserID)
+	body := strings.TrimSpace(p.Text)
+	if err := validateContent(p, dest, uid, body); err != nil {
+		return nil, err
+	}
+	uids, err := recipients(dest, p.UserIDs)
+	if err != nil {
+		return nil, err
 	}
-	body := strings.TrimSpace(text)
-	if body == "" {
-		return nil, ErrEmptyText
+	if p.Narrowcast != nil && dest != DestinationLineNarrowcast {
+		return nil, ErrNarrowcastNotSupported
 	}
-	ts := receivedAt
+	ts := p.ReceivedAt
 	if ts.IsZero() {
 		ts = time.Now().UTC()
 	} else {
 		ts = ts.UTC()
 	}
 	return &Message{
-		destination: dest,
-		userID:      uid,
-		text:        body,
-		receivedAt:  ts,
+		id:           strings.TrimSpace(p.ID),
+		destination:  dest,
+		userID:       uid,
+		userIDs:      uids,
+		narrowcast:   p.Narrowcast,
+		text:         body,
+		lineMessages: append([]linemsg.Message(nil), p.LineMessages...),
+		discord:      p.Discord,
+		action:       p.Action,
+		targetID:     strings.TrimSpace(p.TargetID),
+		receivedAt:   ts,
 	}, nil
 }
 
+func validateContent(p Params, dest, uid, body string) error {
+	switch p.Action {
+	case ActionEdit, ActionDelete:
+		if dest != "discord" {
+			return ErrEditNotSupported
+		}
+		if strings.TrimSpace(p.TargetID) == "" {
+			return ErrEmptyTarget
+		}
+		if p.Action == ActionDelete {
+			return nil
+		}
+	case ActionSend:
+		// マルチキャスト・ブロードキャスト・ナローキャストは userId を使わない。
+		if uid == "" && (dest == DestinationLine || dest == DestinationDiscord) {
+			return ErrEmptyUserID
+		}
+	default:
+		return fmt.Errorf("message: unsupported action %q", p.Action)
+	}
+	switch {
+	case len(p.LineMessages) > 0 && body != "":
+		return ErrTextWithMessages
+	case len(p.LineMessages) > 0 && !IsLine(dest):
+		return ErrMessagesNotSupported
+	case p.Discord != nil && body != "":
+		return ErrTextWithDiscord
+	case p.Discord != nil && dest != "discord":
+		return ErrDiscordNotSupported
+	case len(p.LineMessages) == 0 && p.Discord == nil && body == "":
+		return ErrEmptyText
+	}
+	return nil
+}
+
+// recipients はマルチキャストの宛先を検証し、空白と重複を除いて返す。
+func recipients(dest string, ids []string) ([]string, error) {
+	if dest != DestinationLineMulticast {
+		if len(ids) > 0 {
+			return nil, ErrRecipientsNotSupported
+		}
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	if len(out) == 0 {
+		return nil, ErrEmptyRecipients
+	}
+	if len(out) > MaxRecipients {
+		return nil, ErrTooManyRecipients
+	}
+	return out, nil
+}
+
 // NowUTC は現在時刻をUTCで返す。
 func NowUTC() time.Time {
 	return time.Now().UTC()
 }
 
+// ID はメッセージIDを返す。
+func (m *Message) ID() string { return m.id }
+
 // Destination は宛先を返す。
 func (m *Message) Destination() string { return m.destination }
 
 // UserID はユーザーIDを返す。
 func (m *Message) UserID() string { return m.userID }
 
-// Text は本文を返す。
+// UserIDs はマルチキャストの宛先を返す。
+func (m *Message) UserIDs() []string { return append([]string(nil), m.userIDs...) }
+
+// Narrowcast はナローキャストの宛先と絞り込み条件を返す。
+func (m *Message) Narrowcast() *linemsg.Narrowcast { return m.narrowcast }
+
+// Text は本文を返す。LineMessages を指定した要求では空。
 func (m *Message) Text() string { return m.text }
 
+// LineMessages はLINE宛の型付きメッセージを返す。Text で指定した要求では nil。
+func (m *Message) LineMessages() []linemsg.Message {
+	return append([]linemsg.Message(nil), m.lineMessages...)
+}
+
+// Discord はDiscord宛の投稿内容を返す。Text で指定した要求では nil。
+func (m *Message) Discord() *discordmsg.Payload { return m.discord }
+
+// Action は送信要求の種類を返す。
+func (m *Message) Action() Action { return m.action }
+
+// TargetID は編集・削除の対象の送信要求のIDを返す。
+func (m *Message) TargetID() string { return m.targetID }
+
 // ReceivedAt は受信時刻を返す。
 func (m *Message) ReceivedAt() time.Time { return m.receivedAt }
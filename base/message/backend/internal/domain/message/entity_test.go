@@ -1,8 +1,14 @@
 package message
 
 import (
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 )
 
 // Message生成のテーブル駆動テスト。
@@ -14,21 +20,48 @@ func TestMessageNew(t *testing.T) {
 		name      string
 		dest      string
 		user      string
+		userIDs   []string
+		narrow    *linemsg.Narrowcast
 		text      string
+		messages  []linemsg.Message
+		discord   *discordmsg.Payload
+		action    Action
+		target    string
 		ts        time.Time
 		wantError error
 	}{
 		{name: "正常", dest: "line", user: "U1", text: "hi", ts: now},
+		{name: "ID空でエラー", dest: "line", user: "U1", text: "hi", ts: now, wantError: ErrEmptyID},
 		{name: "宛先空でエラー", user: "U1", text: "hi", ts: now, wantError: ErrEmptyDestination},
 		{name: "user空でエラー", dest: "line", text: "hi", ts: now, wantError: ErrEmptyUserID},
 		{name: "本文空でエラー", dest: "line", user: "U1", text: " ", ts: now, wantError: ErrEmptyText},
 		{name: "時刻ゼロならUTCに補正", dest: "line", user: "U1", text: "hi"},
+		{name: "LINEの型付きメッセージ", dest: "line", user: "U1", messages: []linemsg.Message{linemsg.Sticker{PackageID: "1", StickerID: "2"}}, ts: now},
+		{name: "本文と型付きメッセージの両方でエラー", dest: "line", user: "U1", text: "hi", messages: []linemsg.Message{linemsg.Text{Text: "hi"}}, ts: now, wantError: ErrTextWithMessages},
+		{name: "LINE以外に型付きメッセージでエラー", dest: "discord", user: "U1", messages: []linemsg.Message{linemsg.Text{Text: "hi"}}, ts: now, wantError: ErrMessagesNotSupported},
+		{name: "Discordの投稿内容", dest: "discord", user: "ops", discord: &discordmsg.Payload{Content: "hi"}, ts: now},
+		{name: "Discord以外に投稿内容でエラー", dest: "line", user: "U1", discord: &discordmsg.Payload{Content: "hi"}, ts: now, wantError: ErrDiscordNotSupported},
+		{name: "本文と投稿内容の両方でエラー", dest: "discord", user: "ops", text: "hi", discord: &discordmsg.Payload{Content: "hi"}, ts: now, wantError: ErrTextWithDiscord},
+		{name: "編集はuser不要", dest: "discord", text: "hi", action: ActionEdit, target: "t1", ts: now},
+		{name: "削除は本文不要", dest: "discord", action: ActionDelete, target: "t1", ts: now},
+		{name: "LINEの編集でエラー", dest: "line", text: "hi", action: ActionEdit, target: "t1", ts: now, wantError: ErrEditNotSupported},
+		{name: "対象なしの削除でエラー", dest: "discord", action: ActionDelete, ts: now, wantError: ErrEmptyTarget},
+		{name: "マルチキャスト", dest: DestinationLineMulticast, userIDs: []string{"U1", "U2"}, text: "hi", ts: now},
+		{name: "マルチキャストの宛先なしでエラー", dest: DestinationLineMulticast, userIDs: []string{" "}, text: "hi", ts: now, wantError: ErrEmptyRecipients},
+		{name: "Push に userIds でエラー", dest: "line", user: "U1", userIDs: []string{"U2"}, text: "hi", ts: now, wantError: ErrRecipientsNotSupported},
+		{name: "ブロードキャストはuser不要", dest: DestinationLineBroadcast, messages: []linemsg.Message{linemsg.Text{Text: "hi"}}, ts: now},
+		{name: "ナローキャスト", dest: DestinationLineNarrowcast, narrow: &linemsg.Narrowcast{Recipient: &linemsg.Recipient{Type: "audience", AudienceGroupID: 1}}, text: "hi", ts: now},
+		{name: "ナローキャスト以外に条件でエラー", dest: DestinationLineBroadcast, narrow: &linemsg.Narrowcast{}, text: "hi", ts: now, wantError: ErrNarrowcastNotSupported},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			msg, err := New(tt.dest, tt.user, tt.text, tt.ts)
+			id := "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+			if tt.wantError == ErrEmptyID {
+				id = ""
+			}
+			msg, err := New(Params{ID: id, Destination: tt.dest, UserID: tt.user, UserIDs: tt.userIDs, Narrowcast: tt.narrow, Text: tt.text, LineMessages: tt.messages, Discord: tt.discord, Action: tt.action, TargetID: tt.target, ReceivedAt: tt.ts})
 			if tt.wantError != nil {
 				if err != tt.wantError {
 					t.Fatalf("want %v, got %v", tt.wantError, err)
@@ -38,14 +71,17 @@ func TestMessageNew(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
+			if msg.ID() != id {
+				t.Fatalf("id mismatch")
+			}
 			if msg.Destination() != tt.dest {
 				t.Fatalf("dest mismatch")
 			}
 			if msg.UserID() != tt.user {
 				t.Fatalf("user mismatch")
 			}
-			if msg.Text() != tt.text {
-				t.Fatalf("text mismatch")
+			if msg.Text() != tt.text || len(msg.LineMessages()) != len(tt.messages) || msg.Discord() != tt.discord || msg.Action() != tt.action || msg.TargetID() != tt.target || len(msg.UserIDs()) != len(tt.userIDs) || msg.Narrowcast() != tt.narrow {
+				t.Fatalf("content mismatch")
 			}
 			if msg.ReceivedAt().IsZero() {
 				t.Fatalf("expected non zero time")
@@ -56,3 +92,91 @@ func TestMessageNew(t *testing.T) {
 		})
 	}
 }
+
+// 冪等キーから導くIDが決定的で、UUIDの形式になることを確認する。
+func TestIDFromKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		key       string
+		wantError bool
+	}{
+		{name: "通常のキー", key: "order-123:reminder"},
+		{name: "最大長", key: strings.Repeat("k", MaxIdempotencyKeyLength)},
+		{name: "空はエラー", wantError: true},
+		{name: "長すぎる", key: strings.Repeat("k", MaxIdempotencyKeyLength+1), wantError: true},
+		{name: "制御文字", key: "a\nb", wantError: true},
+		{name: "非ASCII", key: "注文1", wantError: true},
+	}
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			id, err := IDFromKey(tt.key)
+			if tt.wantError {
+				if !errors.Is(err, ErrInvalidIdempotencyKey) {
+					t.Fatalf("want ErrInvalidIdempotencyKey, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			again, _ := IDFromKey(tt.key)
+			if id != again || !uuidPattern.MatchString(id) {
+				t.Fatalf("id=%s again=%s", id, again)
+			}
+			other, _ := IDFromKey(tt.key + "x")
+			if other == id {
+				t.Fatalf("different keys produced the same id")
+			}
+		})
+	}
+}
+
+func TestNewID(t *testing.T) {
+	t.Parallel()
+	a, b := NewID(), NewID()
+	if a == b || !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(a) {
+		t.Fatalf("unexpected ids: %s %s", a, b)
+	}
+	if !ValidID(a) || ValidID(strings.ToUpper(a)) || ValidID("../"+a[3:]) || ValidID("") {
+		t.Fatalf("ValidID mismatch for %s", a)
+	}
+}
+
+// 状態遷移の順序が前後しても終端の状態を上書きしないことを確認する。
+func TestStatusApply(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		steps       []State
+		wantState   State
+		wantHistory int
+	}{
+		{name: "正常な流れ", steps: []State{StateQueued, StateSending, StateDelivered}, wantState: StateDelivered, wantHistory: 3},
+		{name: "再送を経て配送不能", steps: []State{StateQueued, StateSending, StateFailed, StateSending, StateDeadLettered}, wantState: StateDeadLettered, wantHistory: 5},
+		{name: "workerが先に記録してもqueuedで戻らない", steps: []State{StateSending, StateQueued}, wantState: StateSending, wantHistory: 1},
+		{name: "配送済みの後の記録は無視", steps: []State{StateSending, StateDelivered, StateQueued, StateFailed}, wantState: StateDelivered, wantHistory: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			st := Status{MessageID: "m1"}
+			for i, state := range tt.steps {
+				st, _ = st.Apply(state, "", i, t0.Add(time.Duration(i)*time.Second))
+			}
+			if st.State != tt.wantState || len(st.History) != tt.wantHistory {
+				t.Fatalf("state=%s history=%d", st.State, len(st.History))
+			}
+			if !st.CreatedAt.Equal(t0) || st.UpdatedAt.Before(st.CreatedAt) {
+				t.Fatalf("createdAt=%s updatedAt=%s", st.CreatedAt, st.UpdatedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package message
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+)
+
+// MaxIdempotencyKeyLength は冪等キーの最大長。
+const MaxIdempotencyKeyLength = 255
+
+// ErrInvalidIdempotencyKey は冪等キーが空・長すぎる・表示可能なASCII以外を含む場合に返す。
+var ErrInvalidIdempotencyKey = errors.New("message: idempotency key must be 1-255 printable ASCII characters")
+
+// idNamespace は冪等キーからメッセージIDを導くUUIDv5の名前空間。値を変えると既存のキーとIDの対応が崩れる。
+var idNamespace = [16]byte{0x6f, 0x0b, 0x3e, 0x52, 0x9c, 0x41, 0x4d, 0x7a, 0x8e, 0x15, 0x2a, 0xc9, 0x3b, 0x60, 0xd4, 0x71}
+
+// NewID はランダムなメッセージID（UUIDv4）を返す。
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("message: read random: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return formatUUID(b)
+}
+
+// IDFromKey は冪等キーから決まるメッセージID（UUIDv5）を返す。同じキーには常に同じIDを返すため、
+// 再送された要求にも最初の要求と同じIDを返せる。
+func IDFromKey(key string) (string, error) {
+	if len(key) == 0 || len(key) > MaxIdempotencyKeyLength {
+		return "", ErrInvalidIdempotencyKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return "", ErrInvalidIdempotencyKey
+		}
+	}
+	h := sha1.New()
+	h.Write(idNamespace[:])
+	h.Write([]byte(key))
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return formatUUID(b), nil
+}
+
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ValidID は id が NewID・IDFromKey の返す形式（小文字16進のUUID）かを返す。
+func ValidID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
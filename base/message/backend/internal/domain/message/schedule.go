@@ -0,0 +1,25 @@
+package message
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Scheduled は配送予約中のメッセージ1件。ingress が作った worker 宛のエンベロープをそのまま持ち、
+// SendAt になったら scheduler が Subject へ流す。
+type Scheduled struct {
+	MessageID   string    `json:"messageId"`
+	Destination string    `json:"destination"`
+	Subject     string    `json:"subject"`
+	SendAt      time.Time `json:"sendAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// ReleasingAt は scheduler が送り出し始めた時刻。設定された予約は取り消せない。
+	ReleasingAt *time.Time `json:"releasingAt,omitempty"`
+	// Body は worker へ渡すエンベロープ。
+	Body json.RawMessage `json:"body"`
+}
+
+// Due は at の時点で送る時刻になっているかを返す。
+func (s Scheduled) Due(at time.Time) bool {
+	return !s.SendAt.After(at)
+}
@@ -0,0 +1,80 @@
+package message
+
+import "time"
+
+// State は配送状態。
+type State string
+
+const (
+	// StateScheduled は予約され、送る時刻を待っている。
+	StateScheduled State = "scheduled"
+	// StateQueued はストリームに保存され、worker の処理待ち。
+	StateQueued State = "queued"
+	// StateSending は worker が送信先へ送っている最中。
+	StateSending State = "sending"
+	// StateDelivered は送信先が受け付けた。
+	StateDelivered State = "delivered"
+	// StateFailed は送信に失敗し、再送を待っている。
+	StateFailed State = "failed"
+	// StateDeadLettered は再送を諦めて配送不能キューへ移した。
+	StateDeadLettered State = "dead_lettered"
+	// StateCanceled は予約が送る前に取り消された。
+	StateCanceled State = "canceled"
+)
+
+// Terminal はこれ以上状態が変わらないかを返す。
+func (s State) Terminal() bool {
+	return s == StateDelivered || s == StateDeadLettered || s == StateCanceled
+}
+
+// Transition は状態の変化1回分。
+type Transition struct {
+	State  State     `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// RemoteRef は送信先が振ったメッセージの識別子。Discord投稿の編集・削除に使う。
+type RemoteRef struct {
+	MessageID string `json:"messageId"`
+	// ThreadID はスレッド内の投稿の場合のスレッドID。
+	ThreadID string `json:"threadId,omitempty"`
+}
+
+// Status はメッセージ1件の配送状態と履歴。
+type Status struct {
+	MessageID   string       `json:"messageId"`
+	Destination string       `json:"destination,omitempty"`
+	State       State        `json:"state"`
+	Reason      string       `json:"reason,omitempty"`
+	Attempts    int          `json:"attempts"`
+	Remote      *RemoteRef   `json:"remote,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+	History     []Transition `json:"history"`
+}
+
+// Apply は状態を state に進めた Status を返す。ingress と worker の記録は前後しうるため、
+// 終端の状態からの変化と、処理が始まった後の scheduled・queued は無視して false を返す。
+// 予約中からは queued に進める。
+// attempt は worker の配送回数で、記録済みより大きければ Attempts を更新する。
+func (s Status) Apply(state State, reason string, attempt int, at time.Time) (Status, bool) {
+	switch {
+	case s.State.Terminal(),
+		state == StateScheduled && s.State != "",
+		state == StateQueued && s.State != "" && s.State != StateScheduled:
+		return s, false
+	}
+	at = at.UTC()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = at
+	}
+	if attempt > s.Attempts {
+		s.Attempts = attempt
+	}
+	s.State = state
+	s.Reason = reason
+	s.UpdatedAt = at
+	s.History = append(append([]Transition(nil), s.History...), Transition{State: state, Reason: reason, At: at})
+	return s, true
+}
@@ -0,0 +1,417 @@
+package msgtemplate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
+)
+
+var (
+	// ErrInvalidTemplate はテナント設定のテンプレートが不正な場合に返す。
+	ErrInvalidTemplate = errors.New("msgtemplate: invalid template")
+	// ErrNotFound は templateId のテンプレートが定義されていない場合に返す。
+	ErrNotFound = errors.New("msgtemplate: template not found")
+	// ErrNoBody はテンプレートに宛先で使える本文がない場合に返す。
+	ErrNoBody = errors.New("msgtemplate: template has no body for the destination")
+	// ErrRender は params が足りないなどで展開できなかった場合に返す。
+	ErrRender = errors.New("msgtemplate: render failed")
+)
+
+// Definition はテナント設定の1テンプレート。ロケールごとに本文を持つ。
+type Definition struct {
+	// DefaultLocale は要求のロケールに合う本文がないときに使うロケール。ロケールが1つなら省略できる。
+	DefaultLocale string             `yaml:"defaultLocale"`
+	Locales       map[string]Variant `yaml:"locales"`
+}
+
+// Variant は1ロケール分の本文。宛先に合う型付きの本文があればそれを、なければ Text を使う。
+// 文字列はすべて text/template として params で展開する。型付きの本文は構造を保ったまま
+// 文字列の値だけを展開するので、params にJSONの記号が含まれていても壊れない。
+type Variant struct {
+	// Text はどの宛先でも使えるテキストの本文。
+	Text string `yaml:"text"`
+	// LineMessages はLINE宛の型付きメッセージ（LINEの形式、1〜5件）。Flex などに使う。
+	LineMessages []any `yaml:"lineMessages"`
+	// Discord はDiscord宛の投稿内容（content・embeds など /send の discord と同じ形式）。
+	Discord map[string]any `yaml:"discord"`
+}
+
+// Channel は本文を選ぶための宛先の種類。LINEの各宛先は ChannelLine にまとめる。
+type Channel string
+
+const (
+	ChannelLine    Channel = "line"
+	ChannelDiscord Channel = "discord"
+)
+
+// Rendered は展開した本文。Text・Messages・Discord のいずれか1つだけが入る。
+type Rendered struct {
+	Text     string
+	Messages []json.RawMessage
+	Discord  json.RawMessage
+}
+
+// Set はテナントのテンプレートを読み込み時に解析したもの。
+type Set struct {
+	templates map[string]compiledTemplate
+}
+
+type compiledTemplate struct {
+	defaultLocale string
+	locales       map[string]compiledVariant
+}
+
+type compiledVariant struct {
+	text         renderer
+	lineMessages renderer
+	discord      renderer
+}
+
+// renderer は params で値を展開する。文字列以外の値はそのまま返す。
+type renderer func(params map[string]any) (any, error)
+
+// Compile はテンプレートの定義を検証して解析する。テンプレートの構文、ロケールの指定、
+// LINE宛の件数と type の有無を確かめ、型付きの本文は仮の params で展開して送信要求と同じ検証にかける。
+// 実際の params で展開した本文も送るときに改めて検証する。
+func Compile(defs map[string]Definition) (*Set, error) {
+	set := &Set{templates: make(map[string]compiledTemplate, len(defs))}
+	for id, def := range defs {
+		if strings.TrimSpace(id) == "" || strings.ContainsAny(id, " \t\r\n") {
+			return nil, fmt.Errorf("%w: template id %q must not be empty or contain whitespace", ErrInvalidTemplate, id)
+		}
+		t, err := compileDefinition(id, def)
+		if err != nil {
+			return nil, err
+		}
+		set.templates[id] = t
+	}
+	return set, nil
+}
+
+func compileDefinition(id string, def Definition) (compiledTemplate, error) {
+	if len(def.Locales) == 0 {
+		return compiledTemplate{}, fmt.Errorf("%w: %s: locales is required", ErrInvalidTemplate, id)
+	}
+	t := compiledTemplate{defaultLocale: def.DefaultLocale, locales: make(map[string]compiledVariant, len(def.Locales))}
+	if t.defaultLocale == "" {
+		if len(def.Locales) > 1 {
+			return compiledTemplate{}, fmt.Errorf("%w: %s: defaultLocale is required when there are several locales", ErrInvalidTemplate, id)
+		}
+		for locale := range def.Locales {
+			t.defaultLocale = locale
+		}
+	}
+	if _, ok := def.Locales[t.defaultLocale]; !ok {
+		return compiledTemplate{}, fmt.Errorf("%w: %s: defaultLocale %q is not in locales", ErrInvalidTemplate, id, t.defaultLocale)
+	}
+	for locale, v := range def.Locales {
+		key := normalizeLocale(locale)
+		if _, dup := t.locales[key]; dup || key == "" {
+			return compiledTemplate{}, fmt.Errorf("%w: %s: locale %q is empty or duplicated", ErrInvalidTemplate, id, locale)
+		}
+		cv, err := compileVariant(id+"."+locale, v)
+		if err != nil {
+			return compiledTemplate{}, err
+		}
+		t.locales[key] = cv
+	}
+	t.defaultLocale = normalizeLocale(t.defaultLocale)
+	return t, nil
+}
+
+func compileVariant(name string, v Variant) (compiledVariant, error) {
+	if strings.TrimSpace(v.Text) == "" && len(v.LineMessages) == 0 && v.Discord == nil {
+		return compiledVariant{}, fmt.Errorf("%w: %s: text, lineMessages or discord is required", ErrInvalidTemplate, name)
+	}
+	var cv compiledVariant
+	var err error
+	if strings.TrimSpace(v.Text) != "" {
+		if cv.text, err = compileValue(name+".text", v.Text); err != nil {
+			return compiledVariant{}, err
+		}
+	}
+	if len(v.LineMessages) > 0 {
+		if len(v.LineMessages) > linemsg.MaxMessages {
+			return compiledVariant{}, fmt.Errorf("%w: %s.lineMessages must contain 1-%d items", ErrInvalidTemplate, name, linemsg.MaxMessages)
+		}
+		for i, m := range v.LineMessages {
+			obj, ok := m.(map[string]any)
+			if typ, _ := obj["type"].(string); !ok || typ == "" {
+				return compiledVariant{}, fmt.Errorf("%w: %s.lineMessages[%d] needs type", ErrInvalidTemplate, name, i)
+			}
+		}
+		if cv.lineMessages, err = compileValue(name+".lineMessages", v.LineMessages); err != nil {
+			return compiledVariant{}, err
+		}
+	}
+	if v.Discord != nil {
+		if cv.discord, err = compileValue(name+".discord", v.Discord); err != nil {
+			return compiledVariant{}, err
+		}
+	}
+	if err := checkVariant(name, v); err != nil {
+		return compiledVariant{}, err
+	}
+	return cv, nil
+}
+
+// placeholders は読み込み時の検証で params に入れる仮の値。params を入れる位置によって通る値が
+// 違う（本文は空だと通らず、URLは http(s) でないと通らない）ので、どれかで通れば正しいとみなす。
+var placeholders = []string{"https://example.com", ""}
+
+// checkVariant は型付きの本文を仮の params で展開し、送信要求と同じ検証にかける。
+// 入れ子の参照や range など仮の値では展開できない本文は、送るときの検証に任せる。
+func checkVariant(name string, v Variant) error {
+	if len(v.LineMessages) > 0 {
+		if err := checkValue(v.LineMessages, func(r renderer, params map[string]any) error {
+			messages, err := renderLine(r, params)
+			if err != nil {
+				return err
+			}
+			_, err = linemsg.Parse(messages)
+			return err
+		}); err != nil {
+			return fmt.Errorf("%w: %s.lineMessages: %v", ErrInvalidTemplate, name, err)
+		}
+	}
+	if v.Discord != nil {
+		if err := checkValue(v.Discord, func(r renderer, params map[string]any) error {
+			raw, err := renderJSON(r, params)
+			if err != nil {
+				return err
+			}
+			_, err = discordmsg.Parse(raw)
+			return err
+		}); err != nil {
+			return fmt.Errorf("%w: %s.discord: %v", ErrInvalidTemplate, name, err)
+		}
+	}
+	return nil
+}
+
+// checkValue は参照しているキーに placeholders の値を順に入れて展開し、validate に通るかを確かめる。
+func checkValue(v any, validate func(r renderer, params map[string]any) error) error {
+	keys := map[string]bool{}
+	r, err := compileValueOption("", v, "missingkey=zero", keys)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, p := range placeholders {
+		params := make(map[string]any, len(keys))
+		for k := range keys {
+			params[k] = p
+		}
+		err := validate(r, params)
+		if err == nil || errors.Is(err, ErrRender) {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// compileValue はYAMLから読んだ値の文字列をすべてテンプレートとして解析する。
+// params にないキーを参照したら展開時にエラーにする。
+func compileValue(path string, v any) (renderer, error) {
+	return compileValueOption(path, v, "missingkey=error", nil)
+}
+
+// compileValueOption は option を付けて compileValue と同じように解析する。
+// keys が nil でなければ、テンプレートが参照している params のキーを集める。
+func compileValueOption(path string, v any, option string, keys map[string]bool) (renderer, error) {
+	switch v := v.(type) {
+	case string:
+		t, err := template.New(path).Option(option).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		if keys != nil && t.Tree != nil {
+			collectKeys(t.Tree.Root, keys)
+		}
+		return func(params map[string]any) (any, error) {
+			var b strings.Builder
+			if err := t.Execute(&b, params); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrRender, err)
+			}
+			return b.String(), nil
+		}, nil
+	case map[string]any:
+		fields := make(map[string]renderer, len(v))
+		for k, e := range v {
+			r, err := compileValueOption(path+"."+k, e, option, keys)
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = r
+		}
+		return func(params map[string]any) (any, error) {
+			out := make(map[string]any, len(fields))
+			for k, r := range fields {
+				x, err := r(params)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = x
+			}
+			return out, nil
+		}, nil
+	case []any:
+		items := make([]renderer, len(v))
+		for i, e := range v {
+			r, err := compileValueOption(fmt.Sprintf("%s[%d]", path, i), e, option, keys)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = r
+		}
+		return func(params map[string]any) (any, error) {
+			out := make([]any, len(items))
+			for i, r := range items {
+				x, err := r(params)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = x
+			}
+			return out, nil
+		}, nil
+	case nil, bool, int, int64, uint64, float64:
+		return func(map[string]any) (any, error) { return v, nil }, nil
+	default:
+		return nil, fmt.Errorf("%w: %s: unsupported value %T", ErrInvalidTemplate, path, v)
+	}
+}
+
+// collectKeys はテンプレートの構文木から {{.key}} の key を集める。
+func collectKeys(node parse.Node, keys map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectKeys(c, keys)
+		}
+	case *parse.ActionNode:
+		collectKeys(n.Pipe, keys)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collectKeys(c, keys)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			collectKeys(a, keys)
+		}
+	case *parse.FieldNode:
+		keys[n.Ident[0]] = true
+	case *parse.ChainNode:
+		collectKeys(n.Node, keys)
+	case *parse.IfNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.RangeNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.WithNode:
+		collectKeys(&n.BranchNode, keys)
+	case *parse.BranchNode:
+		collectKeys(n.Pipe, keys)
+		collectKeys(n.List, keys)
+		collectKeys(n.ElseList, keys)
+	}
+}
+
+// renderLine はLINE宛の本文を展開し、1件ずつJSONにする。
+func renderLine(r renderer, params map[string]any) ([]json.RawMessage, error) {
+	out, err := r(params)
+	if err != nil {
+		return nil, err
+	}
+	var messages []json.RawMessage
+	for _, m := range out.([]any) {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRender, err)
+		}
+		messages = append(messages, b)
+	}
+	return messages, nil
+}
+
+// renderJSON は本文を展開してJSONにする。
+func renderJSON(r renderer, params map[string]any) (json.RawMessage, error) {
+	out, err := r(params)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRender, err)
+	}
+	return b, nil
+}
+
+// Render は id のテンプレートを locale と宛先の種類に合う本文で展開する。locale は完全一致、
+// 言語部分（ja-JP なら ja）、既定のロケールの順に探す。
+func (s *Set) Render(id, locale string, ch Channel, params map[string]any) (Rendered, error) {
+	if s == nil {
+		return Rendered{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	t, ok := s.templates[id]
+	if !ok {
+		return Rendered{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	v := t.variant(locale)
+	if params == nil {
+		params = map[string]any{}
+	}
+
+	switch {
+	case ch == ChannelLine && v.lineMessages != nil:
+		messages, err := renderLine(v.lineMessages, params)
+		if err != nil {
+			return Rendered{}, err
+		}
+		return Rendered{Messages: messages}, nil
+	case ch == ChannelDiscord && v.discord != nil:
+		b, err := renderJSON(v.discord, params)
+		if err != nil {
+			return Rendered{}, err
+		}
+		return Rendered{Discord: b}, nil
+	case v.text != nil:
+		out, err := v.text(params)
+		if err != nil {
+			return Rendered{}, err
+		}
+		return Rendered{Text: out.(string)}, nil
+	default:
+		return Rendered{}, fmt.Errorf("%w: %s for %s", ErrNoBody, id, ch)
+	}
+}
+
+func (t compiledTemplate) variant(locale string) compiledVariant {
+	locale = normalizeLocale(locale)
+	if v, ok := t.locales[locale]; ok {
+		return v
+	}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		if v, ok := t.locales[lang]; ok {
+			return v
+		}
+	}
+	return t.locales[t.defaultLocale]
+}
+
+// normalizeLocale は ja_JP・JA-jp などを ja-jp にそろえる。
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
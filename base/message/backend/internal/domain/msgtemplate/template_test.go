@@ -0,0 +1,166 @@
+package msgtemplate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testDefs = `
+order-shipped:
+  defaultLocale: ja
+  locales:
+    ja:
+      text: "{{.name}}さん、ご注文 {{.orderId}} を発送しました。"
+      lineMessages:
+        - type: flex
+          altText: "発送のお知らせ {{.orderId}}"
+          contents:
+            type: bubble
+            body:
+              type: box
+              layout: vertical
+              contents:
+                - type: text
+                  text: "{{.name}}さん"
+                  size: xl
+      discord:
+        embeds:
+          - title: "発送 {{.orderId}}"
+            color: 65280
+    en:
+      text: "Hi {{.name}}, order {{.orderId}} has shipped."
+line-only:
+  locales:
+    ja:
+      lineMessages:
+        - type: sticker
+          packageId: "446"
+          stickerId: "1988"
+`
+
+func compileYAML(t *testing.T, src string) (*Set, error) {
+	t.Helper()
+	var defs map[string]Definition
+	if err := yaml.Unmarshal([]byte(src), &defs); err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	return Compile(defs)
+}
+
+// ロケールと宛先の種類に合う本文を選び、文字列の値だけを展開することを確認する。
+func TestSet_Render(t *testing.T) {
+	t.Parallel()
+
+	set, err := compileYAML(t, testDefs)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	params := map[string]any{"name": `山田 "太郎"`, "orderId": "A-1"}
+	tests := []struct {
+		name    string
+		id      string
+		locale  string
+		ch      Channel
+		params  map[string]any
+		want    string
+		wantErr error
+	}{
+		{name: "LINEはFlex", id: "order-shipped", locale: "ja", ch: ChannelLine, params: params, want: `{"altText":"発送のお知らせ A-1","contents":{"body":{"contents":[{"size":"xl","text":"山田 \"太郎\"さん","type":"text"}],"layout":"vertical","type":"box"},"type":"bubble"},"type":"flex"}`},
+		{name: "Discordは埋め込み", id: "order-shipped", locale: "ja", ch: ChannelDiscord, params: params, want: `{"embeds":[{"color":65280,"title":"発送 A-1"}]}`},
+		{name: "型付きの本文がなければテキスト", id: "order-shipped", locale: "en", ch: ChannelDiscord, params: params, want: `Hi 山田 "太郎", order A-1 has shipped.`},
+		{name: "地域付きは言語で探す", id: "order-shipped", locale: "en_US", ch: ChannelLine, params: params, want: `Hi 山田 "太郎", order A-1 has shipped.`},
+		{name: "未定義のロケールは既定", id: "order-shipped", locale: "fr", ch: ChannelLine, params: params, want: `{"altText":"発送のお知らせ A-1"`},
+		{name: "未定義のテンプレート", id: "missing", ch: ChannelLine, wantErr: ErrNotFound},
+		{name: "paramsが足りない", id: "order-shipped", locale: "en", ch: ChannelLine, params: map[string]any{"name": "x"}, wantErr: ErrRender},
+		{name: "宛先に使える本文がない", id: "line-only", ch: ChannelDiscord, wantErr: ErrNoBody},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := set.Render(tt.id, tt.locale, tt.ch, tt.params)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var body string
+			switch {
+			case len(got.Messages) > 0:
+				body = string(got.Messages[0])
+			case got.Discord != nil:
+				body = string(got.Discord)
+			default:
+				body = got.Text
+			}
+			if !strings.HasPrefix(body, tt.want) {
+				t.Fatalf("body=%s want=%s", body, tt.want)
+			}
+		})
+	}
+}
+
+// 読み込み時に不正な定義をエラーにすることを確認する。
+func TestCompile_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "構文エラー", src: "a:\n  locales:\n    ja:\n      text: \"{{.name\"\n", wantErr: "unclosed action"},
+		{name: "ロケールなし", src: "a:\n  locales: {}\n", wantErr: "locales is required"},
+		{name: "既定のロケールが必要", src: "a:\n  locales:\n    ja: {text: x}\n    en: {text: y}\n", wantErr: "defaultLocale is required"},
+		{name: "既定のロケールが未定義", src: "a:\n  defaultLocale: fr\n  locales:\n    ja: {text: x}\n", wantErr: `defaultLocale "fr"`},
+		{name: "本文なし", src: "a:\n  locales:\n    ja: {}\n", wantErr: "text, lineMessages or discord is required"},
+		{name: "typeのないLINEメッセージ", src: "a:\n  locales:\n    ja:\n      lineMessages:\n        - text: x\n", wantErr: "needs type"},
+		{name: "LINEメッセージが6件", src: "a:\n  locales:\n    ja:\n      lineMessages: [{type: text, text: a}, {type: text, text: a}, {type: text, text: a}, {type: text, text: a}, {type: text, text: a}, {type: text, text: a}]\n", wantErr: "1-5 items"},
+		{name: "ロケールの重複", src: "a:\n  defaultLocale: ja\n  locales:\n    ja: {text: x}\n    JA: {text: y}\n", wantErr: "duplicated"},
+		{name: "IDに空白", src: "\"a b\":\n  locales:\n    ja: {text: x}\n", wantErr: "whitespace"},
+		{name: "Flexの形式が不正", src: "a:\n  locales:\n    ja:\n      lineMessages:\n        - type: flex\n          altText: \"{{.name}}\"\n          contents: {type: box, layout: vertical, contents: []}\n", wantErr: "a.ja.lineMessages"},
+		{name: "Discordの埋め込みが不正", src: "a:\n  locales:\n    ja:\n      discord:\n        embeds:\n          - title: \"{{.name}}\"\n            colour: 1\n", wantErr: "a.ja.discord"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := compileYAML(t, tt.src)
+			if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err=%v want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// params を入れる位置に仮の値で通る本文や、仮の値では展開できない本文は読み込み時に拒まない。
+func TestCompile_Placeholders(t *testing.T) {
+	t.Parallel()
+
+	src := `
+image:
+  locales:
+    ja:
+      lineMessages:
+        - type: image
+          originalContentUrl: "{{.url}}"
+          previewImageUrl: "{{.url}}"
+      discord:
+        content: "{{.body}}"
+nested:
+  locales:
+    ja:
+      discord:
+        content: "{{.user.name}}"
+`
+	if _, err := compileYAML(t, src); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+}
@@ -4,14 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
 )
 
-// Sender はDiscord Webhookへメッセージを送信するポート実装。
+// Sender はDiscord Webhookへ投稿・編集・削除するポート実装。
 type Sender interface {
-	Send(text string) error
+	// Send は投稿し、Discordが振ったメッセージIDを返す。スレッドへの投稿ならスレッドIDも返す。
+	Send(p discordmsg.Payload) (message.RemoteRef, error)
+	// Edit は投稿の本文と埋め込みを置き換える。
+	Edit(ref message.RemoteRef, p discordmsg.Payload) error
+	// Delete は投稿を削除する。既に削除済みなら成功とする。
+	Delete(ref message.RemoteRef) error
 }
 
 type sender struct {
@@ -31,38 +44,207 @@ func NewSender(webhookURL, username, avatarURL string, timeout time.Duration) Se
 	}
 }
 
-func (s *sender) Send(text string) error {
-	payload := map[string]any{
-		"content": text,
-		"allowed_mentions": map[string]any{
-			"parse": []string{},
-		},
-	}
-	if s.username != "" {
-		payload["username"] = s.username
+// allowedMentions は本文中のメンションを通知しない設定。
+var allowedMentions = map[string]any{"parse": []string{}}
+
+type attachmentRef struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+func (s *sender) Send(p discordmsg.Payload) (message.RemoteRef, error) {
+	payload := struct {
+		Content         string             `json:"content,omitempty"`
+		Username        string             `json:"username,omitempty"`
+		AvatarURL       string             `json:"avatar_url,omitempty"`
+		Embeds          []discordmsg.Embed `json:"embeds,omitempty"`
+		ThreadName      string             `json:"thread_name,omitempty"`
+		Attachments     []attachmentRef    `json:"attachments,omitempty"`
+		AllowedMentions map[string]any     `json:"allowed_mentions"`
+	}{
+		Content:         p.Content,
+		Username:        s.username,
+		AvatarURL:       s.avatarURL,
+		Embeds:          p.Embeds,
+		ThreadName:      p.ThreadName,
+		AllowedMentions: allowedMentions,
 	}
-	if s.avatarURL != "" {
-		payload["avatar_url"] = s.avatarURL
+	for i, a := range p.Attachments {
+		payload.Attachments = append(payload.Attachments, attachmentRef{ID: i, Filename: a.Filename})
 	}
 
-	body, err := json.Marshal(payload)
+	endpoint, err := s.endpoint("", p.ThreadID, true)
+	if err != nil {
+		return message.RemoteRef{}, err
+	}
+	body, contentType, err := encodeBody(payload, p.Attachments)
 	if err != nil {
-		return fmt.Errorf("discord: encode payload: %w", err)
+		return message.RemoteRef{}, err
 	}
-	req, err := http.NewRequest(http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	res, err := s.do(http.MethodPost, endpoint, body, contentType)
 	if err != nil {
-		return fmt.Errorf("discord: new request: %w", err)
+		return message.RemoteRef{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return message.RemoteRef{}, &StatusError{StatusCode: res.StatusCode}
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	res, err := s.client.Do(req)
+	// wait=true なので作成された投稿が返る。スレッド内の投稿では channel_id がスレッドID。
+	var posted struct {
+		ID        string `json:"id"`
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&posted); err != nil {
+		return message.RemoteRef{}, fmt.Errorf("discord: decode response: %w", err)
+	}
+	if posted.ID == "" {
+		return message.RemoteRef{}, fmt.Errorf("discord: response has no message id")
+	}
+	ref := message.RemoteRef{MessageID: posted.ID}
+	if p.ThreadID != "" || p.ThreadName != "" {
+		ref.ThreadID = posted.ChannelID
+	}
+	return ref, nil
+}
+
+func (s *sender) Edit(ref message.RemoteRef, p discordmsg.Payload) error {
+	// 本文・埋め込みを空にする編集もできるよう、省略せずに送る。
+	embeds := p.Embeds
+	if embeds == nil {
+		embeds = []discordmsg.Embed{}
+	}
+	payload := struct {
+		Content         string             `json:"content"`
+		Embeds          []discordmsg.Embed `json:"embeds"`
+		AllowedMentions map[string]any     `json:"allowed_mentions"`
+	}{Content: p.Content, Embeds: embeds, AllowedMentions: allowedMentions}
+
+	endpoint, err := s.endpoint("/messages/"+url.PathEscape(ref.MessageID), ref.ThreadID, false)
+	if err != nil {
+		return err
+	}
+	body, contentType, err := encodeBody(payload, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(http.MethodPatch, endpoint, body, contentType)
 	if err != nil {
-		return fmt.Errorf("discord: request failed: %w", err)
+		return err
 	}
 	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return &StatusError{StatusCode: res.StatusCode}
+	}
+	return nil
+}
 
+func (s *sender) Delete(ref message.RemoteRef) error {
+	endpoint, err := s.endpoint("/messages/"+url.PathEscape(ref.MessageID), ref.ThreadID, false)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(http.MethodDelete, endpoint, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("discord: status=%d", res.StatusCode)
+		return &StatusError{StatusCode: res.StatusCode}
 	}
 	return nil
 }
+
+// endpoint はWebhookのURLに path とクエリ（wait・thread_id）を付ける。
+func (s *sender) endpoint(path, threadID string, wait bool) (string, error) {
+	u, err := url.Parse(s.webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("discord: parse webhook url: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = ""
+	q := u.Query()
+	if wait {
+		q.Set("wait", "true")
+	}
+	if threadID != "" {
+		q.Set("thread_id", threadID)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (s *sender) do(method, endpoint string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("discord: new request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discord: request failed: %w", err)
+	}
+	return res, nil
+}
+
+// encodeBody は添付ファイルがなければJSON、あれば payload_json と files[n] の multipart にする。
+func encodeBody(payload any, attachments []discordmsg.Attachment) (io.Reader, string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("discord: encode payload: %w", err)
+	}
+	if len(attachments) == 0 {
+		return bytes.NewReader(b), "application/json", nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="payload_json"`)
+	h.Set("Content-Type", "application/json")
+	part, err := w.CreatePart(h)
+	if err == nil {
+		_, err = part.Write(b)
+	}
+	for i, a := range attachments {
+		if err != nil {
+			break
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename=%s`, i, strconv.Quote(a.Filename)))
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+		if part, err = w.CreatePart(h); err == nil {
+			_, err = part.Write(a.Data)
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("discord: encode multipart: %w", err)
+	}
+	return &buf, w.FormDataContentType(), nil
+}
+
+// StatusError はDiscordがエラーのステータスを返したことを表す。
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("discord: status=%d", e.StatusCode)
+}
+
+// Retryable は時間をおけば成功しうるか（5xx・429）を返す。
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,166 @@
+package discord
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+type capturedRequest struct {
+	method      string
+	path        string
+	query       string
+	contentType string
+	body        []byte
+}
+
+func newCaptureServer(t *testing.T, status int, resp string) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+	got := &capturedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method, got.path, got.query = r.Method, r.URL.Path, r.URL.RawQuery
+		got.contentType = r.Header.Get("Content-Type")
+		got.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(resp))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+// 投稿は wait=true で送り、返った投稿IDとスレッドIDを返すことを確認する。
+func TestSender_Send(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		payload   discordmsg.Payload
+		wantQuery string
+		wantRef   message.RemoteRef
+		wantBody  string
+	}{
+		{
+			name:      "本文と埋め込み",
+			payload:   discordmsg.Payload{Content: "障害", Embeds: []discordmsg.Embed{{Title: "DB", Color: 0xFF0000, Fields: []discordmsg.EmbedField{{Name: "影響", Value: "全店舗", Inline: true}}}}},
+			wantQuery: "wait=true",
+			wantRef:   message.RemoteRef{MessageID: "111"},
+			wantBody:  `{"content":"障害","username":"bot","embeds":[{"title":"DB","color":16711680,"fields":[{"name":"影響","value":"全店舗","inline":true}]}],"allowed_mentions":{"parse":[]}}`,
+		},
+		{
+			name:      "既存スレッド",
+			payload:   discordmsg.Payload{Content: "hi", ThreadID: "222"},
+			wantQuery: "thread_id=222&wait=true",
+			wantRef:   message.RemoteRef{MessageID: "111", ThreadID: "222"},
+			wantBody:  `{"content":"hi","username":"bot","allowed_mentions":{"parse":[]}}`,
+		},
+		{
+			name:      "フォーラムに新規投稿",
+			payload:   discordmsg.Payload{Content: "hi", ThreadName: "障害報告"},
+			wantQuery: "wait=true",
+			wantRef:   message.RemoteRef{MessageID: "111", ThreadID: "222"},
+			wantBody:  `{"content":"hi","username":"bot","thread_name":"障害報告","allowed_mentions":{"parse":[]}}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv, got := newCaptureServer(t, http.StatusOK, `{"id":"111","channel_id":"222"}`)
+
+			ref, err := NewSender(srv.URL+"/api/webhooks/1/tok", "bot", "", time.Second).Send(tt.payload)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ref != tt.wantRef {
+				t.Fatalf("ref=%+v want=%+v", ref, tt.wantRef)
+			}
+			if got.method != http.MethodPost || got.path != "/api/webhooks/1/tok" || got.query != tt.wantQuery {
+				t.Fatalf("request=%s %s?%s", got.method, got.path, got.query)
+			}
+			if string(got.body) != tt.wantBody {
+				t.Fatalf("body=%s\nwant=%s", got.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// 添付ファイルは payload_json と files[n] の multipart で送る。
+func TestSender_SendAttachments(t *testing.T) {
+	t.Parallel()
+	srv, got := newCaptureServer(t, http.StatusOK, `{"id":"111","channel_id":"9"}`)
+
+	p := discordmsg.Payload{Content: "log", Attachments: []discordmsg.Attachment{{Filename: "a.txt", ContentType: "text/plain", Data: []byte("hello")}}}
+	if _, err := NewSender(srv.URL, "", "", time.Second).Send(p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(got.contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("content-type=%s", got.contentType)
+	}
+	r := multipart.NewReader(strings.NewReader(string(got.body)), params["boundary"])
+	parts := map[string]string{}
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(part)
+		parts[part.FormName()] = string(b)
+		if part.FormName() == "files[0]" && (part.FileName() != "a.txt" || part.Header.Get("Content-Type") != "text/plain") {
+			t.Fatalf("file part header=%v", part.Header)
+		}
+	}
+	var payload struct {
+		Attachments []attachmentRef `json:"attachments"`
+	}
+	if err := json.Unmarshal([]byte(parts["payload_json"]), &payload); err != nil || len(payload.Attachments) != 1 || payload.Attachments[0].Filename != "a.txt" {
+		t.Fatalf("payload_json=%s err=%v", parts["payload_json"], err)
+	}
+	if parts["files[0]"] != "hello" {
+		t.Fatalf("file=%q", parts["files[0]"])
+	}
+}
+
+// 編集・削除は投稿IDのパスへ送り、スレッド内なら thread_id を付ける。削除済みは成功とする。
+func TestSender_EditDelete(t *testing.T) {
+	t.Parallel()
+
+	ref := message.RemoteRef{MessageID: "111", ThreadID: "222"}
+	srv, got := newCaptureServer(t, http.StatusOK, `{}`)
+	s := NewSender(srv.URL+"/api/webhooks/1/tok", "bot", "", time.Second)
+
+	if err := s.Edit(ref, discordmsg.Payload{Content: "復旧"}); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if got.method != http.MethodPatch || got.path != "/api/webhooks/1/tok/messages/111" || got.query != "thread_id=222" {
+		t.Fatalf("edit request=%s %s?%s", got.method, got.path, got.query)
+	}
+	if string(got.body) != `{"content":"復旧","embeds":[],"allowed_mentions":{"parse":[]}}` {
+		t.Fatalf("edit body=%s", got.body)
+	}
+
+	if err := s.Delete(ref); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got.method != http.MethodDelete || got.path != "/api/webhooks/1/tok/messages/111" {
+		t.Fatalf("delete request=%s %s", got.method, got.path)
+	}
+
+	gone, _ := newCaptureServer(t, http.StatusNotFound, `{}`)
+	if err := NewSender(gone.URL, "", "", time.Second).Delete(ref); err != nil {
+		t.Fatalf("delete of missing message should succeed: %v", err)
+	}
+	failing, _ := newCaptureServer(t, http.StatusNotFound, `{}`)
+	if err := NewSender(failing.URL, "", "", time.Second).Edit(ref, discordmsg.Payload{Content: "x"}); err == nil {
+		t.Fatalf("edit of missing message should fail")
+	}
+}
@@ -0,0 +1,76 @@
+package line
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NarrowcastProgress はナローキャストの進捗。件数は送信が始まるまで返らない。
+type NarrowcastProgress struct {
+	// Phase は waiting・sending・succeeded・failed のいずれか。
+	Phase             string     `json:"phase"`
+	SuccessCount      *int64     `json:"successCount,omitempty"`
+	FailureCount      *int64     `json:"failureCount,omitempty"`
+	TargetCount       *int64     `json:"targetCount,omitempty"`
+	FailedDescription string     `json:"failedDescription,omitempty"`
+	ErrorCode         *int       `json:"errorCode,omitempty"`
+	AcceptedTime      *time.Time `json:"acceptedTime,omitempty"`
+	CompletedTime     *time.Time `json:"completedTime,omitempty"`
+}
+
+// ProgressReader はナローキャストのリクエストIDから進捗を取得する。
+type ProgressReader interface {
+	NarrowcastProgress(ctx context.Context, requestID string) (NarrowcastProgress, error)
+}
+
+type progressReader struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// NewProgressReader はナローキャスト進捗APIのクライアントを生成する。
+func NewProgressReader(endpoint, channelToken string, timeout time.Duration) ProgressReader {
+	return &progressReader{
+		endpoint: strings.TrimSpace(endpoint),
+		token:    strings.TrimSpace(channelToken),
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *progressReader) NarrowcastProgress(ctx context.Context, requestID string) (NarrowcastProgress, error) {
+	if p.endpoint == "" {
+		return NarrowcastProgress{}, fmt.Errorf("line progress: %w", ErrEndpointNotConfigured)
+	}
+	u, err := url.Parse(p.endpoint)
+	if err != nil {
+		return NarrowcastProgress{}, fmt.Errorf("line progress: parse endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("requestId", requestID)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return NarrowcastProgress{}, fmt.Errorf("line progress: new request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return NarrowcastProgress{}, fmt.Errorf("line progress: request failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return NarrowcastProgress{}, &StatusError{Op: "progress", StatusCode: res.StatusCode}
+	}
+	var out NarrowcastProgress
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return NarrowcastProgress{}, fmt.Errorf("line progress: decode response: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,33 @@
+package line
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// リクエストIDをクエリで渡し、進捗をそのまま読むことを確認する。
+func TestProgressReader(t *testing.T) {
+	t.Parallel()
+
+	var gotQuery, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"phase":"succeeded","successCount":0,"failureCount":1,"targetCount":1,"acceptedTime":"2025-01-01T00:00:00.000Z","completedTime":"2025-01-01T00:01:00.000Z"}`))
+	}))
+	defer srv.Close()
+
+	got, err := NewProgressReader(srv.URL, "token", time.Second).NarrowcastProgress(context.Background(), "req-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotQuery != "requestId=req-1" || gotAuth != "Bearer token" {
+		t.Fatalf("query=%q auth=%q", gotQuery, gotAuth)
+	}
+	if got.Phase != "succeeded" || got.SuccessCount == nil || *got.SuccessCount != 0 || *got.FailureCount != 1 || got.CompletedTime == nil {
+		t.Fatalf("progress=%+v", got)
+	}
+}
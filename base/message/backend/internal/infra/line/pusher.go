@@ -3,62 +3,188 @@ package line
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
 )
 
+// ErrEndpointNotConfigured は使うAPIのエンドポイントがテナントに設定されていない場合に返す。
+var ErrEndpointNotConfigured = errors.New("line: endpoint is not configured")
+
 // Pusher はLINE Messaging APIへメッセージを送信するポート実装。
+// messages はLINEの形式のまま送る（最大5件）。retryKey を渡すと X-Line-Retry-Key として送り、
+// 同じキーの再送をLINE側で重複排除させる。
 type Pusher interface {
-	Push(userID, text string) error
+	Push(userID string, messages []linemsg.Message, retryKey string) error
+	// Multicast は userIDs を linemsg.MaxMulticastRecipients 件ずつに分けて送る。分けた2つ目以降には
+	// retryKey から導いたキーを使うため、途中で失敗して再送しても送信済みの分は重複しない。
+	// progress は2つ目以降を送る前に呼ぶ（nil可）。呼び出し側はこれで処理中であることを伝え、再配送を防ぐ。
+	Multicast(userIDs []string, messages []linemsg.Message, retryKey string, progress func()) error
+	// Broadcast は友だち全員に送る。
+	Broadcast(messages []linemsg.Message, retryKey string) error
+	// Narrowcast は条件に合う友だちに送り、進捗の照会に使うリクエストIDを返す。
+	Narrowcast(n linemsg.Narrowcast, messages []linemsg.Message, retryKey string) (requestID string, err error)
+}
+
+// Endpoints はテナントごとのLINE Messaging APIのエンドポイント。空のものは使えない。
+type Endpoints struct {
+	Push       string
+	Multicast  string
+	Broadcast  string
+	Narrowcast string
 }
 
 type pusher struct {
-	endpoint string
-	token    string
-	client   *http.Client
+	endpoints Endpoints
+	token     string
+	client    *http.Client
 }
 
-// NewPusher はLINE Push APIクライアントを生成する。
-func NewPusher(endpoint, channelToken string, timeout time.Duration) Pusher {
+// NewPusher はLINE送信APIクライアントを生成する。
+func NewPusher(endpoints Endpoints, channelToken string, timeout time.Duration) Pusher {
 	return &pusher{
-		endpoint: strings.TrimSpace(endpoint),
-		token:    strings.TrimSpace(channelToken),
-		client:   &http.Client{Timeout: timeout},
+		endpoints: Endpoints{
+			Push:       strings.TrimSpace(endpoints.Push),
+			Multicast:  strings.TrimSpace(endpoints.Multicast),
+			Broadcast:  strings.TrimSpace(endpoints.Broadcast),
+			Narrowcast: strings.TrimSpace(endpoints.Narrowcast),
+		},
+		token:  strings.TrimSpace(channelToken),
+		client: &http.Client{Timeout: timeout},
 	}
 }
 
-func (p *pusher) Push(userID, text string) error {
+func (p *pusher) Push(userID string, messages []linemsg.Message, retryKey string) error {
 	if userID == "" {
 		return fmt.Errorf("line push: userId empty")
 	}
-	body := map[string]any{
-		"to": userID,
-		"messages": []map[string]string{{
-			"type": "text",
-			"text": text,
-		}},
+	body := struct {
+		To       string            `json:"to"`
+		Messages []linemsg.Message `json:"messages"`
+	}{To: userID, Messages: messages}
+	_, err := p.post("push", p.endpoints.Push, body, len(messages), retryKey)
+	return err
+}
+
+func (p *pusher) Multicast(userIDs []string, messages []linemsg.Message, retryKey string, progress func()) error {
+	if len(userIDs) == 0 {
+		return fmt.Errorf("line multicast: userIds empty")
+	}
+	for i := 0; i*linemsg.MaxMulticastRecipients < len(userIDs); i++ {
+		if i > 0 && progress != nil {
+			progress()
+		}
+		chunk := userIDs[i*linemsg.MaxMulticastRecipients : min((i+1)*linemsg.MaxMulticastRecipients, len(userIDs))]
+		key, err := chunkRetryKey(retryKey, i)
+		if err != nil {
+			return fmt.Errorf("line multicast: %w", err)
+		}
+		body := struct {
+			To       []string          `json:"to"`
+			Messages []linemsg.Message `json:"messages"`
+		}{To: chunk, Messages: messages}
+		if _, err := p.post("multicast", p.endpoints.Multicast, body, len(messages), key); err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// chunkRetryKey は分けて送る i 番目のリトライキーを返す。最初は retryKey をそのまま使う。
+func chunkRetryKey(retryKey string, i int) (string, error) {
+	if retryKey == "" || i == 0 {
+		return retryKey, nil
+	}
+	return message.IDFromKey(retryKey + "#" + strconv.Itoa(i))
+}
+
+func (p *pusher) Broadcast(messages []linemsg.Message, retryKey string) error {
+	body := struct {
+		Messages []linemsg.Message `json:"messages"`
+	}{Messages: messages}
+	_, err := p.post("broadcast", p.endpoints.Broadcast, body, len(messages), retryKey)
+	return err
+}
+
+func (p *pusher) Narrowcast(n linemsg.Narrowcast, messages []linemsg.Message, retryKey string) (string, error) {
+	body := struct {
+		Messages []linemsg.Message `json:"messages"`
+		linemsg.Narrowcast
+	}{Messages: messages, Narrowcast: n}
+	res, err := p.post("narrowcast", p.endpoints.Narrowcast, body, len(messages), retryKey)
+	if err != nil {
+		return "", err
+	}
+	// 同じリトライキーで受理済みの場合は、最初に受理した要求のIDが別のヘッダで返る。
+	if id := res.Get("X-Line-Accepted-Request-Id"); id != "" {
+		return id, nil
+	}
+	if id := res.Get("X-Line-Request-Id"); id != "" {
+		return id, nil
+	}
+	return "", fmt.Errorf("line narrowcast: response has no request id")
+}
+
+// post は body を送り、応答ヘッダを返す。
+func (p *pusher) post(op, endpoint string, body any, messages int, retryKey string) (http.Header, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("line %s: %w", op, ErrEndpointNotConfigured)
+	}
+	if messages == 0 || messages > linemsg.MaxMessages {
+		return nil, fmt.Errorf("line %s: messages must contain 1-%d items", op, linemsg.MaxMessages)
 	}
 	b, err := json.Marshal(body)
 	if err != nil {
-		return fmt.Errorf("line push: encode body: %w", err)
+		return nil, fmt.Errorf("line %s: encode body: %w", op, err)
 	}
-	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(b))
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
 	if err != nil {
-		return fmt.Errorf("line push: new request: %w", err)
+		return nil, fmt.Errorf("line %s: new request: %w", op, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+p.token)
+	if retryKey != "" {
+		req.Header.Set("X-Line-Retry-Key", retryKey)
+	}
 
 	res, err := p.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("line push: request failed: %w", err)
+		return nil, fmt.Errorf("line %s: request failed: %w", op, err)
 	}
 	defer res.Body.Close()
 
+	// 同じリトライキーの要求を受理済みなら 409 が返る。送信自体は済んでいるので成功とみなす。
+	if res.StatusCode == http.StatusConflict && retryKey != "" {
+		return res.Header, nil
+	}
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("line push: status %d", res.StatusCode)
+		return nil, &StatusError{Op: op, StatusCode: res.StatusCode}
 	}
-	return nil
+	return res.Header, nil
+}
+
+// StatusError はLINE APIがエラーのステータスを返したことを表す。
+type StatusError struct {
+	// Op は呼び出したAPI（push・multicast・broadcast・narrowcast・progress）。
+	Op         string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	op := e.Op
+	if op == "" {
+		op = "push"
+	}
+	return fmt.Sprintf("line %s: status %d", op, e.StatusCode)
+}
+
+// Retryable は時間をおけば成功しうるか（5xx・429）を返す。
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
 }
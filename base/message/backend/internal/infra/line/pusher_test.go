@@ -0,0 +1,173 @@
+package line
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
+)
+
+// リトライキーをヘッダで送り、受理済み（409）は成功として扱うことを確認する。
+func TestPusher_RetryKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		retryKey   string
+		status     int
+		wantStatus int
+	}{
+		{name: "キー付きで成功", retryKey: "k1", status: http.StatusOK},
+		{name: "キー付きの409は受理済み", retryKey: "k1", status: http.StatusConflict},
+		{name: "キーなしの409はエラー", status: http.StatusConflict, wantStatus: http.StatusConflict},
+		{name: "キー付きでも5xxはエラー", retryKey: "k1", status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var gotKey string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotKey = r.Header.Get("X-Line-Retry-Key")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err := NewPusher(Endpoints{Push: srv.URL}, "token", time.Second).Push("U1", []linemsg.Message{linemsg.Text{Text: "hi"}}, tt.retryKey)
+			if gotKey != tt.retryKey {
+				t.Fatalf("retry key=%q want=%q", gotKey, tt.retryKey)
+			}
+			var se *StatusError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &se) || se.StatusCode != tt.wantStatus):
+				t.Fatalf("err=%v want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// 型付きメッセージをテキストに潰さずLINEの形式で送ることを確認する。
+func TestPusher_Body(t *testing.T) {
+	t.Parallel()
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	defer srv.Close()
+
+	messages := []linemsg.Message{
+		linemsg.Text{Text: "hi"},
+		linemsg.Flex{AltText: "店舗", Contents: json.RawMessage(`{"type":"bubble"}`)},
+	}
+	if err := NewPusher(Endpoints{Push: srv.URL}, "token", time.Second).Push("U1", messages, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"to":"U1","messages":[{"type":"text","text":"hi"},{"type":"flex","altText":"店舗","contents":{"type":"bubble"}}]}`
+	if got != want {
+		t.Fatalf("body=%s\nwant=%s", got, want)
+	}
+}
+
+// マルチキャストは500件ずつに分け、2つ目以降は導いたリトライキーで送ることを確認する。
+func TestPusher_MulticastChunks(t *testing.T) {
+	t.Parallel()
+
+	var (
+		sizes []int
+		keys  []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			To []string `json:"to"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sizes = append(sizes, len(body.To))
+		keys = append(keys, r.Header.Get("X-Line-Retry-Key"))
+	}))
+	defer srv.Close()
+
+	ids := make([]string, 1201)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("U%d", i)
+	}
+	const key = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	// progress は2つ目以降を送る前に呼ばれ、その時点で送り終えた分の件数を控える。
+	var progressAt []int
+	progress := func() { progressAt = append(progressAt, len(sizes)) }
+	if err := NewPusher(Endpoints{Multicast: srv.URL}, "token", time.Second).Multicast(ids, []linemsg.Message{linemsg.Text{Text: "hi"}}, key, progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(sizes) != "[500 500 201]" {
+		t.Fatalf("chunk sizes=%v", sizes)
+	}
+	if fmt.Sprint(progressAt) != "[1 2]" {
+		t.Fatalf("progress calls after chunks=%v", progressAt)
+	}
+	if keys[0] != key || keys[1] == key || keys[1] == keys[2] {
+		t.Fatalf("retry keys=%v", keys)
+	}
+	again, _ := chunkRetryKey(key, 1)
+	if keys[1] != again {
+		t.Fatalf("retry key must be stable: %s != %s", keys[1], again)
+	}
+}
+
+// ナローキャストは条件をそのまま送り、リクエストIDを返す。受理済みなら最初のIDを返す。
+func TestPusher_Narrowcast(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		wantID string
+	}{
+		{name: "受理", status: http.StatusAccepted, header: map[string]string{"X-Line-Request-Id": "req-1"}, wantID: "req-1"},
+		{name: "受理済み", status: http.StatusConflict, header: map[string]string{"X-Line-Request-Id": "req-2", "X-Line-Accepted-Request-Id": "req-1"}, wantID: "req-1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				got = string(b)
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			n := linemsg.Narrowcast{Recipient: &linemsg.Recipient{Type: "audience", AudienceGroupID: 1}, Limit: &linemsg.NarrowcastLimit{Max: 10}}
+			id, err := NewPusher(Endpoints{Narrowcast: srv.URL}, "token", time.Second).Narrowcast(n, []linemsg.Message{linemsg.Text{Text: "hi"}}, "k1")
+			if err != nil || id != tt.wantID {
+				t.Fatalf("id=%q err=%v want=%q", id, err, tt.wantID)
+			}
+			want := `{"messages":[{"type":"text","text":"hi"}],"recipient":{"type":"audience","audienceGroupId":1},"limit":{"max":10}}`
+			if got != want {
+				t.Fatalf("body=%s\nwant=%s", got, want)
+			}
+		})
+	}
+}
+
+// エンドポイント未設定のAPIは呼ばずにエラーにする。
+func TestPusher_EndpointNotConfigured(t *testing.T) {
+	t.Parallel()
+	err := NewPusher(Endpoints{Push: "https://example.com"}, "token", time.Second).Broadcast([]linemsg.Message{linemsg.Text{Text: "hi"}}, "")
+	if !errors.Is(err, ErrEndpointNotConfigured) {
+		t.Fatalf("err=%v", err)
+	}
+}
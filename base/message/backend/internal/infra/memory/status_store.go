@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
+)
+
+type statusEntry struct {
+	status   message.Status
+	revision uint64
+}
+
+// StatusStore はプロセス内に配送状態を保持する。ingress と worker が別プロセスの構成では
+// 互いの記録が見えないため、ローカル検証やテスト用。
+type StatusStore struct {
+	mu      sync.Mutex
+	entries map[string]statusEntry
+}
+
+// NewStatusStore は空の StatusStore を生成する。
+func NewStatusStore() *StatusStore {
+	return &StatusStore{entries: map[string]statusEntry{}}
+}
+
+// Get は状態と revision を返す。
+func (s *StatusStore) Get(_ context.Context, id string) (message.Status, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return message.Status{}, 0, status.ErrNotFound
+	}
+	return e.status, e.revision, nil
+}
+
+// Create は未記録のIDに状態を保存する。
+func (s *StatusStore) Create(_ context.Context, st message.Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[st.MessageID]; ok {
+		return status.ErrConflict
+	}
+	s.entries[st.MessageID] = statusEntry{status: st, revision: 1}
+	return nil
+}
+
+// Update は revision が最新の場合だけ上書きする。
+func (s *StatusStore) Update(_ context.Context, st message.Status, revision uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[st.MessageID]
+	if !ok || e.revision != revision {
+		return status.ErrConflict
+	}
+	s.entries[st.MessageID] = statusEntry{status: st, revision: revision + 1}
+	return nil
+}
@@ -2,25 +2,114 @@ package nats
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/tenant"
 )
 
 // Producer はNATSへメッセージをpublishする。
 type Producer interface {
 	Publish(ctx context.Context, subject string, data []byte) error
+	// PublishWithID は Nats-Msg-Id を付けてpublishする。重複排除の期間内に同じIDが保存済みなら
+	// 保存せずに duplicate=true を返す。
+	PublishWithID(ctx context.Context, subject, msgID string, data []byte) (duplicate bool, err error)
+}
+
+// Stream はテナントのJetStreamストリーム定義。
+type Stream struct {
+	Name     string
+	Subjects []string
+	MaxAge   time.Duration
+	// Duplicates は Nats-Msg-Id による重複排除の期間。0ならサーバーの既定（2分）。
+	Duplicates time.Duration
+}
+
+// TenantStream はテナント設定からストリーム定義を組み立てる。ingress・webhook・worker で同じ定義にそろえる。
+func TenantStream(cfg tenant.MessageTenant) Stream {
+	return Stream{
+		Name:       cfg.Delivery.Stream,
+		Subjects:   cfg.StreamSubjects(),
+		MaxAge:     cfg.Delivery.MaxAge,
+		Duplicates: cfg.Delivery.DuplicateWindow,
+	}
+}
+
+// EventStream はテナント設定から webhook が中継する受信イベントのストリーム定義を組み立てる。
+// 受信イベントは webhookEventId で購読側が重複を除くので、Nats-Msg-Id の重複排除は使わない。
+func EventStream(cfg tenant.MessageTenant) Stream {
+	return Stream{
+		Name:     cfg.Events.Stream,
+		Subjects: []string{cfg.Events.LineSubject},
+		MaxAge:   cfg.Delivery.MaxAge,
+	}
+}
+
+// EnsureStream はストリームを作成または更新する。同じ定義で何度呼んでもよい。
+func EnsureStream(ctx context.Context, js jetstream.JetStream, s Stream) (jetstream.Stream, error) {
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       s.Name,
+		Subjects:   s.Subjects,
+		Retention:  jetstream.LimitsPolicy,
+		MaxAge:     s.MaxAge,
+		Duplicates: s.Duplicates,
+		Storage:    jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensure stream %s: %w", s.Name, err)
+	}
+	return stream, nil
 }
 
 type producer struct {
-	nc *nats.Conn
+	js     jetstream.JetStream
+	stream Stream
+
+	mu    sync.Mutex
+	ready bool
 }
 
-// NewProducer はProducerを生成する。
-func NewProducer(nc *nats.Conn) Producer {
-	return &producer{nc: nc}
+// NewProducer はJetStreamへpublishするProducerを生成する。
+// ストリームは初回publish時に作成し、サーバーが保存を確認するまで待つ。
+func NewProducer(js jetstream.JetStream, stream Stream) Producer {
+	return &producer{js: js, stream: stream}
 }
 
-// Publish はNATSにメッセージを送る。
+// Publish はストリームに保存されたことを確認してから戻る。
 func (p *producer) Publish(ctx context.Context, subject string, data []byte) error {
-	return p.nc.Publish(subject, data)
+	if err := p.ensureStream(ctx); err != nil {
+		return err
+	}
+	if _, err := p.js.Publish(ctx, subject, data); err != nil {
+		return fmt.Errorf("jetstream publish: %w", err)
+	}
+	return nil
+}
+
+// PublishWithID は msgID で重複排除しながらpublishする。
+func (p *producer) PublishWithID(ctx context.Context, subject, msgID string, data []byte) (bool, error) {
+	if err := p.ensureStream(ctx); err != nil {
+		return false, err
+	}
+	ack, err := p.js.Publish(ctx, subject, data, jetstream.WithMsgID(msgID))
+	if err != nil {
+		return false, fmt.Errorf("jetstream publish: %w", err)
+	}
+	return ack.Duplicate, nil
+}
+
+func (p *producer) ensureStream(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ready {
+		return nil
+	}
+	if _, err := EnsureStream(ctx, p.js, p.stream); err != nil {
+		return err
+	}
+	p.ready = true
+	return nil
 }
@@ -0,0 +1,273 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+)
+
+// ScheduleStore は配送予約を JetStream の Key-Value バケットに保存する。
+// キーは「送る時刻の区切り（分単位の Unix 秒）.メッセージID」で、送る時刻になった予約は
+// 区切りで絞り込んで読む。予約は送り出すか取り消すまで残るため、バケットに TTL は付けない。
+// 代わりに消すときは履歴ごと purge し、残った削除マーカーは Compact で片付ける。
+type ScheduleStore struct {
+	js     jetstream.JetStream
+	bucket string
+
+	mu   sync.Mutex
+	kv   jetstream.KeyValue
+	next time.Time // ListDue が次に読み始める区切り。ゼロ値ならバケット全体から探す。
+}
+
+const (
+	// scheduleSlot はキーの区切りの幅。
+	scheduleSlot = time.Minute
+	// maxFilteredSlots は区切りごとに絞り込んで読む上限。これより遡る場合はキーをすべて列挙する。
+	maxFilteredSlots = 60
+)
+
+// scheduleKey は予約を保存するキーを返す。
+func scheduleKey(sc message.Scheduled) string {
+	return slotPrefix(sc.SendAt.Truncate(scheduleSlot)) + "." + sc.MessageID
+}
+
+func slotPrefix(slot time.Time) string {
+	return strconv.FormatInt(slot.Unix(), 10)
+}
+
+// keySlot はキーの区切りを返す。形式が違うキーなら ok=false。
+func keySlot(key string) (slot time.Time, ok bool) {
+	prefix, _, found := strings.Cut(key, ".")
+	if !found {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0).UTC(), true
+}
+
+// NewScheduleStore は ScheduleStore を生成する。バケットは初回アクセス時に作成する。
+func NewScheduleStore(js jetstream.JetStream, bucket string) *ScheduleStore {
+	return &ScheduleStore{js: js, bucket: bucket}
+}
+
+// Get は予約と revision を返す。
+func (s *ScheduleStore) Get(ctx context.Context, id string) (message.Scheduled, uint64, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return message.Scheduled{}, 0, err
+	}
+	keys, err := s.keys(ctx, kv, "*."+id)
+	if err != nil {
+		return message.Scheduled{}, 0, err
+	}
+	if len(keys) == 0 {
+		return message.Scheduled{}, 0, schedule.ErrNotFound
+	}
+	return s.read(ctx, kv, keys[0])
+}
+
+// read はキーの予約と revision を返す。
+func (s *ScheduleStore) read(ctx context.Context, kv jetstream.KeyValue, key string) (message.Scheduled, uint64, error) {
+	entry, err := kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return message.Scheduled{}, 0, schedule.ErrNotFound
+	}
+	if err != nil {
+		return message.Scheduled{}, 0, fmt.Errorf("schedule get %s: %w", key, err)
+	}
+	var sc message.Scheduled
+	if err := json.Unmarshal(entry.Value(), &sc); err != nil {
+		return message.Scheduled{}, 0, fmt.Errorf("schedule decode %s: %w", key, err)
+	}
+	return sc, entry.Revision(), nil
+}
+
+// List はすべての予約を返す。キーを列挙してから読むため、その間に消えた予約は含めない。
+func (s *ScheduleStore) List(ctx context.Context) ([]message.Scheduled, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.keys(ctx, kv, ">")
+	if err != nil {
+		return nil, err
+	}
+	return s.readAll(ctx, kv, keys, nil)
+}
+
+// ListDue は until の時点で送る時刻になった予約を返す。
+// 前回読んだ区切りから until の区切りまでのキーだけを読み、予約が残っていた最も古い区切りを次の起点にする。
+// 時計のずれで少し過去の予約が後から入っても拾えるよう、起点は until の1つ前の区切りより先へ進めない。
+func (s *ScheduleStore) ListDue(ctx context.Context, until time.Time) ([]message.Scheduled, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	last := until.UTC().Truncate(scheduleSlot)
+	s.mu.Lock()
+	from := s.next
+	s.mu.Unlock()
+	if from.After(last) {
+		from = last
+	}
+
+	var keys []string
+	if from.IsZero() || last.Sub(from) > maxFilteredSlots*scheduleSlot {
+		all, err := s.keys(ctx, kv, ">")
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range all {
+			if slot, ok := keySlot(k); ok && !slot.After(last) {
+				keys = append(keys, k)
+			}
+		}
+	} else {
+		var filters []string
+		for slot := from; !slot.After(last); slot = slot.Add(scheduleSlot) {
+			filters = append(filters, slotPrefix(slot)+".*")
+		}
+		if keys, err = s.keys(ctx, kv, filters...); err != nil {
+			return nil, err
+		}
+	}
+
+	next := last.Add(-scheduleSlot)
+	for _, k := range keys {
+		if slot, ok := keySlot(k); ok && slot.Before(next) {
+			next = slot
+		}
+	}
+	s.mu.Lock()
+	s.next = next
+	s.mu.Unlock()
+
+	return s.readAll(ctx, kv, keys, func(sc message.Scheduled) bool { return sc.Due(until) })
+}
+
+// readAll はキーの予約を読み、keep が nil でなければ true を返したものだけを返す。その間に消えた予約は含めない。
+func (s *ScheduleStore) readAll(ctx context.Context, kv jetstream.KeyValue, keys []string, keep func(message.Scheduled) bool) ([]message.Scheduled, error) {
+	entries := make([]message.Scheduled, 0, len(keys))
+	for _, k := range keys {
+		sc, _, err := s.read(ctx, kv, k)
+		if errors.Is(err, schedule.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keep == nil || keep(sc) {
+			entries = append(entries, sc)
+		}
+	}
+	return entries, nil
+}
+
+// keys は filters に合うキーを列挙する。
+func (s *ScheduleStore) keys(ctx context.Context, kv jetstream.KeyValue, filters ...string) ([]string, error) {
+	lister, err := kv.ListKeysFiltered(ctx, filters...)
+	if err != nil {
+		return nil, fmt.Errorf("schedule list: %w", err)
+	}
+	var keys []string
+	for k := range lister.Keys() {
+		keys = append(keys, k)
+	}
+	_ = lister.Stop()
+	return keys, nil
+}
+
+// Create は未登録のIDに予約を保存する。
+func (s *ScheduleStore) Create(ctx context.Context, sc message.Scheduled) error {
+	kv, data, err := s.prepare(ctx, sc)
+	if err != nil {
+		return err
+	}
+	_, err = kv.Create(ctx, scheduleKey(sc), data)
+	return s.wrap("put", sc.MessageID, err)
+}
+
+// Update は revision が最新の場合だけ上書きする。
+func (s *ScheduleStore) Update(ctx context.Context, sc message.Scheduled, revision uint64) error {
+	kv, data, err := s.prepare(ctx, sc)
+	if err != nil {
+		return err
+	}
+	_, err = kv.Update(ctx, scheduleKey(sc), data, revision)
+	return s.wrap("put", sc.MessageID, err)
+}
+
+// Delete は予約を履歴ごと消す。revision が0なら確かめない。
+func (s *ScheduleStore) Delete(ctx context.Context, sc message.Scheduled, revision uint64) error {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return err
+	}
+	return s.wrap("delete", sc.MessageID, kv.Purge(ctx, scheduleKey(sc), jetstream.LastRevision(revision)))
+}
+
+// Compact は消した予約の削除マーカーのうち、30分より古いものを片付ける。
+func (s *ScheduleStore) Compact(ctx context.Context) error {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return err
+	}
+	if err := kv.PurgeDeletes(ctx); err != nil {
+		return fmt.Errorf("schedule compact: %w", err)
+	}
+	return nil
+}
+
+func (s *ScheduleStore) prepare(ctx context.Context, sc message.Scheduled) (jetstream.KeyValue, []byte, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("schedule encode %s: %w", sc.MessageID, err)
+	}
+	return kv, data, nil
+}
+
+func (s *ScheduleStore) wrap(op, id string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	// revision が合わない場合もキーが既にある場合と同じエラーコードで返る。
+	case errors.Is(err, jetstream.ErrKeyExists):
+		return schedule.ErrConflict
+	default:
+		return fmt.Errorf("schedule %s %s: %w", op, id, err)
+	}
+}
+
+func (s *ScheduleStore) keyValue(ctx context.Context) (jetstream.KeyValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv != nil {
+		return s.kv, nil
+	}
+	kv, err := s.js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:  s.bucket,
+		Storage: jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensure schedule bucket %s: %w", s.bucket, err)
+	}
+	s.kv = kv
+	return kv, nil
+}
@@ -0,0 +1,232 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/usecase/schedule"
+)
+
+// fakeKeyValue は予約の保存に使う操作だけを持つプロセス内のKVバケット。
+// キーの列挙に渡されたフィルタを記録する。
+type fakeKeyValue struct {
+	jetstream.KeyValue
+
+	mu       sync.Mutex
+	values   map[string]fakeEntry
+	revision uint64
+	filters  [][]string
+}
+
+type fakeEntry struct {
+	jetstream.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e fakeEntry) Value() []byte    { return e.value }
+func (e fakeEntry) Revision() uint64 { return e.revision }
+
+type fakeLister struct{ keys chan string }
+
+func (l fakeLister) Keys() <-chan string { return l.keys }
+func (l fakeLister) Stop() error         { return nil }
+
+func (f *fakeKeyValue) Create(_ context.Context, key string, value []byte, _ ...jetstream.KVCreateOpt) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.values[key]; ok {
+		return 0, jetstream.ErrKeyExists
+	}
+	f.revision++
+	f.values[key] = fakeEntry{value: value, revision: f.revision}
+	return f.revision, nil
+}
+
+func (f *fakeKeyValue) Update(_ context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e, ok := f.values[key]; !ok || e.revision != revision {
+		return 0, jetstream.ErrKeyExists
+	}
+	f.revision++
+	f.values[key] = fakeEntry{value: value, revision: f.revision}
+	return f.revision, nil
+}
+
+func (f *fakeKeyValue) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.values[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return e, nil
+}
+
+func (f *fakeKeyValue) Purge(_ context.Context, key string, _ ...jetstream.KVDeleteOpt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.values, key)
+	return nil
+}
+
+func (f *fakeKeyValue) ListKeysFiltered(_ context.Context, filters ...string) (jetstream.KeyLister, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filters = append(f.filters, filters)
+	var keys []string
+	for k := range f.values {
+		for _, filter := range filters {
+			if subjectMatch(filter, k) {
+				keys = append(keys, k)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	ch := make(chan string, len(keys))
+	for _, k := range keys {
+		ch <- k
+	}
+	close(ch)
+	return fakeLister{keys: ch}, nil
+}
+
+func (f *fakeKeyValue) lastFilters() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.filters[len(f.filters)-1]
+}
+
+// subjectMatch は NATS のサブジェクトと同じく、'*' を1トークン、'>' を残りすべてに合わせる。
+func subjectMatch(filter, key string) bool {
+	ft, kt := strings.Split(filter, "."), strings.Split(key, ".")
+	for i, t := range ft {
+		if t == ">" {
+			return len(kt) > i
+		}
+		if i >= len(kt) || (t != "*" && t != kt[i]) {
+			return false
+		}
+	}
+	return len(ft) == len(kt)
+}
+
+func newTestScheduleStore() (*ScheduleStore, *fakeKeyValue) {
+	kv := &fakeKeyValue{values: map[string]fakeEntry{}}
+	return &ScheduleStore{kv: kv}, kv
+}
+
+func ids(entries []message.Scheduled) []string {
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.MessageID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// 予約は送る時刻の区切りごとのキーに保存し、メッセージIDで引ける。
+func TestScheduleStore_GetByID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store, kv := newTestScheduleStore()
+	sendAt := time.Date(2025, 1, 1, 0, 0, 30, 0, time.UTC)
+	entry := message.Scheduled{MessageID: "a", Subject: "line.events", SendAt: sendAt}
+	if err := store.Create(ctx, entry); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := store.Create(ctx, entry); !errors.Is(err, schedule.ErrConflict) {
+		t.Fatalf("second create err=%v want ErrConflict", err)
+	}
+	if _, err := kv.Get(ctx, "1735689600.a"); err != nil {
+		t.Fatalf("slot key: %v", err)
+	}
+
+	got, rev, err := store.Get(ctx, "a")
+	if err != nil || got.MessageID != "a" {
+		t.Fatalf("get=%+v err=%v", got, err)
+	}
+	if err := store.Update(ctx, got, rev+1); !errors.Is(err, schedule.ErrConflict) {
+		t.Fatalf("stale update err=%v want ErrConflict", err)
+	}
+	if err := store.Delete(ctx, got, rev); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "a"); !errors.Is(err, schedule.ErrNotFound) {
+		t.Fatalf("get after delete err=%v want ErrNotFound", err)
+	}
+}
+
+// 最初はバケット全体から探し、以降は予約が残る区切りから今の区切りまでだけを読む。
+func TestScheduleStore_ListDue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store, kv := newTestScheduleStore()
+	now := time.Date(2025, 1, 1, 0, 10, 30, 0, time.UTC)
+	for _, e := range []message.Scheduled{
+		{MessageID: "old", SendAt: now.Add(-time.Hour)},
+		{MessageID: "due", SendAt: now},
+		{MessageID: "later", SendAt: now.Add(10 * time.Second)},
+		{MessageID: "future", SendAt: now.Add(time.Hour)},
+	} {
+		if err := store.Create(ctx, e); err != nil {
+			t.Fatalf("create %s: %v", e.MessageID, err)
+		}
+	}
+
+	got, err := store.ListDue(ctx, now)
+	if err != nil {
+		t.Fatalf("list due: %v", err)
+	}
+	if want := []string{"due", "old"}; strings.Join(ids(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("due=%v want=%v", ids(got), want)
+	}
+	if filters := kv.lastFilters(); len(filters) != 1 || filters[0] != ">" {
+		t.Fatalf("first scan filters=%v want full scan", filters)
+	}
+
+	// 古い予約が残っている間はその区切りから読む。
+	got, err = store.ListDue(ctx, now)
+	if err != nil {
+		t.Fatalf("list due: %v", err)
+	}
+	if len(got) != 2 || len(kv.lastFilters()) != 61 {
+		t.Fatalf("due=%v filters=%d", ids(got), len(kv.lastFilters()))
+	}
+
+	// 送り出した後は今の区切りと1つ前だけを読み、後から入った1つ前の区切りの予約も拾う。
+	for _, e := range got {
+		if err := store.Delete(ctx, e, 0); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	if _, err := store.ListDue(ctx, now); err != nil {
+		t.Fatalf("list due: %v", err)
+	}
+	late := message.Scheduled{MessageID: "late", SendAt: now.Add(-time.Minute)}
+	if err := store.Create(ctx, late); err != nil {
+		t.Fatalf("create late: %v", err)
+	}
+	got, err = store.ListDue(ctx, now.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("list due: %v", err)
+	}
+	if want := []string{"late", "later"}; strings.Join(ids(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("due=%v want=%v", ids(got), want)
+	}
+	if filters := kv.lastFilters(); strings.Join(filters, ",") != "1735690140.*,1735690200.*" {
+		t.Fatalf("filters=%v", filters)
+	}
+}
@@ -0,0 +1,113 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
+)
+
+// StatusStore は配送状態を JetStream の Key-Value バケットに保存する。キーはメッセージID。
+type StatusStore struct {
+	js     jetstream.JetStream
+	bucket string
+	ttl    time.Duration
+
+	mu sync.Mutex
+	kv jetstream.KeyValue
+}
+
+// NewStatusStore は StatusStore を生成する。バケットは初回アクセス時に作成し、
+// 各キーは最後の更新から ttl 経つと消える。
+func NewStatusStore(js jetstream.JetStream, bucket string, ttl time.Duration) *StatusStore {
+	return &StatusStore{js: js, bucket: bucket, ttl: ttl}
+}
+
+// Get は状態と revision を返す。
+func (s *StatusStore) Get(ctx context.Context, id string) (message.Status, uint64, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return message.Status{}, 0, err
+	}
+	entry, err := kv.Get(ctx, id)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return message.Status{}, 0, status.ErrNotFound
+	}
+	if err != nil {
+		return message.Status{}, 0, fmt.Errorf("status get %s: %w", id, err)
+	}
+	var st message.Status
+	if err := json.Unmarshal(entry.Value(), &st); err != nil {
+		return message.Status{}, 0, fmt.Errorf("status decode %s: %w", id, err)
+	}
+	return st, entry.Revision(), nil
+}
+
+// Create は未記録のIDに状態を保存する。
+func (s *StatusStore) Create(ctx context.Context, st message.Status) error {
+	kv, data, err := s.prepare(ctx, st)
+	if err != nil {
+		return err
+	}
+	_, err = kv.Create(ctx, st.MessageID, data)
+	return s.wrap(st.MessageID, err)
+}
+
+// Update は revision が最新の場合だけ上書きする。
+func (s *StatusStore) Update(ctx context.Context, st message.Status, revision uint64) error {
+	kv, data, err := s.prepare(ctx, st)
+	if err != nil {
+		return err
+	}
+	_, err = kv.Update(ctx, st.MessageID, data, revision)
+	return s.wrap(st.MessageID, err)
+}
+
+func (s *StatusStore) prepare(ctx context.Context, st message.Status) (jetstream.KeyValue, []byte, error) {
+	kv, err := s.keyValue(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, nil, fmt.Errorf("status encode %s: %w", st.MessageID, err)
+	}
+	return kv, data, nil
+}
+
+func (s *StatusStore) wrap(id string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	// revision が合わない場合もキーが既にある場合と同じエラーコードで返る。
+	case errors.Is(err, jetstream.ErrKeyExists):
+		return status.ErrConflict
+	default:
+		return fmt.Errorf("status put %s: %w", id, err)
+	}
+}
+
+func (s *StatusStore) keyValue(ctx context.Context) (jetstream.KeyValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv != nil {
+		return s.kv, nil
+	}
+	kv, err := s.js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:  s.bucket,
+		TTL:     s.ttl,
+		Storage: jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensure status bucket %s: %w", s.bucket, err)
+	}
+	s.kv = kv
+	return kv, nil
+}
@@ -2,9 +2,12 @@ package tenant
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
 )
 
 // Config はmessageサービス全体のテナント設定を表す。
@@ -14,19 +17,107 @@ type Config struct {
 
 // MessageTenant は1テナント分のメッセージ設定。
 type MessageTenant struct {
-	NATSURL            string        `yaml:"natsURL"`
-	LineSubject        string        `yaml:"lineSubject"`
-	DiscordSubject     string        `yaml:"discordSubject"`
-	IngressTimeout     time.Duration `yaml:"ingressTimeout"`
-	WorkerHTTPTimeout  time.Duration `yaml:"workerHTTPTimeout"`
-	Line               LineConfig    `yaml:"line"`
-	Discord            DiscordConfig `yaml:"discord"`
+	NATSURL           string            `yaml:"natsURL"`
+	LineSubject       string            `yaml:"lineSubject"`
+	DiscordSubject    string            `yaml:"discordSubject"`
+	IngressTimeout    time.Duration     `yaml:"ingressTimeout"`
+	WorkerHTTPTimeout time.Duration     `yaml:"workerHTTPTimeout"`
+	Line              LineConfig        `yaml:"line"`
+	Discord           DiscordConfig     `yaml:"discord"`
+	ServiceAuth       ServiceAuthConfig `yaml:"serviceAuth"`
+	Delivery          DeliveryConfig    `yaml:"delivery"`
+	Status            StatusConfig      `yaml:"status"`
+	Schedule          ScheduleConfig    `yaml:"schedule"`
+	Events            EventsConfig      `yaml:"events"`
+	// Templates は /send の templateId で使う名前付きテンプレート。読み込み時に構文を検証する。
+	Templates map[string]msgtemplate.Definition `yaml:"templates"`
+}
+
+// 配送状態の保存先。
+const (
+	StatusBackendNATSKV = "nats-kv"
+	StatusBackendMemory = "memory"
+)
+
+// StatusConfig は配送状態の記録先の設定。省略した項目は Loader が既定値で補う。
+type StatusConfig struct {
+	// Backend は nats-kv（既定）か memory。memory はプロセス内だけで共有されるためローカル検証用。
+	Backend string `yaml:"backend"`
+	// Bucket は nats-kv のバケット名（既定 MESSAGE_STATUS_<tenantID>）。
+	Bucket string `yaml:"bucket"`
+	// TTL は最後の更新から状態を残す期間。
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// ScheduleConfig は配送予約（/send の sendAt・delay）の設定。省略した項目は Loader が既定値で補う。
+// 予約は ingress と worker で共有するため、常に NATS の Key-Value バケットに保存する。
+type ScheduleConfig struct {
+	// Bucket は予約を保存するバケット名（既定 MESSAGE_SCHEDULE_<tenantID>）。
+	Bucket string `yaml:"bucket"`
+	// MaxDelay は今から予約できる期間（既定 status.ttl）。予約中に配送状態が消えないよう status.ttl 以下にする。
+	MaxDelay time.Duration `yaml:"maxDelay"`
+	// PollInterval は worker が送る時刻になった予約を確かめる間隔。
+	PollInterval time.Duration `yaml:"pollInterval"`
+}
+
+// EventsConfig は webhook が中継する受信イベントの publish 先。省略した項目は Loader が既定値で補う。
+// 送信要求とは別のストリームに置き、worker の配送や配送不能キューに混ぜない。
+type EventsConfig struct {
+	// Stream は受信イベントのストリーム名（既定 MESSAGE_EVENTS_<tenantID>）。保持期間は delivery.maxAge に合わせる。
+	Stream string `yaml:"stream"`
+	// LineSubject はLINEの受信イベントのサブジェクト（既定 line.inbound.<tenantID>）。
+	LineSubject string `yaml:"lineSubject"`
+}
+
+// DeliveryConfig はJetStreamによる配送の設定。省略した項目は Loader が既定値で補う。
+type DeliveryConfig struct {
+	// Stream はテナントのストリーム名（既定 MESSAGE_<tenantID>）。
+	Stream string `yaml:"stream"`
+	// DeadLetterSubject は配送を諦めたメッセージの行き先（既定 message.dlq.<tenantID>）。
+	DeadLetterSubject string `yaml:"deadLetterSubject"`
+	// MaxDeliver は1メッセージあたりの最大配送回数。
+	MaxDeliver int `yaml:"maxDeliver"`
+	// AckWait は worker が応答しないまま処理中とみなす期間。過ぎると JetStream が再配送する。
+	AckWait time.Duration `yaml:"ackWait"`
+	// Backoff は再送間隔の初期値で、再送ごとに倍にして MaxBackoff で頭打ちにする。
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// MaxAge はストリームにメッセージを残す期間。
+	MaxAge time.Duration `yaml:"maxAge"`
+	// DuplicateWindow は /send の冪等キーで重複を除く期間。MaxAge 以下にする。
+	DuplicateWindow time.Duration `yaml:"duplicateWindow"`
+}
+
+// StreamSubjects はテナントのストリームが受け持つサブジェクトを返す。
+func (t MessageTenant) StreamSubjects() []string {
+	var subjects []string
+	for _, s := range []string{t.LineSubject, t.DiscordSubject, t.Delivery.DeadLetterSubject} {
+		if s = strings.TrimSpace(s); s != "" {
+			subjects = append(subjects, s)
+		}
+	}
+	return subjects
+}
+
+// ServiceAuthConfig は /send の呼び出し元を認証する設定。
+// issuer を設定すると、authが client_credentials で発行した message:send スコープのトークンを必須にする。
+type ServiceAuthConfig struct {
+	Issuer  string `yaml:"issuer"`
+	JWKSURL string `yaml:"jwksURL"`
 }
 
 // LineConfig はLINE送信用の資格情報。
+// ChannelSecret はWebhookの X-Line-Signature 検証に使い、未設定のテナントはWebhookを受け付けない。
+// マルチキャスト・ブロードキャスト・ナローキャストと進捗照会のエンドポイントは、省略すると
+// pushEndpoint が .../message/push の形ならそこから導く。
 type LineConfig struct {
-	PushEndpoint string `yaml:"pushEndpoint"`
-	ChannelToken string `yaml:"channelToken"`
+	PushEndpoint               string `yaml:"pushEndpoint"`
+	MulticastEndpoint          string `yaml:"multicastEndpoint"`
+	BroadcastEndpoint          string `yaml:"broadcastEndpoint"`
+	NarrowcastEndpoint         string `yaml:"narrowcastEndpoint"`
+	NarrowcastProgressEndpoint string `yaml:"narrowcastProgressEndpoint"`
+	ChannelToken               string `yaml:"channelToken"`
+	ChannelSecret              string `yaml:"channelSecret"`
 }
 
 // DiscordConfig はDiscord送信用の資格情報。
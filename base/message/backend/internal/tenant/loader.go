@@ -6,6 +6,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
 )
 
 // Loader はテナント設定を保持し、参照用APIを提供する。
@@ -22,6 +25,9 @@ func NewLoader(path string) (*Loader, error) {
 	if err := validateConfig(cfg); err != nil {
 		return nil, err
 	}
+	for id, t := range cfg.Message {
+		cfg.Message[id] = applyDefaults(id, t)
+	}
 	return &Loader{cfg: cfg}, nil
 }
 
@@ -128,9 +134,220 @@ func validateTenant(id string, t MessageTenant) error {
 	if t.WorkerHTTPTimeout <= 0 {
 		return fmt.Errorf("tenant %s: workerHTTPTimeout must be positive", id)
 	}
+	if err := validateDelivery(id, t); err != nil {
+		return err
+	}
+	if err := validateStatus(id, t.Status); err != nil {
+		return err
+	}
+	if err := validateSchedule(id, t); err != nil {
+		return err
+	}
+	if err := validateEvents(id, t); err != nil {
+		return err
+	}
+	if _, err := msgtemplate.Compile(t.Templates); err != nil {
+		return fmt.Errorf("tenant %s: templates: %w", id, err)
+	}
+	return nil
+}
+
+// 配送設定の既定値。
+const (
+	defaultMaxDeliver = 5
+	defaultAckWait    = 30 * time.Second
+	defaultBackoff    = 5 * time.Second
+	defaultMaxBackoff = 5 * time.Minute
+	defaultMaxAge     = 72 * time.Hour
+	defaultDuplicates = time.Hour
+	defaultStatusTTL  = 7 * 24 * time.Hour
+	defaultPoll       = time.Second
+)
+
+func validateDelivery(id string, t MessageTenant) error {
+	d := t.Delivery
+	if strings.ContainsAny(d.Stream, ".*> \t") {
+		return fmt.Errorf("tenant %s: delivery.stream must not contain '.', '*', '>' or whitespace", id)
+	}
+	if d.MaxDeliver < 0 || d.AckWait < 0 || d.Backoff < 0 || d.MaxBackoff < 0 || d.MaxAge < 0 || d.DuplicateWindow < 0 {
+		return fmt.Errorf("tenant %s: delivery values must not be negative", id)
+	}
+	if d.Backoff > 0 && d.MaxBackoff > 0 && d.Backoff > d.MaxBackoff {
+		return fmt.Errorf("tenant %s: delivery.backoff must not exceed delivery.maxBackoff", id)
+	}
+	// 1回のHTTP呼び出しが AckWait を超えると、処理中に JetStream が再配送して二重に送ってしまう。
+	ackWait := d.AckWait
+	if ackWait == 0 {
+		ackWait = defaultAckWait
+	}
+	if ackWait <= t.WorkerHTTPTimeout {
+		return fmt.Errorf("tenant %s: delivery.ackWait must be longer than workerHTTPTimeout", id)
+	}
+	maxAge := d.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	if d.DuplicateWindow > maxAge {
+		return fmt.Errorf("tenant %s: delivery.duplicateWindow must not exceed delivery.maxAge", id)
+	}
+	dlq := strings.TrimSpace(d.DeadLetterSubject)
+	if dlq != "" && (dlq == strings.TrimSpace(t.LineSubject) || dlq == strings.TrimSpace(t.DiscordSubject)) {
+		return fmt.Errorf("tenant %s: delivery.deadLetterSubject must differ from line/discord subjects", id)
+	}
+	return nil
+}
+
+func validateStatus(id string, s StatusConfig) error {
+	switch s.Backend {
+	case "", StatusBackendNATSKV, StatusBackendMemory:
+	default:
+		return fmt.Errorf("tenant %s: status.backend must be %s or %s", id, StatusBackendNATSKV, StatusBackendMemory)
+	}
+	if !validBucket(s.Bucket) {
+		return fmt.Errorf("tenant %s: status.bucket may contain only letters, digits, '-' and '_'", id)
+	}
+	if s.TTL < 0 {
+		return fmt.Errorf("tenant %s: status.ttl must not be negative", id)
+	}
+	return nil
+}
+
+func validateSchedule(id string, t MessageTenant) error {
+	s := t.Schedule
+	if !validBucket(s.Bucket) {
+		return fmt.Errorf("tenant %s: schedule.bucket may contain only letters, digits, '-' and '_'", id)
+	}
+	if s.MaxDelay < 0 || s.PollInterval < 0 {
+		return fmt.Errorf("tenant %s: schedule values must not be negative", id)
+	}
+	ttl := t.Status.TTL
+	if ttl == 0 {
+		ttl = defaultStatusTTL
+	}
+	if s.MaxDelay > ttl {
+		return fmt.Errorf("tenant %s: schedule.maxDelay must not exceed status.ttl", id)
+	}
+	if s.Bucket != "" && s.Bucket == t.Status.Bucket {
+		return fmt.Errorf("tenant %s: schedule.bucket must differ from status.bucket", id)
+	}
+	return nil
+}
+
+func validateEvents(id string, t MessageTenant) error {
+	e := t.Events
+	if strings.ContainsAny(e.Stream, ".*> \t") {
+		return fmt.Errorf("tenant %s: events.stream must not contain '.', '*', '>' or whitespace", id)
+	}
+	// 既定値を補う前に検証するので、省略された配送設定は既定値と比べる。
+	d := applyDefaults(id, t).Delivery
+	if e.Stream != "" && e.Stream == d.Stream {
+		return fmt.Errorf("tenant %s: events.stream must differ from delivery.stream", id)
+	}
+	subject := strings.TrimSpace(e.LineSubject)
+	if subject == "" {
+		return nil
+	}
+	for _, s := range []string{t.LineSubject, t.DiscordSubject, d.DeadLetterSubject} {
+		if subject == strings.TrimSpace(s) {
+			return fmt.Errorf("tenant %s: events.lineSubject must differ from line/discord/dead-letter subjects", id)
+		}
+	}
 	return nil
 }
 
+// validBucket は Key-Value バケット名に使える文字だけかを返す。空なら既定値を使うので true。
+func validBucket(name string) bool {
+	for _, c := range name {
+		if !(c == '-' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDefaults は省略された配送設定・状態記録・配送予約・受信イベントの設定を既定値で補う。
+func applyDefaults(id string, t MessageTenant) MessageTenant {
+	d := &t.Delivery
+	if strings.TrimSpace(d.Stream) == "" {
+		d.Stream = "MESSAGE_" + id
+	}
+	if strings.TrimSpace(d.DeadLetterSubject) == "" {
+		d.DeadLetterSubject = "message.dlq." + id
+	}
+	if d.MaxDeliver == 0 {
+		d.MaxDeliver = defaultMaxDeliver
+	}
+	if d.AckWait == 0 {
+		d.AckWait = defaultAckWait
+	}
+	if d.Backoff == 0 {
+		d.Backoff = defaultBackoff
+	}
+	if d.MaxBackoff == 0 {
+		d.MaxBackoff = defaultMaxBackoff
+	}
+	if d.Backoff > d.MaxBackoff {
+		d.MaxBackoff = d.Backoff
+	}
+	if d.MaxAge == 0 {
+		d.MaxAge = defaultMaxAge
+	}
+	if d.DuplicateWindow == 0 {
+		d.DuplicateWindow = min(defaultDuplicates, d.MaxAge)
+	}
+	applyLineDefaults(&t.Line)
+	st := &t.Status
+	if st.Backend == "" {
+		st.Backend = StatusBackendNATSKV
+	}
+	if st.Bucket == "" {
+		st.Bucket = "MESSAGE_STATUS_" + id
+	}
+	if st.TTL == 0 {
+		st.TTL = defaultStatusTTL
+	}
+	sc := &t.Schedule
+	if sc.Bucket == "" {
+		sc.Bucket = "MESSAGE_SCHEDULE_" + id
+	}
+	if sc.MaxDelay == 0 {
+		sc.MaxDelay = st.TTL
+	}
+	if sc.PollInterval == 0 {
+		sc.PollInterval = defaultPoll
+	}
+	ev := &t.Events
+	if strings.TrimSpace(ev.Stream) == "" {
+		ev.Stream = "MESSAGE_EVENTS_" + id
+	}
+	if strings.TrimSpace(ev.LineSubject) == "" {
+		ev.LineSubject = "line.inbound." + id
+	}
+	return t
+}
+
+// applyLineDefaults は省略されたLINEのエンドポイントを pushEndpoint から導く。
+// pushEndpoint が .../message/push の形でなければ導かず、そのAPIは使えないままにする。
+func applyLineDefaults(l *LineConfig) {
+	base, ok := strings.CutSuffix(strings.TrimSpace(l.PushEndpoint), "/message/push")
+	if !ok {
+		return
+	}
+	for _, e := range []struct {
+		field *string
+		path  string
+	}{
+		{&l.MulticastEndpoint, "/message/multicast"},
+		{&l.BroadcastEndpoint, "/message/broadcast"},
+		{&l.NarrowcastEndpoint, "/message/narrowcast"},
+		{&l.NarrowcastProgressEndpoint, "/message/progress/narrowcast"},
+	} {
+		if strings.TrimSpace(*e.field) == "" {
+			*e.field = base + e.path
+		}
+	}
+}
+
 // Tenants は全テナントの設定をコピーして返す。
 func (l *Loader) Tenants() map[string]MessageTenant {
 	out := make(map[string]MessageTenant, len(l.cfg.Message))
@@ -3,6 +3,7 @@ package tenant
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -183,3 +184,362 @@ message:
 		t.Fatalf("webhook not overridden: %s", dup.Discord.WebhookURL)
 	}
 }
+
+// 配送設定の既定値と検証を確認する。
+func TestNewLoader_Delivery(t *testing.T) {
+	t.Parallel()
+
+	base := `
+message:
+  a:
+    natsURL: nats://nats:4222
+    lineSubject: line.events.a
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
+    line:
+      pushEndpoint: https://api.line.me/v2/bot/message/push
+      channelToken: tok
+`
+	tests := []struct {
+		name      string
+		delivery  string
+		want      DeliveryConfig
+		wantError bool
+	}{
+		{name: "省略時は既定値", want: DeliveryConfig{Stream: "MESSAGE_a", DeadLetterSubject: "message.dlq.a", MaxDeliver: 5, AckWait: 30 * time.Second, Backoff: 5 * time.Second, MaxBackoff: 5 * time.Minute, MaxAge: 72 * time.Hour, DuplicateWindow: time.Hour}},
+		{
+			name:     "指定値を優先",
+			delivery: "    delivery:\n      stream: A_OUT\n      deadLetterSubject: dlq.a\n      maxDeliver: 3\n      ackWait: 2m\n      backoff: 1m\n      maxAge: 24h\n      duplicateWindow: 10m\n",
+			want:     DeliveryConfig{Stream: "A_OUT", DeadLetterSubject: "dlq.a", MaxDeliver: 3, AckWait: 2 * time.Minute, Backoff: time.Minute, MaxBackoff: 5 * time.Minute, MaxAge: 24 * time.Hour, DuplicateWindow: 10 * time.Minute},
+		},
+		{
+			name:     "保持期間が短ければ重複排除もそれに合わせる",
+			delivery: "    delivery:\n      maxAge: 30m\n",
+			want:     DeliveryConfig{Stream: "MESSAGE_a", DeadLetterSubject: "message.dlq.a", MaxDeliver: 5, AckWait: 30 * time.Second, Backoff: 5 * time.Second, MaxBackoff: 5 * time.Minute, MaxAge: 30 * time.Minute, DuplicateWindow: 30 * time.Minute},
+		},
+		{name: "ストリーム名にドット", delivery: "    delivery:\n      stream: a.b\n", wantError: true},
+		{name: "負の配送回数", delivery: "    delivery:\n      maxDeliver: -1\n", wantError: true},
+		{name: "AckWaitがHTTPタイムアウト以下", delivery: "    delivery:\n      ackWait: 1s\n", wantError: true},
+		{name: "初期間隔が上限超え", delivery: "    delivery:\n      backoff: 10m\n      maxBackoff: 1m\n", wantError: true},
+		{name: "重複排除が保持期間超え", delivery: "    delivery:\n      duplicateWindow: 100h\n", wantError: true},
+		{name: "DLQが送信サブジェクトと同じ", delivery: "    delivery:\n      deadLetterSubject: line.events.a\n", wantError: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.delivery), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, _ := loader.MessageConfig("a")
+			if cfg.Delivery != tt.want {
+				t.Fatalf("delivery=%+v want=%+v", cfg.Delivery, tt.want)
+			}
+			subjects := cfg.StreamSubjects()
+			if len(subjects) != 2 || subjects[1] != tt.want.DeadLetterSubject {
+				t.Fatalf("subjects=%v", subjects)
+			}
+		})
+	}
+}
+
+// 配送状態の記録先の既定値と検証を確認する。
+func TestNewLoader_Status(t *testing.T) {
+	t.Parallel()
+
+	base := `
+message:
+  a:
+    natsURL: nats://nats:4222
+    lineSubject: line.events.a
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
+    line:
+      pushEndpoint: https://api.line.me/v2/bot/message/push
+      channelToken: tok
+`
+	tests := []struct {
+		name      string
+		status    string
+		want      StatusConfig
+		wantError bool
+	}{
+		{name: "省略時は既定値", want: StatusConfig{Backend: "nats-kv", Bucket: "MESSAGE_STATUS_a", TTL: 7 * 24 * time.Hour}},
+		{
+			name:   "指定値を優先",
+			status: "    status:\n      backend: memory\n      bucket: a-status\n      ttl: 1h\n",
+			want:   StatusConfig{Backend: "memory", Bucket: "a-status", TTL: time.Hour},
+		},
+		{name: "未知のバックエンド", status: "    status:\n      backend: redis\n", wantError: true},
+		{name: "バケット名にドット", status: "    status:\n      bucket: a.status\n", wantError: true},
+		{name: "負の保持期間", status: "    status:\n      ttl: -1h\n", wantError: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.status), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, _ := loader.MessageConfig("a")
+			if cfg.Status != tt.want {
+				t.Fatalf("status=%+v want=%+v", cfg.Status, tt.want)
+			}
+		})
+	}
+}
+
+// 配送予約の設定は省略すると既定値で補い、予約できる期間は状態の保存期間以下に限ることを確認する。
+func TestNewLoader_Schedule(t *testing.T) {
+	t.Parallel()
+
+	base := `
+message:
+  a:
+    natsURL: nats://nats:4222
+    lineSubject: line.events.a
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
+    line:
+      pushEndpoint: https://api.line.me/v2/bot/message/push
+      channelToken: tok
+`
+	tests := []struct {
+		name      string
+		extra     string
+		want      ScheduleConfig
+		wantError bool
+	}{
+		{name: "省略時は既定値", want: ScheduleConfig{Bucket: "MESSAGE_SCHEDULE_a", MaxDelay: 7 * 24 * time.Hour, PollInterval: time.Second}},
+		{
+			name:  "期間の既定は状態の保存期間",
+			extra: "    status:\n      ttl: 48h\n",
+			want:  ScheduleConfig{Bucket: "MESSAGE_SCHEDULE_a", MaxDelay: 48 * time.Hour, PollInterval: time.Second},
+		},
+		{
+			name:  "指定値を優先",
+			extra: "    schedule:\n      bucket: a-schedule\n      maxDelay: 24h\n      pollInterval: 5s\n",
+			want:  ScheduleConfig{Bucket: "a-schedule", MaxDelay: 24 * time.Hour, PollInterval: 5 * time.Second},
+		},
+		{name: "状態の保存期間より長い", extra: "    status:\n      ttl: 24h\n    schedule:\n      maxDelay: 48h\n", wantError: true},
+		{name: "状態と同じバケット", extra: "    status:\n      bucket: a-kv\n    schedule:\n      bucket: a-kv\n", wantError: true},
+		{name: "バケット名にドット", extra: "    schedule:\n      bucket: a.schedule\n", wantError: true},
+		{name: "負の間隔", extra: "    schedule:\n      pollInterval: -1s\n", wantError: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.extra), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, _ := loader.MessageConfig("a")
+			if cfg.Schedule != tt.want {
+				t.Fatalf("schedule=%+v want=%+v", cfg.Schedule, tt.want)
+			}
+		})
+	}
+}
+
+// 受信イベントの publish 先の既定値と、送信要求のストリーム・サブジェクトと重ならないことを確認する。
+func TestNewLoader_Events(t *testing.T) {
+	t.Parallel()
+
+	base := `
+message:
+  a:
+    natsURL: nats://nats:4222
+    lineSubject: line.events.a
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
+    line:
+      pushEndpoint: https://api.line.me/v2/bot/message/push
+      channelToken: tok
+`
+	tests := []struct {
+		name      string
+		extra     string
+		want      EventsConfig
+		wantError bool
+	}{
+		{name: "省略時は既定値", want: EventsConfig{Stream: "MESSAGE_EVENTS_a", LineSubject: "line.inbound.a"}},
+		{
+			name:  "指定値を優先",
+			extra: "    events:\n      stream: A_IN\n      lineSubject: line.received.a\n",
+			want:  EventsConfig{Stream: "A_IN", LineSubject: "line.received.a"},
+		},
+		{name: "送信サブジェクトと同じ", extra: "    events:\n      lineSubject: line.events.a\n", wantError: true},
+		{name: "既定のDLQと同じ", extra: "    events:\n      lineSubject: message.dlq.a\n", wantError: true},
+		{name: "既定の配送ストリームと同じ", extra: "    events:\n      stream: MESSAGE_a\n", wantError: true},
+		{name: "ストリーム名にドット", extra: "    events:\n      stream: a.in\n", wantError: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.extra), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, _ := loader.MessageConfig("a")
+			if cfg.Events != tt.want {
+				t.Fatalf("events=%+v want=%+v", cfg.Events, tt.want)
+			}
+		})
+	}
+}
+
+// テンプレートは読み込み時に構文を検証し、不正ならテナント名付きのエラーにすることを確認する。
+func TestNewLoader_Templates(t *testing.T) {
+	t.Parallel()
+
+	base := `
+message:
+  a:
+    natsURL: nats://nats:4222
+    discordSubject: discord.incoming.a
+    ingressTimeout: 5s
+    workerHTTPTimeout: 5s
+    discord:
+      webhookURL: https://discord.com/api/webhooks/x/y
+    templates:
+      welcome:
+        locales:
+          ja:
+`
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "テキスト", body: "            text: \"ようこそ {{.name}} さん\"\n"},
+		{name: "埋め込み", body: "            discord:\n              embeds:\n                - title: \"{{.name}}\"\n"},
+		{name: "構文エラー", body: "            text: \"{{if .name}}\"\n", wantErr: "tenant a: templates:"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.body), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, _ := loader.MessageConfig("a")
+			if _, ok := cfg.Templates["welcome"].Locales["ja"]; !ok {
+				t.Fatalf("templates=%+v", cfg.Templates)
+			}
+		})
+	}
+}
+
+// LINEの各エンドポイントは省略すると pushEndpoint から導き、指定値はそのまま使うことを確認する。
+func TestNewLoader_LineEndpoints(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		line string
+		want LineConfig
+	}{
+		{
+			name: "pushEndpointから導く",
+			line: "      pushEndpoint: https://api.line.me/v2/bot/message/push\n",
+			want: LineConfig{
+				PushEndpoint:               "https://api.line.me/v2/bot/message/push",
+				MulticastEndpoint:          "https://api.line.me/v2/bot/message/multicast",
+				BroadcastEndpoint:          "https://api.line.me/v2/bot/message/broadcast",
+				NarrowcastEndpoint:         "https://api.line.me/v2/bot/message/narrowcast",
+				NarrowcastProgressEndpoint: "https://api.line.me/v2/bot/message/progress/narrowcast",
+			},
+		},
+		{
+			name: "指定値を優先",
+			line: "      pushEndpoint: https://api.line.me/v2/bot/message/push\n      multicastEndpoint: http://mock/multicast\n",
+			want: LineConfig{
+				PushEndpoint:               "https://api.line.me/v2/bot/message/push",
+				MulticastEndpoint:          "http://mock/multicast",
+				BroadcastEndpoint:          "https://api.line.me/v2/bot/message/broadcast",
+				NarrowcastEndpoint:         "https://api.line.me/v2/bot/message/narrowcast",
+				NarrowcastProgressEndpoint: "https://api.line.me/v2/bot/message/progress/narrowcast",
+			},
+		},
+		{
+			name: "導けない形なら空のまま",
+			line: "      pushEndpoint: http://mock/push\n",
+			want: LineConfig{PushEndpoint: "http://mock/push"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := "message:\n  a:\n    natsURL: nats://nats:4222\n    lineSubject: line.events.a\n    ingressTimeout: 5s\n    workerHTTPTimeout: 5s\n    line:\n      channelToken: tok\n" + tt.line
+			path := filepath.Join(t.TempDir(), "t.yaml")
+			if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loader, err := NewLoader(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _ := loader.MessageConfig("a")
+			tt.want.ChannelToken = "tok"
+			if got.Line != tt.want {
+				t.Fatalf("line=%+v\nwant=%+v", got.Line, tt.want)
+			}
+		})
+	}
+}
@@ -7,13 +7,34 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
 	"github.com/sngm3741/roots/base/message/internal/infra/nats"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
-// Publisher は宛先ごとにNATSへpublishする。
+// Publisher は宛先ごとにNATSへpublishする。msgID が重複排除の期間内に保存済みなら duplicate=true を返す。
 type Publisher interface {
-	Publish(ctx context.Context, subject string, data []byte) error
+	Publish(ctx context.Context, subject, msgID string, data []byte) (duplicate bool, err error)
+}
+
+// StatusRecorder は配送状態を記録・参照する。status.Tracker が満たす。
+type StatusRecorder interface {
+	Record(ctx context.Context, id, destination string, state message.State, reason string, attempt int) error
+	Get(ctx context.Context, id string) (message.Status, error)
+}
+
+// Scheduler は配送予約を登録する。schedule.Service が満たす。
+// 同じメッセージIDの予約が既にあれば登録せずに duplicate=true を返す。
+type Scheduler interface {
+	Add(ctx context.Context, entry message.Scheduled) (duplicate bool, err error)
+}
+
+// TemplateRenderer はテナントのテンプレートを展開する。msgtemplate.Set が満たす。
+type TemplateRenderer interface {
+	Render(id, locale string, ch msgtemplate.Channel, params map[string]any) (msgtemplate.Rendered, error)
 }
 
 // Subjects は宛先→NATSサブジェクトのマッピング。
@@ -26,48 +47,288 @@ type Subjects struct {
 type Service struct {
 	publisher Publisher
 	subjects  Subjects
+	status    StatusRecorder
+	scheduler Scheduler
+	templates TemplateRenderer
+	logger    func(format string, v ...any)
 }
 
-// NewService は送信サービスを生成する。
-func NewService(publisher Publisher, subjects Subjects) *Service {
+// NewService は送信サービスを生成する。status が nil なら配送状態を記録しない。
+// scheduler が nil なら予約（sendAt・delay）を、templates が nil ならテンプレートを受け付けない。
+func NewService(publisher Publisher, subjects Subjects, status StatusRecorder, scheduler Scheduler, templates TemplateRenderer, logger func(format string, v ...any)) *Service {
 	return &Service{
 		publisher: publisher,
 		subjects:  subjects,
+		status:    status,
+		scheduler: scheduler,
+		templates: templates,
+		logger:    logger,
 	}
 }
 
+// SendInput は送信要求の入力。
+type SendInput struct {
+	Destination string
+	UserID      string
+	// UserIDs は line-multicast の宛先（最大 message.MaxRecipients 件）。
+	UserIDs []string
+	// Narrowcast は line-narrowcast の宛先（オーディエンス）と絞り込み条件（属性情報）・上限数。
+	Narrowcast json.RawMessage
+	Text       string
+	// Messages はLINE宛の型付きメッセージ（最大5件）。Text とは同時に指定できない。
+	Messages []json.RawMessage
+	// Discord はDiscord宛の投稿内容（埋め込み・添付ファイル・スレッド）。Text とは同時に指定できない。
+	Discord json.RawMessage
+	// IdempotencyKey を指定すると、同じキーの要求は重複排除の期間内は1度だけ送る。
+	IdempotencyKey string
+	// SendAt・Delay のどちらかを指定すると、その時刻まで予約してから送る。過ぎた時刻ならすぐ送る。
+	SendAt time.Time
+	Delay  time.Duration
+	// TemplateID を指定すると、テナントのテンプレートを Locale と宛先に合わせて Params で展開した本文を送る。
+	// Text・Messages・Discord とは同時に指定できない。
+	TemplateID string
+	Locale     string
+	Params     map[string]any
+}
+
+// SendResult は受け付けたメッセージの情報。
+type SendResult struct {
+	MessageID string
+	// Duplicate は同じ冪等キーの要求を既に受け付けていたことを表す。MessageID は最初の要求と同じ。
+	Duplicate bool
+	// SendAt は予約した場合の送る時刻。すぐ送る場合はゼロ値。
+	SendAt time.Time
+}
+
 // Send は宛先/本文を検証し、NATSにpublishする。
-func (s *Service) Send(ctx context.Context, destination, userID, text string) error {
-	dest := strings.TrimSpace(destination)
+func (s *Service) Send(ctx context.Context, in SendInput) (SendResult, error) {
+	dest := strings.TrimSpace(in.Destination)
 	if dest == "" {
-		return message.ErrEmptyDestination
+		return SendResult{}, message.ErrEmptyDestination
+	}
+	sendAt, err := s.resolveSendAt(in, message.NowUTC())
+	if err != nil {
+		return SendResult{}, err
+	}
+	id := message.NewID()
+	if in.IdempotencyKey != "" {
+		var err error
+		if id, err = message.IDFromKey(in.IdempotencyKey); err != nil {
+			return SendResult{}, err
+		}
+	}
+	if in.TemplateID != "" {
+		if in, err = s.applyTemplate(in, dest); err != nil {
+			return SendResult{}, err
+		}
+	} else if in.Locale != "" || in.Params != nil {
+		return SendResult{}, message.ErrParamsWithoutTemplate
+	}
+	var lineMessages []linemsg.Message
+	if len(in.Messages) > 0 {
+		var err error
+		if lineMessages, err = linemsg.Parse(in.Messages); err != nil {
+			return SendResult{}, err
+		}
 	}
-	msg, err := message.New(dest, userID, text, message.NowUTC())
+	var narrowcast *linemsg.Narrowcast
+	if len(in.Narrowcast) > 0 {
+		var err error
+		if narrowcast, err = linemsg.ParseNarrowcast(in.Narrowcast); err != nil {
+			return SendResult{}, err
+		}
+	}
+	var discord *discordmsg.Payload
+	if len(in.Discord) > 0 {
+		p, err := discordmsg.Parse(in.Discord)
+		if err != nil {
+			return SendResult{}, err
+		}
+		discord = &p
+	}
+	msg, err := message.New(message.Params{
+		ID:           id,
+		Destination:  dest,
+		UserID:       in.UserID,
+		UserIDs:      in.UserIDs,
+		Narrowcast:   narrowcast,
+		Text:         in.Text,
+		LineMessages: lineMessages,
+		Discord:      discord,
+		ReceivedAt:   message.NowUTC(),
+	})
+	if err != nil {
+		return SendResult{}, err
+	}
+	if !sendAt.IsZero() {
+		return s.schedule(ctx, msg, sendAt)
+	}
+	return s.publish(ctx, msg)
+}
+
+// applyTemplate は TemplateID のテンプレートを展開し、本文に入れた SendInput を返す。
+// 展開した本文は直接指定された本文と同じ検証にかける。
+func (s *Service) applyTemplate(in SendInput, dest string) (SendInput, error) {
+	if strings.TrimSpace(in.Text) != "" || len(in.Messages) > 0 || len(in.Discord) > 0 {
+		return in, message.ErrTemplateWithBody
+	}
+	if s.templates == nil {
+		return in, fmt.Errorf("%w: %s", msgtemplate.ErrNotFound, in.TemplateID)
+	}
+	ch := msgtemplate.ChannelLine
+	if dest == message.DestinationDiscord {
+		ch = msgtemplate.ChannelDiscord
+	}
+	rendered, err := s.templates.Render(in.TemplateID, in.Locale, ch, in.Params)
 	if err != nil {
-		return err
+		return in, err
 	}
+	in.Text, in.Messages, in.Discord = rendered.Text, rendered.Messages, rendered.Discord
+	return in, nil
+}
+
+// resolveSendAt は予約の送る時刻を返す。すぐ送る場合はゼロ値。
+func (s *Service) resolveSendAt(in SendInput, now time.Time) (time.Time, error) {
+	var at time.Time
+	switch {
+	case !in.SendAt.IsZero() && in.Delay != 0:
+		return time.Time{}, message.ErrSendAtWithDelay
+	case in.Delay < 0:
+		return time.Time{}, message.ErrNegativeDelay
+	case in.Delay > 0:
+		at = now.Add(in.Delay)
+	case !in.SendAt.IsZero():
+		at = in.SendAt.UTC()
+	}
+	if !at.After(now) {
+		return time.Time{}, nil
+	}
+	if s.scheduler == nil {
+		return time.Time{}, fmt.Errorf("scheduled delivery is not configured")
+	}
+	return at, nil
+}
 
+// EditInput は送信済みのDiscord投稿の編集要求。本文は Text か Discord のどちらか。
+type EditInput struct {
+	// TargetID は編集する投稿を送った送信要求のメッセージID。
+	TargetID string
+	Text     string
+	// Discord は置き換える本文と埋め込み。添付ファイルとスレッドは変えられない。
+	Discord json.RawMessage
+}
+
+// Edit は送信済みのDiscord投稿を編集する要求をpublishする。編集は投稿と同じ順序で worker が処理し、
+// 対象がまだ送られていなければ送られるまで再送で待つ。
+func (s *Service) Edit(ctx context.Context, in EditInput) (SendResult, error) {
+	var payload discordmsg.Payload
+	switch {
+	case len(in.Discord) > 0 && strings.TrimSpace(in.Text) != "":
+		return SendResult{}, message.ErrTextWithDiscord
+	case len(in.Discord) > 0:
+		p, err := discordmsg.ParseEdit(in.Discord)
+		if err != nil {
+			return SendResult{}, err
+		}
+		payload = p
+	case strings.TrimSpace(in.Text) != "":
+		payload = discordmsg.Payload{Content: strings.TrimSpace(in.Text)}
+		if err := payload.ValidateEdit(); err != nil {
+			return SendResult{}, err
+		}
+	default:
+		return SendResult{}, message.ErrEmptyText
+	}
+	return s.modify(ctx, message.ActionEdit, in.TargetID, &payload)
+}
+
+// Delete は送信済みのDiscord投稿を削除する要求をpublishする。
+func (s *Service) Delete(ctx context.Context, targetID string) (SendResult, error) {
+	return s.modify(ctx, message.ActionDelete, targetID, nil)
+}
+
+// modify は対象の送信要求がDiscord宛に受け付けたものか確かめ、編集・削除の要求を作ってpublishする。
+func (s *Service) modify(ctx context.Context, action message.Action, targetID string, payload *discordmsg.Payload) (SendResult, error) {
+	if s.status == nil {
+		return SendResult{}, status.ErrNotFound
+	}
+	target, err := s.status.Get(ctx, targetID)
+	if err != nil {
+		return SendResult{}, err
+	}
+	msg, err := message.New(message.Params{
+		ID:          message.NewID(),
+		Destination: target.Destination,
+		Discord:     payload,
+		Action:      action,
+		TargetID:    targetID,
+		ReceivedAt:  message.NowUTC(),
+	})
+	if err != nil {
+		return SendResult{}, err
+	}
+	return s.publish(ctx, msg)
+}
+
+// publish は送信要求を宛先のサブジェクトへ送り、受け付けたことを記録する。
+func (s *Service) publish(ctx context.Context, msg *message.Message) (SendResult, error) {
 	subject, err := s.subjectFor(msg.Destination())
 	if err != nil {
-		return err
+		return SendResult{}, err
 	}
 
 	body, err := encodeEnvelope(msg)
 	if err != nil {
-		return err
+		return SendResult{}, err
 	}
 
-	return s.publisher.Publish(ctx, subject, body)
+	// メッセージIDを Nats-Msg-Id にし、同じ冪等キーの再送をストリームで除く。
+	duplicate, err := s.publisher.Publish(ctx, subject, msg.ID(), body)
+	if err != nil {
+		return SendResult{}, err
+	}
+	// 保存済みのメッセージは worker が送るので、状態を記録できなくても受け付けとする。
+	if !duplicate && s.status != nil {
+		if err := s.status.Record(ctx, msg.ID(), msg.Destination(), message.StateQueued, "", 0); err != nil {
+			s.logger("status record failed id=%s: %v", msg.ID(), err)
+		}
+	}
+	return SendResult{MessageID: msg.ID(), Duplicate: duplicate}, nil
 }
 
+// schedule は送信要求を予約に登録し、sendAt に scheduler が宛先のサブジェクトへ流す。
+// エンベロープとメッセージIDはすぐ送る場合と同じものを使う。
+func (s *Service) schedule(ctx context.Context, msg *message.Message, sendAt time.Time) (SendResult, error) {
+	subject, err := s.subjectFor(msg.Destination())
+	if err != nil {
+		return SendResult{}, err
+	}
+	body, err := encodeEnvelope(msg)
+	if err != nil {
+		return SendResult{}, err
+	}
+	duplicate, err := s.scheduler.Add(ctx, message.Scheduled{
+		MessageID:   msg.ID(),
+		Destination: msg.Destination(),
+		Subject:     subject,
+		SendAt:      sendAt,
+		Body:        body,
+	})
+	if err != nil {
+		return SendResult{}, err
+	}
+	return SendResult{MessageID: msg.ID(), Duplicate: duplicate, SendAt: sendAt}, nil
+}
+
+// subjectFor は宛先のサブジェクトを返す。LINEの宛先はすべて同じサブジェクトに流す。
 func (s *Service) subjectFor(destination string) (string, error) {
-	switch destination {
-	case "line":
+	switch {
+	case message.IsLine(destination):
 		if s.subjects.Line == "" {
 			return "", fmt.Errorf("subject for line is empty")
 		}
 		return s.subjects.Line, nil
-	case "discord":
+	case destination == message.DestinationDiscord:
 		if s.subjects.Discord == "" {
 			return "", fmt.Errorf("subject for discord is empty")
 		}
@@ -77,21 +338,45 @@ func (s *Service) subjectFor(destination string) (string, error) {
 	}
 }
 
+// encodeEnvelope は worker へ渡すJSONを作る。本文は text なら message.message、
+// 型付きメッセージなら messages にLINEの形式のまま、Discordの投稿内容なら discord に入れる。
+// マルチキャストは userIds、ナローキャストは narrowcast に宛先を入れる。
+// 編集・削除では action と target（対象のメッセージID）を付ける。
 func encodeEnvelope(msg *message.Message) ([]byte, error) {
 	payload := struct {
-		Destination string          `json:"destination"`
-		UserID      string          `json:"userId"`
-		Message     json.RawMessage `json:"message"`
-		ReceivedAt  time.Time       `json:"receivedAt"`
+		ID          string              `json:"id"`
+		Destination string              `json:"destination"`
+		Action      message.Action      `json:"action,omitempty"`
+		Target      string              `json:"target,omitempty"`
+		UserID      string              `json:"userId"`
+		UserIDs     []string            `json:"userIds,omitempty"`
+		Narrowcast  *linemsg.Narrowcast `json:"narrowcast,omitempty"`
+		Message     *envelopeText       `json:"message,omitempty"`
+		Messages    []linemsg.Message   `json:"messages,omitempty"`
+		Discord     *discordmsg.Payload `json:"discord,omitempty"`
+		ReceivedAt  time.Time           `json:"receivedAt"`
 	}{
+		ID:          msg.ID(),
 		Destination: msg.Destination(),
+		Action:      msg.Action(),
+		Target:      msg.TargetID(),
 		UserID:      msg.UserID(),
-		Message:     json.RawMessage(fmt.Sprintf(`{"message":%q}`, msg.Text())),
+		UserIDs:     msg.UserIDs(),
+		Narrowcast:  msg.Narrowcast(),
+		Messages:    msg.LineMessages(),
+		Discord:     msg.Discord(),
 		ReceivedAt:  msg.ReceivedAt(),
 	}
+	if msg.Text() != "" {
+		payload.Message = &envelopeText{Message: msg.Text()}
+	}
 	return json.Marshal(payload)
 }
 
+type envelopeText struct {
+	Message string `json:"message"`
+}
+
 // PublisherImpl はNATS Producerをラップする実装。
 type PublisherImpl struct {
 	producer nats.Producer
@@ -103,6 +388,6 @@ func NewPublisherImpl(producer nats.Producer) *PublisherImpl {
 }
 
 // Publish はNATSへ委譲する。
-func (p *PublisherImpl) Publish(ctx context.Context, subject string, data []byte) error {
-	return p.producer.Publish(ctx, subject, data)
+func (p *PublisherImpl) Publish(ctx context.Context, subject, msgID string, data []byte) (bool, error) {
+	return p.producer.PublishWithID(ctx, subject, msgID, data)
 }
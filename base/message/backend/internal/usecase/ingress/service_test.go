@@ -2,23 +2,59 @@ package ingress
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
 	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/domain/msgtemplate"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
 type fakePublisher struct {
 	subjects []string
+	msgIDs   []string
 	data     [][]byte
 	err      error
 }
 
-func (f *fakePublisher) Publish(ctx context.Context, subject string, data []byte) error {
+// Publish は同じ msgID の2回目以降を重複として扱う。
+func (f *fakePublisher) Publish(ctx context.Context, subject, msgID string, data []byte) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, id := range f.msgIDs {
+		if id == msgID {
+			return true, nil
+		}
+	}
 	f.subjects = append(f.subjects, subject)
+	f.msgIDs = append(f.msgIDs, msgID)
 	f.data = append(f.data, data)
-	return f.err
+	return false, nil
+}
+
+type fakeRecorder struct {
+	records  []string
+	statuses map[string]message.Status
+}
+
+func (f *fakeRecorder) Record(_ context.Context, id, destination string, state message.State, _ string, _ int) error {
+	f.records = append(f.records, id+" "+destination+" "+string(state))
+	return nil
+}
+
+func (f *fakeRecorder) Get(_ context.Context, id string) (message.Status, error) {
+	st, ok := f.statuses[id]
+	if !ok {
+		return message.Status{}, status.ErrNotFound
+	}
+	return st, nil
 }
 
 func TestService_Send_DefaultDestination(t *testing.T) {
@@ -27,42 +63,424 @@ func TestService_Send_DefaultDestination(t *testing.T) {
 
 func TestService_Send_UnknownDestination(t *testing.T) {
 	pub := &fakePublisher{}
-	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"})
+	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, nil, t.Logf)
 
-	if err := svc.Send(context.Background(), "unknown", "U1", "hello"); err == nil {
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "unknown", UserID: "U1", Text: "hello"}); err == nil {
 		t.Fatalf("expected error")
 	}
 }
 
 func TestService_Send_Validation(t *testing.T) {
 	pub := &fakePublisher{}
-	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"})
+	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, nil, t.Logf)
 
-	if err := svc.Send(context.Background(), "line", "", "hello"); err == nil {
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", Text: "hello"}); err == nil {
 		t.Fatalf("expected error for empty user")
 	}
-	if err := svc.Send(context.Background(), "line", "U1", ""); err == nil {
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1"}); err == nil {
 		t.Fatalf("expected error for empty text")
 	}
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1", Text: "hello", IdempotencyKey: "a\nb"}); !errors.Is(err, message.ErrInvalidIdempotencyKey) {
+		t.Fatalf("expected ErrInvalidIdempotencyKey, got %v", err)
+	}
 }
 
 func TestService_Send_PropagatesPublisherError(t *testing.T) {
 	pub := &fakePublisher{err: errors.New("publish fail")}
-	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"})
+	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, nil, t.Logf)
 
-	if err := svc.Send(context.Background(), "line", "U1", "hello"); err == nil {
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1", Text: "hello"}); err == nil {
 		t.Fatalf("expected publisher error")
 	}
 }
 
+// エンベロープは本文の種類に応じて message か messages を持つ。
 func TestEncodeEnvelope_Format(t *testing.T) {
+	t.Parallel()
+
 	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
-	msg, _ := message.New("line", "U1", "hello", now)
-	body, err := encodeEnvelope(msg)
+	const id = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	tests := []struct {
+		name   string
+		params message.Params
+		want   string
+	}{
+		{
+			name:   "テキスト",
+			params: message.Params{ID: id, Destination: "line", UserID: "U1", Text: `he said "hi"`, ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"line","userId":"U1","message":{"message":"he said \"hi\""},"receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "型付きメッセージ",
+			params: message.Params{ID: id, Destination: "line", UserID: "U1", LineMessages: []linemsg.Message{linemsg.Sticker{PackageID: "446", StickerID: "1988"}}, ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"line","userId":"U1","messages":[{"type":"sticker","packageId":"446","stickerId":"1988"}],"receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "Discordの投稿内容",
+			params: message.Params{ID: id, Destination: "discord", UserID: "U1", Discord: &discordmsg.Payload{Content: "障害", ThreadName: "DB"}, ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"discord","userId":"U1","discord":{"content":"障害","threadName":"DB"},"receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "マルチキャスト",
+			params: message.Params{ID: id, Destination: message.DestinationLineMulticast, UserIDs: []string{"U1", "U2", "U1"}, Text: "hi", ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"line-multicast","userId":"","userIds":["U1","U2"],"message":{"message":"hi"},"receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "ナローキャスト",
+			params: message.Params{ID: id, Destination: message.DestinationLineNarrowcast, Narrowcast: &linemsg.Narrowcast{Recipient: &linemsg.Recipient{Type: "audience", AudienceGroupID: 1}}, Text: "hi", ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"line-narrowcast","userId":"","narrowcast":{"recipient":{"type":"audience","audienceGroupId":1}},"message":{"message":"hi"},"receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "Discord投稿の削除",
+			params: message.Params{ID: id, Destination: "discord", Action: message.ActionDelete, TargetID: "t-1", ReceivedAt: now},
+			want:   `{"id":"` + id + `","destination":"discord","action":"delete","target":"t-1","userId":"","receivedAt":"2025-01-01T00:00:00Z"}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			msg, err := message.New(tt.params)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			body, err := encodeEnvelope(msg)
+			if err != nil {
+				t.Fatalf("encodeEnvelope error: %v", err)
+			}
+			if string(body) != tt.want {
+				t.Fatalf("body=%s\nwant=%s", body, tt.want)
+			}
+		})
+	}
+}
+
+// 型付きメッセージは検証してから publish する。
+func TestService_Send_LineMessages(t *testing.T) {
+	t.Parallel()
+	pub := &fakePublisher{}
+	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, nil, t.Logf)
+
+	valid := []json.RawMessage{json.RawMessage(`{"type":"image","originalContentUrl":"https://example.com/a.jpg","previewImageUrl":"https://example.com/b.jpg"}`)}
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1", Messages: valid}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pub.data) != 1 {
+		t.Fatalf("expected publish")
+	}
+	invalid := []json.RawMessage{json.RawMessage(`{"type":"image","originalContentUrl":"http://example.com/a.jpg","previewImageUrl":"https://example.com/b.jpg"}`)}
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1", Messages: invalid}); !errors.Is(err, linemsg.ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	}
+	if _, err := svc.Send(context.Background(), SendInput{Destination: "discord", UserID: "U1", Messages: valid}); !errors.Is(err, message.ErrMessagesNotSupported) {
+		t.Fatalf("expected ErrMessagesNotSupported, got %v", err)
+	}
+	if len(pub.data) != 1 {
+		t.Fatalf("invalid requests must not be published")
+	}
+}
+
+// マルチキャスト・ブロードキャスト・ナローキャストはLINEのサブジェクトへ1件でpublishする。
+func TestService_Send_LineBulk(t *testing.T) {
+	t.Parallel()
+
+	userIDs := func(n int) []string {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("U%032d", i)
+		}
+		return ids
+	}
+	tests := []struct {
+		name    string
+		in      SendInput
+		wantErr error
+	}{
+		{name: "500件を超えるマルチキャスト", in: SendInput{Destination: "line-multicast", UserIDs: userIDs(1200), Text: "hi"}},
+		{name: "ブロードキャスト", in: SendInput{Destination: "line-broadcast", Text: "hi"}},
+		{name: "ナローキャスト", in: SendInput{Destination: "line-narrowcast", Narrowcast: json.RawMessage(`{"filter":{"demographic":{"type":"appType","oneOf":["ios"]}}}`), Text: "hi"}},
+		{name: "不正な絞り込み条件", in: SendInput{Destination: "line-narrowcast", Narrowcast: json.RawMessage(`{"filter":{"demographic":{"type":"age","oneOf":["age_20"]}}}`), Text: "hi"}, wantErr: linemsg.ErrInvalidNarrowcast},
+		{name: "マルチキャストの宛先なし", in: SendInput{Destination: "line-multicast", Text: "hi"}, wantErr: message.ErrEmptyRecipients},
+		{name: "宛先が多すぎる", in: SendInput{Destination: "line-multicast", UserIDs: userIDs(message.MaxRecipients + 1), Text: "hi"}, wantErr: message.ErrTooManyRecipients},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pub := &fakePublisher{}
+			svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, nil, t.Logf)
+
+			_, err := svc.Send(context.Background(), tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || len(pub.data) != 0 {
+					t.Fatalf("err=%v want=%v published=%d", err, tt.wantErr, len(pub.data))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pub.data) != 1 || pub.subjects[0] != "line.events" {
+				t.Fatalf("published=%v", pub.subjects)
+			}
+		})
+	}
+}
+
+// 冪等キーが同じ要求は同じIDを返し、2回目は重複として publish されないことを確認する。
+func TestService_Send_IdempotencyKey(t *testing.T) {
+	t.Parallel()
+	pub := &fakePublisher{}
+	rec := &fakeRecorder{}
+	svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, rec, nil, nil, t.Logf)
+	in := SendInput{Destination: "line", UserID: "U1", Text: "hello", IdempotencyKey: "order-1"}
+
+	first, err := svc.Send(context.Background(), in)
+	if err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	second, err := svc.Send(context.Background(), in)
 	if err != nil {
-		t.Fatalf("encodeEnvelope error: %v", err)
+		t.Fatalf("second send: %v", err)
 	}
-	if len(body) == 0 {
-		t.Fatalf("expected body")
+	if first.Duplicate || !second.Duplicate || first.MessageID != second.MessageID {
+		t.Fatalf("first=%+v second=%+v", first, second)
+	}
+	if len(pub.data) != 1 || pub.msgIDs[0] != first.MessageID {
+		t.Fatalf("published=%v", pub.msgIDs)
+	}
+	// 重複した要求では queued を記録し直さない。
+	if len(rec.records) != 1 || rec.records[0] != first.MessageID+" line queued" {
+		t.Fatalf("records=%v", rec.records)
+	}
+	var envelope struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(pub.data[0], &envelope); err != nil || envelope.ID != first.MessageID {
+		t.Fatalf("envelope id=%q err=%v", envelope.ID, err)
+	}
+
+	other, err := svc.Send(context.Background(), SendInput{Destination: "line", UserID: "U1", Text: "hello"})
+	if err != nil {
+		t.Fatalf("send without key: %v", err)
+	}
+	if other.Duplicate || other.MessageID == first.MessageID {
+		t.Fatalf("unexpected result without key: %+v", other)
+	}
+}
+
+// 編集・削除は対象がDiscord宛に受け付けたものか確かめ、新しいIDでpublishする。
+func TestService_EditDelete(t *testing.T) {
+	t.Parallel()
+
+	const (
+		discordID = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+		lineID    = "1b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	)
+	statuses := map[string]message.Status{
+		discordID: {MessageID: discordID, Destination: "discord", State: message.StateDelivered},
+		lineID:    {MessageID: lineID, Destination: "line", State: message.StateDelivered},
+	}
+	tests := []struct {
+		name       string
+		edit       *EditInput
+		target     string
+		wantErr    error
+		wantAction string
+	}{
+		{name: "本文で編集", edit: &EditInput{TargetID: discordID, Text: "復旧しました"}, wantAction: "edit"},
+		{name: "埋め込みで編集", edit: &EditInput{TargetID: discordID, Discord: json.RawMessage(`{"embeds":[{"title":"DB","color":65280}]}`)}, wantAction: "edit"},
+		{name: "削除", target: discordID, wantAction: "delete"},
+		{name: "対象なし", target: "2b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d", wantErr: status.ErrNotFound},
+		{name: "LINE宛は対象外", target: lineID, wantErr: message.ErrEditNotSupported},
+		{name: "本文なし", edit: &EditInput{TargetID: discordID}, wantErr: message.ErrEmptyText},
+		{name: "本文と投稿内容の両方", edit: &EditInput{TargetID: discordID, Text: "x", Discord: json.RawMessage(`{"content":"x"}`)}, wantErr: message.ErrTextWithDiscord},
+		{name: "添付ファイルは編集できない", edit: &EditInput{TargetID: discordID, Discord: json.RawMessage(`{"attachments":[{"filename":"a.txt","data":"aGVsbG8="}]}`)}, wantErr: discordmsg.ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pub := &fakePublisher{}
+			rec := &fakeRecorder{statuses: statuses}
+			svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, rec, nil, nil, t.Logf)
+
+			var (
+				res SendResult
+				err error
+			)
+			if tt.edit != nil {
+				res, err = svc.Edit(context.Background(), *tt.edit)
+			} else {
+				res, err = svc.Delete(context.Background(), tt.target)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tt.wantErr)
+				}
+				if len(pub.data) != 0 {
+					t.Fatalf("rejected request must not be published")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pub.data) != 1 || pub.subjects[0] != "discord.incoming" || pub.msgIDs[0] != res.MessageID || res.MessageID == discordID {
+				t.Fatalf("published=%v ids=%v result=%+v", pub.subjects, pub.msgIDs, res)
+			}
+			var envelope struct {
+				Action string `json:"action"`
+				Target string `json:"target"`
+			}
+			if err := json.Unmarshal(pub.data[0], &envelope); err != nil || envelope.Action != tt.wantAction || envelope.Target != discordID {
+				t.Fatalf("envelope=%s err=%v", pub.data[0], err)
+			}
+		})
+	}
+}
+
+type fakeScheduler struct {
+	entries []message.Scheduled
+}
+
+func (f *fakeScheduler) Add(_ context.Context, entry message.Scheduled) (bool, error) {
+	for _, e := range f.entries {
+		if e.MessageID == entry.MessageID {
+			return true, nil
+		}
+	}
+	f.entries = append(f.entries, entry)
+	return false, nil
+}
+
+// sendAt・delay を指定した要求は publish せずに予約し、過ぎた時刻ならすぐ送る。
+func TestService_Send_Schedule(t *testing.T) {
+	t.Parallel()
+
+	future := message.NowUTC().Add(time.Hour)
+	tests := []struct {
+		name          string
+		in            SendInput
+		noScheduler   bool
+		wantErr       string
+		wantScheduled bool
+	}{
+		{name: "時刻で予約", in: SendInput{SendAt: future}, wantScheduled: true},
+		{name: "遅延で予約", in: SendInput{Delay: 10 * time.Minute}, wantScheduled: true},
+		{name: "過ぎた時刻はすぐ送る", in: SendInput{SendAt: future.Add(-2 * time.Hour)}},
+		{name: "時刻と遅延の両方", in: SendInput{SendAt: future, Delay: time.Minute}, wantErr: message.ErrSendAtWithDelay.Error()},
+		{name: "負の遅延", in: SendInput{Delay: -time.Minute}, wantErr: message.ErrNegativeDelay.Error()},
+		{name: "予約先なし", in: SendInput{Delay: time.Minute}, noScheduler: true, wantErr: "not configured"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pub := &fakePublisher{}
+			sched := &fakeScheduler{}
+			var scheduler Scheduler = sched
+			if tt.noScheduler {
+				scheduler = nil
+			}
+			svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, scheduler, nil, t.Logf)
+			in := tt.in
+			in.Destination, in.UserID, in.Text = "line", "U1", "hello"
+
+			res, err := svc.Send(context.Background(), in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantScheduled {
+				if len(pub.data) != 1 || len(sched.entries) != 0 || !res.SendAt.IsZero() {
+					t.Fatalf("published=%d scheduled=%d result=%+v", len(pub.data), len(sched.entries), res)
+				}
+				return
+			}
+			if len(pub.data) != 0 || len(sched.entries) != 1 {
+				t.Fatalf("published=%d scheduled=%d", len(pub.data), len(sched.entries))
+			}
+			e := sched.entries[0]
+			if e.MessageID != res.MessageID || e.Subject != "line.events" || e.Destination != "line" || !e.SendAt.Equal(res.SendAt) || res.SendAt.IsZero() {
+				t.Fatalf("entry=%+v result=%+v", e, res)
+			}
+			var envelope struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(e.Body, &envelope); err != nil || envelope.ID != res.MessageID {
+				t.Fatalf("envelope id=%q err=%v", envelope.ID, err)
+			}
+		})
+	}
+}
+
+// templateId の要求は宛先に合う本文を展開し、直接指定した本文と同じ検証にかけてからpublishする。
+func TestService_Send_Template(t *testing.T) {
+	t.Parallel()
+
+	set, err := msgtemplate.Compile(map[string]msgtemplate.Definition{
+		"shipped": {
+			DefaultLocale: "ja",
+			Locales: map[string]msgtemplate.Variant{
+				"ja": {
+					Text:         "{{.name}}さん、発送しました",
+					LineMessages: []any{map[string]any{"type": "text", "text": "{{.name}}さん、発送しました"}},
+					Discord:      map[string]any{"embeds": []any{map[string]any{"title": "発送 {{.orderId}}", "color": 65280}}},
+				},
+				"en": {Text: "Shipped, {{.name}}"},
+			},
+		},
+		"bad-image": {
+			Locales: map[string]msgtemplate.Variant{
+				"ja": {LineMessages: []any{map[string]any{"type": "image", "originalContentUrl": "{{.url}}", "previewImageUrl": "{{.url}}"}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	params := map[string]any{"name": "山田", "orderId": "A-1", "url": "http://example.com/a.png"}
+	tests := []struct {
+		name    string
+		in      SendInput
+		want    string
+		wantErr error
+	}{
+		{name: "LINEは型付きメッセージ", in: SendInput{Destination: "line", UserID: "U1", TemplateID: "shipped", Params: params}, want: `"messages":[{"type":"text","text":"山田さん、発送しました"}]`},
+		{name: "Discordは埋め込み", in: SendInput{Destination: "discord", UserID: "U1", TemplateID: "shipped", Params: params}, want: `"discord":{"embeds":[{"title":"発送 A-1","color":65280}]}`},
+		{name: "ロケールでテキスト", in: SendInput{Destination: "discord", UserID: "U1", TemplateID: "shipped", Locale: "en-US", Params: params}, want: `"message":{"message":"Shipped, 山田"}`},
+		{name: "本文と同時指定", in: SendInput{Destination: "line", UserID: "U1", TemplateID: "shipped", Text: "x"}, wantErr: message.ErrTemplateWithBody},
+		{name: "テンプレートなしのparams", in: SendInput{Destination: "line", UserID: "U1", Text: "x", Params: params}, wantErr: message.ErrParamsWithoutTemplate},
+		{name: "未定義のテンプレート", in: SendInput{Destination: "line", UserID: "U1", TemplateID: "missing"}, wantErr: msgtemplate.ErrNotFound},
+		{name: "paramsが足りない", in: SendInput{Destination: "line", UserID: "U1", TemplateID: "shipped"}, wantErr: msgtemplate.ErrRender},
+		{name: "展開した本文も検証する", in: SendInput{Destination: "line", UserID: "U1", TemplateID: "bad-image", Params: params}, wantErr: linemsg.ErrInvalidMessage},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pub := &fakePublisher{}
+			svc := NewService(pub, Subjects{Line: "line.events", Discord: "discord.incoming"}, nil, nil, set, t.Logf)
+
+			_, err := svc.Send(context.Background(), tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pub.data) != 1 || !strings.Contains(string(pub.data[0]), tt.want) {
+				t.Fatalf("published=%s want containing %s", pub.data, tt.want)
+			}
+		})
 	}
 }
@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+// Publisher は Nats-Msg-Id を付けてpublishする。nats.Producer が満たす。
+type Publisher interface {
+	PublishWithID(ctx context.Context, subject, msgID string, data []byte) (duplicate bool, err error)
+}
+
+// Dispatcher は送る時刻になった予約を宛先のサブジェクトへ送り出す。
+// 予約に送り出し中の印を付けてからpublishし、最後に予約を消す。途中で失敗・停止しても印の付いた予約は
+// 次の周期で送り直し、メッセージIDを Nats-Msg-Id にしているので重複排除の期間内なら二重に送らない。
+// 複数のプロセスで動かしても同じ理由で重複しない。
+type Dispatcher struct {
+	store       Store
+	publisher   Publisher
+	status      StatusRecorder
+	interval    time.Duration
+	now         func() time.Time
+	logger      func(format string, v ...any)
+	compactedAt time.Time
+}
+
+// compactInterval は消した予約の跡を片付ける間隔。
+const compactInterval = time.Hour
+
+// NewDispatcher は Dispatcher を生成する。interval は予約を確かめる間隔。
+// status が nil なら配送状態を記録しない。
+func NewDispatcher(store Store, publisher Publisher, status StatusRecorder, interval time.Duration, logger func(format string, v ...any)) *Dispatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Dispatcher{
+		store:     store,
+		publisher: publisher,
+		status:    status,
+		interval:  interval,
+		now:       message.NowUTC,
+		logger:    logger,
+	}
+}
+
+// Run は ctx が終わるまで interval ごとに予約を送り出す。
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.releaseDue(ctx)
+		d.compact(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseDue は送る時刻になった予約をすべて送り出す。失敗した予約は次の周期に回す。
+func (d *Dispatcher) releaseDue(ctx context.Context) {
+	now := d.now()
+	entries, err := d.store.ListDue(ctx, now)
+	if err != nil {
+		d.logger("schedule list failed: %v", err)
+		return
+	}
+	for _, e := range entries {
+		if err := d.release(ctx, e, now); err != nil {
+			d.logger("schedule release failed id=%s: %v", e.MessageID, err)
+		}
+	}
+}
+
+// compact は前回から compactInterval 以上経っていれば消した予約の跡を片付ける。
+func (d *Dispatcher) compact(ctx context.Context) {
+	now := d.now()
+	if now.Sub(d.compactedAt) < compactInterval {
+		return
+	}
+	d.compactedAt = now
+	if err := d.store.Compact(ctx); err != nil {
+		d.logger("schedule compact failed: %v", err)
+	}
+}
+
+func (d *Dispatcher) release(ctx context.Context, e message.Scheduled, now time.Time) error {
+	if e.ReleasingAt == nil {
+		// 印を付けた後は取り消せないので、取り消しと競合したらどちらか一方だけが成功する。
+		current, rev, err := d.store.Get(ctx, e.MessageID)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.ReleasingAt == nil {
+			current.ReleasingAt = &now
+			err := d.store.Update(ctx, current, rev)
+			if errors.Is(err, ErrConflict) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("mark releasing: %w", err)
+			}
+		}
+		e = current
+	}
+
+	if _, err := d.publisher.PublishWithID(ctx, e.Subject, e.MessageID, e.Body); err != nil {
+		return err
+	}
+	// 前の周期で送り出していた場合も記録し直す。queued は処理が始まった後なら無視される。
+	if d.status != nil {
+		if err := d.status.Record(ctx, e.MessageID, e.Destination, message.StateQueued, "", 0); err != nil {
+			d.logger("status record failed id=%s: %v", e.MessageID, err)
+		}
+	}
+	if err := d.store.Delete(ctx, e, 0); err != nil {
+		return fmt.Errorf("delete released: %w", err)
+	}
+	return nil
+}
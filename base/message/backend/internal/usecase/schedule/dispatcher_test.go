@@ -0,0 +1,134 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+type fakePublisher struct {
+	subjects []string
+	msgIDs   []string
+	err      error
+}
+
+func (f *fakePublisher) PublishWithID(_ context.Context, subject, msgID string, _ []byte) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, id := range f.msgIDs {
+		if id == msgID {
+			return true, nil
+		}
+	}
+	f.subjects = append(f.subjects, subject)
+	f.msgIDs = append(f.msgIDs, msgID)
+	return false, nil
+}
+
+// 送る時刻になった予約だけを流して消し、queued を記録する。
+func TestDispatcher_ReleaseDue(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore(
+		message.Scheduled{MessageID: idA, Destination: "line-broadcast", Subject: "line.events", SendAt: now},
+		message.Scheduled{MessageID: idB, Destination: "discord", Subject: "discord.incoming", SendAt: now.Add(time.Second)},
+	)
+	pub := &fakePublisher{}
+	rec := &fakeRecorder{}
+	d := NewDispatcher(store, pub, rec, time.Second, t.Logf)
+	d.now = func() time.Time { return now }
+
+	d.releaseDue(context.Background())
+
+	if len(pub.msgIDs) != 1 || pub.msgIDs[0] != idA || pub.subjects[0] != "line.events" {
+		t.Fatalf("published=%v %v", pub.msgIDs, pub.subjects)
+	}
+	if _, _, err := store.Get(context.Background(), idA); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("released entry remains: %v", err)
+	}
+	if _, _, err := store.Get(context.Background(), idB); err != nil {
+		t.Fatalf("future entry removed: %v", err)
+	}
+	if len(rec.records) != 1 || rec.records[0] != idA+" line-broadcast queued" {
+		t.Fatalf("records=%v", rec.records)
+	}
+}
+
+// publish に失敗した予約は送り出し中の印が付いたまま残り、次の周期で送り直す。
+// 印の付いた予約は取り消せない。
+func TestDispatcher_RetryAfterPublishFailure(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore(message.Scheduled{MessageID: idA, Destination: "line", Subject: "line.events", SendAt: now})
+	pub := &fakePublisher{err: errors.New("nats down")}
+	d := NewDispatcher(store, pub, nil, time.Second, t.Logf)
+	d.now = func() time.Time { return now }
+
+	d.releaseDue(context.Background())
+	got, _, err := store.Get(context.Background(), idA)
+	if err != nil || got.ReleasingAt == nil {
+		t.Fatalf("entry=%+v err=%v", got, err)
+	}
+	if err := NewService(store, nil, 0, t.Logf).Cancel(context.Background(), idA); !errors.Is(err, ErrReleased) {
+		t.Fatalf("cancel err=%v want ErrReleased", err)
+	}
+
+	pub.err = nil
+	d.releaseDue(context.Background())
+	if len(pub.msgIDs) != 1 || pub.msgIDs[0] != idA {
+		t.Fatalf("published=%v", pub.msgIDs)
+	}
+	if _, _, err := store.Get(context.Background(), idA); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("released entry remains: %v", err)
+	}
+}
+
+// 一覧を読んだ後に取り消された予約は流さない。
+func TestDispatcher_SkipsCanceled(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := message.Scheduled{MessageID: idA, Destination: "line", Subject: "line.events", SendAt: now}
+	store := newFakeStore(entry)
+	pub := &fakePublisher{}
+	d := NewDispatcher(store, pub, nil, time.Second, t.Logf)
+	d.now = func() time.Time { return now }
+
+	if err := NewService(store, nil, 0, t.Logf).Cancel(context.Background(), idA); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := d.release(context.Background(), entry, now); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if len(pub.msgIDs) != 0 {
+		t.Fatalf("canceled entry published: %v", pub.msgIDs)
+	}
+}
+
+// 消した予約の跡は compactInterval ごとに1回だけ片付ける。
+func TestDispatcher_Compact(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	d := NewDispatcher(store, &fakePublisher{}, nil, time.Second, t.Logf)
+	d.now = func() time.Time { return now }
+
+	d.compact(context.Background())
+	now = now.Add(compactInterval - time.Second)
+	d.compact(context.Background())
+	if store.compactions != 1 {
+		t.Fatalf("compactions=%d want=1", store.compactions)
+	}
+	now = now.Add(time.Second)
+	d.compact(context.Background())
+	if store.compactions != 2 {
+		t.Fatalf("compactions=%d want=2", store.compactions)
+	}
+}
@@ -0,0 +1,132 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+var (
+	// ErrNotFound は予約がない（送り出し済み・取り消し済みを含む）場合に返す。
+	ErrNotFound = errors.New("schedule: not found")
+	// ErrConflict は読んだ後に他から更新されていた場合に Store が返す。
+	ErrConflict = errors.New("schedule: revision conflict")
+	// ErrReleased は取り消そうとした予約を scheduler が送り出し始めていた場合に返す。
+	ErrReleased = errors.New("schedule: already being released")
+	// ErrTooFar は送る時刻が予約できる期間より先の場合に返す。
+	ErrTooFar = errors.New("schedule: sendAt is too far in the future")
+)
+
+// Store は配送予約の保存先。予約はメッセージIDで引き、revision で楽観ロックする。
+type Store interface {
+	// Get は予約と revision を返す。なければ ErrNotFound。
+	Get(ctx context.Context, id string) (message.Scheduled, uint64, error)
+	// List はすべての予約を返す。順序は問わない。
+	List(ctx context.Context) ([]message.Scheduled, error)
+	// ListDue は until の時点で送る時刻になった予約を返す。順序は問わない。
+	ListDue(ctx context.Context, until time.Time) ([]message.Scheduled, error)
+	// Create は未登録のIDに予約を保存する。既にあれば ErrConflict。
+	Create(ctx context.Context, s message.Scheduled) error
+	// Update は revision が最新の場合だけ予約を上書きする。そうでなければ ErrConflict。
+	Update(ctx context.Context, s message.Scheduled, revision uint64) error
+	// Delete は予約を消す。revision が0でなければ最新の場合だけ消し、そうでなければ ErrConflict。
+	Delete(ctx context.Context, s message.Scheduled, revision uint64) error
+	// Compact は消した予約の跡を片付ける。
+	Compact(ctx context.Context) error
+}
+
+// StatusRecorder は配送状態を記録する。status.Tracker が満たす。
+type StatusRecorder interface {
+	Record(ctx context.Context, id, destination string, state message.State, reason string, attempt int) error
+}
+
+// maxConflictRetries は競合時に読み直す上限。
+const maxConflictRetries = 5
+
+// Service は配送予約の登録・一覧・取り消しを行う。
+type Service struct {
+	store    Store
+	status   StatusRecorder
+	maxDelay time.Duration
+	now      func() time.Time
+	logger   func(format string, v ...any)
+}
+
+// NewService は Service を生成する。maxDelay は今から予約できる期間で、0 なら制限しない。
+// status が nil なら配送状態を記録しない。
+func NewService(store Store, status StatusRecorder, maxDelay time.Duration, logger func(format string, v ...any)) *Service {
+	return &Service{store: store, status: status, maxDelay: maxDelay, now: message.NowUTC, logger: logger}
+}
+
+// Add は予約を登録する。同じメッセージIDの予約が既にあれば登録せずに duplicate=true を返す。
+func (s *Service) Add(ctx context.Context, entry message.Scheduled) (duplicate bool, err error) {
+	now := s.now()
+	if s.maxDelay > 0 && entry.SendAt.Sub(now) > s.maxDelay {
+		return false, fmt.Errorf("%w: at most %s ahead", ErrTooFar, s.maxDelay)
+	}
+	entry.SendAt = entry.SendAt.UTC()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+	err = s.store.Create(ctx, entry)
+	if errors.Is(err, ErrConflict) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// 予約は保存済みなので、状態を記録できなくても受け付けとする。
+	if s.status != nil {
+		if err := s.status.Record(ctx, entry.MessageID, entry.Destination, message.StateScheduled, "", 0); err != nil {
+			s.logger("status record failed id=%s: %v", entry.MessageID, err)
+		}
+	}
+	return false, nil
+}
+
+// List は予約を送る時刻の早い順に返す。
+func (s *Service) List(ctx context.Context) ([]message.Scheduled, error) {
+	entries, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].SendAt.Equal(entries[j].SendAt) {
+			return entries[i].SendAt.Before(entries[j].SendAt)
+		}
+		return entries[i].MessageID < entries[j].MessageID
+	})
+	return entries, nil
+}
+
+// Cancel は送り出す前の予約を取り消す。scheduler が送り出し始めていたら ErrReleased。
+func (s *Service) Cancel(ctx context.Context, id string) error {
+	for i := 0; i < maxConflictRetries; i++ {
+		entry, rev, err := s.store.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if entry.ReleasingAt != nil {
+			return ErrReleased
+		}
+		// scheduler が同時に送り出し始めていたら revision が変わっているので、読み直して確かめる。
+		err = s.store.Delete(ctx, entry, rev)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if s.status != nil {
+			if err := s.status.Record(ctx, id, entry.Destination, message.StateCanceled, "canceled by request", 0); err != nil {
+				s.logger("status record failed id=%s: %v", id, err)
+			}
+		}
+		return nil
+	}
+	return ErrConflict
+}
@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+type storeEntry struct {
+	scheduled message.Scheduled
+	revision  uint64
+}
+
+// fakeStore はプロセス内に予約を保持する。
+type fakeStore struct {
+	mu          sync.Mutex
+	entries     map[string]storeEntry
+	compactions int
+}
+
+func newFakeStore(entries ...message.Scheduled) *fakeStore {
+	s := &fakeStore{entries: map[string]storeEntry{}}
+	for _, e := range entries {
+		s.entries[e.MessageID] = storeEntry{scheduled: e, revision: 1}
+	}
+	return s
+}
+
+func (s *fakeStore) Get(_ context.Context, id string) (message.Scheduled, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return message.Scheduled{}, 0, ErrNotFound
+	}
+	return e.scheduled, e.revision, nil
+}
+
+func (s *fakeStore) List(_ context.Context) ([]message.Scheduled, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []message.Scheduled
+	for _, e := range s.entries {
+		out = append(out, e.scheduled)
+	}
+	return out, nil
+}
+
+func (s *fakeStore) ListDue(ctx context.Context, until time.Time) ([]message.Scheduled, error) {
+	all, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []message.Scheduled
+	for _, e := range all {
+		if e.Due(until) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) Create(_ context.Context, sc message.Scheduled) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[sc.MessageID]; ok {
+		return ErrConflict
+	}
+	s.entries[sc.MessageID] = storeEntry{scheduled: sc, revision: 1}
+	return nil
+}
+
+func (s *fakeStore) Update(_ context.Context, sc message.Scheduled, revision uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[sc.MessageID]
+	if !ok || e.revision != revision {
+		return ErrConflict
+	}
+	s.entries[sc.MessageID] = storeEntry{scheduled: sc, revision: revision + 1}
+	return nil
+}
+
+func (s *fakeStore) Delete(_ context.Context, sc message.Scheduled, revision uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[sc.MessageID]
+	if revision != 0 && (!ok || e.revision != revision) {
+		return ErrConflict
+	}
+	delete(s.entries, sc.MessageID)
+	return nil
+}
+
+func (s *fakeStore) Compact(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compactions++
+	return nil
+}
+
+type fakeRecorder struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (f *fakeRecorder) Record(_ context.Context, id, destination string, state message.State, _ string, _ int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, id+" "+destination+" "+string(state))
+	return nil
+}
+
+const (
+	idA = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	idB = "1b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+)
+
+// 予約の登録は期間を確かめ、同じIDの2回目は重複として扱う。
+func TestService_Add(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	rec := &fakeRecorder{}
+	svc := NewService(store, rec, 24*time.Hour, t.Logf)
+	svc.now = func() time.Time { return now }
+
+	entry := message.Scheduled{MessageID: idA, Destination: "line", Subject: "line.events", SendAt: now.Add(time.Hour)}
+	if dup, err := svc.Add(context.Background(), entry); err != nil || dup {
+		t.Fatalf("first add dup=%v err=%v", dup, err)
+	}
+	if dup, err := svc.Add(context.Background(), entry); err != nil || !dup {
+		t.Fatalf("second add dup=%v err=%v", dup, err)
+	}
+	saved, _, _ := store.Get(context.Background(), idA)
+	if !saved.CreatedAt.Equal(now) {
+		t.Fatalf("createdAt=%v", saved.CreatedAt)
+	}
+	if len(rec.records) != 1 || rec.records[0] != idA+" line scheduled" {
+		t.Fatalf("records=%v", rec.records)
+	}
+
+	far := message.Scheduled{MessageID: idB, Destination: "line", SendAt: now.Add(25 * time.Hour)}
+	if _, err := svc.Add(context.Background(), far); !errors.Is(err, ErrTooFar) {
+		t.Fatalf("err=%v want ErrTooFar", err)
+	}
+}
+
+// 一覧は送る時刻の早い順。
+func TestService_List(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore(
+		message.Scheduled{MessageID: idA, SendAt: now.Add(2 * time.Hour)},
+		message.Scheduled{MessageID: idB, SendAt: now.Add(time.Hour)},
+	)
+	entries, err := NewService(store, nil, 0, t.Logf).List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 || entries[0].MessageID != idB || entries[1].MessageID != idA {
+		t.Fatalf("entries=%+v", entries)
+	}
+}
+
+// 取り消しは送り出し前の予約だけを消し、canceled を記録する。
+func TestService_Cancel(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		entry       *message.Scheduled
+		wantErr     error
+		wantRecords int
+	}{
+		{name: "取り消し", entry: &message.Scheduled{MessageID: idA, Destination: "discord", SendAt: now}, wantRecords: 1},
+		{name: "送り出し中", entry: &message.Scheduled{MessageID: idA, Destination: "discord", SendAt: now, ReleasingAt: &now}, wantErr: ErrReleased},
+		{name: "予約なし", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := newFakeStore()
+			if tt.entry != nil {
+				store = newFakeStore(*tt.entry)
+			}
+			rec := &fakeRecorder{}
+			err := NewService(store, rec, 0, t.Logf).Cancel(context.Background(), idA)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want=%v", err, tt.wantErr)
+			}
+			if len(rec.records) != tt.wantRecords {
+				t.Fatalf("records=%v", rec.records)
+			}
+			if tt.wantErr == nil {
+				if _, _, err := store.Get(context.Background(), idA); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("entry remains: %v", err)
+				}
+				if rec.records[0] != idA+" discord canceled" {
+					t.Fatalf("records=%v", rec.records)
+				}
+			}
+		})
+	}
+}
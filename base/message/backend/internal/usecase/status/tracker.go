@@ -0,0 +1,108 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+var (
+	// ErrNotFound はメッセージIDの状態が記録されていない場合に返す。
+	ErrNotFound = errors.New("status: not found")
+	// ErrConflict は読んだ後に他から更新されていた場合に Store が返す。
+	ErrConflict = errors.New("status: revision conflict")
+)
+
+// Store は配送状態の保存先。revision で楽観ロックし、ingress と worker が同じIDを同時に更新しても取りこぼさない。
+type Store interface {
+	// Get は状態と revision を返す。未記録なら ErrNotFound。
+	Get(ctx context.Context, id string) (message.Status, uint64, error)
+	// Create は未記録のIDに状態を保存する。既にあれば ErrConflict。
+	Create(ctx context.Context, st message.Status) error
+	// Update は revision が最新の場合だけ状態を上書きする。そうでなければ ErrConflict。
+	Update(ctx context.Context, st message.Status, revision uint64) error
+}
+
+// maxConflictRetries は競合時に読み直す上限。
+const maxConflictRetries = 5
+
+// Tracker は状態遷移を Store に記録する。
+type Tracker struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewTracker は Tracker を生成する。
+func NewTracker(store Store) *Tracker {
+	return &Tracker{store: store, now: message.NowUTC}
+}
+
+// Record は id の状態を state に進める。Status.Apply が無視する遷移は何もしない。
+// worker はサブジェクト単位の宛先（line など）しか知らないため、ingress が queued とともに記録する
+// 宛先（line-multicast など）は、worker の記録が先に届いていても優先する。
+func (t *Tracker) Record(ctx context.Context, id, destination string, state message.State, reason string, attempt int) error {
+	err := t.update(ctx, id, func(current message.Status) (message.Status, bool) {
+		if current.Destination == "" {
+			current.Destination = destination
+		}
+		next, ok := current.Apply(state, reason, attempt, t.now())
+		if state == message.StateQueued && destination != "" && next.Destination != destination {
+			next.Destination = destination
+			ok = true
+		}
+		return next, ok
+	})
+	if err != nil {
+		return fmt.Errorf("record %s for %s: %w", state, id, err)
+	}
+	return nil
+}
+
+// SaveRemote は送信先が振ったメッセージの識別子を id の記録に残す。
+func (t *Tracker) SaveRemote(ctx context.Context, id string, ref message.RemoteRef) error {
+	err := t.update(ctx, id, func(current message.Status) (message.Status, bool) {
+		current.Remote = &ref
+		return current, true
+	})
+	if err != nil {
+		return fmt.Errorf("save remote for %s: %w", id, err)
+	}
+	return nil
+}
+
+// update は id の記録を読み、fn で変えた内容を revision を確かめて書き戻す。競合したら読み直す。
+// fn が false を返したら書かない。
+func (t *Tracker) update(ctx context.Context, id string, fn func(message.Status) (message.Status, bool)) error {
+	for i := 0; i < maxConflictRetries; i++ {
+		current, rev, err := t.store.Get(ctx, id)
+		exists := err == nil
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if !exists {
+			current = message.Status{MessageID: id}
+		}
+		next, ok := fn(current)
+		if !ok {
+			return nil
+		}
+		if exists {
+			err = t.store.Update(ctx, next, rev)
+		} else {
+			err = t.store.Create(ctx, next)
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+// Get は id の状態を返す。
+func (t *Tracker) Get(ctx context.Context, id string) (message.Status, error) {
+	st, _, err := t.store.Get(ctx, id)
+	return st, err
+}
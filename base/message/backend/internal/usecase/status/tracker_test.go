@@ -0,0 +1,122 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+// 記録の新規作成・更新・競合時の読み直し・無視される遷移を確認する。
+func TestTracker_Record(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		initial   *message.Status
+		conflicts int
+		state     message.State
+		wantState message.State
+		wantErr   error
+		wantPuts  int
+	}{
+		{name: "未記録なら作成", state: message.StateQueued, wantState: message.StateQueued, wantPuts: 1},
+		{name: "記録済みなら更新", initial: &message.Status{MessageID: "m1", State: message.StateQueued}, state: message.StateSending, wantState: message.StateSending, wantPuts: 1},
+		{name: "競合したら読み直す", initial: &message.Status{MessageID: "m1", State: message.StateSending}, conflicts: 2, state: message.StateDelivered, wantState: message.StateDelivered, wantPuts: 3},
+		{name: "競合が続けば諦める", initial: &message.Status{MessageID: "m1", State: message.StateSending}, conflicts: 10, state: message.StateDelivered, wantState: message.StateSending, wantErr: ErrConflict, wantPuts: maxConflictRetries},
+		{name: "終端の後は書かない", initial: &message.Status{MessageID: "m1", State: message.StateDelivered}, state: message.StateFailed, wantState: message.StateDelivered},
+		{name: "予約中から queued に進める", initial: &message.Status{MessageID: "m1", State: message.StateScheduled}, state: message.StateQueued, wantState: message.StateQueued, wantPuts: 1},
+		{name: "送り出した後の scheduled は書かない", initial: &message.Status{MessageID: "m1", State: message.StateQueued}, state: message.StateScheduled, wantState: message.StateQueued},
+		{name: "取り消した後は書かない", initial: &message.Status{MessageID: "m1", State: message.StateCanceled}, state: message.StateQueued, wantState: message.StateCanceled},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := &fakeStore{conflicts: tt.conflicts}
+			if tt.initial != nil {
+				store.st, store.rev = *tt.initial, 1
+			}
+			tr := NewTracker(store)
+			tr.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			err := tr.Record(context.Background(), "m1", "line", tt.state, "", 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err=%v want=%v", err, tt.wantErr)
+			}
+			if store.puts != tt.wantPuts {
+				t.Fatalf("puts=%d want=%d", store.puts, tt.wantPuts)
+			}
+			got, err := tr.Get(context.Background(), "m1")
+			if err != nil || got.State != tt.wantState {
+				t.Fatalf("got=%+v err=%v", got, err)
+			}
+		})
+	}
+}
+
+// 送信先のメッセージIDは状態を変えずに記録に残す。
+// worker の記録が先に届いても、ingress が queued とともに記録する宛先を優先する。
+func TestTracker_Record_QueuedDestination(t *testing.T) {
+	t.Parallel()
+	store := &fakeStore{st: message.Status{MessageID: "m1", Destination: "line", State: message.StateDelivered}, rev: 1}
+	tr := NewTracker(store)
+
+	if err := tr.Record(context.Background(), "m1", message.DestinationLineNarrowcast, message.StateQueued, "", 0); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	got, _ := tr.Get(context.Background(), "m1")
+	if got.Destination != message.DestinationLineNarrowcast || got.State != message.StateDelivered || len(got.History) != 0 {
+		t.Fatalf("got=%+v", got)
+	}
+}
+
+func TestTracker_SaveRemote(t *testing.T) {
+	t.Parallel()
+	store := &fakeStore{st: message.Status{MessageID: "m1", State: message.StateSending}, rev: 1}
+	tr := NewTracker(store)
+
+	ref := message.RemoteRef{MessageID: "123", ThreadID: "456"}
+	if err := tr.SaveRemote(context.Background(), "m1", ref); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := tr.Get(context.Background(), "m1")
+	if got.State != message.StateSending || got.Remote == nil || *got.Remote != ref {
+		t.Fatalf("got=%+v", got)
+	}
+}
+
+// fakeStore は1件分の状態を持ち、conflicts 回まで書き込みを競合として断る。
+type fakeStore struct {
+	st        message.Status
+	rev       uint64
+	conflicts int
+	puts      int
+}
+
+func (f *fakeStore) Get(context.Context, string) (message.Status, uint64, error) {
+	if f.rev == 0 {
+		return message.Status{}, 0, ErrNotFound
+	}
+	return f.st, f.rev, nil
+}
+
+func (f *fakeStore) Create(_ context.Context, st message.Status) error {
+	return f.put(st, 0)
+}
+
+func (f *fakeStore) Update(_ context.Context, st message.Status, revision uint64) error {
+	return f.put(st, revision)
+}
+
+func (f *fakeStore) put(st message.Status, revision uint64) error {
+	f.puts++
+	if f.conflicts > 0 || revision != f.rev {
+		f.conflicts--
+		return ErrConflict
+	}
+	f.st, f.rev = st, f.rev+1
+	return nil
+}
@@ -42,19 +42,27 @@ func (h *LineWebhookHandler) Router() http.Handler {
 }
 
 type lineEventsRequest struct {
-	Destination string `json:"destination"`
-	Events      []struct {
-		Type    string `json:"type"`
-		Message *struct {
-			Type string `json:"type"`
-			ID   string `json:"id"`
-			Text string `json:"text"`
-		} `json:"message"`
-		Source struct {
-			Type   string `json:"type"`
-			UserID string `json:"userId"`
-		} `json:"source"`
-	} `json:"events"`
+	Destination string          `json:"destination"`
+	Events      []lineEventJSON `json:"events"`
+}
+
+// lineEventJSON はWebhookの1イベント。種別ごとの内容は該当するフィールドにだけ入る。
+type lineEventJSON struct {
+	Type            string           `json:"type"`
+	Mode            string           `json:"mode"`
+	Timestamp       int64            `json:"timestamp"`
+	WebhookEventID  string           `json:"webhookEventId"`
+	ReplyToken      string           `json:"replyToken"`
+	Source          lineevent.Source `json:"source"`
+	DeliveryContext struct {
+		IsRedelivery bool `json:"isRedelivery"`
+	} `json:"deliveryContext"`
+	Message  json.RawMessage         `json:"message"`
+	Follow   *lineevent.Follow       `json:"follow"`
+	Joined   *lineevent.MemberJoined `json:"joined"`
+	Left     *lineevent.MemberLeft   `json:"left"`
+	Postback *lineevent.Postback     `json:"postback"`
+	Beacon   *lineevent.Beacon       `json:"beacon"`
 }
 
 var errLineNoEvents = errors.New("line: events empty")
@@ -66,14 +74,28 @@ func (h *LineWebhookHandler) handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deps, err := h.resolver.ResolveLineWebhook(tenantID)
+	if err != nil {
+		http.Error(w, "unknown tenant", http.StatusBadRequest)
+		return
+	}
+
 	body, err := readBody(r, h.maxBody)
 	if err != nil {
 		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
+
+	// 署名は改変前の本文そのものに対して検証する。
+	result := verifyLineSignature(deps.ChannelSecret, body, r.Header.Get(lineSignatureHeader))
+	h.logger("line signature check tenant=%s result=%s request_id=%s", tenantID, result, middleware.GetReqID(r.Context()))
+	if result != signatureValid {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
 	h.logger("LINE body: %s", string(body))
 
-	payload, err := parseLinePayload(body)
+	events, skipped, err := parseLinePayload(body, time.Now())
 	if err != nil {
 		if errors.Is(err, errLineNoEvents) {
 			w.WriteHeader(http.StatusOK)
@@ -83,24 +105,24 @@ func (h *LineWebhookHandler) handle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
-
-	msg, err := json.Marshal(payload)
-	if err != nil {
-		h.logger("line payload encode error: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	deps, err := h.resolver.ResolveLineWebhook(tenantID)
-	if err != nil {
-		http.Error(w, "unknown tenant", http.StatusBadRequest)
-		return
+	for _, err := range skipped {
+		h.logger("line event skipped tenant=%s: %v", tenantID, err)
 	}
 
-	if err := deps.Producer.Publish(r.Context(), deps.Subject, msg); err != nil {
-		h.logger("line publish error: %v", err)
-		http.Error(w, "failed to publish", http.StatusBadGateway)
-		return
+	// イベントは1件ずつpublishする。途中で失敗した場合はLINEがバッチごと再送するため、
+	// 購読側は webhookEventId で重複を除く。
+	for _, ev := range events {
+		msg, err := json.Marshal(ev)
+		if err != nil {
+			h.logger("line payload encode error: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if err := deps.Producer.Publish(r.Context(), deps.Subject, msg); err != nil {
+			h.logger("line publish error: %v", err)
+			http.Error(w, "failed to publish", http.StatusBadGateway)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -108,25 +130,126 @@ func (h *LineWebhookHandler) handle(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{"status":"accepted"}`))
 }
 
-func parseLinePayload(body []byte) (*lineevent.Event, error) {
+// parseLinePayload はバッチ内の全イベントを型付きのイベントに変換する。
+// 不正なイベントはバッチ全体を拒否せずに読み飛ばし、その理由を skipped に入れて返す。
+func parseLinePayload(body []byte, receivedAt time.Time) (events []*lineevent.Event, skipped []error, err error) {
 	var req lineEventsRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(req.Events) == 0 {
-		return nil, errLineNoEvents
+		return nil, nil, errLineNoEvents
 	}
-	evt := req.Events[0]
-	message := json.RawMessage(nil)
-	if evt.Type == "message" && evt.Message != nil {
-		msg := map[string]string{
-			"message": evt.Message.Text,
-		}
-		buf, err := json.Marshal(msg)
+	for i, raw := range req.Events {
+		ev, err := buildLineEvent(req.Destination, raw, receivedAt)
 		if err != nil {
-			return nil, fmt.Errorf("encode message: %w", err)
+			skipped = append(skipped, fmt.Errorf("event[%d] type=%s id=%s: %w", i, raw.Type, raw.WebhookEventID, err))
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, skipped, nil
+}
+
+func buildLineEvent(destination string, raw lineEventJSON, receivedAt time.Time) (*lineevent.Event, error) {
+	detail, err := lineDetail(raw)
+	if err != nil {
+		return nil, err
+	}
+	var ts time.Time
+	if raw.Timestamp > 0 {
+		ts = time.UnixMilli(raw.Timestamp).UTC()
+	}
+	return lineevent.New(lineevent.Params{
+		Destination:    destination,
+		WebhookEventID: raw.WebhookEventID,
+		ReplyToken:     raw.ReplyToken,
+		Mode:           raw.Mode,
+		Source:         raw.Source,
+		Timestamp:      ts,
+		Redelivery:     raw.DeliveryContext.IsRedelivery,
+		Detail:         detail,
+		ReceivedAt:     receivedAt,
+	})
+}
+
+// lineDetail はイベント種別に応じた内容を取り出す。未対応の種別は Unknown として残す。
+func lineDetail(raw lineEventJSON) (lineevent.Detail, error) {
+	switch lineevent.Type(raw.Type) {
+	case lineevent.TypeMessage:
+		return lineMessage(raw.Message)
+	case lineevent.TypeFollow:
+		if raw.Follow != nil {
+			return *raw.Follow, nil
+		}
+		return lineevent.Follow{}, nil
+	case lineevent.TypeUnfollow:
+		return lineevent.Unfollow{}, nil
+	case lineevent.TypeJoin:
+		return lineevent.Join{}, nil
+	case lineevent.TypeLeave:
+		return lineevent.Leave{}, nil
+	case lineevent.TypeMemberJoined:
+		if raw.Joined == nil {
+			return nil, errors.New("joined is missing")
 		}
-		message = buf
+		return *raw.Joined, nil
+	case lineevent.TypeMemberLeft:
+		if raw.Left == nil {
+			return nil, errors.New("left is missing")
+		}
+		return *raw.Left, nil
+	case lineevent.TypePostback:
+		if raw.Postback == nil {
+			return nil, errors.New("postback is missing")
+		}
+		return *raw.Postback, nil
+	case lineevent.TypeBeacon:
+		if raw.Beacon == nil {
+			return nil, errors.New("beacon is missing")
+		}
+		return *raw.Beacon, nil
+	default:
+		return lineevent.Unknown{Type: lineevent.Type(raw.Type)}, nil
+	}
+}
+
+// lineMessage はメッセージの種別に応じた型に変換する。
+func lineMessage(raw json.RawMessage) (lineevent.Message, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("message is missing")
+	}
+	var head struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	switch lineevent.MessageType(head.Type) {
+	case lineevent.MessageText:
+		return decodeMessage[lineevent.TextMessage](raw)
+	case lineevent.MessageImage:
+		return decodeMessage[lineevent.ImageMessage](raw)
+	case lineevent.MessageVideo:
+		return decodeMessage[lineevent.VideoMessage](raw)
+	case lineevent.MessageAudio:
+		return decodeMessage[lineevent.AudioMessage](raw)
+	case lineevent.MessageFile:
+		return decodeMessage[lineevent.FileMessage](raw)
+	case lineevent.MessageLocation:
+		return decodeMessage[lineevent.LocationMessage](raw)
+	case lineevent.MessageSticker:
+		return decodeMessage[lineevent.StickerMessage](raw)
+	default:
+		return lineevent.UnknownMessage{ID: head.ID, Type: lineevent.MessageType(head.Type)}, nil
+	}
+}
+
+func decodeMessage[T lineevent.Message](raw json.RawMessage) (lineevent.Message, error) {
+	var m T
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("decode %s message: %w", m.MessageType(), err)
 	}
-	return lineevent.New(req.Destination, evt.Type, evt.Source.UserID, message, time.Now())
+	return m, nil
 }
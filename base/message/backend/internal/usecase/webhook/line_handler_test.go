@@ -1,46 +1,126 @@
 package webhook
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/adapter/http/handler"
+	"github.com/sngm3741/roots/base/message/internal/domain/lineevent"
 )
 
+// バッチ内の全イベントが種別ごとの型で取り出されることを確認する。
 func TestParseLinePayload(t *testing.T) {
 	now := time.Now()
 	body := []byte(`{
 		"destination": "dest",
-		"events": [{
-			"type": "message",
-			"message": {"type":"text","id":"1","text":"hello"},
-			"source": {"type":"user","userId":"U123"}
-		}]
+		"events": [
+			{"type":"message","webhookEventId":"e1","replyToken":"r1","timestamp":1735689600000,"mode":"active",
+			 "deliveryContext":{"isRedelivery":true},
+			 "message":{"type":"text","id":"1","text":"hello"},"source":{"type":"user","userId":"U123"}},
+			{"type":"message","webhookEventId":"e2","message":{"type":"image","id":"2","contentProvider":{"type":"line"}},"source":{"type":"user","userId":"U123"}},
+			{"type":"message","webhookEventId":"e3","message":{"type":"sticker","id":"3","packageId":"446","stickerId":"1988"},"source":{"type":"group","groupId":"C1","userId":"U123"}},
+			{"type":"message","webhookEventId":"e4","message":{"type":"location","id":"4","title":"店","latitude":35.1,"longitude":139.2},"source":{"type":"room","roomId":"R1"}},
+			{"type":"follow","webhookEventId":"e5","follow":{"isUnblocked":true},"source":{"type":"user","userId":"U123"}},
+			{"type":"unfollow","webhookEventId":"e6","source":{"type":"user","userId":"U123"}},
+			{"type":"postback","webhookEventId":"e7","postback":{"data":"action=buy","params":{"date":"2025-01-01"}},"source":{"type":"user","userId":"U123"}},
+			{"type":"beacon","webhookEventId":"e8","beacon":{"hwid":"d41d8cd98f","type":"enter"},"source":{"type":"user","userId":"U123"}},
+			{"type":"join","webhookEventId":"e9","source":{"type":"group","groupId":"C1"}},
+			{"type":"memberJoined","webhookEventId":"e10","joined":{"members":[{"type":"user","userId":"U9"}]},"source":{"type":"group","groupId":"C1"}},
+			{"type":"memberLeft","webhookEventId":"e11","left":{"members":[{"type":"user","userId":"U9"}]},"source":{"type":"group","groupId":"C1"}},
+			{"type":"videoPlayComplete","webhookEventId":"e12","source":{"type":"user","userId":"U123"}}
+		]
 	}`)
 
-	ev, err := parseLinePayload(body)
+	events, skipped, err := parseLinePayload(body, now)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if ev.Destination() != "dest" {
-		t.Fatalf("destination mismatch: %s", ev.Destination())
+	if len(skipped) != 0 {
+		t.Fatalf("unexpected skipped: %v", skipped)
+	}
+	if len(events) != 12 {
+		t.Fatalf("events=%d want=12", len(events))
+	}
+
+	first := events[0]
+	if first.Destination() != "dest" || first.WebhookEventID() != "e1" || first.ReplyToken() != "r1" || first.Mode() != "active" {
+		t.Fatalf("envelope mismatch: %+v", first)
+	}
+	if !first.Redelivery() || !first.Timestamp().Equal(time.UnixMilli(1735689600000)) || !first.ReceivedAt().Equal(now) {
+		t.Fatalf("delivery context mismatch: redelivery=%v ts=%v", first.Redelivery(), first.Timestamp())
+	}
+	if got, ok := first.Detail().(lineevent.TextMessage); !ok || got.Text != "hello" {
+		t.Fatalf("text message mismatch: %#v", first.Detail())
+	}
+	if got, ok := events[1].Detail().(lineevent.ImageMessage); !ok || got.ContentProvider.Type != "line" {
+		t.Fatalf("image message mismatch: %#v", events[1].Detail())
+	}
+	if got, ok := events[2].Detail().(lineevent.StickerMessage); !ok || got.StickerID != "1988" || events[2].Source().GroupID != "C1" {
+		t.Fatalf("sticker message mismatch: %#v", events[2].Detail())
+	}
+	if got, ok := events[3].Detail().(lineevent.LocationMessage); !ok || got.Latitude != 35.1 || events[3].Source().Type != lineevent.SourceRoom {
+		t.Fatalf("location message mismatch: %#v", events[3].Detail())
+	}
+	if got, ok := events[4].Detail().(lineevent.Follow); !ok || !got.IsUnblocked {
+		t.Fatalf("follow mismatch: %#v", events[4].Detail())
+	}
+	if _, ok := events[5].Detail().(lineevent.Unfollow); !ok {
+		t.Fatalf("unfollow mismatch: %#v", events[5].Detail())
+	}
+	if got, ok := events[6].Detail().(lineevent.Postback); !ok || got.Data != "action=buy" || got.Params["date"] != "2025-01-01" {
+		t.Fatalf("postback mismatch: %#v", events[6].Detail())
 	}
-	if ev.EventType() != "message" {
-		t.Fatalf("event type mismatch: %s", ev.EventType())
+	if got, ok := events[7].Detail().(lineevent.Beacon); !ok || got.Type != "enter" {
+		t.Fatalf("beacon mismatch: %#v", events[7].Detail())
 	}
-	if ev.UserID() != "U123" {
-		t.Fatalf("user id mismatch: %s", ev.UserID())
+	if events[8].EventType() != lineevent.TypeJoin || events[8].UserID() != "" {
+		t.Fatalf("join mismatch: %#v", events[8].Detail())
 	}
-	if len(ev.Message()) == 0 {
-		t.Fatalf("expected message content")
+	if got, ok := events[9].Detail().(lineevent.MemberJoined); !ok || len(got.Members) != 1 || got.Members[0].UserID != "U9" {
+		t.Fatalf("memberJoined mismatch: %#v", events[9].Detail())
 	}
-	if ev.ReceivedAt().IsZero() || ev.ReceivedAt().Before(now) {
-		t.Fatalf("unexpected ReceivedAt: %v", ev.ReceivedAt())
+	if _, ok := events[10].Detail().(lineevent.MemberLeft); !ok {
+		t.Fatalf("memberLeft mismatch: %#v", events[10].Detail())
+	}
+	if events[11].EventType() != "videoPlayComplete" {
+		t.Fatalf("unknown event mismatch: %s", events[11].EventType())
+	}
+}
+
+// 不正なイベントだけを読み飛ばし、残りは取り出すことを確認する。
+func TestParseLinePayload_SkipsInvalidEvents(t *testing.T) {
+	body := []byte(`{"destination":"dest","events":[
+		{"type":"message","webhookEventId":"bad1","source":{"type":"user","userId":"U1"}},
+		{"type":"postback","webhookEventId":"bad2","source":{"type":"user","userId":"U1"}},
+		{"type":"follow","webhookEventId":"bad3","source":{"type":"user"}},
+		{"type":"follow","webhookEventId":"ok","source":{"type":"user","userId":"U1"}}
+	]}`)
+	events, skipped, err := parseLinePayload(body, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].WebhookEventID() != "ok" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	if len(skipped) != 3 {
+		t.Fatalf("skipped=%v want 3", skipped)
 	}
 }
 
 func TestParseLinePayload_NoEvents(t *testing.T) {
 	body := []byte(`{"destination": "dest", "events": []}`)
-	_, err := parseLinePayload(body)
+	_, _, err := parseLinePayload(body, time.Now())
 	if !errors.Is(err, errLineNoEvents) {
 		t.Fatalf("expected errLineNoEvents, got %v", err)
 	}
@@ -48,7 +128,131 @@ func TestParseLinePayload_NoEvents(t *testing.T) {
 
 func TestParseLinePayload_InvalidJSON(t *testing.T) {
 	body := []byte(`{invalid`)
-	if _, err := parseLinePayload(body); err == nil {
+	if _, _, err := parseLinePayload(body, time.Now()); err == nil {
 		t.Fatalf("expected error")
 	}
 }
+
+// バッチ内のイベントが1件ずつpublishされることを確認する。
+func TestLineWebhookHandler_PublishesEachEvent(t *testing.T) {
+	t.Parallel()
+
+	const secret = "channel-secret"
+	body := []byte(`{"destination":"dest","events":[
+		{"type":"message","webhookEventId":"e1","message":{"type":"text","id":"1","text":"hello"},"source":{"type":"user","userId":"U1"}},
+		{"type":"follow","webhookEventId":"e2","source":{"type":"user","userId":"U2"}},
+		{"type":"postback","webhookEventId":"e3","postback":{"data":"a=1"},"source":{"type":"user","userId":"U3"}}
+	]}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	producer := &fakeProducer{}
+	resolver := &fakeLineWebhookResolver{deps: handler.LineWebhookDeps{Producer: producer, Subject: "line.events", ChannelSecret: secret}}
+	h := NewLineWebhookHandler(resolver, 1<<20, func(string, ...any) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Host = "tenant1.webhook.example.com"
+	req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	rr := httptest.NewRecorder()
+	h.Router().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	if len(producer.data) != 3 {
+		t.Fatalf("published=%d want=3", len(producer.data))
+	}
+	for i, want := range []string{"e1", "e2", "e3"} {
+		var got struct {
+			WebhookEventID string `json:"webhookEventId"`
+		}
+		if err := json.Unmarshal(producer.data[i], &got); err != nil {
+			t.Fatalf("decode published: %v", err)
+		}
+		if got.WebhookEventID != want || producer.subjects[i] != "line.events" {
+			t.Fatalf("published[%d]=%s subject=%s", i, producer.data[i], producer.subjects[i])
+		}
+	}
+}
+
+// X-Line-Signature の検証結果に応じて中継または401を返すことを確認する。
+func TestLineWebhookHandler_Signature(t *testing.T) {
+	t.Parallel()
+
+	const secret = "channel-secret"
+	body := []byte(`{"destination":"dest","events":[{"type":"message","message":{"type":"text","id":"1","text":"hello"},"source":{"type":"user","userId":"U123"}}]}`)
+	sign := func(key string, b []byte) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(b)
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name        string
+		body        []byte
+		signature   string
+		wantStatus  int
+		wantPublish int
+		wantResult  signatureResult
+	}{
+		{name: "正しい署名", body: body, signature: sign(secret, body), wantStatus: http.StatusAccepted, wantPublish: 1, wantResult: signatureValid},
+		{name: "署名なし", body: body, wantStatus: http.StatusUnauthorized, wantResult: signatureMissing},
+		{name: "Base64でない", body: body, signature: "%%%", wantStatus: http.StatusUnauthorized, wantResult: signatureMalformed},
+		{name: "別の鍵で署名", body: body, signature: sign("other", body), wantStatus: http.StatusUnauthorized, wantResult: signatureMismatch},
+		{name: "本文の改ざん", body: append([]byte(" "), body...), signature: sign(secret, body), wantStatus: http.StatusUnauthorized, wantResult: signatureMismatch},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			producer := &fakeProducer{}
+			resolver := &fakeLineWebhookResolver{deps: handler.LineWebhookDeps{Producer: producer, Subject: "line.events", ChannelSecret: secret}}
+			var logs []string
+			h := NewLineWebhookHandler(resolver, 1<<20, func(format string, v ...any) {
+				logs = append(logs, fmt.Sprintf(format, v...))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			req.Host = "tenant1.webhook.example.com"
+			if tt.signature != "" {
+				req.Header.Set("X-Line-Signature", tt.signature)
+			}
+			rr := httptest.NewRecorder()
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status=%d want=%d", rr.Code, tt.wantStatus)
+			}
+			if len(producer.subjects) != tt.wantPublish {
+				t.Fatalf("published=%d want=%d", len(producer.subjects), tt.wantPublish)
+			}
+			if len(logs) == 0 || !strings.Contains(logs[0], "tenant=tenant1 result="+string(tt.wantResult)) {
+				t.Fatalf("unexpected logs: %v", logs)
+			}
+		})
+	}
+}
+
+type fakeLineWebhookResolver struct {
+	deps handler.LineWebhookDeps
+	err  error
+}
+
+func (f *fakeLineWebhookResolver) ResolveLineWebhook(string) (handler.LineWebhookDeps, error) {
+	return f.deps, f.err
+}
+
+type fakeProducer struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (f *fakeProducer) Publish(_ context.Context, subject string, data []byte) error {
+	f.subjects = append(f.subjects, subject)
+	f.data = append(f.data, data)
+	return nil
+}
+
+func (f *fakeProducer) PublishWithID(ctx context.Context, subject, _ string, data []byte) (bool, error) {
+	return false, f.Publish(ctx, subject, data)
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// lineSignatureHeader はLINEが本文の署名を載せるヘッダ。
+const lineSignatureHeader = "X-Line-Signature"
+
+// signatureResult は署名検証の結果。ログにそのまま出す。
+type signatureResult string
+
+const (
+	signatureValid     signatureResult = "valid"
+	signatureMissing   signatureResult = "missing"
+	signatureMalformed signatureResult = "malformed"
+	signatureMismatch  signatureResult = "mismatch"
+)
+
+// verifyLineSignature は生の本文に対する HMAC-SHA256（鍵はチャネルシークレット）を
+// Base64 の X-Line-Signature と定数時間で比較する。
+func verifyLineSignature(channelSecret string, body []byte, signature string) signatureResult {
+	signature = strings.TrimSpace(signature)
+	if signature == "" {
+		return signatureMissing
+	}
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return signatureMalformed
+	}
+	mac := hmac.New(sha256.New, []byte(channelSecret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return signatureMismatch
+	}
+	return signatureValid
+}
@@ -0,0 +1,225 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+)
+
+// 配送不能キューへ移したメッセージに付けるヘッダ。本文は元のまま残し、再投入できるようにする。
+const (
+	HeaderLastError       = "Message-Last-Error"
+	HeaderOriginalSubject = "Message-Original-Subject"
+	HeaderNumDelivered    = "Message-Num-Delivered"
+	HeaderStreamSequence  = "Message-Stream-Sequence"
+	HeaderFailedAt        = "Message-Failed-At"
+)
+
+// dlqPublishTimeout は配送不能キューへのpublishを待つ上限。
+const dlqPublishTimeout = 5 * time.Second
+
+// statusRecordTimeout は配送状態の記録を待つ上限。
+const statusRecordTimeout = 3 * time.Second
+
+// DeliveryPolicy は再送と配送不能時の扱い。
+type DeliveryPolicy struct {
+	// MaxDeliver は最大配送回数。到達したら配送不能キューへ移す。回数は worker が数え、
+	// JetStream のコンシューマには上限を付けない（配送不能キューへ移せなかったメッセージを再配送させるため）。
+	MaxDeliver int
+	// AckWait は応答がないまま処理中とみなす期間。過ぎると JetStream が再配送する。
+	AckWait time.Duration
+	// Backoff は再送間隔の初期値で、再送ごとに倍にして MaxBackoff で頭打ちにする。
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// DeadLetterSubject は配送を諦めたメッセージの行き先。
+	DeadLetterSubject string
+}
+
+// delay は n 回目の配送に失敗した後の待ち時間を返す。
+func (p DeliveryPolicy) delay(n uint64) time.Duration {
+	d := p.Backoff
+	for i := uint64(1); i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// DeadLetterPublisher は配送不能キューへpublishする。jetstream.JetStream が満たす。
+type DeadLetterPublisher interface {
+	PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// StatusRecorder は配送状態を記録する。status.Tracker が満たす。
+type StatusRecorder interface {
+	Record(ctx context.Context, id, destination string, state message.State, reason string, attempt int) error
+}
+
+// permanentError は再送しても結果が変わらない失敗を表す。
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent は err を再送しない失敗として扱うよう包む。
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryable は時間をおけば成功しうる失敗かを返す。送信先のステータスで判断できるものはそれに従い、
+// それ以外（ネットワークエラーなど）は再送する。
+func retryable(err error) bool {
+	var p *permanentError
+	if errors.As(err, &p) {
+		return false
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return true
+}
+
+// consumer はJetStreamの永続プルコンシューマで1サブジェクトを処理する。
+type consumer struct {
+	name        string
+	subject     string
+	destination string
+	policy      DeliveryPolicy
+	dlq         DeadLetterPublisher
+	// status が nil なら配送状態を記録しない。
+	status StatusRecorder
+	// handle は1メッセージを処理する。時間のかかる処理は途中で progress を呼び、AckWait による再配送を防ぐ。
+	handle func(data []byte, progress func()) error
+	logger func(format string, v ...any)
+	now    func() time.Time
+	// causes は配送不能キューへ移せなかったメッセージの失敗理由をストリームのシーケンスごとに覚えておく。
+	// 再配送で移動だけをやり直すときのヘッダに使う。
+	causes sync.Map
+}
+
+// start はコンシューマを作成または更新し、受信を始める。
+func (c *consumer) start(ctx context.Context, js jetstream.JetStream, stream string) (jetstream.ConsumeContext, error) {
+	cons, err := js.CreateOrUpdateConsumer(ctx, stream, c.config())
+	if err != nil {
+		return nil, fmt.Errorf("consumer %s: %w", c.name, err)
+	}
+	return cons.Consume(c.process)
+}
+
+// config はコンシューマの設定を返す。MaxDeliver に達したメッセージをサーバーが配送しなくなると、
+// 配送不能キューへ移せなかったときに nak しても戻ってこないため、上限は付けずに process で数える。
+func (c *consumer) config() jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:       c.name,
+		FilterSubject: c.subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		MaxDeliver:    -1,
+		AckWait:       c.policy.AckWait,
+	}
+}
+
+// process は1メッセージを処理し、結果に応じて ack・遅延付き nak・配送不能キューへの移動を行う。
+// ingress が Nats-Msg-Id を付けたメッセージは、各段階の状態をそのIDで記録する。
+func (c *consumer) process(msg jetstream.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		c.logger("%s: metadata error: %v", c.name, err)
+		_ = msg.Term()
+		return
+	}
+	id := msg.Headers().Get(jetstream.MsgIDHeader)
+	attempt := int(meta.NumDelivered)
+	if c.policy.MaxDeliver > 0 && meta.NumDelivered > uint64(c.policy.MaxDeliver) {
+		// 最大配送回数を使い切った後の再配送。送り直さず、配送不能キューへの移動だけをやり直す。
+		cause := "max deliveries exceeded"
+		if v, ok := c.causes.Load(meta.Sequence.Stream); ok {
+			cause = v.(string)
+		}
+		c.moveToDeadLetter(msg, meta, id, attempt, cause)
+		return
+	}
+	c.record(id, message.StateSending, "", attempt)
+
+	herr := c.handle(msg.Data(), func() {
+		if err := msg.InProgress(); err != nil {
+			c.logger("%s: in-progress error seq=%d: %v", c.name, meta.Sequence.Stream, err)
+		}
+	})
+	if herr == nil {
+		c.record(id, message.StateDelivered, "", attempt)
+		if err := msg.Ack(); err != nil {
+			c.logger("%s: ack error seq=%d: %v", c.name, meta.Sequence.Stream, err)
+		}
+		return
+	}
+
+	if retryable(herr) && (c.policy.MaxDeliver <= 0 || meta.NumDelivered < uint64(c.policy.MaxDeliver)) {
+		wait := c.policy.delay(meta.NumDelivered)
+		c.logger("%s: delivery failed seq=%d attempt=%d, retrying in %s: %v", c.name, meta.Sequence.Stream, meta.NumDelivered, wait, herr)
+		c.record(id, message.StateFailed, herr.Error(), attempt)
+		_ = msg.NakWithDelay(wait)
+		return
+	}
+
+	c.moveToDeadLetter(msg, meta, id, attempt, herr.Error())
+}
+
+// moveToDeadLetter は配送不能キューへ移して終了させる。移せなかった場合は失わないよう遅延付きで nak し、
+// 再配送されたら process が移動だけをやり直す。
+func (c *consumer) moveToDeadLetter(msg jetstream.Msg, meta *jetstream.MsgMetadata, id string, attempt int, cause string) {
+	if err := c.deadLetter(msg, meta, cause); err != nil {
+		c.logger("%s: dead-letter publish failed seq=%d: %v", c.name, meta.Sequence.Stream, err)
+		c.causes.Store(meta.Sequence.Stream, cause)
+		c.record(id, message.StateFailed, cause, attempt)
+		_ = msg.NakWithDelay(c.policy.delay(meta.NumDelivered))
+		return
+	}
+	c.causes.Delete(meta.Sequence.Stream)
+	c.logger("%s: moved to dead-letter seq=%d attempts=%d: %s", c.name, meta.Sequence.Stream, meta.NumDelivered, cause)
+	c.record(id, message.StateDeadLettered, cause, attempt)
+	_ = msg.Term()
+}
+
+// record は配送状態を記録する。記録の失敗は配送に影響させず、ログに残すだけにする。
+func (c *consumer) record(id string, state message.State, reason string, attempt int) {
+	if c.status == nil || id == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusRecordTimeout)
+	defer cancel()
+	if err := c.status.Record(ctx, id, c.destination, state, reason, attempt); err != nil {
+		c.logger("%s: status record failed id=%s state=%s: %v", c.name, id, state, err)
+	}
+}
+
+func (c *consumer) deadLetter(msg jetstream.Msg, meta *jetstream.MsgMetadata, cause string) error {
+	if c.policy.DeadLetterSubject == "" || c.dlq == nil {
+		return errors.New("dead-letter subject is not configured")
+	}
+	out := nats.NewMsg(c.policy.DeadLetterSubject)
+	out.Data = msg.Data()
+	out.Header.Set(HeaderLastError, cause)
+	out.Header.Set(HeaderOriginalSubject, msg.Subject())
+	out.Header.Set(HeaderNumDelivered, strconv.FormatUint(meta.NumDelivered, 10))
+	out.Header.Set(HeaderStreamSequence, strconv.FormatUint(meta.Sequence.Stream, 10))
+	out.Header.Set(HeaderFailedAt, c.now().UTC().Format(time.RFC3339))
+
+	ctx, cancel := context.WithTimeout(context.Background(), dlqPublishTimeout)
+	defer cancel()
+	_, err := c.dlq.PublishMsg(ctx, out)
+	return err
+}
@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
+)
+
+// 処理結果と配送回数に応じて ack・遅延付き nak・配送不能キューへの移動を選ぶことを確認する。
+func TestConsumer_Process(t *testing.T) {
+	t.Parallel()
+
+	policy := DeliveryPolicy{MaxDeliver: 4, Backoff: time.Second, MaxBackoff: 3 * time.Second, DeadLetterSubject: "message.dlq.t1"}
+	tests := []struct {
+		name      string
+		handleErr error
+		delivered uint64
+		dlqErr    error
+		wantAck   bool
+		wantNak   time.Duration
+		wantTerm  bool
+		wantDLQ   bool
+		wantState []message.State
+	}{
+		{name: "成功はack", delivered: 1, wantAck: true, wantState: []message.State{message.StateSending, message.StateDelivered}},
+		{name: "初回の一時エラーは初期間隔で再送", handleErr: &line.StatusError{StatusCode: 503}, delivered: 1, wantNak: time.Second, wantState: []message.State{message.StateSending, message.StateFailed}},
+		{name: "2回目は倍の間隔", handleErr: errors.New("connection reset"), delivered: 2, wantNak: 2 * time.Second},
+		{name: "間隔は上限で頭打ち", handleErr: &line.StatusError{StatusCode: 429}, delivered: 3, wantNak: 3 * time.Second},
+		{name: "最大配送回数で配送不能キューへ", handleErr: &line.StatusError{StatusCode: 500}, delivered: 4, wantTerm: true, wantDLQ: true, wantState: []message.State{message.StateSending, message.StateDeadLettered}},
+		{name: "4xxは即座に配送不能キューへ", handleErr: &line.StatusError{StatusCode: 400}, delivered: 1, wantTerm: true, wantDLQ: true},
+		{name: "不正な内容は即座に配送不能キューへ", handleErr: permanent(errors.New("message empty")), delivered: 1, wantTerm: true, wantDLQ: true},
+		{name: "配送不能キューへ移せなければ再送", handleErr: permanent(errors.New("message empty")), delivered: 1, dlqErr: errors.New("no responders"), wantNak: time.Second, wantDLQ: true, wantState: []message.State{message.StateSending, message.StateFailed}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dlq := &fakeDeadLetter{err: tt.dlqErr}
+			rec := &fakeRecorder{}
+			c := &consumer{
+				name:        "line-worker",
+				subject:     "line.events.t1",
+				destination: "line",
+				policy:      policy,
+				dlq:         dlq,
+				status:      rec,
+				handle:      func([]byte, func()) error { return tt.handleErr },
+				logger:      func(string, ...any) {},
+				now:         func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) },
+			}
+			msg := &fakeMsg{subject: "line.events.t1", data: []byte(`{"userId":"U1"}`), delivered: tt.delivered, seq: 42, msgID: "m1"}
+			c.process(msg)
+
+			if msg.acked != tt.wantAck || msg.nakDelay != tt.wantNak || msg.termed != tt.wantTerm {
+				t.Fatalf("ack=%v nak=%s term=%v", msg.acked, msg.nakDelay, msg.termed)
+			}
+			if (len(dlq.msgs) > 0) != tt.wantDLQ {
+				t.Fatalf("dlq=%d want=%v", len(dlq.msgs), tt.wantDLQ)
+			}
+			if tt.wantState != nil && !slices.Equal(rec.states, tt.wantState) {
+				t.Fatalf("states=%v want=%v", rec.states, tt.wantState)
+			}
+			for _, r := range rec.reasons[1:] {
+				if tt.handleErr != nil && r != tt.handleErr.Error() {
+					t.Fatalf("reason=%q", r)
+				}
+			}
+			if tt.wantDLQ {
+				out := dlq.msgs[0]
+				if out.Subject != "message.dlq.t1" || string(out.Data) != string(msg.data) {
+					t.Fatalf("unexpected dlq msg: %s %s", out.Subject, out.Data)
+				}
+				if out.Header.Get(HeaderLastError) != tt.handleErr.Error() ||
+					out.Header.Get(HeaderOriginalSubject) != "line.events.t1" ||
+					out.Header.Get(HeaderStreamSequence) != "42" ||
+					out.Header.Get(HeaderFailedAt) != "2025-01-01T00:00:00Z" {
+					t.Fatalf("unexpected dlq headers: %v", out.Header)
+				}
+			}
+		})
+	}
+}
+
+// 最後の配送で配送不能キューへ移せなかったメッセージは、再配送で送り直さずに移動だけをやり直す。
+func TestConsumer_Process_DeadLetterRetry(t *testing.T) {
+	t.Parallel()
+
+	dlq := &fakeDeadLetter{err: errors.New("no responders")}
+	rec := &fakeRecorder{}
+	handled := 0
+	c := &consumer{
+		name:        "line-worker",
+		subject:     "line.events.t1",
+		destination: "line",
+		policy:      DeliveryPolicy{MaxDeliver: 2, Backoff: time.Second, MaxBackoff: time.Minute, DeadLetterSubject: "message.dlq.t1"},
+		dlq:         dlq,
+		status:      rec,
+		handle: func([]byte, func()) error {
+			handled++
+			return &line.StatusError{StatusCode: 503}
+		},
+		logger: func(string, ...any) {},
+		now:    time.Now,
+	}
+
+	last := &fakeMsg{subject: "line.events.t1", data: []byte(`{}`), delivered: 2, seq: 7, msgID: "m1"}
+	c.process(last)
+	if last.termed || last.nakDelay != 2*time.Second || handled != 1 {
+		t.Fatalf("last attempt: term=%v nak=%s handled=%d", last.termed, last.nakDelay, handled)
+	}
+
+	dlq.err = nil
+	redelivered := &fakeMsg{subject: "line.events.t1", data: []byte(`{}`), delivered: 3, seq: 7, msgID: "m1"}
+	c.process(redelivered)
+	if !redelivered.termed || handled != 1 {
+		t.Fatalf("redelivery: term=%v handled=%d", redelivered.termed, handled)
+	}
+	if len(dlq.msgs) != 2 || dlq.msgs[1].Header.Get(HeaderLastError) != "line push: status 503" {
+		t.Fatalf("dlq=%d last error=%q", len(dlq.msgs), dlq.msgs[len(dlq.msgs)-1].Header.Get(HeaderLastError))
+	}
+	want := []message.State{message.StateSending, message.StateFailed, message.StateDeadLettered}
+	if !slices.Equal(rec.states, want) {
+		t.Fatalf("states=%v want=%v", rec.states, want)
+	}
+}
+
+// コンシューマには配送回数の上限を付けず、AckWait は設定どおりにする。
+func TestConsumer_Config(t *testing.T) {
+	t.Parallel()
+
+	c := &consumer{name: "line-worker", subject: "line.events.t1", policy: DeliveryPolicy{MaxDeliver: 5, AckWait: 45 * time.Second}}
+	cfg := c.config()
+	if cfg.MaxDeliver != -1 || cfg.AckWait != 45*time.Second || cfg.Durable != "line-worker" || cfg.FilterSubject != "line.events.t1" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+// ingress を経由しない（Nats-Msg-Id のない）メッセージは状態を記録しない。
+func TestConsumer_Process_WithoutMsgID(t *testing.T) {
+	t.Parallel()
+	rec := &fakeRecorder{}
+	c := &consumer{
+		name:    "line-worker",
+		subject: "line.events.t1",
+		status:  rec,
+		handle:  func([]byte, func()) error { return nil },
+		logger:  func(string, ...any) {},
+		now:     time.Now,
+	}
+	msg := &fakeMsg{subject: "line.events.t1", data: []byte(`{}`), delivered: 1}
+	c.process(msg)
+	if !msg.acked || len(rec.states) != 0 {
+		t.Fatalf("acked=%v states=%v", msg.acked, rec.states)
+	}
+}
+
+type fakeRecorder struct {
+	states  []message.State
+	reasons []string
+}
+
+func (f *fakeRecorder) Record(_ context.Context, id, destination string, state message.State, reason string, _ int) error {
+	if id != "m1" || destination != "line" {
+		return errors.New("unexpected id or destination")
+	}
+	f.states = append(f.states, state)
+	f.reasons = append(f.reasons, reason)
+	return nil
+}
+
+type fakeDeadLetter struct {
+	msgs []*nats.Msg
+	err  error
+}
+
+func (f *fakeDeadLetter) PublishMsg(_ context.Context, msg *nats.Msg, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	f.msgs = append(f.msgs, msg)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &jetstream.PubAck{}, nil
+}
+
+type fakeMsg struct {
+	jetstream.Msg
+	subject   string
+	data      []byte
+	delivered uint64
+	seq       uint64
+	msgID     string
+
+	acked      bool
+	nakDelay   time.Duration
+	termed     bool
+	inProgress int
+}
+
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered, Sequence: jetstream.SequencePair{Stream: m.seq}}, nil
+}
+func (m *fakeMsg) Headers() nats.Header {
+	h := nats.Header{}
+	if m.msgID != "" {
+		h.Set(jetstream.MsgIDHeader, m.msgID)
+	}
+	return h
+}
+func (m *fakeMsg) Data() []byte    { return m.data }
+func (m *fakeMsg) Subject() string { return m.subject }
+func (m *fakeMsg) Ack() error      { m.acked = true; return nil }
+func (m *fakeMsg) NakWithDelay(d time.Duration) error {
+	m.nakDelay = d
+	return nil
+}
+func (m *fakeMsg) Term() error { m.termed = true; return nil }
+func (m *fakeMsg) InProgress() error {
+	m.inProgress++
+	return nil
+}
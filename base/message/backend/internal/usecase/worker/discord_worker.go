@@ -1,70 +1,162 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
 	"github.com/sngm3741/roots/base/message/internal/infra/discord"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
+// RemoteRefStore は送信要求ごとにDiscordが振った投稿IDを保存・参照する。status.Tracker が満たす。
+type RemoteRefStore interface {
+	Get(ctx context.Context, id string) (message.Status, error)
+	SaveRemote(ctx context.Context, id string, ref message.RemoteRef) error
+}
+
 // DiscordWorker はDiscord向けメッセージを処理する。
 type DiscordWorker struct {
 	subject string
 	client  discord.Sender
-	logger  func(format string, v ...any)
+	// refs が nil なら投稿IDを保存せず、編集・削除は処理できない。
+	refs   RemoteRefStore
+	logger func(format string, v ...any)
 }
 
 // NewDiscordWorker はDiscordWorkerを初期化する。
-func NewDiscordWorker(subject string, client discord.Sender, logger func(format string, v ...any)) *DiscordWorker {
+func NewDiscordWorker(subject string, client discord.Sender, refs RemoteRefStore, logger func(format string, v ...any)) *DiscordWorker {
 	return &DiscordWorker{
 		subject: subject,
 		client:  client,
+		refs:    refs,
 		logger:  logger,
 	}
 }
 
-// Subscribe はNATS購読を開始する。
-func (w *DiscordWorker) Subscribe(nc *nats.Conn) error {
-	_, err := nc.Subscribe(w.subject, func(msg *nats.Msg) {
-		if err := w.handleMessage(msg.Data); err != nil {
-			w.logger("discord worker error: %v", err)
-		}
-	})
-	if err != nil {
-		return err
+// Start はJetStreamの永続プルコンシューマで購読を開始する。失敗は policy に従って再送し、
+// 諦めたものは配送不能キューへ移す。status が nil でなければ配送状態を記録する。
+func (w *DiscordWorker) Start(ctx context.Context, js jetstream.JetStream, stream string, policy DeliveryPolicy, status StatusRecorder) (jetstream.ConsumeContext, error) {
+	c := &consumer{
+		name:        "discord-worker",
+		subject:     w.subject,
+		destination: "discord",
+		policy:      policy,
+		dlq:         js,
+		status:      status,
+		handle:      w.handleMessage,
+		logger:      w.logger,
+		now:         time.Now,
 	}
-	return nc.Flush()
+	return c.start(ctx, js, stream)
 }
 
 type discordPayload struct {
-	Destination string    `json:"destination"`
-	UserID      string    `json:"userId"`
-	Message     json.RawMessage `json:"message"`
-	ReceivedAt  time.Time `json:"receivedAt"`
+	// ID は ingress が付けたメッセージID（UUID）。投稿IDの保存に使う。
+	ID          string         `json:"id"`
+	Destination string         `json:"destination"`
+	Action      message.Action `json:"action"`
+	// Target は編集・削除の対象の送信要求のメッセージID。
+	Target     string          `json:"target"`
+	UserID     string          `json:"userId"`
+	Message    json.RawMessage `json:"message"`
+	Discord    json.RawMessage `json:"discord"`
+	ReceivedAt time.Time       `json:"receivedAt"`
 }
 
-func (w *DiscordWorker) handleMessage(data []byte) error {
+func (w *DiscordWorker) handleMessage(data []byte, _ func()) error {
 	var payload discordPayload
 	if err := json.Unmarshal(data, &payload); err != nil {
-		return fmt.Errorf("decode payload: %w", err)
+		return permanent(fmt.Errorf("decode payload: %w", err))
 	}
-	text, err := extractDiscordText(payload.Message)
+	switch payload.Action {
+	case message.ActionSend:
+		return w.send(payload)
+	case message.ActionEdit:
+		ref, err := w.remoteRef(payload.Target)
+		if err != nil {
+			return err
+		}
+		p, err := discordmsg.ParseEdit(payload.Discord)
+		if err != nil {
+			return permanent(err)
+		}
+		return w.client.Edit(ref, p)
+	case message.ActionDelete:
+		ref, err := w.remoteRef(payload.Target)
+		if err != nil {
+			return err
+		}
+		return w.client.Delete(ref)
+	default:
+		return permanent(fmt.Errorf("unsupported action %q", payload.Action))
+	}
+}
+
+// send は投稿し、編集・削除できるよう投稿IDを保存する。投稿は済んでいるので、
+// 保存に失敗しても再送はせずログに残すだけにする。
+func (w *DiscordWorker) send(payload discordPayload) error {
+	p, err := discordContent(payload)
+	if err != nil {
+		return permanent(err)
+	}
+	ref, err := w.client.Send(p)
 	if err != nil {
 		return err
 	}
+	if w.refs == nil || payload.ID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusRecordTimeout)
+	defer cancel()
+	if err := w.refs.SaveRemote(ctx, payload.ID, ref); err != nil {
+		w.logger("discord-worker: save remote ref failed id=%s discord_id=%s: %v", payload.ID, ref.MessageID, err)
+	}
+	return nil
+}
+
+// discordContent は送る内容を取り出す。テキストだけの要求は本文のみの投稿にする。
+func discordContent(payload discordPayload) (discordmsg.Payload, error) {
+	if len(payload.Discord) > 0 {
+		return discordmsg.Parse(payload.Discord)
+	}
+	text, err := extractDiscordText(payload.Message)
+	if err != nil {
+		return discordmsg.Payload{}, err
+	}
 	if text == "" {
-		return errors.New("message empty")
+		return discordmsg.Payload{}, errors.New("message empty")
 	}
-	return w.client.Send(text)
+	return discordmsg.Payload{Content: text}, nil
 }
 
-func (w *DiscordWorker) deliverToDiscord(text string) error {
-	return w.client.Send(text)
+// remoteRef は対象の送信要求の投稿IDを返す。対象がまだ送られていなければ再送で待つ。
+func (w *DiscordWorker) remoteRef(target string) (message.RemoteRef, error) {
+	if w.refs == nil {
+		return message.RemoteRef{}, permanent(errors.New("remote ref store is not configured"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusRecordTimeout)
+	defer cancel()
+	st, err := w.refs.Get(ctx, target)
+	switch {
+	case errors.Is(err, status.ErrNotFound):
+		return message.RemoteRef{}, permanent(fmt.Errorf("target %s: %w", target, err))
+	case err != nil:
+		return message.RemoteRef{}, fmt.Errorf("target %s: %w", target, err)
+	case st.Remote != nil:
+		return *st.Remote, nil
+	case st.State.Terminal():
+		return message.RemoteRef{}, permanent(fmt.Errorf("target %s is %s without a discord message id", target, st.State))
+	default:
+		return message.RemoteRef{}, fmt.Errorf("target %s is not delivered yet (%s)", target, st.State)
+	}
 }
 
 // extractDiscordText は RawMessage から message フィールドを取り出す。
@@ -81,8 +173,8 @@ func extractDiscordText(raw json.RawMessage) (string, error) {
 	return strings.TrimSpace(body.Message), nil
 }
 
-// BuildDiscordWorker はDiscordWorker購読をセットアップする。
-func BuildDiscordWorker(subject string, nc *nats.Conn, client discord.Sender, logger func(format string, v ...any)) error {
-	w := NewDiscordWorker(subject, client, logger)
-	return w.Subscribe(nc)
+// BuildDiscordWorker はDiscordWorkerの購読をセットアップする。
+func BuildDiscordWorker(ctx context.Context, subject string, js jetstream.JetStream, stream string, policy DeliveryPolicy, status StatusRecorder, refs RemoteRefStore, client discord.Sender, logger func(format string, v ...any)) (jetstream.ConsumeContext, error) {
+	w := NewDiscordWorker(subject, client, refs, logger)
+	return w.Start(ctx, js, stream, policy, status)
 }
@@ -1,38 +1,80 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"testing"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/discordmsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/usecase/status"
 )
 
 type fakeDiscordSender struct {
-	calls []string
-	err   error
+	calls   []discordmsg.Payload
+	edits   []string
+	deletes []string
+	err     error
+}
+
+func (f *fakeDiscordSender) Send(p discordmsg.Payload) (message.RemoteRef, error) {
+	f.calls = append(f.calls, p)
+	if f.err != nil {
+		return message.RemoteRef{}, f.err
+	}
+	return message.RemoteRef{MessageID: "111", ThreadID: p.ThreadID}, nil
 }
 
-func (f *fakeDiscordSender) Send(text string) error {
-	f.calls = append(f.calls, text)
+func (f *fakeDiscordSender) Edit(ref message.RemoteRef, p discordmsg.Payload) error {
+	f.edits = append(f.edits, ref.MessageID+" "+p.Content)
 	return f.err
 }
 
+func (f *fakeDiscordSender) Delete(ref message.RemoteRef) error {
+	f.deletes = append(f.deletes, ref.MessageID)
+	return f.err
+}
+
+type fakeRemoteRefs struct {
+	statuses map[string]message.Status
+	saved    map[string]message.RemoteRef
+}
+
+func (f *fakeRemoteRefs) Get(_ context.Context, id string) (message.Status, error) {
+	st, ok := f.statuses[id]
+	if !ok {
+		return message.Status{}, status.ErrNotFound
+	}
+	return st, nil
+}
+
+func (f *fakeRemoteRefs) SaveRemote(_ context.Context, id string, ref message.RemoteRef) error {
+	if f.saved == nil {
+		f.saved = map[string]message.RemoteRef{}
+	}
+	f.saved[id] = ref
+	return nil
+}
+
 func TestDiscordWorker_HandleMessage_Success(t *testing.T) {
 	sender := &fakeDiscordSender{}
-	w := NewDiscordWorker("subject", sender, func(format string, v ...any) {})
+	w := NewDiscordWorker("subject", sender, nil, func(format string, v ...any) {})
 
 	payload := []byte(`{"destination":"dest","userId":"U1","message":{"message":"hi"},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err != nil {
+	if err := w.handleMessage(payload, nil); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(sender.calls) != 1 || sender.calls[0] != "hi" {
+	if len(sender.calls) != 1 || sender.calls[0].Content != "hi" {
 		t.Fatalf("unexpected calls: %+v", sender.calls)
 	}
 }
 
 func TestDiscordWorker_HandleMessage_Empty(t *testing.T) {
 	sender := &fakeDiscordSender{}
-	w := NewDiscordWorker("subject", sender, func(format string, v ...any) {})
+	w := NewDiscordWorker("subject", sender, nil, func(format string, v ...any) {})
 
 	payload := []byte(`{"destination":"dest","userId":"U1","message":{"message":""},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err == nil {
+	if err := w.handleMessage(payload, nil); err == nil {
 		t.Fatalf("expected error")
 	}
 	if len(sender.calls) != 0 {
@@ -42,17 +84,107 @@ func TestDiscordWorker_HandleMessage_Empty(t *testing.T) {
 
 func TestDiscordWorker_HandleMessage_LongText(t *testing.T) {
 	sender := &fakeDiscordSender{}
-	w := NewDiscordWorker("subject", sender, func(format string, v ...any) {})
+	w := NewDiscordWorker("subject", sender, nil, func(format string, v ...any) {})
 
 	long := make([]byte, 5000)
 	for i := range long {
 		long[i] = 'a'
 	}
 	payload := []byte(`{"destination":"dest","userId":"U1","message":{"message":"` + string(long) + `"},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err != nil {
+	if err := w.handleMessage(payload, nil); err != nil {
 		t.Fatalf("unexpected error for long text: %v", err)
 	}
-	if len(sender.calls) != 1 || len(sender.calls[0]) != len(long) {
-		t.Fatalf("unexpected calls length: %v", sender.calls)
+	if len(sender.calls) != 1 || len(sender.calls[0].Content) != len(long) {
+		t.Fatalf("unexpected calls length: %v", len(sender.calls))
+	}
+}
+
+// 投稿内容付きの送信は投稿IDを保存し、編集・削除はその投稿IDを使う。
+func TestDiscordWorker_HandleMessage_Actions(t *testing.T) {
+	t.Parallel()
+
+	const target = "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d"
+	tests := []struct {
+		name          string
+		payload       string
+		target        *message.Status
+		wantErr       bool
+		wantPermanent bool
+		wantSaved     *message.RemoteRef
+		wantEdits     []string
+		wantDeletes   []string
+	}{
+		{
+			name:      "埋め込み付きで送信",
+			payload:   `{"id":"op-1","destination":"discord","discord":{"embeds":[{"title":"障害"}],"threadId":"222"}}`,
+			wantSaved: &message.RemoteRef{MessageID: "111", ThreadID: "222"},
+		},
+		{
+			name:      "編集",
+			payload:   `{"id":"op-1","destination":"discord","action":"edit","target":"` + target + `","discord":{"content":"復旧"}}`,
+			target:    &message.Status{State: message.StateDelivered, Remote: &message.RemoteRef{MessageID: "999"}},
+			wantEdits: []string{"999 復旧"},
+		},
+		{
+			name:        "削除",
+			payload:     `{"id":"op-1","destination":"discord","action":"delete","target":"` + target + `"}`,
+			target:      &message.Status{State: message.StateDelivered, Remote: &message.RemoteRef{MessageID: "999"}},
+			wantDeletes: []string{"999"},
+		},
+		{
+			name:    "対象が未送信なら再送で待つ",
+			payload: `{"id":"op-1","destination":"discord","action":"delete","target":"` + target + `"}`,
+			target:  &message.Status{State: message.StateQueued},
+			wantErr: true,
+		},
+		{
+			name:          "対象が配送不能なら諦める",
+			payload:       `{"id":"op-1","destination":"discord","action":"delete","target":"` + target + `"}`,
+			target:        &message.Status{State: message.StateDeadLettered},
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:          "対象の記録なし",
+			payload:       `{"id":"op-1","destination":"discord","action":"edit","target":"` + target + `","discord":{"content":"x"}}`,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:          "未知の操作",
+			payload:       `{"id":"op-1","destination":"discord","action":"pin"}`,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &fakeDiscordSender{}
+			refs := &fakeRemoteRefs{statuses: map[string]message.Status{}}
+			if tt.target != nil {
+				refs.statuses[target] = *tt.target
+			}
+			w := NewDiscordWorker("subject", sender, refs, t.Logf)
+
+			err := w.handleMessage([]byte(tt.payload), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err=%v wantErr=%v", err, tt.wantErr)
+			}
+			var p *permanentError
+			if tt.wantErr && errors.As(err, &p) != tt.wantPermanent {
+				t.Fatalf("err=%v permanent want=%v", err, tt.wantPermanent)
+			}
+			if tt.wantSaved != nil && refs.saved["op-1"] != *tt.wantSaved {
+				t.Fatalf("saved=%+v want=%+v", refs.saved, *tt.wantSaved)
+			}
+			if len(sender.edits) != len(tt.wantEdits) || (len(tt.wantEdits) > 0 && sender.edits[0] != tt.wantEdits[0]) {
+				t.Fatalf("edits=%v want=%v", sender.edits, tt.wantEdits)
+			}
+			if len(sender.deletes) != len(tt.wantDeletes) || (len(tt.wantDeletes) > 0 && sender.deletes[0] != tt.wantDeletes[0]) {
+				t.Fatalf("deletes=%v want=%v", sender.deletes, tt.wantDeletes)
+			}
+		})
 	}
 }
@@ -1,14 +1,17 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
 	"github.com/sngm3741/roots/base/message/internal/infra/line"
 )
 
@@ -16,49 +19,133 @@ import (
 type LineWorker struct {
 	subject string
 	client  line.Pusher
-	logger  func(format string, v ...any)
+	// refs が nil ならナローキャストのリクエストIDを保存しない。
+	refs   RemoteRefStore
+	logger func(format string, v ...any)
 }
 
 // NewLineWorker はLineWorkerを初期化する。
-func NewLineWorker(subject string, client line.Pusher, logger func(format string, v ...any)) *LineWorker {
+func NewLineWorker(subject string, client line.Pusher, refs RemoteRefStore, logger func(format string, v ...any)) *LineWorker {
 	return &LineWorker{
 		subject: subject,
 		client:  client,
+		refs:    refs,
 		logger:  logger,
 	}
 }
 
-// Subscribe はNATSの購読を開始する。
-func (w *LineWorker) Subscribe(nc *nats.Conn) error {
-	_, err := nc.Subscribe(w.subject, func(msg *nats.Msg) {
-		if err := w.handleMessage(msg.Data); err != nil {
-			w.logger("line worker error: %v", err)
-		}
-	})
-	if err != nil {
-		return err
+// Start はJetStreamの永続プルコンシューマで購読を開始する。失敗は policy に従って再送し、
+// 諦めたものは配送不能キューへ移す。status が nil でなければ配送状態を記録する。
+func (w *LineWorker) Start(ctx context.Context, js jetstream.JetStream, stream string, policy DeliveryPolicy, status StatusRecorder) (jetstream.ConsumeContext, error) {
+	c := &consumer{
+		name:        "line-worker",
+		subject:     w.subject,
+		destination: "line",
+		policy:      policy,
+		dlq:         js,
+		status:      status,
+		handle:      w.handleMessage,
+		logger:      w.logger,
+		now:         time.Now,
 	}
-	return nc.Flush()
+	return c.start(ctx, js, stream)
 }
 
-func (w *LineWorker) handleMessage(data []byte) error {
+func (w *LineWorker) handleMessage(data []byte, progress func()) error {
 	var payload lineeventPayload
 	if err := json.Unmarshal(data, &payload); err != nil {
-		return fmt.Errorf("decode payload: %w", err)
+		return permanent(fmt.Errorf("decode payload: %w", err))
 	}
-	text, err := extractLineText(payload.Message)
+	// 受信イベントは events.lineSubject に流すが、以前の webhook が送信サブジェクトへ流したものは読み飛ばす。
+	if len(payload.Source) > 0 {
+		w.logger("line-worker: skip inbound event on delivery subject event_type=%s", payload.EventType)
+		return nil
+	}
+	messages, err := lineMessages(payload)
 	if err != nil {
-		return err
+		return permanent(err)
+	}
+	err = w.deliver(payload, messages, progress)
+	if errors.Is(err, line.ErrEndpointNotConfigured) {
+		return permanent(err)
+	}
+	return err
+}
+
+// deliver は宛先に応じたAPIで送る。メッセージIDはどのAPIでもリトライキーに使う。
+// マルチキャストは分けて送るたびに progress を呼び、長くかかっても再配送されないようにする。
+func (w *LineWorker) deliver(payload lineeventPayload, messages []linemsg.Message, progress func()) error {
+	switch payload.Destination {
+	case message.DestinationLineMulticast:
+		if len(payload.UserIDs) == 0 {
+			return permanent(errors.New("userIds empty"))
+		}
+		return w.client.Multicast(payload.UserIDs, messages, payload.ID, progress)
+	case message.DestinationLineBroadcast:
+		return w.client.Broadcast(messages, payload.ID)
+	case message.DestinationLineNarrowcast:
+		var n linemsg.Narrowcast
+		if len(payload.Narrowcast) > 0 {
+			parsed, err := linemsg.ParseNarrowcast(payload.Narrowcast)
+			if err != nil {
+				return permanent(err)
+			}
+			n = *parsed
+		}
+		requestID, err := w.client.Narrowcast(n, messages, payload.ID)
+		if err != nil {
+			return err
+		}
+		w.saveRequestID(payload.ID, requestID)
+		return nil
+	default:
+		if strings.TrimSpace(payload.UserID) == "" {
+			return permanent(errors.New("userId empty"))
+		}
+		return w.client.Push(payload.UserID, messages, payload.ID)
+	}
+}
+
+// saveRequestID はナローキャストの進捗を照会できるよう、LINEのリクエストIDを保存する。
+// 送信は受理されているので、保存に失敗しても再送はせずログに残すだけにする。
+func (w *LineWorker) saveRequestID(id, requestID string) {
+	if w.refs == nil || id == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusRecordTimeout)
+	defer cancel()
+	if err := w.refs.SaveRemote(ctx, id, message.RemoteRef{MessageID: requestID}); err != nil {
+		w.logger("line-worker: save narrowcast request id failed id=%s request_id=%s: %v", id, requestID, err)
 	}
-	return w.client.Push(payload.UserID, text)
 }
 
 type lineeventPayload struct {
-	Destination string          `json:"destination"`
-	EventType   string          `json:"eventType"`
-	UserID      string          `json:"userId"`
-	Message     json.RawMessage `json:"message"`
-	ReceivedAt  time.Time       `json:"receivedAt"`
+	// ID は ingress が付けたメッセージID（UUID）。LINEのリトライキーに使う。
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	EventType   string `json:"eventType"`
+	UserID      string `json:"userId"`
+	// UserIDs は line-multicast の宛先。
+	UserIDs []string `json:"userIds"`
+	// Narrowcast は line-narrowcast の宛先と絞り込み条件。
+	Narrowcast json.RawMessage `json:"narrowcast"`
+	Message    json.RawMessage `json:"message"`
+	// Messages は ingress が検証した型付きメッセージ。ある場合は Message より優先する。
+	Messages   []json.RawMessage `json:"messages"`
+	Source     json.RawMessage   `json:"source"`
+	ReceivedAt time.Time         `json:"receivedAt"`
+}
+
+// lineMessages は送るメッセージを取り出す。テキストだけの要求は1件のテキストメッセージにする。
+func lineMessages(payload lineeventPayload) ([]linemsg.Message, error) {
+	if len(payload.Messages) > 0 {
+		return linemsg.Parse(payload.Messages)
+	}
+	text, err := extractLineText(payload.Message)
+	if err != nil {
+		return nil, err
+	}
+	return []linemsg.Message{linemsg.Text{Text: text}}, nil
 }
 
 func extractLineText(raw json.RawMessage) (string, error) {
@@ -77,8 +164,8 @@ func extractLineText(raw json.RawMessage) (string, error) {
 	return body.Message, nil
 }
 
-// BuildLineWorker はLineWorker購読をセットアップする。
-func BuildLineWorker(subject string, nc *nats.Conn, client line.Pusher, logger func(format string, v ...any)) error {
-	w := NewLineWorker(subject, client, logger)
-	return w.Subscribe(nc)
+// BuildLineWorker はLineWorkerの購読をセットアップする。
+func BuildLineWorker(ctx context.Context, subject string, js jetstream.JetStream, stream string, policy DeliveryPolicy, status StatusRecorder, refs RemoteRefStore, client line.Pusher, logger func(format string, v ...any)) (jetstream.ConsumeContext, error) {
+	w := NewLineWorker(subject, client, refs, logger)
+	return w.Start(ctx, js, stream, policy, status)
 }
@@ -1,45 +1,87 @@
 package worker
 
 import (
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sngm3741/roots/base/message/internal/domain/linemsg"
+	"github.com/sngm3741/roots/base/message/internal/domain/message"
+	"github.com/sngm3741/roots/base/message/internal/infra/line"
 )
 
 type fakeLinePusher struct {
 	calls []struct {
-		userID string
-		text   string
+		userID   string
+		text     string
+		messages []linemsg.Message
+		retryKey string
+	}
+	// others はマルチキャスト・ブロードキャスト・ナローキャストの呼び出しを "API 宛先 リトライキー" で控える。
+	others []string
+	err    error
+}
+
+// Multicast は本物と同じく、2つ目以降の塊を送る前に progress を呼ぶ。
+func (f *fakeLinePusher) Multicast(userIDs []string, _ []linemsg.Message, retryKey string, progress func()) error {
+	for i := linemsg.MaxMulticastRecipients; i < len(userIDs) && progress != nil; i += linemsg.MaxMulticastRecipients {
+		progress()
+	}
+	f.others = append(f.others, "multicast "+strings.Join(userIDs, ",")+" "+retryKey)
+	return f.err
+}
+
+func (f *fakeLinePusher) Broadcast(_ []linemsg.Message, retryKey string) error {
+	f.others = append(f.others, "broadcast - "+retryKey)
+	return f.err
+}
+
+func (f *fakeLinePusher) Narrowcast(n linemsg.Narrowcast, _ []linemsg.Message, retryKey string) (string, error) {
+	var audience int64
+	if n.Recipient != nil {
+		audience = n.Recipient.AudienceGroupID
 	}
-	err error
+	f.others = append(f.others, "narrowcast "+strconv.FormatInt(audience, 10)+" "+retryKey)
+	return "req-1", f.err
 }
 
-func (f *fakeLinePusher) Push(userID, text string) error {
+// Push は1件目がテキストならその本文を text に控える。
+func (f *fakeLinePusher) Push(userID string, messages []linemsg.Message, retryKey string) error {
+	var text string
+	if t, ok := messages[0].(linemsg.Text); ok {
+		text = t.Text
+	}
 	f.calls = append(f.calls, struct {
-		userID string
-		text   string
-	}{userID, text})
+		userID   string
+		text     string
+		messages []linemsg.Message
+		retryKey string
+	}{userID, text, messages, retryKey})
 	return f.err
 }
 
 func TestLineWorker_HandleMessage_Success(t *testing.T) {
 	p := &fakeLinePusher{}
-	w := NewLineWorker("subject", p, func(format string, v ...any) {})
+	w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
 
-	payload := []byte(`{"destination":"dest","eventType":"message","userId":"U1","message":{"message":"hi"},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err != nil {
+	payload := []byte(`{"id":"0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d","destination":"dest","eventType":"message","userId":"U1","message":{"message":"hi"},"receivedAt":"2025-01-01T00:00:00Z"}`)
+	if err := w.handleMessage(payload, nil); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(p.calls) != 1 || p.calls[0].userID != "U1" || p.calls[0].text != "hi" {
+	if len(p.calls) != 1 || p.calls[0].userID != "U1" || p.calls[0].text != "hi" || p.calls[0].retryKey != "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d" {
 		t.Fatalf("unexpected calls: %+v", p.calls)
 	}
 }
 
 func TestLineWorker_HandleMessage_EmptyMessage(t *testing.T) {
 	p := &fakeLinePusher{}
-	w := NewLineWorker("subject", p, func(format string, v ...any) {})
+	w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
 
 	payload := []byte(`{"destination":"dest","eventType":"message","userId":"U1","message":{"message":""},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err == nil {
+	if err := w.handleMessage(payload, nil); err == nil {
 		t.Fatalf("expected error for empty message")
 	}
 	if len(p.calls) != 0 {
@@ -50,23 +92,157 @@ func TestLineWorker_HandleMessage_EmptyMessage(t *testing.T) {
 func TestLineWorker_Subscribe_CallbackError(t *testing.T) {
 	// This test ensures Subscribe sets up the handler; nats.Conn is not invoked here.
 	p := &fakeLinePusher{err: errors.New("push fail")}
-	w := NewLineWorker("subject", p, func(format string, v ...any) {})
+	w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
 	_ = w // subscribe is not invoked because it requires live NATS; handled in integration env.
 }
 
 func TestLineWorker_HandleMessage_LongText(t *testing.T) {
 	p := &fakeLinePusher{}
-	w := NewLineWorker("subject", p, func(format string, v ...any) {})
+	w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
 
 	long := make([]byte, 4000)
 	for i := range long {
 		long[i] = 'b'
 	}
 	payload := []byte(`{"destination":"dest","eventType":"message","userId":"U1","message":{"message":"` + string(long) + `"},"receivedAt":"2025-01-01T00:00:00Z"}`)
-	if err := w.handleMessage(payload); err != nil {
+	if err := w.handleMessage(payload, nil); err != nil {
 		t.Fatalf("unexpected error for long text: %v", err)
 	}
 	if len(p.calls) != 1 || p.calls[0].text != string(long) {
 		t.Fatalf("unexpected calls: %+v", p.calls)
 	}
 }
+
+// webhook が中継した受信イベントは送信せずに読み飛ばす。
+func TestLineWorker_HandleMessage_SkipsInboundEvent(t *testing.T) {
+	p := &fakeLinePusher{}
+	w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
+
+	payload := []byte(`{"destination":"dest","eventType":"follow","userId":"U1","source":{"type":"user","userId":"U1"},"receivedAt":"2025-01-01T00:00:00Z"}`)
+	if err := w.handleMessage(payload, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.calls) != 0 {
+		t.Fatalf("expected no calls")
+	}
+}
+
+// 型付きメッセージはそのまま Push に渡し、不正なものは再送しない失敗にする。
+func TestLineWorker_HandleMessage_Messages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		messages      string
+		wantTypes     []linemsg.Type
+		wantPermanent bool
+	}{
+		{name: "複数種別", messages: `[{"type":"sticker","packageId":"1","stickerId":"2"},{"type":"flex","altText":"x","contents":{"type":"bubble"}}]`, wantTypes: []linemsg.Type{linemsg.TypeSticker, linemsg.TypeFlex}},
+		{name: "不正な種別", messages: `[{"type":"video"}]`, wantPermanent: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := &fakeLinePusher{}
+			w := NewLineWorker("subject", p, nil, func(format string, v ...any) {})
+			payload := []byte(`{"id":"m1","destination":"line","userId":"U1","messages":` + tt.messages + `,"receivedAt":"2025-01-01T00:00:00Z"}`)
+			err := w.handleMessage(payload, nil)
+			if tt.wantPermanent {
+				if err == nil || retryable(err) || len(p.calls) != 0 {
+					t.Fatalf("err=%v calls=%d", err, len(p.calls))
+				}
+				return
+			}
+			if err != nil || len(p.calls) != 1 {
+				t.Fatalf("err=%v calls=%d", err, len(p.calls))
+			}
+			for i, m := range p.calls[0].messages {
+				if m.Type() != tt.wantTypes[i] {
+					t.Fatalf("messages[%d]=%s want=%s", i, m.Type(), tt.wantTypes[i])
+				}
+			}
+		})
+	}
+}
+
+// マルチキャスト・ブロードキャスト・ナローキャストは宛先に応じたAPIで送り、
+// ナローキャストのリクエストIDを保存する。
+func TestLineWorker_HandleMessage_Destinations(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		payload       string
+		err           error
+		wantCall      string
+		wantSaved     string
+		wantPermanent bool
+	}{
+		{name: "マルチキャスト", payload: `{"id":"m1","destination":"line-multicast","userIds":["U1","U2"],"message":{"message":"hi"}}`, wantCall: "multicast U1,U2 m1"},
+		{name: "ブロードキャスト", payload: `{"id":"m1","destination":"line-broadcast","message":{"message":"hi"}}`, wantCall: "broadcast - m1"},
+		{name: "ナローキャスト", payload: `{"id":"m1","destination":"line-narrowcast","narrowcast":{"recipient":{"type":"audience","audienceGroupId":2}},"message":{"message":"hi"}}`, wantCall: "narrowcast 2 m1", wantSaved: "req-1"},
+		{name: "宛先なしのマルチキャスト", payload: `{"id":"m1","destination":"line-multicast","message":{"message":"hi"}}`, wantPermanent: true},
+		{name: "エンドポイント未設定", payload: `{"id":"m1","destination":"line-broadcast","message":{"message":"hi"}}`, err: line.ErrEndpointNotConfigured, wantCall: "broadcast - m1", wantPermanent: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := &fakeLinePusher{err: tt.err}
+			refs := &fakeRemoteRefs{}
+			w := NewLineWorker("subject", p, refs, t.Logf)
+
+			err := w.handleMessage([]byte(tt.payload), nil)
+			if tt.wantPermanent {
+				if err == nil || retryable(err) {
+					t.Fatalf("err=%v want permanent", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantCall != "" && (len(p.others) != 1 || p.others[0] != tt.wantCall) {
+				t.Fatalf("calls=%v want=%q", p.others, tt.wantCall)
+			}
+			if len(p.calls) != 0 {
+				t.Fatalf("push must not be called: %+v", p.calls)
+			}
+			if got := refs.saved["m1"]; got != (message.RemoteRef{MessageID: tt.wantSaved}) {
+				t.Fatalf("saved=%+v want=%q", got, tt.wantSaved)
+			}
+		})
+	}
+}
+
+// 分けて送るマルチキャストは塊ごとに InProgress を送り、AckWait を過ぎても再配送されないようにする。
+func TestLineWorker_MulticastReportsProgress(t *testing.T) {
+	t.Parallel()
+
+	ids := make([]string, 2*linemsg.MaxMulticastRecipients+1)
+	for i := range ids {
+		ids[i] = "U" + strconv.Itoa(i)
+	}
+	payload, err := json.Marshal(map[string]any{
+		"id":          "0b7c5f5e-2d1a-4f3b-9c8d-7e6f5a4b3c2d",
+		"destination": message.DestinationLineMulticast,
+		"userIds":     ids,
+		"message":     map[string]string{"message": "hi"},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	w := NewLineWorker("line.events.t1", &fakeLinePusher{}, nil, func(string, ...any) {})
+	c := &consumer{
+		name:    "line-worker",
+		subject: "line.events.t1",
+		policy:  DeliveryPolicy{MaxDeliver: 5},
+		handle:  w.handleMessage,
+		logger:  func(string, ...any) {},
+		now:     time.Now,
+	}
+	msg := &fakeMsg{subject: "line.events.t1", data: payload, delivered: 1}
+	c.process(msg)
+	if !msg.acked || msg.inProgress != 2 {
+		t.Fatalf("acked=%v inProgress=%d want 2", msg.acked, msg.inProgress)
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/sngm3741/roots/base/storage/internal/adapter/http/handler"
 	"github.com/sngm3741/roots/base/storage/internal/config"
+	"github.com/sngm3741/roots/base/storage/internal/infra/serviceauth"
 	"github.com/sngm3741/roots/base/storage/internal/infra/storage"
 	"github.com/sngm3741/roots/base/storage/internal/usecase/upload"
 )
@@ -34,6 +35,15 @@ func main() {
 
 	uc := upload.NewService(uploader, cfg.AllowedTypes, cfg.MaxUploadBytes)
 	uploadHandler := handler.NewUploadHandler(uc, cfg.MaxUploadBytes)
+	if cfg.AuthIssuer != "" {
+		uploadHandler.WithVerifier(serviceauth.NewVerifier(&http.Client{Timeout: cfg.HTTPTimeout}, serviceauth.Config{
+			Issuer:   cfg.AuthIssuer,
+			JWKSURL:  cfg.AuthJWKSURL,
+			Audience: "storage",
+			Scope:    "storage:write",
+		}))
+		log.Printf("service token verification enabled (issuer=%s)", cfg.AuthIssuer)
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID, middleware.RealIP, middleware.Recoverer, middleware.Timeout(30*time.Second))
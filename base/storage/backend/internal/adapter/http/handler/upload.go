@@ -4,20 +4,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/sngm3741/roots/base/storage/internal/infra/serviceauth"
 	"github.com/sngm3741/roots/base/storage/internal/usecase/upload"
 )
 
 // UploadHandler はHTTP経由のアップロードを受け付ける。
 type UploadHandler struct {
-	usecase uploadService
-	maxBody int64
+	usecase  uploadService
+	maxBody  int64
+	verifier tokenVerifier
+}
+
+// tokenVerifier はauthが発行したサービストークンを検証する。
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (*serviceauth.Claims, error)
 }
 
 // uploadService はusecase.Uploadのインターフェース。
@@ -33,6 +43,12 @@ func NewUploadHandler(uc uploadService, maxBody int64) *UploadHandler {
 	}
 }
 
+// WithVerifier はアップロードにサービストークン（storage:write）を要求する。nilなら認証しない。
+func (h *UploadHandler) WithVerifier(v tokenVerifier) *UploadHandler {
+	h.verifier = v
+	return h
+}
+
 // Router は/healthzと/uploadsを持つルーターを返す。
 func (h *UploadHandler) Router() http.Handler {
 	r := chi.NewRouter()
@@ -47,6 +63,10 @@ func (h *UploadHandler) Router() http.Handler {
 }
 
 func (h *UploadHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if h.verifier != nil && !h.authorize(w, r) {
+		return
+	}
+
 	r.Body = http.MaxBytesReader(w, r.Body, h.maxBody+1024)
 	if err := r.ParseMultipartForm(h.maxBody); err != nil {
 		http.Error(w, "failed to parse multipart form", http.StatusBadRequest)
@@ -96,3 +116,29 @@ func (h *UploadHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		"key": key,
 	})
 }
+
+// authorize はBearerトークンを検証し、失敗時のレスポンスを書き込んでfalseを返す。
+func (h *UploadHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="storage"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	_, err := h.verifier.Verify(r.Context(), strings.TrimSpace(header[7:]))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, serviceauth.ErrInsufficientScope):
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="storage:write"`)
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, serviceauth.ErrInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	default:
+		log.Printf("service token verification failed: %v", err)
+		http.Error(w, "token verification unavailable", http.StatusServiceUnavailable)
+	}
+	return false
+}
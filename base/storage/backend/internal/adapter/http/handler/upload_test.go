@@ -3,12 +3,14 @@ package handler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/sngm3741/roots/base/storage/internal/infra/serviceauth"
 	"github.com/sngm3741/roots/base/storage/internal/usecase/upload"
 )
 
@@ -76,3 +78,61 @@ func TestUploadHandler_HandleUpload(t *testing.T) {
 		})
 	}
 }
+
+type fakeVerifier struct {
+	err error
+}
+
+func (f *fakeVerifier) Verify(ctx context.Context, token string) (*serviceauth.Claims, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &serviceauth.Claims{ClientID: "lilink-backend", Scopes: []string{"storage:write"}}, nil
+}
+
+// サービストークン検証が有効な場合の認可マッピングを検証する。
+func TestUploadHandler_ServiceAuth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		header    string
+		verifyErr error
+		wantCode  int
+	}{
+		{name: "正常", header: "Bearer tok", wantCode: http.StatusOK},
+		{name: "ヘッダなしで401", wantCode: http.StatusUnauthorized},
+		{name: "不正トークンで401", header: "Bearer tok", verifyErr: serviceauth.ErrInvalidToken, wantCode: http.StatusUnauthorized},
+		{name: "スコープ不足で403", header: "Bearer tok", verifyErr: serviceauth.ErrInsufficientScope, wantCode: http.StatusForbidden},
+		{name: "JWKS取得失敗で503", header: "Bearer tok", verifyErr: errors.New("jwks down"), wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := &fakeUploadUsecase{key: "k", url: "http://example.com/k"}
+			h := NewUploadHandler(fake, 1024).WithVerifier(&fakeVerifier{err: tt.verifyErr})
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("file", "test.txt")
+			_, _ = io.Copy(part, bytes.NewBufferString("hello"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/uploads", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			h.Router().ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
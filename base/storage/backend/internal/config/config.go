@@ -19,6 +19,9 @@ type Config struct {
 	MaxUploadBytes  int64
 	AllowedTypes    []string
 	HTTPTimeout     time.Duration
+	// AuthIssuer を設定するとアップロードにauthのサービストークンを要求する。
+	AuthIssuer  string
+	AuthJWKSURL string
 }
 
 const (
@@ -38,6 +41,8 @@ func Load() (Config, error) {
 		MaxUploadBytes:  defaultMaxUploadBytes,
 		AllowedTypes:    parseList("STORAGE_ALLOWED_TYPES", []string{"image/"}),
 		HTTPTimeout:     parseDuration("STORAGE_HTTP_TIMEOUT", 10*time.Second),
+		AuthIssuer:      strings.TrimSpace(os.Getenv("STORAGE_AUTH_ISSUER")),
+		AuthJWKSURL:     strings.TrimSpace(os.Getenv("STORAGE_AUTH_JWKS_URL")),
 	}
 
 	if v := strings.TrimSpace(os.Getenv("STORAGE_MAX_UPLOAD_BYTES")); v != "" {
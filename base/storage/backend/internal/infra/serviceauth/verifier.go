@@ -0,0 +1,252 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken は署名・発行者・期限・宛先のいずれかが不正な場合に返す。
+	ErrInvalidToken = errors.New("serviceauth: invalid token")
+	// ErrInsufficientScope は必要なスコープを持たないトークンの場合に返す。
+	ErrInsufficientScope = errors.New("serviceauth: insufficient scope")
+)
+
+// Config はサービストークンの検証設定。
+type Config struct {
+	// Issuer はauthのテナント発行者URL（例: https://tenantA.auth.example.com）。
+	Issuer string
+	// JWKSURL は省略時 Issuer + "/.well-known/jwks.json"。
+	JWKSURL string
+	// Audience はこのサービスの名前（storage:write なら storage）。
+	Audience string
+	// Scope は要求に必要なスコープ。
+	Scope string
+}
+
+// Claims は検証済みトークンから取り出した呼び出し元情報。
+type Claims struct {
+	ClientID string
+	Scopes   []string
+}
+
+// Verifier はauthが client_credentials で発行したRS256トークンを検証する。
+type Verifier struct {
+	issuer   string
+	audience string
+	scope    string
+	keys     *jwksCache
+	now      func() time.Time
+}
+
+// NewVerifier はVerifierを生成する。公開鍵は初回検証時に取得してキャッシュする。
+func NewVerifier(httpClient *http.Client, cfg Config) *Verifier {
+	issuer := strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/")
+	jwksURL := strings.TrimSpace(cfg.JWKSURL)
+	if jwksURL == "" {
+		jwksURL = issuer + "/.well-known/jwks.json"
+	}
+	return &Verifier{
+		issuer:   issuer,
+		audience: cfg.Audience,
+		scope:    cfg.Scope,
+		keys:     newJWKSCache(httpClient, jwksURL, time.Hour),
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Verify はトークンを検証し、必要なスコープを持つ場合に呼び出し元情報を返す。
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "RS256" {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims struct {
+		Iss      string          `json:"iss"`
+		Aud      json.RawMessage `json:"aud"`
+		Exp      int64           `json:"exp"`
+		ClientID string          `json:"client_id"`
+		Scope    string          `json:"scope"`
+	}
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Iss != v.issuer || v.now().Unix() >= claims.Exp || !audienceContains(claims.Aud, v.audience) {
+		return nil, ErrInvalidToken
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	if v.scope != "" && !contains(scopes, v.scope) {
+		return nil, ErrInsufficientScope
+	}
+	return &Claims{ClientID: claims.ClientID, Scopes: scopes}, nil
+}
+
+// audienceContains は aud（文字列または配列）に want が含まれるかを返す。
+func audienceContains(raw json.RawMessage, want string) bool {
+	if want == "" {
+		return true
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == want
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return contains(list, want)
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// minRefreshInterval は未知のkidによるJWKS再取得の最短間隔。
+const minRefreshInterval = time.Minute
+
+// jwksCache はauthの公開鍵セットを取得し、一定時間キャッシュする。
+type jwksCache struct {
+	httpClient *http.Client
+	endpoint   string
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKSCache(httpClient *http.Client, endpoint string, ttl time.Duration) *jwksCache {
+	return &jwksCache{
+		httpClient: httpClient,
+		endpoint:   endpoint,
+		ttl:        ttl,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Key はkidに対応する公開鍵を返す。キャッシュにない場合は鍵ローテーションを考慮して再取得する。
+func (c *jwksCache) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := c.now().Sub(c.fetchedAt)
+	if c.keys != nil && age < c.ttl {
+		if key, ok := c.keys[kid]; ok {
+			return key, nil
+		}
+		// 未知のkidで再取得を繰り返させないよう、直近に取得済みなら拒否する。
+		if age < minRefreshInterval {
+			return nil, ErrInvalidToken
+		}
+	}
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("serviceauth jwks: create request: %w", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("serviceauth jwks: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("serviceauth jwks: read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("serviceauth jwks: status %d", res.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return fmt.Errorf("serviceauth jwks: decode response: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	c.keys = keys
+	c.fetchedAt = c.now()
+	return nil
+}
@@ -0,0 +1,113 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// サービストークンの検証をテーブル駆動で確認する。
+func TestVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+
+	v := NewVerifier(server.Client(), Config{
+		Issuer:   "https://tenant.auth.example.com",
+		JWKSURL:  server.URL,
+		Audience: "storage",
+		Scope:    "storage:write",
+	})
+
+	now := time.Now().Unix()
+	valid := map[string]any{
+		"iss":       "https://tenant.auth.example.com",
+		"aud":       []string{"message", "storage"},
+		"exp":       now + 300,
+		"client_id": "lilink-backend",
+		"scope":     "message:send storage:write",
+	}
+	with := func(k string, val any) map[string]any {
+		c := map[string]any{}
+		for kk, vv := range valid {
+			c[kk] = vv
+		}
+		c[k] = val
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "正常", token: signRS256(t, key, "k1", valid)},
+		{name: "audが文字列", token: signRS256(t, key, "k1", with("aud", "storage"))},
+		{name: "期限切れ", token: signRS256(t, key, "k1", with("exp", now-1)), wantErr: ErrInvalidToken},
+		{name: "発行者違い", token: signRS256(t, key, "k1", with("iss", "https://other.auth.example.com")), wantErr: ErrInvalidToken},
+		{name: "宛先違い", token: signRS256(t, key, "k1", with("aud", []string{"message"})), wantErr: ErrInvalidToken},
+		{name: "スコープ不足", token: signRS256(t, key, "k1", with("scope", "message:send")), wantErr: ErrInsufficientScope},
+		{name: "別の鍵で署名", token: signRS256(t, otherKey, "k1", valid), wantErr: ErrInvalidToken},
+		{name: "未知のkid", token: signRS256(t, key, "unknown", valid), wantErr: ErrInvalidToken},
+		{name: "形式不正", token: "not-a-jwt", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			claims, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err=%v want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.ClientID != "lilink-backend" {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}